@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Authorization errors
+var (
+	ErrAccessDenied     = errors.New("access denied")
+	ErrResourceNotFound = errors.New("resource not found")
+)
+
+// Scope is how far a role's permissions reach beyond its own record
+type Scope string
+
+const (
+	ScopeSelf     Scope = "self"      // Only the subject's own resident record
+	ScopeFamily   Scope = "family"    // Residents the subject is linked to as family
+	ScopeCareTeam Scope = "care_team" // Residents whose care team includes the subject, in the subject's facility
+	ScopeFacility Scope = "facility"  // Any resident in the subject's facility
+	ScopeGlobal   Scope = "global"    // Any resident
+)
+
+// RoleScopes maps roles to the residents their permissions apply to. Roles
+// without a scope can't access resident resources.
+var RoleScopes = map[Role]Scope{
+	RoleResident: ScopeSelf,
+	RoleFamily:   ScopeFamily,
+	RoleStaff:    ScopeCareTeam,
+	RoleProvider: ScopeCareTeam,
+	RoleAdmin:    ScopeFacility,
+	RoleSystem:   ScopeGlobal,
+}
+
+// ResourceOwner is the resident a resource belongs to and their facility
+type ResourceOwner struct {
+	ResidentID string
+	FacilityID string
+}
+
+// ResourceResolver finds who owns a resource. It returns
+// ErrResourceNotFound for unknown IDs.
+type ResourceResolver func(ctx context.Context, id string) (*ResourceOwner, error)
+
+// RelationshipStore answers relationship lookups between users and residents
+type RelationshipStore interface {
+	ResidentFacility(ctx context.Context, residentID string) (string, error)
+	IsCareTeamMember(ctx context.Context, userID, residentID string) (bool, error)
+	IsFamilyMember(ctx context.Context, userID, residentID string) (bool, error)
+}
+
+// Relationship keys
+func residentFacilityKey(residentID string) string {
+	return fmt.Sprintf("authz:resident:%s:facility", residentID)
+}
+
+func careTeamKey(residentID string) string {
+	return fmt.Sprintf("authz:resident:%s:care_team", residentID)
+}
+
+func familyKey(residentID string) string {
+	return fmt.Sprintf("authz:resident:%s:family", residentID)
+}
+
+// RedisRelationshipStore keeps resident facilities, care teams and family
+// links in Redis
+type RedisRelationshipStore struct {
+	redis *redis.Client
+}
+
+// NewRedisRelationshipStore creates a Redis relationship store
+func NewRedisRelationshipStore(redis *redis.Client) *RedisRelationshipStore {
+	return &RedisRelationshipStore{redis: redis}
+}
+
+// ResidentFacility returns a resident's facility
+func (r *RedisRelationshipStore) ResidentFacility(ctx context.Context, residentID string) (string, error) {
+	facilityID, err := r.redis.Get(ctx, residentFacilityKey(residentID)).Result()
+	if err == redis.Nil {
+		return "", ErrResourceNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load resident facility: %w", err)
+	}
+	return facilityID, nil
+}
+
+// IsCareTeamMember reports whether a user is on a resident's care team
+func (r *RedisRelationshipStore) IsCareTeamMember(ctx context.Context, userID, residentID string) (bool, error) {
+	ok, err := r.redis.SIsMember(ctx, careTeamKey(residentID), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check care team: %w", err)
+	}
+	return ok, nil
+}
+
+// CareTeam lists the users on a resident's care team
+func (r *RedisRelationshipStore) CareTeam(ctx context.Context, residentID string) ([]string, error) {
+	members, err := r.redis.SMembers(ctx, careTeamKey(residentID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list care team: %w", err)
+	}
+	return members, nil
+}
+
+// IsFamilyMember reports whether a user is linked to a resident as family
+func (r *RedisRelationshipStore) IsFamilyMember(ctx context.Context, userID, residentID string) (bool, error) {
+	ok, err := r.redis.SIsMember(ctx, familyKey(residentID), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check family link: %w", err)
+	}
+	return ok, nil
+}
+
+// SetResidentFacility records the facility a resident lives at
+func (r *RedisRelationshipStore) SetResidentFacility(ctx context.Context, residentID, facilityID string) error {
+	if err := r.redis.Set(ctx, residentFacilityKey(residentID), facilityID, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store resident facility: %w", err)
+	}
+	return nil
+}
+
+// AddCareTeamMember puts a user on a resident's care team
+func (r *RedisRelationshipStore) AddCareTeamMember(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SAdd(ctx, careTeamKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to add care team member: %w", err)
+	}
+	return nil
+}
+
+// RemoveCareTeamMember takes a user off a resident's care team
+func (r *RedisRelationshipStore) RemoveCareTeamMember(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SRem(ctx, careTeamKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to remove care team member: %w", err)
+	}
+	return nil
+}
+
+// LinkFamily links a user to a resident as family
+func (r *RedisRelationshipStore) LinkFamily(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SAdd(ctx, familyKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to link family member: %w", err)
+	}
+	return nil
+}
+
+// UnlinkFamily removes a user's family link to a resident
+func (r *RedisRelationshipStore) UnlinkFamily(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SRem(ctx, familyKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to unlink family member: %w", err)
+	}
+	return nil
+}
+
+// Authorizer decides whether a subject may act on a specific resource. A
+// request must pass both the role's permission and its scope, so staff at
+// one facility can't reach residents at another by guessing IDs.
+type Authorizer struct {
+	relationships RelationshipStore
+	roles         *RoleStore         // Optional; RolePermissions and RoleScopes when nil
+	delegations   *DelegationService // Optional; family scope then needs a delegation
+	auditLogger   AuditLogger
+	logger        *slog.Logger
+
+	mu        sync.RWMutex
+	resolvers map[string]ResourceResolver
+}
+
+// NewAuthorizer creates an authorizer. Residents are resolvable as the
+// "resident" resource type; register others with RegisterResource.
+func NewAuthorizer(relationships RelationshipStore, auditLogger AuditLogger, logger *slog.Logger) *Authorizer {
+	a := &Authorizer{
+		relationships: relationships,
+		auditLogger:   auditLogger,
+		logger:        logger,
+		resolvers:     make(map[string]ResourceResolver),
+	}
+	a.resolvers["resident"] = func(ctx context.Context, id string) (*ResourceOwner, error) {
+		facilityID, err := relationships.ResidentFacility(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &ResourceOwner{ResidentID: id, FacilityID: facilityID}, nil
+	}
+	return a
+}
+
+// SetRoleStore resolves permissions and scopes from role definitions,
+// including custom roles
+func (a *Authorizer) SetRoleStore(roles *RoleStore) {
+	a.roles = roles
+}
+
+// SetDelegations limits family access to what residents have delegated
+func (a *Authorizer) SetDelegations(delegations *DelegationService) {
+	a.delegations = delegations
+}
+
+// RegisterResource makes a resource type authorizable, e.g. crisis events
+// or sessions resolved to the resident they belong to
+func (a *Authorizer) RegisterResource(resourceType string, resolver ResourceResolver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.resolvers[resourceType] = resolver
+}
+
+// Authorize returns nil if the subject may perform action on the resource,
+// ErrAccessDenied or ErrResourceNotFound if not. Access granted through a
+// delegation is audited.
+func (a *Authorizer) Authorize(ctx context.Context, claims *Claims, action Permission, resourceType, id string) error {
+	delegation, err := a.authorize(ctx, claims, action, resourceType, id)
+	if err == nil && delegation != nil && a.auditLogger != nil {
+		a.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp:      time.Now(),
+			UserID:         claims.UserID,
+			Role:           claims.Role,
+			Resource:       resourceType + ":" + id,
+			Action:         "delegated_access",
+			SessionID:      claims.SessionID,
+			Success:        true,
+			Details:        delegation.auditDetails(action),
+			ImpersonatorID: impersonatorID(claims),
+		})
+	}
+	return err
+}
+
+// authorize is Authorize returning the delegation access was granted
+// through, if any
+func (a *Authorizer) authorize(ctx context.Context, claims *Claims, action Permission, resourceType, id string) (*Delegation, error) {
+	granted, scope, err := a.roleGrant(ctx, claims, action)
+	if err != nil {
+		return nil, err
+	}
+	if !granted && !scopeAllows(claims, action) {
+		return nil, deny(ReasonMissingScope, "token scopes lack %s", action)
+	}
+	if !granted {
+		return nil, deny(ReasonMissingPermission, "role %s lacks %s", claims.Role, action)
+	}
+
+	a.mu.RLock()
+	resolve, ok := a.resolvers[resourceType]
+	a.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown resource type %q", resourceType)
+	}
+	owner, err := resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if scope == ScopeFamily && a.delegations != nil {
+		return a.delegations.authorize(ctx, claims.UserID, owner.ResidentID, action)
+	}
+	return nil, a.checkScope(ctx, claims, scope, owner)
+}
+
+// roleGrant returns whether the subject's role grants action and the
+// role's scope
+func (a *Authorizer) roleGrant(ctx context.Context, claims *Claims, action Permission) (bool, Scope, error) {
+	if claims.IsService() {
+		return slices.Contains(claims.Scopes, action), ScopeGlobal, nil
+	}
+	if !scopeAllows(claims, action) {
+		return false, "", nil
+	}
+	if a.roles == nil {
+		return hasPermission(claims.Role, action), RoleScopes[claims.Role], nil
+	}
+	def, err := a.roles.Resolve(ctx, claims.FacilityID, claims.Role)
+	if errors.Is(err, ErrRoleNotFound) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return def.grants(action), def.Scope, nil
+}
+
+// checkScope applies a role scope to a resource owner
+func (a *Authorizer) checkScope(ctx context.Context, claims *Claims, scope Scope, owner *ResourceOwner) error {
+	if scope == ScopeGlobal {
+		return nil
+	}
+	if scope == ScopeSelf {
+		if claims.UserID != owner.ResidentID {
+			return deny(ReasonNotOwnRecord, "not the subject's own record")
+		}
+		return nil
+	}
+	if scope == ScopeFamily {
+		linked, err := a.relationships.IsFamilyMember(ctx, claims.UserID, owner.ResidentID)
+		if err != nil {
+			return err
+		}
+		if !linked {
+			return deny(ReasonNoFamilyLink, "no family link")
+		}
+		return nil
+	}
+
+	if claims.FacilityID == "" || claims.FacilityID != owner.FacilityID {
+		return deny(ReasonWrongFacility, "resident is at another facility")
+	}
+	switch scope {
+	case ScopeFacility:
+		return nil
+	case ScopeCareTeam:
+		member, err := a.relationships.IsCareTeamMember(ctx, claims.UserID, owner.ResidentID)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return deny(ReasonNotOnCareTeam, "not on the resident's care team")
+		}
+		return nil
+	default:
+		return deny(ReasonNoResidentScope, "role %s has no resident scope", claims.Role)
+	}
+}
+
+// RequireResourceAccess returns middleware that authorizes action on the
+// resource whose ID is in the paramName path parameter. It runs after
+// AuthMiddleware. Unknown resources are refused like forbidden ones so IDs
+// can't be probed.
+func (a *Authorizer) RequireResourceAccess(resourceType, paramName string, action Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "authentication required",
+			})
+			return
+		}
+
+		id := c.Param(paramName)
+		delegation, err := a.authorize(c.Request.Context(), claims, action, resourceType, id)
+		granted := err == nil
+		denied := errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrResourceNotFound)
+
+		if granted || denied {
+			details := map[string]interface{}{
+				"permission":    string(action),
+				"resource_type": resourceType,
+				"resource_id":   id,
+			}
+			reason := ReasonResourceInScope
+			if denied {
+				details["reason"] = err.Error()
+				reason = denialReason(err)
+			}
+			if delegation != nil {
+				maps.Copy(details, delegation.auditDetails(action))
+				reason = ReasonDelegated
+			}
+			logDecision(c.Request.Context(), a.auditLogger, requestEvent(c, claims, details), granted, reason)
+		}
+
+		switch {
+		case granted:
+			c.Next()
+		case denied:
+			a.logger.Warn("resource access denied",
+				slog.String("user_id", claims.UserID),
+				slog.String("role", string(claims.Role)),
+				slog.String("resource_type", resourceType),
+				slog.String("resource_id", id),
+				slog.String("reason", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "insufficient permissions",
+			})
+		default:
+			a.logger.Error("resource authorization failed",
+				slog.String("resource_type", resourceType),
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "authorization unavailable",
+			})
+		}
+	}
+}
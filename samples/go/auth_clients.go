@@ -0,0 +1,538 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Service token lifetime. Services fetch a new token rather than refresh.
+const serviceTokenExpiry = 10 * time.Minute
+
+// Service client errors
+var (
+	ErrInvalidClient  = errors.New("invalid client credentials")
+	ErrInvalidScope   = errors.New("requested scope not granted to client")
+	ErrClientNotFound = errors.New("service client not found")
+)
+
+// ClientSecret is a hashed service client secret. Secrets are 256 random
+// bits, so a plain SHA-256 resists offline guessing without a slow hash.
+// With a pepper configured the hash is an HMAC under it, so a leaked Redis
+// dump alone can't even confirm a guess.
+type ClientSecret struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"` // Hex SHA-256 of the secret, or "hmac:" and the hex HMAC-SHA256
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Set when rotated out
+}
+
+// active reports whether the secret can still be used
+func (cs *ClientSecret) active(now time.Time) bool {
+	return cs.ExpiresAt == nil || now.Before(*cs.ExpiresAt)
+}
+
+// ServiceClient is an internal service's machine identity
+type ServiceClient struct {
+	ClientID  string          `json:"client_id"`
+	Name      string          `json:"name"`
+	Scopes    []Permission    `json:"scopes"`
+	Audiences []string        `json:"audiences,omitempty"` // Services its tokens are valid for, by mesh ServiceType
+	Secrets   []*ClientSecret `json:"secrets"`
+	Disabled  bool            `json:"disabled"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ServiceToken is a client credentials grant response (RFC 6749 §4.4.3)
+type ServiceToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// clientKey holds a service client by ID
+func clientKey(clientID string) string {
+	return fmt.Sprintf("auth:client:%s", clientID)
+}
+
+// Prefix of client secret hashes keyed by the pepper
+const pepperedHashPrefix = "hmac:"
+
+// ClientRegistry registers service clients and issues their tokens
+type ClientRegistry struct {
+	auth   *AuthService
+	redis  *redis.Client
+	logger *slog.Logger
+
+	secrets    SecretProvider
+	pepperName string
+}
+
+// NewClientRegistry creates a client registry issuing tokens from auth
+func NewClientRegistry(auth *AuthService, redis *redis.Client, logger *slog.Logger) *ClientRegistry {
+	return &ClientRegistry{
+		auth:   auth,
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// SetPepper keys new client secret hashes with the named secret. Hashes
+// made before stay verifiable, as do those under the pepper's previous
+// value when secrets is a SecretCache.
+func (r *ClientRegistry) SetPepper(secrets SecretProvider, name string) {
+	r.secrets = secrets
+	r.pepperName = name
+}
+
+// peppers returns the current pepper followed by the previous one, or
+// none if no pepper is configured
+func (r *ClientRegistry) peppers(ctx context.Context) ([][]byte, error) {
+	if r.secrets == nil {
+		return nil, nil
+	}
+	pepper, err := r.secrets.Secret(ctx, r.pepperName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client secret pepper: %w", err)
+	}
+	peppers := [][]byte{pepper}
+	if cache, ok := r.secrets.(*SecretCache); ok {
+		if previous := cache.Previous(r.pepperName); previous != nil {
+			peppers = append(peppers, previous)
+		}
+	}
+	return peppers, nil
+}
+
+// Register creates a service client and returns it with its first secret.
+// The secret is shown only once.
+func (r *ClientRegistry) Register(ctx context.Context, name string, scopes []Permission) (*ServiceClient, string, error) {
+	for _, p := range scopes {
+		if !slices.Contains(AllPermissions, p) {
+			return nil, "", fmt.Errorf("%w: unknown permission %q", ErrInvalidScope, p)
+		}
+	}
+
+	client := &ServiceClient{
+		ClientID:  "svc_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	peppers, err := r.peppers(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := newClientSecret(client, peppers)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := r.save(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	r.logger.Info("service client registered",
+		slog.String("client_id", client.ClientID),
+		slog.String("name", name),
+	)
+	return client, secret, nil
+}
+
+// RotateSecret issues a new secret. Existing secrets keep working for the
+// grace period so deployments can roll over.
+func (r *ClientRegistry) RotateSecret(ctx context.Context, clientID string, grace time.Duration) (string, error) {
+	client, err := r.load(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expiry := now.Add(grace)
+	active := client.Secrets[:0]
+	for _, cs := range client.Secrets {
+		if !cs.active(now) {
+			continue
+		}
+		if cs.ExpiresAt == nil || cs.ExpiresAt.After(expiry) {
+			cs.ExpiresAt = &expiry
+		}
+		active = append(active, cs)
+	}
+	client.Secrets = active
+
+	peppers, err := r.peppers(ctx)
+	if err != nil {
+		return "", err
+	}
+	secret, err := newClientSecret(client, peppers)
+	if err != nil {
+		return "", err
+	}
+	if err := r.save(ctx, client); err != nil {
+		return "", err
+	}
+
+	r.logger.Info("service client secret rotated",
+		slog.String("client_id", clientID),
+		slog.Duration("grace", grace),
+	)
+	return secret, nil
+}
+
+// SetDisabled disables or re-enables a client. Tokens of a disabled client
+// stop validating immediately.
+func (r *ClientRegistry) SetDisabled(ctx context.Context, clientID string, disabled bool) error {
+	client, err := r.load(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	client.Disabled = disabled
+	return r.save(ctx, client)
+}
+
+// SetAudiences limits a client's tokens to the named services, by mesh
+// ServiceType. Tokens already issued keep their audiences until they
+// expire.
+func (r *ClientRegistry) SetAudiences(ctx context.Context, clientID string, audiences []string) error {
+	client, err := r.load(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	client.Audiences = audiences
+	return r.save(ctx, client)
+}
+
+// IssueToken verifies client credentials and issues a service token for
+// the requested scopes, or all of the client's scopes if none are given
+func (r *ClientRegistry) IssueToken(ctx context.Context, clientID, secret string, scopes []Permission, ipAddress string) (*ServiceToken, error) {
+	client, err := r.load(ctx, clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		r.auditIssue(ctx, clientID, ipAddress, "unknown client")
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	peppers, err := r.peppers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if client.Disabled || !client.verify(secret, peppers, time.Now()) {
+		r.auditIssue(ctx, clientID, ipAddress, "invalid credentials")
+		return nil, ErrInvalidClient
+	}
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, p := range scopes {
+		if !slices.Contains(client.Scopes, p) {
+			r.auditIssue(ctx, clientID, ipAddress, "scope "+string(p)+" not granted")
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, p)
+		}
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   client.ClientID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(serviceTokenExpiry)),
+			ID:        uuid.New().String(),
+			Audience:  client.Audiences,
+		},
+		UserID:    client.ClientID,
+		Role:      RoleSystem,
+		TokenType: TokenTypeService,
+		Scopes:    scopes,
+		IPAddress: ipAddress,
+	}
+	token, err := r.auth.signToken(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign service token: %w", err)
+	}
+
+	if r.auth.auditLogger != nil {
+		r.auth.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp: now,
+			UserID:    client.ClientID,
+			EventType: "client_credentials",
+			IPAddress: ipAddress,
+			Success:   true,
+		})
+	}
+
+	names := make([]string, len(scopes))
+	for i, p := range scopes {
+		names[i] = string(p)
+	}
+	return &ServiceToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(serviceTokenExpiry.Seconds()),
+		Scope:       strings.Join(names, " "),
+	}, nil
+}
+
+// auditIssue records a refused client credentials grant
+func (r *ClientRegistry) auditIssue(ctx context.Context, clientID, ipAddress, reason string) {
+	r.logger.Warn("client credentials refused",
+		slog.String("client_id", clientID),
+		slog.String("ip", ipAddress),
+		slog.String("reason", reason),
+	)
+	if r.auth.auditLogger == nil {
+		return
+	}
+	r.auth.auditLogger.LogAuthentication(ctx, &AuthEvent{
+		Timestamp:  time.Now(),
+		UserID:     clientID,
+		EventType:  "failed_attempt",
+		IPAddress:  ipAddress,
+		Success:    false,
+		FailReason: reason,
+	})
+}
+
+// TokenHandler serves the client credentials grant. Credentials come from
+// HTTP Basic auth or the client_id and client_secret form fields.
+func (r *ClientRegistry) TokenHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.PostForm("grant_type") != "client_credentials" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+			return
+		}
+		clientID, secret, ok := c.Request.BasicAuth()
+		if !ok {
+			clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+		}
+		var scopes []Permission
+		for _, s := range strings.Fields(c.PostForm("scope")) {
+			scopes = append(scopes, Permission(s))
+		}
+
+		token, err := r.IssueToken(c.Request.Context(), clientID, secret, scopes, c.ClientIP())
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			c.Header("WWW-Authenticate", `Basic realm="service"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		case errors.Is(err, ErrInvalidScope):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+		case err != nil:
+			r.logger.Error("client credentials grant failed",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		default:
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, token)
+		}
+	}
+}
+
+// load returns a stored client
+func (r *ClientRegistry) load(ctx context.Context, clientID string) (*ServiceClient, error) {
+	return loadServiceClient(ctx, r.redis, clientID)
+}
+
+// save stores a client
+func (r *ClientRegistry) save(ctx context.Context, client *ServiceClient) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("failed to marshal service client: %w", err)
+	}
+	if err := r.redis.Set(ctx, clientKey(client.ClientID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store service client: %w", err)
+	}
+	return nil
+}
+
+// loadServiceClient reads a client from Redis
+func loadServiceClient(ctx context.Context, rdb *redis.Client, clientID string) (*ServiceClient, error) {
+	data, err := rdb.Get(ctx, clientKey(clientID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service client: %w", err)
+	}
+	var client ServiceClient
+	if err := json.Unmarshal(data, &client); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service client: %w", err)
+	}
+	return &client, nil
+}
+
+// newClientSecret adds a secret to a client and returns it in the
+// "<secret id>.<random>" form clients present. It is hashed under the
+// first pepper, if any.
+func newClientSecret(client *ServiceClient, peppers [][]byte) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+	id := uuid.New().String()[:8]
+	secret := id + "." + base64.RawURLEncoding.EncodeToString(raw)
+	var pepper []byte
+	if len(peppers) > 0 {
+		pepper = peppers[0]
+	}
+	client.Secrets = append(client.Secrets, &ClientSecret{
+		ID:        id,
+		Hash:      hashClientSecret(secret, pepper),
+		CreatedAt: time.Now(),
+	})
+	return secret, nil
+}
+
+// hashClientSecret hashes a secret for storage, keyed by pepper if given
+func hashClientSecret(secret string, pepper []byte) string {
+	if pepper == nil {
+		sum := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(secret))
+	return pepperedHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a presented secret against the client's active secrets
+func (client *ServiceClient) verify(secret string, peppers [][]byte, now time.Time) bool {
+	id, _, ok := strings.Cut(secret, ".")
+	if !ok {
+		return false
+	}
+	for _, cs := range client.Secrets {
+		if cs.ID != id || !cs.active(now) {
+			continue
+		}
+		if !strings.HasPrefix(cs.Hash, pepperedHashPrefix) {
+			presented := hashClientSecret(secret, nil)
+			return subtle.ConstantTimeCompare([]byte(cs.Hash), []byte(presented)) == 1
+		}
+		for _, pepper := range peppers {
+			presented := hashClientSecret(secret, pepper)
+			if subtle.ConstantTimeCompare([]byte(cs.Hash), []byte(presented)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// IsService reports whether the claims belong to a service rather than a
+// human session
+func (c *Claims) IsService() bool {
+	return c.TokenType == TokenTypeService
+}
+
+// checkPrincipal refuses tokens that can't authenticate a request. Only
+// service tokens carry RoleSystem; a human session claiming it is refused.
+func checkPrincipal(claims *Claims) error {
+	switch claims.TokenType {
+	case TokenTypeAccess:
+		if claims.Role == RoleSystem {
+			return errors.New("system role on a session token")
+		}
+		return nil
+	case TokenTypeService:
+		if claims.Role != RoleSystem {
+			return errors.New("service token without system role")
+		}
+		return nil
+	default:
+		return errors.New("invalid token type")
+	}
+}
+
+// validateServiceClient checks a service token's client is still enabled.
+// Service tokens have no session to revoke.
+func (s *AuthService) validateServiceClient(ctx context.Context, claims *Claims) error {
+	client, err := loadServiceClient(ctx, s.redis, claims.UserID)
+	if errors.Is(err, ErrClientNotFound) {
+		return errors.New("service client has been removed")
+	}
+	if err != nil {
+		return err
+	}
+	if client.Disabled {
+		return errors.New("service client has been disabled")
+	}
+	return nil
+}
+
+// claimsPermit reports whether a token grants a permission. Service tokens
+// are limited to their scopes, and session tokens to their client's.
+func (s *AuthService) claimsPermit(ctx context.Context, claims *Claims, required Permission) bool {
+	if !scopeAllows(claims, required) {
+		return false
+	}
+	if claims.IsService() {
+		return true
+	}
+	return s.permits(ctx, claims.Role, claims.FacilityID, required)
+}
+
+// RequireService returns middleware admitting only service tokens, for
+// internal endpoints
+func (s *AuthService) RequireService() gin.HandlerFunc {
+	return s.requirePrincipal(true)
+}
+
+// RequireHuman returns middleware admitting only human sessions, for
+// endpoints a service must never call on its own
+func (s *AuthService) RequireHuman() gin.HandlerFunc {
+	return s.requirePrincipal(false)
+}
+
+func (s *AuthService) requirePrincipal(service bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "authentication required",
+			})
+			return
+		}
+		allowed := claims.IsService() == service
+		reason := ReasonPrincipalAllowed
+		if !allowed {
+			reason = ReasonWrongPrincipal
+		}
+		logDecision(c.Request.Context(), s.auditLogger, requestEvent(c, claims, map[string]interface{}{
+			"service_required": service,
+		}), allowed, reason)
+
+		if !allowed {
+			s.logger.Warn("principal type denied",
+				slog.String("user_id", claims.UserID),
+				slog.Bool("service", claims.IsService()),
+				slog.String("resource", c.Request.URL.Path),
+			)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "insufficient permissions",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,542 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// consentCacheTTL bounds how long a cached consent decision is trusted
+const consentCacheTTL = 10 * time.Minute
+
+// Consent errors
+var (
+	ErrUnknownPurpose    = errors.New("unknown consent purpose")
+	ErrNoConsentDocument = errors.New("no consent text published for purpose")
+	ErrStaleConsentText  = errors.New("consent given against outdated text")
+	ErrNotConsentGrantor = errors.New("only the resident or their legal proxy can give consent")
+	ErrConsentNotGranted = errors.New("consent not granted")
+)
+
+// ConsentPurpose is something a resident can authorize. It is an alias so
+// packages that can't import this one can accept CheckConsent through an
+// interface of their own.
+type ConsentPurpose = string
+
+const (
+	ConsentFamilySharing    ConsentPurpose = "family_data_sharing"            // Share conversation summaries and mood with family
+	ConsentVoiceRecording   ConsentPurpose = "voice_recording"                // Keep voice audio beyond transcription
+	ConsentResearch         ConsentPurpose = "research_use"                   // Use de-identified data for research
+	ConsentEmergencyContact ConsentPurpose = "emergency_contact_notification" // Notify emergency contacts of a crisis
+)
+
+// ConsentPurposes lists the purposes consent can be recorded for
+var ConsentPurposes = []ConsentPurpose{
+	ConsentFamilySharing,
+	ConsentVoiceRecording,
+	ConsentResearch,
+	ConsentEmergencyContact,
+}
+
+// ConsentDocument is a version of the text residents agree to. A version
+// that requires reconsent voids grants made against earlier versions.
+type ConsentDocument struct {
+	Purpose           ConsentPurpose `json:"purpose"`
+	Version           int            `json:"version"`
+	Text              string         `json:"text"`
+	RequiresReconsent bool           `json:"requires_reconsent"`
+	EffectiveAt       time.Time      `json:"effective_at"`
+}
+
+// ConsentRecord is one grant or revocation. Records are never changed;
+// the latest one for a resident, purpose and grantee is in force.
+type ConsentRecord struct {
+	ID              string         `json:"id"`
+	ResidentID      string         `json:"resident_id"`
+	Purpose         ConsentPurpose `json:"purpose"`
+	GranteeID       string         `json:"grantee_id,omitempty"` // e.g. one family member; empty for everyone the purpose covers
+	Granted         bool           `json:"granted"`
+	DocumentVersion int            `json:"document_version"`
+	RecordedBy      string         `json:"recorded_by"`
+	ProxyConsent    bool           `json:"proxy_consent"` // Given by a legal proxy
+	ExpiresAt       *time.Time     `json:"expires_at,omitempty"`
+	RecordedAt      time.Time      `json:"recorded_at"`
+	IPAddress       string         `json:"-"`
+}
+
+// ConsentRequest grants or revokes consent
+type ConsentRequest struct {
+	Purpose         ConsentPurpose `json:"purpose" binding:"required"`
+	GranteeID       string         `json:"grantee_id"`
+	Granted         bool           `json:"granted"`
+	DocumentVersion int            `json:"document_version"` // The text shown; required to grant
+	ExpiresAt       *time.Time     `json:"expires_at"`
+}
+
+// ProxyChecker reports whether a user is a resident's legal proxy, such as
+// a healthcare power of attorney
+type ProxyChecker interface {
+	IsLegalProxy(ctx context.Context, userID, residentID string) (bool, error)
+}
+
+// legalProxyKey lists a resident's legal proxies
+func legalProxyKey(residentID string) string {
+	return fmt.Sprintf("authz:resident:%s:proxies", residentID)
+}
+
+// IsLegalProxy reports whether a user is a resident's legal proxy
+func (r *RedisRelationshipStore) IsLegalProxy(ctx context.Context, userID, residentID string) (bool, error) {
+	ok, err := r.redis.SIsMember(ctx, legalProxyKey(residentID), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check legal proxy: %w", err)
+	}
+	return ok, nil
+}
+
+// AddLegalProxy records a user as a resident's legal proxy
+func (r *RedisRelationshipStore) AddLegalProxy(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SAdd(ctx, legalProxyKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to add legal proxy: %w", err)
+	}
+	return nil
+}
+
+// RemoveLegalProxy removes a user as a resident's legal proxy
+func (r *RedisRelationshipStore) RemoveLegalProxy(ctx context.Context, residentID, userID string) error {
+	if err := r.redis.SRem(ctx, legalProxyKey(residentID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to remove legal proxy: %w", err)
+	}
+	return nil
+}
+
+// consentCacheKey caches the decision for a resident, purpose and grantee
+func consentCacheKey(residentID string, purpose ConsentPurpose, granteeID string) string {
+	return fmt.Sprintf("consent:%s:%s:%s", residentID, purpose, granteeID)
+}
+
+// ConsentService records residents' consent in Postgres, keeping every
+// grant and revocation for HIPAA accounting. Decisions are cached in
+// Redis and dropped whenever a resident's consent changes. Expected
+// schema:
+//
+//	CREATE TABLE consent_documents (
+//	    purpose            TEXT NOT NULL,
+//	    version            INT NOT NULL,
+//	    text               TEXT NOT NULL,
+//	    requires_reconsent BOOLEAN NOT NULL,
+//	    effective_at       TIMESTAMPTZ NOT NULL,
+//	    PRIMARY KEY (purpose, version)
+//	);
+//	CREATE TABLE consent_records (
+//	    id               TEXT PRIMARY KEY,
+//	    resident_id      TEXT NOT NULL,
+//	    purpose          TEXT NOT NULL,
+//	    grantee_id       TEXT NOT NULL DEFAULT '',
+//	    granted          BOOLEAN NOT NULL,
+//	    document_version INT NOT NULL,
+//	    recorded_by      TEXT NOT NULL,
+//	    proxy_consent    BOOLEAN NOT NULL,
+//	    expires_at       TIMESTAMPTZ,
+//	    recorded_at      TIMESTAMPTZ NOT NULL,
+//	    ip_address       TEXT NOT NULL DEFAULT ''
+//	);
+//	CREATE INDEX consent_records_resident ON consent_records (resident_id, purpose, grantee_id, recorded_at);
+type ConsentService struct {
+	db          *sql.DB
+	redis       *redis.Client
+	proxies     ProxyChecker
+	auditLogger AuditLogger
+	logger      *slog.Logger
+}
+
+// NewConsentService creates a consent service
+func NewConsentService(db *sql.DB, redis *redis.Client, proxies ProxyChecker, auditLogger AuditLogger, logger *slog.Logger) *ConsentService {
+	return &ConsentService{
+		db:          db,
+		redis:       redis,
+		proxies:     proxies,
+		auditLogger: auditLogger,
+		logger:      logger,
+	}
+}
+
+// knownPurpose reports whether consent can be recorded for a purpose
+func knownPurpose(purpose ConsentPurpose) bool {
+	for _, p := range ConsentPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+// PublishDocument adds a new version of a purpose's consent text and
+// returns its version number
+func (s *ConsentService) PublishDocument(ctx context.Context, purpose ConsentPurpose, text string, requiresReconsent bool) (int, error) {
+	if !knownPurpose(purpose) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownPurpose, purpose)
+	}
+	var version int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO consent_documents (purpose, version, text, requires_reconsent, effective_at)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+		FROM consent_documents WHERE purpose = $1
+		RETURNING version`,
+		purpose, text, requiresReconsent, time.Now(),
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish consent text: %w", err)
+	}
+
+	// A reconsent requirement changes every resident's decision
+	if requiresReconsent {
+		s.bustPurpose(ctx, purpose)
+	}
+	return version, nil
+}
+
+// CurrentDocument returns the latest consent text for a purpose
+func (s *ConsentService) CurrentDocument(ctx context.Context, purpose ConsentPurpose) (*ConsentDocument, error) {
+	doc := &ConsentDocument{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT purpose, version, text, requires_reconsent, effective_at
+		FROM consent_documents WHERE purpose = $1
+		ORDER BY version DESC LIMIT 1`,
+		purpose,
+	).Scan(&doc.Purpose, &doc.Version, &doc.Text, &doc.RequiresReconsent, &doc.EffectiveAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNoConsentDocument, purpose)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consent text: %w", err)
+	}
+	return doc, nil
+}
+
+// Record grants or revokes consent on a resident's behalf. The grantor
+// must be the resident or their legal proxy, and a grant must be against
+// the current text.
+func (s *ConsentService) Record(ctx context.Context, claims *Claims, residentID string, req *ConsentRequest, ipAddress string) (*ConsentRecord, error) {
+	if !knownPurpose(req.Purpose) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPurpose, req.Purpose)
+	}
+
+	proxy := false
+	if claims.UserID != residentID {
+		ok, err := s.proxies.IsLegalProxy(ctx, claims.UserID, residentID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNotConsentGrantor
+		}
+		proxy = true
+	}
+
+	doc, err := s.CurrentDocument(ctx, req.Purpose)
+	if err != nil {
+		return nil, err
+	}
+	if req.Granted && req.DocumentVersion != doc.Version {
+		return nil, fmt.Errorf("%w: version %d shown, current is %d", ErrStaleConsentText, req.DocumentVersion, doc.Version)
+	}
+
+	record := &ConsentRecord{
+		ID:              uuid.New().String(),
+		ResidentID:      residentID,
+		Purpose:         req.Purpose,
+		GranteeID:       req.GranteeID,
+		Granted:         req.Granted,
+		DocumentVersion: doc.Version,
+		RecordedBy:      claims.UserID,
+		ProxyConsent:    proxy,
+		ExpiresAt:       req.ExpiresAt,
+		RecordedAt:      time.Now(),
+		IPAddress:       ipAddress,
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO consent_records (id, resident_id, purpose, grantee_id, granted, document_version,
+		                             recorded_by, proxy_consent, expires_at, recorded_at, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		record.ID, record.ResidentID, record.Purpose, record.GranteeID, record.Granted, record.DocumentVersion,
+		record.RecordedBy, record.ProxyConsent, record.ExpiresAt, record.RecordedAt, record.IPAddress,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record consent: %w", err)
+	}
+	s.bustResident(ctx, residentID, req.Purpose)
+
+	action := "revoke_consent"
+	if record.Granted {
+		action = "grant_consent"
+	}
+	if s.auditLogger != nil {
+		s.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp: record.RecordedAt,
+			UserID:    claims.UserID,
+			Role:      claims.Role,
+			Resource:  "consent:" + residentID,
+			Action:    action,
+			IPAddress: ipAddress,
+			SessionID: claims.SessionID,
+			Success:   true,
+			Details: map[string]interface{}{
+				"purpose":          string(record.Purpose),
+				"grantee_id":       record.GranteeID,
+				"document_version": record.DocumentVersion,
+				"proxy_consent":    proxy,
+			},
+		})
+	}
+	return record, nil
+}
+
+// CheckConsent reports whether a resident's consent for a purpose is in
+// force. A grantee-specific decision takes precedence over one covering
+// every grantee; pass "" when the purpose has no grantee. Without a record
+// consent is not granted.
+func (s *ConsentService) CheckConsent(ctx context.Context, residentID string, purpose ConsentPurpose, granteeID string) (bool, error) {
+	key := consentCacheKey(residentID, purpose, granteeID)
+	if cached, err := s.redis.Get(ctx, key).Result(); err == nil {
+		return cached == "1", nil
+	}
+
+	granted, err := s.decide(ctx, residentID, purpose, granteeID)
+	if err != nil {
+		return false, err
+	}
+
+	value := "0"
+	if granted {
+		value = "1"
+	}
+	if err := s.redis.Set(ctx, key, value, consentCacheTTL).Err(); err != nil {
+		s.logger.Warn("failed to cache consent decision",
+			slog.String("resident_id", residentID),
+			slog.String("error", err.Error()),
+		)
+	}
+	return granted, nil
+}
+
+// RequireConsent is CheckConsent returning ErrConsentNotGranted when
+// consent isn't in force
+func (s *ConsentService) RequireConsent(ctx context.Context, residentID string, purpose ConsentPurpose, granteeID string) error {
+	granted, err := s.CheckConsent(ctx, residentID, purpose, granteeID)
+	if err != nil {
+		return err
+	}
+	if !granted {
+		return fmt.Errorf("%w: %s", ErrConsentNotGranted, purpose)
+	}
+	return nil
+}
+
+// decide evaluates the latest applicable record against the consent text
+func (s *ConsentService) decide(ctx context.Context, residentID string, purpose ConsentPurpose, granteeID string) (bool, error) {
+	var granted bool
+	var version int
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT granted, document_version, expires_at FROM consent_records
+		WHERE resident_id = $1 AND purpose = $2 AND grantee_id IN ($3, '')
+		ORDER BY (grantee_id = $3 AND $3 <> '') DESC, recorded_at DESC
+		LIMIT 1`,
+		residentID, purpose, granteeID,
+	).Scan(&granted, &version, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load consent: %w", err)
+	}
+	if !granted || (expiresAt.Valid && time.Now().After(expiresAt.Time)) {
+		return false, nil
+	}
+
+	// Grants made before text requiring reconsent are void
+	var reconsentVersion int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM consent_documents
+		WHERE purpose = $1 AND requires_reconsent`,
+		purpose,
+	).Scan(&reconsentVersion)
+	if err != nil {
+		return false, fmt.Errorf("failed to load consent text: %w", err)
+	}
+	return version >= reconsentVersion, nil
+}
+
+// History returns every consent record for a resident, newest first
+func (s *ConsentService) History(ctx context.Context, residentID string) ([]*ConsentRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, purpose, grantee_id, granted, document_version, recorded_by, proxy_consent, expires_at, recorded_at
+		FROM consent_records WHERE resident_id = $1
+		ORDER BY recorded_at DESC`,
+		residentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consent history: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*ConsentRecord
+	for rows.Next() {
+		record := &ConsentRecord{ResidentID: residentID}
+		var expiresAt sql.NullTime
+		err := rows.Scan(&record.ID, &record.Purpose, &record.GranteeID, &record.Granted, &record.DocumentVersion,
+			&record.RecordedBy, &record.ProxyConsent, &expiresAt, &record.RecordedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read consent record: %w", err)
+		}
+		if expiresAt.Valid {
+			record.ExpiresAt = &expiresAt.Time
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load consent history: %w", err)
+	}
+	return records, nil
+}
+
+// bustResident drops a resident's cached decisions for a purpose
+func (s *ConsentService) bustResident(ctx context.Context, residentID string, purpose ConsentPurpose) {
+	s.bustPattern(ctx, fmt.Sprintf("consent:%s:%s:*", residentID, purpose))
+}
+
+// bustPurpose drops every cached decision for a purpose
+func (s *ConsentService) bustPurpose(ctx context.Context, purpose ConsentPurpose) {
+	s.bustPattern(ctx, fmt.Sprintf("consent:*:%s:*", purpose))
+}
+
+func (s *ConsentService) bustPattern(ctx context.Context, pattern string) {
+	iter := s.redis.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		s.redis.Del(ctx, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		s.logger.Error("failed to drop cached consent; stale decisions expire within the cache TTL",
+			slog.String("pattern", pattern),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// RegisterConsentRoutes mounts the consent API. The group must already run
+// AuthMiddleware; who may record consent is checked per request, and
+// reading a resident's consent needs the resident, a legal proxy or
+// PermissionReadResident.
+//
+//	GET  /consent/documents/:purpose           current consent text
+//	POST /consent/documents/:purpose           publish new text (PermissionAdminSystem)
+//	GET  /residents/:resident_id/consents      consent history
+//	POST /residents/:resident_id/consents      grant or revoke
+func (s *ConsentService) RegisterConsentRoutes(r gin.IRouter, auth *AuthService) {
+	r.GET("/consent/documents/:purpose", s.getDocument)
+	r.POST("/consent/documents/:purpose", auth.RequirePermission(PermissionAdminSystem), s.publishDocument)
+	r.GET("/residents/:resident_id/consents", s.getHistory(auth))
+	r.POST("/residents/:resident_id/consents", s.recordConsent)
+}
+
+func (s *ConsentService) getDocument(c *gin.Context) {
+	doc, err := s.CurrentDocument(c.Request.Context(), ConsentPurpose(c.Param("purpose")))
+	if err != nil {
+		s.writeConsentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+func (s *ConsentService) publishDocument(c *gin.Context) {
+	var req struct {
+		Text              string `json:"text" binding:"required"`
+		RequiresReconsent bool   `json:"requires_reconsent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "consent text required"})
+		return
+	}
+	purpose := ConsentPurpose(c.Param("purpose"))
+	version, err := s.PublishDocument(c.Request.Context(), purpose, req.Text, req.RequiresReconsent)
+	if err != nil {
+		s.writeConsentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"purpose": purpose, "version": version})
+}
+
+func (s *ConsentService) getHistory(auth *AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		ctx := c.Request.Context()
+		residentID := c.Param("resident_id")
+		allowed := claims.UserID == residentID || auth.claimsPermit(ctx, claims, PermissionReadResident)
+		if !allowed {
+			allowed, err = s.proxies.IsLegalProxy(ctx, claims.UserID, residentID)
+			if err != nil {
+				s.writeConsentError(c, err)
+				return
+			}
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+
+		records, err := s.History(ctx, residentID)
+		if err != nil {
+			s.writeConsentError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"consents": records})
+	}
+}
+
+func (s *ConsentService) recordConsent(c *gin.Context) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	var req ConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "purpose required"})
+		return
+	}
+	record, err := s.Record(c.Request.Context(), claims, c.Param("resident_id"), &req, c.ClientIP())
+	if err != nil {
+		s.writeConsentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, record)
+}
+
+// writeConsentError answers a failed consent request
+func (s *ConsentService) writeConsentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownPurpose), errors.Is(err, ErrNoConsentDocument):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrStaleConsentText):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotConsentGrantor):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		s.logger.Error("consent request failed",
+			slog.String("error", err.Error()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "consent unavailable"})
+	}
+}
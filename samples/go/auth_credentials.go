@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/crypto/argon2"
+)
+
+// Credential errors
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrAccountLocked      = errors.New("account temporarily locked")
+	ErrWeakPassword       = errors.New("password does not meet policy")
+	ErrBreachedPassword   = errors.New("password has appeared in a data breach")
+)
+
+// Argon2Params are the Argon2id cost parameters. Hashes record the
+// parameters they were made with, so raising them only affects new hashes
+// and those upgraded at the next login.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2Params returns the OWASP-recommended Argon2id parameters
+func DefaultArgon2Params() *Argon2Params {
+	return &Argon2Params{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 2,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// PasswordPolicy is what passwords must satisfy. Following NIST SP 800-63B
+// it relies on length and breach checks rather than composition rules.
+type PasswordPolicy struct {
+	MinLength     int  // In characters
+	MaxLength     int  // Bounds hashing cost
+	CheckBreached bool // Refuse passwords known from breaches
+}
+
+// DefaultPasswordPolicy returns the policy for staff and family accounts
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:     12,
+		MaxLength:     128,
+		CheckBreached: true,
+	}
+}
+
+// BreachChecker reports whether a password is known from data breaches
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// Account is a user that signs in with a password
+type Account struct {
+	UserID       string    `json:"user_id"`
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	FacilityID   string    `json:"facility_id"`
+	PasswordHash string    `json:"password_hash"` // PHC string format
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// accountKey holds an account by normalized username
+func accountKey(username string) string {
+	return fmt.Sprintf("auth:account:%s", normalizeUsername(username))
+}
+
+// normalizeUsername makes usernames case-insensitive
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// CredentialService verifies passwords and issues tokens for them
+type CredentialService struct {
+	auth   *AuthService
+	redis  *redis.Client
+	logger *slog.Logger
+	params *Argon2Params
+	policy *PasswordPolicy
+	breach BreachChecker // Optional
+	guard  *LoginGuard
+	keys   *WebAuthnService // Optional security key second factor
+	dummy  string           // Verified against for unknown usernames to keep timing even
+}
+
+// NewCredentialService creates a credential service issuing tokens from
+// auth. breach may be nil to skip breach checks.
+func NewCredentialService(auth *AuthService, redis *redis.Client, breach BreachChecker, logger *slog.Logger) *CredentialService {
+	s := &CredentialService{
+		auth:   auth,
+		redis:  redis,
+		logger: logger,
+		params: DefaultArgon2Params(),
+		policy: DefaultPasswordPolicy(),
+		breach: breach,
+		guard:  NewLoginGuard(redis, DefaultLockoutPolicy(), nil, auth.auditLogger, logger),
+	}
+	s.dummy, _ = s.hashPassword("not-a-real-password")
+	return s
+}
+
+// SetPolicy replaces the password policy
+func (s *CredentialService) SetPolicy(policy *PasswordPolicy) {
+	s.policy = policy
+}
+
+// SetLoginGuard replaces the brute-force guard, e.g. with one that has a
+// step-up verifier
+func (s *CredentialService) SetLoginGuard(guard *LoginGuard) {
+	s.guard = guard
+}
+
+// SetSecondFactor makes password logins of the roles keys requires finish
+// with a security key
+func (s *CredentialService) SetSecondFactor(keys *WebAuthnService) {
+	s.keys = keys
+}
+
+// CheckPassword reports why a password doesn't meet the policy, or nil
+func (s *CredentialService) CheckPassword(ctx context.Context, account *Account, password string) error {
+	n := utf8.RuneCountInString(password)
+	if n < s.policy.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrWeakPassword, s.policy.MinLength)
+	}
+	if n > s.policy.MaxLength {
+		return fmt.Errorf("%w: at most %d characters allowed", ErrWeakPassword, s.policy.MaxLength)
+	}
+	lower := strings.ToLower(password)
+	if u := normalizeUsername(account.Username); u != "" && strings.Contains(lower, u) {
+		return fmt.Errorf("%w: must not contain the username", ErrWeakPassword)
+	}
+
+	if s.policy.CheckBreached && s.breach != nil {
+		breached, err := s.breach.IsBreached(ctx, password)
+		if err != nil {
+			// The check is a safeguard on top of the policy; an outage
+			// shouldn't stop password changes
+			s.logger.Warn("breached password check unavailable",
+				slog.String("error", err.Error()),
+			)
+		} else if breached {
+			return ErrBreachedPassword
+		}
+	}
+	return nil
+}
+
+// SetPassword checks a new password against the policy and stores its
+// hash, creating the account if needed. Existing sessions are revoked.
+func (s *CredentialService) SetPassword(ctx context.Context, account *Account, password string) error {
+	if err := s.CheckPassword(ctx, account, password); err != nil {
+		return err
+	}
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	stored := *account
+	stored.PasswordHash = hash
+	stored.UpdatedAt = time.Now()
+	if err := s.saveAccount(ctx, &stored); err != nil {
+		return err
+	}
+	s.guard.succeed(ctx, account.Username)
+
+	if err := s.auth.RevokeAllSessions(ctx, account.UserID); err != nil {
+		s.logger.Error("failed to revoke sessions after password change",
+			slog.String("user_id", account.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+	return nil
+}
+
+// LoginRequest is a password sign-in
+type LoginRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+	DeviceID    string `json:"device_id"`
+	StepUpToken string `json:"step_up_token"` // Required once the guard asks for step-up
+	ClientID    string `json:"client_id"`     // TokenClients entry of the app signing in
+}
+
+// Login verifies a username and password and issues a token pair
+func (s *CredentialService) Login(ctx context.Context, req *LoginRequest, ipAddress string) (*TokenPair, error) {
+	if err := s.guard.check(ctx, req.Username, ipAddress, req.StepUpToken); err != nil {
+		s.auditFailure(ctx, req, ipAddress, err.Error())
+		return nil, err
+	}
+
+	account, err := s.loadAccount(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	hash := s.dummy
+	if account != nil {
+		hash = account.PasswordHash
+	}
+	ok, outdated, err := verifyPassword(hash, req.Password, s.params)
+	if err != nil {
+		s.logger.Error("failed to verify password",
+			slog.String("username", req.Username),
+			slog.String("error", err.Error()),
+		)
+	}
+	if account == nil || !ok {
+		s.auditFailure(ctx, req, ipAddress, "invalid credentials")
+		s.guard.fail(ctx, req.Username, ipAddress, req.DeviceID)
+		return nil, ErrInvalidCredentials
+	}
+	s.guard.succeed(ctx, req.Username)
+
+	// Hashes made with older parameters are upgraded while the password is
+	// at hand
+	if outdated {
+		if upgraded, err := s.hashPassword(req.Password); err == nil {
+			account.PasswordHash = upgraded
+			if err := s.saveAccount(ctx, account); err != nil {
+				s.logger.Warn("failed to upgrade password hash",
+					slog.String("user_id", account.UserID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+
+	if s.keys != nil {
+		if err := s.keys.secondFactor(ctx, account, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.auth.GenerateClientTokenPair(ctx, req.ClientID, account.UserID, account.Role, account.FacilityID, req.DeviceID, ipAddress)
+}
+
+// auditFailure records a refused login
+func (s *CredentialService) auditFailure(ctx context.Context, req *LoginRequest, ipAddress, reason string) {
+	if s.auth.auditLogger == nil {
+		return
+	}
+	s.auth.auditLogger.LogAuthentication(ctx, &AuthEvent{
+		Timestamp:  time.Now(),
+		UserID:     normalizeUsername(req.Username),
+		EventType:  "failed_attempt",
+		IPAddress:  ipAddress,
+		DeviceID:   req.DeviceID,
+		Success:    false,
+		FailReason: reason,
+	})
+}
+
+// loadAccount returns an account, or nil if there is none
+func (s *CredentialService) loadAccount(ctx context.Context, username string) (*Account, error) {
+	data, err := s.redis.Get(ctx, accountKey(username)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account: %w", err)
+	}
+	var account Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account: %w", err)
+	}
+	return &account, nil
+}
+
+// saveAccount stores an account
+func (s *CredentialService) saveAccount(ctx context.Context, account *Account) error {
+	data, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %w", err)
+	}
+	if err := s.redis.Set(ctx, accountKey(account.Username), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store account: %w", err)
+	}
+	return nil
+}
+
+// hashPassword hashes a password with Argon2id into a PHC string
+func (s *CredentialService) hashPassword(password string) (string, error) {
+	p := s.params
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// verifyPassword checks a password against a PHC string hash. It also
+// reports whether the hash was made with weaker parameters than current.
+func verifyPassword(encoded, password string, current *Argon2Params) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errors.New("unsupported password hash format")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return false, false, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	b64 := base64.RawStdEncoding
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid salt: %w", err)
+	}
+	want, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	got := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(want)))
+	ok := subtle.ConstantTimeCompare(got, want) == 1
+	outdated := p.Memory < current.Memory || p.Time < current.Time || p.Threads < current.Threads
+	return ok, outdated, nil
+}
+
+// LoginHandler serves password sign-in
+func (s *CredentialService) LoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "username and password required",
+			})
+			return
+		}
+
+		tokens, err := s.Login(c.Request.Context(), &req, c.ClientIP())
+		if writeLoginRefusal(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrInvalidCredentials.Error(),
+			})
+		case err != nil:
+			s.logger.Error("login failed",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "sign-in unavailable",
+			})
+		default:
+			c.JSON(http.StatusOK, tokens)
+		}
+	}
+}
+
+// HIBPBreachChecker checks passwords against the Have I Been Pwned range
+// API. Only the first five characters of the password's SHA-1 hash leave
+// the service.
+type HIBPBreachChecker struct {
+	Endpoint string // Defaults to the public API
+	Client   *http.Client
+}
+
+// IsBreached reports whether the password appears in the breach corpus
+func (h *HIBPBreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	endpoint := h.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.pwnedpasswords.com/range/"
+	}
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build breach check: %w", err)
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check breach corpus: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to check breach corpus: status %d", resp.StatusCode)
+	}
+
+	// Each line is SUFFIX:COUNT; padding entries have a count of zero
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		hashSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hashSuffix == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Delegation errors
+var (
+	ErrDelegationNotFound   = errors.New("delegation not found")
+	ErrInvalidDelegation    = errors.New("invalid delegation")
+	ErrNotDelegationGrantor = errors.New("not allowed to manage this resident's delegations")
+)
+
+// maxDelegationTerm bounds how long a delegation lasts before it must be
+// renewed
+const maxDelegationTerm = 365 * 24 * time.Hour
+
+// DelegablePermissions are what a resident can delegate to family. Writes
+// and administration stay with the care team.
+var DelegablePermissions = []Permission{
+	PermissionReadResident,
+	PermissionReadCrisis,
+	PermissionReadAssessment,
+}
+
+// Delegation lets a family member see part of one resident's data. It
+// narrows what the grantee's role allows; it never adds to it.
+type Delegation struct {
+	ID         string       `json:"id"`
+	ResidentID string       `json:"resident_id"`
+	GranteeID  string       `json:"grantee_id"`
+	GrantorID  string       `json:"grantor_id"`
+	Scopes     []Permission `json:"scopes"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// DelegationRequest creates a delegation
+type DelegationRequest struct {
+	GranteeID string       `json:"grantee_id" binding:"required"`
+	Scopes    []Permission `json:"scopes" binding:"required"`
+	ExpiresAt time.Time    `json:"expires_at" binding:"required"`
+}
+
+// auditDetails describes access granted through the delegation
+func (d *Delegation) auditDetails(action Permission) map[string]interface{} {
+	return map[string]interface{}{
+		"delegation_id": d.ID,
+		"grantor_id":    d.GrantorID,
+		"resident_id":   d.ResidentID,
+		"delegated":     string(action),
+	}
+}
+
+// Delegation keys. A grantee has at most one delegation per resident; a
+// new one replaces it.
+func delegationKey(residentID, granteeID string) string {
+	return fmt.Sprintf("authz:resident:%s:delegation:%s", residentID, granteeID)
+}
+
+func residentDelegationsKey(residentID string) string {
+	return fmt.Sprintf("authz:resident:%s:delegations", residentID)
+}
+
+// DelegationService manages family delegations in Redis. Each delegation
+// expires with its key, so lapsed delegations grant nothing.
+type DelegationService struct {
+	redis         *redis.Client
+	relationships *RedisRelationshipStore
+	authorizer    *Authorizer
+	auditLogger   AuditLogger
+	logger        *slog.Logger
+}
+
+// NewDelegationService creates a delegation service. Residents, their
+// legal proxies and anyone authorizer lets write the resident's record
+// may manage delegations.
+func NewDelegationService(redis *redis.Client, relationships *RedisRelationshipStore, authorizer *Authorizer, auditLogger AuditLogger, logger *slog.Logger) *DelegationService {
+	return &DelegationService{
+		redis:         redis,
+		relationships: relationships,
+		authorizer:    authorizer,
+		auditLogger:   auditLogger,
+		logger:        logger,
+	}
+}
+
+// Grant delegates access to one of a resident's family members
+func (d *DelegationService) Grant(ctx context.Context, claims *Claims, residentID string, req *DelegationRequest) (*Delegation, error) {
+	if err := d.checkGrantor(ctx, claims, residentID); err != nil {
+		return nil, err
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: no scopes", ErrInvalidDelegation)
+	}
+	for _, p := range req.Scopes {
+		if !slices.Contains(DelegablePermissions, p) {
+			return nil, fmt.Errorf("%w: %s can't be delegated", ErrInvalidDelegation, p)
+		}
+	}
+	now := time.Now()
+	term := req.ExpiresAt.Sub(now)
+	if term <= 0 || term > maxDelegationTerm {
+		return nil, fmt.Errorf("%w: expiry must be within %s", ErrInvalidDelegation, maxDelegationTerm)
+	}
+	linked, err := d.relationships.IsFamilyMember(ctx, req.GranteeID, residentID)
+	if err != nil {
+		return nil, err
+	}
+	if !linked {
+		return nil, fmt.Errorf("%w: grantee isn't linked to the resident as family", ErrInvalidDelegation)
+	}
+
+	delegation := &Delegation{
+		ID:         uuid.New().String(),
+		ResidentID: residentID,
+		GranteeID:  req.GranteeID,
+		GrantorID:  claims.UserID,
+		Scopes:     req.Scopes,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedAt:  now,
+	}
+	data, err := json.Marshal(delegation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delegation: %w", err)
+	}
+	_, err = d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, delegationKey(residentID, req.GranteeID), data, term)
+		pipe.SAdd(ctx, residentDelegationsKey(residentID), req.GranteeID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store delegation: %w", err)
+	}
+
+	d.audit(ctx, claims, "grant_delegation", delegation)
+	return delegation, nil
+}
+
+// Revoke ends a grantee's delegation
+func (d *DelegationService) Revoke(ctx context.Context, claims *Claims, residentID, granteeID string) error {
+	if err := d.checkGrantor(ctx, claims, residentID); err != nil {
+		return err
+	}
+	delegation, err := d.Active(ctx, residentID, granteeID)
+	if err != nil {
+		return err
+	}
+	if delegation == nil {
+		return ErrDelegationNotFound
+	}
+
+	_, err = d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, delegationKey(residentID, granteeID))
+		pipe.SRem(ctx, residentDelegationsKey(residentID), granteeID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke delegation: %w", err)
+	}
+
+	d.audit(ctx, claims, "revoke_delegation", delegation)
+	return nil
+}
+
+// Active returns a grantee's unexpired delegation for a resident, or nil
+func (d *DelegationService) Active(ctx context.Context, residentID, granteeID string) (*Delegation, error) {
+	data, err := d.redis.Get(ctx, delegationKey(residentID, granteeID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load delegation: %w", err)
+	}
+	var delegation Delegation
+	if err := json.Unmarshal(data, &delegation); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delegation: %w", err)
+	}
+	return &delegation, nil
+}
+
+// List returns a resident's active delegations, pruning lapsed ones from
+// the index
+func (d *DelegationService) List(ctx context.Context, residentID string) ([]*Delegation, error) {
+	grantees, err := d.redis.SMembers(ctx, residentDelegationsKey(residentID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list delegations: %w", err)
+	}
+
+	delegations := make([]*Delegation, 0, len(grantees))
+	for _, granteeID := range grantees {
+		delegation, err := d.Active(ctx, residentID, granteeID)
+		if err != nil {
+			return nil, err
+		}
+		if delegation == nil {
+			d.redis.SRem(ctx, residentDelegationsKey(residentID), granteeID)
+			continue
+		}
+		delegations = append(delegations, delegation)
+	}
+	return delegations, nil
+}
+
+// authorize checks a family member's delegation covers action. Removing
+// the family link suspends the delegation too.
+func (d *DelegationService) authorize(ctx context.Context, granteeID, residentID string, action Permission) (*Delegation, error) {
+	delegation, err := d.Active(ctx, residentID, granteeID)
+	if err != nil {
+		return nil, err
+	}
+	if delegation == nil {
+		return nil, deny(ReasonNoDelegation, "no delegation from the resident")
+	}
+	if !slices.Contains(delegation.Scopes, action) {
+		return nil, deny(ReasonActionNotDelegated, "%s not delegated", action)
+	}
+	linked, err := d.relationships.IsFamilyMember(ctx, granteeID, residentID)
+	if err != nil {
+		return nil, err
+	}
+	if !linked {
+		return nil, deny(ReasonNoFamilyLink, "no family link")
+	}
+	return delegation, nil
+}
+
+// checkGrantor refuses callers who may not manage a resident's delegations
+func (d *DelegationService) checkGrantor(ctx context.Context, claims *Claims, residentID string) error {
+	if claims.UserID == residentID && claims.Role == RoleResident {
+		return nil
+	}
+	proxy, err := d.relationships.IsLegalProxy(ctx, claims.UserID, residentID)
+	if err != nil {
+		return err
+	}
+	if proxy {
+		return nil
+	}
+	err = d.authorizer.Authorize(ctx, claims, PermissionWriteResident, "resident", residentID)
+	if errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrResourceNotFound) {
+		return ErrNotDelegationGrantor
+	}
+	return err
+}
+
+// audit records a change to a delegation
+func (d *DelegationService) audit(ctx context.Context, claims *Claims, action string, delegation *Delegation) {
+	d.logger.Info("delegation changed",
+		slog.String("action", action),
+		slog.String("resident_id", delegation.ResidentID),
+		slog.String("grantee_id", delegation.GranteeID),
+		slog.String("by", claims.UserID),
+	)
+	if d.auditLogger == nil {
+		return
+	}
+	d.auditLogger.LogAccess(ctx, &AccessEvent{
+		Timestamp: time.Now(),
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		Resource:  "delegation:" + delegation.ResidentID,
+		Action:    action,
+		SessionID: claims.SessionID,
+		Success:   true,
+		Details: map[string]interface{}{
+			"delegation_id": delegation.ID,
+			"grantee_id":    delegation.GranteeID,
+			"scopes":        delegation.Scopes,
+			"expires_at":    delegation.ExpiresAt,
+		},
+	})
+}
+
+// RegisterDelegationRoutes mounts delegation management. The group must
+// already run AuthMiddleware; who may manage a resident's delegations is
+// checked per request.
+//
+//	GET    /residents/:resident_id/delegations
+//	POST   /residents/:resident_id/delegations
+//	DELETE /residents/:resident_id/delegations/:grantee_id
+func (d *DelegationService) RegisterDelegationRoutes(r gin.IRouter) {
+	r.GET("/residents/:resident_id/delegations", d.listDelegations)
+	r.POST("/residents/:resident_id/delegations", d.grantDelegation)
+	r.DELETE("/residents/:resident_id/delegations/:grantee_id", d.revokeDelegation)
+}
+
+func (d *DelegationService) listDelegations(c *gin.Context) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	ctx := c.Request.Context()
+	residentID := c.Param("resident_id")
+	if err := d.checkGrantor(ctx, claims, residentID); err != nil {
+		d.writeDelegationError(c, err)
+		return
+	}
+	delegations, err := d.List(ctx, residentID)
+	if err != nil {
+		d.writeDelegationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delegations": delegations})
+}
+
+func (d *DelegationService) grantDelegation(c *gin.Context) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	var req DelegationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "grantee_id, scopes and expires_at required"})
+		return
+	}
+	delegation, err := d.Grant(c.Request.Context(), claims, c.Param("resident_id"), &req)
+	if err != nil {
+		d.writeDelegationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, delegation)
+}
+
+func (d *DelegationService) revokeDelegation(c *gin.Context) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	if err := d.Revoke(c.Request.Context(), claims, c.Param("resident_id"), c.Param("grantee_id")); err != nil {
+		d.writeDelegationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeDelegationError answers a failed delegation request
+func (d *DelegationService) writeDelegationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidDelegation):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotDelegationGrantor):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	case errors.Is(err, ErrDelegationNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		d.logger.Error("delegation request failed",
+			slog.String("error", err.Error()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "delegation unavailable"})
+	}
+}
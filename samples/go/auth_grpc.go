@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RPCPermissions maps gRPC methods to the permission they require beyond
+// authentication. Calls to these methods are always audited, granted or not.
+var RPCPermissions = map[string]Permission{
+	"/therapeutic.streaming.v1.TherapeuticService/ExportSession": PermissionExportTranscript,
+}
+
+// RPCRoles restricts gRPC methods to roles, like RequireRole for Gin routes
+var RPCRoles = map[string][]Role{}
+
+// PublicRPCMethods are served without authentication
+var PublicRPCMethods = map[string]bool{
+	"/grpc.health.v1.Health/Check": true,
+	"/grpc.health.v1.Health/Watch": true,
+}
+
+// claimsCtx is the context key for claims verified by the gRPC interceptors
+type claimsCtx struct{}
+
+// tokenCtx is the context key for the bearer token the claims came from
+type tokenCtx struct{}
+
+// TokenFromContext returns the caller's bearer token verified by the gRPC
+// interceptors, or "" if there is none
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenCtx{}).(string)
+	return token
+}
+
+// WithClaims returns a context carrying verified claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsCtx{}, claims)
+}
+
+// ClaimsFromContext extracts claims injected by the gRPC interceptors
+func ClaimsFromContext(ctx context.Context) (*Claims, error) {
+	claims, ok := ctx.Value(claimsCtx{}).(*Claims)
+	if !ok || claims == nil {
+		return nil, errors.New("claims not found in context")
+	}
+	return claims, nil
+}
+
+// authenticateRPC validates the bearer token in a call's metadata and
+// checks it belongs to the user the call claims to act for
+func (s *AuthService) authenticateRPC(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	parts := strings.SplitN(values[0], " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+	}
+
+	ipAddress, userAgent := rpcClient(ctx)
+
+	claims, err := s.ValidateToken(ctx, parts[1])
+	if err != nil {
+		s.logger.Warn("token validation failed",
+			slog.String("error", err.Error()),
+			slog.String("method", method),
+			slog.String("ip", ipAddress),
+		)
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+
+	if err := checkPrincipal(claims); err != nil {
+		s.logger.Warn("token refused",
+			slog.String("user_id", claims.UserID),
+			slog.String("method", method),
+			slog.String("error", err.Error()),
+		)
+		return nil, status.Error(codes.Unauthenticated, "invalid token type")
+	}
+	if err := s.checkAudience(claims); err != nil {
+		s.logger.Warn("token refused",
+			slog.String("user_id", claims.UserID),
+			slog.String("method", method),
+			slog.String("error", err.Error()),
+		)
+		return nil, status.Error(codes.Unauthenticated, ErrWrongAudience.Error())
+	}
+
+	if err := s.checkNetwork(ctx, claims.UserID, claims.Role, claims.FacilityID, ipAddress); err != nil {
+		if errors.Is(err, ErrNetworkDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		s.logger.Error("failed to evaluate network policy",
+			slog.String("error", err.Error()),
+		)
+		return nil, status.Error(codes.Unavailable, "authentication unavailable")
+	}
+
+	if claims.IsImpersonation() && !ImpersonationRPCMethods[method] {
+		logDecision(ctx, s.auditLogger, rpcEvent(ctx, claims, method, nil), false, ReasonImpersonationReadOnly)
+		return nil, status.Error(codes.PermissionDenied, "read-only while impersonating")
+	}
+
+	// Streaming services identify the user in metadata; it must be the
+	// token's subject unless a service is calling on the user's behalf
+	if userIDs := md.Get("user-id"); len(userIDs) > 0 && userIDs[0] != claims.UserID && !claims.IsService() {
+		s.logger.Warn("user-id metadata does not match token",
+			slog.String("user_id", claims.UserID),
+			slog.String("claimed", userIDs[0]),
+			slog.String("method", method),
+		)
+		return nil, status.Error(codes.Unauthenticated, "user-id does not match token")
+	}
+
+	// Device binding check
+	rules := s.sessionRules(claims.Role)
+	deviceID := ""
+	if deviceIDs := md.Get("x-device-id"); len(deviceIDs) > 0 {
+		deviceID = deviceIDs[0]
+	}
+	if err := s.checkDevice(claims, rules, deviceID); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	// Audit access if enabled; impersonated access always is
+	if (rules.auditAll || claims.IsImpersonation()) && s.auditLogger != nil {
+		s.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp:      time.Now(),
+			UserID:         claims.UserID,
+			Role:           claims.Role,
+			Resource:       method,
+			Action:         "RPC",
+			IPAddress:      ipAddress,
+			UserAgent:      userAgent,
+			SessionID:      claims.SessionID,
+			Success:        true,
+			ImpersonatorID: impersonatorID(claims),
+		})
+	}
+
+	return WithClaims(context.WithValue(ctx, tokenCtx{}, parts[1]), claims), nil
+}
+
+// rpcClient returns the caller's IP address, without the port, and user
+// agent
+func rpcClient(ctx context.Context) (ipAddress, userAgent string) {
+	if p, ok := peer.FromContext(ctx); ok {
+		ipAddress = p.Addr.String()
+		if addrPort, err := netip.ParseAddrPort(ipAddress); err == nil {
+			ipAddress = addrPort.Addr().String()
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if agents := md.Get("user-agent"); len(agents) > 0 {
+		userAgent = agents[0]
+	}
+	return ipAddress, userAgent
+}
+
+// rpcEvent describes a call for a decision record
+func rpcEvent(ctx context.Context, claims *Claims, method string, details map[string]interface{}) *AccessEvent {
+	ipAddress, userAgent := rpcClient(ctx)
+	return &AccessEvent{
+		Timestamp:      time.Now(),
+		UserID:         claims.UserID,
+		Role:           claims.Role,
+		Resource:       method,
+		Action:         "RPC",
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		SessionID:      claims.SessionID,
+		Details:        details,
+		ImpersonatorID: impersonatorID(claims),
+	}
+}
+
+// hasPermission reports whether a role grants a permission
+func hasPermission(role Role, required Permission) bool {
+	for _, p := range RolePermissions[role] {
+		if p == required {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeRPC enforces RPCPermissions for an authenticated call. The
+// attempt is audited either way, and a granted call is refused if its audit
+// record can't be written.
+func (s *AuthService) authorizeRPC(ctx context.Context, method string, req any) error {
+	if roles, ok := RPCRoles[method]; ok {
+		claims, err := ClaimsFromContext(ctx)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, "authentication required")
+		}
+		allowed := slices.Contains(roles, claims.Role)
+		reason := ReasonRoleAllowed
+		if !allowed {
+			reason = ReasonMissingRole
+		}
+		logDecision(ctx, s.auditLogger, rpcEvent(ctx, claims, method, map[string]interface{}{
+			"allowed_roles": roles,
+		}), allowed, reason)
+
+		if !allowed {
+			s.logger.Warn("role access denied",
+				slog.String("user_id", claims.UserID),
+				slog.String("role", string(claims.Role)),
+				slog.String("method", method),
+			)
+			return status.Error(codes.PermissionDenied, "insufficient permissions")
+		}
+	}
+
+	required, ok := RPCPermissions[method]
+	if !ok {
+		return nil
+	}
+	claims, err := ClaimsFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	granted, reason := s.permissionDecision(ctx, claims, required)
+
+	if s.auditLogger != nil {
+		details := map[string]interface{}{"permission": string(required)}
+		if target, ok := req.(interface{ GetSessionId() string }); ok {
+			details["target_session_id"] = target.GetSessionId()
+		}
+		err := logDecision(ctx, s.auditLogger, rpcEvent(ctx, claims, method, details), granted, reason)
+		if err != nil && granted {
+			s.logger.Error("failed to audit privileged call",
+				slog.String("user_id", claims.UserID),
+				slog.String("method", method),
+				slog.String("error", err.Error()),
+			)
+			return status.Error(codes.Unavailable, "audit log unavailable")
+		}
+	}
+
+	if !granted {
+		s.logger.Warn("permission access denied",
+			slog.String("user_id", claims.UserID),
+			slog.String("role", string(claims.Role)),
+			slog.String("permission", string(required)),
+			slog.String("method", method),
+		)
+		return status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that authenticates
+// unary calls and enforces RPCRoles and RPCPermissions
+func (s *AuthService) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if PublicRPCMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := s.authenticateRPC(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.authorizeRPC(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// claimsServerStream overrides a server stream's context with one carrying
+// verified claims
+type claimsServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying claims
+func (s *claimsServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that authenticates
+// streams and enforces RPCRoles and RPCPermissions before the handler sees
+// any message
+func (s *AuthService) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if PublicRPCMethods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := s.authenticateRPC(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeRPC(ctx, info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, &claimsServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
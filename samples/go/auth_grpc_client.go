@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// serviceTokenMargin is how long before expiry a cached service token is
+// replaced
+const serviceTokenMargin = time.Minute
+
+// TokenSource supplies a bearer token for outgoing calls
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// ClientCredentialsSource fetches service tokens with the client
+// credentials grant and caches them until shortly before they expire
+type ClientCredentialsSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []Permission // Empty for all of the client's scopes
+	Client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a cached service token, fetching a new one when needed
+func (c *ClientCredentialsSource) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.expires) > serviceTokenMargin {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		names := make([]string, len(c.Scopes))
+		for i, p := range c.Scopes {
+			names[i] = string(p)
+		}
+		form.Set("scope", strings.Join(names, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch service token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch service token: status %d", resp.StatusCode)
+	}
+
+	var token ServiceToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode service token: %w", err)
+	}
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// outgoingToken returns the token to call with: the caller's own token when
+// a call is made on behalf of an authenticated request, otherwise one from
+// source. A nil source only forwards.
+func outgoingToken(ctx context.Context, source TokenSource) (string, error) {
+	if token := TokenFromContext(ctx); token != "" {
+		return token, nil
+	}
+	if source == nil {
+		return "", nil
+	}
+	return source.Token(ctx)
+}
+
+// withAuthorization attaches a bearer token and, for forwarded calls, the
+// caller's identity metadata
+func withAuthorization(ctx context.Context, source TokenSource) (context.Context, error) {
+	token, err := outgoingToken(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return ctx, nil
+	}
+
+	pairs := []string{"authorization", "Bearer " + token}
+	if claims, err := ClaimsFromContext(ctx); err == nil && TokenFromContext(ctx) == token && !claims.IsService() {
+		pairs = append(pairs, "user-id", claims.UserID)
+		if claims.DeviceID != "" {
+			pairs = append(pairs, "x-device-id", claims.DeviceID)
+		}
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
+
+// UnaryClientInterceptor returns a gRPC client interceptor that attaches
+// the caller's token to unary calls, falling back to source for calls not
+// made on behalf of a request
+func UnaryClientInterceptor(source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withAuthorization(ctx, source)
+		if err != nil {
+			return fmt.Errorf("failed to authorize %s: %w", method, err)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor for streams
+func StreamClientInterceptor(source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withAuthorization(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authorize %s: %w", method, err)
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Guest issuance limits, per client IP
+const (
+	maxGuestsPerIP    = 10
+	guestIssuedWindow = time.Hour
+)
+
+// Guest errors
+var (
+	ErrGuestsDisabled    = errors.New("guest sessions are disabled")
+	ErrGuestLimit        = errors.New("too many guest sessions from this address")
+	ErrInvalidGuestToken = errors.New("invalid guest token")
+	ErrGuestConversion   = errors.New("guest session can't be converted")
+)
+
+// TranscriptTransfer hands a guest's conversations to the account they
+// enrolled as, e.g. PostgresMessageStore in the streaming service
+type TranscriptTransfer interface {
+	TransferTranscripts(ctx context.Context, fromUserID, toUserID string) error
+}
+
+// GuestRequest starts a guest session on a facility's demo device
+type GuestRequest struct {
+	FacilityID string `json:"facility_id" binding:"required"`
+	DeviceID   string `json:"device_id"`
+	ClientID   string `json:"client_id"` // TokenClients entry of the demo app
+}
+
+// GuestSession is an issued guest token. There is no refresh token.
+type GuestSession struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	UserID      string    `json:"user_id"`
+	SessionID   string    `json:"session_id"`
+}
+
+// guestIssuedKey counts guest sessions started from an IP
+func guestIssuedKey(ipAddress string) string {
+	return fmt.Sprintf("auth:guest_issued:%s", ipAddress)
+}
+
+// IsGuest reports whether the claims belong to a pre-enrollment guest.
+// Crisis detection for guests escalates to the facility front desk rather
+// than to 911, as there is no care team or identity to send.
+func (c *Claims) IsGuest() bool {
+	return c.Role == RoleGuest
+}
+
+// IssueGuestToken starts a guest session for a prospective resident trying
+// the companion before an account exists. The token carries RoleGuest,
+// which holds no permissions, and lasts GuestTokenExpiry.
+func (s *AuthService) IssueGuestToken(ctx context.Context, req *GuestRequest, ipAddress string) (*GuestSession, error) {
+	if s.config.GuestTokenExpiry <= 0 {
+		return nil, ErrGuestsDisabled
+	}
+	client, err := s.tokenClient(req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var issued *redis.IntCmd
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		issued = pipe.Incr(ctx, guestIssuedKey(ipAddress))
+		pipe.Expire(ctx, guestIssuedKey(ipAddress), guestIssuedWindow)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count guest sessions: %w", err)
+	}
+	if issued.Val() > maxGuestsPerIP {
+		return nil, ErrGuestLimit
+	}
+
+	now := time.Now()
+	expiry := s.config.GuestTokenExpiry
+	userID := "guest_" + uuid.New().String()
+	sessionID := uuid.New().String()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			ID:        uuid.New().String(),
+			Audience:  client.Audiences,
+		},
+		UserID:     userID,
+		Role:       RoleGuest,
+		FacilityID: req.FacilityID,
+		TokenType:  TokenTypeAccess,
+		SessionID:  sessionID,
+		DeviceID:   req.DeviceID,
+		IPAddress:  ipAddress,
+		ClientID:   req.ClientID,
+	}
+	token, err := s.signToken(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign guest token: %w", err)
+	}
+	if err := s.storeSession(ctx, sessionID, userID, req.DeviceID, ipAddress, now, expiry); err != nil {
+		return nil, fmt.Errorf("failed to store guest session: %w", err)
+	}
+
+	if s.auditLogger != nil {
+		s.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp: now,
+			UserID:    userID,
+			EventType: "guest_login",
+			IPAddress: ipAddress,
+			DeviceID:  req.DeviceID,
+			Success:   true,
+		})
+	}
+
+	return &GuestSession{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresAt:   now.Add(expiry),
+		UserID:      userID,
+		SessionID:   sessionID,
+	}, nil
+}
+
+// ConvertGuest moves a guest's transcript to the account they enrolled as
+// and ends the guest session. The account must be a resident's at the
+// facility the guest session was started at.
+func (s *AuthService) ConvertGuest(ctx context.Context, account *Claims, guestToken string, transcripts TranscriptTransfer, ipAddress string) error {
+	guest, err := s.ValidateToken(ctx, guestToken)
+	if err != nil || !guest.IsGuest() {
+		return ErrInvalidGuestToken
+	}
+	switch {
+	case account.IsGuest() || account.IsService() || account.IsImpersonation():
+		return fmt.Errorf("%w: a resident account is required", ErrGuestConversion)
+	case account.Role != RoleResident:
+		return fmt.Errorf("%w: %s accounts can't take a guest transcript", ErrGuestConversion, account.Role)
+	case account.FacilityID != guest.FacilityID:
+		return fmt.Errorf("%w: guest session is at another facility", ErrGuestConversion)
+	}
+
+	if err := transcripts.TransferTranscripts(ctx, guest.UserID, account.UserID); err != nil {
+		return fmt.Errorf("failed to transfer guest transcript: %w", err)
+	}
+	if err := s.dropSession(ctx, guest.SessionID, guest.UserID); err != nil {
+		s.logger.Error("failed to end converted guest session",
+			slog.String("session_id", guest.SessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+	if err := s.blacklistToken(ctx, guest.ID, guest.ExpiresAt.Time); err != nil {
+		s.logger.Error("failed to blacklist guest token",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	s.logger.Info("guest converted",
+		slog.String("guest_id", guest.UserID),
+		slog.String("user_id", account.UserID),
+	)
+	if s.auditLogger != nil {
+		s.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp: time.Now(),
+			UserID:    account.UserID,
+			Role:      account.Role,
+			Resource:  "user:" + guest.UserID,
+			Action:    "guest_convert",
+			IPAddress: ipAddress,
+			SessionID: account.SessionID,
+			Success:   true,
+			Details:   map[string]interface{}{"guest_session_id": guest.SessionID},
+		})
+	}
+	return nil
+}
+
+// GuestHandler starts guest sessions. It is served without authentication.
+func (s *AuthService) GuestHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GuestRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "facility_id required"})
+			return
+		}
+		session, err := s.IssueGuestToken(c.Request.Context(), &req, c.ClientIP())
+		switch {
+		case errors.Is(err, ErrUnknownTokenClient):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrGuestsDisabled):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrGuestLimit):
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case err != nil:
+			s.logger.Error("guest sign-in failed",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "guest sessions unavailable"})
+		default:
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusCreated, session)
+		}
+	}
+}
+
+// RegisterGuestRoutes mounts guest conversion. The group must already run
+// AuthMiddleware; the caller is the newly enrolled resident.
+//
+//	POST /guest/convert    claim a guest transcript ({"guest_token": ...})
+func (s *AuthService) RegisterGuestRoutes(r gin.IRouter, transcripts TranscriptTransfer) {
+	r.POST("/guest/convert", s.RequireHuman(), func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		var req struct {
+			GuestToken string `json:"guest_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "guest_token required"})
+			return
+		}
+
+		err = s.ConvertGuest(c.Request.Context(), claims, req.GuestToken, transcripts, c.ClientIP())
+		switch {
+		case errors.Is(err, ErrInvalidGuestToken):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrGuestConversion):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case err != nil:
+			s.logger.Error("guest conversion failed",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "guest conversion unavailable"})
+		default:
+			c.Status(http.StatusNoContent)
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Impersonation limits
+const (
+	maxImpersonation     = 30 * time.Minute
+	defaultImpersonation = 15 * time.Minute
+	maxTicketLength      = 64
+)
+
+// ImpersonationRPCMethods are the read-only gRPC methods impersonation
+// tokens may call; all others are refused
+var ImpersonationRPCMethods = map[string]bool{}
+
+// Impersonation errors
+var (
+	ErrImpersonationDenied = errors.New("impersonation not allowed")
+	ErrTicketRequired      = errors.New("a support ticket reference is required")
+)
+
+// Actor is the real identity behind an impersonation token, after the
+// RFC 8693 "act" claim
+type Actor struct {
+	UserID    string `json:"sub"`
+	Role      Role   `json:"role"`
+	SessionID string `json:"session_id"`
+	Ticket    string `json:"ticket"`
+}
+
+// UserDirectory looks up the role and facility of a user to impersonate
+type UserDirectory interface {
+	LookupUser(ctx context.Context, userID string) (role Role, facilityID string, err error)
+}
+
+// ImpersonationRequest starts an impersonation
+type ImpersonationRequest struct {
+	TargetUserID string        `json:"target_user_id" binding:"required"`
+	Ticket       string        `json:"ticket" binding:"required"`
+	Reason       string        `json:"reason"`
+	Duration     time.Duration `json:"duration"` // Nanoseconds; capped at 30 minutes
+}
+
+// Impersonation is an issued impersonation token
+type Impersonation struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	SessionID   string    `json:"session_id"`
+}
+
+// IsImpersonation reports whether the claims act for someone other than
+// their holder
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil
+}
+
+// impersonationAllows reports whether an impersonation token may make an
+// HTTP request: reads, and ending the impersonation
+func impersonationAllows(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodDelete:
+		return strings.HasSuffix(path, "/impersonation")
+	}
+	return false
+}
+
+// impersonatorID returns the real user behind the claims, or ""
+func impersonatorID(claims *Claims) string {
+	if claims.Actor == nil {
+		return ""
+	}
+	return claims.Actor.UserID
+}
+
+// Impersonate issues a read-only access token carrying the target's
+// identity and the admin's. There is no refresh token: when it expires the
+// admin starts again with a ticket.
+func (s *AuthService) Impersonate(ctx context.Context, admin *Claims, directory UserDirectory, req *ImpersonationRequest, ipAddress string) (*Impersonation, error) {
+	if err := s.checkImpersonation(ctx, admin, req); err != nil {
+		s.auditImpersonation(ctx, admin, req, "impersonation_start", ipAddress, err)
+		return nil, err
+	}
+	role, facilityID, err := directory.LookupUser(ctx, req.TargetUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if role == RoleAdmin || role == RoleSystem {
+		err := fmt.Errorf("%w: %s accounts can't be impersonated", ErrImpersonationDenied, role)
+		s.auditImpersonation(ctx, admin, req, "impersonation_start", ipAddress, err)
+		return nil, err
+	}
+	if facilityID != admin.FacilityID && !s.claimsPermit(ctx, admin, PermissionAdminSystem) {
+		err := fmt.Errorf("%w: user is at another facility", ErrImpersonationDenied)
+		s.auditImpersonation(ctx, admin, req, "impersonation_start", ipAddress, err)
+		return nil, err
+	}
+
+	duration := req.Duration
+	if duration <= 0 {
+		duration = defaultImpersonation
+	}
+	duration = min(duration, maxImpersonation)
+
+	now := time.Now()
+	sessionID := uuid.New().String()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   req.TargetUserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			ID:        uuid.New().String(),
+			// Usable only where the admin's own token is
+			Audience: admin.Audience,
+		},
+		UserID:     req.TargetUserID,
+		Role:       role,
+		FacilityID: facilityID,
+		TokenType:  TokenTypeAccess,
+		SessionID:  sessionID,
+		IPAddress:  ipAddress,
+		Scopes:     admin.Scopes,
+		ClientID:   admin.ClientID,
+		Actor: &Actor{
+			UserID:    admin.UserID,
+			Role:      admin.Role,
+			SessionID: admin.SessionID,
+			Ticket:    req.Ticket,
+		},
+	}
+	token, err := s.signToken(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	// The session isn't indexed under the target, so it neither shows in
+	// their session list nor counts against their limit
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey(sessionID), map[string]interface{}{
+			"user_id":         req.TargetUserID,
+			"impersonator_id": admin.UserID,
+			"ticket":          req.Ticket,
+			"ip_address":      ipAddress,
+			"created_at":      now.Unix(),
+			"last_active":     now.Unix(),
+		})
+		pipe.Expire(ctx, sessionKey(sessionID), duration)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store impersonation session: %w", err)
+	}
+
+	s.logger.Warn("impersonation started",
+		slog.String("admin_id", admin.UserID),
+		slog.String("target_user_id", req.TargetUserID),
+		slog.String("ticket", req.Ticket),
+		slog.Duration("duration", duration),
+	)
+	s.auditImpersonation(ctx, admin, req, "impersonation_start", ipAddress, nil)
+
+	return &Impersonation{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresAt:   now.Add(duration),
+		SessionID:   sessionID,
+	}, nil
+}
+
+// EndImpersonation ends an impersonation session early
+func (s *AuthService) EndImpersonation(ctx context.Context, claims *Claims, ipAddress string) error {
+	if !claims.IsImpersonation() {
+		return fmt.Errorf("%w: not an impersonation session", ErrImpersonationDenied)
+	}
+	if err := s.redis.Del(ctx, sessionKey(claims.SessionID)).Err(); err != nil {
+		return fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	if err := s.blacklistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Error("failed to blacklist impersonation token",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	admin := &Claims{UserID: claims.Actor.UserID, Role: claims.Actor.Role, SessionID: claims.Actor.SessionID}
+	req := &ImpersonationRequest{TargetUserID: claims.UserID, Ticket: claims.Actor.Ticket}
+	s.auditImpersonation(ctx, admin, req, "impersonation_end", ipAddress, nil)
+	return nil
+}
+
+// checkImpersonation refuses impersonation the admin isn't entitled to
+func (s *AuthService) checkImpersonation(ctx context.Context, admin *Claims, req *ImpersonationRequest) error {
+	switch {
+	case admin.IsService():
+		return fmt.Errorf("%w: services can't impersonate", ErrImpersonationDenied)
+	case admin.IsImpersonation():
+		return fmt.Errorf("%w: already impersonating", ErrImpersonationDenied)
+	case !s.claimsPermit(ctx, admin, PermissionAdminUsers):
+		return fmt.Errorf("%w: %s required", ErrImpersonationDenied, PermissionAdminUsers)
+	case req.TargetUserID == admin.UserID:
+		return fmt.Errorf("%w: can't impersonate yourself", ErrImpersonationDenied)
+	case req.Ticket == "" || len(req.Ticket) > maxTicketLength:
+		return ErrTicketRequired
+	}
+	return nil
+}
+
+// auditImpersonation records the start or end of an impersonation, or a
+// refused attempt
+func (s *AuthService) auditImpersonation(ctx context.Context, admin *Claims, req *ImpersonationRequest, eventType, ipAddress string, err error) {
+	if s.auditLogger == nil {
+		return
+	}
+	event := &AuthEvent{
+		Timestamp: time.Now(),
+		UserID:    admin.UserID,
+		EventType: eventType,
+		IPAddress: ipAddress,
+		Success:   err == nil,
+	}
+	if err != nil {
+		event.FailReason = err.Error()
+	}
+	s.auditLogger.LogAuthentication(ctx, event)
+	s.auditLogger.LogAccess(ctx, &AccessEvent{
+		Timestamp: event.Timestamp,
+		UserID:    admin.UserID,
+		Role:      admin.Role,
+		Resource:  "user:" + req.TargetUserID,
+		Action:    eventType,
+		IPAddress: ipAddress,
+		SessionID: admin.SessionID,
+		Success:   err == nil,
+		Details:   map[string]interface{}{"ticket": req.Ticket, "reason": req.Reason},
+	})
+}
+
+// RegisterImpersonationRoutes mounts impersonation. The group must already
+// run AuthMiddleware.
+//
+//	POST   /impersonation    start, as an admin (PermissionAdminUsers)
+//	DELETE /impersonation    end, with the impersonation token
+func (s *AuthService) RegisterImpersonationRoutes(r gin.IRouter, directory UserDirectory) {
+	r.POST("/impersonation", s.RequireHuman(), s.RequirePermission(PermissionAdminUsers), func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		var req ImpersonationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": ErrTicketRequired.Error()})
+			return
+		}
+		impersonation, err := s.Impersonate(c.Request.Context(), claims, directory, &req, c.ClientIP())
+		if err != nil {
+			s.writeImpersonationError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, impersonation)
+	})
+
+	r.DELETE("/impersonation", func(c *gin.Context) {
+		claims, err := GetClaimsFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if err := s.EndImpersonation(c.Request.Context(), claims, c.ClientIP()); err != nil {
+			s.writeImpersonationError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// writeImpersonationError answers a failed impersonation request
+func (s *AuthService) writeImpersonationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTicketRequired):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrImpersonationDenied):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		s.logger.Error("impersonation failed",
+			slog.String("error", err.Error()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "impersonation unavailable"})
+	}
+}
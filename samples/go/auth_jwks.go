@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSPath is where the JWKS handler is conventionally mounted
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWKS caching. Verifiers refetch at most every jwksMinRefresh when they
+// see an unknown key ID, so a rotation is picked up without a restart.
+const (
+	jwksMaxAge       = time.Hour
+	jwksMinRefresh   = 30 * time.Second
+	jwksFetchTimeout = 5 * time.Second
+)
+
+// ErrUnknownSigningKey is returned for tokens signed by a key the service
+// doesn't know
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is a key tokens are signed with. RSA keys sign with RS256,
+// P-256 ECDSA keys with ES256 and secrets with HS256.
+type SigningKey struct {
+	ID      string        // Sent as the token's kid; asymmetric keys are published under it
+	Private crypto.Signer // *rsa.PrivateKey or *ecdsa.PrivateKey
+	Secret  []byte        // HS256 secret, used when Private is nil
+}
+
+// VerificationKey is a key tokens may be signed with, such as a signing
+// key retired by rotation whose tokens haven't yet expired
+type VerificationKey struct {
+	ID     string
+	Public crypto.PublicKey // *rsa.PublicKey or *ecdsa.PublicKey
+	Secret []byte           // HS256 secret, used when Public is nil
+}
+
+// method returns the algorithm the key signs with
+func (k *SigningKey) method() (jwt.SigningMethod, error) {
+	if k.Private == nil {
+		return jwt.SigningMethodHS256, nil
+	}
+	return signingMethod(k.Private.Public())
+}
+
+// verification returns the key that verifies the key's signatures
+func (k *SigningKey) verification() *VerificationKey {
+	if k.Private == nil {
+		return &VerificationKey{ID: k.ID, Secret: k.Secret}
+	}
+	return &VerificationKey{ID: k.ID, Public: k.Private.Public()}
+}
+
+// method returns the algorithm the key verifies
+func (k *VerificationKey) method() (jwt.SigningMethod, error) {
+	if k.Public == nil {
+		return jwt.SigningMethodHS256, nil
+	}
+	return signingMethod(k.Public)
+}
+
+// material returns the key in the form the JWT library verifies with
+func (k *VerificationKey) material() interface{} {
+	if k.Public == nil {
+		return k.Secret
+	}
+	return k.Public
+}
+
+// JSONWebKey is a public key in JWK form
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served at JWKSPath
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// signingMethod returns the JWT algorithm for a key
+func signingMethod(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// signingKey returns the key new tokens are signed with, or nil to sign
+// with the legacy JWTSecret
+func (s *AuthService) signingKey(ctx context.Context) (*SigningKey, error) {
+	if s.config.KeyStore != nil {
+		return s.config.KeyStore.SigningKey(ctx)
+	}
+	return s.config.SigningKey, nil
+}
+
+// signWithKey signs a token with a key, naming it in the kid header
+func signWithKey(key *SigningKey, claims *Claims) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	if key.Private == nil {
+		return token.SignedString(key.Secret)
+	}
+	return token.SignedString(key.Private)
+}
+
+// verificationKey returns the key a token must verify against. Tokens
+// with a kid are verified by that key, from the key store, the service's
+// own keys or the JWKS. HS256 tokens without one predate key IDs and are
+// verified with the legacy secret while it is configured.
+func (s *AuthService) verificationKey(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && kid == "" {
+			secret, err := s.legacySecret(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if secret == nil {
+				return nil, errors.New("shared-secret tokens are not accepted")
+			}
+			return secret, nil
+		}
+
+		key, err := s.lookupKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm must be the key's, not whatever the token claims
+		method, err := key.method()
+		if err != nil {
+			return nil, err
+		}
+		if method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return key.material(), nil
+	}
+}
+
+// lookupKey finds a verification key by ID
+func (s *AuthService) lookupKey(ctx context.Context, kid string) (*VerificationKey, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("%w: token has no kid", ErrUnknownSigningKey)
+	}
+	if key := s.config.SigningKey; key != nil && key.ID == kid {
+		return key.verification(), nil
+	}
+	for _, key := range s.config.RetiredKeys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	if s.config.KeyStore != nil {
+		key, err := s.config.KeyStore.VerificationKey(ctx, kid)
+		if err == nil || !errors.Is(err, ErrUnknownSigningKey) || s.jwks == nil {
+			return key, err
+		}
+	}
+	if s.jwks != nil {
+		public, err := s.jwks.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return &VerificationKey{ID: kid, Public: public}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+}
+
+// JWKS returns the public keys tokens from this service may be signed
+// with: the current signing key and any retired ones. Secret keys are
+// never published.
+func (s *AuthService) JWKS(ctx context.Context) (*JSONWebKeySet, error) {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	keys := s.config.RetiredKeys
+	if key := s.config.SigningKey; key != nil {
+		keys = append([]*VerificationKey{key.verification()}, keys...)
+	}
+	if s.config.KeyStore != nil {
+		stored, err := s.config.KeyStore.PublicKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keys: %w", err)
+		}
+		keys = append(keys, stored...)
+	}
+	for _, key := range keys {
+		if key.Public == nil {
+			continue
+		}
+		jwk, err := encodeJWK(key.ID, key.Public)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key %s: %w", key.ID, err)
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
+
+// JWKSHandler serves the JWKS so other services can verify tokens without
+// the signing key. It needs no authentication.
+func (s *AuthService) JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set, err := s.JWKS(c.Request.Context())
+		if err != nil {
+			s.logger.Error("failed to build JWKS",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Key set unavailable",
+			})
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, set)
+	}
+}
+
+// encodeJWK converts a public key to JWK form
+func encodeJWK(kid string, public crypto.PublicKey) (*JSONWebKey, error) {
+	method, err := signingMethod(public)
+	if err != nil {
+		return nil, err
+	}
+	jwk := &JSONWebKey{KeyID: kid, Use: "sig", Algorithm: method.Alg()}
+	b64 := base64.RawURLEncoding
+
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = b64.EncodeToString(k.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = b64.EncodeToString(k.X.FillBytes(make([]byte, 32)))
+		jwk.Y = b64.EncodeToString(k.Y.FillBytes(make([]byte, 32)))
+	}
+	return jwk, nil
+}
+
+// decodeJWK converts a JWK to a public key
+func decodeJWK(jwk *JSONWebKey) (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := b64.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := b64.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Curve)
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := b64.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.KeyType)
+}
+
+// jwksCache holds the keys fetched from the issuer's JWKS
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// newJWKSCache creates a cache for the JWKS at url
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// key returns a public key by ID, refetching the set when the key is
+// unknown or the set is stale
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetched)
+	if (ok && age < jwksMaxAge) || (!ok && age < jwksMinRefresh) {
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+		}
+		return key, nil
+	}
+
+	if err := c.fetch(ctx); err != nil {
+		// A stale key is better than rejecting every token while the
+		// issuer is unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok = c.keys[kid]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+	}
+	return key, nil
+}
+
+// fetch replaces the cached keys with the issuer's current set
+func (c *jwksCache) fetch(ctx context.Context) error {
+	c.fetched = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i := range set.Keys {
+		jwk := &set.Keys[i]
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := decodeJWK(jwk)
+		if err != nil {
+			return fmt.Errorf("failed to decode key %s: %w", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = key
+	}
+	c.keys = keys
+	return nil
+}
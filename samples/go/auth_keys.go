@@ -0,0 +1,477 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Redis keys of the shared key store
+const (
+	signingKeysKey     = "auth:signing_keys" // Hash of kid to storedKey
+	currentKeyKey      = "auth:signing_keys:current"
+	keyRotationLockKey = "auth:signing_keys:rotating"
+)
+
+// Key store timing. Other instances pick up a rotation within keyCacheTTL,
+// and sooner when they see a token signed by a key they don't have yet.
+const (
+	keyCacheTTL        = 30 * time.Second
+	keyReloadMin       = time.Second
+	keyRotationCheck   = time.Minute
+	keyRotationLockTTL = 30 * time.Second
+)
+
+// ErrRotationInProgress is returned when another instance is rotating keys
+var ErrRotationInProgress = errors.New("key rotation in progress")
+
+// KeyStore holds the keys tokens are signed and verified with
+type KeyStore interface {
+	// SigningKey returns the key new tokens are signed with
+	SigningKey(ctx context.Context) (*SigningKey, error)
+	// VerificationKey returns the current key or a retired one still in
+	// its grace period
+	VerificationKey(ctx context.Context, kid string) (*VerificationKey, error)
+	// PublicKeys returns the asymmetric keys to publish in the JWKS
+	PublicKeys(ctx context.Context) ([]*VerificationKey, error)
+}
+
+// KeyRotationConfig controls scheduled signing key rotation
+type KeyRotationConfig struct {
+	Algorithm string        // HS256, RS256 or ES256 for new keys
+	Interval  time.Duration // A new key replaces the current one this long after it was made
+	// GracePeriod is how long tokens signed by a retired key still verify.
+	// It should be at least the refresh token lifetime so rotation never
+	// ends a session early.
+	GracePeriod time.Duration
+}
+
+// DefaultKeyRotationConfig returns monthly ES256 rotation with a grace
+// period covering the default refresh token lifetime
+func DefaultKeyRotationConfig() *KeyRotationConfig {
+	return &KeyRotationConfig{
+		Algorithm:   "ES256",
+		Interval:    30 * 24 * time.Hour,
+		GracePeriod: 24 * time.Hour,
+	}
+}
+
+// storedKey is a key as persisted. The key material is sealed with the
+// store's key-encryption key, since Redis is shared with other services.
+type storedKey struct {
+	ID        string     `json:"id"`
+	Algorithm string     `json:"alg"`
+	Sealed    []byte     `json:"sealed"` // PKCS #8 private key, or the HMAC secret
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// loadedKey is an unsealed key
+type loadedKey struct {
+	key       *SigningKey
+	createdAt time.Time
+	retiredAt time.Time // Zero for the current key
+}
+
+// RedisKeyStore shares rotating signing keys between auth service
+// instances
+type RedisKeyStore struct {
+	redis    *redis.Client
+	aead     cipher.AEAD
+	previous cipher.AEAD // The KEK before a rotation, until keys are re-sealed
+	config   *KeyRotationConfig
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	current string
+	keys    map[string]*loadedKey
+	loaded  time.Time
+}
+
+// NewRedisKeyStore creates a key store. kek is the 32-byte AES-256 key
+// that seals key material at rest; it should come from a secrets manager.
+func NewRedisKeyStore(redis *redis.Client, kek []byte, config *KeyRotationConfig, logger *slog.Logger) (*RedisKeyStore, error) {
+	switch config.Algorithm {
+	case "HS256", "RS256", "ES256":
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", config.Algorithm)
+	}
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key-encryption key: %w", err)
+	}
+	return &RedisKeyStore{
+		redis:  redis,
+		aead:   aead,
+		config: config,
+		logger: logger,
+		keys:   make(map[string]*loadedKey),
+	}, nil
+}
+
+// NewRedisKeyStoreFromSecrets creates a key store whose KEK is the named
+// secret. When the secret rotates, stored keys are re-sealed under the new
+// value; until then the old value still unseals them.
+func NewRedisKeyStoreFromSecrets(ctx context.Context, redis *redis.Client, secrets *SecretCache, name string, config *KeyRotationConfig, logger *slog.Logger) (*RedisKeyStore, error) {
+	kek, err := secrets.Secret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := NewRedisKeyStore(redis, kek, config, logger)
+	if err != nil {
+		return nil, err
+	}
+	secrets.OnRotate(name, ks.rekey)
+	return ks, nil
+}
+
+// SigningKey returns the current key, making the first one if there is none
+func (ks *RedisKeyStore) SigningKey(ctx context.Context) (*SigningKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.refresh(ctx, keyCacheTTL); err != nil {
+		return nil, err
+	}
+	if ks.current == "" {
+		if err := ks.rotate(ctx, false); err != nil {
+			return nil, err
+		}
+	}
+	current, ok := ks.keys[ks.current]
+	if !ok {
+		return nil, fmt.Errorf("%w: current key %s", ErrUnknownSigningKey, ks.current)
+	}
+	return current.key, nil
+}
+
+// VerificationKey returns a key by ID if it is current or in its grace
+// period
+func (ks *RedisKeyStore) VerificationKey(ctx context.Context, kid string) (*VerificationKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.refresh(ctx, keyCacheTTL); err != nil {
+		return nil, err
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		// Another instance may have just rotated
+		if err := ks.refresh(ctx, keyReloadMin); err != nil {
+			return nil, err
+		}
+		if k, ok = ks.keys[kid]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+		}
+	}
+	if !k.retiredAt.IsZero() && time.Since(k.retiredAt) > ks.config.GracePeriod {
+		return nil, fmt.Errorf("%w: %s retired", ErrUnknownSigningKey, kid)
+	}
+	return k.key.verification(), nil
+}
+
+// PublicKeys returns the current and retired asymmetric keys
+func (ks *RedisKeyStore) PublicKeys(ctx context.Context) ([]*VerificationKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := ks.refresh(ctx, keyCacheTTL); err != nil {
+		return nil, err
+	}
+	var keys []*VerificationKey
+	for _, k := range ks.keys {
+		if k.key.Private != nil {
+			keys = append(keys, k.key.verification())
+		}
+	}
+	return keys, nil
+}
+
+// Rotate replaces the current signing key now, e.g. when it may have been
+// exposed. Tokens it signed keep verifying for the grace period.
+func (ks *RedisKeyStore) Rotate(ctx context.Context) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.rotate(ctx, false)
+}
+
+// Run rotates the signing key whenever it comes due, until ctx is
+// cancelled. Every instance may run it; one rotates at a time.
+func (ks *RedisKeyStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyRotationCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ks.mu.Lock()
+			err := ks.rotate(ctx, true)
+			ks.mu.Unlock()
+			if err != nil && !errors.Is(err, ErrRotationInProgress) {
+				ks.logger.Error("scheduled key rotation failed",
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// refresh reloads the keys if they are older than maxAge. ks.mu must be
+// held.
+func (ks *RedisKeyStore) refresh(ctx context.Context, maxAge time.Duration) error {
+	if time.Since(ks.loaded) < maxAge {
+		return nil
+	}
+
+	current, err := ks.redis.Get(ctx, currentKeyKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to load current key: %w", err)
+	}
+	stored, err := ks.redis.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make(map[string]*loadedKey, len(stored))
+	for kid, data := range stored {
+		k, err := ks.unseal([]byte(data))
+		if err != nil {
+			ks.logger.Error("failed to load signing key",
+				slog.String("kid", kid),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		keys[kid] = k
+	}
+	ks.current = current
+	ks.keys = keys
+	ks.loaded = time.Now()
+	return nil
+}
+
+// rotate makes a new current key and retires the old one. With onlyIfDue
+// it does nothing unless the current key has reached the rotation
+// interval. ks.mu must be held.
+func (ks *RedisKeyStore) rotate(ctx context.Context, onlyIfDue bool) error {
+	locked, err := ks.redis.SetNX(ctx, keyRotationLockKey, "1", keyRotationLockTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to lock key rotation: %w", err)
+	}
+	if !locked {
+		return ErrRotationInProgress
+	}
+	defer ks.redis.Del(context.WithoutCancel(ctx), keyRotationLockKey)
+
+	// Another instance may have rotated since the last load
+	if err := ks.refresh(ctx, 0); err != nil {
+		return err
+	}
+	previous, hasPrevious := ks.keys[ks.current]
+	if onlyIfDue && hasPrevious && time.Since(previous.createdAt) < ks.config.Interval {
+		return nil
+	}
+
+	key, err := generateSigningKey(ks.config.Algorithm)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	sealed, err := ks.seal(key, now, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = ks.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, signingKeysKey, key.ID, sealed)
+		if hasPrevious {
+			retired, err := ks.seal(previous.key, previous.createdAt, &now)
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, signingKeysKey, previous.key.ID, retired)
+		}
+		// Keys past their grace period can no longer verify anything
+		for kid, k := range ks.keys {
+			if !k.retiredAt.IsZero() && now.Sub(k.retiredAt) > ks.config.GracePeriod {
+				pipe.HDel(ctx, signingKeysKey, kid)
+			}
+		}
+		pipe.Set(ctx, currentKeyKey, key.ID, 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	ks.logger.Info("signing key rotated",
+		slog.String("kid", key.ID),
+		slog.String("alg", ks.config.Algorithm),
+		slog.String("retired_kid", ks.current),
+	)
+	ks.loaded = time.Time{}
+	return ks.refresh(ctx, 0)
+}
+
+// rekey switches to a new KEK and re-seals the stored keys under it
+func (ks *RedisKeyStore) rekey(ctx context.Context, previous, current []byte) error {
+	aead, err := newAEAD(current)
+	if err != nil {
+		return fmt.Errorf("invalid key-encryption key: %w", err)
+	}
+	old, err := newAEAD(previous)
+	if err != nil {
+		return fmt.Errorf("invalid key-encryption key: %w", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.aead, ks.previous = aead, old
+
+	// Every instance sees the rotation; one re-seal is enough
+	locked, err := ks.redis.SetNX(ctx, keyRotationLockKey, "1", keyRotationLockTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to lock key rotation: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+	defer ks.redis.Del(context.WithoutCancel(ctx), keyRotationLockKey)
+
+	if err := ks.refresh(ctx, 0); err != nil {
+		return err
+	}
+	_, err = ks.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for kid, k := range ks.keys {
+			var retiredAt *time.Time
+			if !k.retiredAt.IsZero() {
+				retiredAt = &k.retiredAt
+			}
+			sealed, err := ks.seal(k.key, k.createdAt, retiredAt)
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, signingKeysKey, kid, sealed)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-seal signing keys: %w", err)
+	}
+
+	ks.logger.Info("signing keys re-sealed under new key-encryption key",
+		slog.Int("keys", len(ks.keys)),
+	)
+	return nil
+}
+
+// seal encrypts a key for storage
+func (ks *RedisKeyStore) seal(key *SigningKey, createdAt time.Time, retiredAt *time.Time) ([]byte, error) {
+	material := key.Secret
+	if key.Private != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key: %w", err)
+		}
+		material = der
+	}
+
+	nonce := make([]byte, ks.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	method, err := key.method()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(&storedKey{
+		ID:        key.ID,
+		Algorithm: method.Alg(),
+		// The key ID is bound as additional data so sealed material can't be
+		// swapped between entries
+		Sealed:    ks.aead.Seal(nonce, nonce, material, []byte(key.ID)),
+		CreatedAt: createdAt,
+		RetiredAt: retiredAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	return data, nil
+}
+
+// unseal decrypts a stored key
+func (ks *RedisKeyStore) unseal(data []byte) (*loadedKey, error) {
+	var stored storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signing key: %w", err)
+	}
+	size := ks.aead.NonceSize()
+	if len(stored.Sealed) < size {
+		return nil, errors.New("sealed key too short")
+	}
+	material, err := ks.aead.Open(nil, stored.Sealed[:size], stored.Sealed[size:], []byte(stored.ID))
+	if err != nil && ks.previous != nil {
+		material, err = ks.previous.Open(nil, stored.Sealed[:size], stored.Sealed[size:], []byte(stored.ID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal signing key: %w", err)
+	}
+
+	key := &SigningKey{ID: stored.ID}
+	if stored.Algorithm == "HS256" {
+		key.Secret = material
+	} else {
+		private, err := x509.ParsePKCS8PrivateKey(material)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", private)
+		}
+		key.Private = signer
+	}
+
+	k := &loadedKey{key: key, createdAt: stored.CreatedAt}
+	if stored.RetiredAt != nil {
+		k.retiredAt = *stored.RetiredAt
+	}
+	return k, nil
+}
+
+// generateSigningKey makes a new key for an algorithm
+func generateSigningKey(alg string) (*SigningKey, error) {
+	key := &SigningKey{ID: uuid.New().String()}
+	var err error
+	switch alg {
+	case "HS256":
+		key.Secret = make([]byte, 32)
+		_, err = rand.Read(key.Secret)
+	case "RS256":
+		key.Private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key.Private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Lockout errors
+var (
+	ErrStepUpRequired = errors.New("additional verification required")
+	ErrIPBlocked      = errors.New("too many failed logins from this address")
+)
+
+// LockoutError is returned while an account is locked
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s for %s", ErrAccountLocked, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap makes a LockoutError match ErrAccountLocked
+func (e *LockoutError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// LockoutPolicy controls brute-force protection. Each lockout of an
+// account lasts twice as long as the one before, until a quiet
+// LevelDecay resets it.
+type LockoutPolicy struct {
+	UserThreshold int           // Failures that lock an account
+	IPThreshold   int           // Failures from one address that block it for the FailureWindow
+	StepUpAfter   int           // Failures after which logins need step-up verification
+	FailureWindow time.Duration // Failures older than this are forgotten
+	BaseLockout   time.Duration
+	MaxLockout    time.Duration
+	LevelDecay    time.Duration
+}
+
+// DefaultLockoutPolicy returns brute-force limits for staff and family
+// sign-in
+func DefaultLockoutPolicy() *LockoutPolicy {
+	return &LockoutPolicy{
+		UserThreshold: 5,
+		IPThreshold:   50,
+		StepUpAfter:   3,
+		FailureWindow: time.Hour,
+		BaseLockout:   time.Minute,
+		MaxLockout:    24 * time.Hour,
+		LevelDecay:    24 * time.Hour,
+	}
+}
+
+// StepUpVerifier checks step-up proof, such as a CAPTCHA response
+type StepUpVerifier interface {
+	Verify(ctx context.Context, token, ipAddress string) (bool, error)
+}
+
+// LockoutStatus describes an account's brute-force state
+type LockoutStatus struct {
+	Username   string        `json:"username"`
+	Failures   int           `json:"failures"`
+	Locked     bool          `json:"locked"`
+	RetryAfter time.Duration `json:"retry_after"`
+	Level      int           `json:"level"` // Lockouts since the last quiet period
+}
+
+// Brute-force tracking keys
+func userFailuresKey(username string) string {
+	return fmt.Sprintf("auth:login_failures:user:%s", normalizeUsername(username))
+}
+
+func ipFailuresKey(ipAddress string) string {
+	return fmt.Sprintf("auth:login_failures:ip:%s", ipAddress)
+}
+
+func lockoutKey(username string) string {
+	return fmt.Sprintf("auth:lockout:user:%s", normalizeUsername(username))
+}
+
+func lockoutLevelKey(username string) string {
+	return fmt.Sprintf("auth:lockout:level:user:%s", normalizeUsername(username))
+}
+
+// LoginGuard tracks failed logins per account and per address and locks
+// out brute-force attempts
+type LoginGuard struct {
+	redis       *redis.Client
+	policy      *LockoutPolicy
+	stepUp      StepUpVerifier // Optional; without it step-up is never asked for
+	auditLogger AuditLogger
+	logger      *slog.Logger
+}
+
+// NewLoginGuard creates a login guard. stepUp may be nil to never ask for
+// step-up verification.
+func NewLoginGuard(redis *redis.Client, policy *LockoutPolicy, stepUp StepUpVerifier, auditLogger AuditLogger, logger *slog.Logger) *LoginGuard {
+	return &LoginGuard{
+		redis:       redis,
+		policy:      policy,
+		stepUp:      stepUp,
+		auditLogger: auditLogger,
+		logger:      logger,
+	}
+}
+
+// check refuses a login attempt while the account is locked or the address
+// blocked, and asks for step-up verification after repeated failures
+func (g *LoginGuard) check(ctx context.Context, username, ipAddress, stepUpToken string) error {
+	pipe := g.redis.Pipeline()
+	lockTTL := pipe.PTTL(ctx, lockoutKey(username))
+	userFailures := pipe.Get(ctx, userFailuresKey(username))
+	ipFailures := pipe.Get(ctx, ipFailuresKey(ipAddress))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to check lockout: %w", err)
+	}
+
+	if ttl := lockTTL.Val(); ttl > 0 {
+		return &LockoutError{RetryAfter: ttl}
+	}
+	ipCount, _ := ipFailures.Int()
+	if ipCount >= g.policy.IPThreshold {
+		return ErrIPBlocked
+	}
+
+	userCount, _ := userFailures.Int()
+	if g.stepUp == nil || (userCount < g.policy.StepUpAfter && ipCount < g.policy.StepUpAfter) {
+		return nil
+	}
+	if stepUpToken == "" {
+		return ErrStepUpRequired
+	}
+	ok, err := g.stepUp.Verify(ctx, stepUpToken, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to verify step-up: %w", err)
+	}
+	if !ok {
+		return ErrStepUpRequired
+	}
+	return nil
+}
+
+// fail records a failed login, locking the account once it reaches the
+// threshold
+func (g *LoginGuard) fail(ctx context.Context, username, ipAddress, deviceID string) {
+	var userCount *redis.IntCmd
+	_, err := g.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		userCount = pipe.Incr(ctx, userFailuresKey(username))
+		pipe.Expire(ctx, userFailuresKey(username), g.policy.FailureWindow)
+		pipe.Incr(ctx, ipFailuresKey(ipAddress))
+		pipe.Expire(ctx, ipFailuresKey(ipAddress), g.policy.FailureWindow)
+		return nil
+	})
+	if err != nil {
+		g.logger.Error("failed to record login failure",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if int(userCount.Val()) < g.policy.UserThreshold {
+		return
+	}
+
+	level, err := g.redis.Incr(ctx, lockoutLevelKey(username)).Result()
+	if err != nil {
+		g.logger.Error("failed to record lockout",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	duration := g.lockoutDuration(int(level))
+	_, err = g.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, lockoutLevelKey(username), g.policy.LevelDecay)
+		pipe.Set(ctx, lockoutKey(username), level, duration)
+		// The next lockout needs a fresh run of failures
+		pipe.Del(ctx, userFailuresKey(username))
+		return nil
+	})
+	if err != nil {
+		g.logger.Error("failed to lock account",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	g.logger.Warn("account locked after failed logins",
+		slog.String("username", normalizeUsername(username)),
+		slog.String("ip", ipAddress),
+		slog.Int64("level", level),
+		slog.Duration("duration", duration),
+	)
+	if g.auditLogger != nil {
+		g.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp:  time.Now(),
+			UserID:     normalizeUsername(username),
+			EventType:  "account_locked",
+			IPAddress:  ipAddress,
+			DeviceID:   deviceID,
+			Success:    false,
+			FailReason: fmt.Sprintf("%d failed logins; locked for %s", g.policy.UserThreshold, duration),
+		})
+	}
+}
+
+// succeed clears an account's failures after a successful login. Its
+// lockout level stands until it decays.
+func (g *LoginGuard) succeed(ctx context.Context, username string) {
+	g.redis.Del(ctx, userFailuresKey(username))
+}
+
+// lockoutDuration doubles with each lockout, up to the maximum
+func (g *LoginGuard) lockoutDuration(level int) time.Duration {
+	duration := g.policy.BaseLockout
+	for i := 1; i < level && duration < g.policy.MaxLockout; i++ {
+		duration *= 2
+	}
+	return min(duration, g.policy.MaxLockout)
+}
+
+// Status returns an account's brute-force state
+func (g *LoginGuard) Status(ctx context.Context, username string) (*LockoutStatus, error) {
+	pipe := g.redis.Pipeline()
+	lockTTL := pipe.PTTL(ctx, lockoutKey(username))
+	failures := pipe.Get(ctx, userFailuresKey(username))
+	level := pipe.Get(ctx, lockoutLevelKey(username))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load lockout status: %w", err)
+	}
+
+	status := &LockoutStatus{Username: normalizeUsername(username)}
+	status.Failures, _ = failures.Int()
+	status.Level, _ = level.Int()
+	if ttl := lockTTL.Val(); ttl > 0 {
+		status.Locked = true
+		status.RetryAfter = ttl
+	}
+	return status, nil
+}
+
+// Unlock clears an account's lockout, failures and lockout level
+func (g *LoginGuard) Unlock(ctx context.Context, username, adminID, ipAddress string) error {
+	err := g.redis.Del(ctx, lockoutKey(username), userFailuresKey(username), lockoutLevelKey(username)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+
+	g.logger.Info("account unlocked",
+		slog.String("username", normalizeUsername(username)),
+		slog.String("admin_id", adminID),
+	)
+	if g.auditLogger != nil {
+		g.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp: time.Now(),
+			UserID:    normalizeUsername(username),
+			EventType: "account_unlocked",
+			IPAddress: ipAddress,
+			Success:   true,
+		})
+		g.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp: time.Now(),
+			UserID:    adminID,
+			Resource:  "account:" + normalizeUsername(username),
+			Action:    "unlock",
+			IPAddress: ipAddress,
+			Success:   true,
+		})
+	}
+	return nil
+}
+
+// UnblockIP clears an address's failures
+func (g *LoginGuard) UnblockIP(ctx context.Context, blocked, adminID, ipAddress string) error {
+	if err := g.redis.Del(ctx, ipFailuresKey(blocked)).Err(); err != nil {
+		return fmt.Errorf("failed to unblock address: %w", err)
+	}
+	if g.auditLogger != nil {
+		g.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp: time.Now(),
+			UserID:    adminID,
+			Resource:  "ip:" + blocked,
+			Action:    "unblock",
+			IPAddress: ipAddress,
+			Success:   true,
+		})
+	}
+	return nil
+}
+
+// StatusHandler serves an account's lockout state for the :username path
+// parameter. Mount it behind RequirePermission(PermissionAdminUsers).
+func (g *LoginGuard) StatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := g.Status(c.Request.Context(), c.Param("username"))
+		if err != nil {
+			g.logger.Error("failed to load lockout status",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "lockout status unavailable",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// UnlockHandler unlocks the account in the :username path parameter.
+// Mount it behind RequirePermission(PermissionAdminUsers).
+func (g *LoginGuard) UnlockHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := g.Unlock(c.Request.Context(), c.Param("username"), c.GetString("user_id"), c.ClientIP()); err != nil {
+			g.logger.Error("failed to unlock account",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "unlock failed",
+			})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// UnblockIPHandler unblocks the address in the :ip path parameter. Mount
+// it behind RequirePermission(PermissionAdminUsers).
+func (g *LoginGuard) UnblockIPHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := g.UnblockIP(c.Request.Context(), c.Param("ip"), c.GetString("user_id"), c.ClientIP()); err != nil {
+			g.logger.Error("failed to unblock address",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "unblock failed",
+			})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// writeLoginRefusal answers a login the guard refused
+func writeLoginRefusal(c *gin.Context, err error) bool {
+	var locked *LockoutError
+	var secondFactor *SecondFactorRequired
+	switch {
+	case errors.As(err, &secondFactor):
+		c.Header("Cache-Control", "no-store")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":         secondFactor.Error(),
+			"second_factor": "webauthn",
+			"ceremony_id":   secondFactor.CeremonyID,
+			"options":       secondFactor.Options,
+		})
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many failed attempts, try again later",
+		})
+	case errors.Is(err, ErrIPBlocked):
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many failed attempts, try again later",
+		})
+	case errors.Is(err, ErrNetworkDenied), errors.Is(err, ErrUserDeactivated), errors.Is(err, ErrSecurityKeyRequired):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrUnknownTokenClient):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrStepUpRequired):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":            "additional verification required",
+			"step_up_required": true,
+		})
+	default:
+		return false
+	}
+	return true
+}
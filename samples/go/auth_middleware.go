@@ -29,6 +29,7 @@ const (
 	RoleProvider Role = "provider"
 	RoleAdmin    Role = "admin"
 	RoleSystem   Role = "system"
+	RoleGuest    Role = "guest" // Pre-enrollment demo; no permissions
 )
 
 // Permission definitions
@@ -43,6 +44,7 @@ const (
 	PermissionReadAssessment   Permission = "assessment:read"
 	PermissionWriteAssessment  Permission = "assessment:write"
 	PermissionReadAudit        Permission = "audit:read"
+	PermissionExportTranscript Permission = "transcript:export"
 	PermissionAdminUsers       Permission = "admin:users"
 	PermissionAdminSystem      Permission = "admin:system"
 )
@@ -70,6 +72,7 @@ var RolePermissions = map[Role][]Permission{
 		PermissionAcknowledgeCrisis,
 		PermissionReadAssessment,
 		PermissionWriteAssessment,
+		PermissionExportTranscript,
 	},
 	RoleAdmin: {
 		PermissionReadResident,
@@ -80,9 +83,11 @@ var RolePermissions = map[Role][]Permission{
 		PermissionReadAssessment,
 		PermissionWriteAssessment,
 		PermissionReadAudit,
+		PermissionExportTranscript,
 		PermissionAdminUsers,
 		PermissionAdminSystem,
 	},
+	RoleGuest: {},
 }
 
 // TokenType distinguishes between access and refresh tokens
@@ -91,6 +96,7 @@ type TokenType string
 const (
 	TokenTypeAccess  TokenType = "access"
 	TokenTypeRefresh TokenType = "refresh"
+	TokenTypeService TokenType = "service" // Client credentials; no session or refresh
 )
 
 // Claims represents JWT claims with HIPAA-required fields
@@ -103,16 +109,32 @@ type Claims struct {
 	SessionID   string    `json:"session_id"`
 	DeviceID    string    `json:"device_id,omitempty"`
 	IPAddress   string    `json:"ip_address,omitempty"`
+	Scopes      []Permission `json:"scopes,omitempty"` // Service token grants, or a client's narrowing of a session's role
+	ClientID    string       `json:"client_id,omitempty"` // TokenClients entry a session token was minted for
+	Actor       *Actor       `json:"act,omitempty"`    // Impersonation tokens only
 }
 
 // AuthConfig contains authentication configuration
 type AuthConfig struct {
-	JWTSecret           string
+	JWTSecret           string // Legacy HS256 secret for tokens without a kid; they are rejected when empty
+	JWTSecretName       string // Name of the legacy secret in Secrets, used in place of JWTSecret
+	Secrets             SecretProvider // Vault, AWS or other secret storage
+	SigningKey          *SigningKey // Signs tokens in place of JWTSecret
+	RetiredKeys         []*VerificationKey // Still verified and published after rotation
+	KeyStore            KeyStore // Rotating keys; takes precedence over SigningKey for signing
+	JWKSURL             string // Verifies tokens from an issuer's published keys
+	Roles               *RoleStore // Custom and per-facility roles; RolePermissions when nil
+	Network             *NetworkGuard // Facility network policies; unrestricted when nil
+	Audience            string // This service's mesh ServiceType; tokens not naming it are refused. Empty accepts any.
+	TokenClients        map[string]*TokenClient // Apps users sign in through, by client ID
 	AccessTokenExpiry   time.Duration
 	RefreshTokenExpiry  time.Duration
+	IdleTimeout         time.Duration // Sessions unused this long are ended; zero disables
+	GuestTokenExpiry    time.Duration // Lifetime of guest tokens; zero disables guest sessions
 	MaxConcurrentSessions int
 	RequireDeviceBinding bool
 	AuditAllAccess      bool
+	RolePolicies        map[Role]*SessionPolicy // Per-role overrides of the session settings above
 }
 
 // DefaultAuthConfig returns HIPAA-compliant default configuration
@@ -120,6 +142,8 @@ func DefaultAuthConfig() *AuthConfig {
 	return &AuthConfig{
 		AccessTokenExpiry:     15 * time.Minute,  // HIPAA: Short session timeout
 		RefreshTokenExpiry:    8 * time.Hour,     // HIPAA: Daily re-authentication
+		IdleTimeout:           30 * time.Minute,  // HIPAA: Automatic logoff
+		GuestTokenExpiry:      30 * time.Minute,  // One demo conversation
 		MaxConcurrentSessions: 3,
 		RequireDeviceBinding:  true,
 		AuditAllAccess:        true,
@@ -132,6 +156,7 @@ type AuthService struct {
 	redis       *redis.Client
 	logger      *slog.Logger
 	auditLogger AuditLogger
+	jwks        *jwksCache
 }
 
 // AuditLogger defines the interface for HIPAA audit logging
@@ -142,16 +167,17 @@ type AuditLogger interface {
 
 // AccessEvent represents an access audit event
 type AccessEvent struct {
-	Timestamp   time.Time
-	UserID      string
-	Role        Role
-	Resource    string
-	Action      string
-	IPAddress   string
-	UserAgent   string
-	SessionID   string
-	Success     bool
-	Details     map[string]interface{}
+	Timestamp      time.Time
+	UserID         string
+	Role           Role
+	Resource       string
+	Action         string
+	IPAddress      string
+	UserAgent      string
+	SessionID      string
+	Success        bool
+	Details        map[string]interface{}
+	ImpersonatorID string // The admin acting as UserID, if any
 }
 
 // AuthEvent represents an authentication audit event
@@ -168,31 +194,52 @@ type AuthEvent struct {
 
 // NewAuthService creates a new authentication service
 func NewAuthService(config *AuthConfig, redis *redis.Client, logger *slog.Logger, auditLogger AuditLogger) *AuthService {
-	return &AuthService{
+	s := &AuthService{
 		config:      config,
 		redis:       redis,
 		logger:      logger,
 		auditLogger: auditLogger,
 	}
+	if config.JWKSURL != "" {
+		s.jwks = newJWKSCache(config.JWKSURL)
+	}
+	return s
 }
 
 // GenerateTokenPair generates access and refresh tokens
 func (s *AuthService) GenerateTokenPair(ctx context.Context, userID string, role Role, facilityID string, deviceID string, ipAddress string) (*TokenPair, error) {
-	sessionID := uuid.New().String()
-	now := time.Now()
+	return s.GenerateClientTokenPair(ctx, "", userID, role, facilityID, deviceID, ipAddress)
+}
 
-	// Check concurrent session limit
-	if err := s.checkSessionLimit(ctx, userID); err != nil {
+// GenerateClientTokenPair generates tokens for a user signing in through
+// one of TokenClients, carrying its audiences and scopes
+func (s *AuthService) GenerateClientTokenPair(ctx context.Context, clientID string, userID string, role Role, facilityID string, deviceID string, ipAddress string) (*TokenPair, error) {
+	client, err := s.tokenClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUserActive(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.checkNetwork(ctx, userID, role, facilityID, ipAddress); err != nil {
 		return nil, err
 	}
+	if s.config.Network != nil {
+		s.config.Network.checkTravel(ctx, userID, ipAddress)
+	}
+
+	sessionID := uuid.New().String()
+	now := time.Now()
+	rules := s.sessionRules(role)
 
 	// Generate access token
 	accessClaims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.AccessTokenExpiry)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(rules.accessExpiry)),
 			ID:        uuid.New().String(),
+			Audience:  client.Audiences,
 		},
 		UserID:     userID,
 		Role:       role,
@@ -201,9 +248,11 @@ func (s *AuthService) GenerateTokenPair(ctx context.Context, userID string, role
 		SessionID:  sessionID,
 		DeviceID:   deviceID,
 		IPAddress:  ipAddress,
+		Scopes:     client.Scopes,
+		ClientID:   clientID,
 	}
 
-	accessToken, err := s.signToken(accessClaims)
+	accessToken, err := s.signToken(ctx, accessClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign access token: %w", err)
 	}
@@ -213,7 +262,7 @@ func (s *AuthService) GenerateTokenPair(ctx context.Context, userID string, role
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.RefreshTokenExpiry)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(rules.refreshExpiry)),
 			ID:        uuid.New().String(),
 		},
 		UserID:     userID,
@@ -222,18 +271,28 @@ func (s *AuthService) GenerateTokenPair(ctx context.Context, userID string, role
 		TokenType:  TokenTypeRefresh,
 		SessionID:  sessionID,
 		DeviceID:   deviceID,
+		ClientID:   clientID,
 	}
 
-	refreshToken, err := s.signToken(refreshClaims)
+	refreshToken, err := s.signToken(ctx, refreshClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
 	// Store session in Redis
-	if err := s.storeSession(ctx, sessionID, userID, deviceID, now); err != nil {
+	if err := s.storeSession(ctx, sessionID, userID, deviceID, ipAddress, now, rules.refreshExpiry); err != nil {
 		return nil, fmt.Errorf("failed to store session: %w", err)
 	}
 
+	// Enforce the concurrent session limit now the new session is indexed,
+	// so simultaneous logins can't both slip under it
+	if err := s.enforceSessionLimit(ctx, userID, rules.maxSessions); err != nil {
+		s.logger.Error("failed to enforce session limit",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+
 	// Audit log
 	if s.auditLogger != nil {
 		s.auditLogger.LogAuthentication(ctx, &AuthEvent{
@@ -249,7 +308,7 @@ func (s *AuthService) GenerateTokenPair(ctx context.Context, userID string, role
 	return &TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    int(s.config.AccessTokenExpiry.Seconds()),
+		ExpiresIn:    int(rules.accessExpiry.Seconds()),
 		TokenType:    "Bearer",
 		SessionID:    sessionID,
 	}, nil
@@ -264,20 +323,32 @@ type TokenPair struct {
 	SessionID    string `json:"session_id"`
 }
 
-// signToken signs a JWT token
-func (s *AuthService) signToken(claims *Claims) (string, error) {
+// signToken signs a JWT token with the current signing key, or the legacy
+// secret if no signing key is configured
+func (s *AuthService) signToken(ctx context.Context, claims *Claims) (string, error) {
+	key, err := s.signingKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+	if key != nil {
+		return signWithKey(key, claims)
+	}
+	secret, err := s.legacySecret(ctx)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", errors.New("no signing key configured")
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	return token.SignedString(secret)
 }
 
 // ValidateToken validates a JWT token and returns claims
 func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.verificationKey(ctx),
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -295,8 +366,15 @@ func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*C
 		return nil, errors.New("token has been revoked")
 	}
 
+	if claims.IsService() {
+		if err := s.validateServiceClient(ctx, claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
 	// Check if session is still valid
-	if valid, err := s.isSessionValid(ctx, claims.SessionID); err != nil {
+	if valid, err := s.isSessionValid(ctx, claims); err != nil {
 		return nil, fmt.Errorf("failed to check session: %w", err)
 	} else if !valid {
 		return nil, errors.New("session has been terminated")
@@ -323,16 +401,24 @@ func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, ip
 		)
 	}
 
+	// The new pair replaces the old session. It goes first so the session
+	// limit doesn't count it and revoke one of the user's other devices.
+	if err := s.dropSession(ctx, claims.SessionID, claims.UserID); err != nil {
+		s.logger.Error("failed to drop refreshed session",
+			slog.String("error", err.Error()),
+		)
+	}
+
 	// Generate new token pair
-	return s.GenerateTokenPair(ctx, claims.UserID, claims.Role, claims.FacilityID, claims.DeviceID, ipAddress)
+	// The client's current settings apply, not those the old pair had
+	return s.GenerateClientTokenPair(ctx, claims.ClientID, claims.UserID, claims.Role, claims.FacilityID, claims.DeviceID, ipAddress)
 }
 
 // RevokeSession terminates a user session
 func (s *AuthService) RevokeSession(ctx context.Context, sessionID string, userID string, reason string) error {
 	// Delete session from Redis
-	key := fmt.Sprintf("session:%s", sessionID)
-	if err := s.redis.Del(ctx, key).Err(); err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
+	if err := s.dropSession(ctx, sessionID, userID); err != nil {
+		return err
 	}
 
 	// Audit log
@@ -351,53 +437,106 @@ func (s *AuthService) RevokeSession(ctx context.Context, sessionID string, userI
 
 // RevokeAllSessions terminates all sessions for a user
 func (s *AuthService) RevokeAllSessions(ctx context.Context, userID string) error {
-	pattern := fmt.Sprintf("session:*:user:%s", userID)
-	iter := s.redis.Scan(ctx, 0, pattern, 0).Iterator()
+	ids, err := s.redis.ZRange(ctx, userSessionsKey(userID), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
 
-	for iter.Next(ctx) {
-		if err := s.redis.Del(ctx, iter.Val()).Err(); err != nil {
-			s.logger.Error("failed to delete session",
-				slog.String("key", iter.Val()),
-				slog.String("error", err.Error()),
-			)
-		}
+	keys := []string{userSessionsKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	if err := s.redis.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	// Audit log
+	if s.auditLogger != nil {
+		s.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp:  time.Now(),
+			UserID:     userID,
+			EventType:  "logout",
+			Success:    true,
+			FailReason: fmt.Sprintf("all %d sessions revoked", len(ids)),
+		})
 	}
 
-	return iter.Err()
+	return nil
 }
 
 // storeSession stores session information in Redis
-func (s *AuthService) storeSession(ctx context.Context, sessionID, userID, deviceID string, createdAt time.Time) error {
-	key := fmt.Sprintf("session:%s", sessionID)
+func (s *AuthService) storeSession(ctx context.Context, sessionID, userID, deviceID, ipAddress string, createdAt time.Time, lifetime time.Duration) error {
+	key := sessionKey(sessionID)
 	data := map[string]interface{}{
 		"user_id":    userID,
 		"device_id":  deviceID,
+		"ip_address": ipAddress,
 		"created_at": createdAt.Unix(),
 		"last_active": time.Now().Unix(),
 	}
 
-	if err := s.redis.HSet(ctx, key, data).Err(); err != nil {
-		return err
-	}
-
-	// Set expiration
-	return s.redis.Expire(ctx, key, s.config.RefreshTokenExpiry).Err()
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, data)
+		pipe.Expire(ctx, key, lifetime)
+		// The index is ordered by creation; sessions expire a fixed time
+		// after creation, so older entries are dropped by score
+		index := userSessionsKey(userID)
+		pipe.ZAdd(ctx, index, &redis.Z{Score: float64(createdAt.Unix()), Member: sessionID})
+		pipe.ZRemRangeByScore(ctx, index, "-inf", sessionExpiredBefore(createdAt, lifetime))
+		pipe.Expire(ctx, index, lifetime)
+		return nil
+	})
+	return err
 }
 
-// isSessionValid checks if a session exists and is valid
-func (s *AuthService) isSessionValid(ctx context.Context, sessionID string) (bool, error) {
-	key := fmt.Sprintf("session:%s", sessionID)
-	exists, err := s.redis.Exists(ctx, key).Result()
+// isSessionValid checks if a session exists and has not been idle for
+// longer than the role allows. Each use slides the idle window forward;
+// a session found idle is ended.
+func (s *AuthService) isSessionValid(ctx context.Context, claims *Claims) (bool, error) {
+	key := sessionKey(claims.SessionID)
+	lastActive, err := s.redis.HGet(ctx, key, "last_active").Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
-	if exists > 0 {
-		// Update last active timestamp
-		s.redis.HSet(ctx, key, "last_active", time.Now().Unix())
+	now := time.Now()
+	idle := now.Sub(time.Unix(lastActive, 0))
+	if timeout := s.sessionRules(claims.Role).idleTimeout; timeout > 0 && idle > timeout {
+		s.expireIdleSession(ctx, claims, idle)
+		return false, nil
 	}
 
-	return exists > 0, nil
+	// Update last active timestamp
+	s.redis.HSet(ctx, key, "last_active", now.Unix())
+	return true, nil
+}
+
+// expireIdleSession ends a session that went unused for too long
+func (s *AuthService) expireIdleSession(ctx context.Context, claims *Claims, idle time.Duration) {
+	if err := s.dropSession(ctx, claims.SessionID, claims.UserID); err != nil {
+		s.logger.Error("failed to end idle session",
+			slog.String("session_id", claims.SessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+	s.logger.Info("session expired after inactivity",
+		slog.String("user_id", claims.UserID),
+		slog.String("session_id", claims.SessionID),
+		slog.Duration("idle", idle),
+	)
+	if s.auditLogger != nil {
+		s.auditLogger.LogAuthentication(ctx, &AuthEvent{
+			Timestamp:  time.Now(),
+			UserID:     claims.UserID,
+			EventType:  "idle_timeout",
+			DeviceID:   claims.DeviceID,
+			Success:    true,
+			FailReason: fmt.Sprintf("session %s idle for %s", claims.SessionID, idle.Round(time.Second)),
+		})
+	}
 }
 
 // blacklistToken adds a token to the blacklist
@@ -418,21 +557,28 @@ func (s *AuthService) isTokenBlacklisted(ctx context.Context, tokenID string) (b
 	return exists > 0, err
 }
 
-// checkSessionLimit enforces concurrent session limits
-func (s *AuthService) checkSessionLimit(ctx context.Context, userID string) error {
-	pattern := fmt.Sprintf("session:*:user:%s", userID)
-	keys, err := s.redis.Keys(ctx, pattern).Result()
+// enforceSessionLimit revokes a user's oldest sessions beyond limit. A
+// limit of zero or less means no limit.
+func (s *AuthService) enforceSessionLimit(ctx context.Context, userID string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	// Everything but the newest limit sessions, oldest first
+	surplus, err := s.redis.ZRange(ctx, userSessionsKey(userID), 0, int64(-limit-1)).Result()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to list sessions: %w", err)
 	}
 
-	if len(keys) >= s.config.MaxConcurrentSessions {
-		// Revoke oldest session
-		// In production, would track session age and revoke oldest
+	for _, sessionID := range surplus {
 		s.logger.Warn("session limit reached, revoking oldest session",
 			slog.String("user_id", userID),
-			slog.Int("session_count", len(keys)),
+			slog.String("session_id", sessionID),
+			slog.Int("limit", limit),
 		)
+		if err := s.RevokeSession(ctx, sessionID, userID, "concurrent session limit"); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -473,24 +619,60 @@ func (s *AuthService) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Verify token type
-		if claims.TokenType != TokenTypeAccess {
+		if err := checkPrincipal(claims); err != nil {
+			s.logger.Warn("token refused",
+				slog.String("user_id", claims.UserID),
+				slog.String("error", err.Error()),
+			)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "invalid token type",
 			})
 			return
 		}
+		if err := s.checkAudience(claims); err != nil {
+			s.logger.Warn("token refused",
+				slog.String("user_id", claims.UserID),
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": ErrWrongAudience.Error(),
+			})
+			return
+		}
 
-		// Device binding check
-		if s.config.RequireDeviceBinding && claims.DeviceID != "" {
-			deviceID := c.GetHeader("X-Device-ID")
-			if deviceID != claims.DeviceID {
-				s.logger.Warn("device binding mismatch",
-					slog.String("user_id", claims.UserID),
-					slog.String("expected", claims.DeviceID),
-					slog.String("actual", deviceID),
-				)
-				// Could enforce or just log depending on policy
+		// Network policy is applied to every request, not just sign-in
+		if err := s.checkNetwork(c.Request.Context(), claims.UserID, claims.Role, claims.FacilityID, c.ClientIP()); err != nil {
+			if errors.Is(err, ErrNetworkDenied) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": err.Error(),
+				})
+				return
 			}
+			s.logger.Error("failed to evaluate network policy",
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "authentication unavailable",
+			})
+			return
+		}
+
+		// Impersonation only looks; it never acts for the user
+		if claims.IsImpersonation() && !impersonationAllows(c.Request.Method, c.Request.URL.Path) {
+			logDecision(c.Request.Context(), s.auditLogger, requestEvent(c, claims, nil), false, ReasonImpersonationReadOnly)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "read-only while impersonating",
+			})
+			return
+		}
+
+		// Device binding check
+		rules := s.sessionRules(claims.Role)
+		if err := s.checkDevice(claims, rules, c.GetHeader("X-Device-ID")); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
 		}
 
 		// Set claims in context
@@ -499,19 +681,25 @@ func (s *AuthService) AuthMiddleware() gin.HandlerFunc {
 		c.Set("role", claims.Role)
 		c.Set("facility_id", claims.FacilityID)
 		c.Set("session_id", claims.SessionID)
-
-		// Audit access if enabled
-		if s.config.AuditAllAccess && s.auditLogger != nil {
+		c.Set("service", claims.IsService())
+		// Also on the request context, so gRPC calls made while handling
+		// the request forward the caller's token
+		ctx := context.WithValue(c.Request.Context(), tokenCtx{}, tokenString)
+		c.Request = c.Request.WithContext(WithClaims(ctx, claims))
+
+		// Audit access if enabled; impersonated access always is
+		if (rules.auditAll || claims.IsImpersonation()) && s.auditLogger != nil {
 			s.auditLogger.LogAccess(c.Request.Context(), &AccessEvent{
-				Timestamp: time.Now(),
-				UserID:    claims.UserID,
-				Role:      claims.Role,
-				Resource:  c.Request.URL.Path,
-				Action:    c.Request.Method,
-				IPAddress: c.ClientIP(),
-				UserAgent: c.GetHeader("User-Agent"),
-				SessionID: claims.SessionID,
-				Success:   true,
+				Timestamp:      time.Now(),
+				UserID:         claims.UserID,
+				Role:           claims.Role,
+				Resource:       c.Request.URL.Path,
+				Action:         c.Request.Method,
+				IPAddress:      c.ClientIP(),
+				UserAgent:      c.GetHeader("User-Agent"),
+				SessionID:      claims.SessionID,
+				Success:        true,
+				ImpersonatorID: impersonatorID(claims),
 			})
 		}
 
@@ -539,6 +727,14 @@ func (s *AuthService) RequireRole(allowedRoles ...Role) gin.HandlerFunc {
 			}
 		}
 
+		reason := ReasonRoleAllowed
+		if !allowed {
+			reason = ReasonMissingRole
+		}
+		logDecision(c.Request.Context(), s.auditLogger, requestEvent(c, userClaims, map[string]interface{}{
+			"allowed_roles": allowedRoles,
+		}), allowed, reason)
+
 		if !allowed {
 			s.logger.Warn("role access denied",
 				slog.String("user_id", userClaims.UserID),
@@ -568,22 +764,18 @@ func (s *AuthService) RequirePermission(required Permission) gin.HandlerFunc {
 		}
 
 		userClaims := claims.(*Claims)
-		permissions := RolePermissions[userClaims.Role]
-
-		hasPermission := false
-		for _, p := range permissions {
-			if p == required {
-				hasPermission = true
-				break
-			}
-		}
+		granted, reason := s.permissionDecision(c.Request.Context(), userClaims, required)
+		logDecision(c.Request.Context(), s.auditLogger, requestEvent(c, userClaims, map[string]interface{}{
+			"permission": string(required),
+		}), granted, reason)
 
-		if !hasPermission {
+		if !granted {
 			s.logger.Warn("permission access denied",
 				slog.String("user_id", userClaims.UserID),
 				slog.String("role", string(userClaims.Role)),
 				slog.String("permission", string(required)),
 				slog.String("resource", c.Request.URL.Path),
+				slog.String("reason", string(reason)),
 			)
 
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
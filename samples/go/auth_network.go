@@ -0,0 +1,465 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Network policy limits
+const (
+	maxNetworkOverride  = 4 * time.Hour
+	lastLoginRetention  = 30 * 24 * time.Hour
+	minTravelDistanceKm = 100 // GeoIP is rarely more precise than this
+	earthRadiusKm       = 6371
+)
+
+// Network policy errors
+var (
+	ErrNetworkDenied        = errors.New("access from this network is not allowed")
+	ErrInvalidNetworkPolicy = errors.New("invalid network policy")
+)
+
+// NetworkPolicy restricts the addresses a facility's privileged accounts
+// may sign in and work from
+type NetworkPolicy struct {
+	FacilityID   string    `json:"facility_id"`
+	AllowedCIDRs []string  `json:"allowed_cidrs"`
+	Roles        []Role    `json:"roles"` // Restricted roles; admins when empty
+	UpdatedAt    time.Time `json:"updated_at"`
+	UpdatedBy    string    `json:"updated_by"`
+
+	prefixes []netip.Prefix
+}
+
+// Validate parses the policy's address ranges
+func (p *NetworkPolicy) Validate() error {
+	if len(p.AllowedCIDRs) == 0 {
+		return fmt.Errorf("%w: at least one address range is required", ErrInvalidNetworkPolicy)
+	}
+	p.prefixes = make([]netip.Prefix, 0, len(p.AllowedCIDRs))
+	for _, cidr := range p.AllowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return fmt.Errorf("%w: %s is not a CIDR range", ErrInvalidNetworkPolicy, cidr)
+		}
+		p.prefixes = append(p.prefixes, prefix.Masked())
+	}
+	return nil
+}
+
+// restricts reports whether the policy applies to a role
+func (p *NetworkPolicy) restricts(role Role) bool {
+	if len(p.Roles) == 0 {
+		return role == RoleAdmin
+	}
+	return slices.Contains(p.Roles, role)
+}
+
+// allows reports whether an address is inside the policy's ranges
+func (p *NetworkPolicy) allows(ipAddress string) bool {
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkOverride lets one user past their facility's network policy for a
+// short time, e.g. an administrator working from a hospital during an
+// emergency
+type NetworkOverride struct {
+	UserID    string    `json:"user_id"`
+	Reason    string    `json:"reason"`
+	GrantedBy string    `json:"granted_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GeoPoint is an approximate location
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// GeoLocator locates addresses, returning nil for ones it can't place
+type GeoLocator interface {
+	Locate(ctx context.Context, ipAddress string) (*GeoPoint, error)
+}
+
+// Network policy keys
+func networkPolicyKey(facilityID string) string {
+	return fmt.Sprintf("auth:network_policy:%s", facilityID)
+}
+
+func networkOverrideKey(userID string) string {
+	return fmt.Sprintf("auth:network_override:%s", userID)
+}
+
+func lastLoginKey(userID string) string {
+	return fmt.Sprintf("auth:last_login:%s", userID)
+}
+
+// NetworkGuard enforces facility network policies on sign-in and on every
+// request, and flags sign-ins from locations the user couldn't have
+// travelled to since their last one
+type NetworkGuard struct {
+	redis          *redis.Client
+	geo            GeoLocator // Optional; without it travel isn't checked
+	auditLogger    AuditLogger
+	logger         *slog.Logger
+	maxTravelSpeed float64 // km/h
+}
+
+// NewNetworkGuard creates a network guard. geo may be nil to skip
+// geo-velocity checks.
+func NewNetworkGuard(redis *redis.Client, geo GeoLocator, auditLogger AuditLogger, logger *slog.Logger) *NetworkGuard {
+	return &NetworkGuard{
+		redis:          redis,
+		geo:            geo,
+		auditLogger:    auditLogger,
+		logger:         logger,
+		maxTravelSpeed: 1000, // Faster than a commercial flight
+	}
+}
+
+// Policy returns a facility's network policy, or nil if it has none
+func (g *NetworkGuard) Policy(ctx context.Context, facilityID string) (*NetworkPolicy, error) {
+	data, err := g.redis.Get(ctx, networkPolicyKey(facilityID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load network policy: %w", err)
+	}
+	var policy NetworkPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode network policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetPolicy replaces a facility's network policy
+func (g *NetworkGuard) SetPolicy(ctx context.Context, policy *NetworkPolicy, admin *Claims, ipAddress string) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	policy.UpdatedAt = time.Now()
+	policy.UpdatedBy = admin.UserID
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode network policy: %w", err)
+	}
+	if err := g.redis.Set(ctx, networkPolicyKey(policy.FacilityID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save network policy: %w", err)
+	}
+	g.audit(ctx, admin, "facility:"+policy.FacilityID, "set_network_policy", ipAddress, map[string]interface{}{
+		"allowed_cidrs": policy.AllowedCIDRs,
+	})
+	return nil
+}
+
+// DeletePolicy lifts a facility's network policy
+func (g *NetworkGuard) DeletePolicy(ctx context.Context, facilityID string, admin *Claims, ipAddress string) error {
+	if err := g.redis.Del(ctx, networkPolicyKey(facilityID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete network policy: %w", err)
+	}
+	g.audit(ctx, admin, "facility:"+facilityID, "delete_network_policy", ipAddress, nil)
+	return nil
+}
+
+// GrantOverride lets a user past their network policy until the override
+// expires. A reason is required; the grant is audited.
+func (g *NetworkGuard) GrantOverride(ctx context.Context, userID, reason string, duration time.Duration, admin *Claims, ipAddress string) (*NetworkOverride, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("%w: an override needs a reason", ErrInvalidNetworkPolicy)
+	}
+	if duration <= 0 || duration > maxNetworkOverride {
+		duration = maxNetworkOverride
+	}
+	override := &NetworkOverride{
+		UserID:    userID,
+		Reason:    reason,
+		GrantedBy: admin.UserID,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	data, err := json.Marshal(override)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode network override: %w", err)
+	}
+	if err := g.redis.Set(ctx, networkOverrideKey(userID), data, duration).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save network override: %w", err)
+	}
+
+	g.logger.Warn("network policy override granted",
+		slog.String("user_id", userID),
+		slog.String("granted_by", admin.UserID),
+		slog.String("reason", reason),
+	)
+	g.audit(ctx, admin, "user:"+userID, "grant_network_override", ipAddress, map[string]interface{}{
+		"reason":     reason,
+		"expires_at": override.ExpiresAt,
+	})
+	return override, nil
+}
+
+// RevokeOverride ends a user's network override early
+func (g *NetworkGuard) RevokeOverride(ctx context.Context, userID string, admin *Claims, ipAddress string) error {
+	if err := g.redis.Del(ctx, networkOverrideKey(userID)).Err(); err != nil {
+		return fmt.Errorf("failed to revoke network override: %w", err)
+	}
+	g.audit(ctx, admin, "user:"+userID, "revoke_network_override", ipAddress, nil)
+	return nil
+}
+
+// Evaluate returns ErrNetworkDenied if the facility's policy keeps the user
+// out of ipAddress and they have no override
+func (g *NetworkGuard) Evaluate(ctx context.Context, userID string, role Role, facilityID, ipAddress string) error {
+	if facilityID == "" {
+		return nil
+	}
+	policy, err := g.Policy(ctx, facilityID)
+	if err != nil {
+		return err
+	}
+	if policy == nil || !policy.restricts(role) || policy.allows(ipAddress) {
+		return nil
+	}
+
+	overridden, err := g.redis.Exists(ctx, networkOverrideKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check network override: %w", err)
+	}
+	if overridden > 0 {
+		return nil
+	}
+	return ErrNetworkDenied
+}
+
+// checkTravel records a sign-in's location and flags it if the user would
+// have had to travel implausibly fast since their last one. Anomalies are
+// logged and audited, not refused.
+func (g *NetworkGuard) checkTravel(ctx context.Context, userID, ipAddress string) {
+	if g.geo == nil {
+		return
+	}
+	here, err := g.geo.Locate(ctx, ipAddress)
+	if err != nil || here == nil {
+		return
+	}
+	now := time.Now()
+
+	key := lastLoginKey(userID)
+	last, err := g.redis.HGetAll(ctx, key).Result()
+	if err == nil && len(last) > 0 {
+		lat, _ := strconv.ParseFloat(last["latitude"], 64)
+		lon, _ := strconv.ParseFloat(last["longitude"], 64)
+		at, _ := strconv.ParseInt(last["at"], 10, 64)
+
+		distance := haversineKm(GeoPoint{Latitude: lat, Longitude: lon}, *here)
+		hours := math.Max(now.Sub(time.Unix(at, 0)).Hours(), 1.0/60)
+		if speed := distance / hours; distance > minTravelDistanceKm && speed > g.maxTravelSpeed {
+			g.logger.Warn("impossible travel between sign-ins",
+				slog.String("user_id", userID),
+				slog.String("previous_ip", last["ip_address"]),
+				slog.String("ip", ipAddress),
+				slog.Float64("distance_km", distance),
+				slog.Float64("speed_kmh", speed),
+			)
+			if g.auditLogger != nil {
+				g.auditLogger.LogAuthentication(ctx, &AuthEvent{
+					Timestamp:  now,
+					UserID:     userID,
+					EventType:  "impossible_travel",
+					IPAddress:  ipAddress,
+					Success:    true,
+					FailReason: fmt.Sprintf("%.0f km from %s in %s", distance, last["ip_address"], now.Sub(time.Unix(at, 0)).Round(time.Minute)),
+				})
+			}
+		}
+	}
+
+	_, err = g.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"latitude":   here.Latitude,
+			"longitude":  here.Longitude,
+			"ip_address": ipAddress,
+			"at":         now.Unix(),
+		})
+		pipe.Expire(ctx, key, lastLoginRetention)
+		return nil
+	})
+	if err != nil {
+		g.logger.Error("failed to record sign-in location",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// haversineKm is the great-circle distance between two points
+func haversineKm(a, b GeoPoint) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// audit records a network policy change
+func (g *NetworkGuard) audit(ctx context.Context, admin *Claims, resource, action, ipAddress string, details map[string]interface{}) {
+	if g.auditLogger == nil {
+		return
+	}
+	g.auditLogger.LogAccess(ctx, &AccessEvent{
+		Timestamp: time.Now(),
+		UserID:    admin.UserID,
+		Role:      admin.Role,
+		Resource:  resource,
+		Action:    action,
+		IPAddress: ipAddress,
+		SessionID: admin.SessionID,
+		Success:   true,
+		Details:   details,
+	})
+}
+
+// checkNetwork applies the configured network policy to a principal.
+// Service tokens aren't tied to a facility and pass.
+func (s *AuthService) checkNetwork(ctx context.Context, userID string, role Role, facilityID, ipAddress string) error {
+	if s.config.Network == nil || role == RoleSystem {
+		return nil
+	}
+	err := s.config.Network.Evaluate(ctx, userID, role, facilityID, ipAddress)
+	if errors.Is(err, ErrNetworkDenied) {
+		s.logger.Warn("network policy denied access",
+			slog.String("user_id", userID),
+			slog.String("facility_id", facilityID),
+			slog.String("ip", ipAddress),
+		)
+		if s.auditLogger != nil {
+			s.auditLogger.LogAuthentication(ctx, &AuthEvent{
+				Timestamp:  time.Now(),
+				UserID:     userID,
+				EventType:  "network_denied",
+				IPAddress:  ipAddress,
+				Success:    false,
+				FailReason: err.Error(),
+			})
+		}
+	}
+	return err
+}
+
+// NetworkOverrideRequest grants a network override
+type NetworkOverrideRequest struct {
+	Reason   string        `json:"reason" binding:"required"`
+	Duration time.Duration `json:"duration"` // Nanoseconds; capped at 4 hours
+}
+
+// RegisterNetworkRoutes mounts network policy management for system
+// administrators. The group must already run AuthMiddleware.
+//
+//	GET    /facilities/:facility_id/network-policy
+//	PUT    /facilities/:facility_id/network-policy
+//	DELETE /facilities/:facility_id/network-policy
+//	POST   /users/:user_id/network-override    emergency access from anywhere
+//	DELETE /users/:user_id/network-override
+func (g *NetworkGuard) RegisterNetworkRoutes(r gin.IRouter, auth *AuthService) {
+	admin := r.Group("", auth.RequireHuman(), auth.RequirePermission(PermissionAdminSystem))
+
+	admin.GET("/facilities/:facility_id/network-policy", func(c *gin.Context) {
+		policy, err := g.Policy(c.Request.Context(), c.Param("facility_id"))
+		if err == nil && policy == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "no network policy"})
+			return
+		}
+		if err != nil {
+			g.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	})
+
+	admin.PUT("/facilities/:facility_id/network-policy", func(c *gin.Context) {
+		claims, _ := GetClaimsFromContext(c)
+		var policy NetworkPolicy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": ErrInvalidNetworkPolicy.Error()})
+			return
+		}
+		policy.FacilityID = c.Param("facility_id")
+		if err := g.SetPolicy(c.Request.Context(), &policy, claims, c.ClientIP()); err != nil {
+			g.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, &policy)
+	})
+
+	admin.DELETE("/facilities/:facility_id/network-policy", func(c *gin.Context) {
+		claims, _ := GetClaimsFromContext(c)
+		if err := g.DeletePolicy(c.Request.Context(), c.Param("facility_id"), claims, c.ClientIP()); err != nil {
+			g.writeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	admin.POST("/users/:user_id/network-override", func(c *gin.Context) {
+		claims, _ := GetClaimsFromContext(c)
+		var req NetworkOverrideRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a reason is required"})
+			return
+		}
+		override, err := g.GrantOverride(c.Request.Context(), c.Param("user_id"), req.Reason, req.Duration, claims, c.ClientIP())
+		if err != nil {
+			g.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, override)
+	})
+
+	admin.DELETE("/users/:user_id/network-override", func(c *gin.Context) {
+		claims, _ := GetClaimsFromContext(c)
+		if err := g.RevokeOverride(c.Request.Context(), c.Param("user_id"), claims, c.ClientIP()); err != nil {
+			g.writeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// writeError answers a failed network policy request
+func (g *NetworkGuard) writeError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvalidNetworkPolicy) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	g.logger.Error("network policy request failed",
+		slog.String("error", err.Error()),
+	)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+		"error": "network policy unavailable",
+	})
+}
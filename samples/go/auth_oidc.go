@@ -0,0 +1,564 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OIDC login timing
+const (
+	oidcStateTTL     = 10 * time.Minute // A login must complete within this
+	oidcDiscoveryTTL = time.Hour
+	oidcHTTPTimeout  = 10 * time.Second
+)
+
+// Federation errors
+var (
+	ErrInvalidOIDCProvider = errors.New("invalid OIDC provider")
+	ErrUnknownFacilityIdP  = errors.New("facility has no identity provider")
+	ErrOIDCStateInvalid    = errors.New("login state missing or expired")
+	ErrIdentityNotLinked   = errors.New("external identity is not linked to a user")
+	ErrNoMappedRole        = errors.New("no role is mapped for the identity's groups")
+)
+
+// GroupRoleMapping grants a role to members of an identity provider group
+type GroupRoleMapping struct {
+	Group string
+	Role  Role
+}
+
+// OIDCProvider is a facility's identity provider, such as Okta or Azure AD
+type OIDCProvider struct {
+	FacilityID   string
+	Issuer       string // e.g. https://example.okta.com
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string // Requested with openid
+	GroupsClaim  string   // ID token claim listing the user's groups; "groups" when empty
+	// RoleMappings are checked in order; the first group the identity
+	// belongs to decides its role. Identities in none are refused.
+	RoleMappings []GroupRoleMapping
+	// AutoProvision creates a user for identities signing in the first
+	// time; otherwise an admin must link them
+	AutoProvision bool
+}
+
+// Validate checks a provider's configuration
+func (p *OIDCProvider) Validate() error {
+	if p.FacilityID == "" || p.ClientID == "" || p.RedirectURL == "" {
+		return fmt.Errorf("%w: facility, client ID and redirect URL are required", ErrInvalidOIDCProvider)
+	}
+	if u, err := url.Parse(p.Issuer); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("%w: issuer must be an https URL", ErrInvalidOIDCProvider)
+	}
+	if len(p.RoleMappings) == 0 {
+		return fmt.Errorf("%w: at least one role mapping is required", ErrInvalidOIDCProvider)
+	}
+	for _, m := range p.RoleMappings {
+		if _, ok := RolePermissions[m.Role]; !ok {
+			return fmt.Errorf("%w: group %s maps to unknown role %q", ErrInvalidOIDCProvider, m.Group, m.Role)
+		}
+	}
+	return nil
+}
+
+// ExternalIdentity is a user as their identity provider describes them
+type ExternalIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// mapRole returns the role an identity's groups grant
+func (p *OIDCProvider) mapRole(groups []string) (Role, bool) {
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+	for _, m := range p.RoleMappings {
+		if member[m.Group] {
+			return m.Role, true
+		}
+	}
+	return "", false
+}
+
+// oidcDiscovery is the part of an issuer's discovery document used here
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// federatedProvider is a registered provider and its discovered endpoints
+type federatedProvider struct {
+	config    *OIDCProvider
+	discovery *oidcDiscovery
+	fetched   time.Time
+	jwks      *jwksCache
+}
+
+// oidcLogin is a login in progress, kept until the callback
+type oidcLogin struct {
+	FacilityID string `json:"facility_id"`
+	Verifier   string `json:"verifier"`
+	Nonce      string `json:"nonce"`
+	DeviceID   string `json:"device_id,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+}
+
+// oidcStateKey holds a login in progress
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("oidc:state:%s", state)
+}
+
+// oidcIdentityKey links an external identity to a user. The issuer is
+// hashed since it is a URL.
+func oidcIdentityKey(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(issuer))
+	return fmt.Sprintf("oidc:identity:%s:%s", base64.RawURLEncoding.EncodeToString(sum[:12]), subject)
+}
+
+// OIDCFederation signs users in through their facility's identity provider
+// with the authorization code flow and PKCE, then issues our own tokens
+type OIDCFederation struct {
+	auth   *AuthService
+	redis  *redis.Client
+	logger *slog.Logger
+	client *http.Client
+	// directory, when set, decides roles instead of the ID token's groups
+	directory UserDirectory
+
+	mu        sync.Mutex
+	providers map[string]*federatedProvider // By facility ID
+}
+
+// NewOIDCFederation creates a federation issuing tokens from auth
+func NewOIDCFederation(auth *AuthService, redis *redis.Client, logger *slog.Logger) *OIDCFederation {
+	return &OIDCFederation{
+		auth:      auth,
+		redis:     redis,
+		logger:    logger,
+		client:    &http.Client{Timeout: oidcHTTPTimeout},
+		providers: make(map[string]*federatedProvider),
+	}
+}
+
+// RegisterProvider sets a facility's identity provider
+func (f *OIDCFederation) RegisterProvider(provider *OIDCProvider) error {
+	if err := provider.Validate(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.providers[provider.FacilityID] = &federatedProvider{config: provider}
+	return nil
+}
+
+// SetDirectory makes a user directory, such as SCIM provisioning, the
+// source of federated users' roles
+func (f *OIDCFederation) SetDirectory(directory UserDirectory) {
+	f.directory = directory
+}
+
+// LinkIdentity links an external identity to an existing user
+func (f *OIDCFederation) LinkIdentity(ctx context.Context, issuer, subject, userID string) error {
+	if err := f.redis.Set(ctx, oidcIdentityKey(issuer, subject), userID, 0).Err(); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// provider returns a snapshot of a facility's provider with its endpoints
+// discovered
+func (f *OIDCFederation) provider(ctx context.Context, facilityID string) (*federatedProvider, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.providers[facilityID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFacilityIdP, facilityID)
+	}
+	if p.discovery != nil && time.Since(p.fetched) < oidcDiscoveryTTL {
+		snapshot := *p
+		return &snapshot, nil
+	}
+
+	var discovery oidcDiscovery
+	endpoint := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := f.getJSON(ctx, endpoint, &discovery); err != nil {
+		if p.discovery != nil {
+			snapshot := *p
+			return &snapshot, nil
+		}
+		return nil, fmt.Errorf("failed to discover %s: %w", p.config.Issuer, err)
+	}
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %s does not match %s", discovery.Issuer, p.config.Issuer)
+	}
+	if p.discovery == nil || p.discovery.JWKSURI != discovery.JWKSURI {
+		p.jwks = newJWKSCache(discovery.JWKSURI)
+	}
+	p.discovery = &discovery
+	p.fetched = time.Now()
+	snapshot := *p
+	return &snapshot, nil
+}
+
+// BeginLogin starts a federated login and returns the identity provider
+// URL to send the browser to. clientID names the app signing in, or is
+// empty.
+func (f *OIDCFederation) BeginLogin(ctx context.Context, facilityID, deviceID, clientID string) (string, error) {
+	if _, err := f.auth.tokenClient(clientID); err != nil {
+		return "", err
+	}
+	p, err := f.provider(ctx, facilityID)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	// 48 bytes encode to 64 characters without padding, as PKCE requires
+	verifier, err := GenerateSecureToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(&oidcLogin{
+		FacilityID: facilityID,
+		Verifier:   verifier,
+		Nonce:      nonce,
+		DeviceID:   deviceID,
+		ClientID:   clientID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal login state: %w", err)
+	}
+	if err := f.redis.Set(ctx, oidcStateKey(state), data, oidcStateTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	return p.discovery.AuthorizationEndpoint + "?" + query.Encode(), nil
+}
+
+// CompleteLogin finishes a federated login from the identity provider's
+// callback, verifying its ID token and issuing our own tokens for the
+// linked user
+func (f *OIDCFederation) CompleteLogin(ctx context.Context, state, code, ipAddress string) (*TokenPair, error) {
+	// State is single use so a replayed callback can't sign in again
+	data, err := f.redis.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login state: %w", err)
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal login state: %w", err)
+	}
+
+	p, err := f.provider(ctx, login.FacilityID)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, err := f.exchangeCode(ctx, p, code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := f.verifyIDToken(ctx, p, rawIDToken, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	role, ok := p.config.mapRole(identity.Groups)
+	if !ok && f.directory == nil {
+		f.auditFailure(ctx, identity.Subject, ipAddress, login.DeviceID, "no mapped role")
+		return nil, ErrNoMappedRole
+	}
+	userID, err := f.resolveUser(ctx, p.config, identity)
+	if err != nil {
+		f.auditFailure(ctx, identity.Subject, ipAddress, login.DeviceID, err.Error())
+		return nil, err
+	}
+	if f.directory != nil {
+		var facilityID string
+		role, facilityID, err = f.directory.LookupUser(ctx, userID)
+		if err == nil && facilityID != login.FacilityID {
+			err = ErrIdentityNotLinked
+		}
+		if err != nil {
+			f.auditFailure(ctx, identity.Subject, ipAddress, login.DeviceID, err.Error())
+			return nil, err
+		}
+	}
+
+	f.logger.Info("federated login",
+		slog.String("user_id", userID),
+		slog.String("facility_id", login.FacilityID),
+		slog.String("issuer", identity.Issuer),
+		slog.String("role", string(role)),
+	)
+	return f.auth.GenerateClientTokenPair(ctx, login.ClientID, userID, role, login.FacilityID, login.DeviceID, ipAddress)
+}
+
+// exchangeCode redeems an authorization code for the ID token
+func (f *OIDCFederation) exchangeCode(ctx context.Context, p *federatedProvider, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("code exchange refused: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no ID token")
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience, expiry
+// and nonce, and returns the identity it asserts
+func (f *OIDCFederation) verifyIDToken(ctx context.Context, p *federatedProvider, raw, nonce string) (*ExternalIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		public, err := p.jwks.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		method, err := signingMethod(public)
+		if err != nil {
+			return nil, err
+		}
+		if method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return public, nil
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+
+	identity := &ExternalIdentity{Issuer: p.config.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+
+	groupsClaim := p.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	if groups, ok := claims[groupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if name, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// resolveUser returns the user an external identity is linked to,
+// provisioning one if the provider allows it
+func (f *OIDCFederation) resolveUser(ctx context.Context, provider *OIDCProvider, identity *ExternalIdentity) (string, error) {
+	key := oidcIdentityKey(identity.Issuer, identity.Subject)
+	userID, err := f.redis.Get(ctx, key).Result()
+	if err == nil {
+		return userID, nil
+	}
+	if err != redis.Nil {
+		return "", fmt.Errorf("failed to resolve identity: %w", err)
+	}
+	if !provider.AutoProvision {
+		return "", ErrIdentityNotLinked
+	}
+
+	// Concurrent first logins must agree on one user
+	if _, err := f.redis.SetNX(ctx, key, uuid.New().String(), 0).Result(); err != nil {
+		return "", fmt.Errorf("failed to provision user: %w", err)
+	}
+	userID, err = f.redis.Get(ctx, key).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve identity: %w", err)
+	}
+	f.logger.Info("provisioned user for external identity",
+		slog.String("user_id", userID),
+		slog.String("facility_id", provider.FacilityID),
+		slog.String("issuer", identity.Issuer),
+	)
+	return userID, nil
+}
+
+// auditFailure records a refused federated login
+func (f *OIDCFederation) auditFailure(ctx context.Context, subject, ipAddress, deviceID, reason string) {
+	if f.auth.auditLogger == nil {
+		return
+	}
+	f.auth.auditLogger.LogAuthentication(ctx, &AuthEvent{
+		Timestamp:  time.Now(),
+		UserID:     subject,
+		EventType:  "oidc_login",
+		IPAddress:  ipAddress,
+		DeviceID:   deviceID,
+		Success:    false,
+		FailReason: reason,
+	})
+}
+
+// getJSON fetches and decodes a JSON document
+func (f *OIDCFederation) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LoginHandler redirects to the identity provider of the facility in the
+// :facility path parameter
+func (f *OIDCFederation) LoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authURL, err := f.BeginLogin(c.Request.Context(), c.Param("facility"), c.Query("device_id"), c.Query("client_id"))
+		if errors.Is(err, ErrUnknownTokenClient) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, ErrUnknownFacilityIdP) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "single sign-on is not configured for this facility",
+			})
+			return
+		}
+		if err != nil {
+			f.logger.Error("failed to start federated login",
+				slog.String("facility_id", c.Param("facility")),
+				slog.String("error", err.Error()),
+			)
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+				"error": "identity provider unavailable",
+			})
+			return
+		}
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// CallbackHandler completes a federated login and returns our tokens
+func (f *OIDCFederation) CallbackHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if idpErr := c.Query("error"); idpErr != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "sign-in was not completed",
+			})
+			return
+		}
+
+		tokens, err := f.CompleteLogin(c.Request.Context(), c.Query("state"), c.Query("code"), c.ClientIP())
+		if err != nil {
+			f.logger.Warn("federated login failed",
+				slog.String("error", err.Error()),
+				slog.String("ip", c.ClientIP()),
+			)
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, ErrIdentityNotLinked), errors.Is(err, ErrNoMappedRole), errors.Is(err, ErrNetworkDenied),
+				errors.Is(err, ErrUserDeactivated):
+				status = http.StatusForbidden
+			case errors.Is(err, ErrOIDCStateInvalid):
+				status = http.StatusBadRequest
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": "sign-in failed",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
@@ -0,0 +1,603 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Role management errors
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrBuiltInRole  = errors.New("built-in roles can't be modified")
+	ErrInvalidRole  = errors.New("invalid role definition")
+)
+
+// Role cache settings
+const (
+	roleCacheTTL     = 5 * time.Minute
+	roleCacheVersion = "auth:roles:version"
+)
+
+// rolePattern is what custom role names must look like
+var rolePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,47}$`)
+
+// AllPermissions lists every permission a role can be granted
+var AllPermissions = []Permission{
+	PermissionReadResident,
+	PermissionWriteResident,
+	PermissionReadCrisis,
+	PermissionWriteCrisis,
+	PermissionAcknowledgeCrisis,
+	PermissionReadAssessment,
+	PermissionWriteAssessment,
+	PermissionReadAudit,
+	PermissionExportTranscript,
+	PermissionAdminUsers,
+	PermissionAdminSystem,
+}
+
+// RoleDefinition is a role and what it grants. Definitions without a
+// facility apply everywhere; a facility's own definition of the same name
+// takes precedence there.
+type RoleDefinition struct {
+	Name        Role         `json:"name"`
+	FacilityID  string       `json:"facility_id,omitempty"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+	Scope       Scope        `json:"scope"`
+	BuiltIn     bool         `json:"built_in"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// Validate checks a definition's name, permissions and scope
+func (d *RoleDefinition) Validate() error {
+	if !rolePattern.MatchString(string(d.Name)) {
+		return fmt.Errorf("%w: name must be lowercase letters, digits and underscores", ErrInvalidRole)
+	}
+	for _, p := range d.Permissions {
+		if !slices.Contains(AllPermissions, p) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, p)
+		}
+	}
+	switch d.Scope {
+	case ScopeSelf, ScopeFamily, ScopeCareTeam, ScopeFacility:
+	case ScopeGlobal:
+		if d.FacilityID != "" {
+			return fmt.Errorf("%w: facility roles can't have global scope", ErrInvalidRole)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidRole, d.Scope)
+	}
+	return nil
+}
+
+// grants reports whether the definition includes a permission
+func (d *RoleDefinition) grants(required Permission) bool {
+	return slices.Contains(d.Permissions, required)
+}
+
+// RoleStore keeps role definitions in Postgres, resolved definitions
+// cached in Redis. Every write bumps a version that is part of each cache
+// key, so changes to a global role reach all facilities at once. Expected
+// schema:
+//
+//	CREATE TABLE roles (
+//	    facility_id TEXT NOT NULL DEFAULT '',
+//	    name        TEXT NOT NULL,
+//	    description TEXT NOT NULL DEFAULT '',
+//	    scope       TEXT NOT NULL,
+//	    built_in    BOOLEAN NOT NULL DEFAULT FALSE,
+//	    updated_at  TIMESTAMPTZ NOT NULL,
+//	    PRIMARY KEY (facility_id, name)
+//	);
+//	CREATE TABLE role_permissions (
+//	    facility_id TEXT NOT NULL,
+//	    role        TEXT NOT NULL,
+//	    permission  TEXT NOT NULL,
+//	    PRIMARY KEY (facility_id, role, permission),
+//	    FOREIGN KEY (facility_id, role) REFERENCES roles ON DELETE CASCADE
+//	);
+type RoleStore struct {
+	db     *sql.DB
+	redis  *redis.Client
+	logger *slog.Logger
+}
+
+// NewRoleStore creates a role store
+func NewRoleStore(db *sql.DB, redis *redis.Client, logger *slog.Logger) *RoleStore {
+	return &RoleStore{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// roleCacheKey holds a resolved definition for a cache version
+func roleCacheKey(version int64, facilityID string, role Role) string {
+	return fmt.Sprintf("auth:roles:%d:%s:%s", version, facilityID, role)
+}
+
+// MigrateBuiltInRoles stores RolePermissions and RoleScopes as global
+// built-in roles. It is safe to run at every start; built-in roles are
+// brought back in line with the code.
+func (r *RoleStore) MigrateBuiltInRoles(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin role migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for role, permissions := range RolePermissions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO roles (facility_id, name, description, scope, built_in, updated_at)
+			VALUES ('', $1, $2, $3, TRUE, $4)
+			ON CONFLICT (facility_id, name) DO UPDATE
+			SET scope = EXCLUDED.scope, built_in = TRUE, updated_at = EXCLUDED.updated_at`,
+			role, "Built-in "+string(role)+" role", RoleScopes[role], now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to migrate role %s: %w", role, err)
+		}
+		if err := replacePermissions(ctx, tx, "", role, permissions); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role migration: %w", err)
+	}
+	r.bust(ctx)
+	return nil
+}
+
+// Resolve returns the definition of a role at a facility, falling back to
+// the global definition
+func (r *RoleStore) Resolve(ctx context.Context, facilityID string, role Role) (*RoleDefinition, error) {
+	version, err := r.redis.Get(ctx, roleCacheVersion).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load role cache version: %w", err)
+	}
+	key := roleCacheKey(version, facilityID, role)
+	if data, err := r.redis.Get(ctx, key).Bytes(); err == nil {
+		var def RoleDefinition
+		if err := json.Unmarshal(data, &def); err == nil {
+			return &def, nil
+		}
+	}
+
+	def, err := r.load(ctx, facilityID, role)
+	if err != nil && !errors.Is(err, ErrRoleNotFound) {
+		return nil, err
+	}
+	if def == nil && facilityID != "" {
+		def, err = r.load(ctx, "", role)
+		if err != nil && !errors.Is(err, ErrRoleNotFound) {
+			return nil, err
+		}
+	}
+	if def == nil {
+		return nil, ErrRoleNotFound
+	}
+
+	if data, err := json.Marshal(def); err == nil {
+		if err := r.redis.Set(ctx, key, data, roleCacheTTL).Err(); err != nil {
+			r.logger.Warn("failed to cache role",
+				slog.String("role", string(role)),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return def, nil
+}
+
+// ListRoles returns the global roles and a facility's own roles
+func (r *RoleStore) ListRoles(ctx context.Context, facilityID string) ([]*RoleDefinition, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT r.facility_id, r.name, r.description, r.scope, r.built_in, r.updated_at,
+		       COALESCE(array_agg(p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions p ON p.facility_id = r.facility_id AND p.role = r.name
+		WHERE r.facility_id IN ('', $1)
+		GROUP BY r.facility_id, r.name
+		ORDER BY r.name, r.facility_id`,
+		facilityID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*RoleDefinition
+	for rows.Next() {
+		def, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, def)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	return roles, nil
+}
+
+// CreateRole stores a new custom role
+func (r *RoleStore) CreateRole(ctx context.Context, def *RoleDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	if _, ok := RolePermissions[def.Name]; ok && def.FacilityID == "" {
+		return ErrBuiltInRole
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin role creation: %w", err)
+	}
+	defer tx.Rollback()
+
+	def.BuiltIn = false
+	def.UpdatedAt = time.Now()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO roles (facility_id, name, description, scope, built_in, updated_at)
+		VALUES ($1, $2, $3, $4, FALSE, $5)
+		ON CONFLICT (facility_id, name) DO NOTHING`,
+		def.FacilityID, def.Name, def.Description, def.Scope, def.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleExists
+	}
+	if err := replacePermissions(ctx, tx, def.FacilityID, def.Name, def.Permissions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role creation: %w", err)
+	}
+	r.bust(ctx)
+	return nil
+}
+
+// SetPermissions replaces the permissions of a custom role
+func (r *RoleStore) SetPermissions(ctx context.Context, facilityID string, role Role, permissions []Permission) error {
+	def, err := r.load(ctx, facilityID, role)
+	if err != nil {
+		return err
+	}
+	if def.BuiltIn {
+		return ErrBuiltInRole
+	}
+	def.Permissions = permissions
+	if err := def.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin permission update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE roles SET updated_at = $3 WHERE facility_id = $1 AND name = $2`,
+		facilityID, role, time.Now(),
+	); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if err := replacePermissions(ctx, tx, facilityID, role, permissions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit permission update: %w", err)
+	}
+	r.bust(ctx)
+	return nil
+}
+
+// DeleteRole removes a custom role. Tokens already issued for it stop
+// granting anything once the cache is busted.
+func (r *RoleStore) DeleteRole(ctx context.Context, facilityID string, role Role) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM roles WHERE facility_id = $1 AND name = $2 AND NOT built_in`,
+		facilityID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if def, err := r.load(ctx, facilityID, role); err == nil && def.BuiltIn {
+			return ErrBuiltInRole
+		}
+		return ErrRoleNotFound
+	}
+	r.bust(ctx)
+	return nil
+}
+
+// load reads one definition from Postgres
+func (r *RoleStore) load(ctx context.Context, facilityID string, role Role) (*RoleDefinition, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT r.facility_id, r.name, r.description, r.scope, r.built_in, r.updated_at,
+		       COALESCE(array_agg(p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions p ON p.facility_id = r.facility_id AND p.role = r.name
+		WHERE r.facility_id = $1 AND r.name = $2
+		GROUP BY r.facility_id, r.name`,
+		facilityID, role,
+	)
+	def, err := scanRole(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoleNotFound
+	}
+	return def, err
+}
+
+// bust invalidates every cached definition
+func (r *RoleStore) bust(ctx context.Context) {
+	if err := r.redis.Incr(ctx, roleCacheVersion).Err(); err != nil {
+		r.logger.Error("failed to bust role cache; changes apply when entries expire",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// scanRole reads a definition from a row of the role queries
+func scanRole(row interface{ Scan(...any) error }) (*RoleDefinition, error) {
+	var def RoleDefinition
+	var permissions []byte
+	err := row.Scan(&def.FacilityID, &def.Name, &def.Description, &def.Scope, &def.BuiltIn, &def.UpdatedAt, &permissions)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read role: %w", err)
+	}
+	def.Permissions, err = parsePermissionArray(permissions)
+	if err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// parsePermissionArray decodes a Postgres text array of permissions.
+// Permission names never need quoting.
+func parsePermissionArray(data []byte) ([]Permission, error) {
+	s := string(data)
+	inner, ok := strings.CutPrefix(s, "{")
+	if inner, ok = strings.CutSuffix(inner, "}"); !ok {
+		return nil, fmt.Errorf("invalid permission array %q", s)
+	}
+	var permissions []Permission
+	for _, p := range strings.Split(inner, ",") {
+		if p != "" {
+			permissions = append(permissions, Permission(p))
+		}
+	}
+	return permissions, nil
+}
+
+// replacePermissions sets a role's permissions within a transaction
+func replacePermissions(ctx context.Context, tx *sql.Tx, facilityID string, role Role, permissions []Permission) error {
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM role_permissions WHERE facility_id = $1 AND role = $2`,
+		facilityID, role,
+	); err != nil {
+		return fmt.Errorf("failed to clear permissions of %s: %w", role, err)
+	}
+	for _, p := range permissions {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (facility_id, role, permission)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`,
+			facilityID, role, p,
+		); err != nil {
+			return fmt.Errorf("failed to grant %s to %s: %w", p, role, err)
+		}
+	}
+	return nil
+}
+
+// permits reports whether a role grants a permission at a facility. With
+// no role store, or if it fails, built-in roles fall back to
+// RolePermissions and custom roles are denied.
+func (s *AuthService) permits(ctx context.Context, role Role, facilityID string, required Permission) bool {
+	if s.config.Roles == nil {
+		return hasPermission(role, required)
+	}
+	def, err := s.config.Roles.Resolve(ctx, facilityID, role)
+	if err != nil {
+		if !errors.Is(err, ErrRoleNotFound) {
+			s.logger.Error("failed to resolve role",
+				slog.String("role", string(role)),
+				slog.String("error", err.Error()),
+			)
+		}
+		return hasPermission(role, required)
+	}
+	return def.grants(required)
+}
+
+// roleAdmin returns the caller's claims and the facility whose roles a
+// request manages. Admins manage their own facility; global roles and
+// other facilities need PermissionAdminSystem.
+func (s *AuthService) roleAdmin(c *gin.Context) (*Claims, string, bool) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "authentication required",
+		})
+		return nil, "", false
+	}
+	facilityID := c.Param("facility_id")
+	if facilityID == "global" {
+		facilityID = ""
+	}
+	if facilityID != claims.FacilityID && !s.permits(c.Request.Context(), claims.Role, claims.FacilityID, PermissionAdminSystem) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "insufficient permissions",
+		})
+		return nil, "", false
+	}
+	return claims, facilityID, true
+}
+
+// checkGrantable refuses permissions the caller doesn't hold themselves,
+// so admins can't escalate through a custom role
+func (s *AuthService) checkGrantable(c *gin.Context, claims *Claims, permissions []Permission) bool {
+	for _, p := range permissions {
+		if !s.permits(c.Request.Context(), claims.Role, claims.FacilityID, p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("can't grant %s without holding it", p),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// auditRoleChange records a change to role definitions
+func (s *AuthService) auditRoleChange(c *gin.Context, claims *Claims, action, facilityID string, role Role, permissions []Permission) {
+	if s.auditLogger == nil {
+		return
+	}
+	s.auditLogger.LogAccess(c.Request.Context(), &AccessEvent{
+		Timestamp: time.Now(),
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		Resource:  "role:" + string(role),
+		Action:    action,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		SessionID: claims.SessionID,
+		Success:   true,
+		Details: map[string]interface{}{
+			"facility_id": facilityID,
+			"permissions": permissions,
+		},
+	})
+}
+
+// writeRoleError answers a failed role management request
+func (s *AuthService) writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRole):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRoleNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrBuiltInRole):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		s.logger.Error("role management failed",
+			slog.String("error", err.Error()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "role management unavailable",
+		})
+	}
+}
+
+// RegisterRoleRoutes mounts role management under
+// /facilities/:facility_id/roles, with "global" as the facility for roles
+// that apply everywhere. The group must already run AuthMiddleware.
+func (s *AuthService) RegisterRoleRoutes(r gin.IRouter) {
+	roles := r.Group("/facilities/:facility_id/roles", s.RequirePermission(PermissionAdminUsers))
+	roles.GET("", s.listRoles)
+	roles.POST("", s.createRole)
+	roles.PUT("/:role/permissions", s.setRolePermissions)
+	roles.DELETE("/:role", s.deleteRole)
+}
+
+// listRoles serves the roles available at a facility
+func (s *AuthService) listRoles(c *gin.Context) {
+	_, facilityID, ok := s.roleAdmin(c)
+	if !ok {
+		return
+	}
+	roles, err := s.config.Roles.ListRoles(c.Request.Context(), facilityID)
+	if err != nil {
+		s.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// createRole creates a custom role
+func (s *AuthService) createRole(c *gin.Context) {
+	claims, facilityID, ok := s.roleAdmin(c)
+	if !ok {
+		return
+	}
+	var def RoleDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid role definition"})
+		return
+	}
+	def.FacilityID = facilityID
+	if !s.checkGrantable(c, claims, def.Permissions) {
+		return
+	}
+	if err := s.config.Roles.CreateRole(c.Request.Context(), &def); err != nil {
+		s.writeRoleError(c, err)
+		return
+	}
+	s.auditRoleChange(c, claims, "create_role", facilityID, def.Name, def.Permissions)
+	c.JSON(http.StatusCreated, def)
+}
+
+// setRolePermissions replaces a custom role's permissions
+func (s *AuthService) setRolePermissions(c *gin.Context) {
+	claims, facilityID, ok := s.roleAdmin(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Permissions []Permission `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "permissions required"})
+		return
+	}
+	if !s.checkGrantable(c, claims, req.Permissions) {
+		return
+	}
+	role := Role(c.Param("role"))
+	if err := s.config.Roles.SetPermissions(c.Request.Context(), facilityID, role, req.Permissions); err != nil {
+		s.writeRoleError(c, err)
+		return
+	}
+	s.auditRoleChange(c, claims, "set_permissions", facilityID, role, req.Permissions)
+	c.Status(http.StatusNoContent)
+}
+
+// deleteRole removes a custom role
+func (s *AuthService) deleteRole(c *gin.Context) {
+	claims, facilityID, ok := s.roleAdmin(c)
+	if !ok {
+		return
+	}
+	role := Role(c.Param("role"))
+	if err := s.config.Roles.DeleteRole(c.Request.Context(), facilityID, role); err != nil {
+		s.writeRoleError(c, err)
+		return
+	}
+	s.auditRoleChange(c, claims, "delete_role", facilityID, role, nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,1184 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// SCIM 2.0 schemas (RFC 7643, RFC 7644)
+const (
+	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimContentType = "application/scim+json"
+	scimMaxResults  = 200
+)
+
+// Provisioning errors
+var (
+	ErrSCIMNotFound       = errors.New("resource not found")
+	ErrSCIMConflict       = errors.New("resource already exists")
+	ErrInvalidSCIM        = errors.New("invalid SCIM request")
+	ErrUnknownSCIMTenant  = errors.New("facility has no SCIM provisioning")
+	ErrUserDeactivated    = errors.New("account is deactivated")
+	ErrUnsupportedSCIMOps = errors.New("unsupported SCIM operation")
+)
+
+// scimFilter is the one filter form supported: attribute eq "value"
+var scimFilter = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+"([^"]*)"\s*$`)
+
+// SCIMTenant is a facility provisioned from its HR system or identity
+// provider
+type SCIMTenant struct {
+	FacilityID string
+	ClientID   string // The service client allowed to provision the facility
+	// RoleMappings are checked in order; the first group a user belongs to
+	// decides their role. Users in none are deactivated.
+	RoleMappings []GroupRoleMapping
+	// Issuer, when set, is the OIDC issuer whose subjects are the users'
+	// externalId; provisioned users are linked for single sign-on
+	Issuer string
+}
+
+// SCIMName is a user's name
+type SCIMName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMEmail is one of a user's email addresses
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMember references a user in a group, or a group from a user
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMMeta is a resource's metadata
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// SCIMUser is a SCIM User resource
+type SCIMUser struct {
+	Schemas    []string     `json:"schemas"`
+	ID         string       `json:"id"`
+	ExternalID string       `json:"externalId,omitempty"`
+	UserName   string       `json:"userName"`
+	Name       *SCIMName    `json:"name,omitempty"`
+	Emails     []SCIMEmail  `json:"emails,omitempty"`
+	Active     *bool        `json:"active"`           // True when omitted
+	Groups     []SCIMMember `json:"groups,omitempty"` // Read-only
+	Meta       *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMGroup is a SCIM Group resource
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMPatch is a PATCH request body
+type SCIMPatch struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []SCIMPatchOp `json:"Operations"`
+}
+
+// SCIMPatchOp is one PATCH operation
+type SCIMPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimList is a list response
+type scimList struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// deactivatedUserKey marks a user who may not be issued tokens
+func deactivatedUserKey(userID string) string {
+	return fmt.Sprintf("auth:user_deactivated:%s", userID)
+}
+
+// SCIMServer provisions users and groups over SCIM 2.0. Users are
+// deactivated, and signed out everywhere, when their identity provider
+// deactivates or deletes them or they leave every mapped group. Expected
+// schema:
+//
+//	CREATE TABLE scim_users (
+//	    id          UUID PRIMARY KEY,
+//	    facility_id TEXT NOT NULL,
+//	    user_name   TEXT NOT NULL,
+//	    external_id TEXT NOT NULL DEFAULT '',
+//	    given_name  TEXT NOT NULL DEFAULT '',
+//	    family_name TEXT NOT NULL DEFAULT '',
+//	    email       TEXT NOT NULL DEFAULT '',
+//	    active      BOOLEAN NOT NULL,
+//	    role        TEXT NOT NULL DEFAULT '',
+//	    created_at  TIMESTAMPTZ NOT NULL,
+//	    updated_at  TIMESTAMPTZ NOT NULL,
+//	    UNIQUE (facility_id, user_name)
+//	);
+//	CREATE TABLE scim_groups (
+//	    id           UUID PRIMARY KEY,
+//	    facility_id  TEXT NOT NULL,
+//	    display_name TEXT NOT NULL,
+//	    external_id  TEXT NOT NULL DEFAULT '',
+//	    created_at   TIMESTAMPTZ NOT NULL,
+//	    updated_at   TIMESTAMPTZ NOT NULL,
+//	    UNIQUE (facility_id, display_name)
+//	);
+//	CREATE TABLE scim_group_members (
+//	    group_id UUID NOT NULL REFERENCES scim_groups ON DELETE CASCADE,
+//	    user_id  UUID NOT NULL REFERENCES scim_users ON DELETE CASCADE,
+//	    PRIMARY KEY (group_id, user_id)
+//	);
+type SCIMServer struct {
+	db     *sql.DB
+	redis  *redis.Client
+	auth   *AuthService
+	oidc   *OIDCFederation // Optional; links users for single sign-on
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	tenants map[string]*SCIMTenant
+}
+
+// NewSCIMServer creates a SCIM server. oidc may be nil when provisioned
+// users don't sign in through a facility identity provider.
+func NewSCIMServer(db *sql.DB, redis *redis.Client, auth *AuthService, oidc *OIDCFederation, logger *slog.Logger) *SCIMServer {
+	return &SCIMServer{
+		db:      db,
+		redis:   redis,
+		auth:    auth,
+		oidc:    oidc,
+		logger:  logger,
+		tenants: make(map[string]*SCIMTenant),
+	}
+}
+
+// RegisterTenant enables provisioning for a facility
+func (s *SCIMServer) RegisterTenant(tenant *SCIMTenant) error {
+	if tenant.FacilityID == "" || tenant.ClientID == "" {
+		return fmt.Errorf("%w: tenant needs a facility and a client", ErrInvalidSCIM)
+	}
+	if len(tenant.RoleMappings) == 0 {
+		return fmt.Errorf("%w: tenant needs at least one role mapping", ErrInvalidSCIM)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants[tenant.FacilityID] = tenant
+	return nil
+}
+
+// tenant returns a facility's tenant
+func (s *SCIMServer) tenant(facilityID string) (*SCIMTenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenant, ok := s.tenants[facilityID]
+	if !ok {
+		return nil, ErrUnknownSCIMTenant
+	}
+	return tenant, nil
+}
+
+// LookupUser returns a provisioned user's role and facility, so the
+// directory can be the source of truth for sign-in and impersonation
+func (s *SCIMServer) LookupUser(ctx context.Context, userID string) (Role, string, error) {
+	var role Role
+	var facilityID string
+	var active bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT role, facility_id, active FROM scim_users WHERE id = $1`,
+		userID,
+	).Scan(&role, &facilityID, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrSCIMNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !active || role == "" {
+		return "", "", ErrUserDeactivated
+	}
+	return role, facilityID, nil
+}
+
+// CreateUser provisions a user
+func (s *SCIMServer) CreateUser(ctx context.Context, tenant *SCIMTenant, user *SCIMUser) (*SCIMUser, error) {
+	if strings.TrimSpace(user.UserName) == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrInvalidSCIM)
+	}
+	name, email := user.fields()
+	now := time.Now()
+	id := uuid.New().String()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO scim_users (id, facility_id, user_name, external_id, given_name, family_name, email, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (facility_id, user_name) DO NOTHING`,
+		id, tenant.FacilityID, user.UserName, user.ExternalID, name.GivenName, name.FamilyName, email, user.active(), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrSCIMConflict
+	}
+
+	if tenant.Issuer != "" && user.ExternalID != "" && s.oidc != nil {
+		if err := s.oidc.LinkIdentity(ctx, tenant.Issuer, user.ExternalID, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.sync(ctx, tenant, id); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, tenant, id)
+}
+
+// GetUser returns a provisioned user
+func (s *SCIMServer) GetUser(ctx context.Context, tenant *SCIMTenant, id string) (*SCIMUser, error) {
+	users, _, err := s.queryUsers(ctx, tenant, "id", id, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrSCIMNotFound
+	}
+	return users[0], nil
+}
+
+// ListUsers returns a page of users, optionally filtered on userName or
+// externalId. startIndex is 1-based.
+func (s *SCIMServer) ListUsers(ctx context.Context, tenant *SCIMTenant, filter string, startIndex, count int) ([]*SCIMUser, int, error) {
+	attr, value, err := parseSCIMFilter(filter, map[string]string{"username": "user_name", "externalid": "external_id"})
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.queryUsers(ctx, tenant, attr, value, startIndex, count)
+}
+
+// queryUsers loads users, with their groups, matching column = value
+func (s *SCIMServer) queryUsers(ctx context.Context, tenant *SCIMTenant, column, value string, startIndex, count int) ([]*SCIMUser, int, error) {
+	where := "facility_id = $1"
+	args := []interface{}{tenant.FacilityID}
+	if column != "" {
+		where += " AND " + column + " = $2"
+		args = append(args, value)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM scim_users WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, user_name, external_id, given_name, family_name, email, active, created_at, updated_at
+		FROM scim_users WHERE %s
+		ORDER BY created_at, id
+		LIMIT %d OFFSET %d`, where, count, startIndex-1),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*SCIMUser
+	for rows.Next() {
+		var u SCIMUser
+		var name SCIMName
+		var email string
+		var active bool
+		meta := SCIMMeta{ResourceType: "User"}
+		if err := rows.Scan(&u.ID, &u.UserName, &u.ExternalID, &name.GivenName, &name.FamilyName, &email, &active, &meta.Created, &meta.LastModified); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		u.Schemas = []string{scimUserSchema}
+		u.Active = &active
+		u.Meta = &meta
+		if name != (SCIMName{}) {
+			u.Name = &name
+		}
+		if email != "" {
+			u.Emails = []SCIMEmail{{Value: email, Primary: true}}
+		}
+		users = append(users, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	for _, u := range users {
+		groups, err := s.userGroups(ctx, u.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, g := range groups {
+			u.Groups = append(u.Groups, SCIMMember{Value: g.id, Display: g.name})
+		}
+	}
+	return users, total, nil
+}
+
+// ReplaceUser overwrites a user's attributes
+func (s *SCIMServer) ReplaceUser(ctx context.Context, tenant *SCIMTenant, id string, user *SCIMUser) (*SCIMUser, error) {
+	if strings.TrimSpace(user.UserName) == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrInvalidSCIM)
+	}
+	name, email := user.fields()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE scim_users
+		SET user_name = $3, external_id = $4, given_name = $5, family_name = $6, email = $7, active = $8, updated_at = $9
+		WHERE id = $1 AND facility_id = $2`,
+		id, tenant.FacilityID, user.UserName, user.ExternalID, name.GivenName, name.FamilyName, email, user.active(), time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrSCIMNotFound
+	}
+	if err := s.sync(ctx, tenant, id); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, tenant, id)
+}
+
+// PatchUser applies PATCH operations to a user. Identity providers mostly
+// use it to flip active.
+func (s *SCIMServer) PatchUser(ctx context.Context, tenant *SCIMTenant, id string, patch *SCIMPatch) (*SCIMUser, error) {
+	user, err := s.GetUser(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range patch.Operations {
+		if err := user.apply(op); err != nil {
+			return nil, err
+		}
+	}
+	return s.ReplaceUser(ctx, tenant, id, user)
+}
+
+// DeleteUser deprovisions a user
+func (s *SCIMServer) DeleteUser(ctx context.Context, tenant *SCIMTenant, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM scim_users WHERE id = $1 AND facility_id = $2`,
+		id, tenant.FacilityID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSCIMNotFound
+	}
+	return s.deactivate(ctx, id, "deleted by identity provider")
+}
+
+// CreateGroup provisions a group
+func (s *SCIMServer) CreateGroup(ctx context.Context, tenant *SCIMTenant, group *SCIMGroup) (*SCIMGroup, error) {
+	if strings.TrimSpace(group.DisplayName) == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidSCIM)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin group creation: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	id := uuid.New().String()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO scim_groups (id, facility_id, display_name, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (facility_id, display_name) DO NOTHING`,
+		id, tenant.FacilityID, group.DisplayName, group.ExternalID, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrSCIMConflict
+	}
+	if err := addMembers(ctx, tx, tenant, id, group.Members); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit group creation: %w", err)
+	}
+
+	if err := s.syncMembers(ctx, tenant, memberIDs(group.Members)); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, tenant, id)
+}
+
+// GetGroup returns a provisioned group with its members
+func (s *SCIMServer) GetGroup(ctx context.Context, tenant *SCIMTenant, id string) (*SCIMGroup, error) {
+	groups, _, err := s.queryGroups(ctx, tenant, "id", id, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, ErrSCIMNotFound
+	}
+	return groups[0], nil
+}
+
+// ListGroups returns a page of groups, optionally filtered on displayName
+// or externalId. startIndex is 1-based.
+func (s *SCIMServer) ListGroups(ctx context.Context, tenant *SCIMTenant, filter string, startIndex, count int) ([]*SCIMGroup, int, error) {
+	attr, value, err := parseSCIMFilter(filter, map[string]string{"displayname": "display_name", "externalid": "external_id"})
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.queryGroups(ctx, tenant, attr, value, startIndex, count)
+}
+
+// queryGroups loads groups, with their members, matching column = value
+func (s *SCIMServer) queryGroups(ctx context.Context, tenant *SCIMTenant, column, value string, startIndex, count int) ([]*SCIMGroup, int, error) {
+	where := "facility_id = $1"
+	args := []interface{}{tenant.FacilityID}
+	if column != "" {
+		where += " AND " + column + " = $2"
+		args = append(args, value)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM scim_groups WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count groups: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, display_name, external_id, created_at, updated_at
+		FROM scim_groups WHERE %s
+		ORDER BY created_at, id
+		LIMIT %d OFFSET %d`, where, count, startIndex-1),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*SCIMGroup
+	for rows.Next() {
+		var g SCIMGroup
+		meta := SCIMMeta{ResourceType: "Group"}
+		if err := rows.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &meta.Created, &meta.LastModified); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan group: %w", err)
+		}
+		g.Schemas = []string{scimGroupSchema}
+		g.Meta = &meta
+		groups = append(groups, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	for _, g := range groups {
+		members, err := s.groupMembers(ctx, g.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		g.Members = members
+	}
+	return groups, total, nil
+}
+
+// ReplaceGroup overwrites a group's name and members
+func (s *SCIMServer) ReplaceGroup(ctx context.Context, tenant *SCIMTenant, id string, group *SCIMGroup) (*SCIMGroup, error) {
+	if strings.TrimSpace(group.DisplayName) == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidSCIM)
+	}
+	before, err := s.groupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin group update: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE scim_groups SET display_name = $3, external_id = $4, updated_at = $5
+		WHERE id = $1 AND facility_id = $2`,
+		id, tenant.FacilityID, group.DisplayName, group.ExternalID, time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrSCIMNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to clear group members: %w", err)
+	}
+	if err := addMembers(ctx, tx, tenant, id, group.Members); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit group update: %w", err)
+	}
+
+	// A renamed group may map to a different role, so everyone who was or
+	// is a member is re-evaluated
+	if err := s.syncMembers(ctx, tenant, append(memberIDs(before), memberIDs(group.Members)...)); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, tenant, id)
+}
+
+// PatchGroup applies PATCH operations to a group: adding, removing or
+// replacing members, or renaming it
+func (s *SCIMServer) PatchGroup(ctx context.Context, tenant *SCIMTenant, id string, patch *SCIMPatch) (*SCIMGroup, error) {
+	group, err := s.GetGroup(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range patch.Operations {
+		if err := group.apply(op); err != nil {
+			return nil, err
+		}
+	}
+	return s.ReplaceGroup(ctx, tenant, id, group)
+}
+
+// DeleteGroup removes a group, re-evaluating its former members
+func (s *SCIMServer) DeleteGroup(ctx context.Context, tenant *SCIMTenant, id string) error {
+	members, err := s.groupMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM scim_groups WHERE id = $1 AND facility_id = $2`,
+		id, tenant.FacilityID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSCIMNotFound
+	}
+	return s.syncMembers(ctx, tenant, memberIDs(members))
+}
+
+// scimGroupRef is a group a user belongs to
+type scimGroupRef struct {
+	id   string
+	name string
+}
+
+// userGroups returns the groups a user belongs to
+func (s *SCIMServer) userGroups(ctx context.Context, userID string) ([]scimGroupRef, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT g.id, g.display_name
+		FROM scim_groups g JOIN scim_group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []scimGroupRef
+	for rows.Next() {
+		var g scimGroupRef
+		if err := rows.Scan(&g.id, &g.name); err != nil {
+			return nil, fmt.Errorf("failed to scan user group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// groupMembers returns a group's members
+func (s *SCIMServer) groupMembers(ctx context.Context, groupID string) ([]SCIMMember, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.id, u.user_name
+		FROM scim_users u JOIN scim_group_members m ON m.user_id = u.id
+		WHERE m.group_id = $1
+		ORDER BY u.user_name`,
+		groupID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []SCIMMember
+	for rows.Next() {
+		var m SCIMMember
+		if err := rows.Scan(&m.Value, &m.Display); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// addMembers adds users of the tenant's facility to a group; others are
+// refused
+func addMembers(ctx context.Context, tx *sql.Tx, tenant *SCIMTenant, groupID string, members []SCIMMember) error {
+	for _, m := range members {
+		if _, err := uuid.Parse(m.Value); err != nil {
+			return fmt.Errorf("%w: unknown member %s", ErrInvalidSCIM, m.Value)
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO scim_group_members (group_id, user_id)
+			SELECT $1, id FROM scim_users WHERE id = $2 AND facility_id = $3
+			ON CONFLICT DO NOTHING`,
+			groupID, m.Value, tenant.FacilityID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add group member: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM scim_users WHERE id = $1 AND facility_id = $2)`,
+				m.Value, tenant.FacilityID,
+			).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to check group member: %w", err)
+			}
+			if !exists {
+				return fmt.Errorf("%w: unknown member %s", ErrInvalidSCIM, m.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// memberIDs returns the user IDs of group members
+func memberIDs(members []SCIMMember) []string {
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.Value
+	}
+	return ids
+}
+
+// syncMembers re-evaluates users whose group membership changed
+func (s *SCIMServer) syncMembers(ctx context.Context, tenant *SCIMTenant, userIDs []string) error {
+	seen := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if err := s.sync(ctx, tenant, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync derives a user's role from their groups and applies it. Inactive
+// users, and users in no mapped group, are deactivated; a user whose role
+// changes is signed out so their next tokens carry the new role.
+func (s *SCIMServer) sync(ctx context.Context, tenant *SCIMTenant, userID string) error {
+	var active bool
+	var previous Role
+	err := s.db.QueryRowContext(ctx, `
+		SELECT active, role FROM scim_users WHERE id = $1`,
+		userID,
+	).Scan(&active, &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	groups, err := s.userGroups(ctx, userID)
+	if err != nil {
+		return err
+	}
+	role := tenant.mapRole(groups)
+	if role != previous {
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE scim_users SET role = $2 WHERE id = $1`,
+			userID, role,
+		); err != nil {
+			return fmt.Errorf("failed to update user role: %w", err)
+		}
+	}
+
+	switch {
+	case !active:
+		return s.deactivate(ctx, userID, "deactivated by identity provider")
+	case role == "":
+		return s.deactivate(ctx, userID, "no mapped group")
+	}
+	if err := s.redis.Del(ctx, deactivatedUserKey(userID)).Err(); err != nil {
+		return fmt.Errorf("failed to reactivate user: %w", err)
+	}
+	if previous != "" && role != previous {
+		s.logger.Info("provisioned role changed",
+			slog.String("user_id", userID),
+			slog.String("from", string(previous)),
+			slog.String("to", string(role)),
+		)
+		return s.auth.RevokeAllSessions(ctx, userID)
+	}
+	return nil
+}
+
+// mapRole returns the role of the first mapped group a user belongs to
+func (t *SCIMTenant) mapRole(groups []scimGroupRef) Role {
+	for _, mapping := range t.RoleMappings {
+		for _, g := range groups {
+			if g.name == mapping.Group {
+				return mapping.Role
+			}
+		}
+	}
+	return ""
+}
+
+// deactivate stops a user being issued tokens and signs them out
+// everywhere
+func (s *SCIMServer) deactivate(ctx context.Context, userID, reason string) error {
+	set, err := s.redis.SetNX(ctx, deactivatedUserKey(userID), reason, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to deactivate user: %w", err)
+	}
+	if set {
+		s.logger.Info("user deprovisioned",
+			slog.String("user_id", userID),
+			slog.String("reason", reason),
+		)
+	}
+	return s.auth.RevokeAllSessions(ctx, userID)
+}
+
+// checkUserActive refuses tokens for users deprovisioned through SCIM
+func (s *AuthService) checkUserActive(ctx context.Context, userID string) error {
+	n, err := s.redis.Exists(ctx, deactivatedUserKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check account status: %w", err)
+	}
+	if n > 0 {
+		return ErrUserDeactivated
+	}
+	return nil
+}
+
+// active reports a user's active attribute, which defaults to true
+func (u *SCIMUser) active() bool {
+	return u.Active == nil || *u.Active
+}
+
+// fields returns the stored name and primary email of a user
+func (u *SCIMUser) fields() (SCIMName, string) {
+	var name SCIMName
+	if u.Name != nil {
+		name = *u.Name
+	}
+	email := ""
+	for _, e := range u.Emails {
+		if e.Primary || email == "" {
+			email = e.Value
+		}
+	}
+	return name, email
+}
+
+// apply applies a PATCH operation to a user. Operations without a path
+// carry an object of attributes to set.
+func (u *SCIMUser) apply(op SCIMPatchOp) error {
+	if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+		return fmt.Errorf("%w: %s on a user", ErrUnsupportedSCIMOps, op.Op)
+	}
+	if op.Path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("%w: patch value must be an object", ErrInvalidSCIM)
+		}
+		for path, value := range attrs {
+			if err := u.apply(SCIMPatchOp{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch strings.ToLower(op.Path) {
+	case "active":
+		// Some identity providers send booleans as strings
+		var active bool
+		if err = json.Unmarshal(op.Value, &active); err != nil {
+			var s string
+			if json.Unmarshal(op.Value, &s) == nil {
+				active, err = strconv.ParseBool(s)
+			}
+		}
+		u.Active = &active
+	case "username":
+		err = json.Unmarshal(op.Value, &u.UserName)
+	case "externalid":
+		err = json.Unmarshal(op.Value, &u.ExternalID)
+	case "name":
+		u.Name = &SCIMName{}
+		err = json.Unmarshal(op.Value, u.Name)
+	case "name.givenname":
+		if u.Name == nil {
+			u.Name = &SCIMName{}
+		}
+		err = json.Unmarshal(op.Value, &u.Name.GivenName)
+	case "name.familyname":
+		if u.Name == nil {
+			u.Name = &SCIMName{}
+		}
+		err = json.Unmarshal(op.Value, &u.Name.FamilyName)
+	case "emails":
+		err = json.Unmarshal(op.Value, &u.Emails)
+	default:
+		return fmt.Errorf("%w: path %s", ErrUnsupportedSCIMOps, op.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: bad value for %s", ErrInvalidSCIM, op.Path)
+	}
+	return nil
+}
+
+// apply applies a PATCH operation to a group
+func (g *SCIMGroup) apply(op SCIMPatchOp) error {
+	path := strings.ToLower(op.Path)
+	switch {
+	case path == "":
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return fmt.Errorf("%w: patch value must be an object", ErrInvalidSCIM)
+		}
+		for path, value := range attrs {
+			if err := g.apply(SCIMPatchOp{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case path == "displayname":
+		if err := json.Unmarshal(op.Value, &g.DisplayName); err != nil {
+			return fmt.Errorf("%w: bad value for displayName", ErrInvalidSCIM)
+		}
+		return nil
+
+	case path == "members":
+		var members []SCIMMember
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return fmt.Errorf("%w: bad value for members", ErrInvalidSCIM)
+			}
+		}
+		switch strings.ToLower(op.Op) {
+		case "add":
+			g.Members = append(g.Members, members...)
+		case "replace":
+			g.Members = members
+		case "remove":
+			if len(members) == 0 {
+				g.Members = nil
+				return nil
+			}
+			g.removeMembers(memberIDs(members))
+		default:
+			return fmt.Errorf("%w: %s on members", ErrUnsupportedSCIMOps, op.Op)
+		}
+		return nil
+
+	case strings.HasPrefix(path, "members[") && strings.EqualFold(op.Op, "remove"):
+		// members[value eq "id"], as Azure AD sends removals
+		attr, id, err := parseSCIMFilter(strings.TrimSuffix(op.Path[len("members["):], "]"), map[string]string{"value": "value"})
+		if err != nil || attr == "" {
+			return fmt.Errorf("%w: path %s", ErrUnsupportedSCIMOps, op.Path)
+		}
+		g.removeMembers([]string{id})
+		return nil
+	}
+	return fmt.Errorf("%w: path %s", ErrUnsupportedSCIMOps, op.Path)
+}
+
+// removeMembers drops users from a group's member list
+func (g *SCIMGroup) removeMembers(ids []string) {
+	kept := g.Members[:0]
+	for _, m := range g.Members {
+		remove := false
+		for _, id := range ids {
+			if m.Value == id {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, m)
+		}
+	}
+	g.Members = kept
+}
+
+// parseSCIMFilter parses an `attribute eq "value"` filter, returning the
+// column for the attribute. An empty filter matches everything.
+func parseSCIMFilter(filter string, columns map[string]string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	m := scimFilter.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", fmt.Errorf("%w: only attribute eq \"value\" filters are supported", ErrInvalidSCIM)
+	}
+	column, ok := columns[strings.ToLower(m[1])]
+	if !ok {
+		return "", "", fmt.Errorf("%w: can't filter on %s", ErrInvalidSCIM, m[1])
+	}
+	return column, m[2], nil
+}
+
+// RegisterSCIMRoutes mounts the SCIM 2.0 endpoints under
+// /facilities/:facility_id/scim/v2. The group must already run
+// AuthMiddleware; only the facility's provisioning client is admitted.
+//
+//	GET/POST              /Users, /Groups
+//	GET/PUT/PATCH/DELETE  /Users/:id, /Groups/:id
+func (s *SCIMServer) RegisterSCIMRoutes(r gin.IRouter) {
+	scim := r.Group("/facilities/:facility_id/scim/v2", s.auth.RequireService(), s.auth.RequirePermission(PermissionAdminUsers), s.requireTenant())
+
+	scim.GET("/Users", s.list(func(ctx context.Context, t *SCIMTenant, filter string, start, count int) (interface{}, int, error) {
+		return s.ListUsers(ctx, t, filter, start, count)
+	}))
+	scim.POST("/Users", s.handle(http.StatusCreated, "create_user", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var user SCIMUser
+		if err := c.ShouldBindJSON(&user); err != nil {
+			return nil, fmt.Errorf("%w: malformed user", ErrInvalidSCIM)
+		}
+		return s.CreateUser(c.Request.Context(), t, &user)
+	}))
+	scim.GET("/Users/:id", s.handle(http.StatusOK, "", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		return s.GetUser(c.Request.Context(), t, c.Param("id"))
+	}))
+	scim.PUT("/Users/:id", s.handle(http.StatusOK, "replace_user", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var user SCIMUser
+		if err := c.ShouldBindJSON(&user); err != nil {
+			return nil, fmt.Errorf("%w: malformed user", ErrInvalidSCIM)
+		}
+		return s.ReplaceUser(c.Request.Context(), t, c.Param("id"), &user)
+	}))
+	scim.PATCH("/Users/:id", s.handle(http.StatusOK, "patch_user", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var patch SCIMPatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			return nil, fmt.Errorf("%w: malformed patch", ErrInvalidSCIM)
+		}
+		return s.PatchUser(c.Request.Context(), t, c.Param("id"), &patch)
+	}))
+	scim.DELETE("/Users/:id", s.handle(http.StatusNoContent, "delete_user", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		return nil, s.DeleteUser(c.Request.Context(), t, c.Param("id"))
+	}))
+
+	scim.GET("/Groups", s.list(func(ctx context.Context, t *SCIMTenant, filter string, start, count int) (interface{}, int, error) {
+		return s.ListGroups(ctx, t, filter, start, count)
+	}))
+	scim.POST("/Groups", s.handle(http.StatusCreated, "create_group", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var group SCIMGroup
+		if err := c.ShouldBindJSON(&group); err != nil {
+			return nil, fmt.Errorf("%w: malformed group", ErrInvalidSCIM)
+		}
+		return s.CreateGroup(c.Request.Context(), t, &group)
+	}))
+	scim.GET("/Groups/:id", s.handle(http.StatusOK, "", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		return s.GetGroup(c.Request.Context(), t, c.Param("id"))
+	}))
+	scim.PUT("/Groups/:id", s.handle(http.StatusOK, "replace_group", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var group SCIMGroup
+		if err := c.ShouldBindJSON(&group); err != nil {
+			return nil, fmt.Errorf("%w: malformed group", ErrInvalidSCIM)
+		}
+		return s.ReplaceGroup(c.Request.Context(), t, c.Param("id"), &group)
+	}))
+	scim.PATCH("/Groups/:id", s.handle(http.StatusOK, "patch_group", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		var patch SCIMPatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			return nil, fmt.Errorf("%w: malformed patch", ErrInvalidSCIM)
+		}
+		return s.PatchGroup(c.Request.Context(), t, c.Param("id"), &patch)
+	}))
+	scim.DELETE("/Groups/:id", s.handle(http.StatusNoContent, "delete_group", func(c *gin.Context, t *SCIMTenant) (interface{}, error) {
+		return nil, s.DeleteGroup(c.Request.Context(), t, c.Param("id"))
+	}))
+}
+
+// requireTenant admits only the client registered to provision the
+// facility in the path
+func (s *SCIMServer) requireTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := s.tenant(c.Param("facility_id"))
+		if err != nil {
+			writeSCIMError(c, http.StatusNotFound, err)
+			return
+		}
+		claims, err := GetClaimsFromContext(c)
+		if err != nil || claims.UserID != tenant.ClientID {
+			writeSCIMError(c, http.StatusForbidden, errors.New("client may not provision this facility"))
+			return
+		}
+		c.Set("scim_tenant", tenant)
+		c.Next()
+	}
+}
+
+// handle wraps a SCIM operation, auditing changes. An empty action marks a
+// read.
+func (s *SCIMServer) handle(status int, action string, op func(*gin.Context, *SCIMTenant) (interface{}, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.MustGet("scim_tenant").(*SCIMTenant)
+		if id := c.Param("id"); id != "" {
+			if _, err := uuid.Parse(id); err != nil {
+				writeSCIMError(c, http.StatusNotFound, ErrSCIMNotFound)
+				return
+			}
+		}
+		result, err := op(c, tenant)
+		if action != "" {
+			s.audit(c, tenant, action, err)
+		}
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		if status == http.StatusNoContent {
+			c.Status(status)
+			return
+		}
+		c.Render(status, scimJSON{result})
+	}
+}
+
+// list wraps a SCIM list operation with paging
+func (s *SCIMServer) list(op func(context.Context, *SCIMTenant, string, int, int) (interface{}, int, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.MustGet("scim_tenant").(*SCIMTenant)
+		start, _ := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+		start = max(start, 1)
+		count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimMaxResults)))
+		if err != nil || count < 0 || count > scimMaxResults {
+			count = scimMaxResults
+		}
+
+		resources, total, err := op(c.Request.Context(), tenant, c.Query("filter"), start, count)
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		page := 0
+		switch r := resources.(type) {
+		case []*SCIMUser:
+			page = len(r)
+		case []*SCIMGroup:
+			page = len(r)
+		}
+		c.Render(http.StatusOK, scimJSON{&scimList{
+			Schemas:      []string{scimListSchema},
+			TotalResults: total,
+			StartIndex:   start,
+			ItemsPerPage: page,
+			Resources:    resources,
+		}})
+	}
+}
+
+// audit records a provisioning change
+func (s *SCIMServer) audit(c *gin.Context, tenant *SCIMTenant, action string, err error) {
+	if s.auth.auditLogger == nil {
+		return
+	}
+	details := map[string]interface{}{"facility_id": tenant.FacilityID}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	s.auth.auditLogger.LogAccess(c.Request.Context(), &AccessEvent{
+		Timestamp: time.Now(),
+		UserID:    tenant.ClientID,
+		Role:      RoleSystem,
+		Resource:  c.Request.URL.Path,
+		Action:    "scim_" + action,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Success:   err == nil,
+		Details:   details,
+	})
+}
+
+// writeError answers a failed SCIM request
+func (s *SCIMServer) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrSCIMNotFound):
+		writeSCIMError(c, http.StatusNotFound, err)
+	case errors.Is(err, ErrSCIMConflict):
+		writeSCIMError(c, http.StatusConflict, err)
+	case errors.Is(err, ErrInvalidSCIM), errors.Is(err, ErrUnsupportedSCIMOps):
+		writeSCIMError(c, http.StatusBadRequest, err)
+	default:
+		s.logger.Error("SCIM request failed",
+			slog.String("path", c.Request.URL.Path),
+			slog.String("error", err.Error()),
+		)
+		writeSCIMError(c, http.StatusInternalServerError, errors.New("provisioning unavailable"))
+	}
+}
+
+// writeSCIMError answers with a SCIM error message
+func writeSCIMError(c *gin.Context, status int, err error) {
+	c.Abort()
+	c.Render(status, scimJSON{gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  err.Error(),
+	}})
+}
+
+// scimJSON renders JSON with the SCIM media type
+type scimJSON struct {
+	data interface{}
+}
+
+func (r scimJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.data)
+}
+
+func (r scimJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", scimContentType)
+}
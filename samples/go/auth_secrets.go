@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// ErrSecretNotFound is returned when a provider has no secret by a name
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider supplies secret material by name, e.g. the legacy JWT
+// secret, the client secret pepper or the signing key KEK, so none of them
+// has to sit in configuration
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// RotationHook is called when a cached secret's value changes
+type RotationHook func(ctx context.Context, previous, current []byte) error
+
+// cachedSecret is a secret held by a SecretCache
+type cachedSecret struct {
+	value    []byte
+	previous []byte // The value before the last rotation
+	fetched  time.Time
+}
+
+// SecretCache fetches secrets lazily from a provider and holds them for a
+// TTL, so a secrets manager isn't called on every token. A value that
+// changes on refetch is a rotation: hooks registered for the name run and
+// the old value stays available from Previous. When the provider is down
+// the last value is served.
+type SecretCache struct {
+	provider SecretProvider
+	ttl      time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	secrets map[string]*cachedSecret
+	hooks   map[string][]RotationHook
+}
+
+// NewSecretCache creates a cache over provider. Other instances pick up a
+// rotation within ttl.
+func NewSecretCache(provider SecretProvider, ttl time.Duration, logger *slog.Logger) *SecretCache {
+	return &SecretCache{
+		provider: provider,
+		ttl:      ttl,
+		logger:   logger,
+		secrets:  make(map[string]*cachedSecret),
+		hooks:    make(map[string][]RotationHook),
+	}
+}
+
+// Secret returns a secret, fetching it if it isn't cached or is stale
+func (sc *SecretCache) Secret(ctx context.Context, name string) ([]byte, error) {
+	sc.mu.Lock()
+	cached, ok := sc.secrets[name]
+	sc.mu.Unlock()
+	if ok && time.Since(cached.fetched) < sc.ttl {
+		return cached.value, nil
+	}
+
+	value, err := sc.fetch(ctx, name)
+	if err != nil {
+		if ok {
+			sc.logger.Warn("serving cached secret",
+				slog.String("name", name),
+				slog.String("error", err.Error()),
+			)
+			return cached.value, nil
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// Previous returns the value a secret had before its last rotation, or nil
+func (sc *SecretCache) Previous(name string) []byte {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if cached, ok := sc.secrets[name]; ok {
+		return cached.previous
+	}
+	return nil
+}
+
+// OnRotate registers a hook to run when a secret's value changes
+func (sc *SecretCache) OnRotate(name string, hook RotationHook) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.hooks[name] = append(sc.hooks[name], hook)
+}
+
+// Refresh refetches a secret now, e.g. when told of a rotation rather than
+// waiting out the TTL
+func (sc *SecretCache) Refresh(ctx context.Context, name string) error {
+	_, err := sc.fetch(ctx, name)
+	return err
+}
+
+// fetch reads a secret from the provider and runs the rotation hooks if it
+// changed
+func (sc *SecretCache) fetch(ctx context.Context, name string) ([]byte, error) {
+	value, err := sc.provider.Secret(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch secret %s: %w", name, err)
+	}
+
+	sc.mu.Lock()
+	cached, ok := sc.secrets[name]
+	rotated := ok && !bytes.Equal(cached.value, value)
+	next := &cachedSecret{value: value, fetched: time.Now()}
+	if ok {
+		next.previous = cached.previous
+	}
+	if rotated {
+		next.previous = cached.value
+	}
+	sc.secrets[name] = next
+	hooks := sc.hooks[name]
+	sc.mu.Unlock()
+
+	if !rotated {
+		return value, nil
+	}
+	sc.logger.Info("secret rotated",
+		slog.String("name", name),
+	)
+	for _, hook := range hooks {
+		if err := hook(ctx, next.previous, value); err != nil {
+			sc.logger.Error("secret rotation hook failed",
+				slog.String("name", name),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return value, nil
+}
+
+// VaultSecretProvider reads secrets from a HashiCorp Vault KV version 2
+// engine. Each secret holds its value in one field.
+type VaultSecretProvider struct {
+	Address string // e.g. https://vault.internal:8200
+	Token   string
+	Mount   string // KV mount; "secret" when empty
+	Field   string // Field holding the value; "value" when empty
+	Base64  bool   // Values are stored base64-encoded
+	Client  *http.Client
+}
+
+// Secret reads the latest version of a secret
+func (p *VaultSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	mount, field, client := p.Mount, p.Field, p.Client
+	if mount == "" {
+		mount = "secret"
+	}
+	if field == "" {
+		field = "value"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	endpoint := strings.TrimSuffix(p.Address, "/") + "/v1/" + url.PathEscape(mount) + "/data/" + strings.TrimPrefix(name, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from vault: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	value, ok := body.Data.Data[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no field %s", ErrSecretNotFound, name, field)
+	}
+	if !p.Base64 {
+		return []byte(value), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret %s: %w", name, err)
+	}
+	return decoded, nil
+}
+
+// AWSSecretsManagerProvider reads secrets from AWS Secrets Manager by
+// secret name or ARN
+type AWSSecretsManagerProvider struct {
+	Client *secretsmanager.Client
+}
+
+// Secret reads the current version of a secret
+func (p *AWSSecretsManagerProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	out, err := p.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from secrets manager: %w", err)
+	}
+	if out.SecretBinary != nil {
+		return out.SecretBinary, nil
+	}
+	return []byte(aws.ToString(out.SecretString)), nil
+}
+
+// AWSKMSProvider decrypts secrets kept as KMS ciphertext, e.g. in
+// deployment configuration, so only the KMS key grants can reveal them
+type AWSKMSProvider struct {
+	Client      *kms.Client
+	KeyID       string            // Expected key; any key the ciphertext names when empty
+	Ciphertexts map[string][]byte // Secret name to ciphertext blob
+}
+
+// Secret decrypts a named ciphertext
+func (p *AWSKMSProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	blob, ok := p.Ciphertexts[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	input := &kms.DecryptInput{
+		CiphertextBlob:    blob,
+		EncryptionContext: map[string]string{"secret": name},
+	}
+	if p.KeyID != "" {
+		input.KeyId = aws.String(p.KeyID)
+	}
+	out, err := p.Client.Decrypt(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return out.Plaintext, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher from a 32-byte key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// SecretAEAD returns an AES-256-GCM cipher keyed by a 32-byte secret, for
+// encrypting fields at rest
+func SecretAEAD(ctx context.Context, secrets SecretProvider, name string) (cipher.AEAD, error) {
+	key, err := secrets.Secret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+// legacySecret returns the HS256 secret for tokens without a kid, from
+// the secret provider when one is configured, or nil if there is none
+func (s *AuthService) legacySecret(ctx context.Context) ([]byte, error) {
+	if s.config.Secrets != nil && s.config.JWTSecretName != "" {
+		secret, err := s.config.Secrets.Secret(ctx, s.config.JWTSecretName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get JWT secret: %w", err)
+		}
+		return secret, nil
+	}
+	if s.config.JWTSecret == "" {
+		return nil, nil
+	}
+	return []byte(s.config.JWTSecret), nil
+}
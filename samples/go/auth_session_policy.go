@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ErrDeviceMismatch is returned when a token bound to one device is used
+// from another under an enforcing policy
+var ErrDeviceMismatch = errors.New("token is bound to another device")
+
+// DeviceBinding is how strictly tokens are held to the device they were
+// issued to
+type DeviceBinding string
+
+const (
+	DeviceBindingOff     DeviceBinding = "off"
+	DeviceBindingLog     DeviceBinding = "log"     // Mismatches are logged
+	DeviceBindingEnforce DeviceBinding = "enforce" // Mismatches are refused
+)
+
+// SessionPolicy overrides AuthConfig's session settings for a role, e.g.
+// short, device-bound sessions for residents on shared facility tablets.
+// Zero and nil fields inherit the global setting.
+type SessionPolicy struct {
+	AccessTokenExpiry     time.Duration
+	RefreshTokenExpiry    time.Duration
+	IdleTimeout           time.Duration
+	MaxConcurrentSessions *int // Zero or less for no limit
+	DeviceBinding         DeviceBinding
+	AuditAllAccess        *bool
+}
+
+// sessionRules are the session settings in force for a role
+type sessionRules struct {
+	accessExpiry  time.Duration
+	refreshExpiry time.Duration
+	idleTimeout   time.Duration
+	maxSessions   int
+	binding       DeviceBinding
+	auditAll      bool
+}
+
+// sessionRules resolves a role's session settings from AuthConfig and the
+// role's policy
+func (s *AuthService) sessionRules(role Role) sessionRules {
+	rules := sessionRules{
+		accessExpiry:  s.config.AccessTokenExpiry,
+		refreshExpiry: s.config.RefreshTokenExpiry,
+		idleTimeout:   s.config.IdleTimeout,
+		maxSessions:   s.config.MaxConcurrentSessions,
+		binding:       DeviceBindingOff,
+		auditAll:      s.config.AuditAllAccess,
+	}
+	if s.config.RequireDeviceBinding {
+		rules.binding = DeviceBindingLog
+	}
+
+	policy := s.config.RolePolicies[role]
+	if policy == nil {
+		return rules
+	}
+	if policy.AccessTokenExpiry > 0 {
+		rules.accessExpiry = policy.AccessTokenExpiry
+	}
+	if policy.RefreshTokenExpiry > 0 {
+		rules.refreshExpiry = policy.RefreshTokenExpiry
+	}
+	if policy.IdleTimeout > 0 {
+		rules.idleTimeout = policy.IdleTimeout
+	}
+	if policy.MaxConcurrentSessions != nil {
+		rules.maxSessions = *policy.MaxConcurrentSessions
+	}
+	if policy.DeviceBinding != "" {
+		rules.binding = policy.DeviceBinding
+	}
+	if policy.AuditAllAccess != nil {
+		rules.auditAll = *policy.AuditAllAccess
+	}
+	return rules
+}
+
+// maxRefreshExpiry is the longest any session can last, for pruning
+// session indexes without knowing the user's role
+func (s *AuthService) maxRefreshExpiry() time.Duration {
+	longest := s.config.RefreshTokenExpiry
+	for _, policy := range s.config.RolePolicies {
+		longest = max(longest, policy.RefreshTokenExpiry)
+	}
+	return longest
+}
+
+// checkDevice applies the role's device binding to a request made from
+// deviceID
+func (s *AuthService) checkDevice(claims *Claims, rules sessionRules, deviceID string) error {
+	if rules.binding == DeviceBindingOff || claims.DeviceID == "" || deviceID == claims.DeviceID {
+		return nil
+	}
+	s.logger.Warn("device binding mismatch",
+		slog.String("user_id", claims.UserID),
+		slog.String("role", string(claims.Role)),
+		slog.String("expected", claims.DeviceID),
+		slog.String("actual", deviceID),
+		slog.String("binding", string(rules.binding)),
+	)
+	if rules.binding == DeviceBindingEnforce {
+		return ErrDeviceMismatch
+	}
+	return nil
+}
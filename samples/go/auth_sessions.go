@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrSessionNotFound is returned for unknown or expired sessions
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionInfo describes an active session
+type SessionInfo struct {
+	SessionID  string    `json:"session_id"`
+	UserID     string    `json:"user_id"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	Current    bool      `json:"current"` // The session making the request
+}
+
+// sessionKey holds a session's details
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+// userSessionsKey indexes a user's session IDs in a sorted set scored by
+// creation time
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("user:%s:sessions", userID)
+}
+
+// sessionExpiredBefore is the index score below which sessions have expired
+func sessionExpiredBefore(now time.Time, lifetime time.Duration) string {
+	return "(" + strconv.FormatInt(now.Add(-lifetime).Unix(), 10)
+}
+
+// ListSessions returns a user's active sessions, newest first. Index
+// entries for expired or deleted sessions are pruned on the way.
+func (s *AuthService) ListSessions(ctx context.Context, userID string) ([]*SessionInfo, error) {
+	index := userSessionsKey(userID)
+	s.redis.ZRemRangeByScore(ctx, index, "-inf", sessionExpiredBefore(time.Now(), s.maxRefreshExpiry()))
+	ids, err := s.redis.ZRevRange(ctx, index, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := make([]*SessionInfo, 0, len(ids))
+	var expired []interface{}
+	for _, id := range ids {
+		info, err := s.GetSession(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			expired = append(expired, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, info)
+	}
+	if len(expired) > 0 {
+		s.redis.ZRem(ctx, index, expired...)
+	}
+	return sessions, nil
+}
+
+// GetSession returns a session's details
+func (s *AuthService) GetSession(ctx context.Context, sessionID string) (*SessionInfo, error) {
+	fields, err := s.redis.HGetAll(ctx, sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	unix := func(field string) time.Time {
+		n, _ := strconv.ParseInt(fields[field], 10, 64)
+		return time.Unix(n, 0)
+	}
+	return &SessionInfo{
+		SessionID:  sessionID,
+		UserID:     fields["user_id"],
+		DeviceID:   fields["device_id"],
+		IPAddress:  fields["ip_address"],
+		CreatedAt:  unix("created_at"),
+		LastActive: unix("last_active"),
+	}, nil
+}
+
+// dropSession deletes a session and its index entry without auditing,
+// for sessions replaced rather than ended
+func (s *AuthService) dropSession(ctx context.Context, sessionID, userID string) error {
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.ZRem(ctx, userSessionsKey(userID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// RegisterSessionRoutes mounts session management. The group must already
+// run AuthMiddleware.
+//
+//	GET    /sessions                    the caller's sessions
+//	DELETE /sessions/:session_id        end one of the caller's sessions
+//	DELETE /sessions                    sign out everywhere (?keep_current=true spares this one)
+//	GET    /users/:user_id/sessions     a user's sessions (admins)
+//	DELETE /users/:user_id/sessions     sign a user out everywhere (admins)
+//	DELETE /users/:user_id/sessions/:session_id
+func (s *AuthService) RegisterSessionRoutes(r gin.IRouter) {
+	own := r.Group("/sessions", s.RequireHuman())
+	own.GET("", s.listSessions)
+	own.DELETE("/:session_id", s.revokeSession)
+	own.DELETE("", s.revokeAllSessions)
+
+	admin := r.Group("/users/:user_id/sessions", s.RequirePermission(PermissionAdminUsers))
+	admin.GET("", s.listSessions)
+	admin.DELETE("/:session_id", s.revokeSession)
+	admin.DELETE("", s.revokeAllSessions)
+}
+
+// sessionOwner returns the caller's claims and the user whose sessions a
+// request is about
+func sessionOwner(c *gin.Context) (*Claims, string, bool) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "authentication required",
+		})
+		return nil, "", false
+	}
+	if userID := c.Param("user_id"); userID != "" {
+		return claims, userID, true
+	}
+	return claims, claims.UserID, true
+}
+
+// listSessions serves a user's active sessions
+func (s *AuthService) listSessions(c *gin.Context) {
+	claims, userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	sessions, err := s.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		s.writeSessionError(c, err)
+		return
+	}
+	for _, session := range sessions {
+		session.Current = session.SessionID == claims.SessionID
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// revokeSession ends one session. A session belonging to someone else is
+// reported as not found.
+func (s *AuthService) revokeSession(c *gin.Context) {
+	claims, userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	session, err := s.GetSession(ctx, c.Param("session_id"))
+	if err == nil && session.UserID != userID {
+		err = ErrSessionNotFound
+	}
+	if err != nil {
+		s.writeSessionError(c, err)
+		return
+	}
+
+	reason := "signed out by user"
+	if claims.UserID != userID {
+		reason = "revoked by admin " + claims.UserID
+	}
+	if err := s.RevokeSession(ctx, session.SessionID, userID, reason); err != nil {
+		s.writeSessionError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// revokeAllSessions signs a user out everywhere
+func (s *AuthService) revokeAllSessions(c *gin.Context) {
+	claims, userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var err error
+	if c.Query("keep_current") == "true" && claims.UserID == userID {
+		err = s.revokeOtherSessions(ctx, userID, claims.SessionID)
+	} else {
+		err = s.RevokeAllSessions(ctx, userID)
+	}
+	if err != nil {
+		s.writeSessionError(c, err)
+		return
+	}
+
+	if s.auditLogger != nil && claims.UserID != userID {
+		s.auditLogger.LogAccess(ctx, &AccessEvent{
+			Timestamp: time.Now(),
+			UserID:    claims.UserID,
+			Role:      claims.Role,
+			Resource:  "sessions:" + userID,
+			Action:    "revoke_all",
+			IPAddress: c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			SessionID: claims.SessionID,
+			Success:   true,
+		})
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// revokeOtherSessions ends all of a user's sessions except one
+func (s *AuthService) revokeOtherSessions(ctx context.Context, userID, keep string) error {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.SessionID == keep {
+			continue
+		}
+		if err := s.RevokeSession(ctx, session.SessionID, userID, "signed out of other sessions"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSessionError answers a failed session management request
+func (s *AuthService) writeSessionError(c *gin.Context, err error) {
+	if errors.Is(err, ErrSessionNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Error("session management failed",
+		slog.String("error", err.Error()),
+	)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+		"error": "session management unavailable",
+	})
+}
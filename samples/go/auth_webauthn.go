@@ -0,0 +1,671 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// WebAuthn limits
+const (
+	webauthnCeremonyTTL = 5 * time.Minute
+	maxSecurityKeys     = 10
+)
+
+// WebAuthn errors
+var (
+	ErrSecurityKeyRequired = errors.New("a security key is required for this account")
+	ErrWebAuthnFailed      = errors.New("security key verification failed")
+	ErrCeremonyExpired     = errors.New("security key ceremony expired or unknown")
+	ErrAttestationRejected = errors.New("authenticator not allowed by attestation policy")
+	ErrSecurityKeyNotFound = errors.New("security key not found")
+	ErrLastSecurityKey     = errors.New("the last security key of an account that requires one can't be removed")
+	ErrTooManySecurityKeys = errors.New("too many security keys registered")
+)
+
+// SecondFactorRequired is returned by a password login that must be
+// completed with a security key. The client passes Options to
+// navigator.credentials.get and posts the result with the ceremony ID.
+type SecondFactorRequired struct {
+	CeremonyID string
+	Options    *protocol.CredentialAssertion
+}
+
+func (e *SecondFactorRequired) Error() string {
+	return "security key required to complete sign-in"
+}
+
+// WebAuthnConfig configures the relying party and its attestation policy
+type WebAuthnConfig struct {
+	RPID          string // Domain credentials are scoped to, e.g. "companion.example.com"
+	RPDisplayName string
+	RPOrigins     []string // Origins ceremonies may come from
+	// Attestation asks authenticators to prove their model. "direct" is
+	// needed for AllowedAAGUIDs to mean anything.
+	Attestation     protocol.ConveyancePreference
+	RequireAttested bool     // Refuse keys registered without attestation
+	AllowedAAGUIDs  []string // Authenticator models admitted; any when empty
+	// RequiredForRoles must complete password logins with a security key,
+	// e.g. RoleProvider for phishing-resistant clinician accounts
+	RequiredForRoles []Role
+	// AllowUnenrolled lets users of those roles sign in with a password
+	// alone until they register a key, so they can enroll; turn it off
+	// once they have
+	AllowUnenrolled bool
+}
+
+// SecurityKey is a registered WebAuthn credential, as shown to its owner
+type SecurityKey struct {
+	ID              string     `json:"id"` // Base64url credential ID
+	Name            string     `json:"name"`
+	AAGUID          string     `json:"aaguid"`
+	AttestationType string     `json:"attestation_type"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+// storedSecurityKey is a security key with its credential
+type storedSecurityKey struct {
+	SecurityKey
+	Credential webauthn.Credential `json:"credential"`
+}
+
+// webauthnUser is a user's security keys. It implements webauthn.User
+// with the user ID as the user handle, so discoverable logins identify the
+// user directly.
+type webauthnUser struct {
+	UserID     string               `json:"user_id"`
+	Role       Role                 `json:"role"`
+	FacilityID string               `json:"facility_id"`
+	Keys       []*storedSecurityKey `json:"keys"`
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return []byte(u.UserID) }
+func (u *webauthnUser) WebAuthnName() string        { return u.UserID }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.UserID }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.Keys))
+	for i, k := range u.Keys {
+		credentials[i] = k.Credential
+	}
+	return credentials
+}
+
+// Ceremony kinds
+const (
+	ceremonyRegister     = "register"
+	ceremonyLogin        = "login"
+	ceremonySecondFactor = "second_factor"
+)
+
+// webauthnCeremony is a registration or login in progress, kept until it
+// is finished
+type webauthnCeremony struct {
+	Kind       string               `json:"kind"`
+	Session    webauthn.SessionData `json:"session"`
+	UserID     string               `json:"user_id,omitempty"`
+	Role       Role                 `json:"role,omitempty"`
+	FacilityID string               `json:"facility_id,omitempty"`
+	DeviceID   string               `json:"device_id,omitempty"`
+	ClientID   string               `json:"client_id,omitempty"`
+	Name       string               `json:"name,omitempty"` // Of the key being registered
+}
+
+// webauthnUserKey holds a user's security keys
+func webauthnUserKey(userID string) string {
+	return fmt.Sprintf("auth:webauthn:%s", userID)
+}
+
+// webauthnCeremonyKey holds a ceremony in progress
+func webauthnCeremonyKey(id string) string {
+	return fmt.Sprintf("auth:webauthn_ceremony:%s", id)
+}
+
+// WebAuthnService registers security keys and signs users in with them,
+// as a primary factor or after a password
+type WebAuthnService struct {
+	config    *WebAuthnConfig
+	webauthn  *webauthn.WebAuthn
+	redis     *redis.Client
+	auth      *AuthService
+	directory UserDirectory // Optional; roles stored at registration when nil
+	logger    *slog.Logger
+}
+
+// NewWebAuthnService creates a WebAuthn service issuing tokens from auth.
+// directory, if given, supplies current roles at passwordless login.
+func NewWebAuthnService(config *WebAuthnConfig, redis *redis.Client, auth *AuthService, directory UserDirectory, logger *slog.Logger) (*WebAuthnService, error) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:                  config.RPID,
+		RPDisplayName:         config.RPDisplayName,
+		RPOrigins:             config.RPOrigins,
+		AttestationPreference: config.Attestation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure webauthn: %w", err)
+	}
+	return &WebAuthnService{
+		config:    config,
+		webauthn:  w,
+		redis:     redis,
+		auth:      auth,
+		directory: directory,
+		logger:    logger,
+	}, nil
+}
+
+// requiredFor reports whether a role's password logins need a security key
+func (s *WebAuthnService) requiredFor(role Role) bool {
+	return slices.Contains(s.config.RequiredForRoles, role)
+}
+
+// BeginRegistration starts registering a security key for the caller
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, claims *Claims, name string) (*protocol.CredentialCreation, string, error) {
+	user, err := s.loadUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(user.Keys) >= maxSecurityKeys {
+		return nil, "", ErrTooManySecurityKeys
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(user.Keys))
+	for i, k := range user.Keys {
+		exclusions[i] = k.Credential.Descriptor()
+	}
+	options, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin registration: %w", err)
+	}
+	id, err := s.saveCeremony(ctx, &webauthnCeremony{
+		Kind:       ceremonyRegister,
+		Session:    *session,
+		UserID:     claims.UserID,
+		Role:       claims.Role,
+		FacilityID: claims.FacilityID,
+		Name:       name,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return options, id, nil
+}
+
+// FinishRegistration verifies the authenticator's attestation response
+// and stores the new key
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, claims *Claims, ceremonyID string, r *http.Request, ipAddress string) (*SecurityKey, error) {
+	ceremony, err := s.takeCeremony(ctx, ceremonyID, ceremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != claims.UserID {
+		return nil, ErrCeremonyExpired
+	}
+	user, err := s.loadUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.FinishRegistration(user, ceremony.Session, r)
+	if err != nil {
+		s.audit(ctx, claims.UserID, "webauthn_register", ipAddress, "", err)
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+	aaguid := ""
+	if id, err := uuid.FromBytes(credential.Authenticator.AAGUID); err == nil {
+		aaguid = id.String()
+	}
+	if err := s.checkAttestation(credential, aaguid); err != nil {
+		s.audit(ctx, claims.UserID, "webauthn_register", ipAddress, "", err)
+		return nil, err
+	}
+
+	key := &storedSecurityKey{
+		SecurityKey: SecurityKey{
+			ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+			Name:            ceremony.Name,
+			AAGUID:          aaguid,
+			AttestationType: credential.AttestationType,
+			CreatedAt:       time.Now(),
+		},
+		Credential: *credential,
+	}
+	user.Role = claims.Role
+	user.FacilityID = claims.FacilityID
+	user.Keys = append(user.Keys, key)
+	if err := s.saveUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("security key registered",
+		slog.String("user_id", claims.UserID),
+		slog.String("aaguid", aaguid),
+		slog.String("attestation", credential.AttestationType),
+	)
+	s.audit(ctx, claims.UserID, "webauthn_register", ipAddress, "", nil)
+	return &key.SecurityKey, nil
+}
+
+// checkAttestation applies the attestation policy to a new credential
+func (s *WebAuthnService) checkAttestation(credential *webauthn.Credential, aaguid string) error {
+	if s.config.RequireAttested && (credential.AttestationType == "" || credential.AttestationType == "none") {
+		return fmt.Errorf("%w: attestation required", ErrAttestationRejected)
+	}
+	if len(s.config.AllowedAAGUIDs) > 0 && !slices.Contains(s.config.AllowedAAGUIDs, aaguid) {
+		return fmt.Errorf("%w: authenticator model %s", ErrAttestationRejected, aaguid)
+	}
+	return nil
+}
+
+// ListKeys returns a user's security keys
+func (s *WebAuthnService) ListKeys(ctx context.Context, userID string) ([]*SecurityKey, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*SecurityKey, len(user.Keys))
+	for i, k := range user.Keys {
+		keys[i] = &k.SecurityKey
+	}
+	return keys, nil
+}
+
+// RemoveKey deletes a security key. The last key of a user whose role
+// requires one stays, so the account isn't left without its second factor.
+func (s *WebAuthnService) RemoveKey(ctx context.Context, claims *Claims, keyID, ipAddress string) error {
+	user, err := s.loadUser(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(user.Keys, func(k *storedSecurityKey) bool { return k.ID == keyID })
+	if i < 0 {
+		return ErrSecurityKeyNotFound
+	}
+	if len(user.Keys) == 1 && s.requiredFor(claims.Role) {
+		return ErrLastSecurityKey
+	}
+	user.Keys = slices.Delete(user.Keys, i, i+1)
+	if err := s.saveUser(ctx, user); err != nil {
+		return err
+	}
+	s.audit(ctx, claims.UserID, "webauthn_remove", ipAddress, "", nil)
+	return nil
+}
+
+// BeginLogin starts a passwordless login with a discoverable credential.
+// The authenticator picks the account, and user verification (PIN or
+// biometric) stands in for the password.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, deviceID, clientID string) (*protocol.CredentialAssertion, string, error) {
+	if _, err := s.auth.tokenClient(clientID); err != nil {
+		return nil, "", err
+	}
+	options, session, err := s.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin login: %w", err)
+	}
+	id, err := s.saveCeremony(ctx, &webauthnCeremony{
+		Kind:     ceremonyLogin,
+		Session:  *session,
+		DeviceID: deviceID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return options, id, nil
+}
+
+// secondFactor is called once a password is verified. It returns nil if
+// the account's role doesn't need a security key, or a
+// SecondFactorRequired challenge to finish with FinishLogin.
+func (s *WebAuthnService) secondFactor(ctx context.Context, account *Account, req *LoginRequest) error {
+	if !s.requiredFor(account.Role) {
+		return nil
+	}
+	user, err := s.loadUser(ctx, account.UserID)
+	if err != nil {
+		return err
+	}
+	if len(user.Keys) == 0 {
+		if s.config.AllowUnenrolled {
+			s.logger.Warn("password login without required security key",
+				slog.String("user_id", account.UserID),
+				slog.String("role", string(account.Role)),
+			)
+			return nil
+		}
+		return ErrSecurityKeyRequired
+	}
+
+	options, session, err := s.webauthn.BeginLogin(user)
+	if err != nil {
+		return fmt.Errorf("failed to begin security key check: %w", err)
+	}
+	id, err := s.saveCeremony(ctx, &webauthnCeremony{
+		Kind:       ceremonySecondFactor,
+		Session:    *session,
+		UserID:     account.UserID,
+		Role:       account.Role,
+		FacilityID: account.FacilityID,
+		DeviceID:   req.DeviceID,
+		ClientID:   req.ClientID,
+	})
+	if err != nil {
+		return err
+	}
+	return &SecondFactorRequired{CeremonyID: id, Options: options}
+}
+
+// FinishLogin verifies an assertion for a passwordless login or a
+// password login's second factor, and issues tokens
+func (s *WebAuthnService) FinishLogin(ctx context.Context, ceremonyID string, r *http.Request, ipAddress string) (*TokenPair, error) {
+	ceremony, err := s.takeCeremony(ctx, ceremonyID, ceremonyLogin, ceremonySecondFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *webauthnUser
+	var credential *webauthn.Credential
+	if ceremony.Kind == ceremonySecondFactor {
+		user, err = s.loadUser(ctx, ceremony.UserID)
+		if err != nil {
+			return nil, err
+		}
+		credential, err = s.webauthn.FinishLogin(user, ceremony.Session, r)
+	} else {
+		credential, err = s.webauthn.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			u, err := s.loadUser(ctx, string(userHandle))
+			if err != nil {
+				return nil, err
+			}
+			if len(u.Keys) == 0 {
+				return nil, ErrSecurityKeyNotFound
+			}
+			user = u
+			return u, nil
+		}, ceremony.Session, r)
+	}
+	userID := ceremony.UserID
+	if user != nil {
+		userID = user.UserID
+	}
+	if err != nil {
+		s.audit(ctx, userID, "webauthn_login", ipAddress, ceremony.DeviceID, err)
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	// A signature counter that went backwards means the key was cloned
+	if credential.Authenticator.CloneWarning {
+		err := fmt.Errorf("%w: possible cloned authenticator", ErrWebAuthnFailed)
+		s.audit(ctx, userID, "webauthn_login", ipAddress, ceremony.DeviceID, err)
+		return nil, err
+	}
+	now := time.Now()
+	for _, k := range user.Keys {
+		if bytes.Equal(k.Credential.ID, credential.ID) {
+			k.Credential.Authenticator.SignCount = credential.Authenticator.SignCount
+			k.LastUsedAt = &now
+		}
+	}
+	if err := s.saveUser(ctx, user); err != nil {
+		s.logger.Error("failed to update security key",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	role, facilityID := ceremony.Role, ceremony.FacilityID
+	if ceremony.Kind == ceremonyLogin {
+		role, facilityID = user.Role, user.FacilityID
+		if s.directory != nil {
+			role, facilityID, err = s.directory.LookupUser(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up user: %w", err)
+			}
+		}
+	}
+	s.audit(ctx, userID, "webauthn_login", ipAddress, ceremony.DeviceID, nil)
+	return s.auth.GenerateClientTokenPair(ctx, ceremony.ClientID, userID, role, facilityID, ceremony.DeviceID, ipAddress)
+}
+
+// loadUser returns a user's security keys; a user without any has none
+func (s *WebAuthnService) loadUser(ctx context.Context, userID string) (*webauthnUser, error) {
+	data, err := s.redis.Get(ctx, webauthnUserKey(userID)).Bytes()
+	if err == redis.Nil {
+		return &webauthnUser{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load security keys: %w", err)
+	}
+	var user webauthnUser
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal security keys: %w", err)
+	}
+	return &user, nil
+}
+
+// saveUser stores a user's security keys
+func (s *WebAuthnService) saveUser(ctx context.Context, user *webauthnUser) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal security keys: %w", err)
+	}
+	if err := s.redis.Set(ctx, webauthnUserKey(user.UserID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store security keys: %w", err)
+	}
+	return nil
+}
+
+// saveCeremony keeps a ceremony until it is finished or expires
+func (s *WebAuthnService) saveCeremony(ctx context.Context, ceremony *webauthnCeremony) (string, error) {
+	id, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(ceremony)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ceremony: %w", err)
+	}
+	if err := s.redis.Set(ctx, webauthnCeremonyKey(id), data, webauthnCeremonyTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store ceremony: %w", err)
+	}
+	return id, nil
+}
+
+// takeCeremony consumes a ceremony of one of the given kinds, so each
+// challenge is answered at most once
+func (s *WebAuthnService) takeCeremony(ctx context.Context, id string, kinds ...string) (*webauthnCeremony, error) {
+	data, err := s.redis.GetDel(ctx, webauthnCeremonyKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCeremonyExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ceremony: %w", err)
+	}
+	var ceremony webauthnCeremony
+	if err := json.Unmarshal(data, &ceremony); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ceremony: %w", err)
+	}
+	if !slices.Contains(kinds, ceremony.Kind) {
+		return nil, ErrCeremonyExpired
+	}
+	return &ceremony, nil
+}
+
+// audit records a security key event
+func (s *WebAuthnService) audit(ctx context.Context, userID, eventType, ipAddress, deviceID string, err error) {
+	if err != nil {
+		s.logger.Warn("security key ceremony failed",
+			slog.String("user_id", userID),
+			slog.String("event", eventType),
+			slog.String("error", err.Error()),
+		)
+	}
+	if s.auth.auditLogger == nil {
+		return
+	}
+	event := &AuthEvent{
+		Timestamp: time.Now(),
+		UserID:    userID,
+		EventType: eventType,
+		IPAddress: ipAddress,
+		DeviceID:  deviceID,
+		Success:   err == nil,
+	}
+	if err != nil {
+		event.FailReason = err.Error()
+	}
+	s.auth.auditLogger.LogAuthentication(ctx, event)
+}
+
+// LoginBeginHandler starts a passwordless login. It is served without
+// authentication.
+func (s *WebAuthnService) LoginBeginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		options, ceremonyID, err := s.BeginLogin(c.Request.Context(), c.Query("device_id"), c.Query("client_id"))
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+	}
+}
+
+// LoginFinishHandler finishes a passwordless login or a password login's
+// second factor. The body is the authenticator's assertion, and the
+// ceremony_id query parameter names the challenge it answers. It is served
+// without authentication.
+func (s *WebAuthnService) LoginFinishHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens, err := s.FinishLogin(c.Request.Context(), c.Query("ceremony_id"), c.Request, c.ClientIP())
+		if writeLoginRefusal(c, err) {
+			return
+		}
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// RegisterWebAuthnRoutes mounts security key management for the caller.
+// The group must already run AuthMiddleware.
+//
+//	GET    /webauthn/credentials          the caller's keys
+//	POST   /webauthn/register             begin registering a key (?name=)
+//	POST   /webauthn/register/finish      finish, with the attestation (?ceremony_id=)
+//	DELETE /webauthn/credentials/:id
+func (s *WebAuthnService) RegisterWebAuthnRoutes(r gin.IRouter) {
+	keys := r.Group("/webauthn", s.auth.RequireHuman())
+
+	keys.GET("/credentials", func(c *gin.Context) {
+		claims, ok := webauthnCaller(c)
+		if !ok {
+			return
+		}
+		list, err := s.ListKeys(c.Request.Context(), claims.UserID)
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"credentials": list})
+	})
+
+	keys.POST("/register", func(c *gin.Context) {
+		claims, ok := webauthnCaller(c)
+		if !ok {
+			return
+		}
+		options, ceremonyID, err := s.BeginRegistration(c.Request.Context(), claims, c.Query("name"))
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+	})
+
+	keys.POST("/register/finish", func(c *gin.Context) {
+		claims, ok := webauthnCaller(c)
+		if !ok {
+			return
+		}
+		key, err := s.FinishRegistration(c.Request.Context(), claims, c.Query("ceremony_id"), c.Request, c.ClientIP())
+		if err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, key)
+	})
+
+	keys.DELETE("/credentials/:id", func(c *gin.Context) {
+		claims, ok := webauthnCaller(c)
+		if !ok {
+			return
+		}
+		if err := s.RemoveKey(c.Request.Context(), claims, c.Param("id"), c.ClientIP()); err != nil {
+			s.writeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// webauthnCaller returns the caller's claims. Impersonators can't manage
+// the user's keys.
+func webauthnCaller(c *gin.Context) (*Claims, bool) {
+	claims, err := GetClaimsFromContext(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return nil, false
+	}
+	if claims.IsImpersonation() || claims.IsGuest() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "security keys can't be managed from this session"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// writeError answers a failed WebAuthn request
+func (s *WebAuthnService) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCeremonyExpired), errors.Is(err, ErrUnknownTokenClient),
+		errors.Is(err, ErrTooManySecurityKeys):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrWebAuthnFailed):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrWebAuthnFailed.Error()})
+	case errors.Is(err, ErrAttestationRejected), errors.Is(err, ErrLastSecurityKey):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrSecurityKeyNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		s.logger.Error("security key request failed",
+			slog.String("error", err.Error()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "security keys unavailable"})
+	}
+}
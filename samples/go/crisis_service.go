@@ -45,6 +45,8 @@ type CrisisAlert struct {
 	AssignedTo      []string               `json:"assigned_to"`
 	Acknowledgments []Acknowledgment       `json:"acknowledgments"`
 	Escalations     []Escalation           `json:"escalations"`
+	FacilityID      string                 `json:"facility_id,omitempty"`
+	Guest           bool                   `json:"guest,omitempty"` // Pre-enrollment guest; see initiateGuestResponse
 }
 
 // AlertStatus represents the current state of a crisis alert
@@ -77,11 +79,12 @@ type Escalation struct {
 
 // CrisisServiceConfig contains configuration for the crisis service
 type CrisisServiceConfig struct {
-	ResponseTimeouts  map[CrisisLevel]time.Duration
-	EscalationDelays  map[CrisisLevel]time.Duration
-	MaxRetries        int
-	RetryDelay        time.Duration
-	Enable911AutoCall bool
+	ResponseTimeouts    map[CrisisLevel]time.Duration
+	EscalationDelays    map[CrisisLevel]time.Duration
+	MaxRetries          int
+	RetryDelay          time.Duration
+	Enable911AutoCall   bool
+	GuestEscalationRole string // On-call role alerted for guests, who have no care team
 }
 
 // DefaultCrisisConfig returns regulatory-compliant default configuration
@@ -99,9 +102,10 @@ func DefaultCrisisConfig() *CrisisServiceConfig {
 			CrisisLevelElevated:  30 * time.Minute,
 			CrisisLevelModerate:  12 * time.Hour,
 		},
-		MaxRetries:        3,
-		RetryDelay:        5 * time.Second,
-		Enable911AutoCall: true,
+		MaxRetries:          3,
+		RetryDelay:          5 * time.Second,
+		Enable911AutoCall:   true,
+		GuestEscalationRole: "front_desk",
 	}
 }
 
@@ -114,6 +118,7 @@ type CrisisService struct {
 	detector        CrisisDetector
 	careTeamService CareTeamService
 	auditLogger     AuditLogger
+	consent         ConsentChecker // Optional; without it only legal proxies are notified
 
 	// Active alerts by ID
 	activeAlerts sync.Map
@@ -147,6 +152,16 @@ type CareTeamService interface {
 	GetEmergencyContacts(ctx context.Context, residentID string) ([]EmergencyContact, error)
 }
 
+// ConsentChecker reports whether a resident's consent for a purpose is in
+// force
+type ConsentChecker interface {
+	CheckConsent(ctx context.Context, residentID, purpose, granteeID string) (bool, error)
+}
+
+// consentEmergencyContact is the consent purpose covering notification of
+// emergency contacts
+const consentEmergencyContact = "emergency_contact_notification"
+
 // AIRouterClient defines the gRPC interface for the AI router
 type AIRouterClient interface {
 	AnalyzeCrisis(ctx context.Context, req *CrisisAnalysisRequest) (*CrisisAnalysisResponse, error)
@@ -162,6 +177,8 @@ type AuditLogger interface {
 type DetectionContext struct {
 	UserID           string
 	SessionID        string
+	FacilityID       string
+	Guest            bool // Pre-enrollment guest session
 	RecentMessages   []string
 	PHQ9Score        *int
 	GAD7Score        *int
@@ -289,6 +306,12 @@ func NewCrisisService(
 	return svc
 }
 
+// SetConsentChecker makes emergency contact notification follow the
+// resident's consent
+func (s *CrisisService) SetConsentChecker(checker ConsentChecker) {
+	s.consent = checker
+}
+
 // AnalyzeMessage analyzes a message for crisis indicators
 func (s *CrisisService) AnalyzeMessage(ctx context.Context, message string, detectionCtx *DetectionContext) (*CrisisAlert, error) {
 	startTime := time.Now()
@@ -336,6 +359,8 @@ func (s *CrisisService) AnalyzeMessage(ctx context.Context, message string, dete
 		ClinicalContext:  make(map[string]interface{}),
 		Timestamp:        time.Now(),
 		Status:           AlertStatusActive,
+		FacilityID:       detectionCtx.FacilityID,
+		Guest:            detectionCtx.Guest,
 	}
 
 	// Set response deadline
@@ -379,6 +404,11 @@ func (s *CrisisService) initiateResponse(alert *CrisisAlert) {
 	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Minute)
 	defer cancel()
 
+	if alert.Guest {
+		s.initiateGuestResponse(ctx, alert)
+		return
+	}
+
 	// Get care team
 	careTeam, err := s.careTeamService.GetCareTeam(ctx, alert.UserID)
 	if err != nil {
@@ -437,6 +467,56 @@ func (s *CrisisService) initiateResponse(alert *CrisisAlert) {
 	}
 }
 
+// initiateGuestResponse alerts the facility front desk to a crisis in a
+// guest session. Guests have no care team, emergency contacts or verified
+// identity, so there is no 911 auto-escalation; front desk staff are on
+// site and decide whether to call.
+func (s *CrisisService) initiateGuestResponse(ctx context.Context, alert *CrisisAlert) {
+	staff, err := s.careTeamService.GetOnCallStaff(ctx, alert.FacilityID, s.config.GuestEscalationRole)
+	if err != nil {
+		s.logger.Error("failed to get front desk staff for guest crisis",
+			slog.String("error", err.Error()),
+			slog.String("facility_id", alert.FacilityID),
+		)
+	}
+
+	recipients := &NotificationRecipients{}
+	for _, member := range staff {
+		recipients.UserIDs = append(recipients.UserIDs, member.UserID)
+		if member.Phone != "" {
+			recipients.PhoneNumbers = append(recipients.PhoneNumbers, member.Phone)
+		}
+	}
+	alert.AssignedTo = recipients.UserIDs
+
+	if err := s.notifier.SendPush(ctx, recipients.UserIDs, alert); err != nil {
+		s.logger.Error("failed to send push notifications",
+			slog.String("error", err.Error()),
+		)
+	}
+	if (alert.Level == CrisisLevelImmediate || alert.Level == CrisisLevelUrgent) && len(recipients.PhoneNumbers) > 0 {
+		message := fmt.Sprintf(
+			"CRISIS ALERT: A guest using the companion demo needs attention now. Level: %s. Please go to them immediately.",
+			alert.Level,
+		)
+		s.notifier.SendSMS(ctx, recipients.PhoneNumbers, message)
+	}
+
+	if s.auditLogger != nil {
+		s.auditLogger.LogCrisisEvent(ctx, &CrisisAuditEvent{
+			Timestamp: time.Now(),
+			AlertID:   alert.ID,
+			UserID:    alert.UserID,
+			EventType: "response_initiated",
+			Details: map[string]interface{}{
+				"level":      alert.Level,
+				"recipients": recipients.UserIDs,
+				"guest":      true,
+			},
+		})
+	}
+}
+
 // NotificationRecipients contains recipients for notifications
 type NotificationRecipients struct {
 	UserIDs      []string
@@ -525,7 +605,8 @@ func (s *CrisisService) monitorFor911Escalation(alert *CrisisAlert) {
 	}
 }
 
-// notifyEmergencyContacts notifies emergency contacts
+// notifyEmergencyContacts notifies emergency contacts. Legal proxies are
+// always told; other contacts only with the resident's consent.
 func (s *CrisisService) notifyEmergencyContacts(ctx context.Context, alert *CrisisAlert) {
 	contacts, err := s.careTeamService.GetEmergencyContacts(ctx, alert.UserID)
 	if err != nil {
@@ -535,7 +616,22 @@ func (s *CrisisService) notifyEmergencyContacts(ctx context.Context, alert *Cris
 		return
 	}
 
+	consented := false
+	if s.consent != nil {
+		consented, err = s.consent.CheckConsent(ctx, alert.UserID, consentEmergencyContact, "")
+		if err != nil {
+			s.logger.Error("failed to check emergency contact consent; notifying legal proxies only",
+				slog.String("alert_id", alert.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
 	for _, contact := range contacts {
+		if !contact.IsLegalProxy && !consented {
+			continue
+		}
+
 		// SMS notification
 		if contact.Phone != "" {
 			message := fmt.Sprintf(
@@ -3,41 +3,33 @@
 // and crisis alert broadcasting.
 package streaming
 
+//go:generate buf generate
+
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// ChatMessage represents a message in a therapeutic conversation
-type ChatMessage struct {
-	ID            string                 `json:"id"`
-	SessionID     string                 `json:"session_id"`
-	UserID        string                 `json:"user_id"`
-	Role          MessageRole            `json:"role"`
-	Content       string                 `json:"content"`
-	Timestamp     time.Time              `json:"timestamp"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
-	AgentType     string                 `json:"agent_type,omitempty"`
-	CrisisLevel   string                 `json:"crisis_level,omitempty"`
-	IsStreaming   bool                   `json:"is_streaming"`
-	StreamIndex   int32                  `json:"stream_index"`
-	IsFinal       bool                   `json:"is_final"`
-}
+// Wire types (ChatMessage, VoiceRequest, CrisisAlert, ...) and service
+// registration are generated from proto/grpc_streaming.proto
 
 // MessageRole defines the role of a message sender
-type MessageRole string
+type MessageRole = string
 
 const (
 	RoleUser      MessageRole = "user"
@@ -49,12 +41,30 @@ const (
 type StreamState struct {
 	SessionID     string
 	UserID        string
+	FacilityID    string
+	Guest         bool // Pre-enrollment guest, who has no care team
 	StartedAt     time.Time
-	LastActivity  time.Time
+	LastActivity  time.Time // Last resident message; guarded by mu
 	MessageCount  int64
 	IsActive      bool
 	CurrentAgent  string
 	CrisisStatus  string
+
+	// Language is the resident's detected language, empty until the
+	// translator sees a message; guarded by mu
+	Language string
+
+	// Crisis mode suspends normal agents until the care team resolves the
+	// crisis; guarded by mu along with CrisisStatus
+	CrisisMode      bool
+	CrisisModeSince time.Time
+
+	mu               sync.Mutex
+	cancelGeneration context.CancelCauseFunc
+
+	usage   *usageMeter
+	parties *sessionParties
+	worker  *messageWorker
 }
 
 // TherapeuticStreamServer implements bidirectional streaming for therapeutic chat
@@ -66,7 +76,22 @@ type TherapeuticStreamServer struct {
 	aiRouter      AIRouterClient
 	crisisService CrisisService
 	sessions      sync.Map // map[sessionID]*StreamState
-	streams       sync.Map // map[sessionID]grpc.ServerStream
+	replay        *replayLog
+	usage         *UsageTracker
+	history       MessageStore
+	flow          *FlowControlConfig
+	rateLimits    *RateLimitConfig
+	summarizer    *SessionSummarizer
+	translator    Translator
+	embedder      Embedder
+	responseCache *ResponseCacheConfig
+	routing       *RoutingEngine
+	guardrails    *GuardrailConfig
+	idle          *IdleConfig
+	callers       CallerResolver
+	access        SessionAccess
+	instanceID    string
+	routerOnce    sync.Once
 
 	// Metrics
 	activeStreams   int64
@@ -74,14 +99,13 @@ type TherapeuticStreamServer struct {
 	avgResponseTime time.Duration
 }
 
-// UnimplementedTherapeuticServiceServer for forward compatibility
-type UnimplementedTherapeuticServiceServer struct{}
-
 // AIRouterClient interface for AI router communication
 type AIRouterClient interface {
 	StreamGenerate(ctx context.Context, req *GenerateRequest) (<-chan *GenerateChunk, error)
 	AnalyzeCrisis(ctx context.Context, message string, context *CrisisContext) (*CrisisResult, error)
 	ClassifyIntent(ctx context.Context, message string) (*IntentResult, error)
+	SummarizeSession(ctx context.Context, req *SummaryRequest) (*SummaryResult, error)
+	AnalyzeEmotion(ctx context.Context, message string) (*EmotionResult, error)
 }
 
 // CrisisService interface for crisis management
@@ -90,6 +114,27 @@ type CrisisService interface {
 	NotifyTeam(ctx context.Context, userID string, level string) error
 }
 
+// Caller is what a stream's verified token says about the caller
+type Caller struct {
+	UserID     string // The token's subject
+	FacilityID string
+	Guest      bool            // Pre-enrollment guest, who has no care team
+	Role       ParticipantRole // Mapped from the token's role; empty if it can't take part in chats
+}
+
+// CallerResolver reads the caller from a stream's context, as verified by
+// the auth package's stream interceptor (auth.ClaimsFromContext)
+type CallerResolver interface {
+	ResolveCaller(ctx context.Context) (*Caller, error)
+}
+
+// SessionAccess decides whether a verified clinician or family member may
+// join a resident's session, e.g. through auth.Authorizer's care team and
+// family link checks. A nil error allows the join.
+type SessionAccess interface {
+	AuthorizeJoin(ctx context.Context, caller *Caller, residentID string) error
+}
+
 // GenerateRequest for AI generation
 type GenerateRequest struct {
 	SessionID    string
@@ -135,15 +180,6 @@ type CrisisResult struct {
 	Action     string
 }
 
-// CrisisAlert for reporting
-type CrisisAlert struct {
-	UserID    string
-	SessionID string
-	Level     string
-	Message   string
-	Timestamp time.Time
-}
-
 // IntentResult from intent classification
 type IntentResult struct {
 	Intent     string
@@ -157,15 +193,47 @@ func NewTherapeuticStreamServer(
 	logger *slog.Logger,
 	aiRouter AIRouterClient,
 	crisisService CrisisService,
+	usage *UsageTracker,
+	history MessageStore,
+	summarizer *SessionSummarizer,
 ) *TherapeuticStreamServer {
 	return &TherapeuticStreamServer{
 		redis:         redis,
 		logger:        logger,
 		aiRouter:      aiRouter,
 		crisisService: crisisService,
+		replay:        &replayLog{redis: redis},
+		usage:         usage,
+		history:       history,
+		summarizer:    summarizer,
+		flow:          DefaultFlowControlConfig(),
+		rateLimits:    DefaultRateLimitConfig(),
+		guardrails:    DefaultGuardrailConfig(),
+		idle:          DefaultIdleConfig(),
+		instanceID:    uuid.New().String(),
 	}
 }
 
+// SetFlowControl replaces the outbound flow control settings. It must be
+// called before the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetFlowControl(config *FlowControlConfig) {
+	s.flow = config
+}
+
+// SetCallerResolver takes the caller's facility, guest status and
+// participant role from their verified token rather than metadata. It must
+// be called before the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetCallerResolver(resolver CallerResolver) {
+	s.callers = resolver
+}
+
+// SetSessionAccess checks clinicians and family against the resident
+// before they join a session. Joining needs both this and a caller
+// resolver. It must be called before the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetSessionAccess(access SessionAccess) {
+	s.access = access
+}
+
 // Chat implements bidirectional streaming for therapeutic conversations
 func (s *TherapeuticStreamServer) Chat(stream grpc.BidiStreamingServer[ChatMessage, ChatMessage]) error {
 	ctx := stream.Context()
@@ -178,25 +246,83 @@ func (s *TherapeuticStreamServer) Chat(stream grpc.BidiStreamingServer[ChatMessa
 
 	sessionID := extractMetadata(md, "session-id")
 	userID := extractMetadata(md, "user-id")
+	facilityID := extractMetadata(md, "facility-id")
 
 	if sessionID == "" || userID == "" {
 		return status.Error(codes.InvalidArgument, "session-id and user-id required")
 	}
 
+	var caller *Caller
+	var guest bool
+	if s.callers != nil {
+		var err error
+		caller, err = s.callers.ResolveCaller(ctx)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, "caller not verified")
+		}
+		facilityID, guest = caller.FacilityID, caller.Guest
+	}
+
+	// Clinicians and family join the resident's session. Their role comes
+	// from their token, so unverified callers can't join.
+	if caller == nil {
+		if role := ParticipantRole(extractMetadata(md, "participant-role")); role != "" && role != ParticipantResident {
+			return status.Error(codes.PermissionDenied, "joining a session requires a verified caller")
+		}
+	} else if caller.Role != ParticipantResident {
+		return s.joinSession(stream, md, sessionID, userID, caller)
+	}
+
+	// Checked before anything is replayed or the session is taken over
+	if err := s.claimSessionOwner(ctx, sessionID, userID); err != nil {
+		if errors.Is(err, ErrSessionOwned) {
+			s.logger.Warn("session claimed by another user",
+				slog.String("session_id", sessionID),
+				slog.String("user_id", userID),
+			)
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		s.logger.Error("failed to claim session",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return status.Error(codes.Unavailable, "session unavailable")
+	}
+
+	release, err := s.acquireSessionSlot(ctx, stream, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// Initialize stream state
 	state := &StreamState{
 		SessionID:    sessionID,
 		UserID:       userID,
+		FacilityID:   facilityID,
+		Guest:        guest,
 		StartedAt:    time.Now(),
 		LastActivity: time.Now(),
 		IsActive:     true,
+		usage:        s.usage.meter(sessionID, userID, facilityID),
 	}
+	defer state.usage.close(ctx)
+	defer s.summarizeChat(ctx, state)
+	resident := &participant{
+		UserID:   userID,
+		Role:     ParticipantResident,
+		Mode:     ModeParticipant,
+		JoinedAt: state.StartedAt,
+		stream:   newSessionStream(stream, sessionID, sessionID, s.replay, s.flow, s.logger),
+	}
+	state.parties = newSessionParties(sessionID, resident)
 	s.sessions.Store(sessionID, state)
-	s.streams.Store(sessionID, stream)
+	defer s.locateSession(ctx, sessionID)()
 	defer func() {
 		state.IsActive = false
-		s.sessions.Delete(sessionID)
-		s.streams.Delete(sessionID)
+		// A reconnect may already have replaced this session's state
+		s.sessions.CompareAndDelete(sessionID, state)
+		state.parties.end()
 	}()
 
 	s.logger.Info("chat stream started",
@@ -204,14 +330,91 @@ func (s *TherapeuticStreamServer) Chat(stream grpc.BidiStreamingServer[ChatMessa
 		slog.String("user_id", userID),
 	)
 
+	return s.serveParticipant(ctx, md, resident, state, func() error {
+		return s.receiveMessages(ctx, stream, state)
+	})
+}
+
+// serveParticipant streams a session to one party until it disconnects,
+// falls too far behind, or the session ends. receive handles the party's
+// inbound messages.
+func (s *TherapeuticStreamServer) serveParticipant(
+	ctx context.Context,
+	md metadata.MD,
+	p *participant,
+	state *StreamState,
+	receive func() error,
+) error {
+	ss := p.stream
+	sessionID := state.SessionID
+
 	// Subscribe to Redis for external messages (crisis alerts, etc.)
 	pubsub := s.redis.Subscribe(ctx, fmt.Sprintf("session:%s:messages", sessionID))
 	defer pubsub.Close()
 
-	// Handle Redis messages in background
-	go s.handleRedisMessages(ctx, stream, pubsub)
+	// Replay anything a reconnecting client missed before going live.
+	// Messages published meanwhile wait in the subscription.
+	if last, ok := lastReceivedIndex(md); ok {
+		if err := ss.resume(ctx, last); err != nil {
+			s.logger.Error("failed to resume chat stream",
+				slog.String("error", err.Error()),
+				slog.String("session_id", sessionID),
+			)
+			return status.Error(codes.Unavailable, "failed to replay missed messages")
+		}
+	}
+
+	// Deliver outbound messages in background
+	go ss.run(ctx)
+
+	// Messages sent while the resident was away come before live traffic
+	if p.Role == ParticipantResident {
+		s.deliverOffline(ctx, p)
+	}
+
+	// Handle Redis messages and keepalives in background
+	go s.handleRedisMessages(ctx, p, state, pubsub)
+	go s.heartbeat(ctx, p, state)
+	idle := make(chan error, 1)
+	go s.watchIdle(ctx, p, state, idle)
+
+	// Process incoming messages until the client leaves or can't keep up
+	received := make(chan error, 1)
+	go func() {
+		received <- receive()
+	}()
+
+	select {
+	case err := <-received:
+		ss.close()
+		return err
+	case <-state.parties.ended:
+		ss.close()
+		return status.Error(codes.Unavailable, "session ended")
+	case err := <-idle:
+		ss.close()
+		return err
+	case <-ss.failed:
+		if errors.Is(ss.err, errBufferOverflow) || errors.Is(ss.err, errSendTimeout) {
+			return status.Error(codes.ResourceExhausted, ss.err.Error())
+		}
+		return ss.err
+	}
+}
+
+// receiveMessages processes incoming chat messages until the stream ends
+func (s *TherapeuticStreamServer) receiveMessages(
+	ctx context.Context,
+	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	state *StreamState,
+) error {
+	sessionID := state.SessionID
+
+	// Messages are processed in the background so a crisis disclosure is
+	// received even while a response is streaming
+	worker := s.startWorker(ctx, state)
+	defer worker.stop()
 
-	// Process incoming messages
 	for {
 		msg, err := stream.Recv()
 		if err == io.EOF {
@@ -228,17 +431,53 @@ func (s *TherapeuticStreamServer) Chat(stream grpc.BidiStreamingServer[ChatMessa
 			return err
 		}
 
+		// Heartbeat answers only show the client is alive
+		state.parties.resident.heard()
+		if msg.Metadata["type"] == controlHeartbeat {
+			continue
+		}
+
+		// Typing indicators are passed on, not processed
+		if msg.Metadata["type"] == controlTyping {
+			state.parties.sendExcept(typingMessage(sessionID, state.parties.resident), state.UserID)
+			continue
+		}
+
 		// Update state
-		state.LastActivity = time.Now()
+		state.touch()
 		state.MessageCount++
+		state.usage.add(ctx, Usage{Messages: 1})
+
+		// Let other parties see what the resident said
+		state.parties.sendExcept(&ChatMessage{
+			SessionId: sessionID,
+			UserId:    state.UserID,
+			Role:      RoleUser,
+			Content:   msg.Content,
+			Timestamp: timestamppb.Now(),
+			IsFinal:   true,
+			Metadata:  map[string]string{"participant_role": string(ParticipantResident)},
+		}, state.UserID)
+
+		if !s.allowMessage(ctx, state, state.parties.resident) {
+			// Kept in history so later responses still have it as context
+			s.recordMessage(ctx, &ChatMessage{
+				SessionId: sessionID,
+				UserId:    state.UserID,
+				Role:      RoleUser,
+				Content:   msg.Content,
+				Timestamp: timestamppb.Now(),
+				Metadata:  map[string]string{"rate_limited": "true"},
+				IsFinal:   true,
+			})
+			continue
+		}
 
-		// Process message
-		if err := s.processMessage(ctx, stream, msg, state); err != nil {
-			s.logger.Error("failed to process message",
-				slog.String("error", err.Error()),
-				slog.String("session_id", sessionID),
-			)
-			// Continue processing, don't break stream
+		s.trackMood(ctx, state, msg)
+
+		// Queue for processing; a response still streaming is superseded
+		if err := worker.submit(ctx, msg, state); err != nil {
+			return err
 		}
 	}
 }
@@ -246,91 +485,271 @@ func (s *TherapeuticStreamServer) Chat(stream grpc.BidiStreamingServer[ChatMessa
 // processMessage handles an incoming chat message
 func (s *TherapeuticStreamServer) processMessage(
 	ctx context.Context,
-	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
 	msg *ChatMessage,
 	state *StreamState,
 ) error {
 	startTime := time.Now()
 
+	// Residents writing in another language are answered in it; analysis
+	// and generation work from the English translation
+	turn := s.translateInbound(ctx, state, msg.Content)
+
+	// History is loaded before this message is recorded so it only holds
+	// earlier turns
+	history := englishHistory(s.recentHistory(ctx, state.SessionID))
+	inbound := &ChatMessage{
+		SessionId: state.SessionID,
+		UserId:    state.UserID,
+		Role:      RoleUser,
+		Content:   msg.Content,
+		Timestamp: timestamppb.Now(),
+		Metadata:  msg.Metadata,
+		IsFinal:   true,
+	}
+	if turn.language != "" {
+		annotateTranslation(inbound, turn.language, turn.english)
+	}
+	s.recordMessage(ctx, inbound)
+
 	// Crisis check first (safety-first architecture)
-	crisisResult, err := s.aiRouter.AnalyzeCrisis(ctx, msg.Content, &CrisisContext{
-		RecentMessages: s.getRecentMessages(ctx, state.SessionID),
+	crisisResult, err := s.aiRouter.AnalyzeCrisis(ctx, turn.english, &CrisisContext{
+		RecentMessages: recentContents(history),
 	})
 	if err != nil {
-		s.logger.Error("crisis analysis failed",
-			slog.String("error", err.Error()),
-		)
+		s.reportError(state, ComponentCrisisAnalysis, err, "")
 	} else if crisisResult.Level != "" && crisisResult.Level != "NONE" {
 		// Report crisis
 		s.crisisService.ReportCrisis(ctx, &CrisisAlert{
-			UserID:    state.UserID,
-			SessionID: state.SessionID,
-			Level:     crisisResult.Level,
-			Message:   msg.Content,
-			Timestamp: time.Now(),
+			UserId:     state.UserID,
+			SessionId:  state.SessionID,
+			Level:      crisisResult.Level,
+			Message:    turn.english,
+			Timestamp:  timestamppb.Now(),
+			FacilityId: state.FacilityID,
+			Guest:      state.Guest,
 		})
 
+		// Severe crises get the protocol response instead of generated content
+		if interruptsGeneration(crisisResult.Level) {
+			return s.interruptForCrisis(ctx, state, crisisResult.Level)
+		}
+
 		// Send crisis acknowledgment
+		_, acknowledgment := state.crisisNotices()
 		crisisMsg := &ChatMessage{
-			SessionID:   state.SessionID,
-			UserID:      state.UserID,
+			SessionId:   state.SessionID,
+			UserId:      state.UserID,
 			Role:        RoleSystem,
-			Content:     "I'm concerned about what you've shared. Your care team has been notified and will reach out shortly.",
-			Timestamp:   time.Now(),
+			Content:     acknowledgment,
+			Timestamp:   timestamppb.Now(),
 			CrisisLevel: crisisResult.Level,
 			IsFinal:     true,
 		}
-		if err := stream.Send(crisisMsg); err != nil {
+		s.localizeNotice(ctx, state, crisisMsg)
+		s.recordMessage(ctx, crisisMsg)
+		if err := state.parties.send(crisisMsg); err != nil {
 			return err
 		}
 	}
 
 	// Classify intent to determine agent
-	intentResult, err := s.aiRouter.ClassifyIntent(ctx, msg.Content)
+	intentResult, err := s.aiRouter.ClassifyIntent(ctx, turn.english)
 	if err != nil {
-		s.logger.Error("intent classification failed",
-			slog.String("error", err.Error()),
-		)
+		s.reportError(state, ComponentIntent, err, FallbackDefaultAgent)
 		intentResult = &IntentResult{AgentType: "conversational"}
 	}
 
+	// Sessions in crisis mode stay with the supervised crisis agent; outside
+	// it pins, hooks and facility rules may override the classifier
+	routing := s.routeAgent(ctx, state, turn.english, intentResult)
+	intentResult.AgentType = routing.AgentType
+
+	if previous := state.CurrentAgent; previous != "" && previous != intentResult.AgentType {
+		state.parties.send(controlMessage(state.SessionID, controlAgentSwitch, map[string]string{
+			"from": previous,
+			"to":   intentResult.AgentType,
+		}))
+	}
 	state.CurrentAgent = intentResult.AgentType
 
-	// Stream AI response
-	chunks, err := s.aiRouter.StreamGenerate(ctx, &GenerateRequest{
+	// Stream AI response; a crisis interrupt cancels genCtx
+	genCtx, done := state.beginGeneration(ctx)
+	defer done()
+
+	// Checked after registering the cancel func so a message arriving now
+	// either cancels this generation or is seen here
+	if state.worker.hasNewer() {
+		s.logger.Info("response superseded before generation",
+			slog.String("session_id", state.SessionID),
+		)
+		return nil
+	}
+
+	// Repeated benign prompts are answered from the resident's cache
+	var probe *cacheProbe
+	if s.cacheable(state, turn.english, crisisResult, intentResult, history) {
+		var hit *cachedResponse
+		if hit, probe = s.probeCache(ctx, state, turn.english, intentResult); hit != nil {
+			return s.sendCachedResponse(ctx, state, turn, routing, hit)
+		}
+	}
+
+	state.parties.send(controlMessage(state.SessionID, controlThinking, map[string]string{
+		"agent_type": intentResult.AgentType,
+	}))
+
+	chunks, err := s.aiRouter.StreamGenerate(genCtx, &GenerateRequest{
 		SessionID:    state.SessionID,
 		UserID:       state.UserID,
-		Message:      msg.Content,
+		Message:      turn.english,
 		AgentType:    intentResult.AgentType,
 		StreamTokens: true,
+		Context: &ConversationContext{
+			History: contextWindow(history, contextTokenBudget),
+		},
 	})
 	if err != nil {
+		if genCtx.Err() != nil {
+			return s.endInterruptedResponse(ctx, state, 0, context.Cause(genCtx))
+		}
+		s.reportError(state, ComponentGeneration, err, "")
 		return fmt.Errorf("generation failed: %w", err)
 	}
 
+	// Tokens are billed and the complete response stored even when it is
+	// cut short
+	var tokens int64
+	var response strings.Builder
+	var localized string
+	guard := s.newResponseGuard()
+	defer func() {
+		if tokens > 0 {
+			state.usage.add(ctx, Usage{Tokens: tokens})
+		}
+		s.recordGuardrailTriggers(ctx, state, intentResult.AgentType, guard)
+		if response.Len() > 0 {
+			stored := &ChatMessage{
+				SessionId: state.SessionID,
+				UserId:    state.UserID,
+				Role:      RoleAssistant,
+				Content:   response.String(),
+				Timestamp: timestamppb.Now(),
+				AgentType: intentResult.AgentType,
+				IsFinal:   true,
+			}
+			stored.Metadata = routing.metadata()
+			if genCtx.Err() != nil {
+				stored.Metadata["interrupted"] = "true"
+			}
+			guard.annotate(stored)
+			if localized != "" {
+				annotateTranslation(stored, turn.language, stored.Content)
+				stored.Content = localized
+			}
+			s.recordMessage(ctx, stored)
+		}
+	}()
+
 	// Stream response chunks to client
 	var streamIndex int32 = 0
-	for chunk := range chunks {
+	for {
+		var chunk *GenerateChunk
+		var ok bool
+		select {
+		case <-genCtx.Done():
+			return s.endInterruptedResponse(ctx, state, streamIndex, context.Cause(genCtx))
+		case chunk, ok = <-chunks:
+		}
+		if !ok {
+			break
+		}
+		tokens += int64(chunk.TokenCount)
+
+		// Text reaches the resident only after the guardrails scan it
+		content, blocked := guard.push(chunk.Content, chunk.IsFinal)
+		if blocked {
+			fallback, err := s.replaceResponse(ctx, state, streamIndex, intentResult.AgentType)
+			response.Reset()
+			response.WriteString(englishContent(fallback))
+			if _, ok := fallback.Metadata[metaEnglishText]; ok {
+				localized = fallback.Content
+			}
+			return err
+		}
+		response.WriteString(content)
+
+		// A translated response is sent whole once generation finishes
+		if turn.language != "" || (content == "" && !chunk.IsFinal) {
+			continue
+		}
+
 		responseMsg := &ChatMessage{
-			SessionID:   state.SessionID,
-			UserID:      state.UserID,
+			SessionId:   state.SessionID,
+			UserId:      state.UserID,
 			Role:        RoleAssistant,
-			Content:     chunk.Content,
-			Timestamp:   time.Now(),
+			Content:     content,
+			Timestamp:   timestamppb.Now(),
 			AgentType:   chunk.AgentType,
 			IsStreaming: !chunk.IsFinal,
 			StreamIndex: streamIndex,
 			IsFinal:     chunk.IsFinal,
-			Metadata:    chunk.Metadata,
+			Metadata:    stringMetadata(chunk.Metadata),
 		}
 
-		if err := stream.Send(responseMsg); err != nil {
+		if err := state.parties.send(responseMsg); err != nil {
 			return fmt.Errorf("failed to send chunk: %w", err)
 		}
 
 		streamIndex++
 	}
 
+	// Text still held back if generation ended without a final chunk
+	if rest, _ := guard.push("", true); rest != "" {
+		response.WriteString(rest)
+		if turn.language == "" {
+			if err := state.parties.send(&ChatMessage{
+				SessionId:   state.SessionID,
+				UserId:      state.UserID,
+				Role:        RoleAssistant,
+				Content:     rest,
+				Timestamp:   timestamppb.Now(),
+				AgentType:   intentResult.AgentType,
+				StreamIndex: streamIndex,
+				IsFinal:     true,
+			}); err != nil {
+				return fmt.Errorf("failed to send chunk: %w", err)
+			}
+		}
+	}
+
+	if turn.language != "" && response.Len() > 0 {
+		text, ok := s.translateOutbound(genCtx, state.SessionID, turn.language, response.String())
+		if genCtx.Err() != nil {
+			return s.endInterruptedResponse(ctx, state, 0, context.Cause(genCtx))
+		}
+		responseMsg := &ChatMessage{
+			SessionId: state.SessionID,
+			UserId:    state.UserID,
+			Role:      RoleAssistant,
+			Content:   text,
+			Timestamp: timestamppb.Now(),
+			AgentType: intentResult.AgentType,
+			IsFinal:   true,
+		}
+		if ok {
+			localized = text
+			responseMsg.Metadata = map[string]string{metaLanguage: turn.language}
+		}
+		if err := state.parties.send(responseMsg); err != nil {
+			return fmt.Errorf("failed to send response: %w", err)
+		}
+	}
+
+	// Only complete responses the guardrails left untouched are reused
+	if probe != nil && response.Len() > 0 && (guard == nil || len(guard.hits) == 0) {
+		s.storeCachedResponse(ctx, probe, response.String())
+	}
+
 	// Log response time
 	s.logger.Info("message processed",
 		slog.String("session_id", state.SessionID),
@@ -341,10 +760,12 @@ func (s *TherapeuticStreamServer) processMessage(
 	return nil
 }
 
-// handleRedisMessages handles messages from Redis pub/sub
+// handleRedisMessages handles messages from Redis pub/sub. Every party
+// subscribes for itself so it keeps receiving them if others disconnect.
 func (s *TherapeuticStreamServer) handleRedisMessages(
 	ctx context.Context,
-	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	p *participant,
+	state *StreamState,
 	pubsub *redis.PubSub,
 ) {
 	ch := pubsub.Channel()
@@ -354,15 +775,25 @@ func (s *TherapeuticStreamServer) handleRedisMessages(
 		case <-ctx.Done():
 			return
 		case redisMsg := <-ch:
-			var msg ChatMessage
-			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
+			msg := &ChatMessage{}
+			if err := redisJSON.Unmarshal([]byte(redisMsg.Payload), msg); err != nil {
 				s.logger.Error("failed to unmarshal Redis message",
 					slog.String("error", err.Error()),
 				)
 				continue
 			}
 
-			if err := stream.Send(&msg); err != nil {
+			// Escalations raised elsewhere stop any response being streamed
+			if p.Role == ParticipantResident && interruptsGeneration(msg.CrisisLevel) {
+				if err := s.interruptForCrisis(ctx, state, msg.CrisisLevel); err != nil {
+					s.logger.Error("failed to send crisis protocol response",
+						slog.String("error", err.Error()),
+					)
+					return
+				}
+			}
+
+			if err := p.deliver(msg); err != nil {
 				s.logger.Error("failed to send Redis message to stream",
 					slog.String("error", err.Error()),
 				)
@@ -372,25 +803,21 @@ func (s *TherapeuticStreamServer) handleRedisMessages(
 	}
 }
 
-// getRecentMessages retrieves recent messages for context
-func (s *TherapeuticStreamServer) getRecentMessages(ctx context.Context, sessionID string) []string {
-	key := fmt.Sprintf("session:%s:history", sessionID)
-	messages, err := s.redis.LRange(ctx, key, -10, -1).Result()
-	if err != nil {
-		return []string{}
-	}
-	return messages
-}
 
-// BroadcastToSession sends a message to a specific session
-func (s *TherapeuticStreamServer) BroadcastToSession(sessionID string, msg *ChatMessage) error {
-	streamI, ok := s.streams.Load(sessionID)
-	if !ok {
-		return errors.New("session not found")
-	}
+// redisJSON decodes messages published to Redis by other services. Both
+// snake_case and camelCase field names are accepted.
+var redisJSON = protojson.UnmarshalOptions{DiscardUnknown: true}
 
-	stream := streamI.(grpc.BidiStreamingServer[ChatMessage, ChatMessage])
-	return stream.Send(msg)
+// stringMetadata converts generation metadata to chat message metadata
+func stringMetadata(metadata map[string]interface{}) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
 }
 
 // extractMetadata extracts a value from gRPC metadata
@@ -410,11 +837,15 @@ type VoiceStreamServer struct {
 	sttClient  STTClient
 	ttsClient  TTSClient
 	aiRouter   AIRouterClient
+	crisis     CrisisService
+	usage      *UsageTracker
+	profiles   VoiceProfileStore
+	summarizer *SessionSummarizer
+	vad        VoiceActivityDetector
+	codecs     map[string]AudioCodec
+	ttsFormat  *AudioFormat
 }
 
-// UnimplementedVoiceServiceServer for forward compatibility
-type UnimplementedVoiceServiceServer struct{}
-
 // STTClient interface for speech-to-text
 type STTClient interface {
 	StreamTranscribe(ctx context.Context, audioStream <-chan []byte) (<-chan *TranscriptionResult, error)
@@ -422,7 +853,7 @@ type STTClient interface {
 
 // TTSClient interface for text-to-speech
 type TTSClient interface {
-	StreamSynthesize(ctx context.Context, text string, voice string) (<-chan []byte, error)
+	StreamSynthesize(ctx context.Context, text string, profile *VoiceProfile) (<-chan []byte, error)
 }
 
 // TranscriptionResult from STT
@@ -431,31 +862,7 @@ type TranscriptionResult struct {
 	IsFinal    bool
 	Confidence float64
 	Timestamp  time.Duration
-}
-
-// AudioChunk represents audio data
-type AudioChunk struct {
-	Data       []byte
-	Format     string // "wav", "opus", "webm"
-	SampleRate int
-	Channels   int
-	IsFinal    bool
-}
-
-// VoiceRequest for voice streaming
-type VoiceRequest struct {
-	SessionID string
-	UserID    string
-	Audio     *AudioChunk
-}
-
-// VoiceResponse from voice streaming
-type VoiceResponse struct {
-	SessionID    string
-	Transcription string
-	Response     string
-	Audio        *AudioChunk
-	IsFinal      bool
+	Speaker    string // Diarization label; empty unless the stream is diarized
 }
 
 // NewVoiceStreamServer creates a new voice streaming server
@@ -464,12 +871,26 @@ func NewVoiceStreamServer(
 	sttClient STTClient,
 	ttsClient TTSClient,
 	aiRouter AIRouterClient,
+	crisisService CrisisService,
+	usage *UsageTracker,
+	profiles VoiceProfileStore,
+	summarizer *SessionSummarizer,
 ) *VoiceStreamServer {
 	return &VoiceStreamServer{
-		logger:    logger,
-		sttClient: sttClient,
-		ttsClient: ttsClient,
-		aiRouter:  aiRouter,
+		logger:     logger,
+		sttClient:  sttClient,
+		ttsClient:  ttsClient,
+		aiRouter:   aiRouter,
+		crisis:     crisisService,
+		usage:      usage,
+		profiles:   profiles,
+		summarizer: summarizer,
+		vad:        NewEnergyVAD(),
+		codecs: map[string]AudioCodec{
+			"pcm": pcmCodec{},
+			"wav": wavCodec{},
+		},
+		ttsFormat: &AudioFormat{Format: "opus", SampleRate: 48000, Channels: 1},
 	}
 }
 
@@ -491,36 +912,87 @@ func (s *VoiceStreamServer) StreamVoice(stream grpc.BidiStreamingServer[VoiceReq
 		slog.String("user_id", userID),
 	)
 
+	// The first message may carry the client's playback capabilities
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	output, err := s.negotiateOutput(first.Capabilities)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if first.Capabilities != nil {
+		if err := stream.Send(&VoiceResponse{SessionId: sessionID, OutputFormat: output}); err != nil {
+			return err
+		}
+	}
+
+	meter := s.usage.meter(sessionID, userID, extractMetadata(md, "facility-id"))
+	defer meter.close(ctx)
+
+	voice := s.resolveVoiceProfile(ctx, userID)
+
+	transcript := &voiceTranscript{}
+	defer s.summarizer.sessionEnded(ctx, &SessionSummary{
+		SessionID:  sessionID,
+		UserID:     userID,
+		FacilityID: extractMetadata(md, "facility-id"),
+		Channel:    channelVoice,
+		StartedAt:  time.Now(),
+	}, transcript.snapshot)
+
 	// Channel for audio chunks
 	audioIn := make(chan []byte, 100)
 	defer close(audioIn)
 
-	// Start transcription stream
-	transcriptions, err := s.sttClient.StreamTranscribe(ctx, audioIn)
+	// Start transcription stream; group and family sessions are diarized so
+	// each turn is attributed to its speaker
+	speakers := &speakerMap{}
+	transcriptions, err := s.startTranscription(ctx, md, audioIn)
 	if err != nil {
+		s.sendVoiceError(stream, sessionID, ComponentTranscription, err, "", true)
 		return status.Error(codes.Internal, "failed to start transcription")
 	}
 
+	// Speaking over a response cuts it off; the audio keeps flowing to
+	// transcription so the interruption becomes the next turn
+	barge := &bargeIn{vad: s.vad}
+
 	// Process transcriptions and generate responses
-	go s.processTranscriptions(ctx, stream, sessionID, userID, transcriptions)
+	go s.processTranscriptions(ctx, stream, sessionID, userID, meter, barge, output, voice, speakers, transcript, transcriptions)
 
 	// Receive audio chunks
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			return nil
+	for req := first; ; {
+		if req.Preferences != nil {
+			s.switchVoice(ctx, userID, voice, req.Preferences)
 		}
-		if err != nil {
-			return err
+		if len(req.Speakers) > 0 {
+			speakers.assign(req.Speakers)
 		}
 
 		if req.Audio != nil && len(req.Audio.Data) > 0 {
+			if barge.observe(req.Audio) {
+				s.logger.Info("voice response interrupted by resident",
+					slog.String("session_id", sessionID),
+				)
+			}
 			select {
 			case audioIn <- req.Audio.Data:
 			default:
 				s.logger.Warn("audio buffer full, dropping chunk")
 			}
 		}
+
+		req, err = stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
 }
 
@@ -529,8 +1001,18 @@ func (s *VoiceStreamServer) processTranscriptions(
 	ctx context.Context,
 	stream grpc.BidiStreamingServer[VoiceRequest, VoiceResponse],
 	sessionID, userID string,
+	meter *usageMeter,
+	barge *bargeIn,
+	output *AudioFormat,
+	voice *voiceSettings,
+	speakers *speakerMap,
+	transcript *voiceTranscript,
 	transcriptions <-chan *TranscriptionResult,
 ) {
+	// Audio is metered by how far transcription has progressed, which
+	// doesn't depend on the codec
+	var transcribed time.Duration
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -540,64 +1022,187 @@ func (s *VoiceStreamServer) processTranscriptions(
 				return
 			}
 
+			sp := speakers.speaker(result.Speaker)
 			if !result.IsFinal {
 				// Send partial transcription
-				stream.Send(&VoiceResponse{
-					SessionID:     sessionID,
+				stream.Send(sp.tag(&VoiceResponse{
+					SessionId:     sessionID,
 					Transcription: result.Text,
 					IsFinal:       false,
-				})
+				}))
 				continue
 			}
 
-			// Generate AI response for final transcription
-			chunks, err := s.aiRouter.StreamGenerate(ctx, &GenerateRequest{
-				SessionID: sessionID,
-				UserID:    userID,
-				Message:   result.Text,
-			})
-			if err != nil {
-				s.logger.Error("generation failed",
-					slog.String("error", err.Error()),
-				)
-				continue
+			if result.Timestamp > transcribed {
+				meter.add(ctx, Usage{Messages: 1, AudioSeconds: (result.Timestamp - transcribed).Seconds()})
+				transcribed = result.Timestamp
+			} else {
+				meter.add(ctx, Usage{Messages: 1})
 			}
 
-			// Collect response text
-			var responseText string
-			for chunk := range chunks {
-				responseText += chunk.Content
+			// Only the resident's own words are analyzed for crisis
+			turn := sp.turn(sessionID, userID, result.Text)
+			if e := s.analyzeUtterance(ctx, sessionID, userID, sp, turn); e != nil {
+				stream.Send(&VoiceResponse{SessionId: sessionID, Error: e})
 			}
+			transcript.add(turn)
 
-			// Synthesize speech
-			audioChunks, err := s.ttsClient.StreamSynthesize(ctx, responseText, "therapeutic-warm")
-			if err != nil {
-				s.logger.Error("TTS failed",
-					slog.String("error", err.Error()),
-				)
-				continue
-			}
+			respCtx, done := barge.respond(ctx)
+			s.respond(respCtx, stream, sessionID, userID, meter, output, voice.current(), sp, transcript, result.Text)
+			done()
+		}
+	}
+}
 
-			// Stream audio response
-			for audioData := range audioChunks {
-				stream.Send(&VoiceResponse{
-					SessionID:     sessionID,
-					Transcription: result.Text,
+// respond generates and speaks the answer to one transcribed turn. If the
+// resident barges in, the remaining audio is abandoned and the client told
+// to flush what it has buffered.
+func (s *VoiceStreamServer) respond(
+	ctx context.Context,
+	stream grpc.BidiStreamingServer[VoiceRequest, VoiceResponse],
+	sessionID, userID string,
+	meter *usageMeter,
+	output *AudioFormat,
+	profile *VoiceProfile,
+	sp speaker,
+	transcript *voiceTranscript,
+	transcription string,
+) {
+	var responseText string
+	interrupted := func() bool {
+		if !errors.Is(context.Cause(ctx), errBargeIn) {
+			return false
+		}
+		stream.Send(sp.tag(&VoiceResponse{
+			SessionId:     sessionID,
+			Transcription: transcription,
+			Response:      responseText,
+			IsFinal:       true,
+			Interrupted:   true,
+		}))
+		return true
+	}
+
+	// Generate AI response for final transcription
+	chunks, err := s.aiRouter.StreamGenerate(ctx, &GenerateRequest{
+		SessionID: sessionID,
+		UserID:    userID,
+		Message:   transcription,
+	})
+	if err != nil {
+		if !interrupted() {
+			s.sendVoiceError(stream, sessionID, ComponentGeneration, err, "", false)
+		}
+		return
+	}
+
+	// Collect response text
+	var tokens int64
+	var agentType string
+	for chunk := range chunks {
+		responseText += chunk.Content
+		tokens += int64(chunk.TokenCount)
+		if chunk.AgentType != "" {
+			agentType = chunk.AgentType
+		}
+	}
+	if tokens > 0 {
+		meter.add(ctx, Usage{Tokens: tokens})
+	}
+	if responseText != "" {
+		transcript.add(&ChatMessage{
+			SessionId: sessionID,
+			UserId:    userID,
+			Role:      RoleAssistant,
+			Content:   responseText,
+			Timestamp: timestamppb.Now(),
+			AgentType: agentType,
+			IsFinal:   true,
+		})
+	}
+	if interrupted() {
+		return
+	}
+
+	// Without audio the resident still gets the response as text
+	textOnly := func(component string, err error) {
+		s.sendVoiceError(stream, sessionID, component, err, FallbackTextOnly, false)
+		stream.Send(sp.tag(&VoiceResponse{
+			SessionId:     sessionID,
+			Transcription: transcription,
+			Response:      responseText,
+			IsFinal:       true,
+		}))
+	}
+
+	trans, err := s.newTranscoder(output)
+	if err != nil {
+		textOnly(ComponentTranscoding, err)
+		return
+	}
+	audioResponse := func(data []byte) *VoiceResponse {
+		return sp.tag(&VoiceResponse{
+			SessionId:     sessionID,
+			Transcription: transcription,
+			Response:      responseText,
+			Audio: &AudioChunk{
+				Data:       data,
+				Format:     output.Format,
+				SampleRate: output.SampleRate,
+				Channels:   output.Channels,
+			},
+		})
+	}
+
+	// Synthesize speech
+	audioChunks, err := s.ttsClient.StreamSynthesize(ctx, responseText, profile)
+	if err != nil {
+		if !interrupted() {
+			textOnly(ComponentSynthesis, err)
+		}
+		return
+	}
+
+	// Stream audio response
+	for {
+		select {
+		case <-ctx.Done():
+			// Drain so the synthesizer isn't left blocked on a send
+			go func() {
+				for range audioChunks {
+				}
+			}()
+			interrupted()
+			return
+		case audioData, ok := <-audioChunks:
+			if !ok {
+				if trans != nil {
+					if data, err := trans.flush(); err == nil && len(data) > 0 {
+						stream.Send(audioResponse(data))
+					}
+				}
+
+				// Send final response
+				stream.Send(sp.tag(&VoiceResponse{
+					SessionId:     sessionID,
+					Transcription: transcription,
 					Response:      responseText,
-					Audio: &AudioChunk{
-						Data:   audioData,
-						Format: "opus",
-					},
-				})
+					IsFinal:       true,
+				}))
+				return
 			}
-
-			// Send final response
-			stream.Send(&VoiceResponse{
-				SessionID:     sessionID,
-				Transcription: result.Text,
-				Response:      responseText,
-				IsFinal:       true,
-			})
+			if trans != nil {
+				if audioData, err = trans.transcode(audioData); err != nil {
+					s.logger.Error("audio transcoding failed",
+						slog.String("error", err.Error()),
+					)
+					continue
+				}
+				if len(audioData) == 0 {
+					continue
+				}
+			}
+			stream.Send(audioResponse(audioData))
 		}
 	}
 }
@@ -610,22 +1215,6 @@ type CrisisAlertStreamServer struct {
 	logger *slog.Logger
 }
 
-// UnimplementedCrisisAlertServiceServer for forward compatibility
-type UnimplementedCrisisAlertServiceServer struct{}
-
-// CrisisAlertRequest for subscribing to alerts
-type CrisisAlertRequest struct {
-	FacilityID string
-	UserID     string
-	Roles      []string
-}
-
-// CrisisAlertResponse streaming response
-type CrisisAlertResponse struct {
-	Alert     *CrisisAlert
-	Timestamp time.Time
-}
-
 // NewCrisisAlertStreamServer creates a new crisis alert streaming server
 func NewCrisisAlertStreamServer(redis *redis.Client, logger *slog.Logger) *CrisisAlertStreamServer {
 	return &CrisisAlertStreamServer{
@@ -641,13 +1230,21 @@ func (s *CrisisAlertStreamServer) StreamAlerts(
 ) error {
 	ctx := stream.Context()
 
+	filter, err := newAlertFilter(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	as := newAlertStream(stream)
+	ackChannel := alertAckChannel(as.id)
+
 	// Subscribe to crisis alert channels
 	channels := []string{
-		fmt.Sprintf("crisis:facility:%s", req.FacilityID),
+		fmt.Sprintf("crisis:facility:%s", req.FacilityId),
+		ackChannel,
 	}
 
-	if req.UserID != "" {
-		channels = append(channels, fmt.Sprintf("crisis:user:%s", req.UserID))
+	if req.UserId != "" {
+		channels = append(channels, fmt.Sprintf("crisis:user:%s", req.UserId))
 	}
 
 	for _, role := range req.Roles {
@@ -658,32 +1255,70 @@ func (s *CrisisAlertStreamServer) StreamAlerts(
 	defer pubsub.Close()
 
 	s.logger.Info("crisis alert stream started",
-		slog.String("facility_id", req.FacilityID),
-		slog.String("user_id", req.UserID),
+		slog.String("facility_id", req.FacilityId),
+		slog.String("user_id", req.UserId),
+		slog.String("stream_id", as.id),
 		slog.Any("channels", channels),
 	)
 
+	// Replay after subscribing so nothing published meanwhile is missed; an
+	// alert may then arrive twice, and clients dedupe by ID
+	if req.ReplayActive {
+		active, err := s.activeAlerts(ctx, req.FacilityId)
+		if err != nil {
+			s.logger.Warn("failed to replay active alerts",
+				slog.String("facility_id", req.FacilityId),
+				slog.String("error", err.Error()),
+			)
+		}
+		for _, alert := range active {
+			if !filter.matches(alert) {
+				continue
+			}
+			if err := as.deliver(alert, true); err != nil {
+				return err
+			}
+		}
+	}
+
 	ch := pubsub.Channel()
+	ticker := time.NewTicker(alertAckTimeout / 2)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case now := <-ticker.C:
+			abandoned, err := as.redeliver(now)
+			for _, d := range abandoned {
+				s.logger.Warn("crisis alert never acknowledged",
+					slog.String("stream_id", as.id),
+					slog.String("alert_id", d.response.Alert.Id),
+					slog.Int("attempts", d.attempts),
+				)
+			}
+			if err != nil {
+				return err
+			}
 		case msg := <-ch:
-			var alert CrisisAlert
-			if err := json.Unmarshal([]byte(msg.Payload), &alert); err != nil {
+			if msg.Channel == ackChannel {
+				s.handleAcknowledgment(ctx, as, req.UserId, msg.Payload)
+				continue
+			}
+
+			alert := &CrisisAlert{}
+			if err := redisJSON.Unmarshal([]byte(msg.Payload), alert); err != nil {
 				s.logger.Error("failed to unmarshal crisis alert",
 					slog.String("error", err.Error()),
 				)
 				continue
 			}
-
-			response := &CrisisAlertResponse{
-				Alert:     &alert,
-				Timestamp: time.Now(),
+			if !filter.matches(alert) {
+				continue
 			}
 
-			if err := stream.Send(response); err != nil {
+			if err := as.deliver(alert, false); err != nil {
 				s.logger.Error("failed to send crisis alert",
 					slog.String("error", err.Error()),
 				)
@@ -701,22 +1336,6 @@ type MetricsStreamServer struct {
 	logger *slog.Logger
 }
 
-// UnimplementedMetricsServiceServer for forward compatibility
-type UnimplementedMetricsServiceServer struct{}
-
-// MetricsRequest for subscribing to metrics
-type MetricsRequest struct {
-	ServiceTypes []string
-	Interval     time.Duration
-}
-
-// MetricsResponse streaming response
-type MetricsResponse struct {
-	ServiceType string
-	Metrics     map[string]float64
-	Timestamp   time.Time
-}
-
 // NewMetricsStreamServer creates a new metrics streaming server
 func NewMetricsStreamServer(redis *redis.Client, logger *slog.Logger) *MetricsStreamServer {
 	return &MetricsStreamServer{
@@ -732,11 +1351,20 @@ func (s *MetricsStreamServer) StreamMetrics(
 ) error {
 	ctx := stream.Context()
 
-	interval := req.Interval
+	interval := req.GetInterval().AsDuration()
 	if interval < time.Second {
 		interval = time.Second
 	}
 
+	// Rates and percentiles cover each interval, starting from a baseline
+	// read now
+	windows := make(map[string]*metricsWindow, len(req.ServiceTypes))
+	for _, serviceType := range req.ServiceTypes {
+		if w, err := s.readWindow(ctx, serviceType); err == nil {
+			windows[serviceType] = w
+		}
+	}
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -754,7 +1382,18 @@ func (s *MetricsStreamServer) StreamMetrics(
 				response := &MetricsResponse{
 					ServiceType: serviceType,
 					Metrics:     metrics,
-					Timestamp:   time.Now(),
+					Timestamp:   timestamppb.Now(),
+				}
+
+				if w, err := s.readWindow(ctx, serviceType); err != nil {
+					s.logger.Warn("failed to read metric window",
+						slog.String("service_type", serviceType),
+						slog.String("error", err.Error()),
+					)
+				} else {
+					response.Rates = w.rates(windows[serviceType])
+					response.Histograms = w.summaries(windows[serviceType])
+					windows[serviceType] = w
 				}
 
 				if err := stream.Send(response); err != nil {
@@ -784,7 +1423,11 @@ func (s *MetricsStreamServer) collectMetrics(ctx context.Context, serviceType st
 	return metrics, nil
 }
 
-// RegisterServices registers all gRPC streaming services
+// RegisterServices registers all gRPC streaming services. The server should
+// be built with the auth package's stream and unary interceptors so the
+// user-id metadata these services trust has been checked against a token
+// and transcript exports are permission-gated and audited, and with
+// KeepaliveServerOptions so dead connections release their sessions.
 func RegisterServices(
 	server *grpc.Server,
 	redis *redis.Client,
@@ -793,26 +1436,26 @@ func RegisterServices(
 	crisisService CrisisService,
 	sttClient STTClient,
 	ttsClient TTSClient,
+	usage *UsageTracker,
+	history MessageStore,
+	voiceProfiles VoiceProfileStore,
+	summarizer *SessionSummarizer,
 ) {
 	// Register therapeutic chat streaming
-	chatServer := NewTherapeuticStreamServer(redis, logger, aiRouter, crisisService)
-	// RegisterTherapeuticServiceServer(server, chatServer)
-	_ = chatServer
+	chatServer := NewTherapeuticStreamServer(redis, logger, aiRouter, crisisService, usage, history, summarizer)
+	RegisterTherapeuticServiceServer(server, chatServer)
 
 	// Register voice streaming
-	voiceServer := NewVoiceStreamServer(logger, sttClient, ttsClient, aiRouter)
-	// RegisterVoiceServiceServer(server, voiceServer)
-	_ = voiceServer
+	voiceServer := NewVoiceStreamServer(logger, sttClient, ttsClient, aiRouter, crisisService, usage, voiceProfiles, summarizer)
+	RegisterVoiceServiceServer(server, voiceServer)
 
 	// Register crisis alert streaming
 	crisisAlertServer := NewCrisisAlertStreamServer(redis, logger)
-	// RegisterCrisisAlertServiceServer(server, crisisAlertServer)
-	_ = crisisAlertServer
+	RegisterCrisisAlertServiceServer(server, crisisAlertServer)
 
 	// Register metrics streaming
 	metricsServer := NewMetricsStreamServer(redis, logger)
-	// RegisterMetricsServiceServer(server, metricsServer)
-	_ = metricsServer
+	RegisterMetricsServiceServer(server, metricsServer)
 
 	logger.Info("all gRPC streaming services registered")
 }
@@ -0,0 +1,2153 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: grpc_streaming.proto
+
+// Streaming services for real-time therapeutic AI interactions: chat, voice,
+// crisis alert broadcasting, and live metrics.
+
+package streaming
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ChatMessage is a message in a therapeutic conversation.
+type ChatMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Role          string                 `protobuf:"bytes,4,opt,name=role,proto3" json:"role,omitempty"` // "user", "assistant", or "system"
+	Content       string                 `protobuf:"bytes,5,opt,name=content,proto3" json:"content,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,7,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	AgentType     string                 `protobuf:"bytes,8,opt,name=agent_type,json=agentType,proto3" json:"agent_type,omitempty"`
+	CrisisLevel   string                 `protobuf:"bytes,9,opt,name=crisis_level,json=crisisLevel,proto3" json:"crisis_level,omitempty"`
+	IsStreaming   bool                   `protobuf:"varint,10,opt,name=is_streaming,json=isStreaming,proto3" json:"is_streaming,omitempty"`
+	StreamIndex   int32                  `protobuf:"varint,11,opt,name=stream_index,json=streamIndex,proto3" json:"stream_index,omitempty"`
+	IsFinal       bool                   `protobuf:"varint,12,opt,name=is_final,json=isFinal,proto3" json:"is_final,omitempty"`
+	Sequence      int64                  `protobuf:"varint,13,opt,name=sequence,proto3" json:"sequence,omitempty"` // Per-session outbound sequence, echoed back as last-received-index on resume
+	Error         *StreamError           `protobuf:"bytes,14,opt,name=error,proto3" json:"error,omitempty"`        // Set on "error" control messages
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatMessage) Reset() {
+	*x = ChatMessage{}
+	mi := &file_grpc_streaming_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatMessage) ProtoMessage() {}
+
+func (x *ChatMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatMessage.ProtoReflect.Descriptor instead.
+func (*ChatMessage) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChatMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetAgentType() string {
+	if x != nil {
+		return x.AgentType
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetCrisisLevel() string {
+	if x != nil {
+		return x.CrisisLevel
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetIsStreaming() bool {
+	if x != nil {
+		return x.IsStreaming
+	}
+	return false
+}
+
+func (x *ChatMessage) GetStreamIndex() int32 {
+	if x != nil {
+		return x.StreamIndex
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetIsFinal() bool {
+	if x != nil {
+		return x.IsFinal
+	}
+	return false
+}
+
+func (x *ChatMessage) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetError() *StreamError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+// StreamError reports a pipeline failure so clients can explain it and
+// adapt instead of waiting on a response that won't come.
+type StreamError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`                                        // "unavailable", "timeout", "rate_limited", "invalid" or "internal"
+	Component     string                 `protobuf:"bytes,2,opt,name=component,proto3" json:"component,omitempty"`                              // Pipeline stage at fault, e.g. "generation" or "speech_synthesis"
+	Retryable     bool                   `protobuf:"varint,3,opt,name=retryable,proto3" json:"retryable,omitempty"`                             // Sending the same request again may succeed
+	Terminal      bool                   `protobuf:"varint,4,opt,name=terminal,proto3" json:"terminal,omitempty"`                               // The stream is ending; otherwise it carries on degraded
+	CorrelationId string                 `protobuf:"bytes,5,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"` // Matches the server's log entry
+	Message       string                 `protobuf:"bytes,6,opt,name=message,proto3" json:"message,omitempty"`                                  // Safe to show the resident; empty if nothing need be shown
+	Fallback      string                 `protobuf:"bytes,7,opt,name=fallback,proto3" json:"fallback,omitempty"`                                // What the server did instead, e.g. "text_only"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamError) Reset() {
+	*x = StreamError{}
+	mi := &file_grpc_streaming_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamError) ProtoMessage() {}
+
+func (x *StreamError) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamError.ProtoReflect.Descriptor instead.
+func (*StreamError) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamError) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *StreamError) GetComponent() string {
+	if x != nil {
+		return x.Component
+	}
+	return ""
+}
+
+func (x *StreamError) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *StreamError) GetTerminal() bool {
+	if x != nil {
+		return x.Terminal
+	}
+	return false
+}
+
+func (x *StreamError) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *StreamError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *StreamError) GetFallback() string {
+	if x != nil {
+		return x.Fallback
+	}
+	return ""
+}
+
+// SessionMoodRequest subscribes to a session's mood updates.
+type SessionMoodRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Replay        bool                   `protobuf:"varint,2,opt,name=replay,proto3" json:"replay,omitempty"` // Start with the session's recent points
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionMoodRequest) Reset() {
+	*x = SessionMoodRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionMoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionMoodRequest) ProtoMessage() {}
+
+func (x *SessionMoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionMoodRequest.ProtoReflect.Descriptor instead.
+func (*SessionMoodRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SessionMoodRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *SessionMoodRequest) GetReplay() bool {
+	if x != nil {
+		return x.Replay
+	}
+	return false
+}
+
+// MoodUpdate scores one resident message and the trajectory so far.
+type MoodUpdate struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SessionId      string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	MessageId      string                 `protobuf:"bytes,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Timestamp      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Valence        float64                `protobuf:"fixed64,4,opt,name=valence,proto3" json:"valence,omitempty"` // -1 (negative) to 1 (positive)
+	Arousal        float64                `protobuf:"fixed64,5,opt,name=arousal,proto3" json:"arousal,omitempty"` // 0 (calm) to 1 (agitated)
+	Emotions       map[string]float64     `protobuf:"bytes,6,rep,name=emotions,proto3" json:"emotions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	RollingValence float64                `protobuf:"fixed64,7,opt,name=rolling_valence,json=rollingValence,proto3" json:"rolling_valence,omitempty"` // Exponentially weighted over recent messages
+	Trend          float64                `protobuf:"fixed64,8,opt,name=trend,proto3" json:"trend,omitempty"`                                         // Valence change per message
+	TrajectoryRisk float64                `protobuf:"fixed64,9,opt,name=trajectory_risk,json=trajectoryRisk,proto3" json:"trajectory_risk,omitempty"` // 0 to 1; sustained or worsening negative mood
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MoodUpdate) Reset() {
+	*x = MoodUpdate{}
+	mi := &file_grpc_streaming_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoodUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoodUpdate) ProtoMessage() {}
+
+func (x *MoodUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoodUpdate.ProtoReflect.Descriptor instead.
+func (*MoodUpdate) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MoodUpdate) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *MoodUpdate) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *MoodUpdate) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *MoodUpdate) GetValence() float64 {
+	if x != nil {
+		return x.Valence
+	}
+	return 0
+}
+
+func (x *MoodUpdate) GetArousal() float64 {
+	if x != nil {
+		return x.Arousal
+	}
+	return 0
+}
+
+func (x *MoodUpdate) GetEmotions() map[string]float64 {
+	if x != nil {
+		return x.Emotions
+	}
+	return nil
+}
+
+func (x *MoodUpdate) GetRollingValence() float64 {
+	if x != nil {
+		return x.RollingValence
+	}
+	return 0
+}
+
+func (x *MoodUpdate) GetTrend() float64 {
+	if x != nil {
+		return x.Trend
+	}
+	return 0
+}
+
+func (x *MoodUpdate) GetTrajectoryRisk() float64 {
+	if x != nil {
+		return x.TrajectoryRisk
+	}
+	return 0
+}
+
+// ExportSessionRequest asks for a session's transcript.
+type ExportSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Format        string                 `protobuf:"bytes,2,opt,name=format,proto3" json:"format,omitempty"` // "json" (default) or "pdf"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportSessionRequest) Reset() {
+	*x = ExportSessionRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportSessionRequest) ProtoMessage() {}
+
+func (x *ExportSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportSessionRequest.ProtoReflect.Descriptor instead.
+func (*ExportSessionRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExportSessionRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ExportSessionRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+// ExportSessionResponse carries the rendered transcript.
+type ExportSessionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Content       []byte                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	ContentType   string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Filename      string                 `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	MessageCount  int32                  `protobuf:"varint,4,opt,name=message_count,json=messageCount,proto3" json:"message_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportSessionResponse) Reset() {
+	*x = ExportSessionResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportSessionResponse) ProtoMessage() {}
+
+func (x *ExportSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportSessionResponse.ProtoReflect.Descriptor instead.
+func (*ExportSessionResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExportSessionResponse) GetContent() []byte {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *ExportSessionResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ExportSessionResponse) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *ExportSessionResponse) GetMessageCount() int32 {
+	if x != nil {
+		return x.MessageCount
+	}
+	return 0
+}
+
+// AudioChunk is a segment of audio.
+type AudioChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Format        string                 `protobuf:"bytes,2,opt,name=format,proto3" json:"format,omitempty"` // "pcm", "wav", "opus", "webm"
+	SampleRate    int32                  `protobuf:"varint,3,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	Channels      int32                  `protobuf:"varint,4,opt,name=channels,proto3" json:"channels,omitempty"`
+	IsFinal       bool                   `protobuf:"varint,5,opt,name=is_final,json=isFinal,proto3" json:"is_final,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AudioChunk) Reset() {
+	*x = AudioChunk{}
+	mi := &file_grpc_streaming_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AudioChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AudioChunk) ProtoMessage() {}
+
+func (x *AudioChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AudioChunk.ProtoReflect.Descriptor instead.
+func (*AudioChunk) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AudioChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *AudioChunk) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *AudioChunk) GetSampleRate() int32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *AudioChunk) GetChannels() int32 {
+	if x != nil {
+		return x.Channels
+	}
+	return 0
+}
+
+func (x *AudioChunk) GetIsFinal() bool {
+	if x != nil {
+		return x.IsFinal
+	}
+	return false
+}
+
+// AudioFormat describes how a stream's audio is encoded.
+type AudioFormat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Format        string                 `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`
+	SampleRate    int32                  `protobuf:"varint,2,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	Channels      int32                  `protobuf:"varint,3,opt,name=channels,proto3" json:"channels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AudioFormat) Reset() {
+	*x = AudioFormat{}
+	mi := &file_grpc_streaming_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AudioFormat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AudioFormat) ProtoMessage() {}
+
+func (x *AudioFormat) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AudioFormat.ProtoReflect.Descriptor instead.
+func (*AudioFormat) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AudioFormat) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *AudioFormat) GetSampleRate() int32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *AudioFormat) GetChannels() int32 {
+	if x != nil {
+		return x.Channels
+	}
+	return 0
+}
+
+// AudioCapabilities lists the formats a client can play, most preferred first.
+type AudioCapabilities struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Formats       []string               `protobuf:"bytes,1,rep,name=formats,proto3" json:"formats,omitempty"`
+	SampleRate    int32                  `protobuf:"varint,2,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"` // Preferred playback rate; 0 accepts the server's
+	Channels      int32                  `protobuf:"varint,3,opt,name=channels,proto3" json:"channels,omitempty"`                       // Preferred channel count; 0 accepts the server's
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AudioCapabilities) Reset() {
+	*x = AudioCapabilities{}
+	mi := &file_grpc_streaming_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AudioCapabilities) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AudioCapabilities) ProtoMessage() {}
+
+func (x *AudioCapabilities) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AudioCapabilities.ProtoReflect.Descriptor instead.
+func (*AudioCapabilities) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AudioCapabilities) GetFormats() []string {
+	if x != nil {
+		return x.Formats
+	}
+	return nil
+}
+
+func (x *AudioCapabilities) GetSampleRate() int32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *AudioCapabilities) GetChannels() int32 {
+	if x != nil {
+		return x.Channels
+	}
+	return 0
+}
+
+// VoicePreferences personalizes synthesized speech. Unset fields keep
+// their current value.
+type VoicePreferences struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	VoiceId         string                 `protobuf:"bytes,1,opt,name=voice_id,json=voiceId,proto3" json:"voice_id,omitempty"`
+	SpeakingRate    float32                `protobuf:"fixed32,2,opt,name=speaking_rate,json=speakingRate,proto3" json:"speaking_rate,omitempty"` // 1.0 is normal speed
+	Language        string                 `protobuf:"bytes,3,opt,name=language,proto3" json:"language,omitempty"`                               // BCP 47 tag, e.g. "en-US"
+	NormalizeVolume *bool                  `protobuf:"varint,4,opt,name=normalize_volume,json=normalizeVolume,proto3,oneof" json:"normalize_volume,omitempty"`
+	Persist         bool                   `protobuf:"varint,5,opt,name=persist,proto3" json:"persist,omitempty"` // Also save as the resident's default for future streams
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *VoicePreferences) Reset() {
+	*x = VoicePreferences{}
+	mi := &file_grpc_streaming_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoicePreferences) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoicePreferences) ProtoMessage() {}
+
+func (x *VoicePreferences) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoicePreferences.ProtoReflect.Descriptor instead.
+func (*VoicePreferences) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *VoicePreferences) GetVoiceId() string {
+	if x != nil {
+		return x.VoiceId
+	}
+	return ""
+}
+
+func (x *VoicePreferences) GetSpeakingRate() float32 {
+	if x != nil {
+		return x.SpeakingRate
+	}
+	return 0
+}
+
+func (x *VoicePreferences) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *VoicePreferences) GetNormalizeVolume() bool {
+	if x != nil && x.NormalizeVolume != nil {
+		return *x.NormalizeVolume
+	}
+	return false
+}
+
+func (x *VoicePreferences) GetPersist() bool {
+	if x != nil {
+		return x.Persist
+	}
+	return false
+}
+
+// VoiceRequest carries audio from the client.
+type VoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Audio         *AudioChunk            `protobuf:"bytes,3,opt,name=audio,proto3" json:"audio,omitempty"`
+	Capabilities  *AudioCapabilities     `protobuf:"bytes,4,opt,name=capabilities,proto3" json:"capabilities,omitempty"` // Sent on the first message to negotiate response audio
+	Preferences   *VoicePreferences      `protobuf:"bytes,5,opt,name=preferences,proto3" json:"preferences,omitempty"`   // Switches the voice for later responses
+	Speakers      []*SpeakerAssignment   `protobuf:"bytes,6,rep,name=speakers,proto3" json:"speakers,omitempty"`         // Identifies diarized speakers; later assignments of a label replace earlier ones
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoiceRequest) Reset() {
+	*x = VoiceRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoiceRequest) ProtoMessage() {}
+
+func (x *VoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoiceRequest.ProtoReflect.Descriptor instead.
+func (*VoiceRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *VoiceRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *VoiceRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *VoiceRequest) GetAudio() *AudioChunk {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+func (x *VoiceRequest) GetCapabilities() *AudioCapabilities {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *VoiceRequest) GetPreferences() *VoicePreferences {
+	if x != nil {
+		return x.Preferences
+	}
+	return nil
+}
+
+func (x *VoiceRequest) GetSpeakers() []*SpeakerAssignment {
+	if x != nil {
+		return x.Speakers
+	}
+	return nil
+}
+
+// SpeakerAssignment ties a diarization label to a session participant.
+// Sessions with several speakers set speaker-count metadata to enable
+// diarization.
+type SpeakerAssignment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Label         string                 `protobuf:"bytes,1,opt,name=label,proto3" json:"label,omitempty"` // Label from VoiceResponse.speaker, e.g. "spk_1"
+	ParticipantId string                 `protobuf:"bytes,2,opt,name=participant_id,json=participantId,proto3" json:"participant_id,omitempty"`
+	Role          string                 `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"` // "resident", "clinician" or "family"
+	Name          string                 `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SpeakerAssignment) Reset() {
+	*x = SpeakerAssignment{}
+	mi := &file_grpc_streaming_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SpeakerAssignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpeakerAssignment) ProtoMessage() {}
+
+func (x *SpeakerAssignment) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpeakerAssignment.ProtoReflect.Descriptor instead.
+func (*SpeakerAssignment) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SpeakerAssignment) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *SpeakerAssignment) GetParticipantId() string {
+	if x != nil {
+		return x.ParticipantId
+	}
+	return ""
+}
+
+func (x *SpeakerAssignment) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *SpeakerAssignment) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// VoiceResponse carries transcriptions, the AI response, and its audio.
+type VoiceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Transcription string                 `protobuf:"bytes,2,opt,name=transcription,proto3" json:"transcription,omitempty"`
+	Response      string                 `protobuf:"bytes,3,opt,name=response,proto3" json:"response,omitempty"`
+	Audio         *AudioChunk            `protobuf:"bytes,4,opt,name=audio,proto3" json:"audio,omitempty"`
+	IsFinal       bool                   `protobuf:"varint,5,opt,name=is_final,json=isFinal,proto3" json:"is_final,omitempty"`
+	Interrupted   bool                   `protobuf:"varint,6,opt,name=interrupted,proto3" json:"interrupted,omitempty"`                      // The resident barged in; stop playback and discard buffered audio
+	OutputFormat  *AudioFormat           `protobuf:"bytes,7,opt,name=output_format,json=outputFormat,proto3" json:"output_format,omitempty"` // Negotiated response audio format, sent once at stream start
+	Error         *StreamError           `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	Speaker       string                 `protobuf:"bytes,9,opt,name=speaker,proto3" json:"speaker,omitempty"`                             // Diarization label of the transcribed speaker
+	SpeakerRole   string                 `protobuf:"bytes,10,opt,name=speaker_role,json=speakerRole,proto3" json:"speaker_role,omitempty"` // Their assigned role; empty until assigned
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VoiceResponse) Reset() {
+	*x = VoiceResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VoiceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoiceResponse) ProtoMessage() {}
+
+func (x *VoiceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoiceResponse.ProtoReflect.Descriptor instead.
+func (*VoiceResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *VoiceResponse) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *VoiceResponse) GetTranscription() string {
+	if x != nil {
+		return x.Transcription
+	}
+	return ""
+}
+
+func (x *VoiceResponse) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *VoiceResponse) GetAudio() *AudioChunk {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+func (x *VoiceResponse) GetIsFinal() bool {
+	if x != nil {
+		return x.IsFinal
+	}
+	return false
+}
+
+func (x *VoiceResponse) GetInterrupted() bool {
+	if x != nil {
+		return x.Interrupted
+	}
+	return false
+}
+
+func (x *VoiceResponse) GetOutputFormat() *AudioFormat {
+	if x != nil {
+		return x.OutputFormat
+	}
+	return nil
+}
+
+func (x *VoiceResponse) GetError() *StreamError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *VoiceResponse) GetSpeaker() string {
+	if x != nil {
+		return x.Speaker
+	}
+	return ""
+}
+
+func (x *VoiceResponse) GetSpeakerRole() string {
+	if x != nil {
+		return x.SpeakerRole
+	}
+	return ""
+}
+
+// CrisisAlert is a crisis reported for a resident.
+type CrisisAlert struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Level         string                 `protobuf:"bytes,3,opt,name=level,proto3" json:"level,omitempty"`
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Id            string                 `protobuf:"bytes,6,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"` // ACTIVE, ACKNOWLEDGED, IN_PROGRESS, ESCALATED or RESOLVED
+	FacilityId    string                 `protobuf:"bytes,8,opt,name=facility_id,json=facilityId,proto3" json:"facility_id,omitempty"`
+	Guest         bool                   `protobuf:"varint,9,opt,name=guest,proto3" json:"guest,omitempty"` // Pre-enrollment guest, escalated to the front desk
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrisisAlert) Reset() {
+	*x = CrisisAlert{}
+	mi := &file_grpc_streaming_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrisisAlert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrisisAlert) ProtoMessage() {}
+
+func (x *CrisisAlert) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrisisAlert.ProtoReflect.Descriptor instead.
+func (*CrisisAlert) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *CrisisAlert) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CrisisAlert) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetFacilityId() string {
+	if x != nil {
+		return x.FacilityId
+	}
+	return ""
+}
+
+func (x *CrisisAlert) GetGuest() bool {
+	if x != nil {
+		return x.Guest
+	}
+	return false
+}
+
+// CrisisAlertRequest subscribes to alerts for a facility, user, and roles.
+type CrisisAlertRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FacilityId    string                 `protobuf:"bytes,1,opt,name=facility_id,json=facilityId,proto3" json:"facility_id,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Roles         []string               `protobuf:"bytes,3,rep,name=roles,proto3" json:"roles,omitempty"`
+	MinLevel      string                 `protobuf:"bytes,4,opt,name=min_level,json=minLevel,proto3" json:"min_level,omitempty"`              // Only alerts at or above this level
+	Statuses      []string               `protobuf:"bytes,5,rep,name=statuses,proto3" json:"statuses,omitempty"`                              // Only alerts in these states; empty for all
+	ReplayActive  bool                   `protobuf:"varint,6,opt,name=replay_active,json=replayActive,proto3" json:"replay_active,omitempty"` // Start with the facility's unresolved alerts
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrisisAlertRequest) Reset() {
+	*x = CrisisAlertRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrisisAlertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrisisAlertRequest) ProtoMessage() {}
+
+func (x *CrisisAlertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrisisAlertRequest.ProtoReflect.Descriptor instead.
+func (*CrisisAlertRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CrisisAlertRequest) GetFacilityId() string {
+	if x != nil {
+		return x.FacilityId
+	}
+	return ""
+}
+
+func (x *CrisisAlertRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CrisisAlertRequest) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *CrisisAlertRequest) GetMinLevel() string {
+	if x != nil {
+		return x.MinLevel
+	}
+	return ""
+}
+
+func (x *CrisisAlertRequest) GetStatuses() []string {
+	if x != nil {
+		return x.Statuses
+	}
+	return nil
+}
+
+func (x *CrisisAlertRequest) GetReplayActive() bool {
+	if x != nil {
+		return x.ReplayActive
+	}
+	return false
+}
+
+// CrisisAlertResponse delivers one alert.
+type CrisisAlertResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Alert         *CrisisAlert           `protobuf:"bytes,1,opt,name=alert,proto3" json:"alert,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	StreamId      string                 `protobuf:"bytes,3,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`        // Identifies this subscription in acknowledgments
+	DeliveryId    int64                  `protobuf:"varint,4,opt,name=delivery_id,json=deliveryId,proto3" json:"delivery_id,omitempty"` // Acknowledge to stop redelivery
+	Replayed      bool                   `protobuf:"varint,5,opt,name=replayed,proto3" json:"replayed,omitempty"`                       // Already active when the stream started
+	Redelivered   bool                   `protobuf:"varint,6,opt,name=redelivered,proto3" json:"redelivered,omitempty"`                 // Sent before without being acknowledged
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrisisAlertResponse) Reset() {
+	*x = CrisisAlertResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrisisAlertResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrisisAlertResponse) ProtoMessage() {}
+
+func (x *CrisisAlertResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrisisAlertResponse.ProtoReflect.Descriptor instead.
+func (*CrisisAlertResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *CrisisAlertResponse) GetAlert() *CrisisAlert {
+	if x != nil {
+		return x.Alert
+	}
+	return nil
+}
+
+func (x *CrisisAlertResponse) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CrisisAlertResponse) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+func (x *CrisisAlertResponse) GetDeliveryId() int64 {
+	if x != nil {
+		return x.DeliveryId
+	}
+	return 0
+}
+
+func (x *CrisisAlertResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+func (x *CrisisAlertResponse) GetRedelivered() bool {
+	if x != nil {
+		return x.Redelivered
+	}
+	return false
+}
+
+// AlertAckRequest confirms a stream's deliveries were shown to staff.
+type AlertAckRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamId      string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	DeliveryIds   []int64                `protobuf:"varint,2,rep,packed,name=delivery_ids,json=deliveryIds,proto3" json:"delivery_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AlertAckRequest) Reset() {
+	*x = AlertAckRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AlertAckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AlertAckRequest) ProtoMessage() {}
+
+func (x *AlertAckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AlertAckRequest.ProtoReflect.Descriptor instead.
+func (*AlertAckRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AlertAckRequest) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+func (x *AlertAckRequest) GetDeliveryIds() []int64 {
+	if x != nil {
+		return x.DeliveryIds
+	}
+	return nil
+}
+
+// AlertAckResponse confirms acknowledgments were recorded.
+type AlertAckResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AlertAckResponse) Reset() {
+	*x = AlertAckResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AlertAckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AlertAckResponse) ProtoMessage() {}
+
+func (x *AlertAckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AlertAckResponse.ProtoReflect.Descriptor instead.
+func (*AlertAckResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{17}
+}
+
+// MetricsRequest subscribes to metrics for service types.
+type MetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServiceTypes  []string               `protobuf:"bytes,1,rep,name=service_types,json=serviceTypes,proto3" json:"service_types,omitempty"`
+	Interval      *durationpb.Duration   `protobuf:"bytes,2,opt,name=interval,proto3" json:"interval,omitempty"` // Minimum one second
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsRequest) Reset() {
+	*x = MetricsRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsRequest) ProtoMessage() {}
+
+func (x *MetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsRequest.ProtoReflect.Descriptor instead.
+func (*MetricsRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *MetricsRequest) GetServiceTypes() []string {
+	if x != nil {
+		return x.ServiceTypes
+	}
+	return nil
+}
+
+func (x *MetricsRequest) GetInterval() *durationpb.Duration {
+	if x != nil {
+		return x.Interval
+	}
+	return nil
+}
+
+// MetricsResponse delivers one service's metrics.
+type MetricsResponse struct {
+	state         protoimpl.MessageState       `protogen:"open.v1"`
+	ServiceType   string                       `protobuf:"bytes,1,opt,name=service_type,json=serviceType,proto3" json:"service_type,omitempty"`
+	Metrics       map[string]float64           `protobuf:"bytes,2,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Timestamp     *timestamppb.Timestamp       `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Rates         map[string]float64           `protobuf:"bytes,4,rep,name=rates,proto3" json:"rates,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"` // Counter increase per second over the interval
+	Histograms    map[string]*HistogramSummary `protobuf:"bytes,5,rep,name=histograms,proto3" json:"histograms,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsResponse) Reset() {
+	*x = MetricsResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsResponse) ProtoMessage() {}
+
+func (x *MetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsResponse.ProtoReflect.Descriptor instead.
+func (*MetricsResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *MetricsResponse) GetServiceType() string {
+	if x != nil {
+		return x.ServiceType
+	}
+	return ""
+}
+
+func (x *MetricsResponse) GetMetrics() map[string]float64 {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *MetricsResponse) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *MetricsResponse) GetRates() map[string]float64 {
+	if x != nil {
+		return x.Rates
+	}
+	return nil
+}
+
+func (x *MetricsResponse) GetHistograms() map[string]*HistogramSummary {
+	if x != nil {
+		return x.Histograms
+	}
+	return nil
+}
+
+// HistogramSummary describes a histogram's observations over one interval.
+type HistogramSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Count         uint64                 `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	Mean          float64                `protobuf:"fixed64,2,opt,name=mean,proto3" json:"mean,omitempty"`
+	P50           float64                `protobuf:"fixed64,3,opt,name=p50,proto3" json:"p50,omitempty"`
+	P95           float64                `protobuf:"fixed64,4,opt,name=p95,proto3" json:"p95,omitempty"`
+	P99           float64                `protobuf:"fixed64,5,opt,name=p99,proto3" json:"p99,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistogramSummary) Reset() {
+	*x = HistogramSummary{}
+	mi := &file_grpc_streaming_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistogramSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistogramSummary) ProtoMessage() {}
+
+func (x *HistogramSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistogramSummary.ProtoReflect.Descriptor instead.
+func (*HistogramSummary) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *HistogramSummary) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *HistogramSummary) GetMean() float64 {
+	if x != nil {
+		return x.Mean
+	}
+	return 0
+}
+
+func (x *HistogramSummary) GetP50() float64 {
+	if x != nil {
+		return x.P50
+	}
+	return 0
+}
+
+func (x *HistogramSummary) GetP95() float64 {
+	if x != nil {
+		return x.P95
+	}
+	return 0
+}
+
+func (x *HistogramSummary) GetP99() float64 {
+	if x != nil {
+		return x.P99
+	}
+	return 0
+}
+
+// MetricsCatalogRequest asks which metrics services report.
+type MetricsCatalogRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServiceTypes  []string               `protobuf:"bytes,1,rep,name=service_types,json=serviceTypes,proto3" json:"service_types,omitempty"` // Empty lists every service
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsCatalogRequest) Reset() {
+	*x = MetricsCatalogRequest{}
+	mi := &file_grpc_streaming_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsCatalogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsCatalogRequest) ProtoMessage() {}
+
+func (x *MetricsCatalogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsCatalogRequest.ProtoReflect.Descriptor instead.
+func (*MetricsCatalogRequest) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *MetricsCatalogRequest) GetServiceTypes() []string {
+	if x != nil {
+		return x.ServiceTypes
+	}
+	return nil
+}
+
+// ServiceMetricsCatalog names one service's metrics by kind.
+type ServiceMetricsCatalog struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServiceType   string                 `protobuf:"bytes,1,opt,name=service_type,json=serviceType,proto3" json:"service_type,omitempty"`
+	Gauges        []string               `protobuf:"bytes,2,rep,name=gauges,proto3" json:"gauges,omitempty"`
+	Counters      []string               `protobuf:"bytes,3,rep,name=counters,proto3" json:"counters,omitempty"`
+	Histograms    []string               `protobuf:"bytes,4,rep,name=histograms,proto3" json:"histograms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServiceMetricsCatalog) Reset() {
+	*x = ServiceMetricsCatalog{}
+	mi := &file_grpc_streaming_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceMetricsCatalog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceMetricsCatalog) ProtoMessage() {}
+
+func (x *ServiceMetricsCatalog) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceMetricsCatalog.ProtoReflect.Descriptor instead.
+func (*ServiceMetricsCatalog) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ServiceMetricsCatalog) GetServiceType() string {
+	if x != nil {
+		return x.ServiceType
+	}
+	return ""
+}
+
+func (x *ServiceMetricsCatalog) GetGauges() []string {
+	if x != nil {
+		return x.Gauges
+	}
+	return nil
+}
+
+func (x *ServiceMetricsCatalog) GetCounters() []string {
+	if x != nil {
+		return x.Counters
+	}
+	return nil
+}
+
+func (x *ServiceMetricsCatalog) GetHistograms() []string {
+	if x != nil {
+		return x.Histograms
+	}
+	return nil
+}
+
+// MetricsCatalogResponse lists available metrics.
+type MetricsCatalogResponse struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	Services      []*ServiceMetricsCatalog `protobuf:"bytes,1,rep,name=services,proto3" json:"services,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsCatalogResponse) Reset() {
+	*x = MetricsCatalogResponse{}
+	mi := &file_grpc_streaming_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsCatalogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsCatalogResponse) ProtoMessage() {}
+
+func (x *MetricsCatalogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpc_streaming_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsCatalogResponse.ProtoReflect.Descriptor instead.
+func (*MetricsCatalogResponse) Descriptor() ([]byte, []int) {
+	return file_grpc_streaming_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *MetricsCatalogResponse) GetServices() []*ServiceMetricsCatalog {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+var File_grpc_streaming_proto protoreflect.FileDescriptor
+
+const file_grpc_streaming_proto_rawDesc = "" +
+	"\n" +
+	"\x14grpc_streaming.proto\x12\x18therapeutic.streaming.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc7\x04\n" +
+	"\vChatMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04role\x18\x04 \x01(\tR\x04role\x12\x18\n" +
+	"\acontent\x18\x05 \x01(\tR\acontent\x128\n" +
+	"\ttimestamp\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12O\n" +
+	"\bmetadata\x18\a \x03(\v23.therapeutic.streaming.v1.ChatMessage.MetadataEntryR\bmetadata\x12\x1d\n" +
+	"\n" +
+	"agent_type\x18\b \x01(\tR\tagentType\x12!\n" +
+	"\fcrisis_level\x18\t \x01(\tR\vcrisisLevel\x12!\n" +
+	"\fis_streaming\x18\n" +
+	" \x01(\bR\visStreaming\x12!\n" +
+	"\fstream_index\x18\v \x01(\x05R\vstreamIndex\x12\x19\n" +
+	"\bis_final\x18\f \x01(\bR\aisFinal\x12\x1a\n" +
+	"\bsequence\x18\r \x01(\x03R\bsequence\x12;\n" +
+	"\x05error\x18\x0e \x01(\v2%.therapeutic.streaming.v1.StreamErrorR\x05error\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd6\x01\n" +
+	"\vStreamError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x1c\n" +
+	"\tcomponent\x18\x02 \x01(\tR\tcomponent\x12\x1c\n" +
+	"\tretryable\x18\x03 \x01(\bR\tretryable\x12\x1a\n" +
+	"\bterminal\x18\x04 \x01(\bR\bterminal\x12%\n" +
+	"\x0ecorrelation_id\x18\x05 \x01(\tR\rcorrelationId\x12\x18\n" +
+	"\amessage\x18\x06 \x01(\tR\amessage\x12\x1a\n" +
+	"\bfallback\x18\a \x01(\tR\bfallback\"K\n" +
+	"\x12SessionMoodRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06replay\x18\x02 \x01(\bR\x06replay\"\xad\x03\n" +
+	"\n" +
+	"MoodUpdate\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\tR\tmessageId\x128\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x18\n" +
+	"\avalence\x18\x04 \x01(\x01R\avalence\x12\x18\n" +
+	"\aarousal\x18\x05 \x01(\x01R\aarousal\x12N\n" +
+	"\bemotions\x18\x06 \x03(\v22.therapeutic.streaming.v1.MoodUpdate.EmotionsEntryR\bemotions\x12'\n" +
+	"\x0frolling_valence\x18\a \x01(\x01R\x0erollingValence\x12\x14\n" +
+	"\x05trend\x18\b \x01(\x01R\x05trend\x12'\n" +
+	"\x0ftrajectory_risk\x18\t \x01(\x01R\x0etrajectoryRisk\x1a;\n" +
+	"\rEmotionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"M\n" +
+	"\x14ExportSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06format\x18\x02 \x01(\tR\x06format\"\x95\x01\n" +
+	"\x15ExportSessionResponse\x12\x18\n" +
+	"\acontent\x18\x01 \x01(\fR\acontent\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12#\n" +
+	"\rmessage_count\x18\x04 \x01(\x05R\fmessageCount\"\x90\x01\n" +
+	"\n" +
+	"AudioChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x16\n" +
+	"\x06format\x18\x02 \x01(\tR\x06format\x12\x1f\n" +
+	"\vsample_rate\x18\x03 \x01(\x05R\n" +
+	"sampleRate\x12\x1a\n" +
+	"\bchannels\x18\x04 \x01(\x05R\bchannels\x12\x19\n" +
+	"\bis_final\x18\x05 \x01(\bR\aisFinal\"b\n" +
+	"\vAudioFormat\x12\x16\n" +
+	"\x06format\x18\x01 \x01(\tR\x06format\x12\x1f\n" +
+	"\vsample_rate\x18\x02 \x01(\x05R\n" +
+	"sampleRate\x12\x1a\n" +
+	"\bchannels\x18\x03 \x01(\x05R\bchannels\"j\n" +
+	"\x11AudioCapabilities\x12\x18\n" +
+	"\aformats\x18\x01 \x03(\tR\aformats\x12\x1f\n" +
+	"\vsample_rate\x18\x02 \x01(\x05R\n" +
+	"sampleRate\x12\x1a\n" +
+	"\bchannels\x18\x03 \x01(\x05R\bchannels\"\xcd\x01\n" +
+	"\x10VoicePreferences\x12\x19\n" +
+	"\bvoice_id\x18\x01 \x01(\tR\avoiceId\x12#\n" +
+	"\rspeaking_rate\x18\x02 \x01(\x02R\fspeakingRate\x12\x1a\n" +
+	"\blanguage\x18\x03 \x01(\tR\blanguage\x12.\n" +
+	"\x10normalize_volume\x18\x04 \x01(\bH\x00R\x0fnormalizeVolume\x88\x01\x01\x12\x18\n" +
+	"\apersist\x18\x05 \x01(\bR\apersistB\x13\n" +
+	"\x11_normalize_volume\"\xea\x02\n" +
+	"\fVoiceRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12:\n" +
+	"\x05audio\x18\x03 \x01(\v2$.therapeutic.streaming.v1.AudioChunkR\x05audio\x12O\n" +
+	"\fcapabilities\x18\x04 \x01(\v2+.therapeutic.streaming.v1.AudioCapabilitiesR\fcapabilities\x12L\n" +
+	"\vpreferences\x18\x05 \x01(\v2*.therapeutic.streaming.v1.VoicePreferencesR\vpreferences\x12G\n" +
+	"\bspeakers\x18\x06 \x03(\v2+.therapeutic.streaming.v1.SpeakerAssignmentR\bspeakers\"x\n" +
+	"\x11SpeakerAssignment\x12\x14\n" +
+	"\x05label\x18\x01 \x01(\tR\x05label\x12%\n" +
+	"\x0eparticipant_id\x18\x02 \x01(\tR\rparticipantId\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\"\xaf\x03\n" +
+	"\rVoiceResponse\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12$\n" +
+	"\rtranscription\x18\x02 \x01(\tR\rtranscription\x12\x1a\n" +
+	"\bresponse\x18\x03 \x01(\tR\bresponse\x12:\n" +
+	"\x05audio\x18\x04 \x01(\v2$.therapeutic.streaming.v1.AudioChunkR\x05audio\x12\x19\n" +
+	"\bis_final\x18\x05 \x01(\bR\aisFinal\x12 \n" +
+	"\vinterrupted\x18\x06 \x01(\bR\vinterrupted\x12J\n" +
+	"\routput_format\x18\a \x01(\v2%.therapeutic.streaming.v1.AudioFormatR\foutputFormat\x12;\n" +
+	"\x05error\x18\b \x01(\v2%.therapeutic.streaming.v1.StreamErrorR\x05error\x12\x18\n" +
+	"\aspeaker\x18\t \x01(\tR\aspeaker\x12!\n" +
+	"\fspeaker_role\x18\n" +
+	" \x01(\tR\vspeakerRole\"\x8e\x02\n" +
+	"\vCrisisAlert\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12\x14\n" +
+	"\x05level\x18\x03 \x01(\tR\x05level\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x0e\n" +
+	"\x02id\x18\x06 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\a \x01(\tR\x06status\x12\x1f\n" +
+	"\vfacility_id\x18\b \x01(\tR\n" +
+	"facilityId\x12\x14\n" +
+	"\x05guest\x18\t \x01(\bR\x05guest\"\xc2\x01\n" +
+	"\x12CrisisAlertRequest\x12\x1f\n" +
+	"\vfacility_id\x18\x01 \x01(\tR\n" +
+	"facilityId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05roles\x18\x03 \x03(\tR\x05roles\x12\x1b\n" +
+	"\tmin_level\x18\x04 \x01(\tR\bminLevel\x12\x1a\n" +
+	"\bstatuses\x18\x05 \x03(\tR\bstatuses\x12#\n" +
+	"\rreplay_active\x18\x06 \x01(\bR\freplayActive\"\x88\x02\n" +
+	"\x13CrisisAlertResponse\x12;\n" +
+	"\x05alert\x18\x01 \x01(\v2%.therapeutic.streaming.v1.CrisisAlertR\x05alert\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x1b\n" +
+	"\tstream_id\x18\x03 \x01(\tR\bstreamId\x12\x1f\n" +
+	"\vdelivery_id\x18\x04 \x01(\x03R\n" +
+	"deliveryId\x12\x1a\n" +
+	"\breplayed\x18\x05 \x01(\bR\breplayed\x12 \n" +
+	"\vredelivered\x18\x06 \x01(\bR\vredelivered\"Q\n" +
+	"\x0fAlertAckRequest\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\x12!\n" +
+	"\fdelivery_ids\x18\x02 \x03(\x03R\vdeliveryIds\"\x12\n" +
+	"\x10AlertAckResponse\"l\n" +
+	"\x0eMetricsRequest\x12#\n" +
+	"\rservice_types\x18\x01 \x03(\tR\fserviceTypes\x125\n" +
+	"\binterval\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\binterval\"\xc8\x04\n" +
+	"\x0fMetricsResponse\x12!\n" +
+	"\fservice_type\x18\x01 \x01(\tR\vserviceType\x12P\n" +
+	"\ametrics\x18\x02 \x03(\v26.therapeutic.streaming.v1.MetricsResponse.MetricsEntryR\ametrics\x128\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12J\n" +
+	"\x05rates\x18\x04 \x03(\v24.therapeutic.streaming.v1.MetricsResponse.RatesEntryR\x05rates\x12Y\n" +
+	"\n" +
+	"histograms\x18\x05 \x03(\v29.therapeutic.streaming.v1.MetricsResponse.HistogramsEntryR\n" +
+	"histograms\x1a:\n" +
+	"\fMetricsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\x1a8\n" +
+	"\n" +
+	"RatesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\x1ai\n" +
+	"\x0fHistogramsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12@\n" +
+	"\x05value\x18\x02 \x01(\v2*.therapeutic.streaming.v1.HistogramSummaryR\x05value:\x028\x01\"r\n" +
+	"\x10HistogramSummary\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x04R\x05count\x12\x12\n" +
+	"\x04mean\x18\x02 \x01(\x01R\x04mean\x12\x10\n" +
+	"\x03p50\x18\x03 \x01(\x01R\x03p50\x12\x10\n" +
+	"\x03p95\x18\x04 \x01(\x01R\x03p95\x12\x10\n" +
+	"\x03p99\x18\x05 \x01(\x01R\x03p99\"<\n" +
+	"\x15MetricsCatalogRequest\x12#\n" +
+	"\rservice_types\x18\x01 \x03(\tR\fserviceTypes\"\x8e\x01\n" +
+	"\x15ServiceMetricsCatalog\x12!\n" +
+	"\fservice_type\x18\x01 \x01(\tR\vserviceType\x12\x16\n" +
+	"\x06gauges\x18\x02 \x03(\tR\x06gauges\x12\x1a\n" +
+	"\bcounters\x18\x03 \x03(\tR\bcounters\x12\x1e\n" +
+	"\n" +
+	"histograms\x18\x04 \x03(\tR\n" +
+	"histograms\"e\n" +
+	"\x16MetricsCatalogResponse\x12K\n" +
+	"\bservices\x18\x01 \x03(\v2/.therapeutic.streaming.v1.ServiceMetricsCatalogR\bservices2\xcb\x02\n" +
+	"\x12TherapeuticService\x12X\n" +
+	"\x04Chat\x12%.therapeutic.streaming.v1.ChatMessage\x1a%.therapeutic.streaming.v1.ChatMessage(\x010\x01\x12i\n" +
+	"\x11StreamSessionMood\x12,.therapeutic.streaming.v1.SessionMoodRequest\x1a$.therapeutic.streaming.v1.MoodUpdate0\x01\x12p\n" +
+	"\rExportSession\x12..therapeutic.streaming.v1.ExportSessionRequest\x1a/.therapeutic.streaming.v1.ExportSessionResponse2r\n" +
+	"\fVoiceService\x12b\n" +
+	"\vStreamVoice\x12&.therapeutic.streaming.v1.VoiceRequest\x1a'.therapeutic.streaming.v1.VoiceResponse(\x010\x012\xef\x01\n" +
+	"\x12CrisisAlertService\x12m\n" +
+	"\fStreamAlerts\x12,.therapeutic.streaming.v1.CrisisAlertRequest\x1a-.therapeutic.streaming.v1.CrisisAlertResponse0\x01\x12j\n" +
+	"\x11AcknowledgeAlerts\x12).therapeutic.streaming.v1.AlertAckRequest\x1a*.therapeutic.streaming.v1.AlertAckResponse2\xea\x01\n" +
+	"\x0eMetricsService\x12f\n" +
+	"\rStreamMetrics\x12(.therapeutic.streaming.v1.MetricsRequest\x1a).therapeutic.streaming.v1.MetricsResponse0\x01\x12p\n" +
+	"\vListMetrics\x12/.therapeutic.streaming.v1.MetricsCatalogRequest\x1a0.therapeutic.streaming.v1.MetricsCatalogResponseB\x0eZ\f./;streamingb\x06proto3"
+
+var (
+	file_grpc_streaming_proto_rawDescOnce sync.Once
+	file_grpc_streaming_proto_rawDescData []byte
+)
+
+func file_grpc_streaming_proto_rawDescGZIP() []byte {
+	file_grpc_streaming_proto_rawDescOnce.Do(func() {
+		file_grpc_streaming_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_grpc_streaming_proto_rawDesc), len(file_grpc_streaming_proto_rawDesc)))
+	})
+	return file_grpc_streaming_proto_rawDescData
+}
+
+var file_grpc_streaming_proto_msgTypes = make([]protoimpl.MessageInfo, 29)
+var file_grpc_streaming_proto_goTypes = []any{
+	(*ChatMessage)(nil),            // 0: therapeutic.streaming.v1.ChatMessage
+	(*StreamError)(nil),            // 1: therapeutic.streaming.v1.StreamError
+	(*SessionMoodRequest)(nil),     // 2: therapeutic.streaming.v1.SessionMoodRequest
+	(*MoodUpdate)(nil),             // 3: therapeutic.streaming.v1.MoodUpdate
+	(*ExportSessionRequest)(nil),   // 4: therapeutic.streaming.v1.ExportSessionRequest
+	(*ExportSessionResponse)(nil),  // 5: therapeutic.streaming.v1.ExportSessionResponse
+	(*AudioChunk)(nil),             // 6: therapeutic.streaming.v1.AudioChunk
+	(*AudioFormat)(nil),            // 7: therapeutic.streaming.v1.AudioFormat
+	(*AudioCapabilities)(nil),      // 8: therapeutic.streaming.v1.AudioCapabilities
+	(*VoicePreferences)(nil),       // 9: therapeutic.streaming.v1.VoicePreferences
+	(*VoiceRequest)(nil),           // 10: therapeutic.streaming.v1.VoiceRequest
+	(*SpeakerAssignment)(nil),      // 11: therapeutic.streaming.v1.SpeakerAssignment
+	(*VoiceResponse)(nil),          // 12: therapeutic.streaming.v1.VoiceResponse
+	(*CrisisAlert)(nil),            // 13: therapeutic.streaming.v1.CrisisAlert
+	(*CrisisAlertRequest)(nil),     // 14: therapeutic.streaming.v1.CrisisAlertRequest
+	(*CrisisAlertResponse)(nil),    // 15: therapeutic.streaming.v1.CrisisAlertResponse
+	(*AlertAckRequest)(nil),        // 16: therapeutic.streaming.v1.AlertAckRequest
+	(*AlertAckResponse)(nil),       // 17: therapeutic.streaming.v1.AlertAckResponse
+	(*MetricsRequest)(nil),         // 18: therapeutic.streaming.v1.MetricsRequest
+	(*MetricsResponse)(nil),        // 19: therapeutic.streaming.v1.MetricsResponse
+	(*HistogramSummary)(nil),       // 20: therapeutic.streaming.v1.HistogramSummary
+	(*MetricsCatalogRequest)(nil),  // 21: therapeutic.streaming.v1.MetricsCatalogRequest
+	(*ServiceMetricsCatalog)(nil),  // 22: therapeutic.streaming.v1.ServiceMetricsCatalog
+	(*MetricsCatalogResponse)(nil), // 23: therapeutic.streaming.v1.MetricsCatalogResponse
+	nil,                            // 24: therapeutic.streaming.v1.ChatMessage.MetadataEntry
+	nil,                            // 25: therapeutic.streaming.v1.MoodUpdate.EmotionsEntry
+	nil,                            // 26: therapeutic.streaming.v1.MetricsResponse.MetricsEntry
+	nil,                            // 27: therapeutic.streaming.v1.MetricsResponse.RatesEntry
+	nil,                            // 28: therapeutic.streaming.v1.MetricsResponse.HistogramsEntry
+	(*timestamppb.Timestamp)(nil),  // 29: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),    // 30: google.protobuf.Duration
+}
+var file_grpc_streaming_proto_depIdxs = []int32{
+	29, // 0: therapeutic.streaming.v1.ChatMessage.timestamp:type_name -> google.protobuf.Timestamp
+	24, // 1: therapeutic.streaming.v1.ChatMessage.metadata:type_name -> therapeutic.streaming.v1.ChatMessage.MetadataEntry
+	1,  // 2: therapeutic.streaming.v1.ChatMessage.error:type_name -> therapeutic.streaming.v1.StreamError
+	29, // 3: therapeutic.streaming.v1.MoodUpdate.timestamp:type_name -> google.protobuf.Timestamp
+	25, // 4: therapeutic.streaming.v1.MoodUpdate.emotions:type_name -> therapeutic.streaming.v1.MoodUpdate.EmotionsEntry
+	6,  // 5: therapeutic.streaming.v1.VoiceRequest.audio:type_name -> therapeutic.streaming.v1.AudioChunk
+	8,  // 6: therapeutic.streaming.v1.VoiceRequest.capabilities:type_name -> therapeutic.streaming.v1.AudioCapabilities
+	9,  // 7: therapeutic.streaming.v1.VoiceRequest.preferences:type_name -> therapeutic.streaming.v1.VoicePreferences
+	11, // 8: therapeutic.streaming.v1.VoiceRequest.speakers:type_name -> therapeutic.streaming.v1.SpeakerAssignment
+	6,  // 9: therapeutic.streaming.v1.VoiceResponse.audio:type_name -> therapeutic.streaming.v1.AudioChunk
+	7,  // 10: therapeutic.streaming.v1.VoiceResponse.output_format:type_name -> therapeutic.streaming.v1.AudioFormat
+	1,  // 11: therapeutic.streaming.v1.VoiceResponse.error:type_name -> therapeutic.streaming.v1.StreamError
+	29, // 12: therapeutic.streaming.v1.CrisisAlert.timestamp:type_name -> google.protobuf.Timestamp
+	13, // 13: therapeutic.streaming.v1.CrisisAlertResponse.alert:type_name -> therapeutic.streaming.v1.CrisisAlert
+	29, // 14: therapeutic.streaming.v1.CrisisAlertResponse.timestamp:type_name -> google.protobuf.Timestamp
+	30, // 15: therapeutic.streaming.v1.MetricsRequest.interval:type_name -> google.protobuf.Duration
+	26, // 16: therapeutic.streaming.v1.MetricsResponse.metrics:type_name -> therapeutic.streaming.v1.MetricsResponse.MetricsEntry
+	29, // 17: therapeutic.streaming.v1.MetricsResponse.timestamp:type_name -> google.protobuf.Timestamp
+	27, // 18: therapeutic.streaming.v1.MetricsResponse.rates:type_name -> therapeutic.streaming.v1.MetricsResponse.RatesEntry
+	28, // 19: therapeutic.streaming.v1.MetricsResponse.histograms:type_name -> therapeutic.streaming.v1.MetricsResponse.HistogramsEntry
+	22, // 20: therapeutic.streaming.v1.MetricsCatalogResponse.services:type_name -> therapeutic.streaming.v1.ServiceMetricsCatalog
+	20, // 21: therapeutic.streaming.v1.MetricsResponse.HistogramsEntry.value:type_name -> therapeutic.streaming.v1.HistogramSummary
+	0,  // 22: therapeutic.streaming.v1.TherapeuticService.Chat:input_type -> therapeutic.streaming.v1.ChatMessage
+	2,  // 23: therapeutic.streaming.v1.TherapeuticService.StreamSessionMood:input_type -> therapeutic.streaming.v1.SessionMoodRequest
+	4,  // 24: therapeutic.streaming.v1.TherapeuticService.ExportSession:input_type -> therapeutic.streaming.v1.ExportSessionRequest
+	10, // 25: therapeutic.streaming.v1.VoiceService.StreamVoice:input_type -> therapeutic.streaming.v1.VoiceRequest
+	14, // 26: therapeutic.streaming.v1.CrisisAlertService.StreamAlerts:input_type -> therapeutic.streaming.v1.CrisisAlertRequest
+	16, // 27: therapeutic.streaming.v1.CrisisAlertService.AcknowledgeAlerts:input_type -> therapeutic.streaming.v1.AlertAckRequest
+	18, // 28: therapeutic.streaming.v1.MetricsService.StreamMetrics:input_type -> therapeutic.streaming.v1.MetricsRequest
+	21, // 29: therapeutic.streaming.v1.MetricsService.ListMetrics:input_type -> therapeutic.streaming.v1.MetricsCatalogRequest
+	0,  // 30: therapeutic.streaming.v1.TherapeuticService.Chat:output_type -> therapeutic.streaming.v1.ChatMessage
+	3,  // 31: therapeutic.streaming.v1.TherapeuticService.StreamSessionMood:output_type -> therapeutic.streaming.v1.MoodUpdate
+	5,  // 32: therapeutic.streaming.v1.TherapeuticService.ExportSession:output_type -> therapeutic.streaming.v1.ExportSessionResponse
+	12, // 33: therapeutic.streaming.v1.VoiceService.StreamVoice:output_type -> therapeutic.streaming.v1.VoiceResponse
+	15, // 34: therapeutic.streaming.v1.CrisisAlertService.StreamAlerts:output_type -> therapeutic.streaming.v1.CrisisAlertResponse
+	17, // 35: therapeutic.streaming.v1.CrisisAlertService.AcknowledgeAlerts:output_type -> therapeutic.streaming.v1.AlertAckResponse
+	19, // 36: therapeutic.streaming.v1.MetricsService.StreamMetrics:output_type -> therapeutic.streaming.v1.MetricsResponse
+	23, // 37: therapeutic.streaming.v1.MetricsService.ListMetrics:output_type -> therapeutic.streaming.v1.MetricsCatalogResponse
+	30, // [30:38] is the sub-list for method output_type
+	22, // [22:30] is the sub-list for method input_type
+	22, // [22:22] is the sub-list for extension type_name
+	22, // [22:22] is the sub-list for extension extendee
+	0,  // [0:22] is the sub-list for field type_name
+}
+
+func init() { file_grpc_streaming_proto_init() }
+func file_grpc_streaming_proto_init() {
+	if File_grpc_streaming_proto != nil {
+		return
+	}
+	file_grpc_streaming_proto_msgTypes[9].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_grpc_streaming_proto_rawDesc), len(file_grpc_streaming_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   29,
+			NumExtensions: 0,
+			NumServices:   4,
+		},
+		GoTypes:           file_grpc_streaming_proto_goTypes,
+		DependencyIndexes: file_grpc_streaming_proto_depIdxs,
+		MessageInfos:      file_grpc_streaming_proto_msgTypes,
+	}.Build()
+	File_grpc_streaming_proto = out.File
+	file_grpc_streaming_proto_goTypes = nil
+	file_grpc_streaming_proto_depIdxs = nil
+}
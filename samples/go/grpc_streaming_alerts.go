@@ -0,0 +1,281 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Alert delivery limits
+const (
+	alertAckTimeout     = 30 * time.Second // Unacknowledged alerts are sent again after this
+	alertMaxDeliveries  = 5
+	activeAlertTTL      = 7 * 24 * time.Hour
+	alertDeliveryLogTTL = 7 * 24 * time.Hour
+)
+
+// Alert statuses, as set by the crisis service
+const (
+	alertStatusActive   = "ACTIVE"
+	alertStatusResolved = "RESOLVED"
+)
+
+// activeAlertsKey holds a facility's unresolved alerts, keyed by alert ID
+func activeAlertsKey(facilityID string) string {
+	return fmt.Sprintf("crisis:active:facility:%s", facilityID)
+}
+
+// alertAckChannel carries acknowledgments to the instance serving a stream
+func alertAckChannel(streamID string) string {
+	return fmt.Sprintf("crisis:acks:%s", streamID)
+}
+
+// alertDeliveriesKey records which dashboard streams confirmed an alert
+func alertDeliveriesKey(alertID string) string {
+	return fmt.Sprintf("crisis:deliveries:%s", alertID)
+}
+
+// alertStatus returns an alert's status; alerts published without one are
+// new
+func alertStatus(alert *CrisisAlert) string {
+	if alert.Status == "" {
+		return alertStatusActive
+	}
+	return alert.Status
+}
+
+// PublishAlert broadcasts an alert to a facility's dashboards and keeps the
+// facility's unresolved alerts current so reconnecting dashboards can
+// replay them. Publishers should use it, or maintain the same keys, for
+// replay to see their alerts.
+func (s *CrisisAlertStreamServer) PublishAlert(ctx context.Context, facilityID string, alert *CrisisAlert) error {
+	if alert.Id == "" {
+		alert.Id = uuid.New().String()
+	}
+	if alert.Timestamp == nil {
+		alert.Timestamp = timestamppb.Now()
+	}
+
+	data, err := protojson.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	key := activeAlertsKey(facilityID)
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if alertStatus(alert) == alertStatusResolved {
+			pipe.HDel(ctx, key, alert.Id)
+		} else {
+			pipe.HSet(ctx, key, alert.Id, data)
+			pipe.Expire(ctx, key, activeAlertTTL)
+		}
+		pipe.Publish(ctx, fmt.Sprintf("crisis:facility:%s", facilityID), data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish alert: %w", err)
+	}
+	return nil
+}
+
+// activeAlerts loads a facility's unresolved alerts, oldest first
+func (s *CrisisAlertStreamServer) activeAlerts(ctx context.Context, facilityID string) ([]*CrisisAlert, error) {
+	raw, err := s.redis.HGetAll(ctx, activeAlertsKey(facilityID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active alerts: %w", err)
+	}
+
+	alerts := make([]*CrisisAlert, 0, len(raw))
+	for _, item := range raw {
+		alert := &CrisisAlert{}
+		if err := redisJSON.Unmarshal([]byte(item), alert); err != nil {
+			s.logger.Warn("skipping unreadable active alert",
+				slog.String("facility_id", facilityID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Timestamp.AsTime().Before(alerts[j].Timestamp.AsTime())
+	})
+	return alerts, nil
+}
+
+// alertFilter selects the alerts a subscriber asked for
+type alertFilter struct {
+	minRank  int
+	statuses map[string]bool // Empty allows every status
+}
+
+// newAlertFilter builds a filter from a subscription request
+func newAlertFilter(req *CrisisAlertRequest) (*alertFilter, error) {
+	f := &alertFilter{statuses: make(map[string]bool)}
+	if req.MinLevel != "" {
+		rank, ok := crisisLevelRank[req.MinLevel]
+		if !ok {
+			return nil, fmt.Errorf("unknown crisis level %q", req.MinLevel)
+		}
+		f.minRank = rank
+	}
+	for _, st := range req.Statuses {
+		f.statuses[st] = true
+	}
+	return f, nil
+}
+
+// matches reports whether an alert passes the filter
+func (f *alertFilter) matches(alert *CrisisAlert) bool {
+	if crisisLevelRank[alert.Level] < f.minRank {
+		return false
+	}
+	return len(f.statuses) == 0 || f.statuses[alertStatus(alert)]
+}
+
+// alertDelivery is an alert sent on a stream and not yet acknowledged
+type alertDelivery struct {
+	response *CrisisAlertResponse
+	sentAt   time.Time
+	attempts int
+}
+
+// alertStream tracks one dashboard subscription's deliveries. It is owned
+// by the stream's handler goroutine.
+type alertStream struct {
+	id      string
+	stream  grpc.ServerStreamingServer[CrisisAlertResponse]
+	nextID  int64
+	pending map[int64]*alertDelivery
+}
+
+// newAlertStream starts tracking a subscription
+func newAlertStream(stream grpc.ServerStreamingServer[CrisisAlertResponse]) *alertStream {
+	return &alertStream{
+		id:      uuid.New().String(),
+		stream:  stream,
+		pending: make(map[int64]*alertDelivery),
+	}
+}
+
+// deliver sends an alert and holds it until acknowledged
+func (as *alertStream) deliver(alert *CrisisAlert, replayed bool) error {
+	as.nextID++
+	response := &CrisisAlertResponse{
+		Alert:      alert,
+		Timestamp:  timestamppb.Now(),
+		StreamId:   as.id,
+		DeliveryId: as.nextID,
+		Replayed:   replayed,
+	}
+	as.pending[as.nextID] = &alertDelivery{response: response, sentAt: time.Now(), attempts: 1}
+	return as.stream.Send(response)
+}
+
+// acknowledge releases confirmed deliveries and returns them
+func (as *alertStream) acknowledge(ids []int64) []*alertDelivery {
+	var acked []*alertDelivery
+	for _, id := range ids {
+		if d, ok := as.pending[id]; ok {
+			acked = append(acked, d)
+			delete(as.pending, id)
+		}
+	}
+	return acked
+}
+
+// redeliver resends alerts that have waited too long for acknowledgment
+// and reports those given up on
+func (as *alertStream) redeliver(now time.Time) ([]*alertDelivery, error) {
+	var abandoned []*alertDelivery
+	for id, d := range as.pending {
+		if now.Sub(d.sentAt) < alertAckTimeout {
+			continue
+		}
+		if d.attempts >= alertMaxDeliveries {
+			abandoned = append(abandoned, d)
+			delete(as.pending, id)
+			continue
+		}
+
+		d.attempts++
+		d.sentAt = now
+		d.response.Redelivered = true
+		d.response.Timestamp = timestamppb.Now()
+		if err := as.stream.Send(d.response); err != nil {
+			return abandoned, err
+		}
+	}
+	return abandoned, nil
+}
+
+// handleAcknowledgment releases the deliveries named in a forwarded
+// acknowledgment and records who was shown each alert
+func (s *CrisisAlertStreamServer) handleAcknowledgment(ctx context.Context, as *alertStream, userID, payload string) {
+	var ids []int64
+	if err := json.Unmarshal([]byte(payload), &ids); err != nil {
+		s.logger.Warn("ignoring malformed alert acknowledgment",
+			slog.String("stream_id", as.id),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	acked := as.acknowledge(ids)
+	if len(acked) == 0 {
+		return
+	}
+	entry, _ := json.Marshal(map[string]any{
+		"user_id":         userID,
+		"acknowledged_at": time.Now(),
+	})
+
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range acked {
+			if d.response.Alert.Id == "" {
+				continue
+			}
+			key := alertDeliveriesKey(d.response.Alert.Id)
+			pipe.HSet(ctx, key, as.id, entry)
+			pipe.Expire(ctx, key, alertDeliveryLogTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("failed to record alert acknowledgments",
+			slog.String("stream_id", as.id),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// AcknowledgeAlerts confirms deliveries on a stream, which may be served
+// by another instance
+func (s *CrisisAlertStreamServer) AcknowledgeAlerts(ctx context.Context, req *AlertAckRequest) (*AlertAckResponse, error) {
+	if req.StreamId == "" || len(req.DeliveryIds) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "stream_id and delivery_ids required")
+	}
+
+	data, err := json.Marshal(req.DeliveryIds)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to encode acknowledgment")
+	}
+	receivers, err := s.redis.Publish(ctx, alertAckChannel(req.StreamId), data).Result()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "failed to forward acknowledgment")
+	}
+	if receivers == 0 {
+		return nil, status.Error(codes.NotFound, "alert stream not found")
+	}
+	return &AlertAckResponse{}, nil
+}
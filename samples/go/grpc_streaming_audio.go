@@ -0,0 +1,302 @@
+package streaming
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNoCommonAudioFormat is returned when a client can play none of the
+// formats the server can produce
+var ErrNoCommonAudioFormat = errors.New("no common audio format")
+
+// AudioCodec converts between an encoding and interleaved 16-bit PCM.
+// Codecs backed by native libraries, such as opus and webm, are registered
+// by the deployment.
+type AudioCodec interface {
+	Name() string
+	NewDecoder(format *AudioFormat) (AudioDecoder, error)
+	NewEncoder(format *AudioFormat) (AudioEncoder, error)
+}
+
+// AudioDecoder decodes one stream of audio
+type AudioDecoder interface {
+	Decode(data []byte) ([]int16, error)
+}
+
+// AudioEncoder encodes one stream of audio
+type AudioEncoder interface {
+	Encode(samples []int16) ([]byte, error)
+	// Flush returns any partially filled frame at the end of the stream
+	Flush() ([]byte, error)
+}
+
+// RegisterCodec adds a codec that responses may be transcoded to or from.
+// It must be called before the server starts accepting streams.
+func (s *VoiceStreamServer) RegisterCodec(codec AudioCodec) {
+	s.codecs[codec.Name()] = codec
+}
+
+// SetTTSFormat declares the format the TTS client produces. It must be
+// called before the server starts accepting streams.
+func (s *VoiceStreamServer) SetTTSFormat(format *AudioFormat) {
+	s.ttsFormat = format
+}
+
+// sameFormat reports whether audio can pass between formats untouched
+func sameFormat(a, b *AudioFormat) bool {
+	return a.Format == b.Format && a.SampleRate == b.SampleRate && a.Channels == b.Channels
+}
+
+// negotiateOutput picks the response audio format from what a client says
+// it can play. Clients that don't say get the TTS format unchanged.
+func (s *VoiceStreamServer) negotiateOutput(caps *AudioCapabilities) (*AudioFormat, error) {
+	if caps == nil || len(caps.Formats) == 0 {
+		return s.ttsFormat, nil
+	}
+
+	for _, name := range caps.Formats {
+		candidate := &AudioFormat{
+			Format:     name,
+			SampleRate: s.ttsFormat.SampleRate,
+			Channels:   s.ttsFormat.Channels,
+		}
+		if caps.SampleRate > 0 {
+			candidate.SampleRate = caps.SampleRate
+		}
+		if caps.Channels > 0 {
+			candidate.Channels = caps.Channels
+		}
+
+		if sameFormat(candidate, s.ttsFormat) {
+			return candidate, nil
+		}
+		_, canDecode := s.codecs[s.ttsFormat.Format]
+		_, canEncode := s.codecs[name]
+		if canDecode && canEncode {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: client accepts %v", ErrNoCommonAudioFormat, caps.Formats)
+}
+
+// newTranscoder converts synthesized audio to the negotiated format. A nil
+// transcoder passes audio through.
+func (s *VoiceStreamServer) newTranscoder(output *AudioFormat) (*transcoder, error) {
+	if sameFormat(s.ttsFormat, output) {
+		return nil, nil
+	}
+
+	decoder, err := s.codecs[s.ttsFormat.Format].NewDecoder(s.ttsFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s decoder: %w", s.ttsFormat.Format, err)
+	}
+	encoder, err := s.codecs[output.Format].NewEncoder(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s encoder: %w", output.Format, err)
+	}
+	return &transcoder{
+		decoder: decoder,
+		encoder: encoder,
+		from:    s.ttsFormat,
+		to:      output,
+	}, nil
+}
+
+// transcoder decodes, remixes, resamples and re-encodes one audio stream
+type transcoder struct {
+	decoder AudioDecoder
+	encoder AudioEncoder
+	from    *AudioFormat
+	to      *AudioFormat
+
+	// Resampler state carried across chunks
+	phase float64
+	prev  []int16
+}
+
+// transcode converts one chunk. The result may be empty while an encoder
+// fills a frame.
+func (t *transcoder) transcode(data []byte) ([]byte, error) {
+	samples, err := t.decoder.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
+	}
+	samples = remix(samples, int(t.from.Channels), int(t.to.Channels))
+	samples = t.resample(samples)
+
+	encoded, err := t.encoder.Encode(samples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audio: %w", err)
+	}
+	return encoded, nil
+}
+
+// flush returns the encoder's final partial frame
+func (t *transcoder) flush() ([]byte, error) {
+	return t.encoder.Flush()
+}
+
+// remix converts interleaved samples between channel counts. Downmixing to
+// mono averages channels; otherwise channels are repeated or dropped.
+func remix(samples []int16, from, to int) []int16 {
+	if from <= 0 || to <= 0 || from == to {
+		return samples
+	}
+
+	frames := len(samples) / from
+	out := make([]int16, frames*to)
+	for f := 0; f < frames; f++ {
+		in := samples[f*from : (f+1)*from]
+		if to == 1 {
+			var sum int
+			for _, sample := range in {
+				sum += int(sample)
+			}
+			out[f] = int16(sum / from)
+			continue
+		}
+		for c := 0; c < to; c++ {
+			out[f*to+c] = in[c%from]
+		}
+	}
+	return out
+}
+
+// resample converts interleaved samples to the output rate by linear
+// interpolation, continuing from where the previous chunk left off
+func (t *transcoder) resample(samples []int16) []int16 {
+	channels := int(t.to.Channels)
+	if channels <= 0 {
+		channels = 1
+	}
+	if t.from.SampleRate <= 0 || t.to.SampleRate <= 0 || t.from.SampleRate == t.to.SampleRate {
+		return samples
+	}
+
+	// The last frame of the previous chunk is index 0 when present
+	frames := append(append([]int16{}, t.prev...), samples...)
+	count := len(frames) / channels
+	if count == 0 {
+		return nil
+	}
+
+	step := float64(t.from.SampleRate) / float64(t.to.SampleRate)
+	var out []int16
+	pos := t.phase
+	for ; int(pos)+1 < count; pos += step {
+		i := int(pos)
+		frac := pos - float64(i)
+		for c := 0; c < channels; c++ {
+			a := float64(frames[i*channels+c])
+			b := float64(frames[(i+1)*channels+c])
+			out = append(out, int16(math.Round(a+(b-a)*frac)))
+		}
+	}
+
+	t.prev = append(t.prev[:0], frames[(count-1)*channels:count*channels]...)
+	t.phase = pos - float64(count-1)
+	return out
+}
+
+// pcmCodec is raw 16-bit little-endian PCM
+type pcmCodec struct{}
+
+func (pcmCodec) Name() string { return "pcm" }
+
+func (pcmCodec) NewDecoder(*AudioFormat) (AudioDecoder, error) { return pcmDecoder{}, nil }
+
+func (pcmCodec) NewEncoder(*AudioFormat) (AudioEncoder, error) { return pcmEncoder{}, nil }
+
+// pcmDecoder decodes raw PCM
+type pcmDecoder struct{}
+
+func (pcmDecoder) Decode(data []byte) ([]int16, error) {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples, nil
+}
+
+// pcmEncoder encodes raw PCM
+type pcmEncoder struct{}
+
+func (pcmEncoder) Encode(samples []int16) ([]byte, error) {
+	data := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	return data, nil
+}
+
+func (pcmEncoder) Flush() ([]byte, error) { return nil, nil }
+
+// wavHeaderSize is the size of a canonical PCM WAV header
+const wavHeaderSize = 44
+
+// wavCodec is PCM with a WAV header at the start of each stream. Streamed
+// headers leave the length unset, as players of live audio expect.
+type wavCodec struct{}
+
+func (wavCodec) Name() string { return "wav" }
+
+func (wavCodec) NewDecoder(*AudioFormat) (AudioDecoder, error) { return &wavDecoder{}, nil }
+
+func (wavCodec) NewEncoder(format *AudioFormat) (AudioEncoder, error) {
+	return &wavEncoder{format: format}, nil
+}
+
+// wavDecoder strips the header from the first chunk
+type wavDecoder struct {
+	started bool
+}
+
+func (d *wavDecoder) Decode(data []byte) ([]int16, error) {
+	if !d.started {
+		d.started = true
+		if len(data) >= wavHeaderSize && string(data[:4]) == "RIFF" {
+			data = data[wavHeaderSize:]
+		}
+	}
+	return pcmDecoder{}.Decode(data)
+}
+
+// wavEncoder writes a header before the first chunk
+type wavEncoder struct {
+	format  *AudioFormat
+	started bool
+}
+
+func (e *wavEncoder) Encode(samples []int16) ([]byte, error) {
+	data, _ := pcmEncoder{}.Encode(samples)
+	if e.started {
+		return data, nil
+	}
+	e.started = true
+	return append(wavHeader(e.format), data...), nil
+}
+
+func (e *wavEncoder) Flush() ([]byte, error) { return nil, nil }
+
+// wavHeader builds a streaming PCM WAV header
+func wavHeader(format *AudioFormat) []byte {
+	channels := uint16(max(format.Channels, 1))
+	rate := uint32(format.SampleRate)
+
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], math.MaxUint32)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], channels)
+	binary.LittleEndian.PutUint32(header[24:], rate)
+	binary.LittleEndian.PutUint32(header[28:], rate*uint32(channels)*2)
+	binary.LittleEndian.PutUint16(header[32:], channels*2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], math.MaxUint32)
+	return header
+}
@@ -0,0 +1,251 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// metaCached marks responses served from the response cache
+const metaCached = "cached"
+
+// Embedder turns text into embedding vectors for similarity matching. The
+// crisis service's AI router client satisfies it.
+type Embedder interface {
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+}
+
+// ResponseCacheConfig controls reuse of responses to repeated prompts
+type ResponseCacheConfig struct {
+	Intents       []string      // Only these intents are cached, e.g. greetings and orientation questions
+	MinConfidence float64       // Intent classifications below this are never cached
+	Similarity    float64       // Minimum cosine similarity for a prompt to match
+	MaxLength     int           // Longer messages are never cached; they are rarely repeats
+	MaxEntries    int           // Responses kept per resident
+	TTL           time.Duration // A resident's cache expires this long after its last write
+}
+
+// DefaultResponseCacheConfig returns cache settings for the everyday
+// prompts memory-care residents tend to repeat
+func DefaultResponseCacheConfig() *ResponseCacheConfig {
+	return &ResponseCacheConfig{
+		Intents:       []string{"greeting", "farewell", "small_talk", "orientation"},
+		MinConfidence: 0.85,
+		Similarity:    0.95,
+		MaxLength:     200,
+		MaxEntries:    100,
+		TTL:           6 * time.Hour,
+	}
+}
+
+// SetResponseCache enables the response cache. Caching is off until this
+// is called; a nil embedder turns it off again. It must be called before
+// the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetResponseCache(embedder Embedder, config *ResponseCacheConfig) {
+	s.embedder = embedder
+	s.responseCache = config
+}
+
+// cachedResponse is a stored response and the prompt it answered
+type cachedResponse struct {
+	Prompt    string    `json:"prompt"`
+	Embedding []float32 `json:"embedding"`
+	Intent    string    `json:"intent"`
+	AgentType string    `json:"agent_type"`
+	Response  string    `json:"response"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// responseCacheKey holds a resident's cached responses. Caches are per
+// resident since responses may address them personally.
+func responseCacheKey(userID string) string {
+	return fmt.Sprintf("response_cache:user:%s", userID)
+}
+
+// cacheProbe is a cacheable turn's prompt, looked up before generation and
+// stored after it
+type cacheProbe struct {
+	key       string
+	prompt    string
+	embedding []float32
+	intent    string
+	agentType string
+}
+
+// cacheable reports whether a turn is safe to answer from, or store in,
+// the cache. Anything near a crisis is excluded: a detected or unknown
+// crisis level, crisis mode, or a crisis anywhere in the recent history.
+func (s *TherapeuticStreamServer) cacheable(
+	state *StreamState,
+	prompt string,
+	crisis *CrisisResult,
+	intent *IntentResult,
+	history []*ChatMessage,
+) bool {
+	config := s.responseCache
+	if s.embedder == nil || config == nil {
+		return false
+	}
+	if crisis == nil || (crisis.Level != "" && crisis.Level != "NONE") || state.inCrisisMode() {
+		return false
+	}
+	for _, msg := range history {
+		if msg.CrisisLevel != "" && msg.CrisisLevel != "NONE" {
+			return false
+		}
+	}
+	if intent.AgentType == crisisAgentType || intent.Confidence < config.MinConfidence {
+		return false
+	}
+	return containsString(config.Intents, intent.Intent) && len([]rune(prompt)) <= config.MaxLength
+}
+
+// probeCache looks a prompt up in the resident's cache. It returns the
+// matching response if there is one, and a probe to store the generated
+// response under if not.
+func (s *TherapeuticStreamServer) probeCache(ctx context.Context, state *StreamState, prompt string, intent *IntentResult) (*cachedResponse, *cacheProbe) {
+	embedding, err := s.embedder.GetEmbedding(ctx, prompt)
+	if err != nil {
+		s.logger.Warn("failed to embed prompt for response cache",
+			slog.String("session_id", state.SessionID),
+			slog.String("error", err.Error()),
+		)
+		return nil, nil
+	}
+	probe := &cacheProbe{
+		key:       responseCacheKey(state.UserID),
+		prompt:    prompt,
+		embedding: embedding,
+		intent:    intent.Intent,
+		agentType: intent.AgentType,
+	}
+
+	entries, err := s.redis.LRange(ctx, probe.key, 0, -1).Result()
+	if err != nil {
+		s.logger.Warn("failed to read response cache",
+			slog.String("session_id", state.SessionID),
+			slog.String("error", err.Error()),
+		)
+		return nil, probe
+	}
+
+	var best *cachedResponse
+	bestScore := s.responseCache.Similarity
+	for _, data := range entries {
+		var entry cachedResponse
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			continue
+		}
+		if entry.Intent != probe.intent || entry.AgentType != probe.agentType {
+			continue
+		}
+		if score := cosineSimilarity(embedding, entry.Embedding); score >= bestScore {
+			best, bestScore = &entry, score
+		}
+	}
+	return best, probe
+}
+
+// storeCachedResponse saves a complete generated response for reuse
+func (s *TherapeuticStreamServer) storeCachedResponse(ctx context.Context, probe *cacheProbe, response string) {
+	data, err := json.Marshal(&cachedResponse{
+		Prompt:    probe.prompt,
+		Embedding: probe.embedding,
+		Intent:    probe.intent,
+		AgentType: probe.agentType,
+		Response:  response,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, probe.key, data)
+		pipe.LTrim(ctx, probe.key, -int64(s.responseCache.MaxEntries), -1)
+		pipe.Expire(ctx, probe.key, s.responseCache.TTL)
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("failed to store cached response",
+			slog.String("key", probe.key),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// sendCachedResponse answers a turn from the cache, translated for
+// residents who don't write in English
+func (s *TherapeuticStreamServer) sendCachedResponse(
+	ctx context.Context,
+	state *StreamState,
+	turn translation,
+	routing *routingDecision,
+	hit *cachedResponse,
+) error {
+	msg := &ChatMessage{
+		SessionId: state.SessionID,
+		UserId:    state.UserID,
+		Role:      RoleAssistant,
+		Content:   hit.Response,
+		Timestamp: timestamppb.Now(),
+		AgentType: hit.AgentType,
+		IsFinal:   true,
+		Metadata:  map[string]string{metaCached: "true"},
+	}
+	stored := &ChatMessage{
+		SessionId: msg.SessionId,
+		UserId:    msg.UserId,
+		Role:      msg.Role,
+		Content:   msg.Content,
+		Timestamp: msg.Timestamp,
+		AgentType: msg.AgentType,
+		IsFinal:   true,
+		Metadata:  routing.metadata(),
+	}
+	stored.Metadata[metaCached] = "true"
+
+	if turn.language != "" {
+		if text, ok := s.translateOutbound(ctx, state.SessionID, turn.language, hit.Response); ok {
+			msg.Content = text
+			msg.Metadata[metaLanguage] = turn.language
+			annotateTranslation(stored, turn.language, stored.Content)
+			stored.Content = text
+		}
+	}
+	s.recordMessage(ctx, stored)
+
+	if err := state.parties.send(msg); err != nil {
+		return fmt.Errorf("failed to send response: %w", err)
+	}
+	s.logger.Info("message answered from cache",
+		slog.String("session_id", state.SessionID),
+		slog.String("intent", hit.Intent),
+		slog.String("agent", hit.AgentType),
+	)
+	return nil
+}
+
+// cosineSimilarity compares two embeddings; vectors of different lengths
+// never match
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,140 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// crisisLevelRank orders the levels reported by crisis analysis
+var crisisLevelRank = map[string]int{
+	"NONE":      0,
+	"MODERATE":  1,
+	"ELEVATED":  2,
+	"URGENT":    3,
+	"IMMEDIATE": 4,
+}
+
+// crisisAgentType handles generation while a session is in crisis mode
+const crisisAgentType = "crisis"
+
+// crisisProtocolResponse is sent in place of generated content when a
+// crisis interrupts the conversation
+const crisisProtocolResponse = "I'm concerned about your safety right now. Your care team has been notified and someone will be with you shortly. If you are in immediate danger, please call 988 or 911."
+
+// crisisAcknowledgment is sent when a crisis below URGENT is reported
+const crisisAcknowledgment = "I'm concerned about what you've shared. Your care team has been notified and will reach out shortly."
+
+// Guests have no care team; the crisis service alerts the facility front
+// desk instead
+const (
+	guestCrisisProtocolResponse = "I'm concerned about your safety right now. The front desk has been alerted and a staff member will be with you shortly. If you are in immediate danger, please call 988 or 911."
+	guestCrisisAcknowledgment   = "I'm concerned about what you've shared. The front desk has been alerted and a staff member will check in with you shortly."
+)
+
+// crisisNotices returns the protocol response and acknowledgment for the
+// session, which tell guests the front desk is coming
+func (st *StreamState) crisisNotices() (protocol, acknowledgment string) {
+	if st.Guest {
+		return guestCrisisProtocolResponse, guestCrisisAcknowledgment
+	}
+	return crisisProtocolResponse, crisisAcknowledgment
+}
+
+// interruptsGeneration reports whether a crisis level is severe enough to
+// stop AI generation (URGENT or above)
+func interruptsGeneration(level string) bool {
+	return crisisLevelRank[level] >= crisisLevelRank["URGENT"]
+}
+
+// enterCrisisMode cancels any in-flight generation and places the session
+// under supervision. It reports whether the session was newly switched.
+func (st *StreamState) enterCrisisMode(level string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.cancelGeneration != nil {
+		st.cancelGeneration(errCrisisInterrupt)
+		st.cancelGeneration = nil
+	}
+	if crisisLevelRank[level] > crisisLevelRank[st.CrisisStatus] {
+		st.CrisisStatus = level
+	}
+	if st.CrisisMode {
+		return false
+	}
+	st.CrisisMode = true
+	st.CrisisModeSince = time.Now()
+	return true
+}
+
+// inCrisisMode reports whether the session is under crisis supervision
+func (st *StreamState) inCrisisMode() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.CrisisMode
+}
+
+// interruptForCrisis stops generation for a session, switches it into
+// crisis mode and sends the crisis protocol response
+func (s *TherapeuticStreamServer) interruptForCrisis(
+	ctx context.Context,
+	state *StreamState,
+	level string,
+) error {
+	if state.enterCrisisMode(level) {
+		s.logger.Warn("session entered crisis mode",
+			slog.String("session_id", state.SessionID),
+			slog.String("user_id", state.UserID),
+			slog.String("level", level),
+		)
+	}
+
+	// Don't keep delivering a response the crisis has superseded
+	state.parties.discardPartials()
+
+	response, _ := state.crisisNotices()
+	protocolMsg := &ChatMessage{
+		SessionId:   state.SessionID,
+		UserId:      state.UserID,
+		Role:        RoleSystem,
+		Content:     response,
+		Timestamp:   timestamppb.Now(),
+		CrisisLevel: level,
+		IsFinal:     true,
+		Metadata:    map[string]string{"type": "crisis_protocol"},
+	}
+	s.localizeNotice(ctx, state, protocolMsg)
+	s.recordMessage(ctx, protocolMsg)
+	return state.parties.send(protocolMsg)
+}
+
+// ExitCrisisMode returns a session to normal generation once the care team
+// has resolved the crisis
+func (s *TherapeuticStreamServer) ExitCrisisMode(sessionID, clinicianID string) error {
+	stateI, ok := s.sessions.Load(sessionID)
+	if !ok {
+		return errors.New("session not found")
+	}
+	state := stateI.(*StreamState)
+
+	state.mu.Lock()
+	wasInCrisis := state.CrisisMode
+	since := state.CrisisModeSince
+	state.CrisisMode = false
+	state.CrisisStatus = ""
+	state.CrisisModeSince = time.Time{}
+	state.mu.Unlock()
+
+	if wasInCrisis {
+		s.logger.Info("session left crisis mode",
+			slog.String("session_id", sessionID),
+			slog.String("clinician_id", clinicianID),
+			slog.Duration("duration", time.Since(since)),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package streaming
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxSpeakers caps the speaker-count a session may ask diarization for
+const maxSpeakers = 8
+
+// Metadata recorded on voice transcript turns in diarized sessions
+const (
+	metaSpeaker       = "speaker"
+	metaSpeakerRole   = "speaker_role"
+	metaSpeakerName   = "speaker_name"
+	metaCrisisSkipped = "crisis_analysis_skipped"
+)
+
+// DiarizingSTTClient is an STTClient that can tell speakers apart. Each
+// result's Speaker labels who said it.
+type DiarizingSTTClient interface {
+	STTClient
+	StreamTranscribeSpeakers(ctx context.Context, audioStream <-chan []byte, speakers int) (<-chan *TranscriptionResult, error)
+}
+
+// startTranscription starts the STT stream, diarized when the session has
+// several speakers and the STT supports it
+func (s *VoiceStreamServer) startTranscription(ctx context.Context, md metadata.MD, audioIn <-chan []byte) (<-chan *TranscriptionResult, error) {
+	speakers, _ := strconv.Atoi(extractMetadata(md, "speaker-count"))
+	if diarizer, ok := s.sttClient.(DiarizingSTTClient); ok && speakers > 1 {
+		return diarizer.StreamTranscribeSpeakers(ctx, audioIn, min(speakers, maxSpeakers))
+	}
+	return s.sttClient.StreamTranscribe(ctx, audioIn)
+}
+
+// speakerMap holds who each diarization label is, as the client assigns
+// them
+type speakerMap struct {
+	mu       sync.Mutex
+	assigned map[string]*SpeakerAssignment
+}
+
+// assign records speaker assignments
+func (m *speakerMap) assign(assignments []*SpeakerAssignment) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.assigned == nil {
+		m.assigned = make(map[string]*SpeakerAssignment)
+	}
+	for _, a := range assignments {
+		if a.Label != "" {
+			m.assigned[a.Label] = a
+		}
+	}
+}
+
+// identify returns who a label was assigned to, or nil
+func (m *speakerMap) identify(label string) *SpeakerAssignment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.assigned[label]
+}
+
+// speaker is who said a transcribed turn
+type speaker struct {
+	label      string
+	assignment *SpeakerAssignment // Nil until the client assigns the label
+}
+
+// speaker looks up who said a turn
+func (m *speakerMap) speaker(label string) speaker {
+	return speaker{label: label, assignment: m.identify(label)}
+}
+
+// role returns the speaker's assigned role, or "" if unassigned
+func (sp speaker) role() string {
+	if sp.assignment == nil {
+		return ""
+	}
+	return sp.assignment.Role
+}
+
+// isResident reports whether the turn should be treated as the
+// resident's. Undiarized and unassigned speech counts, so nothing the
+// resident says escapes crisis analysis before speakers are identified.
+func (sp speaker) isResident() bool {
+	role := sp.role()
+	return role == "" || role == string(ParticipantResident)
+}
+
+// turn builds the transcript message for something the speaker said
+func (sp speaker) turn(sessionID, userID, text string) *ChatMessage {
+	msg := &ChatMessage{
+		SessionId: sessionID,
+		UserId:    userID,
+		Role:      RoleUser,
+		Content:   text,
+		Timestamp: timestamppb.Now(),
+		IsFinal:   true,
+	}
+	if sp.label == "" {
+		return msg
+	}
+	msg.Metadata = map[string]string{metaSpeaker: sp.label}
+	if a := sp.assignment; a != nil {
+		msg.Metadata[metaSpeakerRole] = a.Role
+		if a.Name != "" {
+			msg.Metadata[metaSpeakerName] = a.Name
+		}
+		if a.ParticipantId != "" && !sp.isResident() {
+			msg.UserId = a.ParticipantId
+		}
+	}
+	return msg
+}
+
+// tag labels a voice response with the speaker it answers
+func (sp speaker) tag(resp *VoiceResponse) *VoiceResponse {
+	resp.Speaker = sp.label
+	resp.SpeakerRole = sp.role()
+	return resp
+}
+
+// analyzeUtterance runs crisis analysis on a resident's turn and reports
+// what it finds. Other speakers' turns are marked as skipped: a family
+// member describing a hard week is not the resident in crisis.
+func (s *VoiceStreamServer) analyzeUtterance(ctx context.Context, sessionID, userID string, sp speaker, turn *ChatMessage) *StreamError {
+	if !sp.isResident() {
+		if turn.Metadata == nil {
+			turn.Metadata = make(map[string]string)
+		}
+		turn.Metadata[metaCrisisSkipped] = "true"
+		return nil
+	}
+
+	result, err := s.aiRouter.AnalyzeCrisis(ctx, turn.Content, &CrisisContext{})
+	if err != nil {
+		return newStreamError(s.logger, sessionID, ComponentCrisisAnalysis, err, "", false)
+	}
+	if result.Level == "" || result.Level == "NONE" {
+		return nil
+	}
+	turn.CrisisLevel = result.Level
+	s.crisis.ReportCrisis(ctx, &CrisisAlert{
+		UserId:    userID,
+		SessionId: sessionID,
+		Level:     result.Level,
+		Message:   turn.Content,
+		Timestamp: timestamppb.Now(),
+	})
+	return nil
+}
@@ -0,0 +1,121 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// controlError reports a pipeline failure; the message's Error says what
+// failed and whether to retry
+const controlError = "error"
+
+// Stream error codes
+const (
+	ErrorCodeUnavailable = "unavailable"
+	ErrorCodeTimeout     = "timeout"
+	ErrorCodeRateLimited = "rate_limited"
+	ErrorCodeInvalid     = "invalid"
+	ErrorCodeInternal    = "internal"
+)
+
+// Pipeline components that can fail
+const (
+	ComponentCrisisAnalysis = "crisis_analysis"
+	ComponentIntent         = "intent_classification"
+	ComponentGeneration     = "generation"
+	ComponentTranscription  = "transcription"
+	ComponentSynthesis      = "speech_synthesis"
+	ComponentTranscoding    = "audio_transcoding"
+)
+
+// What the server did in place of a failed component
+const (
+	FallbackTextOnly     = "text_only"     // The response is sent as text without audio
+	FallbackDefaultAgent = "default_agent" // The conversational agent answers
+)
+
+// errorNotices are shown to residents when a component fails. Failures
+// residents can't act on have none.
+var errorNotices = map[string]string{
+	ComponentGeneration:    "I'm having trouble answering right now. Please try again in a moment.",
+	ComponentTranscription: "I couldn't hear that. Please try again, or type your message instead.",
+	ComponentSynthesis:     "Voice is temporarily unavailable, so I'll reply in text for now.",
+	ComponentTranscoding:   "Voice is temporarily unavailable, so I'll reply in text for now.",
+}
+
+// classifyError maps a failure to a stream error code and whether retrying
+// may help
+func classifyError(err error) (string, bool) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCodeTimeout, true
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return ErrorCodeInternal, false
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.Aborted:
+		return ErrorCodeUnavailable, true
+	case codes.DeadlineExceeded:
+		return ErrorCodeTimeout, true
+	case codes.ResourceExhausted:
+		return ErrorCodeRateLimited, true
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return ErrorCodeInvalid, false
+	}
+	return ErrorCodeInternal, false
+}
+
+// newStreamError describes a component failure for clients and logs it
+// under a correlation ID the client can quote
+func newStreamError(logger *slog.Logger, sessionID, component string, err error, fallback string, terminal bool) *StreamError {
+	code, retryable := classifyError(err)
+	e := &StreamError{
+		Code:          code,
+		Component:     component,
+		Retryable:     retryable,
+		Terminal:      terminal,
+		CorrelationId: uuid.New().String(),
+		Message:       errorNotices[component],
+		Fallback:      fallback,
+	}
+	logger.Error("stream pipeline failure",
+		slog.String("session_id", sessionID),
+		slog.String("component", component),
+		slog.String("code", code),
+		slog.String("correlation_id", e.CorrelationId),
+		slog.Bool("terminal", terminal),
+		slog.String("error", err.Error()),
+	)
+	return e
+}
+
+// reportError tells a session's parties that a component failed. The
+// session carries on; fallback says how.
+func (s *TherapeuticStreamServer) reportError(state *StreamState, component string, err error, fallback string) {
+	msg := controlMessage(state.SessionID, controlError, map[string]string{
+		"component": component,
+	})
+	msg.Error = newStreamError(s.logger, state.SessionID, component, err, fallback, false)
+	msg.Content = msg.Error.Message
+	state.parties.send(msg)
+}
+
+// sendVoiceError tells a voice client that a component failed
+func (s *VoiceStreamServer) sendVoiceError(
+	stream grpc.BidiStreamingServer[VoiceRequest, VoiceResponse],
+	sessionID, component string,
+	err error,
+	fallback string,
+	terminal bool,
+) *StreamError {
+	e := newStreamError(s.logger, sessionID, component, err, fallback, terminal)
+	stream.Send(&VoiceResponse{SessionId: sessionID, Error: e})
+	return e
+}
@@ -0,0 +1,378 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Export formats
+const (
+	exportFormatJSON = "json"
+	exportFormatPDF  = "pdf"
+)
+
+// exportMaxMessages bounds a single export; longer sessions are exported
+// from the database directly
+const exportMaxMessages = 10000
+
+// errExportTooLarge is returned when a session exceeds exportMaxMessages
+var errExportTooLarge = errors.New("session too large to export")
+
+// Transcript PDF layout, in points on US Letter
+const (
+	pdfPageWidth  = 612
+	pdfPageHeight = 792
+	pdfMargin     = 54
+	pdfFontSize   = 10
+	pdfLeading    = 13
+	pdfLineChars  = 95 // Helvetica at pdfFontSize across the text width
+	pdfPageLines  = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// SessionTranscript is the record of a session released by ExportSession
+type SessionTranscript struct {
+	SessionID    string                   `json:"session_id"`
+	ExportedAt   time.Time                `json:"exported_at"`
+	ExportedBy   string                   `json:"exported_by"`
+	StartedAt    time.Time                `json:"started_at"`
+	EndedAt      time.Time                `json:"ended_at"`
+	MessageCount int                      `json:"message_count"`
+	Entries      []*TranscriptEntry       `json:"entries"`
+	CrisisEvents []*TranscriptCrisisEvent `json:"crisis_events"`
+}
+
+// TranscriptEntry is one message in a transcript. Annotations carry what
+// the platform recorded about the message, e.g. that it was rate limited or
+// a spoken response was interrupted.
+type TranscriptEntry struct {
+	ID          string            `json:"id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Role        string            `json:"role"`
+	UserID      string            `json:"user_id,omitempty"`
+	Content     string            `json:"content"`
+	AgentType   string            `json:"agent_type,omitempty"`
+	CrisisLevel string            `json:"crisis_level,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// TranscriptCrisisEvent marks a message crisis analysis flagged
+type TranscriptCrisisEvent struct {
+	MessageID string    `json:"message_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+}
+
+// ExportSession renders a session's complete transcript. It relies on the
+// auth package's unary interceptor to check the caller's permission and
+// audit the export, and on the caller resolver to name the exporter.
+func (s *TherapeuticStreamServer) ExportSession(ctx context.Context, req *ExportSessionRequest) (*ExportSessionResponse, error) {
+	if req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id required")
+	}
+	format := req.Format
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatPDF {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported export format %q", format)
+	}
+	if s.history == nil {
+		return nil, status.Error(codes.FailedPrecondition, "conversation history is not configured")
+	}
+	// The transcript names whoever the token says exported it
+	if s.callers == nil {
+		return nil, status.Error(codes.FailedPrecondition, "caller verification is not configured")
+	}
+	caller, err := s.callers.ResolveCaller(ctx)
+	if err != nil || caller.UserID == "" {
+		return nil, status.Error(codes.Unauthenticated, "caller not verified")
+	}
+	exportedBy := caller.UserID
+
+	messages, err := s.exportMessages(ctx, req.SessionId)
+	if errors.Is(err, errExportTooLarge) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to load session for export",
+			slog.String("session_id", req.SessionId),
+			slog.String("error", err.Error()),
+		)
+		return nil, status.Error(codes.Internal, "failed to load transcript")
+	}
+	if len(messages) == 0 {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	transcript := newSessionTranscript(req.SessionId, exportedBy, messages)
+	response := &ExportSessionResponse{
+		Filename:     fmt.Sprintf("transcript-%s.%s", req.SessionId, format),
+		MessageCount: int32(transcript.MessageCount),
+	}
+	switch format {
+	case exportFormatPDF:
+		response.Content = renderTranscriptPDF(transcript)
+		response.ContentType = "application/pdf"
+	default:
+		response.Content, err = json.MarshalIndent(transcript, "", "  ")
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to encode transcript")
+		}
+		response.ContentType = "application/json"
+	}
+
+	s.logger.Info("session transcript exported",
+		slog.String("session_id", req.SessionId),
+		slog.String("exported_by", exportedBy),
+		slog.String("format", format),
+		slog.Int("messages", transcript.MessageCount),
+	)
+	return response, nil
+}
+
+// exportMessages pages through a session's whole history, oldest first
+func (s *TherapeuticStreamServer) exportMessages(ctx context.Context, sessionID string) ([]*ChatMessage, error) {
+	var pages [][]*ChatMessage
+	total := 0
+	cursor := ""
+	for {
+		page, err := s.history.GetHistory(ctx, sessionID, cursor, historyPageMax)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page.Messages)
+		total += len(page.Messages)
+		if total > exportMaxMessages {
+			return nil, errExportTooLarge
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	// Pages arrive newest first
+	messages := make([]*ChatMessage, 0, total)
+	for i := len(pages) - 1; i >= 0; i-- {
+		messages = append(messages, pages[i]...)
+	}
+	return messages, nil
+}
+
+// newSessionTranscript builds a transcript from a session's messages,
+// oldest first
+func newSessionTranscript(sessionID, exportedBy string, messages []*ChatMessage) *SessionTranscript {
+	t := &SessionTranscript{
+		SessionID:    sessionID,
+		ExportedAt:   time.Now().UTC(),
+		ExportedBy:   exportedBy,
+		MessageCount: len(messages),
+		Entries:      make([]*TranscriptEntry, 0, len(messages)),
+		CrisisEvents: []*TranscriptCrisisEvent{},
+	}
+	for _, msg := range messages {
+		entry := &TranscriptEntry{
+			ID:          msg.Id,
+			Timestamp:   msg.Timestamp.AsTime().UTC(),
+			Role:        msg.Role,
+			UserID:      msg.UserId,
+			Content:     msg.Content,
+			AgentType:   msg.AgentType,
+			CrisisLevel: msg.CrisisLevel,
+			Annotations: msg.Metadata,
+		}
+		t.Entries = append(t.Entries, entry)
+
+		if crisisLevelRank[msg.CrisisLevel] > 0 {
+			t.CrisisEvents = append(t.CrisisEvents, &TranscriptCrisisEvent{
+				MessageID: msg.Id,
+				Timestamp: entry.Timestamp,
+				Level:     msg.CrisisLevel,
+			})
+		}
+	}
+	if len(t.Entries) > 0 {
+		t.StartedAt = t.Entries[0].Timestamp
+		t.EndedAt = t.Entries[len(t.Entries)-1].Timestamp
+	}
+	return t
+}
+
+// transcriptLines lays a transcript out as text lines for the PDF
+func transcriptLines(t *SessionTranscript) []string {
+	const stamp = "2006-01-02 15:04:05 MST"
+	lines := []string{
+		"Session Transcript",
+		"",
+		"Session:     " + t.SessionID,
+		"Period:      " + t.StartedAt.Format(stamp) + " to " + t.EndedAt.Format(stamp),
+		fmt.Sprintf("Messages:    %d", t.MessageCount),
+		fmt.Sprintf("Crisis flags: %d", len(t.CrisisEvents)),
+		"Exported:    " + t.ExportedAt.Format(stamp) + " by " + t.ExportedBy,
+		"",
+		"CONFIDENTIAL: contains protected health information.",
+		"",
+	}
+
+	for _, e := range t.Entries {
+		heading := fmt.Sprintf("[%s] %s", e.Timestamp.Format(stamp), e.Role)
+		if e.AgentType != "" {
+			heading += " (" + e.AgentType + ")"
+		}
+		if crisisLevelRank[e.CrisisLevel] > 0 {
+			heading += " - CRISIS " + e.CrisisLevel
+		}
+		lines = append(lines, heading)
+		for _, line := range wrapText(e.Content, pdfLineChars-4) {
+			lines = append(lines, "    "+line)
+		}
+
+		keys := make([]string, 0, len(e.Annotations))
+		for key := range e.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, line := range wrapText(key+": "+e.Annotations[key], pdfLineChars-6) {
+				lines = append(lines, "      "+line)
+			}
+		}
+		lines = append(lines, "")
+	}
+
+	if len(t.CrisisEvents) > 0 {
+		lines = append(lines, "Crisis Events", "")
+		for _, c := range t.CrisisEvents {
+			lines = append(lines, fmt.Sprintf("[%s] %s  message %s", c.Timestamp.Format(stamp), c.Level, c.MessageID))
+		}
+	}
+	return lines
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces
+// where possible
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				r := []rune(word)
+				lines = append(lines, string(r[:width]))
+				word = string(r[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderTranscriptPDF renders a transcript as a plain paginated PDF
+func renderTranscriptPDF(t *SessionTranscript) []byte {
+	// Each page ends with a blank line and its footer
+	const perPage = pdfPageLines - 2
+	lines := transcriptLines(t)
+	pageCount := (len(lines) + perPage - 1) / perPage
+
+	pages := make([][]string, 0, pageCount)
+	for len(lines) > 0 {
+		n := min(len(lines), perPage)
+		page := append([]string(nil), lines[:n]...)
+		for len(page) < pdfPageLines-1 {
+			page = append(page, "")
+		}
+		page = append(page, fmt.Sprintf("Session %s    Page %d of %d", t.SessionID, len(pages)+1, pageCount))
+		pages = append(pages, page)
+		lines = lines[n:]
+	}
+	return writePDF(pages)
+}
+
+// writePDF writes pages of Helvetica text lines as a PDF document
+func writePDF(pages [][]string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1-3 are the catalog, page tree and font; each page is then
+	// a page object followed by its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", pdfString(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfQuotes maps typographic punctuation to what the standard fonts' Latin
+// encoding can show reliably
+var pdfQuotes = strings.NewReplacer("‘", "'", "’", "'", "“", `"`, "”", `"`, "–", "-", "—", "-", "…", "...")
+
+// pdfString escapes text for a PDF string literal. Characters outside
+// Latin-1 are shown as '?'.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range pdfQuotes.Replace(text) {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '\t':
+			b.WriteString("    ")
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,367 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// OverflowPolicy decides what happens when a client falls so far behind
+// that its outbound buffer fills
+type OverflowPolicy string
+
+const (
+	// OverflowDropPartials drops streaming partial chunks to make room and
+	// only disconnects when the buffer is full of complete messages
+	OverflowDropPartials OverflowPolicy = "drop_partials"
+	// OverflowDisconnect disconnects the client as soon as the buffer fills
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// FlowControlConfig bounds how much a slow chat client can hold up the
+// server
+type FlowControlConfig struct {
+	BufferSize  int           // Outbound messages queued per session
+	SendTimeout time.Duration // Longest a single Send may block
+	Policy      OverflowPolicy
+}
+
+// DefaultFlowControlConfig returns default flow control configuration
+func DefaultFlowControlConfig() *FlowControlConfig {
+	return &FlowControlConfig{
+		BufferSize:  64,
+		SendTimeout: 10 * time.Second,
+		Policy:      OverflowDropPartials,
+	}
+}
+
+// Reasons a slow client is disconnected
+var (
+	errBufferOverflow = errors.New("client not keeping up: outbound buffer full")
+	errSendTimeout    = errors.New("client not keeping up: send timed out")
+	errStreamClosed   = errors.New("stream closed")
+)
+
+// flowMetrics tracks outbound buffering across all chat sessions
+var flowMetrics = struct {
+	occupancy       prometheus.Histogram
+	buffered        prometheus.Gauge
+	coalesced       prometheus.Counter
+	droppedPartials prometheus.Counter
+	disconnects     *prometheus.CounterVec
+}{
+	occupancy: prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "lilo_streaming",
+		Name:      "outbound_buffer_occupancy_ratio",
+		Help:      "Fill ratio of a session's outbound buffer when a message is queued.",
+		Buckets:   []float64{0, .1, .25, .5, .75, .9, 1},
+	}),
+	buffered: prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lilo_streaming",
+		Name:      "outbound_buffered_messages",
+		Help:      "Messages waiting in outbound buffers across all sessions.",
+	}),
+	coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_streaming",
+		Name:      "outbound_coalesced_chunks_total",
+		Help:      "Partial chunks merged into a queued chunk for a slow client.",
+	}),
+	droppedPartials: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_streaming",
+		Name:      "outbound_dropped_partials_total",
+		Help:      "Partial chunks dropped because a client's buffer was full.",
+	}),
+	disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lilo_streaming",
+		Name:      "slow_client_disconnects_total",
+		Help:      "Chat streams closed because the client could not keep up.",
+	}, []string{"reason"}),
+}
+
+// FlowControlCollectors returns the outbound buffering collectors for
+// registration with the process metrics registry
+func FlowControlCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		flowMetrics.occupancy,
+		flowMetrics.buffered,
+		flowMetrics.coalesced,
+		flowMetrics.droppedPartials,
+		flowMetrics.disconnects,
+	}
+}
+
+// isPartial reports whether a message is a mid-response streaming chunk
+func isPartial(msg *ChatMessage) bool {
+	return msg.IsStreaming && !msg.IsFinal
+}
+
+// sessionStream decouples producers from a chat client. Messages are queued
+// in a bounded buffer and written by a single goroutine, which records each
+// one in the replay log as it goes out.
+type sessionStream struct {
+	stream    grpc.BidiStreamingServer[ChatMessage, ChatMessage]
+	sessionID string
+	replayID  string // Replay log this stream's messages are recorded in
+	replay    *replayLog
+	flow      *FlowControlConfig
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	queue   []*ChatMessage
+	dropped int // Partials dropped since the last message written
+	closing bool
+	ready   chan struct{}
+
+	failOnce sync.Once
+	failed   chan struct{}
+	err      error
+	done     chan struct{}
+}
+
+// newSessionStream creates a session stream; run must be started to
+// deliver messages
+func newSessionStream(
+	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	sessionID, replayID string,
+	replay *replayLog,
+	flow *FlowControlConfig,
+	logger *slog.Logger,
+) *sessionStream {
+	return &sessionStream{
+		stream:    stream,
+		sessionID: sessionID,
+		replayID:  replayID,
+		replay:    replay,
+		flow:      flow,
+		logger:    logger,
+		ready:     make(chan struct{}, 1),
+		failed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// send queues a message for delivery. Consecutive partial chunks are merged
+// while the client is behind; a full buffer is handled per the overflow
+// policy. An error means the stream has been or is being disconnected.
+func (ss *sessionStream) send(msg *ChatMessage) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	select {
+	case <-ss.failed:
+		return ss.err
+	default:
+	}
+	if ss.closing {
+		return errStreamClosed
+	}
+
+	if n := len(ss.queue); n > 0 && isPartial(msg) {
+		if tail := ss.queue[n-1]; isPartial(tail) && tail.Role == msg.Role && tail.AgentType == msg.AgentType {
+			tail.Content += msg.Content
+			tail.StreamIndex = msg.StreamIndex
+			tail.Timestamp = msg.Timestamp
+			flowMetrics.coalesced.Inc()
+			return nil
+		}
+	}
+
+	if len(ss.queue) >= ss.flow.BufferSize {
+		// Control messages are only useful if they arrive promptly
+		if isControl(msg) {
+			return nil
+		}
+		if ss.flow.Policy != OverflowDropPartials {
+			ss.fail(errBufferOverflow, "buffer_overflow")
+			return ss.err
+		}
+		if isPartial(msg) {
+			ss.dropped++
+			flowMetrics.droppedPartials.Inc()
+			return nil
+		}
+		if !ss.evictPartial() {
+			ss.fail(errBufferOverflow, "buffer_overflow")
+			return ss.err
+		}
+	}
+
+	flowMetrics.occupancy.Observe(float64(len(ss.queue)) / float64(ss.flow.BufferSize))
+	flowMetrics.buffered.Inc()
+	ss.queue = append(ss.queue, msg)
+
+	select {
+	case ss.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// evictPartial drops the oldest queued partial chunk to make room for a
+// complete message. Caller must hold ss.mu.
+func (ss *sessionStream) evictPartial() bool {
+	for i, queued := range ss.queue {
+		if isPartial(queued) {
+			ss.queue = append(ss.queue[:i], ss.queue[i+1:]...)
+			ss.dropped++
+			flowMetrics.droppedPartials.Inc()
+			flowMetrics.buffered.Dec()
+			return true
+		}
+	}
+	return false
+}
+
+// discardPartials drops queued partial chunks, e.g. when the response they
+// belong to has been interrupted
+func (ss *sessionStream) discardPartials() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	kept := ss.queue[:0]
+	for _, msg := range ss.queue {
+		if isPartial(msg) {
+			flowMetrics.buffered.Dec()
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	ss.queue = kept
+}
+
+// next removes the oldest queued message. Clients are told how many
+// partials were dropped ahead of it, i.e. that streamed text has gaps.
+func (ss *sessionStream) next() (*ChatMessage, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if len(ss.queue) == 0 {
+		return nil, false
+	}
+	msg := ss.queue[0]
+	ss.queue[0] = nil
+	ss.queue = ss.queue[1:]
+	flowMetrics.buffered.Dec()
+
+	if ss.dropped > 0 {
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string)
+		}
+		msg.Metadata["dropped_partials"] = strconv.Itoa(ss.dropped)
+		ss.dropped = 0
+	}
+	return msg, true
+}
+
+// run writes queued messages until the stream ends, then keeps whatever
+// could not be delivered in the replay log for the client's next resume
+func (ss *sessionStream) run(ctx context.Context) {
+	defer close(ss.done)
+	defer ss.flushToReplay(ctx)
+
+	for {
+		msg, ok := ss.next()
+		if !ok {
+			ss.mu.Lock()
+			closing := ss.closing
+			ss.mu.Unlock()
+			if closing {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ss.failed:
+				return
+			case <-ss.ready:
+			}
+			continue
+		}
+
+		if !isControl(msg) {
+			if err := ss.replay.append(ctx, ss.replayID, msg); err != nil {
+				ss.logger.Warn("message not recorded for replay",
+					slog.String("session_id", ss.sessionID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+
+		// Send can't be cancelled; a stuck client is disconnected instead,
+		// which unblocks it once the handler returns
+		timer := time.AfterFunc(ss.flow.SendTimeout, func() {
+			ss.fail(errSendTimeout, "send_timeout")
+		})
+		err := ss.stream.Send(msg)
+		timer.Stop()
+
+		if err != nil {
+			ss.fail(err, "send_error")
+			return
+		}
+	}
+}
+
+// flushToReplay records undelivered messages so a resumed stream can
+// replay them
+func (ss *sessionStream) flushToReplay(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ss.flow.SendTimeout)
+	defer cancel()
+
+	for {
+		msg, ok := ss.next()
+		if !ok {
+			return
+		}
+		if isControl(msg) {
+			continue
+		}
+		if err := ss.replay.append(ctx, ss.replayID, msg); err != nil {
+			ss.logger.Warn("undelivered message not recorded for replay",
+				slog.String("session_id", ss.sessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// close stops accepting messages and waits up to the send timeout for the
+// buffer to drain
+func (ss *sessionStream) close() {
+	ss.mu.Lock()
+	ss.closing = true
+	ss.mu.Unlock()
+
+	select {
+	case ss.ready <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-ss.done:
+	case <-time.After(ss.flow.SendTimeout):
+	}
+}
+
+// fail marks the stream for disconnection. Only the first reason is kept.
+func (ss *sessionStream) fail(err error, reason string) {
+	ss.failOnce.Do(func() {
+		ss.err = err
+		close(ss.failed)
+
+		if reason != "send_error" {
+			flowMetrics.disconnects.WithLabelValues(reason).Inc()
+			ss.logger.Warn("disconnecting slow chat client",
+				slog.String("session_id", ss.sessionID),
+				slog.String("reason", reason),
+			)
+		}
+	})
+}
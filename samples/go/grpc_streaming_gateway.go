@@ -0,0 +1,408 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// hubChannel is the websocket hub's pub/sub channel. The hub publishes
+// what its clients send there and delivers what is published to the
+// clients of the named user.
+const hubChannel = "lilo:websocket:messages"
+
+// gatewayOrigin marks messages the gateway published so it doesn't take
+// them as client input
+const gatewayOrigin = "grpc_gateway"
+
+// Gateway limits
+const (
+	gatewayInboundBuffer = 32
+	gatewayClaimTTL      = time.Minute // A crashed instance's bridges can be claimed after this
+	gatewayClaimRefresh  = 20 * time.Second
+)
+
+// Hub message types the gateway handles, as defined by the websocket hub
+const (
+	hubTypeChat      = "chat"
+	hubTypeTyping    = "typing"
+	hubTypePresence  = "presence"
+	hubTypeHeartbeat = "heartbeat"
+)
+
+// HubMessage is the websocket hub's wire format
+type HubMessage struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	UserID      string                 `json:"user_id"`
+	SessionID   string                 `json:"session_id"`
+	Content     string                 `json:"content,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	CrisisLevel string                 `json:"crisis_level,omitempty"`
+	RequiresAck bool                   `json:"requires_ack,omitempty"`
+}
+
+// gatewayClaimKey names the instance bridging a session, so one gateway
+// handles each session however many are subscribed to the hub
+func gatewayClaimKey(sessionID string) string {
+	return fmt.Sprintf("gateway:session:%s", sessionID)
+}
+
+// WebSocketGateway carries websocket hub conversations through the gRPC
+// chat pipeline, so web clients get the same crisis handling, routing and
+// history as gRPC clients. The hub authenticates its clients; the gateway
+// trusts the user and session it reports.
+type WebSocketGateway struct {
+	server *TherapeuticStreamServer
+	redis  *redis.Client
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	bridges map[string]*hubBridge // By session ID
+}
+
+// NewWebSocketGateway creates a gateway into a chat server
+func NewWebSocketGateway(server *TherapeuticStreamServer, redis *redis.Client, logger *slog.Logger) *WebSocketGateway {
+	return &WebSocketGateway{
+		server:  server,
+		redis:   redis,
+		logger:  logger,
+		bridges: make(map[string]*hubBridge),
+	}
+}
+
+// Run bridges hub conversations until ctx is cancelled
+func (g *WebSocketGateway) Run(ctx context.Context) error {
+	pubsub := g.redis.Subscribe(ctx, hubChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			g.closeAll()
+			return nil
+		case redisMsg := <-ch:
+			var msg HubMessage
+			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
+				g.logger.Error("failed to unmarshal hub message",
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			if msg.Metadata["origin"] == gatewayOrigin || msg.SessionID == "" || msg.UserID == "" {
+				continue
+			}
+			g.dispatch(ctx, &msg)
+		}
+	}
+}
+
+// dispatch passes a client's message to its session's bridge, opening one
+// for the first message
+func (g *WebSocketGateway) dispatch(ctx context.Context, msg *HubMessage) {
+	g.mu.Lock()
+	b, ok := g.bridges[msg.SessionID]
+	g.mu.Unlock()
+
+	if msg.Type == hubTypePresence {
+		if online, _ := msg.Metadata["online"].(bool); !online && ok {
+			b.closeInbound()
+		}
+		return
+	}
+	chat := hubToChat(msg)
+	if chat == nil {
+		return
+	}
+
+	if !ok {
+		if !g.claim(ctx, msg.SessionID) {
+			return
+		}
+		b = g.open(ctx, msg)
+	}
+	if b.userID != msg.UserID {
+		g.logger.Warn("ignoring hub message from another user",
+			slog.String("session_id", msg.SessionID),
+			slog.String("user_id", msg.UserID),
+		)
+		return
+	}
+	b.deliver(chat)
+}
+
+// claim makes this instance the session's bridge. It reports false if
+// another instance already is.
+func (g *WebSocketGateway) claim(ctx context.Context, sessionID string) bool {
+	claimed, err := g.redis.SetNX(ctx, gatewayClaimKey(sessionID), g.server.instanceID, gatewayClaimTTL).Result()
+	if err != nil {
+		g.logger.Warn("failed to claim hub session",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	return claimed
+}
+
+// open starts a chat stream for a hub session
+func (g *WebSocketGateway) open(ctx context.Context, first *HubMessage) *hubBridge {
+	md := metadata.Pairs(
+		"session-id", first.SessionID,
+		"user-id", first.UserID,
+	)
+	for key, header := range map[string]string{
+		"facility_id":         "facility-id",
+		"participant_role":    "participant-role",
+		"last_received_index": "last-received-index",
+	} {
+		if v, ok := first.Metadata[key]; ok {
+			md.Set(header, fmt.Sprint(v))
+		}
+	}
+
+	streamCtx, cancel := context.WithCancel(metadata.NewIncomingContext(ctx, md))
+	b := &hubBridge{
+		gateway:   g,
+		sessionID: first.SessionID,
+		userID:    first.UserID,
+		ctx:       streamCtx,
+		cancel:    cancel,
+		inbound:   make(chan *ChatMessage, gatewayInboundBuffer),
+		closed:    make(chan struct{}),
+	}
+
+	g.mu.Lock()
+	g.bridges[b.sessionID] = b
+	g.mu.Unlock()
+
+	release := g.holdClaim(streamCtx, b.sessionID)
+	go func() {
+		defer func() {
+			cancel()
+			release()
+			g.mu.Lock()
+			if g.bridges[b.sessionID] == b {
+				delete(g.bridges, b.sessionID)
+			}
+			g.mu.Unlock()
+		}()
+
+		g.logger.Info("bridging hub session",
+			slog.String("session_id", b.sessionID),
+			slog.String("user_id", b.userID),
+		)
+		if err := g.server.Chat(b); err != nil {
+			g.logger.Info("hub session bridge ended",
+				slog.String("session_id", b.sessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+	return b
+}
+
+// holdClaim refreshes a session claim until ctx ends, then releases it
+func (g *WebSocketGateway) holdClaim(ctx context.Context, sessionID string) func() {
+	key := gatewayClaimKey(sessionID)
+	go func() {
+		ticker := time.NewTicker(gatewayClaimRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.redis.Expire(ctx, key, gatewayClaimTTL)
+			}
+		}
+	}()
+	return func() {
+		releaseLocator.Run(context.WithoutCancel(ctx), g.redis, []string{key}, g.server.instanceID)
+	}
+}
+
+// closeAll ends every bridged session
+func (g *WebSocketGateway) closeAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, b := range g.bridges {
+		b.cancel()
+	}
+}
+
+// hubBridge presents a hub session to the chat server as a gRPC stream
+type hubBridge struct {
+	gateway   *WebSocketGateway
+	sessionID string
+	userID    string
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	inbound   chan *ChatMessage
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// deliver queues a client message for the chat server. A client sending
+// faster than the session can take is dropped rather than blocking every
+// other hub session.
+func (b *hubBridge) deliver(msg *ChatMessage) {
+	select {
+	case <-b.closed:
+	case b.inbound <- msg:
+	default:
+		b.gateway.logger.Warn("hub session inbound buffer full, closing",
+			slog.String("session_id", b.sessionID),
+		)
+		b.cancel()
+	}
+}
+
+// closeInbound ends the client's side of the stream
+func (b *hubBridge) closeInbound() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// Recv returns the client's next message
+func (b *hubBridge) Recv() (*ChatMessage, error) {
+	select {
+	case msg := <-b.inbound:
+		return msg, nil
+	case <-b.closed:
+		return nil, io.EOF
+	case <-b.ctx.Done():
+		return nil, b.ctx.Err()
+	}
+}
+
+// Send publishes a message to the hub for the resident's clients
+func (b *hubBridge) Send(msg *ChatMessage) error {
+	data, err := json.Marshal(chatToHub(msg, b.sessionID, b.userID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal hub message: %w", err)
+	}
+	if err := b.gateway.redis.Publish(b.ctx, hubChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish hub message: %w", err)
+	}
+	return nil
+}
+
+// Context returns the bridged stream's context, carrying its metadata
+func (b *hubBridge) Context() context.Context { return b.ctx }
+
+// SetHeader is a no-op; hub clients have no headers
+func (b *hubBridge) SetHeader(metadata.MD) error { return nil }
+
+// SendHeader is a no-op; hub clients have no headers
+func (b *hubBridge) SendHeader(metadata.MD) error { return nil }
+
+// SetTrailer is a no-op; hub clients have no trailers
+func (b *hubBridge) SetTrailer(metadata.MD) {}
+
+// SendMsg sends a chat message
+func (b *hubBridge) SendMsg(m any) error {
+	msg, ok := m.(*ChatMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	return b.Send(msg)
+}
+
+// RecvMsg receives a chat message
+func (b *hubBridge) RecvMsg(m any) error {
+	out, ok := m.(*ChatMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	msg, err := b.Recv()
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, msg)
+	return nil
+}
+
+// hubToChat converts a client's hub message, or returns nil for types the
+// chat pipeline doesn't take
+func hubToChat(msg *HubMessage) *ChatMessage {
+	chat := &ChatMessage{
+		Id:        msg.ID,
+		SessionId: msg.SessionID,
+		UserId:    msg.UserID,
+		Role:      RoleUser,
+		Content:   msg.Content,
+		Metadata:  make(map[string]string, len(msg.Metadata)+1),
+	}
+	for k, v := range msg.Metadata {
+		chat.Metadata[k] = fmt.Sprint(v)
+	}
+
+	switch msg.Type {
+	case hubTypeChat:
+	case hubTypeTyping:
+		chat.Metadata["type"] = controlTyping
+	case hubTypeHeartbeat:
+		chat.Metadata["type"] = controlHeartbeat
+	default:
+		return nil
+	}
+	return chat
+}
+
+// chatToHub converts an outbound chat message for the hub, addressed to
+// the resident. Streaming position and crisis level carry over so web
+// clients assemble and flag responses as gRPC clients do.
+func chatToHub(msg *ChatMessage, sessionID, userID string) *HubMessage {
+	out := &HubMessage{
+		ID:          msg.Id,
+		Type:        hubTypeChat,
+		UserID:      userID,
+		SessionID:   sessionID,
+		Content:     msg.Content,
+		CrisisLevel: msg.CrisisLevel,
+		RequiresAck: crisisLevelRank[msg.CrisisLevel] > 0,
+		Timestamp:   time.Now(),
+		Metadata: map[string]interface{}{
+			"origin":       gatewayOrigin,
+			"role":         msg.Role,
+			"is_streaming": msg.IsStreaming,
+			"stream_index": msg.StreamIndex,
+			"is_final":     msg.IsFinal,
+			"sequence":     msg.Sequence,
+		},
+	}
+	if msg.Timestamp != nil {
+		out.Timestamp = msg.Timestamp.AsTime()
+	}
+	if msg.AgentType != "" {
+		out.Metadata["agent_type"] = msg.AgentType
+	}
+	if msg.UserId != "" && msg.UserId != userID {
+		out.Metadata["sender_id"] = msg.UserId
+	}
+	for k, v := range msg.Metadata {
+		out.Metadata[k] = v
+	}
+
+	switch msg.Metadata["type"] {
+	case controlTyping:
+		out.Type = hubTypeTyping
+	case controlHeartbeat:
+		out.Type = hubTypeHeartbeat
+	}
+	// Metadata can't override the gateway's own markers
+	out.Metadata["origin"] = gatewayOrigin
+	out.Metadata["stream_index"] = msg.StreamIndex
+	return out
+}
@@ -0,0 +1,614 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: grpc_streaming.proto
+
+// Streaming services for real-time therapeutic AI interactions: chat, voice,
+// crisis alert broadcasting, and live metrics.
+
+package streaming
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TherapeuticService_Chat_FullMethodName              = "/therapeutic.streaming.v1.TherapeuticService/Chat"
+	TherapeuticService_StreamSessionMood_FullMethodName = "/therapeutic.streaming.v1.TherapeuticService/StreamSessionMood"
+	TherapeuticService_ExportSession_FullMethodName     = "/therapeutic.streaming.v1.TherapeuticService/ExportSession"
+)
+
+// TherapeuticServiceClient is the client API for TherapeuticService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TherapeuticService streams a therapeutic conversation in both directions.
+// Callers identify the session with session-id and user-id metadata.
+type TherapeuticServiceClient interface {
+	Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChatMessage, ChatMessage], error)
+	// StreamSessionMood follows a session's emotional trajectory for staff.
+	StreamSessionMood(ctx context.Context, in *SessionMoodRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MoodUpdate], error)
+	// ExportSession produces a session's complete transcript for the record.
+	// Exports release clinical records; the server gates them by permission
+	// and audits every attempt.
+	ExportSession(ctx context.Context, in *ExportSessionRequest, opts ...grpc.CallOption) (*ExportSessionResponse, error)
+}
+
+type therapeuticServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTherapeuticServiceClient(cc grpc.ClientConnInterface) TherapeuticServiceClient {
+	return &therapeuticServiceClient{cc}
+}
+
+func (c *therapeuticServiceClient) Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChatMessage, ChatMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TherapeuticService_ServiceDesc.Streams[0], TherapeuticService_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChatMessage, ChatMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TherapeuticService_ChatClient = grpc.BidiStreamingClient[ChatMessage, ChatMessage]
+
+func (c *therapeuticServiceClient) StreamSessionMood(ctx context.Context, in *SessionMoodRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MoodUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TherapeuticService_ServiceDesc.Streams[1], TherapeuticService_StreamSessionMood_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SessionMoodRequest, MoodUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TherapeuticService_StreamSessionMoodClient = grpc.ServerStreamingClient[MoodUpdate]
+
+func (c *therapeuticServiceClient) ExportSession(ctx context.Context, in *ExportSessionRequest, opts ...grpc.CallOption) (*ExportSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportSessionResponse)
+	err := c.cc.Invoke(ctx, TherapeuticService_ExportSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TherapeuticServiceServer is the server API for TherapeuticService service.
+// All implementations must embed UnimplementedTherapeuticServiceServer
+// for forward compatibility.
+//
+// TherapeuticService streams a therapeutic conversation in both directions.
+// Callers identify the session with session-id and user-id metadata.
+type TherapeuticServiceServer interface {
+	Chat(grpc.BidiStreamingServer[ChatMessage, ChatMessage]) error
+	// StreamSessionMood follows a session's emotional trajectory for staff.
+	StreamSessionMood(*SessionMoodRequest, grpc.ServerStreamingServer[MoodUpdate]) error
+	// ExportSession produces a session's complete transcript for the record.
+	// Exports release clinical records; the server gates them by permission
+	// and audits every attempt.
+	ExportSession(context.Context, *ExportSessionRequest) (*ExportSessionResponse, error)
+	mustEmbedUnimplementedTherapeuticServiceServer()
+}
+
+// UnimplementedTherapeuticServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTherapeuticServiceServer struct{}
+
+func (UnimplementedTherapeuticServiceServer) Chat(grpc.BidiStreamingServer[ChatMessage, ChatMessage]) error {
+	return status.Error(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedTherapeuticServiceServer) StreamSessionMood(*SessionMoodRequest, grpc.ServerStreamingServer[MoodUpdate]) error {
+	return status.Error(codes.Unimplemented, "method StreamSessionMood not implemented")
+}
+func (UnimplementedTherapeuticServiceServer) ExportSession(context.Context, *ExportSessionRequest) (*ExportSessionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ExportSession not implemented")
+}
+func (UnimplementedTherapeuticServiceServer) mustEmbedUnimplementedTherapeuticServiceServer() {}
+func (UnimplementedTherapeuticServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeTherapeuticServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TherapeuticServiceServer will
+// result in compilation errors.
+type UnsafeTherapeuticServiceServer interface {
+	mustEmbedUnimplementedTherapeuticServiceServer()
+}
+
+func RegisterTherapeuticServiceServer(s grpc.ServiceRegistrar, srv TherapeuticServiceServer) {
+	// If the following call panics, it indicates UnimplementedTherapeuticServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TherapeuticService_ServiceDesc, srv)
+}
+
+func _TherapeuticService_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TherapeuticServiceServer).Chat(&grpc.GenericServerStream[ChatMessage, ChatMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TherapeuticService_ChatServer = grpc.BidiStreamingServer[ChatMessage, ChatMessage]
+
+func _TherapeuticService_StreamSessionMood_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SessionMoodRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TherapeuticServiceServer).StreamSessionMood(m, &grpc.GenericServerStream[SessionMoodRequest, MoodUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TherapeuticService_StreamSessionMoodServer = grpc.ServerStreamingServer[MoodUpdate]
+
+func _TherapeuticService_ExportSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TherapeuticServiceServer).ExportSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TherapeuticService_ExportSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TherapeuticServiceServer).ExportSession(ctx, req.(*ExportSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TherapeuticService_ServiceDesc is the grpc.ServiceDesc for TherapeuticService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TherapeuticService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "therapeutic.streaming.v1.TherapeuticService",
+	HandlerType: (*TherapeuticServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExportSession",
+			Handler:    _TherapeuticService_ExportSession_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _TherapeuticService_Chat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamSessionMood",
+			Handler:       _TherapeuticService_StreamSessionMood_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "grpc_streaming.proto",
+}
+
+const (
+	VoiceService_StreamVoice_FullMethodName = "/therapeutic.streaming.v1.VoiceService/StreamVoice"
+)
+
+// VoiceServiceClient is the client API for VoiceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// VoiceService streams audio in and transcriptions, responses, and
+// synthesized audio out.
+type VoiceServiceClient interface {
+	StreamVoice(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[VoiceRequest, VoiceResponse], error)
+}
+
+type voiceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVoiceServiceClient(cc grpc.ClientConnInterface) VoiceServiceClient {
+	return &voiceServiceClient{cc}
+}
+
+func (c *voiceServiceClient) StreamVoice(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[VoiceRequest, VoiceResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VoiceService_ServiceDesc.Streams[0], VoiceService_StreamVoice_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[VoiceRequest, VoiceResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VoiceService_StreamVoiceClient = grpc.BidiStreamingClient[VoiceRequest, VoiceResponse]
+
+// VoiceServiceServer is the server API for VoiceService service.
+// All implementations must embed UnimplementedVoiceServiceServer
+// for forward compatibility.
+//
+// VoiceService streams audio in and transcriptions, responses, and
+// synthesized audio out.
+type VoiceServiceServer interface {
+	StreamVoice(grpc.BidiStreamingServer[VoiceRequest, VoiceResponse]) error
+	mustEmbedUnimplementedVoiceServiceServer()
+}
+
+// UnimplementedVoiceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVoiceServiceServer struct{}
+
+func (UnimplementedVoiceServiceServer) StreamVoice(grpc.BidiStreamingServer[VoiceRequest, VoiceResponse]) error {
+	return status.Error(codes.Unimplemented, "method StreamVoice not implemented")
+}
+func (UnimplementedVoiceServiceServer) mustEmbedUnimplementedVoiceServiceServer() {}
+func (UnimplementedVoiceServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeVoiceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VoiceServiceServer will
+// result in compilation errors.
+type UnsafeVoiceServiceServer interface {
+	mustEmbedUnimplementedVoiceServiceServer()
+}
+
+func RegisterVoiceServiceServer(s grpc.ServiceRegistrar, srv VoiceServiceServer) {
+	// If the following call panics, it indicates UnimplementedVoiceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VoiceService_ServiceDesc, srv)
+}
+
+func _VoiceService_StreamVoice_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VoiceServiceServer).StreamVoice(&grpc.GenericServerStream[VoiceRequest, VoiceResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VoiceService_StreamVoiceServer = grpc.BidiStreamingServer[VoiceRequest, VoiceResponse]
+
+// VoiceService_ServiceDesc is the grpc.ServiceDesc for VoiceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VoiceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "therapeutic.streaming.v1.VoiceService",
+	HandlerType: (*VoiceServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamVoice",
+			Handler:       _VoiceService_StreamVoice_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "grpc_streaming.proto",
+}
+
+const (
+	CrisisAlertService_StreamAlerts_FullMethodName      = "/therapeutic.streaming.v1.CrisisAlertService/StreamAlerts"
+	CrisisAlertService_AcknowledgeAlerts_FullMethodName = "/therapeutic.streaming.v1.CrisisAlertService/AcknowledgeAlerts"
+)
+
+// CrisisAlertServiceClient is the client API for CrisisAlertService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CrisisAlertService pushes crisis alerts to care staff. Dashboards
+// acknowledge each delivery; unacknowledged alerts are sent again.
+type CrisisAlertServiceClient interface {
+	StreamAlerts(ctx context.Context, in *CrisisAlertRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CrisisAlertResponse], error)
+	AcknowledgeAlerts(ctx context.Context, in *AlertAckRequest, opts ...grpc.CallOption) (*AlertAckResponse, error)
+}
+
+type crisisAlertServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCrisisAlertServiceClient(cc grpc.ClientConnInterface) CrisisAlertServiceClient {
+	return &crisisAlertServiceClient{cc}
+}
+
+func (c *crisisAlertServiceClient) StreamAlerts(ctx context.Context, in *CrisisAlertRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CrisisAlertResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CrisisAlertService_ServiceDesc.Streams[0], CrisisAlertService_StreamAlerts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CrisisAlertRequest, CrisisAlertResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrisisAlertService_StreamAlertsClient = grpc.ServerStreamingClient[CrisisAlertResponse]
+
+func (c *crisisAlertServiceClient) AcknowledgeAlerts(ctx context.Context, in *AlertAckRequest, opts ...grpc.CallOption) (*AlertAckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AlertAckResponse)
+	err := c.cc.Invoke(ctx, CrisisAlertService_AcknowledgeAlerts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CrisisAlertServiceServer is the server API for CrisisAlertService service.
+// All implementations must embed UnimplementedCrisisAlertServiceServer
+// for forward compatibility.
+//
+// CrisisAlertService pushes crisis alerts to care staff. Dashboards
+// acknowledge each delivery; unacknowledged alerts are sent again.
+type CrisisAlertServiceServer interface {
+	StreamAlerts(*CrisisAlertRequest, grpc.ServerStreamingServer[CrisisAlertResponse]) error
+	AcknowledgeAlerts(context.Context, *AlertAckRequest) (*AlertAckResponse, error)
+	mustEmbedUnimplementedCrisisAlertServiceServer()
+}
+
+// UnimplementedCrisisAlertServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCrisisAlertServiceServer struct{}
+
+func (UnimplementedCrisisAlertServiceServer) StreamAlerts(*CrisisAlertRequest, grpc.ServerStreamingServer[CrisisAlertResponse]) error {
+	return status.Error(codes.Unimplemented, "method StreamAlerts not implemented")
+}
+func (UnimplementedCrisisAlertServiceServer) AcknowledgeAlerts(context.Context, *AlertAckRequest) (*AlertAckResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AcknowledgeAlerts not implemented")
+}
+func (UnimplementedCrisisAlertServiceServer) mustEmbedUnimplementedCrisisAlertServiceServer() {}
+func (UnimplementedCrisisAlertServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeCrisisAlertServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CrisisAlertServiceServer will
+// result in compilation errors.
+type UnsafeCrisisAlertServiceServer interface {
+	mustEmbedUnimplementedCrisisAlertServiceServer()
+}
+
+func RegisterCrisisAlertServiceServer(s grpc.ServiceRegistrar, srv CrisisAlertServiceServer) {
+	// If the following call panics, it indicates UnimplementedCrisisAlertServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CrisisAlertService_ServiceDesc, srv)
+}
+
+func _CrisisAlertService_StreamAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CrisisAlertRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CrisisAlertServiceServer).StreamAlerts(m, &grpc.GenericServerStream[CrisisAlertRequest, CrisisAlertResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrisisAlertService_StreamAlertsServer = grpc.ServerStreamingServer[CrisisAlertResponse]
+
+func _CrisisAlertService_AcknowledgeAlerts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AlertAckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrisisAlertServiceServer).AcknowledgeAlerts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrisisAlertService_AcknowledgeAlerts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrisisAlertServiceServer).AcknowledgeAlerts(ctx, req.(*AlertAckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CrisisAlertService_ServiceDesc is the grpc.ServiceDesc for CrisisAlertService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CrisisAlertService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "therapeutic.streaming.v1.CrisisAlertService",
+	HandlerType: (*CrisisAlertServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AcknowledgeAlerts",
+			Handler:    _CrisisAlertService_AcknowledgeAlerts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamAlerts",
+			Handler:       _CrisisAlertService_StreamAlerts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "grpc_streaming.proto",
+}
+
+const (
+	MetricsService_StreamMetrics_FullMethodName = "/therapeutic.streaming.v1.MetricsService/StreamMetrics"
+	MetricsService_ListMetrics_FullMethodName   = "/therapeutic.streaming.v1.MetricsService/ListMetrics"
+)
+
+// MetricsServiceClient is the client API for MetricsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MetricsService pushes live service metrics to dashboards. ListMetrics
+// tells dashboards which metrics exist so charts can be built dynamically.
+type MetricsServiceClient interface {
+	StreamMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsResponse], error)
+	ListMetrics(ctx context.Context, in *MetricsCatalogRequest, opts ...grpc.CallOption) (*MetricsCatalogResponse, error)
+}
+
+type metricsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMetricsServiceClient(cc grpc.ClientConnInterface) MetricsServiceClient {
+	return &metricsServiceClient{cc}
+}
+
+func (c *metricsServiceClient) StreamMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[0], MetricsService_StreamMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MetricsRequest, MetricsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_StreamMetricsClient = grpc.ServerStreamingClient[MetricsResponse]
+
+func (c *metricsServiceClient) ListMetrics(ctx context.Context, in *MetricsCatalogRequest, opts ...grpc.CallOption) (*MetricsCatalogResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetricsCatalogResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MetricsServiceServer is the server API for MetricsService service.
+// All implementations must embed UnimplementedMetricsServiceServer
+// for forward compatibility.
+//
+// MetricsService pushes live service metrics to dashboards. ListMetrics
+// tells dashboards which metrics exist so charts can be built dynamically.
+type MetricsServiceServer interface {
+	StreamMetrics(*MetricsRequest, grpc.ServerStreamingServer[MetricsResponse]) error
+	ListMetrics(context.Context, *MetricsCatalogRequest) (*MetricsCatalogResponse, error)
+	mustEmbedUnimplementedMetricsServiceServer()
+}
+
+// UnimplementedMetricsServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMetricsServiceServer struct{}
+
+func (UnimplementedMetricsServiceServer) StreamMetrics(*MetricsRequest, grpc.ServerStreamingServer[MetricsResponse]) error {
+	return status.Error(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListMetrics(context.Context, *MetricsCatalogRequest) (*MetricsCatalogResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
+func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeMetricsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MetricsServiceServer will
+// result in compilation errors.
+type UnsafeMetricsServiceServer interface {
+	mustEmbedUnimplementedMetricsServiceServer()
+}
+
+func RegisterMetricsServiceServer(s grpc.ServiceRegistrar, srv MetricsServiceServer) {
+	// If the following call panics, it indicates UnimplementedMetricsServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MetricsService_ServiceDesc, srv)
+}
+
+func _MetricsService_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MetricsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).StreamMetrics(m, &grpc.GenericServerStream[MetricsRequest, MetricsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_StreamMetricsServer = grpc.ServerStreamingServer[MetricsResponse]
+
+func _MetricsService_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricsCatalogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListMetrics(ctx, req.(*MetricsCatalogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MetricsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "therapeutic.streaming.v1.MetricsService",
+	HandlerType: (*MetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListMetrics",
+			Handler:    _MetricsService_ListMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _MetricsService_StreamMetrics_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "grpc_streaming.proto",
+}
@@ -0,0 +1,299 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GuardrailAction is what happens to a response when a rule matches
+type GuardrailAction string
+
+const (
+	// GuardrailRedact removes the matched text and lets the response continue
+	GuardrailRedact GuardrailAction = "redact"
+	// GuardrailReplace withdraws the whole response for the fallback
+	GuardrailReplace GuardrailAction = "replace"
+)
+
+// Guardrail trigger log limits
+const (
+	guardrailLogSize = 1000
+	guardrailLogTTL  = 30 * 24 * time.Hour
+	guardrailExcerpt = 200 // Characters of matched text kept for review
+)
+
+// GuardrailRule flags contraindicated content in AI responses
+type GuardrailRule struct {
+	Name     string
+	Category string // e.g. medical_advice, self_harm, medication_dosing
+	Pattern  *regexp.Regexp
+	Action   GuardrailAction
+}
+
+// GuardrailConfig controls the response safety filter
+type GuardrailConfig struct {
+	Rules []*GuardrailRule
+	// HoldBack is how much streamed text is held until more arrives so a
+	// match split across chunks is caught; it should exceed the longest
+	// match the rules expect
+	HoldBack  int
+	Redaction string // Replaces redacted text
+	Fallback  string // Sent in place of a withdrawn response
+}
+
+// DefaultGuardrailConfig returns rules against medication dosing, self-harm
+// instructions and medical advice
+func DefaultGuardrailConfig() *GuardrailConfig {
+	return &GuardrailConfig{
+		Rules: []*GuardrailRule{
+			{
+				Name:     "self_harm_method",
+				Category: "self_harm",
+				Pattern:  regexp.MustCompile(`(?i)\b(how|ways?|best way|easiest way)\s+to\s+(kill|hurt|harm|cut|hang|poison|overdose)\b`),
+				Action:   GuardrailReplace,
+			},
+			{
+				Name:     "lethal_quantity",
+				Category: "self_harm",
+				Pattern:  regexp.MustCompile(`(?i)\b(lethal|fatal|deadly)\s+(dose|amount|quantity)\b`),
+				Action:   GuardrailReplace,
+			},
+			{
+				Name:     "dosage_amount",
+				Category: "medication_dosing",
+				Pattern:  regexp.MustCompile(`(?i)\b\d+(\.\d+)?\s*(mg|milligrams?|mcg|micrograms?|ml|milliliters?|units?)\b`),
+				Action:   GuardrailReplace,
+			},
+			{
+				Name:     "dosage_instruction",
+				Category: "medication_dosing",
+				Pattern:  regexp.MustCompile(`(?i)\b(take|taking|double|skip)\s+(an?\s+|your\s+|extra\s+|another\s+|\d+\s+)*(pills?|tablets?|doses?|capsules?)\b`),
+				Action:   GuardrailReplace,
+			},
+			{
+				Name:     "medication_change",
+				Category: "medical_advice",
+				Pattern:  regexp.MustCompile(`(?i)\b(you should|you can|it'?s (fine|okay|ok|safe) to)\s+(stop|start|quit|skip|change|reduce|increase)\s+(taking\s+)?(your\s+)?(medications?|meds|prescriptions?|insulin)\b[^.!?\n]*`),
+				Action:   GuardrailRedact,
+			},
+			{
+				Name:     "diagnosis",
+				Category: "medical_advice",
+				Pattern:  regexp.MustCompile(`(?i)\byou (probably |likely |definitely |may )?(have|are suffering from)\s+(depression|dementia|alzheimer'?s|diabetes|cancer|bipolar disorder|schizophrenia|an? infection)\b[^.!?\n]*`),
+				Action:   GuardrailRedact,
+			},
+		},
+		HoldBack:  120,
+		Redaction: "[removed: please ask your care team]",
+		Fallback:  "That's something your care team is best placed to help with. Would you like me to let a nurse know you have a question?",
+	}
+}
+
+// SetGuardrails replaces the response safety filter. A nil config turns
+// filtering off. It must be called before the server starts accepting
+// streams.
+func (s *TherapeuticStreamServer) SetGuardrails(config *GuardrailConfig) {
+	s.guardrails = config
+}
+
+// guardrailHit is one rule match in a response
+type guardrailHit struct {
+	rule    *GuardrailRule
+	excerpt string
+}
+
+// GuardrailTrigger is logged for clinical review whenever a rule matches
+type GuardrailTrigger struct {
+	SessionID string          `json:"session_id"`
+	UserID    string          `json:"user_id"`
+	AgentType string          `json:"agent_type"`
+	Rule      string          `json:"rule"`
+	Category  string          `json:"category"`
+	Action    GuardrailAction `json:"action"`
+	Excerpt   string          `json:"excerpt"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// guardrailLogKey holds a facility's guardrail triggers for review
+func guardrailLogKey(facilityID string) string {
+	return fmt.Sprintf("guardrail:triggers:facility:%s", facilityID)
+}
+
+// responseGuard scans one response as it streams. A nil guard passes
+// everything through.
+type responseGuard struct {
+	config   *GuardrailConfig
+	pending  string // Scanned text not yet released
+	hits     []guardrailHit
+	replaced bool
+}
+
+// newResponseGuard starts scanning a response
+func (s *TherapeuticStreamServer) newResponseGuard() *responseGuard {
+	if s.guardrails == nil {
+		return nil
+	}
+	return &responseGuard{config: s.guardrails}
+}
+
+// push scans streamed text and returns what can be released. It reports
+// true once the response must be withdrawn. Text is held back until it
+// ends on a word boundary HoldBack characters before the latest chunk, or
+// until final.
+func (g *responseGuard) push(text string, final bool) (string, bool) {
+	if g == nil {
+		return text, false
+	}
+	if g.replaced {
+		return "", true
+	}
+	g.pending += text
+
+	// Replacement wins over redaction, so it sees the text first
+	for _, rule := range g.config.Rules {
+		if rule.Action != GuardrailReplace {
+			continue
+		}
+		if match := rule.Pattern.FindString(g.pending); match != "" {
+			g.hit(rule, match)
+			g.replaced = true
+			g.pending = ""
+			return "", true
+		}
+	}
+	for _, rule := range g.config.Rules {
+		if rule.Action != GuardrailRedact {
+			continue
+		}
+		g.pending = rule.Pattern.ReplaceAllStringFunc(g.pending, func(match string) string {
+			g.hit(rule, match)
+			return g.config.Redaction
+		})
+	}
+
+	if final {
+		released := g.pending
+		g.pending = ""
+		return released, false
+	}
+	cut := len(g.pending) - g.config.HoldBack
+	if cut <= 0 {
+		return "", false
+	}
+	i := strings.LastIndexAny(g.pending[:cut], " \n")
+	if i < 0 {
+		return "", false
+	}
+	released := g.pending[:i+1]
+	g.pending = g.pending[i+1:]
+	return released, false
+}
+
+// hit records a match
+func (g *responseGuard) hit(rule *GuardrailRule, match string) {
+	if runes := []rune(match); len(runes) > guardrailExcerpt {
+		match = string(runes[:guardrailExcerpt])
+	}
+	g.hits = append(g.hits, guardrailHit{rule: rule, excerpt: match})
+}
+
+// annotate marks a stored response with what the guardrails did to it
+func (g *responseGuard) annotate(msg *ChatMessage) {
+	if g == nil || len(g.hits) == 0 {
+		return
+	}
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	action := GuardrailRedact
+	if g.replaced {
+		action = GuardrailReplace
+	}
+	var rules []string
+	for _, h := range g.hits {
+		rules = appendUnique(rules, h.rule.Name)
+	}
+	msg.Metadata["guardrail"] = string(action)
+	msg.Metadata["guardrail_rules"] = strings.Join(rules, ",")
+}
+
+// replaceResponse withdraws a response the guardrails blocked and sends
+// the fallback in its place. Clients discard the partial response, as for
+// an interrupted one.
+func (s *TherapeuticStreamServer) replaceResponse(
+	ctx context.Context,
+	state *StreamState,
+	streamIndex int32,
+	agentType string,
+) (*ChatMessage, error) {
+	state.parties.discardPartials()
+
+	msg := &ChatMessage{
+		SessionId:   state.SessionID,
+		UserId:      state.UserID,
+		Role:        RoleAssistant,
+		Content:     s.guardrails.Fallback,
+		Timestamp:   timestamppb.Now(),
+		AgentType:   agentType,
+		StreamIndex: streamIndex,
+		IsFinal:     true,
+		Metadata: map[string]string{
+			"guardrail":        string(GuardrailReplace),
+			"replaces_partial": "true",
+		},
+	}
+	s.localizeNotice(ctx, state, msg)
+	return msg, state.parties.send(msg)
+}
+
+// recordGuardrailTriggers logs a response's rule matches for clinical
+// review
+func (s *TherapeuticStreamServer) recordGuardrailTriggers(ctx context.Context, state *StreamState, agentType string, g *responseGuard) {
+	if g == nil || len(g.hits) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	key := guardrailLogKey(state.FacilityID)
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, h := range g.hits {
+			s.logger.Warn("guardrail triggered",
+				slog.String("session_id", state.SessionID),
+				slog.String("rule", h.rule.Name),
+				slog.String("category", h.rule.Category),
+				slog.String("action", string(h.rule.Action)),
+			)
+			data, err := json.Marshal(&GuardrailTrigger{
+				SessionID: state.SessionID,
+				UserID:    state.UserID,
+				AgentType: agentType,
+				Rule:      h.rule.Name,
+				Category:  h.rule.Category,
+				Action:    h.rule.Action,
+				Excerpt:   h.excerpt,
+				Timestamp: time.Now(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal trigger: %w", err)
+			}
+			pipe.RPush(ctx, key, data)
+		}
+		pipe.LTrim(ctx, key, -guardrailLogSize, -1)
+		pipe.Expire(ctx, key, guardrailLogTTL)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to record guardrail triggers",
+			slog.String("session_id", state.SessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,353 @@
+package streaming
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Conversation history limits
+const (
+	historyCacheSize   = 100 // Most recent messages kept in Redis per session
+	historyCacheTTL    = 24 * time.Hour
+	historyPageMax     = 100
+	historyContextSize = 50   // Messages considered for a generation context
+	contextTokenBudget = 3000 // Approximate tokens of history sent with a generation
+	crisisContextSize  = 10   // Recent messages given to crisis analysis
+)
+
+// ErrInvalidHistoryCursor is returned for a malformed pagination cursor
+var ErrInvalidHistoryCursor = errors.New("invalid history cursor")
+
+// HistoryPage is one page of a session's conversation, oldest first
+type HistoryPage struct {
+	Messages []*ChatMessage `json:"messages"`
+	// NextCursor fetches the preceding page; empty when there is none
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// MessageStore persists complete chat messages, inbound and outbound
+type MessageStore interface {
+	Append(ctx context.Context, msg *ChatMessage) error
+	// Recent returns up to limit of a session's latest messages, oldest first
+	Recent(ctx context.Context, sessionID string, limit int) ([]*ChatMessage, error)
+	// GetHistory pages backwards through a session from cursor ("" for the latest)
+	GetHistory(ctx context.Context, sessionID, cursor string, limit int) (*HistoryPage, error)
+}
+
+// PostgresMessageStore keeps history in Postgres with the latest messages of
+// each session cached in Redis. Expected schema:
+//
+//	CREATE TABLE chat_messages (
+//	    position   BIGSERIAL PRIMARY KEY,
+//	    id         TEXT NOT NULL UNIQUE,
+//	    session_id TEXT NOT NULL,
+//	    user_id    TEXT NOT NULL,
+//	    role       TEXT NOT NULL,
+//	    created_at TIMESTAMPTZ NOT NULL,
+//	    message    JSONB NOT NULL
+//	);
+//	CREATE INDEX chat_messages_session ON chat_messages (session_id, position);
+type PostgresMessageStore struct {
+	db     *sql.DB
+	redis  *redis.Client
+	logger *slog.Logger
+}
+
+// NewPostgresMessageStore creates a message store
+func NewPostgresMessageStore(db *sql.DB, redis *redis.Client, logger *slog.Logger) *PostgresMessageStore {
+	return &PostgresMessageStore{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// cacheKey returns the Redis list caching a session's latest messages
+func (m *PostgresMessageStore) cacheKey(sessionID string) string {
+	return fmt.Sprintf("session:%s:history", sessionID)
+}
+
+// Append stores a message, assigning an ID and timestamp if missing. A
+// cache failure is logged; the message is still in Postgres.
+func (m *PostgresMessageStore) Append(ctx context.Context, msg *ChatMessage) error {
+	if msg.Id == "" {
+		msg.Id = uuid.New().String()
+	}
+	if msg.Timestamp == nil {
+		msg.Timestamp = timestamppb.Now()
+	}
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	_, err = m.db.ExecContext(ctx, `
+		INSERT INTO chat_messages (id, session_id, user_id, role, created_at, message)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING`,
+		msg.Id, msg.SessionId, msg.UserId, msg.Role, msg.Timestamp.AsTime(), data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store message: %w", err)
+	}
+
+	key := m.cacheKey(msg.SessionId)
+	_, err = m.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, data)
+		pipe.LTrim(ctx, key, -historyCacheSize, -1)
+		pipe.Expire(ctx, key, historyCacheTTL)
+		return nil
+	})
+	if err != nil {
+		m.logger.Warn("failed to cache message",
+			slog.String("session_id", msg.SessionId),
+			slog.String("error", err.Error()),
+		)
+	}
+	return nil
+}
+
+// Recent returns a session's latest messages from the cache, falling back
+// to Postgres when the cache is cold
+func (m *PostgresMessageStore) Recent(ctx context.Context, sessionID string, limit int) ([]*ChatMessage, error) {
+	raw, err := m.redis.LRange(ctx, m.cacheKey(sessionID), int64(-limit), -1).Result()
+	if err == nil && len(raw) > 0 {
+		messages := make([]*ChatMessage, 0, len(raw))
+		for _, item := range raw {
+			msg := &ChatMessage{}
+			if err := redisJSON.Unmarshal([]byte(item), msg); err == nil {
+				messages = append(messages, msg)
+			}
+		}
+		return messages, nil
+	}
+
+	page, err := m.GetHistory(ctx, sessionID, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	return page.Messages, nil
+}
+
+// GetHistory returns the page of messages preceding cursor
+func (m *PostgresMessageStore) GetHistory(ctx context.Context, sessionID, cursor string, limit int) (*HistoryPage, error) {
+	if limit <= 0 || limit > historyPageMax {
+		limit = historyPageMax
+	}
+
+	var before int64
+	if cursor != "" {
+		var err error
+		before, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return nil, ErrInvalidHistoryCursor
+		}
+	}
+
+	// One extra row tells whether an older page exists
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT position, message FROM chat_messages
+		WHERE session_id = $1 AND ($2 = 0 OR position < $2)
+		ORDER BY position DESC
+		LIMIT $3`,
+		sessionID, before, limit+1,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []int64
+	var messages []*ChatMessage
+	for rows.Next() {
+		var position int64
+		var data []byte
+		if err := rows.Scan(&position, &data); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		msg := &ChatMessage{}
+		if err := redisJSON.Unmarshal(data, msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message: %w", err)
+		}
+		positions = append(positions, position)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+
+	page := &HistoryPage{}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.NextCursor = strconv.FormatInt(positions[limit-1], 10)
+	}
+
+	// Rows come newest first; pages read oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	page.Messages = messages
+	return page, nil
+}
+
+// TransferTranscripts reassigns a user's conversations to another user,
+// e.g. a guest's demo conversation to the resident account they enrolled
+// as. Cached history of the moved sessions is dropped so it reloads with
+// the new owner.
+func (m *PostgresMessageStore) TransferTranscripts(ctx context.Context, fromUserID, toUserID string) error {
+	rows, err := m.db.QueryContext(ctx, `
+		UPDATE chat_messages
+		SET user_id = $2, message = jsonb_set(message, '{userId}', to_jsonb($2::text))
+		WHERE user_id = $1
+		RETURNING session_id`,
+		fromUserID, toUserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to transfer messages: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make(map[string]bool)
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return fmt.Errorf("failed to read transferred session: %w", err)
+		}
+		sessions[sessionID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to transfer messages: %w", err)
+	}
+
+	_, err = m.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for sessionID := range sessions {
+			pipe.Del(ctx, m.cacheKey(sessionID))
+			pipe.SetXX(ctx, sessionOwnerKey(sessionID), toUserID, redis.KeepTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		m.logger.Warn("failed to update transferred sessions",
+			slog.String("user_id", toUserID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	m.logger.Info("transcripts transferred",
+		slog.String("from_user_id", fromUserID),
+		slog.String("to_user_id", toUserID),
+		slog.Int("sessions", len(sessions)),
+	)
+	return nil
+}
+
+// recordMessage stores a message if history is configured. Storage
+// failures don't interrupt the conversation.
+func (s *TherapeuticStreamServer) recordMessage(ctx context.Context, msg *ChatMessage) {
+	if s.history == nil {
+		return
+	}
+	if err := s.history.Append(context.WithoutCancel(ctx), msg); err != nil {
+		s.logger.Error("failed to record chat message",
+			slog.String("session_id", msg.SessionId),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// recentHistory loads a session's latest messages for context
+func (s *TherapeuticStreamServer) recentHistory(ctx context.Context, sessionID string) []*ChatMessage {
+	if s.history == nil {
+		return nil
+	}
+	messages, err := s.history.Recent(ctx, sessionID, historyContextSize)
+	if err != nil {
+		s.logger.Warn("failed to load conversation history",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return nil
+	}
+	return messages
+}
+
+// recentContents returns the text of the last few conversational messages
+// for crisis analysis
+func recentContents(history []*ChatMessage) []string {
+	contents := make([]string, 0, crisisContextSize)
+	for i := len(history) - 1; i >= 0 && len(contents) < crisisContextSize; i-- {
+		if conversational(history[i]) {
+			contents = append(contents, englishContent(history[i]))
+		}
+	}
+	for i, j := 0, len(contents)-1; i < j; i, j = i+1, j-1 {
+		contents[i], contents[j] = contents[j], contents[i]
+	}
+	return contents
+}
+
+// conversational reports whether a message belongs in generation context.
+// Presence events and other control messages don't.
+func conversational(msg *ChatMessage) bool {
+	switch msg.Role {
+	case RoleUser, RoleAssistant:
+		return msg.Content != ""
+	case RoleSystem:
+		return msg.CrisisLevel != ""
+	}
+	return false
+}
+
+// estimateTokens approximates a message's token count
+func estimateTokens(msg *ChatMessage) int {
+	return len(msg.Content)/4 + 4
+}
+
+// contextWindow trims history to fit a token budget. Crisis-annotated
+// messages are kept first so safety context outlives ordinary turns; the
+// rest is filled newest first. Chronological order is preserved.
+func contextWindow(history []*ChatMessage, budget int) []*ChatMessage {
+	keep := make([]bool, len(history))
+	used := 0
+
+	for i, msg := range history {
+		if msg.CrisisLevel != "" && conversational(msg) {
+			if cost := estimateTokens(msg); used+cost <= budget {
+				keep[i] = true
+				used += cost
+			}
+		}
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		msg := history[i]
+		if keep[i] || !conversational(msg) {
+			continue
+		}
+		cost := estimateTokens(msg)
+		if used+cost > budget {
+			break
+		}
+		keep[i] = true
+		used += cost
+	}
+
+	window := make([]*ChatMessage, 0, len(history))
+	for i, msg := range history {
+		if keep[i] {
+			window = append(window, msg)
+		}
+	}
+	return window
+}
@@ -0,0 +1,163 @@
+package streaming
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// controlIdleWarning tells the resident the session will close soon
+const controlIdleWarning = "idle_warning"
+
+// idleClosedResponse is sent when an abandoned session is closed
+const idleClosedResponse = "It's been quiet for a while, so I've closed our conversation for now. I'm here whenever you'd like to talk again."
+
+// IdleConfig controls keepalives and the closing of abandoned sessions
+type IdleConfig struct {
+	IdleTimeout      time.Duration // Sessions without a resident message are closed after this; 0 disables
+	IdleWarning      time.Duration // Residents are warned this long before
+	ClientTimeout    time.Duration // Clients that answer heartbeats are dropped this long after their last
+	KeepaliveTime    time.Duration // Transport pings on connections quiet this long
+	KeepaliveTimeout time.Duration // Connections not answering a ping are closed after this
+}
+
+// DefaultIdleConfig returns idle settings for resident conversations
+func DefaultIdleConfig() *IdleConfig {
+	return &IdleConfig{
+		IdleTimeout:      30 * time.Minute,
+		IdleWarning:      5 * time.Minute,
+		ClientTimeout:    3 * heartbeatInterval,
+		KeepaliveTime:    30 * time.Second,
+		KeepaliveTimeout: 10 * time.Second,
+	}
+}
+
+// SetIdleConfig replaces the idle settings. It must be called before the
+// server starts accepting streams.
+func (s *TherapeuticStreamServer) SetIdleConfig(config *IdleConfig) {
+	s.idle = config
+}
+
+// KeepaliveServerOptions returns the server options that detect dead
+// connections at the transport, ending their streams. The server should be
+// built with them so a vanished client doesn't hold its session open.
+func KeepaliveServerOptions(config *IdleConfig) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    config.KeepaliveTime,
+			Timeout: config.KeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             heartbeatInterval / 2,
+			PermitWithoutStream: true,
+		}),
+	}
+}
+
+// touch records resident activity
+func (st *StreamState) touch() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.LastActivity = time.Now()
+}
+
+// idleFor returns how long since the resident last sent a message
+func (st *StreamState) idleFor() time.Duration {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return time.Since(st.LastActivity)
+}
+
+// heard records that a party's client is alive. Clients opt in to liveness
+// checks by answering heartbeats.
+func (p *participant) heard() {
+	p.lastHeard.Store(time.Now().UnixNano())
+}
+
+// silentFor returns how long since the client last answered a heartbeat.
+// It reports false for clients that never have.
+func (p *participant) silentFor() (time.Duration, bool) {
+	last := p.lastHeard.Load()
+	if last == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, last)), true
+}
+
+// watchIdle ends a party's stream when its client stops answering
+// heartbeats, and closes the resident's session once it has been idle for
+// IdleTimeout. A nil error on done is a graceful close.
+func (s *TherapeuticStreamServer) watchIdle(ctx context.Context, p *participant, state *StreamState, done chan<- error) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stream.failed:
+			return
+		case <-ticker.C:
+		}
+
+		if silent, ok := p.silentFor(); ok && silent > s.idle.ClientTimeout {
+			s.logger.Warn("chat client stopped answering heartbeats",
+				slog.String("session_id", state.SessionID),
+				slog.String("user_id", p.UserID),
+				slog.Duration("silent", silent),
+			)
+			done <- status.Error(codes.Unavailable, "client stopped answering heartbeats")
+			return
+		}
+
+		if p.Role != ParticipantResident || s.idle.IdleTimeout <= 0 || state.generating() {
+			continue
+		}
+		idle := state.idleFor()
+		warnAt := s.idle.IdleTimeout - s.idle.IdleWarning
+		switch {
+		case idle >= s.idle.IdleTimeout:
+			s.closeIdleSession(ctx, state, idle)
+			done <- nil
+			return
+		case idle >= warnAt && !warned:
+			warned = true
+			state.parties.send(controlMessage(state.SessionID, controlIdleWarning, map[string]string{
+				"closes_in_seconds": strconv.Itoa(int((s.idle.IdleTimeout - idle).Seconds())),
+			}))
+		case idle < warnAt:
+			warned = false
+		}
+	}
+}
+
+// closeIdleSession tells everyone an abandoned session is closing. The
+// Chat handler's cleanup then summarizes it and releases its state.
+func (s *TherapeuticStreamServer) closeIdleSession(ctx context.Context, state *StreamState, idle time.Duration) {
+	s.logger.Info("closing idle chat session",
+		slog.String("session_id", state.SessionID),
+		slog.String("user_id", state.UserID),
+		slog.Duration("idle", idle),
+	)
+
+	notice := &ChatMessage{
+		SessionId: state.SessionID,
+		UserId:    state.UserID,
+		Role:      RoleSystem,
+		Content:   idleClosedResponse,
+		Timestamp: timestamppb.Now(),
+		IsFinal:   true,
+		Metadata:  map[string]string{"type": "session_idle"},
+	}
+	s.localizeNotice(ctx, state, notice)
+	s.recordMessage(ctx, notice)
+	state.parties.send(notice)
+}
@@ -0,0 +1,84 @@
+package streaming
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// heartbeatInterval is how often idle or long-running streams are pinged
+const heartbeatInterval = 15 * time.Second
+
+// Control message types, carried in metadata["type"] on system messages.
+// They drive client UI state and are neither stored nor replayed.
+const (
+	controlTyping      = "typing"       // A person is composing a message
+	controlThinking    = "thinking"     // Generation has started
+	controlAgentSwitch = "agent_switch" // A different agent is now responding
+	controlHeartbeat   = "heartbeat"    // Sent by the server; clients answer to prove they are alive
+)
+
+// isControl reports whether msg is an ephemeral control message
+func isControl(msg *ChatMessage) bool {
+	switch msg.Metadata["type"] {
+	case controlTyping, controlThinking, controlAgentSwitch, controlHeartbeat, controlIdleWarning, controlError:
+		return true
+	}
+	return false
+}
+
+// controlMessage builds a control message of the given type
+func controlMessage(sessionID, kind string, fields map[string]string) *ChatMessage {
+	metadata := map[string]string{"type": kind}
+	for k, v := range fields {
+		metadata[k] = v
+	}
+	return &ChatMessage{
+		SessionId: sessionID,
+		Role:      RoleSystem,
+		Timestamp: timestamppb.Now(),
+		IsFinal:   true,
+		Metadata:  metadata,
+	}
+}
+
+// typingMessage relays that a party is composing a message
+func typingMessage(sessionID string, p *participant) *ChatMessage {
+	return controlMessage(sessionID, controlTyping, map[string]string{
+		"participant_id":   p.UserID,
+		"participant_role": string(p.Role),
+	})
+}
+
+// generating reports whether a response is being generated
+func (st *StreamState) generating() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.cancelGeneration != nil
+}
+
+// heartbeat pings a party periodically so clients can tell a long
+// generation from a stalled connection, and idle streams stay open through
+// proxies
+func (s *TherapeuticStreamServer) heartbeat(ctx context.Context, p *participant, state *StreamState) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stream.failed:
+			return
+		case <-ticker.C:
+			msg := controlMessage(state.SessionID, controlHeartbeat, map[string]string{
+				"generating": strconv.FormatBool(state.generating()),
+			})
+			if err := p.stream.send(msg); err != nil {
+				return
+			}
+		}
+	}
+}
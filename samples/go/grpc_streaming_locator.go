@@ -0,0 +1,168 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Session locator timing. An instance that dies stops refreshing and its
+// sessions are unlocated after locatorTTL.
+const (
+	locatorTTL     = time.Minute
+	locatorRefresh = 20 * time.Second
+)
+
+// releaseLocator deletes a session's locator only if this instance still
+// holds it; a reconnect elsewhere may have taken it over
+var releaseLocator = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// routedMessage is a message forwarded to the instance serving a session
+type routedMessage struct {
+	SessionID string          `json:"session_id"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// sessionLocatorKey maps a session to the instance serving it
+func sessionLocatorKey(sessionID string) string {
+	return fmt.Sprintf("session:%s:instance", sessionID)
+}
+
+// instanceChannel carries messages routed to one instance's sessions
+func instanceChannel(instanceID string) string {
+	return fmt.Sprintf("instance:%s:sessions", instanceID)
+}
+
+// SetInstanceID names this instance in the session locator, e.g. with the
+// pod name. It must be called before the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetInstanceID(instanceID string) {
+	s.instanceID = instanceID
+}
+
+// locateSession records that this instance serves a session and keeps the
+// record fresh. The returned release must be called when the session ends.
+func (s *TherapeuticStreamServer) locateSession(ctx context.Context, sessionID string) func() {
+	s.routerOnce.Do(func() {
+		go s.runSessionRouter(context.Background())
+	})
+
+	key := sessionLocatorKey(sessionID)
+	if err := s.redis.Set(ctx, key, s.instanceID, locatorTTL).Err(); err != nil {
+		s.logger.Warn("failed to register session location",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	refreshCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(locatorRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-refreshCtx.Done():
+				return
+			case <-ticker.C:
+				if err := s.redis.Set(refreshCtx, key, s.instanceID, locatorTTL).Err(); err != nil && refreshCtx.Err() == nil {
+					s.logger.Warn("failed to refresh session location",
+						slog.String("session_id", sessionID),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		if err := releaseLocator.Run(context.WithoutCancel(ctx), s.redis, []string{key}, s.instanceID).Err(); err != nil {
+			s.logger.Warn("failed to release session location",
+				slog.String("session_id", sessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// sessionInstance returns the instance serving a session, or "" if no
+// instance is
+func (s *TherapeuticStreamServer) sessionInstance(ctx context.Context, sessionID string) (string, error) {
+	instanceID, err := s.redis.Get(ctx, sessionLocatorKey(sessionID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to locate session: %w", err)
+	}
+	return instanceID, nil
+}
+
+// routeToInstance forwards a message to the instance serving its session.
+// It reports false if that instance isn't listening.
+func (s *TherapeuticStreamServer) routeToInstance(ctx context.Context, instanceID, sessionID string, msg *ChatMessage) (bool, error) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	envelope, err := json.Marshal(&routedMessage{SessionID: sessionID, Message: data})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal routed message: %w", err)
+	}
+	receivers, err := s.redis.Publish(ctx, instanceChannel(instanceID), envelope).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to route message: %w", err)
+	}
+	return receivers > 0, nil
+}
+
+// runSessionRouter delivers messages other instances route here. A session
+// that ended in the meantime gets the message queued for its resident.
+func (s *TherapeuticStreamServer) runSessionRouter(ctx context.Context) {
+	pubsub := s.redis.Subscribe(ctx, instanceChannel(s.instanceID))
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case redisMsg := <-ch:
+			var routed routedMessage
+			if err := json.Unmarshal([]byte(redisMsg.Payload), &routed); err != nil {
+				s.logger.Error("failed to unmarshal routed message",
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			msg := &ChatMessage{}
+			if err := redisJSON.Unmarshal(routed.Message, msg); err != nil {
+				s.logger.Error("failed to unmarshal routed message",
+					slog.String("session_id", routed.SessionID),
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+
+			if stateI, ok := s.sessions.Load(routed.SessionID); ok {
+				if err := stateI.(*StreamState).parties.send(msg); err == nil {
+					continue
+				}
+			}
+			if err := s.queueForOwner(ctx, routed.SessionID, msg); err != nil {
+				s.logger.Error("routed message undeliverable",
+					slog.String("session_id", routed.SessionID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultLatencyBuckets are histogram bucket upper bounds in seconds
+var defaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Reserved histogram fields alongside the bucket counts
+const (
+	histogramCountField = "count"
+	histogramSumField   = "sum"
+	histogramInfBucket  = "+Inf"
+)
+
+// Services report gauges in metrics:<service>, counters in
+// metrics:<service>:counters, and each histogram's per-bucket counts in
+// metrics:<service>:histogram:<name>, listed in metrics:<service>:histograms.
+
+// countersKey holds a service's monotonically increasing counters
+func countersKey(serviceType string) string {
+	return fmt.Sprintf("metrics:%s:counters", serviceType)
+}
+
+// histogramKey holds one histogram's bucket counts, count and sum
+func histogramKey(serviceType, name string) string {
+	return fmt.Sprintf("metrics:%s:histogram:%s", serviceType, name)
+}
+
+// histogramsKey lists a service's histograms
+func histogramsKey(serviceType string) string {
+	return fmt.Sprintf("metrics:%s:histograms", serviceType)
+}
+
+// MetricsRecorder writes counters and histograms in the layout
+// MetricsStreamServer reads
+type MetricsRecorder struct {
+	redis   *redis.Client
+	buckets []float64
+}
+
+// NewMetricsRecorder creates a recorder using latency buckets in seconds
+func NewMetricsRecorder(redis *redis.Client) *MetricsRecorder {
+	return &MetricsRecorder{
+		redis:   redis,
+		buckets: defaultLatencyBuckets,
+	}
+}
+
+// Increment adds to a counter
+func (r *MetricsRecorder) Increment(ctx context.Context, serviceType, name string, delta float64) error {
+	if err := r.redis.HIncrByFloat(ctx, countersKey(serviceType), name, delta).Err(); err != nil {
+		return fmt.Errorf("failed to increment counter: %w", err)
+	}
+	return nil
+}
+
+// Observe records one value in a histogram
+func (r *MetricsRecorder) Observe(ctx context.Context, serviceType, name string, value float64) error {
+	bucket := histogramInfBucket
+	for _, bound := range r.buckets {
+		if value <= bound {
+			bucket = strconv.FormatFloat(bound, 'g', -1, 64)
+			break
+		}
+	}
+
+	key := histogramKey(serviceType, name)
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, bucket, 1)
+		pipe.HIncrBy(ctx, key, histogramCountField, 1)
+		pipe.HIncrByFloat(ctx, key, histogramSumField, value)
+		pipe.SAdd(ctx, histogramsKey(serviceType), name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record observation: %w", err)
+	}
+	return nil
+}
+
+// histogramSnapshot is a histogram's cumulative state at one moment
+type histogramSnapshot struct {
+	buckets map[float64]float64 // Per-bucket counts by upper bound
+	count   float64
+	sum     float64
+}
+
+// parseHistogram reads a histogram hash
+func parseHistogram(fields map[string]string) histogramSnapshot {
+	h := histogramSnapshot{buckets: make(map[float64]float64)}
+	for field, raw := range fields {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case histogramCountField:
+			h.count = value
+		case histogramSumField:
+			h.sum = value
+		case histogramInfBucket:
+			h.buckets[math.Inf(1)] = value
+		default:
+			if bound, err := strconv.ParseFloat(field, 64); err == nil {
+				h.buckets[bound] = value
+			}
+		}
+	}
+	return h
+}
+
+// since returns the observations made after prev. A histogram that was
+// reset is taken as new.
+func (h histogramSnapshot) since(prev histogramSnapshot) histogramSnapshot {
+	if h.count < prev.count {
+		return h
+	}
+	diff := histogramSnapshot{
+		buckets: make(map[float64]float64, len(h.buckets)),
+		count:   h.count - prev.count,
+		sum:     h.sum - prev.sum,
+	}
+	for bound, n := range h.buckets {
+		diff.buckets[bound] = n - prev.buckets[bound]
+	}
+	return diff
+}
+
+// quantile estimates the q-th quantile by interpolating within the bucket
+// it falls in. Values past the last finite bound report that bound.
+func (h histogramSnapshot) quantile(q float64) float64 {
+	bounds := make([]float64, 0, len(h.buckets))
+	var total float64
+	for bound, n := range h.buckets {
+		bounds = append(bounds, bound)
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Float64s(bounds)
+
+	rank := q * total
+	var seen, lower float64
+	for _, upper := range bounds {
+		n := h.buckets[upper]
+		if seen+n >= rank && n > 0 {
+			if math.IsInf(upper, 1) {
+				return lower
+			}
+			return lower + (upper-lower)*(rank-seen)/n
+		}
+		seen += n
+		if !math.IsInf(upper, 1) {
+			lower = upper
+		}
+	}
+	return lower
+}
+
+// summary reduces the snapshot to what dashboards chart
+func (h histogramSnapshot) summary() *HistogramSummary {
+	summary := &HistogramSummary{Count: uint64(h.count)}
+	if h.count > 0 {
+		summary.Mean = h.sum / h.count
+		summary.P50 = h.quantile(.5)
+		summary.P95 = h.quantile(.95)
+		summary.P99 = h.quantile(.99)
+	}
+	return summary
+}
+
+// metricsWindow is one reading of a service's counters and histograms.
+// Consecutive readings give rates and per-interval percentiles.
+type metricsWindow struct {
+	at         time.Time
+	counters   map[string]float64
+	histograms map[string]histogramSnapshot
+}
+
+// readWindow reads a service's counters and histograms
+func (s *MetricsStreamServer) readWindow(ctx context.Context, serviceType string) (*metricsWindow, error) {
+	names, err := s.redis.SMembers(ctx, histogramsKey(serviceType)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list histograms: %w", err)
+	}
+
+	var counters *redis.StringStringMapCmd
+	histograms := make(map[string]*redis.StringStringMapCmd, len(names))
+	_, err = s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		counters = pipe.HGetAll(ctx, countersKey(serviceType))
+		for _, name := range names {
+			histograms[name] = pipe.HGetAll(ctx, histogramKey(serviceType, name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	w := &metricsWindow{
+		at:         time.Now(),
+		counters:   make(map[string]float64),
+		histograms: make(map[string]histogramSnapshot, len(names)),
+	}
+	for name, raw := range counters.Val() {
+		if value, err := strconv.ParseFloat(raw, 64); err == nil {
+			w.counters[name] = value
+		}
+	}
+	for name, cmd := range histograms {
+		w.histograms[name] = parseHistogram(cmd.Val())
+	}
+	return w, nil
+}
+
+// rates returns each counter's increase per second since prev. A counter
+// that went backwards was reset and counts from zero.
+func (w *metricsWindow) rates(prev *metricsWindow) map[string]float64 {
+	if prev == nil {
+		return nil
+	}
+	elapsed := w.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	rates := make(map[string]float64, len(w.counters))
+	for name, value := range w.counters {
+		delta := value - prev.counters[name]
+		if delta < 0 {
+			delta = value
+		}
+		rates[name] = delta / elapsed
+	}
+	return rates
+}
+
+// summaries describes each histogram's observations since prev
+func (w *metricsWindow) summaries(prev *metricsWindow) map[string]*HistogramSummary {
+	if prev == nil {
+		return nil
+	}
+	summaries := make(map[string]*HistogramSummary, len(w.histograms))
+	for name, h := range w.histograms {
+		summaries[name] = h.since(prev.histograms[name]).summary()
+	}
+	return summaries
+}
+
+// ListMetrics lists the gauges, counters and histograms services report
+func (s *MetricsStreamServer) ListMetrics(ctx context.Context, req *MetricsCatalogRequest) (*MetricsCatalogResponse, error) {
+	serviceTypes := req.ServiceTypes
+	if len(serviceTypes) == 0 {
+		var err error
+		if serviceTypes, err = s.reportingServices(ctx); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	response := &MetricsCatalogResponse{}
+	for _, serviceType := range serviceTypes {
+		var gauges, counters *redis.StringSliceCmd
+		var histograms *redis.StringSliceCmd
+		_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			gauges = pipe.HKeys(ctx, fmt.Sprintf("metrics:%s", serviceType))
+			counters = pipe.HKeys(ctx, countersKey(serviceType))
+			histograms = pipe.SMembers(ctx, histogramsKey(serviceType))
+			return nil
+		})
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read metrics catalog")
+		}
+
+		catalog := &ServiceMetricsCatalog{
+			ServiceType: serviceType,
+			Gauges:      gauges.Val(),
+			Counters:    counters.Val(),
+			Histograms:  histograms.Val(),
+		}
+		sort.Strings(catalog.Gauges)
+		sort.Strings(catalog.Counters)
+		sort.Strings(catalog.Histograms)
+		response.Services = append(response.Services, catalog)
+	}
+	return response, nil
+}
+
+// reportingServices finds every service with metrics in Redis
+func (s *MetricsStreamServer) reportingServices(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	iter := s.redis.Scan(ctx, 0, "metrics:*", 100).Iterator()
+	for iter.Next(ctx) {
+		parts := strings.SplitN(iter.Val(), ":", 3)
+		if len(parts) >= 2 && parts[1] != "" {
+			seen[parts[1]] = true
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan metrics: %w", err)
+	}
+
+	services := make([]string, 0, len(seen))
+	for serviceType := range seen {
+		services = append(services, serviceType)
+	}
+	sort.Strings(services)
+	return services, nil
+}
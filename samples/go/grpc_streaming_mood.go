@@ -0,0 +1,186 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Mood trajectory parameters
+const (
+	moodHistorySize = 50  // Points kept per session for replay
+	moodWindow      = 10  // Recent points the trajectory is computed over
+	moodSmoothing   = 0.3 // Weight of the newest point in the rolling valence
+)
+
+// EmotionResult scores a message's emotional content. The AI router
+// derives it from the message's embedding.
+type EmotionResult struct {
+	Valence  float64            // -1 (negative) to 1 (positive)
+	Arousal  float64            // 0 (calm) to 1 (agitated)
+	Emotions map[string]float64 // e.g. sadness, anxiety, hope
+}
+
+// moodKey holds a session's recent mood points
+func moodKey(sessionID string) string {
+	return fmt.Sprintf("session:%s:mood", sessionID)
+}
+
+// moodChannel carries a session's mood updates to staff dashboards
+func moodChannel(sessionID string) string {
+	return fmt.Sprintf("session:%s:mood:updates", sessionID)
+}
+
+// trackMood scores a resident message in the background and publishes the
+// updated trajectory. Scoring never delays the response.
+func (s *TherapeuticStreamServer) trackMood(ctx context.Context, state *StreamState, msg *ChatMessage) {
+	ctx = context.WithoutCancel(ctx)
+	messageID := msg.Id
+	if messageID == "" {
+		messageID = uuid.New().String()
+	}
+	content := msg.Content
+
+	go func() {
+		if err := s.recordMood(ctx, state.SessionID, messageID, content); err != nil {
+			s.logger.Warn("failed to update mood trajectory",
+				slog.String("session_id", state.SessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+}
+
+// recordMood scores one message, appends it to the session's points and
+// publishes the update
+func (s *TherapeuticStreamServer) recordMood(ctx context.Context, sessionID, messageID, content string) error {
+	emotion, err := s.aiRouter.AnalyzeEmotion(ctx, content)
+	if err != nil {
+		return fmt.Errorf("failed to analyze emotion: %w", err)
+	}
+
+	update := &MoodUpdate{
+		SessionId: sessionID,
+		MessageId: messageID,
+		Timestamp: timestamppb.Now(),
+		Valence:   emotion.Valence,
+		Arousal:   emotion.Arousal,
+		Emotions:  emotion.Emotions,
+	}
+
+	key := moodKey(sessionID)
+	raw, err := s.redis.LRange(ctx, key, -(moodWindow - 1), -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load mood history: %w", err)
+	}
+	valences := make([]float64, 0, len(raw)+1)
+	for _, item := range raw {
+		point := &MoodUpdate{}
+		if err := redisJSON.Unmarshal([]byte(item), point); err == nil {
+			valences = append(valences, point.Valence)
+		}
+	}
+	valences = append(valences, update.Valence)
+	update.RollingValence, update.Trend, update.TrajectoryRisk = moodTrajectory(valences)
+
+	data, err := protojson.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mood update: %w", err)
+	}
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, data)
+		pipe.LTrim(ctx, key, -moodHistorySize, -1)
+		pipe.Expire(ctx, key, historyCacheTTL)
+		pipe.Publish(ctx, moodChannel(sessionID), data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish mood update: %w", err)
+	}
+	return nil
+}
+
+// moodTrajectory summarizes recent valences, oldest first. Risk rises with
+// a negative rolling mood and with a downward trend, so a resident sliding
+// from neutral is flagged before they are plainly negative.
+func moodTrajectory(valences []float64) (rolling, trend, risk float64) {
+	rolling = valences[0]
+	for _, v := range valences[1:] {
+		rolling = moodSmoothing*v + (1-moodSmoothing)*rolling
+	}
+
+	// Least-squares slope against message index
+	if n := float64(len(valences)); n > 1 {
+		var sumX, sumY, sumXY, sumXX float64
+		for i, v := range valences {
+			x := float64(i)
+			sumX += x
+			sumY += v
+			sumXY += x * v
+			sumXX += x * x
+		}
+		trend = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	}
+
+	risk = 0.6*math.Max(0, -rolling) + 0.4*math.Min(1, math.Max(0, -trend*5))
+	return rolling, trend, math.Min(1, risk)
+}
+
+// StreamSessionMood streams a session's mood updates to staff dashboards
+func (s *TherapeuticStreamServer) StreamSessionMood(
+	req *SessionMoodRequest,
+	stream grpc.ServerStreamingServer[MoodUpdate],
+) error {
+	ctx := stream.Context()
+	if req.SessionId == "" {
+		return status.Error(codes.InvalidArgument, "session_id required")
+	}
+
+	pubsub := s.redis.Subscribe(ctx, moodChannel(req.SessionId))
+	defer pubsub.Close()
+
+	// Replay after subscribing so no point is missed in between
+	if req.Replay {
+		raw, err := s.redis.LRange(ctx, moodKey(req.SessionId), 0, -1).Result()
+		if err != nil {
+			return status.Error(codes.Unavailable, "failed to load mood history")
+		}
+		for _, item := range raw {
+			update := &MoodUpdate{}
+			if err := redisJSON.Unmarshal([]byte(item), update); err != nil {
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-ch:
+			update := &MoodUpdate{}
+			if err := redisJSON.Unmarshal([]byte(msg.Payload), update); err != nil {
+				s.logger.Error("failed to unmarshal mood update",
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Offline delivery limits
+const (
+	offlineQueueTTL  = 7 * 24 * time.Hour // Undelivered messages expire after this
+	offlineQueueSize = 50                 // Kept under the default outbound buffer
+	receiptTTL       = 30 * 24 * time.Hour
+)
+
+// Delivery states reported in receipts
+const (
+	DeliveryQueued    = "queued"
+	DeliveryDelivered = "delivered"
+)
+
+// ErrSessionNotFound is returned when broadcasting to a session that has
+// never been opened
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionOwned is returned when a user opens a session that belongs to
+// another resident
+var ErrSessionOwned = errors.New("session belongs to another user")
+
+// receiptsChannel carries receipt updates to senders
+const receiptsChannel = "delivery:receipts"
+
+// DeliveryReceipt tracks a message sent while its recipient was offline
+type DeliveryReceipt struct {
+	MessageID   string     `json:"message_id"`
+	SessionID   string     `json:"session_id"`
+	UserID      string     `json:"user_id"` // Recipient
+	Status      string     `json:"status"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// sessionOwnerKey maps a session to the resident it belongs to
+func sessionOwnerKey(sessionID string) string {
+	return fmt.Sprintf("session:%s:owner", sessionID)
+}
+
+// offlineQueueKey holds a resident's undelivered messages
+func offlineQueueKey(userID string) string {
+	return fmt.Sprintf("offline:user:%s", userID)
+}
+
+// receiptKey holds a message's delivery receipt
+func receiptKey(messageID string) string {
+	return fmt.Sprintf("delivery:receipt:%s", messageID)
+}
+
+// claimSessionOwner records who a session belongs to so messages can be
+// queued for them once they disconnect. The first resident to open a session
+// owns it; anyone else gets ErrSessionOwned. The owner's claim is renewed.
+func (s *TherapeuticStreamServer) claimSessionOwner(ctx context.Context, sessionID, userID string) error {
+	key := sessionOwnerKey(sessionID)
+	for {
+		claimed, err := s.redis.SetNX(ctx, key, userID, offlineQueueTTL).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim session: %w", err)
+		}
+		if claimed {
+			return nil
+		}
+
+		owner, err := s.redis.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			// Expired between the two calls; claim it again
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read session owner: %w", err)
+		}
+		if owner != userID {
+			return ErrSessionOwned
+		}
+		if err := s.redis.Expire(ctx, key, offlineQueueTTL).Err(); err != nil {
+			s.logger.Warn("failed to renew session owner",
+				slog.String("session_id", sessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+		return nil
+	}
+}
+
+// BroadcastToSession sends a message to everyone connected to a session,
+// whichever instance they are on. The session locator names the instance
+// to route to; sessions it doesn't know of are reached through the
+// session's channel. If nobody is connected the message is queued for the
+// resident's next connection and a receipt tracks it.
+func (s *TherapeuticStreamServer) BroadcastToSession(ctx context.Context, sessionID string, msg *ChatMessage) error {
+	if stateI, ok := s.sessions.Load(sessionID); ok {
+		return stateI.(*StreamState).parties.send(msg)
+	}
+
+	instanceID, err := s.sessionInstance(ctx, sessionID)
+	if err != nil {
+		s.logger.Warn("session locator unavailable",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+	if instanceID != "" && instanceID != s.instanceID {
+		routed, err := s.routeToInstance(ctx, instanceID, sessionID, msg)
+		if err != nil {
+			return err
+		}
+		if routed {
+			return nil
+		}
+		// The instance is gone; its locator will expire
+	}
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	receivers, err := s.redis.Publish(ctx, fmt.Sprintf("session:%s:messages", sessionID), data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	if receivers > 0 {
+		return nil
+	}
+	return s.queueForOwner(ctx, sessionID, msg)
+}
+
+// queueForOwner holds a message for the resident a session belongs to
+func (s *TherapeuticStreamServer) queueForOwner(ctx context.Context, sessionID string, msg *ChatMessage) error {
+	userID, err := s.redis.Get(ctx, sessionOwnerKey(sessionID)).Result()
+	if err == redis.Nil {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up session owner: %w", err)
+	}
+	return s.queueOffline(ctx, userID, msg)
+}
+
+// queueOffline holds a message for a disconnected resident
+func (s *TherapeuticStreamServer) queueOffline(ctx context.Context, userID string, msg *ChatMessage) error {
+	if msg.Id == "" {
+		msg.Id = uuid.New().String()
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	receipt, err := json.Marshal(&DeliveryReceipt{
+		MessageID: msg.Id,
+		SessionID: msg.SessionId,
+		UserID:    userID,
+		Status:    DeliveryQueued,
+		QueuedAt:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal receipt: %w", err)
+	}
+
+	key := offlineQueueKey(userID)
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, data)
+		pipe.LTrim(ctx, key, -offlineQueueSize, -1)
+		pipe.Expire(ctx, key, offlineQueueTTL)
+		pipe.Set(ctx, receiptKey(msg.Id), receipt, receiptTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	s.logger.Info("queued message for offline resident",
+		slog.String("session_id", msg.SessionId),
+		slog.String("user_id", userID),
+		slog.String("message_id", msg.Id),
+	)
+	return nil
+}
+
+// deliverOffline hands a connecting resident everything queued while they
+// were away, ahead of live traffic
+func (s *TherapeuticStreamServer) deliverOffline(ctx context.Context, p *participant) {
+	key := offlineQueueKey(p.UserID)
+
+	var queued *redis.StringSliceCmd
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		queued = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to load offline messages",
+			slog.String("user_id", p.UserID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	for _, item := range queued.Val() {
+		msg := &ChatMessage{}
+		if err := redisJSON.Unmarshal([]byte(item), msg); err != nil {
+			s.logger.Error("failed to unmarshal offline message",
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string)
+		}
+		msg.Metadata["offline_delivery"] = "true"
+
+		if err := p.deliver(msg); err != nil {
+			// Put back what couldn't be handed over
+			if err := s.queueOffline(ctx, p.UserID, msg); err != nil {
+				s.logger.Error("offline message lost",
+					slog.String("message_id", msg.Id),
+					slog.String("error", err.Error()),
+				)
+			}
+			continue
+		}
+		s.markDelivered(ctx, msg.Id)
+	}
+}
+
+// markDelivered updates a message's receipt and tells its sender
+func (s *TherapeuticStreamServer) markDelivered(ctx context.Context, messageID string) {
+	receipt, err := s.DeliveryStatus(ctx, messageID)
+	if err != nil {
+		s.logger.Warn("delivery receipt unavailable",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	now := time.Now()
+	receipt.Status = DeliveryDelivered
+	receipt.DeliveredAt = &now
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return
+	}
+
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, receiptKey(messageID), data, receiptTTL)
+		pipe.Publish(ctx, receiptsChannel, data)
+		return nil
+	})
+	if err != nil {
+		s.logger.Warn("failed to record delivery receipt",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// DeliveryStatus returns the receipt for a message queued by
+// BroadcastToSession
+func (s *TherapeuticStreamServer) DeliveryStatus(ctx context.Context, messageID string) (*DeliveryReceipt, error) {
+	data, err := s.redis.Get(ctx, receiptKey(messageID)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("no receipt for message %s", messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt: %w", err)
+	}
+
+	receipt := &DeliveryReceipt{}
+	if err := json.Unmarshal(data, receipt); err != nil {
+		return nil, fmt.Errorf("failed to decode receipt: %w", err)
+	}
+	return receipt, nil
+}
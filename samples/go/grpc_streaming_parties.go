@@ -0,0 +1,333 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ParticipantRole identifies who a party to a chat session is
+type ParticipantRole string
+
+const (
+	ParticipantResident  ParticipantRole = "resident" // Session owner; drives the AI conversation
+	ParticipantClinician ParticipantRole = "clinician"
+	ParticipantFamily    ParticipantRole = "family"
+)
+
+// ParticipantMode controls whether a joining party may speak
+type ParticipantMode string
+
+const (
+	ModeParticipant ParticipantMode = "participant"
+	ModeObserver    ParticipantMode = "observer"
+)
+
+// participant is one connected party to a session
+type participant struct {
+	UserID   string
+	Role     ParticipantRole
+	Mode     ParticipantMode
+	JoinedAt time.Time
+
+	stream    *sessionStream
+	lastHeard atomic.Int64 // Unix nanos of the last heartbeat answer; 0 if never
+}
+
+// view returns the copy of msg this participant may see, or nil. Family
+// members don't see crisis annotations or crisis notices meant for the
+// resident.
+func (p *participant) view(msg *ChatMessage) *ChatMessage {
+	if p.Role == ParticipantFamily {
+		if msg.Metadata["type"] == "crisis_protocol" || (msg.Role == RoleSystem && msg.CrisisLevel != "") {
+			return nil
+		}
+	}
+
+	// Each stream's buffer may coalesce or annotate its own copy
+	clone := proto.Clone(msg).(*ChatMessage)
+	if p.Role == ParticipantFamily {
+		clone.CrisisLevel = ""
+	}
+	return clone
+}
+
+// deliver queues msg for this participant, subject to visibility
+func (p *participant) deliver(msg *ChatMessage) error {
+	if visible := p.view(msg); visible != nil {
+		return p.stream.send(visible)
+	}
+	return nil
+}
+
+// sessionParties fans a session's messages out to everyone connected
+type sessionParties struct {
+	sessionID string
+
+	mu       sync.RWMutex
+	resident *participant
+	members  map[string]*participant // keyed by user ID
+
+	ended     chan struct{}
+	endedOnce sync.Once
+}
+
+// newSessionParties creates the party list for a resident's session
+func newSessionParties(sessionID string, resident *participant) *sessionParties {
+	return &sessionParties{
+		sessionID: sessionID,
+		resident:  resident,
+		members:   map[string]*participant{resident.UserID: resident},
+		ended:     make(chan struct{}),
+	}
+}
+
+// send delivers msg to every party. Only the resident's delivery error is
+// returned; other parties are disconnected by their own handlers.
+func (sp *sessionParties) send(msg *ChatMessage) error {
+	return sp.sendExcept(msg, "")
+}
+
+// sendExcept delivers msg to every party other than the given user
+func (sp *sessionParties) sendExcept(msg *ChatMessage, userID string) error {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	var residentErr error
+	for id, p := range sp.members {
+		if id == userID {
+			continue
+		}
+		err := p.deliver(msg)
+		if p == sp.resident {
+			residentErr = err
+		}
+	}
+	return residentErr
+}
+
+// discardPartials drops queued partial chunks for every party
+func (sp *sessionParties) discardPartials() {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	for _, p := range sp.members {
+		p.stream.discardPartials()
+	}
+}
+
+// join adds a party and announces it to the session
+func (sp *sessionParties) join(p *participant) {
+	sp.mu.Lock()
+	sp.members[p.UserID] = p
+	sp.mu.Unlock()
+
+	sp.sendExcept(sp.presenceEvent(p, "participant_joined"), p.UserID)
+}
+
+// leave removes a party and announces its departure
+func (sp *sessionParties) leave(p *participant) {
+	sp.mu.Lock()
+	if sp.members[p.UserID] != p {
+		sp.mu.Unlock()
+		return
+	}
+	delete(sp.members, p.UserID)
+	sp.mu.Unlock()
+
+	sp.send(sp.presenceEvent(p, "participant_left"))
+}
+
+// end closes the session for everyone when the resident leaves
+func (sp *sessionParties) end() {
+	sp.endedOnce.Do(func() { close(sp.ended) })
+}
+
+// presenceEvent builds a join or leave event for a party
+func (sp *sessionParties) presenceEvent(p *participant, eventType string) *ChatMessage {
+	return &ChatMessage{
+		SessionId: sp.sessionID,
+		Role:      RoleSystem,
+		Timestamp: timestamppb.Now(),
+		IsFinal:   true,
+		Metadata: map[string]string{
+			"type":             eventType,
+			"participant_id":   p.UserID,
+			"participant_role": string(p.Role),
+			"participant_mode": string(p.Mode),
+		},
+	}
+}
+
+// joinSession connects a clinician or family member to an active session
+func (s *TherapeuticStreamServer) joinSession(
+	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	md metadata.MD,
+	sessionID, userID string,
+	caller *Caller,
+) error {
+	ctx := stream.Context()
+
+	role := caller.Role
+	if role != ParticipantClinician && role != ParticipantFamily {
+		return status.Error(codes.PermissionDenied, "role cannot take part in chat sessions")
+	}
+	if s.access == nil {
+		return status.Error(codes.PermissionDenied, "joining sessions is not enabled")
+	}
+	mode := ParticipantMode(extractMetadata(md, "participant-mode"))
+	switch mode {
+	case "":
+		mode = ModeObserver
+	case ModeObserver, ModeParticipant:
+	default:
+		return status.Error(codes.InvalidArgument, "unknown participant-mode")
+	}
+
+	// Checked before revealing where, or whether, the session is served
+	residentID, err := s.sessionResident(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return status.Error(codes.NotFound, "session not active")
+	}
+	if err != nil {
+		s.logger.Error("failed to look up session resident",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return status.Error(codes.Unavailable, "session unavailable")
+	}
+	if err := s.access.AuthorizeJoin(ctx, caller, residentID); err != nil {
+		s.logger.Warn("session join refused",
+			slog.String("session_id", sessionID),
+			slog.String("user_id", userID),
+			slog.String("role", string(role)),
+			slog.String("error", err.Error()),
+		)
+		return status.Error(codes.PermissionDenied, "not permitted to join this session")
+	}
+
+	stateI, ok := s.sessions.Load(sessionID)
+	if !ok {
+		// Parties are served where the resident is; tell the client where
+		if instanceID, err := s.sessionInstance(ctx, sessionID); err == nil && instanceID != "" {
+			stream.SetTrailer(metadata.Pairs("session-instance", instanceID))
+			return status.Error(codes.FailedPrecondition, "session is served by another instance")
+		}
+		return status.Error(codes.NotFound, "session not active")
+	}
+	state := stateI.(*StreamState)
+	if state.UserID != residentID {
+		// Taken over by another resident since the check
+		return status.Error(codes.PermissionDenied, "not permitted to join this session")
+	}
+
+	p := &participant{
+		UserID:   userID,
+		Role:     role,
+		Mode:     mode,
+		JoinedAt: time.Now(),
+		stream:   newSessionStream(stream, sessionID, sessionID+":"+userID, s.replay, s.flow, s.logger),
+	}
+	state.parties.join(p)
+	defer state.parties.leave(p)
+
+	s.logger.Info("participant joined chat session",
+		slog.String("session_id", sessionID),
+		slog.String("user_id", userID),
+		slog.String("role", string(role)),
+		slog.String("mode", string(mode)),
+	)
+
+	return s.serveParticipant(ctx, md, p, state, func() error {
+		return s.relayParticipantMessages(ctx, stream, p, state)
+	})
+}
+
+// sessionResident returns the resident a session belongs to, or
+// ErrSessionNotFound if it has never been opened
+func (s *TherapeuticStreamServer) sessionResident(ctx context.Context, sessionID string) (string, error) {
+	if stateI, ok := s.sessions.Load(sessionID); ok {
+		return stateI.(*StreamState).UserID, nil
+	}
+	residentID, err := s.redis.Get(ctx, sessionOwnerKey(sessionID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrSessionNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read session owner: %w", err)
+	}
+	return residentID, nil
+}
+
+// relayParticipantMessages forwards what a joined party says to the rest
+// of the session. Observers are read-only.
+func (s *TherapeuticStreamServer) relayParticipantMessages(
+	ctx context.Context,
+	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	p *participant,
+	state *StreamState,
+) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		p.heard()
+		if msg.Metadata["type"] == controlHeartbeat {
+			continue
+		}
+
+		if msg.Metadata["type"] == controlTyping {
+			if p.Mode == ModeParticipant {
+				state.parties.sendExcept(typingMessage(state.SessionID, p), p.UserID)
+			}
+			continue
+		}
+
+		if p.Mode == ModeObserver {
+			s.logger.Warn("ignoring message from session observer",
+				slog.String("session_id", state.SessionID),
+				slog.String("user_id", p.UserID),
+			)
+			continue
+		}
+
+		if !s.allowMessage(ctx, state, p) {
+			continue
+		}
+
+		relayed := &ChatMessage{
+			SessionId: state.SessionID,
+			UserId:    p.UserID,
+			Role:      RoleUser,
+			Content:   msg.Content,
+			Timestamp: timestamppb.Now(),
+			IsFinal:   true,
+			Metadata:  map[string]string{"participant_role": string(p.Role)},
+		}
+		s.recordMessage(ctx, relayed)
+		if err := state.parties.sendExcept(relayed, p.UserID); err != nil {
+			s.logger.Warn("failed to relay participant message",
+				slog.String("session_id", state.SessionID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Rate limit windows and session leases
+const (
+	rateLimitWindow     = time.Minute
+	sessionLeaseTTL     = time.Minute // A crashed instance's sessions free up after this
+	sessionLeaseRenewal = 20 * time.Second
+)
+
+// RateLimitConfig bounds how fast and how widely one user can drive the AI.
+// Counters live in Redis so limits hold across instances. Zero disables a
+// limit.
+type RateLimitConfig struct {
+	UserMessagesPerMinute    int // Across all of a user's sessions
+	SessionMessagesPerMinute int
+	MaxSessionsPerUser       int // Concurrent chat sessions
+}
+
+// DefaultRateLimitConfig returns default rate limit configuration
+func DefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		UserMessagesPerMinute:    30,
+		SessionMessagesPerMinute: 20,
+		MaxSessionsPerUser:       3,
+	}
+}
+
+// SetRateLimits replaces the chat rate limits. It must be called before the
+// server starts accepting streams.
+func (s *TherapeuticStreamServer) SetRateLimits(config *RateLimitConfig) {
+	s.rateLimits = config
+}
+
+// rateKey returns the message counter for a scope in the current window
+func rateKey(scope, id string, window int64) string {
+	return fmt.Sprintf("ratelimit:chat:%s:%s:%d", scope, id, window)
+}
+
+// sessionLeaseKey returns the sorted set of a user's live sessions, scored
+// by lease expiry
+func sessionLeaseKey(userID string) string {
+	return fmt.Sprintf("ratelimit:chat:user:%s:sessions", userID)
+}
+
+// checkMessageRate counts a message against the user and session limits.
+// When it is over a limit, notify is set for the first rejected message of
+// the window only, so a flood produces a single notice.
+func (s *TherapeuticStreamServer) checkMessageRate(
+	ctx context.Context,
+	sessionID, userID string,
+) (allowed, notify bool, retryAfter time.Duration, err error) {
+	limits := s.rateLimits
+	if limits.UserMessagesPerMinute <= 0 && limits.SessionMessagesPerMinute <= 0 {
+		return true, false, 0, nil
+	}
+
+	now := time.Now()
+	window := now.Unix() / int64(rateLimitWindow.Seconds())
+	retryAfter = time.Unix((window+1)*int64(rateLimitWindow.Seconds()), 0).Sub(now)
+
+	userKey := rateKey("user", userID, window)
+	sessionKey := rateKey("session", sessionID, window)
+
+	var userCount, sessionCount *redis.IntCmd
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		userCount = pipe.Incr(ctx, userKey)
+		pipe.Expire(ctx, userKey, 2*rateLimitWindow)
+		sessionCount = pipe.Incr(ctx, sessionKey)
+		pipe.Expire(ctx, sessionKey, 2*rateLimitWindow)
+		return nil
+	})
+	if err != nil {
+		return false, false, 0, fmt.Errorf("failed to count message: %w", err)
+	}
+
+	over := func(count *redis.IntCmd, limit int) (exceeded, first bool) {
+		if limit <= 0 {
+			return false, false
+		}
+		return count.Val() > int64(limit), count.Val() == int64(limit)+1
+	}
+	userOver, userFirst := over(userCount, limits.UserMessagesPerMinute)
+	sessionOver, sessionFirst := over(sessionCount, limits.SessionMessagesPerMinute)
+
+	if !userOver && !sessionOver {
+		return true, false, 0, nil
+	}
+	return false, userFirst || sessionFirst, retryAfter, nil
+}
+
+// allowMessage applies message rate limits to a party, telling them to slow
+// down rather than ending the stream. Limits are lifted in crisis mode so a
+// resident in distress is never held back, and a Redis failure lets the
+// message through.
+func (s *TherapeuticStreamServer) allowMessage(ctx context.Context, state *StreamState, p *participant) bool {
+	if state.inCrisisMode() {
+		return true
+	}
+
+	allowed, notify, retryAfter, err := s.checkMessageRate(ctx, state.SessionID, p.UserID)
+	if err != nil {
+		s.logger.Warn("message rate limit unavailable",
+			slog.String("session_id", state.SessionID),
+			slog.String("error", err.Error()),
+		)
+		return true
+	}
+	if allowed {
+		return true
+	}
+
+	s.logger.Warn("chat message rate limited",
+		slog.String("session_id", state.SessionID),
+		slog.String("user_id", p.UserID),
+	)
+	if notify {
+		p.deliver(slowDownMessage(state.SessionID, retryAfter))
+	}
+	return false
+}
+
+// slowDownMessage asks a party to wait before sending more
+func slowDownMessage(sessionID string, retryAfter time.Duration) *ChatMessage {
+	return &ChatMessage{
+		SessionId: sessionID,
+		Role:      RoleSystem,
+		Content:   "You're sending messages faster than I can keep up with. Please slow down and I'll be right with you.",
+		Timestamp: timestamppb.Now(),
+		IsFinal:   true,
+		Metadata: map[string]string{
+			"type":                "rate_limited",
+			"retry_after_seconds": strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())),
+		},
+	}
+}
+
+// acquireSessionSlot registers a resident's session against their
+// concurrent session limit. Reconnecting to a session already held doesn't
+// take another slot. The returned release must be called when the session
+// ends; the lease is renewed until then.
+func (s *TherapeuticStreamServer) acquireSessionSlot(
+	ctx context.Context,
+	stream grpc.BidiStreamingServer[ChatMessage, ChatMessage],
+	sessionID, userID string,
+) (func(), error) {
+	limit := s.rateLimits.MaxSessionsPerUser
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	key := sessionLeaseKey(userID)
+	lease := func(ctx context.Context) (*redis.IntCmd, error) {
+		now := time.Now()
+		var count *redis.IntCmd
+		_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+			pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Add(sessionLeaseTTL).UnixMilli()), Member: sessionID})
+			pipe.Expire(ctx, key, sessionLeaseTTL)
+			count = pipe.ZCard(ctx, key)
+			return nil
+		})
+		return count, err
+	}
+
+	count, err := lease(ctx)
+	if err != nil {
+		s.logger.Warn("session limit unavailable",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return func() {}, nil
+	}
+	if count.Val() > int64(limit) {
+		s.redis.ZRem(ctx, key, sessionID)
+		s.logger.Warn("concurrent chat session limit reached",
+			slog.String("session_id", sessionID),
+			slog.String("user_id", userID),
+			slog.Int("limit", limit),
+		)
+		stream.Send(&ChatMessage{
+			SessionId: sessionID,
+			Role:      RoleSystem,
+			Content:   "You already have the maximum number of conversations open. Please close one and try again.",
+			Timestamp: timestamppb.Now(),
+			IsFinal:   true,
+			Metadata: map[string]string{
+				"type":  "session_limit",
+				"limit": strconv.Itoa(limit),
+			},
+		})
+		return nil, status.Error(codes.ResourceExhausted, "too many concurrent chat sessions")
+	}
+
+	renewCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(sessionLeaseRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				if _, err := lease(renewCtx); err != nil && renewCtx.Err() == nil {
+					s.logger.Warn("failed to renew session lease",
+						slog.String("session_id", sessionID),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		s.redis.ZRem(context.WithoutCancel(ctx), key, sessionID)
+	}, nil
+}
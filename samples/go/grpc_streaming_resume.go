@@ -0,0 +1,135 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Replay log retention. Resume covers dropped connections, not long-term
+// history, so messages are kept briefly.
+const (
+	replayRetention = 200
+	replayTTL       = time.Hour
+)
+
+// lastReceivedIndexKey is the metadata key a reconnecting client uses to
+// report the last sequence number it received
+const lastReceivedIndexKey = "last-received-index"
+
+// replayLog persists outbound chat messages with sequence numbers so a
+// reconnecting client can receive what it missed. Each connected party to a
+// session has its own log, identified by a replay ID.
+type replayLog struct {
+	redis *redis.Client
+}
+
+// seqKey returns the key holding a log's last assigned sequence number
+func (l *replayLog) seqKey(replayID string) string {
+	return fmt.Sprintf("session:%s:seq", replayID)
+}
+
+// logKey returns the key holding a log's recent outbound messages
+func (l *replayLog) logKey(replayID string) string {
+	return fmt.Sprintf("session:%s:outbound", replayID)
+}
+
+// append assigns the next sequence number to msg and records it
+func (l *replayLog) append(ctx context.Context, replayID string, msg *ChatMessage) error {
+	seq, err := l.redis.Incr(ctx, l.seqKey(replayID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to assign sequence: %w", err)
+	}
+	msg.Sequence = seq
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	logKey := l.logKey(replayID)
+	_, err = l.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, logKey, data)
+		pipe.LTrim(ctx, logKey, -replayRetention, -1)
+		pipe.Expire(ctx, logKey, replayTTL)
+		pipe.Expire(ctx, l.seqKey(replayID), replayTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record message: %w", err)
+	}
+	return nil
+}
+
+// since returns retained messages after the given sequence number, and
+// whether older missed messages had already been trimmed
+func (l *replayLog) since(ctx context.Context, replayID string, last int64) ([]*ChatMessage, bool, error) {
+	raw, err := l.redis.LRange(ctx, l.logKey(replayID), 0, -1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load replay log: %w", err)
+	}
+
+	missed := make([]*ChatMessage, 0, len(raw))
+	for _, item := range raw {
+		msg := &ChatMessage{}
+		if err := redisJSON.Unmarshal([]byte(item), msg); err != nil {
+			continue
+		}
+		if msg.Sequence > last {
+			missed = append(missed, msg)
+		}
+	}
+
+	truncated := len(missed) > 0 && missed[0].Sequence > last+1
+	return missed, truncated, nil
+}
+
+// resume replays messages the client missed. It must complete before run
+// starts writing live messages.
+func (ss *sessionStream) resume(ctx context.Context, last int64) error {
+	missed, truncated, err := ss.replay.since(ctx, ss.replayID, last)
+	if err != nil {
+		return err
+	}
+
+	if truncated {
+		ss.logger.Warn("replay log no longer holds every missed message",
+			slog.String("session_id", ss.sessionID),
+			slog.Int64("last_received", last),
+			slog.Int64("oldest_available", missed[0].Sequence),
+		)
+	}
+
+	for _, msg := range missed {
+		if err := ss.stream.Send(msg); err != nil {
+			return fmt.Errorf("failed to replay message: %w", err)
+		}
+	}
+
+	ss.logger.Info("chat stream resumed",
+		slog.String("session_id", ss.sessionID),
+		slog.Int64("last_received", last),
+		slog.Int("replayed", len(missed)),
+	)
+	return nil
+}
+
+// lastReceivedIndex returns the sequence number a reconnecting client last
+// received, or false for a fresh connection
+func lastReceivedIndex(md metadata.MD) (int64, bool) {
+	value := extractMetadata(md, lastReceivedIndexKey)
+	if value == "" {
+		return 0, false
+	}
+	last, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || last < 0 {
+		return 0, false
+	}
+	return last, true
+}
@@ -0,0 +1,423 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Routing stages, in order of precedence
+const (
+	routeCrisisMode = "crisis_mode" // Always the crisis agent; nothing overrides it
+	routePin        = "pin"         // A clinician pinned an agent for the resident
+	routeHook       = "hook"        // Registered override hooks
+	routeRule       = "rule"        // The facility's routing rules
+	routeClassifier = "classifier"  // The intent classifier's choice
+)
+
+// Metadata recording how a response's agent was chosen
+const (
+	metaRoutingSource = "routing_source"
+	metaRoutingTrace  = "routing_trace"
+)
+
+// ErrInvalidRoutingRule is returned when a routing rule fails validation
+var ErrInvalidRoutingRule = errors.New("invalid routing rule")
+
+// HourRange is a window of local hours, [Start, End). A window that ends
+// before it starts runs past midnight, e.g. 22 to 6.
+type HourRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// contains reports whether an hour falls in the window
+func (h *HourRange) contains(hour int) bool {
+	if h.Start <= h.End {
+		return hour >= h.Start && hour < h.End
+	}
+	return hour >= h.Start || hour < h.End
+}
+
+// RoutingRule sends matching messages to an agent. Every condition set must
+// hold; unset conditions match anything.
+type RoutingRule struct {
+	Name      string     `json:"name"`
+	AgentType string     `json:"agent_type"`
+	Intents   []string   `json:"intents,omitempty"` // Agent types chosen by the classifier
+	Hours     *HourRange `json:"hours,omitempty"`   // In the facility's time zone
+	Goals     []string   `json:"goals,omitempty"`   // Any active care plan goal
+}
+
+// Validate checks a rule for consistency
+func (r *RoutingRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name required", ErrInvalidRoutingRule)
+	}
+	if r.AgentType == "" {
+		return fmt.Errorf("%w: agent type required", ErrInvalidRoutingRule)
+	}
+	if r.AgentType == crisisAgentType {
+		return fmt.Errorf("%w: the crisis agent is reserved for crisis mode", ErrInvalidRoutingRule)
+	}
+	if h := r.Hours; h != nil && (h.Start < 0 || h.Start > 23 || h.End < 0 || h.End > 24 || h.Start == h.End) {
+		return fmt.Errorf("%w: hours must be a non-empty range within 0-24", ErrInvalidRoutingRule)
+	}
+	return nil
+}
+
+// FacilityRouting is a facility's routing rules, tried in order until one
+// matches
+type FacilityRouting struct {
+	Timezone string         `json:"timezone"` // IANA name; UTC if empty
+	Rules    []*RoutingRule `json:"rules"`
+}
+
+// Validate checks a facility's rules
+func (f *FacilityRouting) Validate() error {
+	if _, err := time.LoadLocation(f.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidRoutingRule, f.Timezone)
+	}
+	seen := make(map[string]bool, len(f.Rules))
+	for _, rule := range f.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("%w: duplicate rule %q", ErrInvalidRoutingRule, rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return nil
+}
+
+// AgentPin keeps a resident with one agent until removed or expired
+type AgentPin struct {
+	AgentType string    `json:"agent_type"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+// CarePlanSource provides a resident's active care plan goals
+type CarePlanSource interface {
+	ActiveGoals(ctx context.Context, userID string) ([]string, error)
+}
+
+// RoutingInput is what routing decisions are made from
+type RoutingInput struct {
+	SessionID  string
+	UserID     string
+	FacilityID string
+	Message    string // English text
+	Intent     *IntentResult
+}
+
+// RoutingHook may override the agent for a message. It returns false to
+// leave the decision to later stages.
+type RoutingHook func(ctx context.Context, in *RoutingInput) (agentType string, ok bool)
+
+// namedHook is a registered hook
+type namedHook struct {
+	name string
+	hook RoutingHook
+}
+
+// RoutingStep records one stage of a routing decision
+type RoutingStep struct {
+	Stage     string `json:"stage"`
+	Name      string `json:"name,omitempty"`
+	Matched   bool   `json:"matched"`
+	AgentType string `json:"agent_type,omitempty"`
+	Detail    string `json:"detail,omitempty"` // Why a rule didn't match
+}
+
+// routingDecision is the agent chosen for a message and how
+type routingDecision struct {
+	AgentType string
+	Source    string
+	Trace     []RoutingStep
+}
+
+// decide records the matching step and settles the decision
+func (d *routingDecision) decide(step RoutingStep) {
+	step.Matched = true
+	d.Trace = append(d.Trace, step)
+	d.AgentType = step.AgentType
+	d.Source = step.Stage
+	if step.Name != "" {
+		d.Source += ":" + step.Name
+	}
+}
+
+// metadata returns the decision as message metadata
+func (d *routingDecision) metadata() map[string]string {
+	trace, _ := json.Marshal(d.Trace)
+	return map[string]string{
+		metaRoutingSource: d.Source,
+		metaRoutingTrace:  string(trace),
+	}
+}
+
+// RoutingEngine applies clinician pins, override hooks and per-facility
+// rules on top of intent classification
+type RoutingEngine struct {
+	redis     *redis.Client
+	carePlans CarePlanSource // Optional; goal conditions never match without it
+	logger    *slog.Logger
+	hooks     []namedHook
+	now       func() time.Time
+}
+
+// NewRoutingEngine creates a routing engine
+func NewRoutingEngine(redis *redis.Client, carePlans CarePlanSource, logger *slog.Logger) *RoutingEngine {
+	return &RoutingEngine{
+		redis:     redis,
+		carePlans: carePlans,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// AddHook registers an override hook, consulted in registration order after
+// pins and before facility rules. It must be called before the server
+// starts accepting streams.
+func (e *RoutingEngine) AddHook(name string, hook RoutingHook) {
+	e.hooks = append(e.hooks, namedHook{name: name, hook: hook})
+}
+
+// SetRoutingEngine enables routing overrides. Without one the classifier's
+// choice stands outside crisis mode. It must be called before the server
+// starts accepting streams.
+func (s *TherapeuticStreamServer) SetRoutingEngine(engine *RoutingEngine) {
+	s.routing = engine
+}
+
+// facilityRoutingKey holds a facility's routing rules
+func facilityRoutingKey(facilityID string) string {
+	return fmt.Sprintf("routing:facility:%s", facilityID)
+}
+
+// agentPinKey holds a resident's pinned agent
+func agentPinKey(userID string) string {
+	return fmt.Sprintf("routing:pin:user:%s", userID)
+}
+
+// SetFacilityRouting replaces a facility's routing rules
+func (e *RoutingEngine) SetFacilityRouting(ctx context.Context, facilityID string, routing *FacilityRouting) error {
+	if err := routing.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(routing)
+	if err != nil {
+		return fmt.Errorf("failed to marshal routing rules: %w", err)
+	}
+	if err := e.redis.Set(ctx, facilityRoutingKey(facilityID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store routing rules: %w", err)
+	}
+	return nil
+}
+
+// facilityRouting loads a facility's rules; nil if it has none
+func (e *RoutingEngine) facilityRouting(ctx context.Context, facilityID string) (*FacilityRouting, error) {
+	data, err := e.redis.Get(ctx, facilityRoutingKey(facilityID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing rules: %w", err)
+	}
+	routing := &FacilityRouting{}
+	if err := json.Unmarshal(data, routing); err != nil {
+		return nil, fmt.Errorf("failed to decode routing rules: %w", err)
+	}
+	return routing, nil
+}
+
+// PinAgent keeps a resident with an agent. A zero ttl pins until removed.
+func (e *RoutingEngine) PinAgent(ctx context.Context, userID, agentType, clinicianID string, ttl time.Duration) error {
+	if agentType == "" || agentType == crisisAgentType {
+		return fmt.Errorf("%w: cannot pin agent %q", ErrInvalidRoutingRule, agentType)
+	}
+	data, err := json.Marshal(&AgentPin{
+		AgentType: agentType,
+		PinnedBy:  clinicianID,
+		PinnedAt:  e.now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pin: %w", err)
+	}
+	if err := e.redis.Set(ctx, agentPinKey(userID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to pin agent: %w", err)
+	}
+
+	e.logger.Info("agent pinned",
+		slog.String("user_id", userID),
+		slog.String("agent_type", agentType),
+		slog.String("clinician_id", clinicianID),
+	)
+	return nil
+}
+
+// UnpinAgent returns a resident to normal routing
+func (e *RoutingEngine) UnpinAgent(ctx context.Context, userID string) error {
+	if err := e.redis.Del(ctx, agentPinKey(userID)).Err(); err != nil {
+		return fmt.Errorf("failed to unpin agent: %w", err)
+	}
+	return nil
+}
+
+// pinnedAgent loads a resident's pin; nil if there is none
+func (e *RoutingEngine) pinnedAgent(ctx context.Context, userID string) (*AgentPin, error) {
+	data, err := e.redis.Get(ctx, agentPinKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pin: %w", err)
+	}
+	pin := &AgentPin{}
+	if err := json.Unmarshal(data, pin); err != nil {
+		return nil, fmt.Errorf("failed to decode pin: %w", err)
+	}
+	return pin, nil
+}
+
+// route runs pins, hooks and facility rules. It reports false if none of
+// them chose an agent. Lookup failures are traced and skipped so routing
+// degrades to the classifier rather than failing the message.
+func (e *RoutingEngine) route(ctx context.Context, in *RoutingInput, d *routingDecision) bool {
+	pin, err := e.pinnedAgent(ctx, in.UserID)
+	switch {
+	case err != nil:
+		d.Trace = append(d.Trace, RoutingStep{Stage: routePin, Detail: err.Error()})
+	case pin != nil:
+		d.decide(RoutingStep{Stage: routePin, Name: pin.PinnedBy, AgentType: pin.AgentType})
+		return true
+	}
+
+	for _, h := range e.hooks {
+		if agentType, ok := h.hook(ctx, in); ok && agentType != "" && agentType != crisisAgentType {
+			d.decide(RoutingStep{Stage: routeHook, Name: h.name, AgentType: agentType})
+			return true
+		}
+		d.Trace = append(d.Trace, RoutingStep{Stage: routeHook, Name: h.name})
+	}
+
+	routing, err := e.facilityRouting(ctx, in.FacilityID)
+	if err != nil {
+		d.Trace = append(d.Trace, RoutingStep{Stage: routeRule, Detail: err.Error()})
+		return false
+	}
+	if routing == nil {
+		return false
+	}
+	loc, err := time.LoadLocation(routing.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	hour := e.now().In(loc).Hour()
+
+	// Goals are loaded once, and only if a rule needs them
+	var goals map[string]bool
+	for _, rule := range routing.Rules {
+		if len(rule.Goals) > 0 && goals == nil {
+			goals = e.activeGoals(ctx, in.UserID)
+		}
+		if reason := rule.mismatch(in.Intent.AgentType, hour, goals); reason != "" {
+			d.Trace = append(d.Trace, RoutingStep{Stage: routeRule, Name: rule.Name, Detail: reason})
+			continue
+		}
+		d.decide(RoutingStep{Stage: routeRule, Name: rule.Name, AgentType: rule.AgentType})
+		return true
+	}
+	return false
+}
+
+// mismatch returns why a rule doesn't apply, or "" if it does
+func (r *RoutingRule) mismatch(intent string, hour int, goals map[string]bool) string {
+	if len(r.Intents) > 0 && !containsString(r.Intents, intent) {
+		return fmt.Sprintf("intent %s not in %s", intent, strings.Join(r.Intents, ","))
+	}
+	if r.Hours != nil && !r.Hours.contains(hour) {
+		return fmt.Sprintf("hour %d outside %d-%d", hour, r.Hours.Start, r.Hours.End)
+	}
+	if len(r.Goals) > 0 {
+		for _, goal := range r.Goals {
+			if goals[goal] {
+				return ""
+			}
+		}
+		return "no matching care plan goal"
+	}
+	return ""
+}
+
+// activeGoals loads a resident's care plan goals as a set
+func (e *RoutingEngine) activeGoals(ctx context.Context, userID string) map[string]bool {
+	goals := make(map[string]bool)
+	if e.carePlans == nil {
+		return goals
+	}
+	list, err := e.carePlans.ActiveGoals(ctx, userID)
+	if err != nil {
+		e.logger.Warn("failed to load care plan goals",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+		return goals
+	}
+	for _, goal := range list {
+		goals[goal] = true
+	}
+	return goals
+}
+
+// containsString reports whether values holds value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// routeAgent chooses the agent for a message. Crisis mode always wins;
+// then clinician pins, hooks and facility rules; then the classifier.
+func (s *TherapeuticStreamServer) routeAgent(ctx context.Context, state *StreamState, message string, intent *IntentResult) *routingDecision {
+	d := &routingDecision{}
+	if state.inCrisisMode() {
+		d.decide(RoutingStep{Stage: routeCrisisMode, AgentType: crisisAgentType})
+		return d
+	}
+
+	if s.routing != nil {
+		in := &RoutingInput{
+			SessionID:  state.SessionID,
+			UserID:     state.UserID,
+			FacilityID: state.FacilityID,
+			Message:    message,
+			Intent:     intent,
+		}
+		if s.routing.route(ctx, in, d) {
+			if d.AgentType != intent.AgentType {
+				s.logger.Info("agent overridden by routing",
+					slog.String("session_id", state.SessionID),
+					slog.String("classified", intent.AgentType),
+					slog.String("agent", d.AgentType),
+					slog.String("source", d.Source),
+				)
+			}
+			return d
+		}
+	}
+
+	d.decide(RoutingStep{Stage: routeClassifier, Name: intent.Intent, AgentType: intent.AgentType})
+	return d
+}
@@ -0,0 +1,268 @@
+package streaming
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Session summary limits
+const (
+	summaryTranscriptSize = 200              // Latest messages summarized for a chat session
+	summaryTimeout        = 45 * time.Second // Dashboards expect a note within a minute
+)
+
+// Session channels
+const (
+	channelChat  = "chat"
+	channelVoice = "voice"
+)
+
+// SummaryRequest asks the AI router to summarize a session
+type SummaryRequest struct {
+	SessionID  string
+	UserID     string
+	Transcript []*ChatMessage
+}
+
+// SummaryResult is the AI router's reading of a session
+type SummaryResult struct {
+	Summary        string
+	Topics         []string
+	MoodIndicators []string
+}
+
+// SessionSummary is the clinical note written when a session ends. Crisis
+// flags and agent types come from the recorded conversation, not the model.
+type SessionSummary struct {
+	SessionID      string    `json:"session_id"`
+	UserID         string    `json:"user_id"`
+	FacilityID     string    `json:"facility_id"`
+	Channel        string    `json:"channel"`
+	StartedAt      time.Time `json:"started_at"`
+	EndedAt        time.Time `json:"ended_at"`
+	MessageCount   int       `json:"message_count"`
+	Summary        string    `json:"summary"`
+	Topics         []string  `json:"topics"`
+	MoodIndicators []string  `json:"mood_indicators"`
+	CrisisFlags    []string  `json:"crisis_flags"`
+	AgentTypes     []string  `json:"agent_types"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+// SummaryStore persists session summaries
+type SummaryStore interface {
+	// SaveSummary stores a summary, replacing any earlier one for the
+	// session, e.g. from before a reconnect
+	SaveSummary(ctx context.Context, summary *SessionSummary) error
+}
+
+// PostgresSummaryStore keeps summaries in Postgres. Expected schema:
+//
+//	CREATE TABLE session_summaries (
+//	    session_id   TEXT PRIMARY KEY,
+//	    user_id      TEXT NOT NULL,
+//	    facility_id  TEXT NOT NULL,
+//	    ended_at     TIMESTAMPTZ NOT NULL,
+//	    summary      JSONB NOT NULL
+//	);
+//	CREATE INDEX session_summaries_user ON session_summaries (user_id, ended_at);
+type PostgresSummaryStore struct {
+	db *sql.DB
+}
+
+// NewPostgresSummaryStore creates a summary store
+func NewPostgresSummaryStore(db *sql.DB) *PostgresSummaryStore {
+	return &PostgresSummaryStore{db: db}
+}
+
+// SaveSummary upserts a session's summary
+func (p *PostgresSummaryStore) SaveSummary(ctx context.Context, summary *SessionSummary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary: %w", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO session_summaries (session_id, user_id, facility_id, ended_at, summary)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (session_id) DO UPDATE
+		SET ended_at = EXCLUDED.ended_at, summary = EXCLUDED.summary`,
+		summary.SessionID, summary.UserID, summary.FacilityID, summary.EndedAt, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store summary: %w", err)
+	}
+	return nil
+}
+
+// SessionSummarizer writes a clinical note when a session ends and
+// announces it to care dashboards
+type SessionSummarizer struct {
+	aiRouter AIRouterClient
+	store    SummaryStore
+	redis    *redis.Client
+	logger   *slog.Logger
+}
+
+// NewSessionSummarizer creates a session summarizer
+func NewSessionSummarizer(aiRouter AIRouterClient, store SummaryStore, redis *redis.Client, logger *slog.Logger) *SessionSummarizer {
+	return &SessionSummarizer{
+		aiRouter: aiRouter,
+		store:    store,
+		redis:    redis,
+		logger:   logger,
+	}
+}
+
+// summaryChannel returns the channel a facility's dashboards receive
+// summaries on
+func summaryChannel(facilityID string) string {
+	return fmt.Sprintf("summaries:facility:%s", facilityID)
+}
+
+// sessionEnded summarizes a session in the background so the stream
+// handler can return. A nil summarizer does nothing.
+func (m *SessionSummarizer) sessionEnded(
+	ctx context.Context,
+	summary *SessionSummary,
+	transcript func(ctx context.Context) ([]*ChatMessage, error),
+) {
+	if m == nil {
+		return
+	}
+	summary.EndedAt = time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), summaryTimeout)
+		defer cancel()
+
+		if err := m.summarize(ctx, summary, transcript); err != nil {
+			m.logger.Error("failed to summarize session",
+				slog.String("session_id", summary.SessionID),
+				slog.String("channel", summary.Channel),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+}
+
+// summarize generates, stores and publishes a session's summary
+func (m *SessionSummarizer) summarize(
+	ctx context.Context,
+	summary *SessionSummary,
+	transcript func(ctx context.Context) ([]*ChatMessage, error),
+) error {
+	all, err := transcript(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load transcript: %w", err)
+	}
+
+	messages := make([]*ChatMessage, 0, len(all))
+	spoke := false
+	for _, msg := range all {
+		if !conversational(msg) {
+			continue
+		}
+		messages = append(messages, msg)
+		spoke = spoke || msg.Role == RoleUser
+
+		if msg.CrisisLevel != "" {
+			summary.CrisisFlags = appendUnique(summary.CrisisFlags, msg.CrisisLevel)
+		}
+		if msg.AgentType != "" {
+			summary.AgentTypes = appendUnique(summary.AgentTypes, msg.AgentType)
+		}
+	}
+	if !spoke {
+		// Nothing was said; there is nothing to note
+		return nil
+	}
+	summary.MessageCount = len(messages)
+
+	result, err := m.aiRouter.SummarizeSession(ctx, &SummaryRequest{
+		SessionID:  summary.SessionID,
+		UserID:     summary.UserID,
+		Transcript: messages,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate summary: %w", err)
+	}
+	summary.Summary = result.Summary
+	summary.Topics = result.Topics
+	summary.MoodIndicators = result.MoodIndicators
+	summary.GeneratedAt = time.Now()
+
+	if err := m.store.SaveSummary(ctx, summary); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary: %w", err)
+	}
+	if err := m.redis.Publish(ctx, summaryChannel(summary.FacilityID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish summary: %w", err)
+	}
+
+	m.logger.Info("session summarized",
+		slog.String("session_id", summary.SessionID),
+		slog.String("channel", summary.Channel),
+		slog.Int("messages", summary.MessageCount),
+		slog.Int("crisis_flags", len(summary.CrisisFlags)),
+	)
+	return nil
+}
+
+// appendUnique appends value unless it is already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// summarizeChat queues a summary of a chat session from its stored
+// history. Chat summaries need a message store.
+func (s *TherapeuticStreamServer) summarizeChat(ctx context.Context, state *StreamState) {
+	if s.history == nil {
+		return
+	}
+	s.summarizer.sessionEnded(ctx, &SessionSummary{
+		SessionID:  state.SessionID,
+		UserID:     state.UserID,
+		FacilityID: state.FacilityID,
+		Channel:    channelChat,
+		StartedAt:  state.StartedAt,
+	}, func(ctx context.Context) ([]*ChatMessage, error) {
+		return s.history.Recent(ctx, state.SessionID, summaryTranscriptSize)
+	})
+}
+
+// voiceTranscript collects a voice session's turns for its summary
+type voiceTranscript struct {
+	mu       sync.Mutex
+	messages []*ChatMessage
+}
+
+// add records a turn
+func (t *voiceTranscript) add(msg *ChatMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, msg)
+}
+
+// snapshot returns the turns so far
+func (t *voiceTranscript) snapshot(context.Context) ([]*ChatMessage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*ChatMessage(nil), t.messages...), nil
+}
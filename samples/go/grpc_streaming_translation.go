@@ -0,0 +1,173 @@
+package streaming
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// pivotLanguage is the language crisis analysis, intent classification and
+// generation work in
+const pivotLanguage = "en"
+
+// Translation parameters
+const (
+	languageConfidence = 0.8             // Below this a message keeps the session's language
+	noticeTranslateTTL = 3 * time.Second // Safety notices fall back to English after this
+)
+
+// Metadata recorded on translated messages. The message content is always
+// what the resident wrote or was shown.
+const (
+	metaLanguage    = "language"
+	metaEnglishText = "english_text"
+)
+
+// Translator detects and translates languages for residents who don't
+// write in English
+type Translator interface {
+	// DetectLanguage returns a BCP 47 tag and a confidence from 0 to 1
+	DetectLanguage(ctx context.Context, text string) (string, float64, error)
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// SetTranslator enables translation of resident messages and responses. It
+// must be called before the server starts accepting streams.
+func (s *TherapeuticStreamServer) SetTranslator(translator Translator) {
+	s.translator = translator
+}
+
+// translation is a resident message's language and its English text
+type translation struct {
+	language string // Empty when the message needs no translation
+	english  string
+}
+
+// isPivotLanguage reports whether a language tag is English
+func isPivotLanguage(tag string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	return base == "" || base == pivotLanguage
+}
+
+// residentLanguage returns the language the resident last wrote in
+func (st *StreamState) residentLanguage() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Language
+}
+
+// setResidentLanguage records the language the resident is writing in
+func (st *StreamState) setResidentLanguage(language string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Language = language
+}
+
+// translateInbound detects a resident message's language and translates it
+// to English. Short or ambiguous messages keep the session's language. A
+// failed translation passes the original text on rather than blocking
+// crisis analysis.
+func (s *TherapeuticStreamServer) translateInbound(ctx context.Context, state *StreamState, content string) translation {
+	if s.translator == nil || strings.TrimSpace(content) == "" {
+		return translation{english: content}
+	}
+
+	language := state.residentLanguage()
+	detected, confidence, err := s.translator.DetectLanguage(ctx, content)
+	if err != nil {
+		s.logger.Warn("language detection failed",
+			slog.String("session_id", state.SessionID),
+			slog.String("error", err.Error()),
+		)
+	} else if confidence >= languageConfidence && detected != language {
+		state.setResidentLanguage(detected)
+		language = detected
+	}
+	if isPivotLanguage(language) {
+		return translation{english: content}
+	}
+
+	english, err := s.translator.Translate(ctx, content, language, pivotLanguage)
+	if err != nil {
+		s.logger.Error("failed to translate resident message",
+			slog.String("session_id", state.SessionID),
+			slog.String("language", language),
+			slog.String("error", err.Error()),
+		)
+		english = content
+	}
+	return translation{language: language, english: english}
+}
+
+// translateOutbound translates English text into a resident's language. It
+// reports false if the text should be sent untranslated.
+func (s *TherapeuticStreamServer) translateOutbound(ctx context.Context, sessionID, language, text string) (string, bool) {
+	if s.translator == nil || isPivotLanguage(language) {
+		return text, false
+	}
+	localized, err := s.translator.Translate(ctx, text, pivotLanguage, language)
+	if err != nil {
+		s.logger.Error("failed to translate response",
+			slog.String("session_id", sessionID),
+			slog.String("language", language),
+			slog.String("error", err.Error()),
+		)
+		return text, false
+	}
+	return localized, true
+}
+
+// localizeNotice translates a system notice into the resident's language.
+// Safety notices can't wait on a slow translator, so they go out in English
+// if translation takes too long.
+func (s *TherapeuticStreamServer) localizeNotice(ctx context.Context, state *StreamState, msg *ChatMessage) {
+	language := state.residentLanguage()
+	if s.translator == nil || isPivotLanguage(language) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), noticeTranslateTTL)
+	defer cancel()
+
+	if localized, ok := s.translateOutbound(ctx, state.SessionID, language, msg.Content); ok {
+		annotateTranslation(msg, language, msg.Content)
+		msg.Content = localized
+	}
+}
+
+// annotateTranslation records a message's language and English text
+func annotateTranslation(msg *ChatMessage, language, english string) {
+	metadata := make(map[string]string, len(msg.Metadata)+2)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata[metaLanguage] = language
+	metadata[metaEnglishText] = english
+	msg.Metadata = metadata
+}
+
+// englishContent returns the English text of a message
+func englishContent(msg *ChatMessage) string {
+	if english, ok := msg.Metadata[metaEnglishText]; ok {
+		return english
+	}
+	return msg.Content
+}
+
+// englishHistory returns history with translated messages in English, for
+// analysis and generation
+func englishHistory(history []*ChatMessage) []*ChatMessage {
+	out := make([]*ChatMessage, len(history))
+	for i, msg := range history {
+		if _, ok := msg.Metadata[metaEnglishText]; !ok {
+			out[i] = msg
+			continue
+		}
+		english := proto.Clone(msg).(*ChatMessage)
+		english.Content = englishContent(msg)
+		out[i] = english
+	}
+	return out
+}
@@ -0,0 +1,307 @@
+package streaming
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Usage counters are kept per session, and per user and facility in daily
+// buckets so quotas and cost reports can cover any date range
+const (
+	usageSessionTTL = 30 * 24 * time.Hour
+	usageBucketTTL  = 400 * 24 * time.Hour
+	usageDayFormat  = "2006-01-02"
+	usageMaxRange   = 366 // days
+	usageRecordTime = 2 * time.Second
+)
+
+// Hash fields of a usage counter
+const (
+	usageFieldTokens   = "tokens"
+	usageFieldMessages = "messages"
+	usageFieldAudioMs  = "audio_ms"
+)
+
+// ErrUsageRangeTooLarge is returned for usage queries spanning more than a year
+var ErrUsageRangeTooLarge = errors.New("usage query range exceeds 366 days")
+
+// Usage is consumption attributed to a session, user or facility
+type Usage struct {
+	Tokens       int64   `json:"tokens"`
+	Messages     int64   `json:"messages"`
+	AudioSeconds float64 `json:"audio_seconds"`
+}
+
+// add accumulates another usage record
+func (u *Usage) add(other Usage) {
+	u.Tokens += other.Tokens
+	u.Messages += other.Messages
+	u.AudioSeconds += other.AudioSeconds
+}
+
+// ConnectionUsage is the usage of one stream connection, reported to the sink
+// when the stream ends. A resumed session reports once per connection.
+type ConnectionUsage struct {
+	SessionID  string
+	UserID     string
+	FacilityID string
+	StartedAt  time.Time
+	EndedAt    time.Time
+	Usage
+}
+
+// UsageSink archives per-connection usage for billing and reporting
+type UsageSink interface {
+	RecordSessionUsage(ctx context.Context, usage *ConnectionUsage) error
+}
+
+// UsageTracker accumulates token, message and audio usage in Redis and
+// answers usage queries. A nil tracker records nothing.
+type UsageTracker struct {
+	redis  *redis.Client
+	sink   UsageSink
+	logger *slog.Logger
+}
+
+// NewUsageTracker creates a usage tracker; sink may be nil
+func NewUsageTracker(redis *redis.Client, sink UsageSink, logger *slog.Logger) *UsageTracker {
+	return &UsageTracker{
+		redis:  redis,
+		sink:   sink,
+		logger: logger,
+	}
+}
+
+// sessionKey returns the counter key for a session
+func (t *UsageTracker) sessionKey(sessionID string) string {
+	return fmt.Sprintf("usage:session:%s", sessionID)
+}
+
+// bucketKey returns the daily counter key for a user or facility
+func (t *UsageTracker) bucketKey(scope, id string, day time.Time) string {
+	return fmt.Sprintf("usage:%s:%s:%s", scope, id, day.UTC().Format(usageDayFormat))
+}
+
+// record adds usage to the session, user and facility counters
+func (t *UsageTracker) record(ctx context.Context, sessionID, userID, facilityID string, delta Usage) error {
+	now := time.Now()
+	buckets := []string{t.bucketKey("user", userID, now)}
+	if facilityID != "" {
+		buckets = append(buckets, t.bucketKey("facility", facilityID, now))
+	}
+
+	audioMs := int64(delta.AudioSeconds * 1000)
+	_, err := t.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr := func(key string, ttl time.Duration) {
+			if delta.Tokens != 0 {
+				pipe.HIncrBy(ctx, key, usageFieldTokens, delta.Tokens)
+			}
+			if delta.Messages != 0 {
+				pipe.HIncrBy(ctx, key, usageFieldMessages, delta.Messages)
+			}
+			if audioMs != 0 {
+				pipe.HIncrBy(ctx, key, usageFieldAudioMs, audioMs)
+			}
+			pipe.Expire(ctx, key, ttl)
+		}
+
+		incr(t.sessionKey(sessionID), usageSessionTTL)
+		for _, key := range buckets {
+			incr(key, usageBucketTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// load reads counters from the given keys and sums them
+func (t *UsageTracker) load(ctx context.Context, keys []string) (*Usage, error) {
+	cmds, err := t.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to load usage: %w", err)
+	}
+
+	total := &Usage{}
+	for _, cmd := range cmds {
+		fields, err := cmd.(*redis.StringStringMapCmd).Result()
+		if err != nil {
+			continue
+		}
+		tokens, _ := strconv.ParseInt(fields[usageFieldTokens], 10, 64)
+		messages, _ := strconv.ParseInt(fields[usageFieldMessages], 10, 64)
+		audioMs, _ := strconv.ParseInt(fields[usageFieldAudioMs], 10, 64)
+		total.add(Usage{
+			Tokens:       tokens,
+			Messages:     messages,
+			AudioSeconds: float64(audioMs) / 1000,
+		})
+	}
+	return total, nil
+}
+
+// SessionUsage returns the usage of a session across all its connections
+func (t *UsageTracker) SessionUsage(ctx context.Context, sessionID string) (*Usage, error) {
+	return t.load(ctx, []string{t.sessionKey(sessionID)})
+}
+
+// UserUsage returns a user's usage over the days from..to inclusive (UTC)
+func (t *UsageTracker) UserUsage(ctx context.Context, userID string, from, to time.Time) (*Usage, error) {
+	return t.rangeUsage(ctx, "user", userID, from, to)
+}
+
+// FacilityUsage returns a facility's usage over the days from..to inclusive
+// (UTC), e.g. to enforce per-facility quotas
+func (t *UsageTracker) FacilityUsage(ctx context.Context, facilityID string, from, to time.Time) (*Usage, error) {
+	return t.rangeUsage(ctx, "facility", facilityID, from, to)
+}
+
+// rangeUsage sums the daily buckets of a user or facility
+func (t *UsageTracker) rangeUsage(ctx context.Context, scope, id string, from, to time.Time) (*Usage, error) {
+	start := from.UTC().Truncate(24 * time.Hour)
+	end := to.UTC().Truncate(24 * time.Hour)
+	if end.Before(start) {
+		return &Usage{}, nil
+	}
+	if end.Sub(start) >= usageMaxRange*24*time.Hour {
+		return nil, ErrUsageRangeTooLarge
+	}
+
+	var keys []string
+	for day := start; !day.After(end); day = day.Add(24 * time.Hour) {
+		keys = append(keys, t.bucketKey(scope, id, day))
+	}
+	return t.load(ctx, keys)
+}
+
+// usageMeter attributes the usage of one stream connection
+type usageMeter struct {
+	tracker    *UsageTracker
+	sessionID  string
+	userID     string
+	facilityID string
+	startedAt  time.Time
+
+	mu    sync.Mutex
+	total Usage
+}
+
+// meter starts metering a stream connection
+func (t *UsageTracker) meter(sessionID, userID, facilityID string) *usageMeter {
+	if t == nil {
+		return nil
+	}
+	return &usageMeter{
+		tracker:    t,
+		sessionID:  sessionID,
+		userID:     userID,
+		facilityID: facilityID,
+		startedAt:  time.Now(),
+	}
+}
+
+// add records usage. It outlives the stream context so usage incurred as a
+// client disconnects is still counted.
+func (m *usageMeter) add(ctx context.Context, delta Usage) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.total.add(delta)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usageRecordTime)
+	defer cancel()
+
+	if err := m.tracker.record(ctx, m.sessionID, m.userID, m.facilityID, delta); err != nil {
+		m.tracker.logger.Warn("usage not recorded",
+			slog.String("session_id", m.sessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// close reports the connection's usage to the sink
+func (m *usageMeter) close(ctx context.Context) {
+	if m == nil || m.tracker.sink == nil {
+		return
+	}
+
+	m.mu.Lock()
+	report := &ConnectionUsage{
+		SessionID:  m.sessionID,
+		UserID:     m.userID,
+		FacilityID: m.facilityID,
+		StartedAt:  m.startedAt,
+		EndedAt:    time.Now(),
+		Usage:      m.total,
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usageRecordTime)
+	defer cancel()
+
+	if err := m.tracker.sink.RecordSessionUsage(ctx, report); err != nil {
+		m.tracker.logger.Error("failed to archive session usage",
+			slog.String("session_id", m.sessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// PostgresUsageSink archives session usage in Postgres. Expected schema:
+//
+//	CREATE TABLE session_usage (
+//	    session_id    TEXT PRIMARY KEY,
+//	    user_id       TEXT NOT NULL,
+//	    facility_id   TEXT NOT NULL DEFAULT '',
+//	    started_at    TIMESTAMPTZ NOT NULL,
+//	    ended_at      TIMESTAMPTZ NOT NULL,
+//	    tokens        BIGINT NOT NULL DEFAULT 0,
+//	    messages      BIGINT NOT NULL DEFAULT 0,
+//	    audio_seconds DOUBLE PRECISION NOT NULL DEFAULT 0
+//	);
+type PostgresUsageSink struct {
+	db *sql.DB
+}
+
+// NewPostgresUsageSink creates a sink writing to the session_usage table
+func NewPostgresUsageSink(db *sql.DB) *PostgresUsageSink {
+	return &PostgresUsageSink{db: db}
+}
+
+// RecordSessionUsage adds a connection's usage to its session's row
+func (p *PostgresUsageSink) RecordSessionUsage(ctx context.Context, usage *ConnectionUsage) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO session_usage
+			(session_id, user_id, facility_id, started_at, ended_at, tokens, messages, audio_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (session_id) DO UPDATE SET
+			ended_at      = EXCLUDED.ended_at,
+			tokens        = session_usage.tokens + EXCLUDED.tokens,
+			messages      = session_usage.messages + EXCLUDED.messages,
+			audio_seconds = session_usage.audio_seconds + EXCLUDED.audio_seconds`,
+		usage.SessionID, usage.UserID, usage.FacilityID, usage.StartedAt, usage.EndedAt,
+		usage.Tokens, usage.Messages, usage.AudioSeconds,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to archive session usage: %w", err)
+	}
+	return nil
+}
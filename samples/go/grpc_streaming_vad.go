@@ -0,0 +1,108 @@
+package streaming
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// bargeInChunks is how many consecutive speech chunks interrupt playback,
+// so a cough or a bump of the microphone doesn't
+const bargeInChunks = 3
+
+// errBargeIn cancels a voice response the resident has talked over
+var errBargeIn = errors.New("resident barged in")
+
+// VoiceActivityDetector reports whether an audio chunk contains speech
+type VoiceActivityDetector interface {
+	IsSpeech(chunk *AudioChunk) bool
+}
+
+// EnergyVAD detects speech in uncompressed 16-bit little-endian PCM by
+// signal energy. Compressed formats are never reported as speech; clients
+// sending opus or webm need a codec-aware detector for barge-in. Clients
+// are expected to apply echo cancellation so playback isn't mistaken for
+// the resident.
+type EnergyVAD struct {
+	Threshold float64 // RMS as a fraction of full scale
+}
+
+// NewEnergyVAD creates an energy detector tuned for close-talking
+// microphones
+func NewEnergyVAD() *EnergyVAD {
+	return &EnergyVAD{Threshold: 0.02}
+}
+
+// IsSpeech reports whether the chunk's energy is above the threshold
+func (v *EnergyVAD) IsSpeech(chunk *AudioChunk) bool {
+	if chunk.Format != "wav" && chunk.Format != "pcm" {
+		return false
+	}
+
+	samples := len(chunk.Data) / 2
+	if samples == 0 {
+		return false
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(chunk.Data[2*i:]))) / math.MaxInt16
+		sum += sample * sample
+	}
+	return math.Sqrt(sum/float64(samples)) >= v.Threshold
+}
+
+// SetVoiceActivityDetector replaces the detector used for barge-in. It must
+// be called before the server starts accepting streams.
+func (s *VoiceStreamServer) SetVoiceActivityDetector(vad VoiceActivityDetector) {
+	s.vad = vad
+}
+
+// bargeIn tracks whether a response is playing and cancels it when the
+// resident starts speaking over it
+type bargeIn struct {
+	vad VoiceActivityDetector
+
+	mu        sync.Mutex
+	speechRun int // Consecutive chunks containing speech
+	cancel    context.CancelCauseFunc
+}
+
+// respond starts a response that speech can interrupt. done must be called
+// once it has finished playing.
+func (b *bargeIn) respond(ctx context.Context) (context.Context, func()) {
+	respCtx, cancel := context.WithCancelCause(ctx)
+
+	b.mu.Lock()
+	b.cancel = cancel
+	b.mu.Unlock()
+
+	return respCtx, func() {
+		b.mu.Lock()
+		b.cancel = nil
+		b.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// observe runs voice activity detection on incoming audio and reports
+// whether it interrupted a response
+func (b *bargeIn) observe(chunk *AudioChunk) bool {
+	speech := b.vad.IsSpeech(chunk)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !speech {
+		b.speechRun = 0
+		return false
+	}
+	b.speechRun++
+	if b.speechRun < bargeInChunks || b.cancel == nil {
+		return false
+	}
+	b.cancel(errBargeIn)
+	b.cancel = nil
+	return true
+}
@@ -0,0 +1,180 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Speaking rate bounds; outside them speech is hard to follow
+const (
+	minSpeakingRate = 0.5
+	maxSpeakingRate = 2.0
+)
+
+// ErrInvalidVoicePreferences is returned for preferences that can't be
+// applied
+var ErrInvalidVoicePreferences = errors.New("invalid voice preferences")
+
+// VoiceProfile is how a resident's responses are spoken
+type VoiceProfile struct {
+	VoiceID         string  `json:"voice_id"`
+	SpeakingRate    float64 `json:"speaking_rate"`
+	Language        string  `json:"language"`
+	NormalizeVolume bool    `json:"normalize_volume"`
+}
+
+// DefaultVoiceProfile returns the profile used until a resident chooses
+// their own
+func DefaultVoiceProfile() *VoiceProfile {
+	return &VoiceProfile{
+		VoiceID:         "therapeutic-warm",
+		SpeakingRate:    1.0,
+		Language:        "en-US",
+		NormalizeVolume: true,
+	}
+}
+
+// apply returns the profile with preferences layered over it
+func (p VoiceProfile) apply(prefs *VoicePreferences) (*VoiceProfile, error) {
+	if prefs.VoiceId != "" {
+		p.VoiceID = prefs.VoiceId
+	}
+	if prefs.SpeakingRate != 0 {
+		rate := float64(prefs.SpeakingRate)
+		if rate < minSpeakingRate || rate > maxSpeakingRate {
+			return nil, fmt.Errorf("%w: speaking rate %.2f outside %.1f-%.1f",
+				ErrInvalidVoicePreferences, rate, minSpeakingRate, maxSpeakingRate)
+		}
+		p.SpeakingRate = rate
+	}
+	if prefs.Language != "" {
+		p.Language = prefs.Language
+	}
+	if prefs.NormalizeVolume != nil {
+		p.NormalizeVolume = *prefs.NormalizeVolume
+	}
+	return &p, nil
+}
+
+// VoiceProfileStore persists residents' voice preferences
+type VoiceProfileStore interface {
+	// Get returns a resident's profile, or nil if they haven't set one
+	Get(ctx context.Context, userID string) (*VoiceProfile, error)
+	Save(ctx context.Context, userID string, profile *VoiceProfile) error
+}
+
+// RedisVoiceProfileStore keeps voice profiles in Redis without expiry
+type RedisVoiceProfileStore struct {
+	redis *redis.Client
+}
+
+// NewRedisVoiceProfileStore creates a voice profile store
+func NewRedisVoiceProfileStore(redis *redis.Client) *RedisVoiceProfileStore {
+	return &RedisVoiceProfileStore{redis: redis}
+}
+
+// profileKey returns the key holding a resident's profile
+func (r *RedisVoiceProfileStore) profileKey(userID string) string {
+	return fmt.Sprintf("voice:profile:%s", userID)
+}
+
+// Get loads a resident's profile
+func (r *RedisVoiceProfileStore) Get(ctx context.Context, userID string) (*VoiceProfile, error) {
+	data, err := r.redis.Get(ctx, r.profileKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load voice profile: %w", err)
+	}
+
+	profile := &VoiceProfile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("failed to decode voice profile: %w", err)
+	}
+	return profile, nil
+}
+
+// Save stores a resident's profile
+func (r *RedisVoiceProfileStore) Save(ctx context.Context, userID string, profile *VoiceProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal voice profile: %w", err)
+	}
+	if err := r.redis.Set(ctx, r.profileKey(userID), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save voice profile: %w", err)
+	}
+	return nil
+}
+
+// voiceSettings is the profile a voice stream is currently speaking with.
+// It is switched by the receive loop and read when a response is
+// synthesized.
+type voiceSettings struct {
+	mu      sync.Mutex
+	profile *VoiceProfile
+}
+
+// current returns the profile to synthesize the next response with
+func (v *voiceSettings) current() *VoiceProfile {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.profile
+}
+
+// resolveVoiceProfile loads a resident's profile at stream start, falling
+// back to the default
+func (s *VoiceStreamServer) resolveVoiceProfile(ctx context.Context, userID string) *voiceSettings {
+	settings := &voiceSettings{profile: DefaultVoiceProfile()}
+	if s.profiles == nil {
+		return settings
+	}
+
+	profile, err := s.profiles.Get(ctx, userID)
+	if err != nil {
+		s.logger.Warn("using default voice profile",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+		return settings
+	}
+	if profile != nil {
+		settings.profile = profile
+	}
+	return settings
+}
+
+// switchVoice applies preferences sent mid-stream, saving them as the
+// resident's default when asked. Invalid preferences are ignored.
+func (s *VoiceStreamServer) switchVoice(ctx context.Context, userID string, voice *voiceSettings, prefs *VoicePreferences) {
+	voice.mu.Lock()
+	profile, err := voice.profile.apply(prefs)
+	if err == nil {
+		voice.profile = profile
+	}
+	voice.mu.Unlock()
+
+	if err != nil {
+		s.logger.Warn("ignoring voice preferences",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if !prefs.Persist || s.profiles == nil {
+		return
+	}
+	if err := s.profiles.Save(ctx, userID, profile); err != nil {
+		s.logger.Error("failed to persist voice preferences",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
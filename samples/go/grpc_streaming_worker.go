@@ -0,0 +1,154 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// inboundQueueSize bounds messages received but not yet processed. Receipt
+// blocks once it is full.
+const inboundQueueSize = 16
+
+// Reasons an in-flight generation is cancelled
+var (
+	errSuperseded      = errors.New("response superseded by a newer message")
+	errCrisisInterrupt = errors.New("response interrupted by crisis")
+)
+
+// interruptReason names a generation cancellation cause for clients
+func interruptReason(cause error) string {
+	switch {
+	case errors.Is(cause, errCrisisInterrupt):
+		return "crisis"
+	case errors.Is(cause, errSuperseded):
+		return "superseded"
+	}
+	return "cancelled"
+}
+
+// messageWorker processes a session's inbound messages one at a time, in
+// order of receipt, so receiving never waits on generation
+type messageWorker struct {
+	inbound chan *ChatMessage
+	pending atomic.Int32 // Received but not yet picked up
+	done    chan struct{}
+}
+
+// startWorker starts processing messages for a session
+func (s *TherapeuticStreamServer) startWorker(ctx context.Context, state *StreamState) *messageWorker {
+	w := &messageWorker{
+		inbound: make(chan *ChatMessage, inboundQueueSize),
+		done:    make(chan struct{}),
+	}
+	state.worker = w
+
+	go func() {
+		defer close(w.done)
+		for msg := range w.inbound {
+			w.pending.Add(-1)
+			if err := s.processMessage(ctx, msg, state); err != nil {
+				s.logger.Error("failed to process message",
+					slog.String("error", err.Error()),
+					slog.String("session_id", state.SessionID),
+				)
+				// Continue processing, don't break stream
+			}
+		}
+	}()
+
+	return w
+}
+
+// submit queues a message, cancelling any response still being generated
+// for an earlier one
+func (w *messageWorker) submit(ctx context.Context, msg *ChatMessage, state *StreamState) error {
+	w.pending.Add(1)
+	state.supersedeGeneration()
+
+	select {
+	case w.inbound <- msg:
+		return nil
+	case <-ctx.Done():
+		w.pending.Add(-1)
+		return ctx.Err()
+	}
+}
+
+// stop processes what has already been received, then returns
+func (w *messageWorker) stop() {
+	close(w.inbound)
+	<-w.done
+}
+
+// hasNewer reports whether a newer message is waiting, in which case
+// generating a response to the current one is wasted work
+func (w *messageWorker) hasNewer() bool {
+	return w != nil && w.pending.Load() > 0
+}
+
+// beginGeneration returns a context for a generation that a newer message
+// or crisis interrupt can cancel. The returned func must be called when it
+// completes.
+func (st *StreamState) beginGeneration(ctx context.Context) (context.Context, context.CancelFunc) {
+	genCtx, cancel := context.WithCancelCause(ctx)
+
+	st.mu.Lock()
+	st.cancelGeneration = cancel
+	st.mu.Unlock()
+
+	return genCtx, func() {
+		st.mu.Lock()
+		st.cancelGeneration = nil
+		st.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// supersedeGeneration cancels the in-flight generation, if any, because a
+// newer message arrived
+func (st *StreamState) supersedeGeneration() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.cancelGeneration != nil {
+		st.cancelGeneration(errSuperseded)
+		st.cancelGeneration = nil
+	}
+}
+
+// endInterruptedResponse closes out a response cut short by a newer message
+// or a crisis so clients discard the partial message
+func (s *TherapeuticStreamServer) endInterruptedResponse(
+	ctx context.Context,
+	state *StreamState,
+	streamIndex int32,
+	cause error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reason := interruptReason(cause)
+	s.logger.Info("generation interrupted",
+		slog.String("session_id", state.SessionID),
+		slog.String("reason", reason),
+		slog.Int("chunks_sent", int(streamIndex)),
+	)
+
+	if streamIndex == 0 {
+		return nil
+	}
+	return state.parties.send(&ChatMessage{
+		SessionId:   state.SessionID,
+		UserId:      state.UserID,
+		Role:        RoleAssistant,
+		Timestamp:   timestamppb.Now(),
+		StreamIndex: streamIndex,
+		IsFinal:     true,
+		Metadata:    map[string]string{"interrupted": "true", "reason": reason},
+	})
+}
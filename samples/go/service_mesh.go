@@ -13,15 +13,17 @@ import (
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health/grpc_health_v1"
-	"google.golang.org/grpc/keepalive"
 )
 
 // ServiceType defines the type of microservice
@@ -73,12 +75,28 @@ const (
 	InstanceStatusStarting  InstanceStatus = "starting"
 )
 
+// DiscoveryMode selects where the registry learns about service instances
+type DiscoveryMode string
+
+const (
+	DiscoveryModeRedis      DiscoveryMode = "redis"      // Self-registration with heartbeats
+	DiscoveryModeKubernetes DiscoveryMode = "kubernetes" // EndpointSlice informers
+)
+
 // ServiceRegistry manages service discovery and registration
 type ServiceRegistry struct {
 	redis       *redis.Client
 	logger      *slog.Logger
+	mode        DiscoveryMode
 	localInstance *ServiceInstance
 	instances   map[ServiceType][]*ServiceInstance
+	outliers    *outlierDetector
+	splits      *trafficSplitter
+	refresh     func() // Rebuilds the instance cache from the discovery backend
+	dependencies *dependencyRecorder
+	fallback    *fallbackResolver // Answers lookups while the backend is unreachable
+	lastRefresh time.Time         // Last successful instance cache refresh
+	slowStart   *SlowStartConfig
 	mu          sync.RWMutex
 	ctx         context.Context
 	cancel      context.CancelFunc
@@ -86,7 +104,8 @@ type ServiceRegistry struct {
 	// Health check configuration
 	healthCheckInterval time.Duration
 	healthCheckTimeout  time.Duration
-	unhealthyThreshold  int
+	health              *healthTracker
+	healthConns         *connPool // Direct connections for gRPC health probes
 }
 
 // RegistryConfig contains configuration for the service registry
@@ -95,7 +114,21 @@ type RegistryConfig struct {
 	HealthCheckInterval time.Duration
 	HealthCheckTimeout  time.Duration
 	UnhealthyThreshold  int
-	RegistrationTTL     time.Duration
+	HealthyThreshold    int           // Consecutive passing checks to recover from unhealthy
+	RegistrationTTL     time.Duration // Heartbeats unchanged for longer mark an instance stale
+
+	// Kubernetes configures EndpointSlice discovery (DiscoveryModeKubernetes only)
+	Kubernetes *KubernetesDiscoveryConfig
+
+	// OutlierDetection configures per-instance ejection from load balancing
+	OutlierDetection *OutlierDetectionConfig
+
+	// Fallback configures DNS SRV or static discovery while Redis is
+	// unreachable (DiscoveryModeRedis only)
+	Fallback *FallbackDiscoveryConfig
+
+	// SlowStart ramps traffic to newly healthy instances; nil disables
+	SlowStart *SlowStartConfig
 }
 
 // DefaultRegistryConfig returns default configuration
@@ -104,35 +137,64 @@ func DefaultRegistryConfig() *RegistryConfig {
 		HealthCheckInterval: 10 * time.Second,
 		HealthCheckTimeout:  5 * time.Second,
 		UnhealthyThreshold:  3,
+		HealthyThreshold:    2,
 		RegistrationTTL:     30 * time.Second,
+		Kubernetes:          DefaultKubernetesDiscoveryConfig(),
+		OutlierDetection:    DefaultOutlierDetectionConfig(),
+		SlowStart:           DefaultSlowStartConfig(),
 	}
 }
 
-// NewServiceRegistry creates a new service registry
+// NewServiceRegistry creates a new Redis-backed service registry
 func NewServiceRegistry(redis *redis.Client, logger *slog.Logger, config *RegistryConfig) *ServiceRegistry {
+	registry := newServiceRegistry(DiscoveryModeRedis, logger, config)
+	registry.redis = redis
+	registry.refresh = registry.refreshInstances
+	registry.healthConns = newConnPool(registry, DefaultConnPoolConfig(), logger)
+	registry.dependencies = newDependencyRecorder(redis, logger)
+	registry.fallback = newFallbackResolver(config.Fallback, logger)
+
+	// Start background workers
+	go registry.syncInstances()
+	go registry.healthChecker()
+	go registry.flushDependencies()
+
+	return registry
+}
+
+// newServiceRegistry builds the registry state shared by all discovery modes
+func newServiceRegistry(mode DiscoveryMode, logger *slog.Logger, config *RegistryConfig) *ServiceRegistry {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	registry := &ServiceRegistry{
-		redis:               redis,
+	return &ServiceRegistry{
 		logger:              logger,
+		mode:                mode,
 		instances:           make(map[ServiceType][]*ServiceInstance),
+		outliers:            newOutlierDetector(config.OutlierDetection, logger),
+		splits:              newTrafficSplitter(logger),
 		ctx:                 ctx,
 		cancel:              cancel,
 		healthCheckInterval: config.HealthCheckInterval,
 		healthCheckTimeout:  config.HealthCheckTimeout,
-		unhealthyThreshold:  config.UnhealthyThreshold,
+		health:              newHealthTracker(config),
+		lastRefresh:         time.Now(),
+		slowStart:           config.SlowStart,
 	}
-
-	// Start background workers
-	go registry.syncInstances()
-	go registry.healthChecker()
-
-	return registry
 }
 
 // Register registers a service instance
 func (r *ServiceRegistry) Register(instance *ServiceInstance) error {
 	r.localInstance = instance
+
+	// Kubernetes publishes endpoints from pod readiness; nothing to write
+	if r.mode == DiscoveryModeKubernetes {
+		r.logger.Info("service registration delegated to kubernetes",
+			slog.String("type", string(instance.Type)),
+			slog.String("id", instance.ID),
+		)
+		return nil
+	}
+
 	instance.Status = InstanceStatusStarting
 	instance.StartedAt = time.Now()
 
@@ -168,6 +230,10 @@ func (r *ServiceRegistry) Register(instance *ServiceInstance) error {
 
 // Deregister removes a service instance
 func (r *ServiceRegistry) Deregister(instance *ServiceInstance) error {
+	if r.mode == DiscoveryModeKubernetes {
+		return nil
+	}
+
 	key := fmt.Sprintf("service:%s:%s", instance.Type, instance.ID)
 	if err := r.redis.Del(r.ctx, key).Err(); err != nil {
 		return fmt.Errorf("failed to deregister instance: %w", err)
@@ -186,8 +252,106 @@ func (r *ServiceRegistry) Deregister(instance *ServiceInstance) error {
 	return nil
 }
 
+// ErrInstanceNotFound is returned when an instance ID is not in the registry
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// drainPollInterval is how often Drain checks for in-flight requests
+const drainPollInterval = 250 * time.Millisecond
+
+// Drain gracefully removes an instance: it is marked Draining (which takes it
+// out of load balancing for every client once they sync), in-flight requests
+// from this process are allowed to finish, and the instance is then
+// deregistered. If ctx expires first the instance is deregistered anyway.
+func (r *ServiceRegistry) Drain(ctx context.Context, instanceID string) error {
+	instance := r.findInstance(instanceID)
+	if instance == nil {
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, instanceID)
+	}
+
+	r.mu.Lock()
+	instance.Status = InstanceStatusDraining
+	// Keep heartbeats from overwriting the draining status
+	if r.localInstance != nil && r.localInstance.ID == instanceID {
+		r.localInstance.Status = InstanceStatusDraining
+	}
+	r.mu.Unlock()
+
+	// Publish the status so other clients stop selecting the instance
+	if r.mode == DiscoveryModeRedis {
+		key := fmt.Sprintf("service:%s:%s", instance.Type, instance.ID)
+		data, err := json.Marshal(instance)
+		if err != nil {
+			return fmt.Errorf("failed to marshal instance: %w", err)
+		}
+		if err := r.redis.Set(r.ctx, key, data, 30*time.Second).Err(); err != nil {
+			return fmt.Errorf("failed to mark instance draining: %w", err)
+		}
+	}
+
+	r.logger.Info("draining instance",
+		slog.String("type", string(instance.Type)),
+		slog.String("id", instance.ID),
+	)
+
+	countI, _ := connectionCounts.LoadOrStore(instance.ID, new(int64))
+	counter := countI.(*int64)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(counter) > 0 {
+		select {
+		case <-ctx.Done():
+			r.logger.Warn("drain deadline reached with requests in flight",
+				slog.String("id", instance.ID),
+				slog.Int64("in_flight", atomic.LoadInt64(counter)),
+			)
+			return r.Deregister(instance)
+		case <-ticker.C:
+		}
+	}
+
+	return r.Deregister(instance)
+}
+
+// allInstances returns every cached instance regardless of status
+func (r *ServiceRegistry) allInstances() []*ServiceInstance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]*ServiceInstance, 0)
+	for _, instances := range r.instances {
+		all = append(all, instances...)
+	}
+	return all
+}
+
+// findInstance looks up an instance by ID in the local cache
+func (r *ServiceRegistry) findInstance(instanceID string) *ServiceInstance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, instances := range r.instances {
+		for _, inst := range instances {
+			if inst.ID == instanceID {
+				return inst
+			}
+		}
+	}
+
+	if r.localInstance != nil && r.localInstance.ID == instanceID {
+		return r.localInstance
+	}
+
+	return nil
+}
+
 // GetInstances returns all healthy instances of a service type
 func (r *ServiceRegistry) GetInstances(serviceType ServiceType) []*ServiceInstance {
+	if instances, ok := r.fallbackInstances(serviceType); ok {
+		return instances
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -205,11 +369,44 @@ func (r *ServiceRegistry) GetInstances(serviceType ServiceType) []*ServiceInstan
 
 // GetInstance returns a single healthy instance using load balancing
 func (r *ServiceRegistry) GetInstance(serviceType ServiceType, strategy LoadBalanceStrategy) (*ServiceInstance, error) {
+	return r.selectInstance(serviceType, strategy, "", nil)
+}
+
+// GetInstanceForKey returns the instance that owns key on the service's
+// consistent-hash ring, so a session keeps hitting the same instance
+func (r *ServiceRegistry) GetInstanceForKey(serviceType ServiceType, key string) (*ServiceInstance, error) {
+	return r.selectInstance(serviceType, LoadBalanceConsistentHash, key, nil)
+}
+
+// selectInstance picks an instance, avoiding the excluded IDs when any
+// alternative exists (used to send retries and hedges elsewhere)
+func (r *ServiceRegistry) selectInstance(serviceType ServiceType, strategy LoadBalanceStrategy, key string, exclude map[string]bool) (*ServiceInstance, error) {
 	instances := r.GetInstances(serviceType)
 	if len(instances) == 0 {
 		return nil, fmt.Errorf("no healthy instances of %s available", serviceType)
 	}
 
+	// Skip instances ejected for consecutive failures
+	instances = r.outliers.filter(instances)
+
+	// Ramp traffic to instances still warming up
+	instances = r.slowStartFilter(instances)
+
+	// Narrow to one version when a canary traffic split is active
+	instances = r.splits.apply(serviceType, instances)
+
+	if len(exclude) > 0 {
+		remaining := make([]*ServiceInstance, 0, len(instances))
+		for _, inst := range instances {
+			if !exclude[inst.ID] {
+				remaining = append(remaining, inst)
+			}
+		}
+		if len(remaining) > 0 {
+			instances = remaining
+		}
+	}
+
 	switch strategy {
 	case LoadBalanceRoundRobin:
 		return r.roundRobin(serviceType, instances), nil
@@ -219,6 +416,13 @@ func (r *ServiceRegistry) GetInstance(serviceType ServiceType, strategy LoadBala
 		return r.weightedRandom(instances), nil
 	case LoadBalanceLeastConnections:
 		return r.leastConnections(instances), nil
+	case LoadBalanceConsistentHash:
+		if key == "" {
+			return r.roundRobin(serviceType, instances), nil
+		}
+		return r.consistentHash(serviceType, instances, key), nil
+	case LoadBalanceLeastLatency:
+		return r.leastLatency(instances), nil
 	default:
 		return instances[0], nil
 	}
@@ -232,6 +436,8 @@ const (
 	LoadBalanceRandom
 	LoadBalanceWeighted
 	LoadBalanceLeastConnections
+	LoadBalanceConsistentHash // Requires a key; see GetInstanceForKey and WithAffinityKey
+	LoadBalanceLeastLatency   // Power of two choices weighted by recent latency and in-flight count
 )
 
 // roundRobinCounters tracks round-robin state per service type
@@ -288,6 +494,14 @@ func (r *ServiceRegistry) leastConnections(instances []*ServiceInstance) *Servic
 	return minInst
 }
 
+// ReportResult feeds the outcome of a request to an instance into outlier
+// detection and canary analysis; callers that bypass ServiceClient should
+// report here
+func (r *ServiceRegistry) ReportResult(inst *ServiceInstance, err error) {
+	r.outliers.record(inst, err)
+	r.splits.record(inst, err)
+}
+
 // heartbeat sends periodic heartbeats to maintain registration
 func (r *ServiceRegistry) heartbeat(instance *ServiceInstance) {
 	ticker := time.NewTicker(10 * time.Second)
@@ -338,11 +552,13 @@ func (r *ServiceRegistry) refreshInstances() {
 	}
 
 	newInstances := make(map[ServiceType][]*ServiceInstance)
+	failures := 0
 
 	for _, svcType := range allTypes {
 		setKey := fmt.Sprintf("services:%s", svcType)
 		ids, err := r.redis.SMembers(r.ctx, setKey).Result()
 		if err != nil {
+			failures++
 			continue
 		}
 
@@ -365,18 +581,61 @@ func (r *ServiceRegistry) refreshInstances() {
 		newInstances[svcType] = instances
 	}
 
+	// Keep serving the last known table rather than an empty one when Redis
+	// is unreachable; fallback discovery takes over once it goes stale
+	if failures == len(allTypes) {
+		r.logger.Warn("instance refresh failed, keeping cached instances")
+		return
+	}
+
+	r.applyHealth(newInstances)
+
 	r.mu.Lock()
 	r.instances = newInstances
+	r.lastRefresh = time.Now()
 	r.mu.Unlock()
+
+	if r.fallback != nil {
+		r.fallback.recovered()
+	}
+
+	r.forgetVanished(newInstances)
+}
+
+// FlushInstanceCache discards cached load balancing state and rebuilds the
+// instance table from the discovery backend
+func (r *ServiceRegistry) FlushInstanceCache() {
+	hashRings.Range(func(key, _ any) bool {
+		hashRings.Delete(key)
+		return true
+	})
+	if r.refresh != nil {
+		r.refresh()
+	}
+	r.logger.Info("instance cache flushed")
+}
+
+// forgetVanished drops per-instance state for instances no longer registered
+func (r *ServiceRegistry) forgetVanished(current map[ServiceType][]*ServiceInstance) {
+	present := make(map[string]bool)
+	for _, instances := range current {
+		for _, inst := range instances {
+			present[inst.ID] = true
+		}
+	}
+	r.outliers.forget(present)
+	r.health.forget(present)
+	forgetLatencies(present)
 }
 
 // healthChecker performs periodic health checks
 func (r *ServiceRegistry) healthChecker() {
-	ticker := time.NewTicker(r.healthCheckInterval)
+	interval, timeout := r.healthCheckSettings()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	client := &http.Client{
-		Timeout: r.healthCheckTimeout,
+		Timeout: timeout,
 	}
 
 	for {
@@ -391,46 +650,82 @@ func (r *ServiceRegistry) healthChecker() {
 				}
 			}
 			r.mu.RUnlock()
+
+			// Pick up interval and timeout changes from the control channel
+			if newInterval, newTimeout := r.healthCheckSettings(); newInterval != interval || newTimeout != timeout {
+				interval, timeout = newInterval, newTimeout
+				ticker.Reset(interval)
+				client = &http.Client{Timeout: timeout}
+			}
 		}
 	}
 }
 
-// checkHealth checks the health of an instance
+// checkHealth checks the health of an instance over HTTP or gRPC
 func (r *ServiceRegistry) checkHealth(client *http.Client, inst *ServiceInstance) {
-	if inst.HealthCheckURL == "" {
-		inst.HealthCheckURL = fmt.Sprintf("http://%s:%d/health", inst.Host, inst.Port)
+	var err error
+	switch inst.healthCheckType() {
+	case HealthCheckGRPC:
+		err = r.checkGRPCHealth(inst)
+	default:
+		err = checkHTTPHealth(client, inst)
 	}
 
-	resp, err := client.Get(inst.HealthCheckURL)
 	if err != nil {
-		r.markUnhealthy(inst)
-		return
+		metrics.healthCheckFailures.WithLabelValues(string(inst.Type)).Inc()
+		r.logger.Debug("health check failed",
+			slog.String("id", inst.ID),
+			slog.String("check", string(inst.healthCheckType())),
+			slog.String("error", err.Error()),
+		)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		inst.Status = InstanceStatusHealthy
+	status, changed, streak := r.health.recordCheck(inst.ID, err)
+
+	// A draining instance stays out of rotation even while it still passes checks
+	if inst.Status != InstanceStatusDraining {
+		inst.Status = status
+	}
+	if err == nil {
 		inst.LastHealthCheck = time.Now()
-	} else {
-		r.markUnhealthy(inst)
 	}
-}
-
-// unhealthyCounts tracks consecutive health check failures
-var unhealthyCounts sync.Map
 
-// markUnhealthy marks an instance as unhealthy
-func (r *ServiceRegistry) markUnhealthy(inst *ServiceInstance) {
-	countI, _ := unhealthyCounts.LoadOrStore(inst.ID, new(int32))
-	count := atomic.AddInt32(countI.(*int32), 1)
-
-	if int(count) >= r.unhealthyThreshold {
-		inst.Status = InstanceStatusUnhealthy
+	if !changed {
+		return
+	}
+	switch status {
+	case InstanceStatusUnhealthy:
 		r.logger.Warn("instance marked unhealthy",
 			slog.String("type", string(inst.Type)),
 			slog.String("id", inst.ID),
-			slog.Int("consecutive_failures", int(count)),
+			slog.Int("consecutive_failures", streak),
 		)
+	case InstanceStatusHealthy:
+		r.logger.Info("instance marked healthy",
+			slog.String("type", string(inst.Type)),
+			slog.String("id", inst.ID),
+			slog.Int("consecutive_successes", streak),
+		)
+	}
+}
+
+// applyHealth carries tracked health onto freshly loaded instances, which
+// otherwise arrive with whatever status their owner last published
+func (r *ServiceRegistry) applyHealth(instances map[ServiceType][]*ServiceInstance) {
+	now := time.Now()
+	for _, list := range instances {
+		for _, inst := range list {
+			status, becameStale := r.health.observe(inst, now)
+			if becameStale {
+				r.logger.Warn("instance heartbeat stale",
+					slog.String("type", string(inst.Type)),
+					slog.String("id", inst.ID),
+				)
+			}
+			if inst.Status != InstanceStatusDraining {
+				inst.Status = status
+			}
+		}
 	}
 }
 
@@ -439,7 +734,13 @@ func (r *ServiceRegistry) Stop() {
 	if r.localInstance != nil {
 		r.Deregister(r.localInstance)
 	}
+	if r.dependencies != nil {
+		r.dependencies.flush(r.ctx)
+	}
 	r.cancel()
+	if r.healthConns != nil {
+		r.healthConns.close()
+	}
 }
 
 // CircuitBreaker implements the circuit breaker pattern
@@ -455,6 +756,7 @@ type CircuitBreaker struct {
 	lastFailure   time.Time
 	mu            sync.RWMutex
 	logger        *slog.Logger
+	forced        bool // Held open by an operator until Reset
 
 	onStateChange func(from, to CircuitState)
 }
@@ -530,7 +832,7 @@ func (cb *CircuitBreaker) allowRequest() bool {
 		return true
 	case CircuitOpen:
 		// Check if timeout has elapsed
-		if time.Since(cb.lastFailure) > cb.timeout {
+		if !cb.forced && time.Since(cb.lastFailure) > cb.timeout {
 			cb.mu.RUnlock()
 			cb.transitionTo(CircuitHalfOpen)
 			cb.mu.RLock()
@@ -596,6 +898,30 @@ func (cb *CircuitBreaker) transitionToLocked(newState CircuitState) {
 	}
 }
 
+// ForceOpen opens the circuit and holds it open until Reset
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forced = true
+	cb.lastFailure = time.Now()
+	cb.transitionToLocked(CircuitOpen)
+}
+
+// Reset closes the circuit and clears any forced state
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forced = false
+	cb.transitionToLocked(CircuitClosed)
+}
+
+// Forced reports whether the circuit is being held open by an operator
+func (cb *CircuitBreaker) Forced() bool {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	return cb.forced
+}
+
 // State returns the current circuit state
 func (cb *CircuitBreaker) State() CircuitState {
 	cb.mu.RLock()
@@ -608,9 +934,21 @@ type ServiceClient struct {
 	registry       *ServiceRegistry
 	circuitBreakers map[ServiceType]*CircuitBreaker
 	httpClient     *http.Client
-	grpcConns      map[string]*grpc.ClientConn
+	pool           *connPool
+	faults         *FaultInjector
+	timeouts       *latencyTracker
+	bulkheads      bulkheads
+	accessLog      *accessLogger
+	routes         *routeTable
+	strategy       LoadBalanceStrategy
+	upstreamTLS    bool
 	logger         *slog.Logger
 	mu             sync.RWMutex
+
+	maxRetries     int
+	retryBackoff   time.Duration
+	retryBudgets   *retryBudgets
+	hedging        *HedgingConfig
 }
 
 // ServiceClientConfig contains client configuration
@@ -620,6 +958,14 @@ type ServiceClientConfig struct {
 	MaxRetries        int
 	RetryBackoff      time.Duration
 	CircuitBreaker    *CircuitBreakerConfig
+	RetryBudget       *RetryBudgetConfig // Caps retries as a share of traffic
+	Hedging           *HedgingConfig     // Optional hedging for idempotent requests
+	ConnPool          *ConnPoolConfig    // gRPC connection lifecycle
+	AdaptiveTimeout   *AdaptiveTimeoutConfig // Latency-derived per-attempt deadlines
+	Bulkheads         map[ServiceType]*BulkheadConfig // Per-service concurrency limits
+	AccessLog         *AccessLogConfig                // Opt-in structured access logging
+	Routes            []*Route                        // Per-endpoint policy overrides
+	Strategy          LoadBalanceStrategy             // Defaults to round robin
 }
 
 // NewServiceClient creates a new service client
@@ -627,10 +973,21 @@ func NewServiceClient(registry *ServiceRegistry, logger *slog.Logger, config *Se
 	client := &ServiceClient{
 		registry:        registry,
 		circuitBreakers: make(map[ServiceType]*CircuitBreaker),
-		grpcConns:       make(map[string]*grpc.ClientConn),
+		pool:            newConnPool(registry, config.ConnPool, logger),
+		faults:          NewFaultInjector(logger),
+		timeouts:        newLatencyTracker(config.AdaptiveTimeout, config.HTTPTimeout),
+		bulkheads:       newBulkheads(config.Bulkheads),
+		accessLog:       newAccessLogger(config.AccessLog),
+		routes:          newRouteTable(logger),
+		strategy:        config.Strategy,
 		logger:          logger,
+		maxRetries:      config.MaxRetries,
+		retryBackoff:    config.RetryBackoff,
+		retryBudgets:    newRetryBudgets(config.RetryBudget),
+		hedging:         config.Hedging,
+		// Timeouts are applied per attempt by the latency tracker so they
+		// can be changed at runtime
 		httpClient: &http.Client{
-			Timeout: config.HTTPTimeout,
 			Transport: &http.Transport{
 				MaxIdleConns:        100,
 				MaxIdleConnsPerHost: 10,
@@ -655,106 +1012,257 @@ func NewServiceClient(registry *ServiceRegistry, logger *slog.Logger, config *Se
 		client.circuitBreakers[svcType] = NewCircuitBreaker(cbConfig, logger)
 	}
 
+	if len(config.Routes) > 0 {
+		if err := client.SetRoutes(config.Routes); err != nil {
+			logger.Error("invalid routing table ignored", slog.String("error", err.Error()))
+		}
+	}
+
 	return client
 }
 
-// CallHTTP makes an HTTP call to a service
+// CallHTTP makes an HTTP call to a service. Idempotent requests without a
+// body are retried on other instances within the retry budget, and hedged
+// when hedging is configured.
 func (c *ServiceClient) CallHTTP(ctx context.Context, serviceType ServiceType, method, path string, body io.Reader) (*http.Response, error) {
-	cb := c.circuitBreakers[serviceType]
-	if cb != nil && cb.State() == CircuitOpen {
-		return nil, ErrCircuitOpen
+	if c.accessLog == nil {
+		return c.callHTTP(ctx, serviceType, method, path, body)
 	}
 
-	instance, err := c.registry.GetInstance(serviceType, LoadBalanceRoundRobin)
+	ctx = withCallStats(ctx)
+	startTime := time.Now()
+	resp, err := c.callHTTP(ctx, serviceType, method, path, body)
+
+	entry := &AccessLogEntry{
+		Source:  "client",
+		Method:  method,
+		Service: serviceType,
+		Latency: time.Since(startTime),
+	}
+	entry.Path, entry.Query, _ = strings.Cut(path, "?")
+	if resp != nil {
+		entry.Status = resp.StatusCode
+	}
 	if err != nil {
-		return nil, err
+		entry.Error = err.Error()
 	}
+	c.accessLog.log(ctx, entry, nil)
 
-	url := fmt.Sprintf("http://%s:%d%s", instance.Host, instance.Port, path)
+	return resp, err
+}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
+// callHTTP implements CallHTTP
+func (c *ServiceClient) callHTTP(ctx context.Context, serviceType ServiceType, method, path string, body io.Reader) (*http.Response, error) {
+	ctx, span := startClientSpan(ctx, serviceType, method, path)
+	defer span.End()
+
+	ctx, err := c.applyRoute(ctx, serviceType, method, path)
 	if err != nil {
+		recordSpanError(span, err)
 		return nil, err
 	}
 
-	// Track connection for least connections LB
-	countI, _ := connectionCounts.LoadOrStore(instance.ID, new(int64))
-	counter := countI.(*int64)
-	atomic.AddInt64(counter, 1)
-	defer atomic.AddInt64(counter, -1)
+	// Instances answer for their own failures through outlier detection;
+	// the breaker judges the service by calls that failed on every instance
+	// tried, so one bad replica can't open it
+	cb := c.breakerFor(ctx, serviceType)
+	if cb != nil {
+		span.SetAttributes(attrCircuitState.String(cb.State().String()))
+		if !cb.allowRequest() {
+			recordSpanError(span, ErrCircuitOpen)
+			return nil, ErrCircuitOpen
+		}
+	}
+
+	budget := c.retryBudgets.forService(serviceType)
+	budget.recordRequest()
+
+	replayable := body == nil && isIdempotent(method)
+	route := routeFromContext(ctx)
 
 	var resp *http.Response
-	executeErr := cb.Execute(func() error {
-		var reqErr error
-		resp, reqErr = c.httpClient.Do(req)
-		if reqErr != nil {
-			return reqErr
+	if replayable && c.hedging != nil && c.hedging.Enabled && (route == nil || route.allowsRetries()) {
+		resp, err = c.hedgedCall(ctx, serviceType, method, path, budget)
+	} else {
+		resp, err = c.callWithRetries(ctx, serviceType, method, path, body, replayable, budget)
+	}
+	if cb != nil && !errors.Is(err, ErrBulkheadFull) {
+		cb.recordResult(err)
+	}
+	c.registry.recordDependency(c.registry.callerService(ctx), serviceType, err)
+
+	if resp != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// callWithRetries performs a request, retrying on a different instance
+// while attempts and the service's retry budget allow
+func (c *ServiceClient) callWithRetries(ctx context.Context, serviceType ServiceType, method, path string, body io.Reader, replayable bool, budget *retryBudget) (*http.Response, error) {
+	tried := make(map[string]bool)
+	c.mu.RLock()
+	wait := c.retryBackoff
+	c.mu.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		instance, err := c.pickInstance(ctx, serviceType, tried)
+		if err != nil {
+			return nil, err
 		}
-		if resp.StatusCode >= 500 {
-			return fmt.Errorf("server error: %d", resp.StatusCode)
+		tried[instance.ID] = true
+
+		resp, err := c.callInstance(ctx, serviceType, instance, method, path, body)
+		if err == nil || errors.Is(err, ErrBulkheadFull) {
+			return resp, err
 		}
-		return nil
-	})
 
-	if executeErr != nil {
-		return nil, executeErr
+		if !replayable || attempt >= c.maxRetriesFor(ctx) || ctx.Err() != nil {
+			return nil, err
+		}
+		if !budget.tryRetry() {
+			c.logger.Warn("retry budget exhausted",
+				slog.String("service", string(serviceType)),
+			)
+			return nil, err
+		}
+
+		recordRetry(ctx, serviceType, attempt+1)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
 	}
+}
 
-	return resp, nil
+// pickInstance selects an instance for a call, honoring any affinity key
+// carried in the context
+func (c *ServiceClient) pickInstance(ctx context.Context, serviceType ServiceType, exclude map[string]bool) (*ServiceInstance, error) {
+	if key := affinityKeyFromContext(ctx); key != "" {
+		return c.registry.selectInstance(serviceType, LoadBalanceConsistentHash, key, exclude)
+	}
+	c.mu.RLock()
+	strategy := c.strategy
+	c.mu.RUnlock()
+	return c.registry.selectInstance(serviceType, strategy, "", exclude)
 }
 
-// GetGRPCConn returns a gRPC connection to a service
-func (c *ServiceClient) GetGRPCConn(ctx context.Context, serviceType ServiceType) (*grpc.ClientConn, error) {
-	instance, err := c.registry.GetInstance(serviceType, LoadBalanceRoundRobin)
+// callInstance performs a single request attempt against one instance
+func (c *ServiceClient) callInstance(ctx context.Context, serviceType ServiceType, instance *ServiceInstance, method, path string, body io.Reader) (*http.Response, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attrInstanceID.String(instance.ID))
+	if stats := callStatsFromContext(ctx); stats != nil {
+		stats.setInstance(instance.ID)
+	}
+
+	url := fmt.Sprintf("%s://%s:%d%s", c.upstreamScheme(instance), instance.Host, instance.Port, path)
+
+	// Hold a bulkhead slot until the response body is closed
+	release, err := c.bulkheads.acquire(ctx, serviceType)
 	if err != nil {
 		return nil, err
 	}
 
-	if instance.GRPCPort == 0 {
-		return nil, fmt.Errorf("service %s does not support gRPC", serviceType)
+	// Bound the attempt by the service's adaptive, overridden, or static deadline
+	cancelTimeout := context.CancelFunc(func() {})
+	if timeout := c.timeouts.timeout(ctx, serviceType); timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
 	}
 
-	connKey := fmt.Sprintf("%s:%d", instance.Host, instance.GRPCPort)
+	// Track connection for least connections LB and draining; a streamed
+	// response stays in flight until its body is closed
+	countI, _ := connectionCounts.LoadOrStore(instance.ID, new(int64))
+	counter := countI.(*int64)
+	atomic.AddInt64(counter, 1)
 
-	c.mu.RLock()
-	if conn, ok := c.grpcConns[connKey]; ok {
-		c.mu.RUnlock()
-		return conn, nil
+	cancel := sync.OnceFunc(func() {
+		atomic.AddInt64(counter, -1)
+		cancelTimeout()
+		release()
+	})
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		cancel()
+		return nil, err
 	}
-	c.mu.RUnlock()
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// Propagate trace context, verified identity, and call metadata
+	injectTraceContext(ctx, req.Header)
+	setIdentityHeaders(ctx, req.Header)
+	setCallHeaders(ctx, req.Header, c.registry.callerService(ctx))
 
-	// Double-check after acquiring write lock
-	if conn, ok := c.grpcConns[connKey]; ok {
-		return conn, nil
-	}
+	startTime := time.Now()
 
-	// Create new connection
-	opts := []grpc.DialOption{
-		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time:                10 * time.Second,
-			Timeout:             3 * time.Second,
-			PermitWithoutStream: true,
-		}),
+	var resp *http.Response
+	do := func() error {
+		var reqErr error
+		// Injected faults flow through the same outlier and breaker accounting
+		// as real failures so resilience behavior can be exercised end to end
+		if fault := c.faults.evaluate(serviceType, path); fault != nil {
+			resp, reqErr = fault.apply(ctx, req)
+		}
+		if resp == nil && reqErr == nil {
+			resp, reqErr = c.httpClient.Do(req)
+		}
+		if reqErr != nil {
+			return reqErr
+		}
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("server error: %d", resp.StatusCode)
+		}
+		return nil
 	}
 
-	// Use TLS in production
-	if instance.Metadata["tls"] == "true" {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
-	} else {
-		opts = append(opts, grpc.WithInsecure())
+	executeErr := do()
+	c.registry.ReportResult(instance, executeErr)
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
 	}
+	latency := time.Since(startTime)
+	metrics.observeRequest(serviceType, method, statusCode, latency.Seconds())
 
-	conn, err := grpc.DialContext(ctx, connKey, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to %s: %w", serviceType, err)
+	if executeErr != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, executeErr
 	}
 
-	c.grpcConns[connKey] = conn
+	// Only successes feed the tracker so timeouts can't ratchet the deadline up
+	c.timeouts.observe(serviceType, latency)
+	c.registry.observeLatency(instance, latency)
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// Faults returns the client's fault injector for runtime chaos testing
+func (c *ServiceClient) Faults() *FaultInjector {
+	return c.faults
+}
+
+// GetGRPCConn returns a gRPC connection to a service. The connection targets
+// the registry resolver, so gRPC's round_robin balancer spreads calls across
+// instances and handles reconnects and subconnection health itself.
+func (c *ServiceClient) GetGRPCConn(ctx context.Context, serviceType ServiceType) (*grpc.ClientConn, error) {
+	return c.pool.serviceConn(ctx, serviceType)
+}
 
-	return conn, nil
+// GetInstanceConn returns a pooled connection to one specific instance,
+// for callers that must bypass load balancing (probes, passthrough proxying)
+func (c *ServiceClient) GetInstanceConn(ctx context.Context, instance *ServiceInstance) (*grpc.ClientConn, error) {
+	return c.pool.instanceConn(ctx, instance)
 }
 
 // HealthCheck performs a health check on a gRPC service
@@ -777,12 +1285,7 @@ func (c *ServiceClient) HealthCheck(ctx context.Context, serviceType ServiceType
 
 // Close closes all connections
 func (c *ServiceClient) Close() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	for _, conn := range c.grpcConns {
-		conn.Close()
-	}
+	c.pool.close()
 }
 
 // RetryPolicy defines retry behavior
@@ -791,6 +1294,7 @@ type RetryPolicy struct {
 	InitialWait time.Duration
 	MaxWait     time.Duration
 	Multiplier  float64
+	Service     ServiceType // Optional label for retry metrics
 }
 
 // DefaultRetryPolicy returns a default retry policy
@@ -815,6 +1319,10 @@ func Retry(ctx context.Context, policy *RetryPolicy, fn func() error) error {
 		default:
 		}
 
+		if attempt > 0 {
+			recordRetry(ctx, policy.Service, attempt)
+		}
+
 		if err := fn(); err == nil {
 			return nil
 		} else {
@@ -841,6 +1349,11 @@ type Sidecar struct {
 	proxyPort   int
 	logger      *slog.Logger
 	server      *http.Server
+	grpcServer  *grpc.Server
+	shadows     *shadower
+	accessLog   *accessLogger
+	validator   TokenValidator
+	tlsConfig   *tls.Config
 }
 
 // NewSidecar creates a new sidecar proxy
@@ -851,6 +1364,7 @@ func NewSidecar(registry *ServiceRegistry, client *ServiceClient, localPort, pro
 		localPort: localPort,
 		proxyPort: proxyPort,
 		logger:    logger,
+		shadows:   newShadower(registry, client, logger),
 	}
 }
 
@@ -865,21 +1379,31 @@ func (s *Sidecar) Start() error {
 	})
 
 	// Metrics endpoint
-	mux.HandleFunc("/metrics", s.metricsHandler)
+	metricsRegistry, err := NewMetricsRegistry(s.registry, s.client)
+	if err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
 
 	// Proxy all other requests
 	mux.HandleFunc("/", s.proxyHandler)
 
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.proxyPort),
-		Handler: mux,
+		Addr:      fmt.Sprintf(":%d", s.proxyPort),
+		Handler:   mux,
+		TLSConfig: s.tlsConfig,
 	}
 
 	s.logger.Info("sidecar proxy starting",
 		slog.Int("local_port", s.localPort),
 		slog.Int("proxy_port", s.proxyPort),
+		slog.Bool("tls", s.tlsConfig != nil),
 	)
 
+	// Certificates come from TLSConfig.GetCertificate, so no files are passed
+	if s.tlsConfig != nil {
+		return s.server.ListenAndServeTLS("", "")
+	}
 	return s.server.ListenAndServe()
 }
 
@@ -894,16 +1418,92 @@ func (s *Sidecar) proxyHandler(w http.ResponseWriter, r *http.Request) {
 
 	serviceType := ServiceType(targetService)
 
-	resp, err := s.client.CallHTTP(r.Context(), serviceType, r.Method, r.URL.Path, r.Body)
+	ctx, span := startProxySpan(r, targetService)
+	defer span.End()
+
+	entry := &AccessLogEntry{
+		Source:  "sidecar",
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Service: serviceType,
+	}
+	if s.accessLog != nil {
+		ctx = withCallStats(ctx)
+		startTime := time.Now()
+		defer func() {
+			entry.Latency = time.Since(startTime)
+			s.accessLog.log(ctx, entry, r.Header)
+		}()
+	}
+
+	identity, err := s.authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		recordSpanError(span, err)
+		entry.Status = http.StatusUnauthorized
+		entry.Error = err.Error()
+		http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	if identity != nil {
+		ctx = WithIdentity(ctx, identity)
+	}
+
+	// Work within the caller's remaining budget rather than a fresh timeout
+	ctx, cancelBudget := ExtractCallHeaders(ctx, r.Header)
+	defer cancelBudget()
+	if ctx.Err() != nil {
+		entry.Status = http.StatusGatewayTimeout
+		entry.Error = "deadline budget exhausted"
+		http.Error(w, "deadline budget exhausted", http.StatusGatewayTimeout)
+		return
+	}
+
+	// Mirror a sample of traffic to any configured shadow service
+	body, shadow := s.shadows.prepare(ctx, r, serviceType)
+	if shadow != nil {
+		s.shadows.mirror(shadow)
+	}
+
+	resp, err := s.client.CallHTTP(ctx, serviceType, r.Method, r.URL.Path, body)
 	if err != nil {
+		recordSpanError(span, err)
+		entry.Error = err.Error()
+
+		// Surface injected resets to the caller as a real connection reset
+		if errors.Is(err, ErrInjectedReset) && resetClientConnection(w) {
+			return
+		}
+
+		// Shed load explicitly so callers back off instead of treating it as an outage
+		if errors.Is(err, ErrRateLimited) {
+			entry.Status = http.StatusTooManyRequests
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, ErrBulkheadFull) {
+			entry.Status = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
 		s.logger.Error("proxy request failed",
 			slog.String("error", err.Error()),
 			slog.String("service", targetService),
 		)
+		entry.Status = http.StatusBadGateway
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	entry.Status = resp.StatusCode
+
+	if shadow != nil {
+		shadow.complete(resp.StatusCode)
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
 	// Copy response headers
 	for key, values := range resp.Header {
@@ -916,31 +1516,10 @@ func (s *Sidecar) proxyHandler(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, resp.Body)
 }
 
-// metricsHandler returns Prometheus-style metrics
-func (s *Sidecar) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-
-	// Output circuit breaker states
-	for svcType, cb := range s.client.circuitBreakers {
-		fmt.Fprintf(w, "circuit_breaker_state{service=\"%s\"} %d\n", svcType, cb.State())
-	}
-
-	// Output instance counts
-	s.registry.mu.RLock()
-	for svcType, instances := range s.registry.instances {
-		healthy := 0
-		for _, inst := range instances {
-			if inst.Status == InstanceStatusHealthy {
-				healthy++
-			}
-		}
-		fmt.Fprintf(w, "service_instances_total{service=\"%s\"} %d\n", svcType, len(instances))
-		fmt.Fprintf(w, "service_instances_healthy{service=\"%s\"} %d\n", svcType, healthy)
-	}
-	s.registry.mu.RUnlock()
-}
-
 // Stop gracefully stops the sidecar
 func (s *Sidecar) Stop(ctx context.Context) error {
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
 	return s.server.Shutdown(ctx)
 }
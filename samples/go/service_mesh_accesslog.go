@@ -0,0 +1,208 @@
+package mesh
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedValue replaces sensitive values in access logs
+const redactedValue = "[REDACTED]"
+
+// AccessLogEntry is one structured access log record
+type AccessLogEntry struct {
+	Source     string // "client" or "sidecar"
+	Method     string
+	Path       string
+	Query      string
+	Service    ServiceType
+	InstanceID string
+	Status     int
+	Latency    time.Duration
+	Retries    int
+	TraceID    string
+	Headers    map[string]string
+	Error      string
+}
+
+// Redactor strips PHI from an entry before it is written
+type Redactor func(entry *AccessLogEntry)
+
+// AccessLogConfig configures opt-in access logging
+type AccessLogConfig struct {
+	Enabled bool
+	Logger  *slog.Logger // Defaults to JSON on stdout
+	Headers []string     // Allowlist of request headers to record
+	Redact  Redactor     // Applied to every entry; defaults to RedactQueryValues
+}
+
+// DefaultAccessLogConfig returns default configuration. Logging stays off
+// until explicitly enabled.
+func DefaultAccessLogConfig() *AccessLogConfig {
+	return &AccessLogConfig{
+		Enabled: false,
+		Headers: []string{"User-Agent", "X-Request-ID"},
+		Redact:  RedactQueryValues,
+	}
+}
+
+// RedactQueryValues keeps query parameter names but replaces every value,
+// since identifiers like resident IDs routinely travel in query strings
+func RedactQueryValues(entry *AccessLogEntry) {
+	if entry.Query == "" {
+		return
+	}
+	values, err := url.ParseQuery(entry.Query)
+	if err != nil {
+		entry.Query = redactedValue
+		return
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, url.QueryEscape(key)+"="+redactedValue)
+	}
+	entry.Query = strings.Join(parts, "&")
+}
+
+// accessLogger writes access log entries
+type accessLogger struct {
+	logger  *slog.Logger
+	headers []string
+	redact  Redactor
+}
+
+// newAccessLogger returns nil when access logging is disabled
+func newAccessLogger(config *AccessLogConfig) *accessLogger {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+	redact := config.Redact
+	if redact == nil {
+		redact = RedactQueryValues
+	}
+
+	return &accessLogger{
+		logger:  logger,
+		headers: config.Headers,
+		redact:  redact,
+	}
+}
+
+// log redacts and writes an entry; safe to call on a nil logger
+func (a *accessLogger) log(ctx context.Context, entry *AccessLogEntry, header http.Header) {
+	if a == nil {
+		return
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+	if stats := callStatsFromContext(ctx); stats != nil {
+		entry.InstanceID, entry.Retries = stats.snapshot()
+	}
+
+	if len(a.headers) > 0 && header != nil {
+		entry.Headers = make(map[string]string, len(a.headers))
+		for _, name := range a.headers {
+			if value := header.Get(name); value != "" {
+				entry.Headers[name] = value
+			}
+		}
+	}
+
+	a.redact(entry)
+
+	attrs := []slog.Attr{
+		slog.String("source", entry.Source),
+		slog.String("method", entry.Method),
+		slog.String("path", entry.Path),
+		slog.String("service", string(entry.Service)),
+		slog.String("instance_id", entry.InstanceID),
+		slog.Int("status", entry.Status),
+		slog.Float64("latency_ms", float64(entry.Latency.Microseconds())/1000),
+		slog.Int("retries", entry.Retries),
+		slog.String("trace_id", entry.TraceID),
+	}
+	if entry.Query != "" {
+		attrs = append(attrs, slog.String("query", entry.Query))
+	}
+	if len(entry.Headers) > 0 {
+		attrs = append(attrs, slog.Any("headers", entry.Headers))
+	}
+	if entry.Error != "" {
+		attrs = append(attrs, slog.String("error", entry.Error))
+	}
+
+	a.logger.LogAttrs(ctx, slog.LevelInfo, "access", attrs...)
+}
+
+// callStats collects per-call details from deep in the request path
+type callStats struct {
+	mu         sync.Mutex
+	instanceID string
+	retries    int
+}
+
+// callStatsCtx is the context key for call stats
+type callStatsCtx struct{}
+
+// withCallStats attaches call stats to a context, reusing existing stats
+// so a sidecar and its client share one record
+func withCallStats(ctx context.Context) context.Context {
+	if callStatsFromContext(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, callStatsCtx{}, &callStats{})
+}
+
+// callStatsFromContext returns the call stats, if any
+func callStatsFromContext(ctx context.Context) *callStats {
+	stats, _ := ctx.Value(callStatsCtx{}).(*callStats)
+	return stats
+}
+
+// setInstance records the instance an attempt was sent to
+func (s *callStats) setInstance(id string) {
+	s.mu.Lock()
+	s.instanceID = id
+	s.mu.Unlock()
+}
+
+// addRetry counts a retry or hedge
+func (s *callStats) addRetry() {
+	s.mu.Lock()
+	s.retries++
+	s.mu.Unlock()
+}
+
+// snapshot returns the recorded instance and retry count
+func (s *callStats) snapshot() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.instanceID, s.retries
+}
+
+// EnableAccessLog turns on access logging for requests entering the sidecar
+func (s *Sidecar) EnableAccessLog(config *AccessLogConfig) {
+	s.accessLog = newAccessLogger(config)
+}
@@ -0,0 +1,455 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AdminConfig configures the mesh admin API
+type AdminConfig struct {
+	Port         int
+	Validator    TokenValidator // Required; every admin request must authenticate
+	AllowedRoles []string       // Roles permitted to use the API
+	DrainTimeout time.Duration  // Upper bound for drains started through the API
+}
+
+// DefaultAdminConfig returns default configuration. A Validator must still
+// be supplied.
+func DefaultAdminConfig() *AdminConfig {
+	return &AdminConfig{
+		Port:         9901,
+		AllowedRoles: []string{"admin", "system"},
+		DrainTimeout: 5 * time.Minute,
+	}
+}
+
+// ErrAdminValidatorRequired is returned when the admin API has no validator
+var ErrAdminValidatorRequired = errors.New("admin API requires a token validator")
+
+// AdminServer exposes runtime inspection and control of the mesh over HTTP
+type AdminServer struct {
+	registry *ServiceRegistry
+	client   *ServiceClient
+	config   *AdminConfig
+	logger   *slog.Logger
+	server   *http.Server
+}
+
+// NewAdminServer creates an admin server
+func NewAdminServer(registry *ServiceRegistry, client *ServiceClient, logger *slog.Logger, config *AdminConfig) (*AdminServer, error) {
+	if config.Validator == nil {
+		return nil, ErrAdminValidatorRequired
+	}
+	return &AdminServer{
+		registry: registry,
+		client:   client,
+		config:   config,
+		logger:   logger,
+	}, nil
+}
+
+// Handler returns the authenticated admin routes
+func (a *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/instances", a.handleInstances)
+	mux.HandleFunc("/admin/instances/", a.handleInstanceAction)
+	mux.HandleFunc("/admin/breakers", a.handleBreakers)
+	mux.HandleFunc("/admin/breakers/", a.handleBreakerAction)
+	mux.HandleFunc("/admin/lb", a.handleLoadBalancing)
+	mux.HandleFunc("/admin/cache/flush", a.handleFlush)
+	mux.HandleFunc("/admin/faults", a.handleFaults)
+	mux.HandleFunc("/admin/faults/", a.handleFaultToggle)
+	mux.HandleFunc("/admin/dependencies", a.handleDependencies)
+	mux.HandleFunc("/admin/config", a.handleConfig)
+	mux.HandleFunc("/admin/config/audit", a.handleConfigAudit)
+	return a.authenticate(mux)
+}
+
+// Start starts the admin server
+func (a *AdminServer) Start() error {
+	a.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.config.Port),
+		Handler: a.Handler(),
+	}
+
+	a.logger.Info("mesh admin API starting", slog.Int("port", a.config.Port))
+
+	return a.server.ListenAndServe()
+}
+
+// Stop gracefully stops the admin server
+func (a *AdminServer) Stop(ctx context.Context) error {
+	if a.server == nil {
+		return nil
+	}
+	return a.server.Shutdown(ctx)
+}
+
+// authenticate requires a valid bearer token with an allowed role
+func (a *AdminServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing authorization header"})
+			return
+		}
+
+		identity, err := a.config.Validator.ValidateToken(r.Context(), token)
+		if err != nil {
+			a.logger.Warn("admin token validation failed", slog.String("error", err.Error()))
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
+			return
+		}
+
+		allowed := false
+		for _, role := range a.config.AllowedRoles {
+			if identity.Role == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			a.logger.Warn("mesh admin action",
+				slog.String("user_id", identity.UserID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// adminInstance is one row of the instance table
+type adminInstance struct {
+	*ServiceInstance
+	ActiveConnections int64 `json:"active_connections"`
+	Ejected           bool  `json:"ejected"`
+}
+
+// handleInstances serves GET /admin/instances
+func (a *AdminServer) handleInstances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	a.registry.mu.RLock()
+	table := make(map[ServiceType][]adminInstance, len(a.registry.instances))
+	for svcType, instances := range a.registry.instances {
+		rows := make([]adminInstance, 0, len(instances))
+		for _, inst := range instances {
+			rows = append(rows, adminInstance{
+				ServiceInstance:   inst,
+				ActiveConnections: activeConnections(inst.ID),
+				Ejected:           a.registry.outliers.isEjected(inst.ID),
+			})
+		}
+		table[svcType] = rows
+	}
+	a.registry.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, table)
+}
+
+// handleInstanceAction serves POST /admin/instances/{id}/drain
+func (a *AdminServer) handleInstanceAction(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := splitAction(r.URL.Path, "/admin/instances/")
+	if !ok || action != "drain" || r.Method != http.MethodPost {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	if a.registry.findInstance(id) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": ErrInstanceNotFound.Error()})
+		return
+	}
+
+	// Draining waits for in-flight requests, so run it past the admin request
+	go func() {
+		ctx, cancel := context.WithTimeout(a.registry.ctx, a.config.DrainTimeout)
+		defer cancel()
+		if err := a.registry.Drain(ctx, id); err != nil {
+			a.logger.Error("admin drain failed",
+				slog.String("id", id),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "draining", "id": id})
+}
+
+// adminBreaker is the state of one circuit breaker
+type adminBreaker struct {
+	State  string `json:"state"`
+	Forced bool   `json:"forced"`
+}
+
+// handleBreakers serves GET /admin/breakers
+func (a *AdminServer) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	breakers := make(map[ServiceType]adminBreaker, len(a.client.circuitBreakers))
+	for svcType, cb := range a.client.circuitBreakers {
+		breakers[svcType] = adminBreaker{State: cb.State().String(), Forced: cb.Forced()}
+	}
+	writeJSON(w, http.StatusOK, breakers)
+}
+
+// handleBreakerAction serves POST /admin/breakers/{service}/{open,close}
+func (a *AdminServer) handleBreakerAction(w http.ResponseWriter, r *http.Request) {
+	service, action, ok := splitAction(r.URL.Path, "/admin/breakers/")
+	if !ok || r.Method != http.MethodPost {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	cb, exists := a.client.circuitBreakers[ServiceType(service)]
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown service"})
+		return
+	}
+
+	switch action {
+	case "open":
+		cb.ForceOpen()
+	case "close":
+		cb.Reset()
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, adminBreaker{State: cb.State().String(), Forced: cb.Forced()})
+}
+
+// adminLBStats summarizes load balancing for one service
+type adminLBStats struct {
+	Instances         int              `json:"instances"`
+	Ejected           int              `json:"ejected"`
+	ActiveConnections map[string]int64 `json:"active_connections"`
+	BulkheadInUse     int              `json:"bulkhead_in_use,omitempty"`
+	BulkheadCapacity  int              `json:"bulkhead_capacity,omitempty"`
+	TrafficSplit      *TrafficSplit    `json:"traffic_split,omitempty"`
+	CanaryRolledBack  bool             `json:"canary_rolled_back,omitempty"`
+}
+
+// handleLoadBalancing serves GET /admin/lb
+func (a *AdminServer) handleLoadBalancing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	bulkheadUsage := a.client.bulkheads.inUse()
+
+	a.registry.mu.RLock()
+	stats := make(map[ServiceType]*adminLBStats, len(a.registry.instances))
+	for svcType, instances := range a.registry.instances {
+		s := &adminLBStats{
+			Instances:         len(instances),
+			ActiveConnections: make(map[string]int64, len(instances)),
+		}
+		for _, inst := range instances {
+			s.ActiveConnections[inst.ID] = activeConnections(inst.ID)
+			if a.registry.outliers.isEjected(inst.ID) {
+				s.Ejected++
+			}
+		}
+		if usage, ok := bulkheadUsage[svcType]; ok {
+			s.BulkheadInUse, s.BulkheadCapacity = usage[0], usage[1]
+		}
+		stats[svcType] = s
+	}
+	a.registry.mu.RUnlock()
+
+	for svcType, s := range stats {
+		s.TrafficSplit, s.CanaryRolledBack, _ = a.registry.GetTrafficSplit(svcType)
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleFlush serves POST /admin/cache/flush
+func (a *AdminServer) handleFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	a.registry.FlushInstanceCache()
+	writeJSON(w, http.StatusOK, map[string]string{"status": "flushed"})
+}
+
+// handleFaults serves GET and PUT /admin/faults
+func (a *AdminServer) handleFaults(w http.ResponseWriter, r *http.Request) {
+	faults := a.client.Faults()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var rules []*FaultRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if err := faults.SetRules(rules); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled": faults.Enabled(),
+		"rules":   faults.Rules(),
+	})
+}
+
+// handleFaultToggle serves POST /admin/faults/{enable,disable}
+func (a *AdminServer) handleFaultToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/admin/faults/") {
+	case "enable":
+		a.client.Faults().Enable()
+	case "disable":
+		a.client.Faults().Disable()
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": a.client.Faults().Enabled()})
+}
+
+// handleDependencies serves GET /admin/dependencies. ?service= limits the
+// graph to that service's blast radius and ?format=dot returns Graphviz.
+func (a *AdminServer) handleDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	graph, err := a.registry.DependencyGraph(r.Context())
+	if err != nil {
+		if errors.Is(err, ErrDependencyGraphUnavailable) {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		a.logger.Error("failed to load dependency graph", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load dependency graph"})
+		return
+	}
+
+	if service := r.URL.Query().Get("service"); service != "" {
+		graph = graph.BlastRadius(ServiceType(service))
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, graph)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(graph.DOT()))
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be json or dot"})
+	}
+}
+
+// handleConfig serves PUT /admin/config, publishing a runtime configuration
+// change to every instance. The author is the authenticated caller.
+func (a *AdminServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if a.registry.redis == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "config control channel requires Redis"})
+		return
+	}
+
+	var update ConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	update.Author = IdentityFromContext(r.Context()).UserID
+
+	if err := PublishConfigUpdate(r.Context(), a.registry.redis, &update); err != nil {
+		if errors.Is(err, ErrInvalidConfigUpdate) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		a.logger.Error("failed to publish config update", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to publish config update"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "published", "changes": update.changes()})
+}
+
+// handleConfigAudit serves GET /admin/config/audit
+func (a *AdminServer) handleConfigAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if a.registry.redis == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "config control channel requires Redis"})
+		return
+	}
+
+	entries, err := ConfigAudit(r.Context(), a.registry.redis, 100)
+	if err != nil {
+		a.logger.Error("failed to load config audit log", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load config audit log"})
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// activeConnections returns in-flight requests to an instance from this process
+func activeConnections(instanceID string) int64 {
+	if countI, ok := connectionCounts.Load(instanceID); ok {
+		return atomic.LoadInt64(countI.(*int64))
+	}
+	return 0
+}
+
+// splitAction parses "{prefix}{name}/{action}"
+func splitAction(path, prefix string) (string, string, bool) {
+	name, action, ok := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	if !ok || name == "" || action == "" {
+		return "", "", false
+	}
+	return name, action, true
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
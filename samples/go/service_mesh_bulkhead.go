@@ -0,0 +1,99 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// BulkheadConfig limits concurrent requests to one downstream service
+type BulkheadConfig struct {
+	MaxConcurrent int           // In-flight attempts allowed
+	QueueTimeout  time.Duration // How long to wait for a slot before rejecting
+}
+
+// DefaultBulkheadConfigs returns per-service limits sized so slow AI
+// services can't starve the auth and crisis paths. Services without an
+// entry are not limited.
+func DefaultBulkheadConfigs() map[ServiceType]*BulkheadConfig {
+	return map[ServiceType]*BulkheadConfig{
+		ServiceTypeGeneration: {MaxConcurrent: 32, QueueTimeout: 100 * time.Millisecond},
+		ServiceTypeEmbedding:  {MaxConcurrent: 64, QueueTimeout: 50 * time.Millisecond},
+		ServiceTypeVoice:      {MaxConcurrent: 32, QueueTimeout: 100 * time.Millisecond},
+		ServiceTypeAnalytics:  {MaxConcurrent: 16, QueueTimeout: 0},
+		ServiceTypeAuth:       {MaxConcurrent: 128, QueueTimeout: 250 * time.Millisecond},
+		ServiceTypeCrisis:     {MaxConcurrent: 128, QueueTimeout: time.Second},
+	}
+}
+
+// ErrBulkheadFull is returned when a service's concurrency limit is reached
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// bulkhead is a semaphore guarding one service
+type bulkhead struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// bulkheads holds the per-service semaphores. The map is built once at
+// construction and read without locking.
+type bulkheads map[ServiceType]*bulkhead
+
+// newBulkheads creates semaphores for each configured service
+func newBulkheads(configs map[ServiceType]*BulkheadConfig) bulkheads {
+	b := make(bulkheads, len(configs))
+	for svcType, config := range configs {
+		if config == nil || config.MaxConcurrent <= 0 {
+			continue
+		}
+		b[svcType] = &bulkhead{
+			slots:        make(chan struct{}, config.MaxConcurrent),
+			queueTimeout: config.QueueTimeout,
+		}
+	}
+	return b
+}
+
+// acquire takes a slot for serviceType, waiting up to the queue timeout.
+// The returned release func must be called when the attempt finishes.
+func (b bulkheads) acquire(ctx context.Context, serviceType ServiceType) (func(), error) {
+	bh, ok := b[serviceType]
+	if !ok {
+		return func() {}, nil
+	}
+
+	release := func() { <-bh.slots }
+
+	select {
+	case bh.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if bh.queueTimeout <= 0 {
+		metrics.bulkheadRejections.WithLabelValues(string(serviceType)).Inc()
+		return nil, ErrBulkheadFull
+	}
+
+	timer := time.NewTimer(bh.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case bh.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		metrics.bulkheadRejections.WithLabelValues(string(serviceType)).Inc()
+		return nil, ErrBulkheadFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// inUse returns the occupied and total slots per limited service
+func (b bulkheads) inUse() map[ServiceType][2]int {
+	usage := make(map[ServiceType][2]int, len(b))
+	for svcType, bh := range b {
+		usage[svcType] = [2]int{len(bh.slots), cap(bh.slots)}
+	}
+	return usage
+}
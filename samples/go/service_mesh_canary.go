@@ -0,0 +1,200 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TrafficSplit routes a service's traffic across versions by weight, with
+// automatic rollback when the canary version misbehaves
+type TrafficSplit struct {
+	ServiceType   ServiceType    `json:"service_type"`
+	Weights       map[string]int `json:"weights"`        // Version -> relative weight, e.g. {"1.4": 95, "1.5": 5}
+	StableVersion string         `json:"stable_version"` // Receives all traffic after rollback
+	CanaryVersion string         `json:"canary_version"` // Version whose error rate is watched
+	MaxErrorRate  float64        `json:"max_error_rate"` // Rollback threshold, e.g. 0.05
+	MinRequests   int            `json:"min_requests"`   // Canary requests needed before judging
+	Window        time.Duration  `json:"window"`         // Error-rate evaluation window
+}
+
+// ErrInvalidTrafficSplit is returned when a split fails validation
+var ErrInvalidTrafficSplit = errors.New("invalid traffic split")
+
+// Validate checks a traffic split for consistency
+func (t *TrafficSplit) Validate() error {
+	if t.ServiceType == "" {
+		return fmt.Errorf("%w: service type required", ErrInvalidTrafficSplit)
+	}
+	total := 0
+	for version, weight := range t.Weights {
+		if weight < 0 {
+			return fmt.Errorf("%w: negative weight for %s", ErrInvalidTrafficSplit, version)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: weights must sum to more than zero", ErrInvalidTrafficSplit)
+	}
+	if t.CanaryVersion != "" {
+		if _, ok := t.Weights[t.CanaryVersion]; !ok {
+			return fmt.Errorf("%w: canary version %s has no weight", ErrInvalidTrafficSplit, t.CanaryVersion)
+		}
+		if t.StableVersion == "" || t.StableVersion == t.CanaryVersion {
+			return fmt.Errorf("%w: a distinct stable version is required for rollback", ErrInvalidTrafficSplit)
+		}
+	}
+	return nil
+}
+
+// splitState tracks canary health for an active split
+type splitState struct {
+	split       *TrafficSplit
+	windowStart time.Time
+	requests    int
+	failures    int
+	rolledBack  bool
+}
+
+// trafficSplitter holds the active traffic splits per service type
+type trafficSplitter struct {
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	splits map[ServiceType]*splitState
+}
+
+// newTrafficSplitter creates an empty splitter
+func newTrafficSplitter(logger *slog.Logger) *trafficSplitter {
+	return &trafficSplitter{
+		logger: logger,
+		splits: make(map[ServiceType]*splitState),
+	}
+}
+
+// SetTrafficSplit installs or replaces the traffic split for a service
+func (r *ServiceRegistry) SetTrafficSplit(split *TrafficSplit) error {
+	if err := split.Validate(); err != nil {
+		return err
+	}
+
+	r.splits.mu.Lock()
+	r.splits.splits[split.ServiceType] = &splitState{split: split, windowStart: time.Now()}
+	r.splits.mu.Unlock()
+
+	r.logger.Info("traffic split updated",
+		slog.String("type", string(split.ServiceType)),
+		slog.Any("weights", split.Weights),
+	)
+	return nil
+}
+
+// ClearTrafficSplit removes the traffic split for a service
+func (r *ServiceRegistry) ClearTrafficSplit(serviceType ServiceType) {
+	r.splits.mu.Lock()
+	delete(r.splits.splits, serviceType)
+	r.splits.mu.Unlock()
+}
+
+// GetTrafficSplit returns the active split for a service and whether it
+// has been rolled back
+func (r *ServiceRegistry) GetTrafficSplit(serviceType ServiceType) (*TrafficSplit, bool, bool) {
+	r.splits.mu.RLock()
+	defer r.splits.mu.RUnlock()
+
+	state, ok := r.splits.splits[serviceType]
+	if !ok {
+		return nil, false, false
+	}
+	return state.split, state.rolledBack, true
+}
+
+// apply narrows candidates to one version chosen by weight. Versions with
+// no available instances are skipped so a split never blackholes traffic.
+func (s *trafficSplitter) apply(serviceType ServiceType, instances []*ServiceInstance) []*ServiceInstance {
+	s.mu.RLock()
+	state, ok := s.splits[serviceType]
+	var weights map[string]int
+	if ok {
+		weights = state.split.Weights
+		if state.rolledBack {
+			weights = map[string]int{state.split.StableVersion: 1}
+		}
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		return instances
+	}
+
+	byVersion := make(map[string][]*ServiceInstance)
+	for _, inst := range instances {
+		byVersion[inst.Version] = append(byVersion[inst.Version], inst)
+	}
+
+	total := 0
+	for version, weight := range weights {
+		if len(byVersion[version]) > 0 {
+			total += weight
+		}
+	}
+	if total == 0 {
+		return instances
+	}
+
+	pick := rand.Intn(total)
+	for version, weight := range weights {
+		if len(byVersion[version]) == 0 {
+			continue
+		}
+		pick -= weight
+		if pick < 0 {
+			return byVersion[version]
+		}
+	}
+
+	return instances
+}
+
+// record tracks canary outcomes and rolls back when the error rate is exceeded
+func (s *trafficSplitter) record(inst *ServiceInstance, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.splits[inst.Type]
+	if !ok || state.rolledBack || state.split.CanaryVersion == "" || inst.Version != state.split.CanaryVersion {
+		return
+	}
+
+	if state.split.Window > 0 && time.Since(state.windowStart) > state.split.Window {
+		state.windowStart = time.Now()
+		state.requests = 0
+		state.failures = 0
+	}
+
+	state.requests++
+	if err != nil {
+		state.failures++
+	}
+
+	if state.requests < state.split.MinRequests {
+		return
+	}
+
+	errorRate := float64(state.failures) / float64(state.requests)
+	if errorRate <= state.split.MaxErrorRate {
+		return
+	}
+
+	state.rolledBack = true
+	s.logger.Error("canary rolled back",
+		slog.String("type", string(inst.Type)),
+		slog.String("canary_version", state.split.CanaryVersion),
+		slog.String("stable_version", state.split.StableVersion),
+		slog.Float64("error_rate", errorRate),
+		slog.Int("requests", state.requests),
+	)
+}
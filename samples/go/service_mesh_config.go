@@ -0,0 +1,397 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys for the configuration control channel
+const (
+	ConfigChannel       = "mesh:config:updates"
+	configAuditKey      = "mesh:config:audit"
+	configAuditRetained = 1000
+)
+
+// loadBalanceStrategies maps strategy names accepted in updates
+var loadBalanceStrategies = map[string]LoadBalanceStrategy{
+	"round_robin":       LoadBalanceRoundRobin,
+	"random":            LoadBalanceRandom,
+	"weighted":          LoadBalanceWeighted,
+	"least_connections": LoadBalanceLeastConnections,
+	"least_latency":     LoadBalanceLeastLatency,
+}
+
+// BreakerUpdate changes circuit breaker thresholds
+type BreakerUpdate struct {
+	Services    []ServiceType  `json:"services,omitempty"` // Empty applies to every service breaker
+	MaxFailures *int           `json:"max_failures,omitempty"`
+	Timeout     *time.Duration `json:"timeout,omitempty"`
+	HalfOpenMax *int           `json:"half_open_max,omitempty"`
+}
+
+// ConfigUpdate is a runtime change to client and registry settings. Nil
+// fields are left unchanged.
+type ConfigUpdate struct {
+	Author string `json:"author"`
+	Reason string `json:"reason,omitempty"`
+
+	HTTPTimeout    *time.Duration `json:"http_timeout,omitempty"`
+	MaxRetries     *int           `json:"max_retries,omitempty"`
+	RetryBackoff   *time.Duration `json:"retry_backoff,omitempty"`
+	Strategy       *string        `json:"strategy,omitempty"`
+	CircuitBreaker *BreakerUpdate `json:"circuit_breaker,omitempty"`
+
+	HealthCheckInterval *time.Duration `json:"health_check_interval,omitempty"`
+	HealthCheckTimeout  *time.Duration `json:"health_check_timeout,omitempty"`
+	UnhealthyThreshold  *int           `json:"unhealthy_threshold,omitempty"`
+	HealthyThreshold    *int           `json:"healthy_threshold,omitempty"`
+}
+
+// ErrInvalidConfigUpdate is returned when an update fails validation
+var ErrInvalidConfigUpdate = errors.New("invalid config update")
+
+// Validate checks an update before it is published or applied
+func (u *ConfigUpdate) Validate() error {
+	if u.Author == "" {
+		return fmt.Errorf("%w: author required", ErrInvalidConfigUpdate)
+	}
+	if u.HTTPTimeout != nil && *u.HTTPTimeout <= 0 {
+		return fmt.Errorf("%w: http timeout must be positive", ErrInvalidConfigUpdate)
+	}
+	if u.MaxRetries != nil && *u.MaxRetries < 0 {
+		return fmt.Errorf("%w: max retries cannot be negative", ErrInvalidConfigUpdate)
+	}
+	if u.RetryBackoff != nil && *u.RetryBackoff < 0 {
+		return fmt.Errorf("%w: retry backoff cannot be negative", ErrInvalidConfigUpdate)
+	}
+	if u.Strategy != nil {
+		if _, ok := loadBalanceStrategies[*u.Strategy]; !ok {
+			return fmt.Errorf("%w: unknown strategy %q", ErrInvalidConfigUpdate, *u.Strategy)
+		}
+	}
+	if cb := u.CircuitBreaker; cb != nil {
+		if cb.MaxFailures != nil && *cb.MaxFailures < 1 {
+			return fmt.Errorf("%w: breaker max failures must be at least 1", ErrInvalidConfigUpdate)
+		}
+		if cb.Timeout != nil && *cb.Timeout <= 0 {
+			return fmt.Errorf("%w: breaker timeout must be positive", ErrInvalidConfigUpdate)
+		}
+		if cb.HalfOpenMax != nil && *cb.HalfOpenMax < 1 {
+			return fmt.Errorf("%w: breaker half-open max must be at least 1", ErrInvalidConfigUpdate)
+		}
+	}
+	if u.HealthCheckInterval != nil && *u.HealthCheckInterval < time.Second {
+		return fmt.Errorf("%w: health check interval must be at least 1s", ErrInvalidConfigUpdate)
+	}
+	if u.HealthCheckTimeout != nil && *u.HealthCheckTimeout <= 0 {
+		return fmt.Errorf("%w: health check timeout must be positive", ErrInvalidConfigUpdate)
+	}
+	if u.UnhealthyThreshold != nil && *u.UnhealthyThreshold < 1 {
+		return fmt.Errorf("%w: unhealthy threshold must be at least 1", ErrInvalidConfigUpdate)
+	}
+	if u.HealthyThreshold != nil && *u.HealthyThreshold < 1 {
+		return fmt.Errorf("%w: healthy threshold must be at least 1", ErrInvalidConfigUpdate)
+	}
+	return nil
+}
+
+// changes lists the settings an update touches as "field=value"
+func (u *ConfigUpdate) changes() []string {
+	var changes []string
+	add := func(field string, value any) {
+		changes = append(changes, fmt.Sprintf("%s=%v", field, value))
+	}
+
+	if u.HTTPTimeout != nil {
+		add("http_timeout", *u.HTTPTimeout)
+	}
+	if u.MaxRetries != nil {
+		add("max_retries", *u.MaxRetries)
+	}
+	if u.RetryBackoff != nil {
+		add("retry_backoff", *u.RetryBackoff)
+	}
+	if u.Strategy != nil {
+		add("strategy", *u.Strategy)
+	}
+	if cb := u.CircuitBreaker; cb != nil {
+		if cb.MaxFailures != nil {
+			add("breaker.max_failures", *cb.MaxFailures)
+		}
+		if cb.Timeout != nil {
+			add("breaker.timeout", *cb.Timeout)
+		}
+		if cb.HalfOpenMax != nil {
+			add("breaker.half_open_max", *cb.HalfOpenMax)
+		}
+		if len(cb.Services) > 0 {
+			add("breaker.services", cb.Services)
+		}
+	}
+	if u.HealthCheckInterval != nil {
+		add("health_check_interval", *u.HealthCheckInterval)
+	}
+	if u.HealthCheckTimeout != nil {
+		add("health_check_timeout", *u.HealthCheckTimeout)
+	}
+	if u.UnhealthyThreshold != nil {
+		add("unhealthy_threshold", *u.UnhealthyThreshold)
+	}
+	if u.HealthyThreshold != nil {
+		add("healthy_threshold", *u.HealthyThreshold)
+	}
+	return changes
+}
+
+// ConfigAuditEntry records who published a configuration change
+type ConfigAuditEntry struct {
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author"`
+	Reason  string    `json:"reason,omitempty"`
+	Changes []string  `json:"changes"`
+}
+
+// PublishConfigUpdate validates an update, records it in the audit log, and
+// broadcasts it to every watching instance
+func PublishConfigUpdate(ctx context.Context, client *redis.Client, update *ConfigUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config update: %w", err)
+	}
+
+	audit, err := json.Marshal(&ConfigAuditEntry{
+		Time:    time.Now().UTC(),
+		Author:  update.Author,
+		Reason:  update.Reason,
+		Changes: update.changes(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal config audit entry: %w", err)
+	}
+
+	// Audit first so no change reaches the mesh without a record
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, configAuditKey, audit)
+		pipe.LTrim(ctx, configAuditKey, 0, configAuditRetained-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record config audit entry: %w", err)
+	}
+
+	if err := client.Publish(ctx, ConfigChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish config update: %w", err)
+	}
+	return nil
+}
+
+// ConfigAudit returns the most recent configuration changes, newest first
+func ConfigAudit(ctx context.Context, client *redis.Client, limit int64) ([]*ConfigAuditEntry, error) {
+	raw, err := client.LRange(ctx, configAuditKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config audit log: %w", err)
+	}
+
+	entries := make([]*ConfigAuditEntry, 0, len(raw))
+	for _, item := range raw {
+		var entry ConfigAuditEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// ConfigWatcher applies configuration updates from the control channel to
+// a registry and client
+type ConfigWatcher struct {
+	redis    *redis.Client
+	registry *ServiceRegistry
+	client   *ServiceClient
+	logger   *slog.Logger
+	cancel   context.CancelFunc
+}
+
+// NewConfigWatcher creates a watcher for the given registry and client
+func NewConfigWatcher(redis *redis.Client, registry *ServiceRegistry, client *ServiceClient, logger *slog.Logger) *ConfigWatcher {
+	return &ConfigWatcher{
+		redis:    redis,
+		registry: registry,
+		client:   client,
+		logger:   logger,
+	}
+}
+
+// Start subscribes to the control channel and applies updates until Stop
+func (w *ConfigWatcher) Start(ctx context.Context) error {
+	ctx, w.cancel = context.WithCancel(ctx)
+
+	pubsub := w.redis.Subscribe(ctx, ConfigChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("failed to subscribe to config channel: %w", err)
+	}
+
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				w.handle([]byte(msg.Payload))
+			}
+		}
+	}()
+
+	w.logger.Info("config watcher started", slog.String("channel", ConfigChannel))
+	return nil
+}
+
+// Stop stops applying updates
+func (w *ConfigWatcher) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// LoadFile applies an update from a JSON file, e.g. a mounted ConfigMap
+func (w *ConfigWatcher) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var update ConfigUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return w.Apply(&update)
+}
+
+// handle decodes and applies one control channel message
+func (w *ConfigWatcher) handle(payload []byte) {
+	var update ConfigUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		w.logger.Error("invalid config update message", slog.String("error", err.Error()))
+		return
+	}
+	if err := w.Apply(&update); err != nil {
+		w.logger.Error("config update rejected",
+			slog.String("author", update.Author),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// Apply validates and applies an update. Invalid updates change nothing.
+func (w *ConfigWatcher) Apply(update *ConfigUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	if cb := update.CircuitBreaker; cb != nil {
+		for _, svcType := range cb.Services {
+			if _, ok := w.client.circuitBreakers[svcType]; !ok {
+				return fmt.Errorf("%w: no circuit breaker for %s", ErrInvalidConfigUpdate, svcType)
+			}
+		}
+	}
+
+	c := w.client
+	if update.HTTPTimeout != nil {
+		c.timeouts.setFallback(*update.HTTPTimeout)
+	}
+	c.mu.Lock()
+	if update.MaxRetries != nil {
+		c.maxRetries = *update.MaxRetries
+	}
+	if update.RetryBackoff != nil {
+		c.retryBackoff = *update.RetryBackoff
+	}
+	if update.Strategy != nil {
+		c.strategy = loadBalanceStrategies[*update.Strategy]
+	}
+	c.mu.Unlock()
+
+	if cb := update.CircuitBreaker; cb != nil {
+		services := cb.Services
+		if len(services) == 0 {
+			for svcType := range c.circuitBreakers {
+				services = append(services, svcType)
+			}
+		}
+		for _, svcType := range services {
+			c.circuitBreakers[svcType].reconfigure(cb)
+		}
+	}
+
+	r := w.registry
+	r.mu.Lock()
+	if update.HealthCheckInterval != nil {
+		r.healthCheckInterval = *update.HealthCheckInterval
+	}
+	if update.HealthCheckTimeout != nil {
+		r.healthCheckTimeout = *update.HealthCheckTimeout
+	}
+	r.mu.Unlock()
+	r.health.setThresholds(update.UnhealthyThreshold, update.HealthyThreshold)
+
+	w.logger.Warn("mesh configuration updated",
+		slog.String("author", update.Author),
+		slog.String("reason", update.Reason),
+		slog.Any("changes", update.changes()),
+	)
+	return nil
+}
+
+// reconfigure applies new thresholds; the current state is kept
+func (cb *CircuitBreaker) reconfigure(update *BreakerUpdate) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if update.MaxFailures != nil {
+		cb.maxFailures = *update.MaxFailures
+	}
+	if update.Timeout != nil {
+		cb.timeout = *update.Timeout
+	}
+	if update.HalfOpenMax != nil {
+		cb.halfOpenMax = *update.HalfOpenMax
+	}
+}
+
+// setThresholds changes the check streaks needed to change status
+func (t *healthTracker) setThresholds(unhealthy, healthy *int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if unhealthy != nil {
+		t.unhealthyThreshold = *unhealthy
+	}
+	if healthy != nil {
+		t.healthyThreshold = *healthy
+	}
+}
+
+// healthCheckSettings returns the current health check interval and timeout
+func (r *ServiceRegistry) healthCheckSettings() (time.Duration, time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthCheckInterval, r.healthCheckTimeout
+}
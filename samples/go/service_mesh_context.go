@@ -0,0 +1,235 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Call metadata propagated on every inter-service request. gRPC calls carry
+// the same keys in metadata; their deadline travels as grpc-timeout.
+const (
+	HeaderCallerService = "X-Caller-Service"
+	HeaderDeadline      = "X-Request-Deadline-Ms" // Remaining budget in milliseconds
+	HeaderPriority      = "X-Request-Priority"
+	HeaderTenantID      = "X-Tenant-ID"
+)
+
+// unknownCaller is used when a call carries no caller identity
+const unknownCaller ServiceType = "unknown"
+
+// Priority ranks a request so downstream services can shed lower priority
+// work first under load
+type Priority string
+
+const (
+	PriorityLow      Priority = "low"
+	PriorityNormal   Priority = "normal"
+	PriorityHigh     Priority = "high"
+	PriorityCritical Priority = "critical" // Crisis detection and escalation
+)
+
+// valid reports whether p is a known priority
+func (p Priority) valid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityCritical:
+		return true
+	}
+	return false
+}
+
+// Context keys for call metadata
+type (
+	callerServiceCtx struct{}
+	priorityCtx      struct{}
+	tenantIDCtx      struct{}
+)
+
+// WithCallerService attributes calls made with ctx to a service
+func WithCallerService(ctx context.Context, caller ServiceType) context.Context {
+	return context.WithValue(ctx, callerServiceCtx{}, caller)
+}
+
+// CallerServiceFromContext returns the calling service, if known
+func CallerServiceFromContext(ctx context.Context) ServiceType {
+	caller, _ := ctx.Value(callerServiceCtx{}).(ServiceType)
+	return caller
+}
+
+// WithPriority sets the priority of calls made with ctx
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityCtx{}, priority)
+}
+
+// PriorityFromContext returns the request priority, defaulting to normal
+func PriorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityCtx{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// WithTenantID sets the tenant (facility) calls made with ctx belong to
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDCtx{}, tenantID)
+}
+
+// TenantIDFromContext returns the tenant ID, if any
+func TenantIDFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantIDCtx{}).(string)
+	return tenantID
+}
+
+// callerService returns the service a call is made on behalf of, falling
+// back to the locally registered instance
+func (r *ServiceRegistry) callerService(ctx context.Context) ServiceType {
+	if caller := CallerServiceFromContext(ctx); caller != "" {
+		return caller
+	}
+	if local := r.localInstance; local != nil {
+		return local.Type
+	}
+	return unknownCaller
+}
+
+// remainingBudget returns the time left before ctx's deadline in whole
+// milliseconds, never negative
+func remainingBudget(ctx context.Context) (int64, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	return ms, true
+}
+
+// setCallHeaders writes call metadata onto an outbound HTTP request
+func setCallHeaders(ctx context.Context, header http.Header, caller ServiceType) {
+	header.Set(HeaderCallerService, string(caller))
+	header.Set(HeaderPriority, string(PriorityFromContext(ctx)))
+
+	if ms, ok := remainingBudget(ctx); ok {
+		header.Set(HeaderDeadline, strconv.FormatInt(ms, 10))
+	} else {
+		header.Del(HeaderDeadline)
+	}
+	if tenantID := TenantIDFromContext(ctx); tenantID != "" {
+		header.Set(HeaderTenantID, tenantID)
+	} else {
+		header.Del(HeaderTenantID)
+	}
+}
+
+// ExtractCallHeaders returns a context carrying the call metadata of an
+// inbound HTTP request, bounded by the caller's remaining deadline budget.
+// The cancel func must be called when the request completes.
+func ExtractCallHeaders(ctx context.Context, header http.Header) (context.Context, context.CancelFunc) {
+	if caller := header.Get(HeaderCallerService); caller != "" {
+		ctx = WithCallerService(ctx, ServiceType(caller))
+	}
+	if priority := Priority(header.Get(HeaderPriority)); priority.valid() {
+		ctx = WithPriority(ctx, priority)
+	}
+	if tenantID := header.Get(HeaderTenantID); tenantID != "" {
+		ctx = WithTenantID(ctx, tenantID)
+	}
+
+	if ms, err := strconv.ParseInt(header.Get(HeaderDeadline), 10, 64); err == nil && ms >= 0 {
+		return context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+	}
+	return context.WithCancel(ctx)
+}
+
+// CallMetadataMiddleware applies propagated call metadata to inbound
+// requests so handlers work within the caller's remaining budget instead of
+// their own timeout. Requests whose budget is already spent are rejected.
+func CallMetadataMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := ExtractCallHeaders(r.Context(), r.Header)
+		defer cancel()
+
+		if ctx.Err() != nil {
+			http.Error(w, "deadline budget exhausted", http.StatusGatewayTimeout)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setCallMetadata writes call metadata into outbound gRPC metadata
+func setCallMetadata(ctx context.Context, md metadata.MD, caller ServiceType) {
+	md.Set(HeaderCallerService, string(caller))
+	md.Set(HeaderPriority, string(PriorityFromContext(ctx)))
+	md.Delete(HeaderDeadline)
+
+	if tenantID := TenantIDFromContext(ctx); tenantID != "" {
+		md.Set(HeaderTenantID, tenantID)
+	} else {
+		md.Delete(HeaderTenantID)
+	}
+}
+
+// extractCallMetadata returns a context carrying call metadata from
+// inbound gRPC metadata. gRPC already applies the caller's deadline.
+func extractCallMetadata(ctx context.Context, md metadata.MD) context.Context {
+	if values := md.Get(HeaderCallerService); len(values) > 0 && values[0] != "" {
+		ctx = WithCallerService(ctx, ServiceType(values[0]))
+	}
+	if values := md.Get(HeaderPriority); len(values) > 0 && Priority(values[0]).valid() {
+		ctx = WithPriority(ctx, Priority(values[0]))
+	}
+	if values := md.Get(HeaderTenantID); len(values) > 0 && values[0] != "" {
+		ctx = WithTenantID(ctx, values[0])
+	}
+	return ctx
+}
+
+// outgoingWithCallMetadata adds call metadata to a context's outgoing metadata
+func (r *ServiceRegistry) outgoingWithCallMetadata(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	setCallMetadata(ctx, md, r.callerService(ctx))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// callMetadataUnaryClientInterceptor propagates call metadata on unary RPCs
+func (r *ServiceRegistry) callMetadataUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(r.outgoingWithCallMetadata(ctx), method, req, reply, cc, opts...)
+}
+
+// callMetadataStreamClientInterceptor propagates call metadata on streams
+func (r *ServiceRegistry) callMetadataStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(r.outgoingWithCallMetadata(ctx), desc, cc, method, opts...)
+}
+
+// CallMetadataUnaryInterceptor applies propagated call metadata to inbound
+// unary RPCs
+func CallMetadataUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return handler(extractCallMetadata(ctx, md), req)
+}
+
+// callMetadataServerStream overrides a server stream's context
+type callMetadataServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying call metadata
+func (s *callMetadataServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// CallMetadataStreamInterceptor applies propagated call metadata to inbound
+// streaming RPCs
+func CallMetadataStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	return handler(srv, &callMetadataServerStream{ServerStream: ss, ctx: extractCallMetadata(ss.Context(), md)})
+}
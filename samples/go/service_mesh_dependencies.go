@@ -0,0 +1,274 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis hashes holding the aggregated graph, keyed by "caller>callee"
+const (
+	dependencyCallsKey    = "mesh:dependencies:calls"
+	dependencyErrorsKey   = "mesh:dependencies:errors"
+	dependencyLastSeenKey = "mesh:dependencies:last_seen"
+)
+
+// dependencyFlushInterval is how often local counts are pushed to Redis
+const dependencyFlushInterval = 10 * time.Second
+
+// ErrDependencyGraphUnavailable is returned when the registry has no Redis
+// backend to aggregate the graph in
+var ErrDependencyGraphUnavailable = errors.New("dependency graph requires Redis")
+
+// DependencyEdge is an observed caller -> callee relationship
+type DependencyEdge struct {
+	Caller   ServiceType `json:"caller"`
+	Callee   ServiceType `json:"callee"`
+	Calls    int64       `json:"calls"`
+	Errors   int64       `json:"errors"`
+	LastSeen time.Time   `json:"last_seen"`
+}
+
+// DependencyGraph is the mesh-wide service call graph
+type DependencyGraph struct {
+	Services []ServiceType    `json:"services"`
+	Edges    []DependencyEdge `json:"edges"`
+}
+
+// dependencyEdge identifies an edge in the pending counts
+type dependencyEdge struct {
+	caller ServiceType
+	callee ServiceType
+}
+
+// field returns the Redis hash field for an edge
+func (e dependencyEdge) field() string {
+	return string(e.caller) + ">" + string(e.callee)
+}
+
+// edgeCounts are calls observed locally since the last flush
+type edgeCounts struct {
+	calls  int64
+	errors int64
+}
+
+// dependencyRecorder batches observed calls and periodically adds them to
+// the shared graph so every client contributes to one view
+type dependencyRecorder struct {
+	redis  *redis.Client
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	pending map[dependencyEdge]*edgeCounts
+}
+
+// newDependencyRecorder creates a recorder writing to Redis
+func newDependencyRecorder(client *redis.Client, logger *slog.Logger) *dependencyRecorder {
+	return &dependencyRecorder{
+		redis:   client,
+		logger:  logger,
+		pending: make(map[dependencyEdge]*edgeCounts),
+	}
+}
+
+// record counts one call from caller to callee
+func (d *dependencyRecorder) record(caller, callee ServiceType, err error) {
+	edge := dependencyEdge{caller: caller, callee: callee}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts, ok := d.pending[edge]
+	if !ok {
+		counts = &edgeCounts{}
+		d.pending[edge] = counts
+	}
+	counts.calls++
+	if err != nil {
+		counts.errors++
+	}
+}
+
+// flush adds pending counts to Redis. Counts are kept for the next flush
+// when Redis is unavailable.
+func (d *dependencyRecorder) flush(ctx context.Context) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[dependencyEdge]*edgeCounts)
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	_, err := d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for edge, counts := range pending {
+			field := edge.field()
+			pipe.HIncrBy(ctx, dependencyCallsKey, field, counts.calls)
+			if counts.errors > 0 {
+				pipe.HIncrBy(ctx, dependencyErrorsKey, field, counts.errors)
+			}
+			pipe.HSet(ctx, dependencyLastSeenKey, field, now)
+		}
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	d.logger.Warn("failed to flush dependency graph", slog.String("error", err.Error()))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for edge, counts := range pending {
+		if current, ok := d.pending[edge]; ok {
+			current.calls += counts.calls
+			current.errors += counts.errors
+		} else {
+			d.pending[edge] = counts
+		}
+	}
+}
+
+// flushDependencies periodically pushes observed calls to Redis
+func (r *ServiceRegistry) flushDependencies() {
+	ticker := time.NewTicker(dependencyFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.dependencies.flush(r.ctx)
+		}
+	}
+}
+
+// recordDependency notes a call between services for the dependency graph
+func (r *ServiceRegistry) recordDependency(caller, callee ServiceType, err error) {
+	if r.dependencies != nil {
+		r.dependencies.record(caller, callee, err)
+	}
+}
+
+// DependencyGraph loads the aggregated call graph from Redis
+func (r *ServiceRegistry) DependencyGraph(ctx context.Context) (*DependencyGraph, error) {
+	if r.redis == nil {
+		return nil, ErrDependencyGraphUnavailable
+	}
+
+	calls, err := r.redis.HGetAll(ctx, dependencyCallsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dependency graph: %w", err)
+	}
+	errs, err := r.redis.HGetAll(ctx, dependencyErrorsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dependency graph: %w", err)
+	}
+	lastSeen, err := r.redis.HGetAll(ctx, dependencyLastSeenKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dependency graph: %w", err)
+	}
+
+	graph := &DependencyGraph{Edges: make([]DependencyEdge, 0, len(calls))}
+	for field, value := range calls {
+		caller, callee, ok := strings.Cut(field, ">")
+		if !ok {
+			continue
+		}
+		edge := DependencyEdge{Caller: ServiceType(caller), Callee: ServiceType(callee)}
+		edge.Calls, _ = strconv.ParseInt(value, 10, 64)
+		edge.Errors, _ = strconv.ParseInt(errs[field], 10, 64)
+		if seen, err := strconv.ParseInt(lastSeen[field], 10, 64); err == nil {
+			edge.LastSeen = time.Unix(seen, 0).UTC()
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	graph.normalize()
+	return graph, nil
+}
+
+// normalize sorts edges and derives the service list from them
+func (g *DependencyGraph) normalize() {
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Caller != g.Edges[j].Caller {
+			return g.Edges[i].Caller < g.Edges[j].Caller
+		}
+		return g.Edges[i].Callee < g.Edges[j].Callee
+	})
+
+	seen := make(map[ServiceType]bool)
+	g.Services = g.Services[:0]
+	for _, edge := range g.Edges {
+		for _, svc := range []ServiceType{edge.Caller, edge.Callee} {
+			if !seen[svc] {
+				seen[svc] = true
+				g.Services = append(g.Services, svc)
+			}
+		}
+	}
+	sort.Slice(g.Services, func(i, j int) bool { return g.Services[i] < g.Services[j] })
+}
+
+// BlastRadius returns the subgraph of services that depend on target,
+// directly or transitively, i.e. what a change to target can break
+func (g *DependencyGraph) BlastRadius(target ServiceType) *DependencyGraph {
+	callers := make(map[ServiceType][]DependencyEdge)
+	for _, edge := range g.Edges {
+		callers[edge.Callee] = append(callers[edge.Callee], edge)
+	}
+
+	sub := &DependencyGraph{}
+	visited := map[ServiceType]bool{target: true}
+	queue := []ServiceType{target}
+	for len(queue) > 0 {
+		svc := queue[0]
+		queue = queue[1:]
+		for _, edge := range callers[svc] {
+			sub.Edges = append(sub.Edges, edge)
+			if !visited[edge.Caller] {
+				visited[edge.Caller] = true
+				queue = append(queue, edge.Caller)
+			}
+		}
+	}
+
+	sub.normalize()
+	if len(sub.Services) == 0 {
+		sub.Services = []ServiceType{target}
+	}
+	return sub
+}
+
+// DOT renders the graph in Graphviz format. Edges that saw errors are red.
+func (g *DependencyGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph mesh {\n")
+	b.WriteString("\trankdir=LR;\n")
+	for _, svc := range g.Services {
+		fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(string(svc)))
+	}
+	for _, edge := range g.Edges {
+		label := fmt.Sprintf("%d calls", edge.Calls)
+		attrs := ""
+		if edge.Errors > 0 {
+			label += fmt.Sprintf(", %d errors", edge.Errors)
+			attrs = ", color=red"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s%s];\n",
+			strconv.Quote(string(edge.Caller)), strconv.Quote(string(edge.Callee)), strconv.Quote(label), attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
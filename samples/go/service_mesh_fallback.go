@@ -0,0 +1,231 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FallbackDiscoveryConfig configures discovery used while the registry
+// backend is unreachable. SRV records are tried first, then the static file.
+type FallbackDiscoveryConfig struct {
+	StaleAfter    time.Duration // Engage when the instance cache is older than this
+	CacheTTL      time.Duration // How long resolved instances are reused
+	LookupTimeout time.Duration // Bound on each DNS lookup
+
+	// SRV lookups query _{SRVService}._{SRVProto}.{service}.{SRVDomain}
+	SRVDomain  string // e.g. "therapeutic.svc.cluster.local"; empty disables SRV
+	SRVService string
+	SRVProto   string
+
+	// StaticFile is a JSON map of service type to instances
+	StaticFile string
+}
+
+// DefaultFallbackDiscoveryConfig returns default configuration. A SRVDomain
+// or StaticFile must still be supplied.
+func DefaultFallbackDiscoveryConfig() *FallbackDiscoveryConfig {
+	return &FallbackDiscoveryConfig{
+		StaleAfter:    30 * time.Second,
+		CacheTTL:      30 * time.Second,
+		LookupTimeout: 2 * time.Second,
+		SRVService:    "http",
+		SRVProto:      "tcp",
+	}
+}
+
+// fallbackEntry is a resolved instance list with its cache expiry
+type fallbackEntry struct {
+	instances []*ServiceInstance
+	expires   time.Time
+}
+
+// fallbackResolver answers instance lookups from DNS SRV or a static file
+type fallbackResolver struct {
+	config   *FallbackDiscoveryConfig
+	resolver *net.Resolver
+	logger   *slog.Logger
+	engaged  atomic.Bool
+
+	mu     sync.Mutex
+	cache  map[ServiceType]*fallbackEntry
+	static map[ServiceType][]*ServiceInstance
+	loaded bool
+}
+
+// newFallbackResolver creates a resolver; a nil config disables fallback
+func newFallbackResolver(config *FallbackDiscoveryConfig, logger *slog.Logger) *fallbackResolver {
+	if config == nil || (config.SRVDomain == "" && config.StaticFile == "") {
+		return nil
+	}
+	return &fallbackResolver{
+		config:   config,
+		resolver: net.DefaultResolver,
+		logger:   logger,
+		cache:    make(map[ServiceType]*fallbackEntry),
+	}
+}
+
+// active reports whether the registry cache is stale enough to fall back,
+// logging when fallback is first engaged
+func (f *fallbackResolver) active(lastRefresh time.Time) bool {
+	if time.Since(lastRefresh) <= f.config.StaleAfter {
+		return false
+	}
+	if !f.engaged.Swap(true) {
+		f.logger.Warn("registry stale, using fallback discovery",
+			slog.Time("last_refresh", lastRefresh),
+			slog.String("srv_domain", f.config.SRVDomain),
+			slog.String("static_file", f.config.StaticFile),
+		)
+	}
+	return true
+}
+
+// recovered records that the registry refreshed again
+func (f *fallbackResolver) recovered() {
+	if f.engaged.Swap(false) {
+		f.logger.Info("registry refreshed, fallback discovery disengaged")
+	}
+}
+
+// instances returns fallback instances for a service. Results are cached so
+// load balancing state stays attached to the same instances between calls.
+func (f *fallbackResolver) instances(ctx context.Context, serviceType ServiceType) []*ServiceInstance {
+	f.mu.Lock()
+	entry, ok := f.cache[serviceType]
+	f.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.instances
+	}
+
+	instances, err := f.resolve(ctx, serviceType)
+	if err != nil {
+		f.logger.Warn("fallback discovery failed",
+			slog.String("service", string(serviceType)),
+			slog.String("error", err.Error()),
+		)
+		// A stale answer beats none
+		if ok {
+			return entry.instances
+		}
+		return nil
+	}
+
+	f.mu.Lock()
+	f.cache[serviceType] = &fallbackEntry{instances: instances, expires: time.Now().Add(f.config.CacheTTL)}
+	f.mu.Unlock()
+
+	return instances
+}
+
+// resolve looks a service up in DNS, then in the static file
+func (f *fallbackResolver) resolve(ctx context.Context, serviceType ServiceType) ([]*ServiceInstance, error) {
+	var srvErr error
+	if f.config.SRVDomain != "" {
+		instances, err := f.lookupSRV(ctx, serviceType)
+		if err == nil && len(instances) > 0 {
+			return instances, nil
+		}
+		srvErr = err
+	}
+
+	if f.config.StaticFile != "" {
+		static, err := f.loadStatic()
+		if err != nil {
+			return nil, err
+		}
+		if instances := static[serviceType]; len(instances) > 0 {
+			return instances, nil
+		}
+	}
+
+	if srvErr != nil {
+		return nil, srvErr
+	}
+	return nil, fmt.Errorf("no fallback instances of %s", serviceType)
+}
+
+// lookupSRV converts a service's SRV records to instances
+func (f *fallbackResolver) lookupSRV(ctx context.Context, serviceType ServiceType) ([]*ServiceInstance, error) {
+	name := fmt.Sprintf("%s.%s", serviceType, f.config.SRVDomain)
+	_, records, err := f.resolver.LookupSRV(ctx, f.config.SRVService, f.config.SRVProto, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV records for %s: %w", name, err)
+	}
+
+	instances := make([]*ServiceInstance, 0, len(records))
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		instances = append(instances, &ServiceInstance{
+			ID:       fmt.Sprintf("dns-%s-%d", host, srv.Port),
+			Type:     serviceType,
+			Host:     host,
+			Port:     int(srv.Port),
+			Status:   InstanceStatusHealthy,
+			Weight:   int(srv.Weight),
+			Metadata: map[string]string{"discovery": "dns"},
+		})
+	}
+	return instances, nil
+}
+
+// loadStatic reads the static instance file once
+func (f *fallbackResolver) loadStatic() (map[ServiceType][]*ServiceInstance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.loaded {
+		return f.static, nil
+	}
+
+	data, err := os.ReadFile(f.config.StaticFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static instance file: %w", err)
+	}
+
+	var static map[ServiceType][]*ServiceInstance
+	if err := json.Unmarshal(data, &static); err != nil {
+		return nil, fmt.Errorf("failed to parse static instance file: %w", err)
+	}
+
+	// Listed instances are assumed reachable; outlier detection still applies
+	for svcType, instances := range static {
+		for _, inst := range instances {
+			inst.Type = svcType
+			inst.Status = InstanceStatusHealthy
+		}
+	}
+
+	f.static = static
+	f.loaded = true
+	return static, nil
+}
+
+// fallbackInstances returns instances from fallback discovery when the
+// registry cache has gone stale
+func (r *ServiceRegistry) fallbackInstances(serviceType ServiceType) ([]*ServiceInstance, bool) {
+	if r.fallback == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	lastRefresh := r.lastRefresh
+	r.mu.RUnlock()
+
+	if !r.fallback.active(lastRefresh) {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.fallback.config.LookupTimeout)
+	defer cancel()
+	return r.fallback.instances(ctx, serviceType), true
+}
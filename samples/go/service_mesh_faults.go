@@ -0,0 +1,194 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FaultRule describes faults to inject into calls matching a service and
+// path prefix. Percentages are 0-100 and evaluated independently.
+type FaultRule struct {
+	ServiceType  ServiceType   `json:"service_type"`
+	PathPrefix   string        `json:"path_prefix,omitempty"` // Empty matches every path
+	Delay        time.Duration `json:"delay,omitempty"`
+	DelayPercent float64       `json:"delay_percent,omitempty"`
+	AbortStatus  int           `json:"abort_status,omitempty"` // HTTP status returned instead of calling upstream
+	AbortPercent float64       `json:"abort_percent,omitempty"`
+	ResetPercent float64       `json:"reset_percent,omitempty"` // Simulated connection resets
+	ExpiresAt    time.Time     `json:"expires_at,omitempty"`    // Rule disables itself after this time
+}
+
+// ErrInjectedReset simulates a connection reset from the upstream
+var ErrInjectedReset = errors.New("fault injection: connection reset by peer")
+
+// ErrInvalidFaultRule is returned when a fault rule fails validation
+var ErrInvalidFaultRule = errors.New("invalid fault rule")
+
+// validate checks a fault rule
+func (f *FaultRule) validate() error {
+	if f.ServiceType == "" {
+		return fmt.Errorf("%w: service type required", ErrInvalidFaultRule)
+	}
+	for _, pct := range []float64{f.DelayPercent, f.AbortPercent, f.ResetPercent} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("%w: percentages must be between 0 and 100", ErrInvalidFaultRule)
+		}
+	}
+	if f.AbortPercent > 0 && (f.AbortStatus < 400 || f.AbortStatus > 599) {
+		return fmt.Errorf("%w: abort status must be 4xx or 5xx", ErrInvalidFaultRule)
+	}
+	return nil
+}
+
+// faultAction is the outcome of evaluating the rules for one call
+type faultAction struct {
+	delay       time.Duration
+	abortStatus int
+	reset       bool
+}
+
+// FaultInjector injects latency, errors, and resets into mesh calls for
+// chaos testing. It starts disabled and is toggled at runtime.
+type FaultInjector struct {
+	logger  *slog.Logger
+	enabled atomic.Bool
+
+	mu    sync.RWMutex
+	rules []*FaultRule
+}
+
+// NewFaultInjector creates a disabled fault injector
+func NewFaultInjector(logger *slog.Logger) *FaultInjector {
+	return &FaultInjector{logger: logger}
+}
+
+// SetRules replaces the active fault rules
+func (f *FaultInjector) SetRules(rules []*FaultRule) error {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	f.rules = rules
+	f.mu.Unlock()
+
+	f.logger.Warn("fault injection rules updated", slog.Int("rules", len(rules)))
+	return nil
+}
+
+// Rules returns the active fault rules
+func (f *FaultInjector) Rules() []*FaultRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]*FaultRule(nil), f.rules...)
+}
+
+// Enable turns fault injection on
+func (f *FaultInjector) Enable() {
+	f.enabled.Store(true)
+	f.logger.Warn("fault injection enabled")
+}
+
+// Disable turns fault injection off
+func (f *FaultInjector) Disable() {
+	f.enabled.Store(false)
+	f.logger.Info("fault injection disabled")
+}
+
+// Enabled reports whether fault injection is active
+func (f *FaultInjector) Enabled() bool {
+	return f.enabled.Load()
+}
+
+// evaluate returns the faults to apply to a call, or nil
+func (f *FaultInjector) evaluate(serviceType ServiceType, path string) *faultAction {
+	if !f.enabled.Load() {
+		return nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	now := time.Now()
+	for _, rule := range f.rules {
+		if rule.ServiceType != serviceType || !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if !rule.ExpiresAt.IsZero() && now.After(rule.ExpiresAt) {
+			continue
+		}
+
+		action := &faultAction{}
+		if rule.Delay > 0 && rand.Float64()*100 < rule.DelayPercent {
+			action.delay = rule.Delay
+		}
+		if rand.Float64()*100 < rule.ResetPercent {
+			action.reset = true
+		} else if rand.Float64()*100 < rule.AbortPercent {
+			action.abortStatus = rule.AbortStatus
+		}
+		return action
+	}
+
+	return nil
+}
+
+// apply executes a fault action. It returns a synthetic response for
+// aborts, ErrInjectedReset for resets, and (nil, nil) when the real request
+// should proceed.
+func (a *faultAction) apply(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if a.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(a.delay):
+		}
+	}
+
+	if a.reset {
+		return nil, ErrInjectedReset
+	}
+
+	if a.abortStatus > 0 {
+		body := "fault injected"
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", a.abortStatus, http.StatusText(a.abortStatus)),
+			StatusCode:    a.abortStatus,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"X-Fault-Injected": []string{"true"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// resetClientConnection aborts the downstream connection so the caller
+// observes a reset rather than an HTTP error
+func resetClientConnection(w http.ResponseWriter) bool {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return false
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
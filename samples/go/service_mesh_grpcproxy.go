@@ -0,0 +1,248 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcTargetHeader selects the upstream service when :authority can't
+const grpcTargetHeader = "x-target-service"
+
+// rawFrame carries an undecoded gRPC message through the proxy
+type rawFrame struct {
+	payload []byte
+}
+
+// rawCodec passes message bytes through untouched so the sidecar can proxy
+// any service without its protobuf definitions. It reports itself as
+// "proto" so upstreams see the standard content subtype.
+type rawCodec struct{}
+
+// Marshal implements encoding.Codec
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	frame, ok := v.(*rawFrame)
+	if !ok {
+		return nil, fmt.Errorf("proxy codec cannot marshal %T", v)
+	}
+	return frame.payload, nil
+}
+
+// Unmarshal implements encoding.Codec
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	frame, ok := v.(*rawFrame)
+	if !ok {
+		return fmt.Errorf("proxy codec cannot unmarshal into %T", v)
+	}
+	// gRPC may reuse data after Unmarshal returns
+	frame.payload = append([]byte(nil), data...)
+	return nil
+}
+
+// Name implements encoding.Codec
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// proxyStreamDesc allows any streaming shape; unary calls are a special case
+var proxyStreamDesc = &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+
+// StartGRPC starts transparent gRPC proxying on the given port. Unknown
+// services are forwarded to the upstream resolved from the x-target-service
+// header or the first label of :authority (e.g. "voice.mesh.local").
+func (s *Sidecar) StartGRPC(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(s.grpcProxyHandler),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+	}
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+
+	s.logger.Info("sidecar gRPC proxy starting", slog.Int("grpc_proxy_port", port))
+
+	return s.grpcServer.Serve(lis)
+}
+
+// grpcTargetService resolves the upstream service for a proxied call
+func grpcTargetService(md metadata.MD) (ServiceType, error) {
+	if values := md.Get(grpcTargetHeader); len(values) > 0 && values[0] != "" {
+		return ServiceType(values[0]), nil
+	}
+	if values := md.Get(":authority"); len(values) > 0 && values[0] != "" {
+		host := values[0]
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if label, _, _ := strings.Cut(host, "."); label != "" && net.ParseIP(host) == nil {
+			return ServiceType(label), nil
+		}
+	}
+	return "", status.Error(codes.InvalidArgument, "x-target-service metadata or a service :authority is required")
+}
+
+// grpcProxyHandler forwards one call, in both directions, to the upstream
+func (s *Sidecar) grpcProxyHandler(_ any, serverStream grpc.ServerStream) error {
+	fullMethod, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Error(codes.Internal, "proxy could not determine method")
+	}
+
+	ctx := serverStream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = extractCallMetadata(ctx, md)
+
+	serviceType, err := grpcTargetService(md)
+	if err != nil {
+		return err
+	}
+
+	var authorization string
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	identity, err := s.authenticate(ctx, authorization)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+	}
+
+	startTime := time.Now()
+	err = s.proxyGRPCStream(ctx, serviceType, fullMethod, md, identity, serverStream)
+	metrics.grpcProxyRequests.WithLabelValues(string(serviceType), fullMethod, status.Code(err).String()).Inc()
+	metrics.grpcProxyDuration.WithLabelValues(string(serviceType), fullMethod).Observe(time.Since(startTime).Seconds())
+
+	if err != nil && status.Code(err) != codes.Canceled {
+		s.logger.Warn("grpc proxy call failed",
+			slog.String("service", string(serviceType)),
+			slog.String("method", fullMethod),
+			slog.String("error", err.Error()),
+		)
+	}
+	return err
+}
+
+// proxyGRPCStream opens the upstream stream and pumps messages until either
+// side finishes. The incoming deadline carries over to the upstream call
+// because the outgoing context is derived from the server stream's.
+func (s *Sidecar) proxyGRPCStream(ctx context.Context, serviceType ServiceType, fullMethod string, md metadata.MD, identity *Identity, serverStream grpc.ServerStream) error {
+	if cb := s.client.circuitBreakers[serviceType]; cb != nil && cb.State() == CircuitOpen {
+		return status.Error(codes.Unavailable, ErrCircuitOpen.Error())
+	}
+
+	release, err := s.client.bulkheads.acquire(ctx, serviceType)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer release()
+
+	conn, err := s.client.GetGRPCConn(ctx, serviceType)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	outMD := md.Copy()
+	outMD.Delete(grpcTargetHeader)
+	outMD.Delete(":authority")
+	setIdentityMetadata(identity, outMD)
+
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, outMD))
+	defer cancel()
+
+	clientStream, err := conn.NewStream(ctx, proxyStreamDesc, fullMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+
+	toUpstream := forwardToUpstream(serverStream, clientStream)
+	toDownstream := forwardToDownstream(clientStream, serverStream)
+
+	for {
+		select {
+		case err := <-toUpstream:
+			if errors.Is(err, io.EOF) {
+				// Downstream finished sending; half-close and keep relaying responses
+				clientStream.CloseSend()
+				toUpstream = nil
+				continue
+			}
+			cancel()
+			return status.Errorf(codes.Internal, "failed proxying to upstream: %v", err)
+		case err := <-toDownstream:
+			serverStream.SetTrailer(clientStream.Trailer())
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// Upstream status errors pass through with their original code
+			return err
+		}
+	}
+}
+
+// forwardToUpstream relays downstream messages to the upstream stream
+func forwardToUpstream(src grpc.ServerStream, dst grpc.ClientStream) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		for {
+			frame := &rawFrame{}
+			if err := src.RecvMsg(frame); err != nil {
+				done <- err
+				return
+			}
+			if err := dst.SendMsg(frame); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// forwardToDownstream relays upstream headers and messages back to the caller
+func forwardToDownstream(src grpc.ClientStream, dst grpc.ServerStream) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			frame := &rawFrame{}
+			if err := src.RecvMsg(frame); err != nil {
+				done <- err
+				return
+			}
+			if i == 0 {
+				// Headers are only available once the first message arrives
+				header, err := src.Header()
+				if err != nil {
+					done <- err
+					return
+				}
+				if err := dst.SendHeader(header); err != nil {
+					done <- err
+					return
+				}
+			}
+			if err := dst.SendMsg(frame); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,149 @@
+package mesh
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Consistent-hash ring tuning
+const (
+	ringReplicas      = 128  // Virtual nodes per unit of instance weight
+	boundedLoadFactor = 1.25 // Max load relative to average before spilling over
+)
+
+// affinityKeyCtx is the context key for session affinity
+type affinityKeyCtx struct{}
+
+// WithAffinityKey returns a context that routes ServiceClient calls by key
+// (e.g. session ID) so stateful services keep serving the same session
+func WithAffinityKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKeyCtx{}, key)
+}
+
+// affinityKeyFromContext returns the affinity key, if any
+func affinityKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(affinityKeyCtx{}).(string)
+	return key
+}
+
+// ringPoint is a virtual node on the hash ring
+type ringPoint struct {
+	hash       uint64
+	instanceID string
+}
+
+// hashRing is an immutable consistent-hash ring for one service
+type hashRing struct {
+	signature string
+	points    []ringPoint
+}
+
+// hashRings caches rings per service type, rebuilt when membership changes
+var hashRings sync.Map // map[ServiceType]*hashRing
+
+// hashKey hashes a string onto the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// ringSignature identifies ring membership and weights
+func ringSignature(instances []*ServiceInstance) string {
+	parts := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		parts = append(parts, inst.ID+"/"+strconv.Itoa(inst.Weight))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// buildHashRing places weighted virtual nodes for every instance
+func buildHashRing(signature string, instances []*ServiceInstance) *hashRing {
+	ring := &hashRing{signature: signature}
+	for _, inst := range instances {
+		weight := inst.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for i := 0; i < ringReplicas*weight; i++ {
+			ring.points = append(ring.points, ringPoint{
+				hash:       hashKey(inst.ID + "#" + strconv.Itoa(i)),
+				instanceID: inst.ID,
+			})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i].hash < ring.points[j].hash })
+	return ring
+}
+
+// ringFor returns the ring for the service's current healthy membership.
+// The ring is built from all healthy instances, not the filtered candidates,
+// so ejections and retries don't reshuffle ownership of unrelated keys.
+func (r *ServiceRegistry) ringFor(serviceType ServiceType) *hashRing {
+	members := r.GetInstances(serviceType)
+	signature := ringSignature(members)
+
+	if ringI, ok := hashRings.Load(serviceType); ok && ringI.(*hashRing).signature == signature {
+		return ringI.(*hashRing)
+	}
+
+	ring := buildHashRing(signature, members)
+	hashRings.Store(serviceType, ring)
+	return ring
+}
+
+// consistentHash implements consistent hashing with bounded loads: walk the
+// ring clockwise from the key and take the first candidate whose in-flight
+// count is under boundedLoadFactor times the average
+func (r *ServiceRegistry) consistentHash(serviceType ServiceType, instances []*ServiceInstance, key string) *ServiceInstance {
+	ring := r.ringFor(serviceType)
+	if len(ring.points) == 0 {
+		return instances[0]
+	}
+
+	candidates := make(map[string]*ServiceInstance, len(instances))
+	loads := make(map[string]int64, len(instances))
+	var totalLoad int64
+	for _, inst := range instances {
+		candidates[inst.ID] = inst
+		countI, _ := connectionCounts.LoadOrStore(inst.ID, new(int64))
+		load := atomic.LoadInt64(countI.(*int64))
+		loads[inst.ID] = load
+		totalLoad += load
+	}
+
+	capacity := int64(math.Ceil(boundedLoadFactor * float64(totalLoad+1) / float64(len(instances))))
+
+	h := hashKey(key)
+	start := sort.Search(len(ring.points), func(i int) bool { return ring.points[i].hash >= h })
+
+	var firstCandidate *ServiceInstance
+	visited := make(map[string]bool, len(instances))
+	for i := 0; i < len(ring.points) && len(visited) < len(candidates); i++ {
+		point := ring.points[(start+i)%len(ring.points)]
+		inst, ok := candidates[point.instanceID]
+		if !ok || visited[point.instanceID] {
+			continue
+		}
+		visited[point.instanceID] = true
+
+		if firstCandidate == nil {
+			firstCandidate = inst
+		}
+		if loads[inst.ID] < capacity {
+			return inst
+		}
+	}
+
+	if firstCandidate != nil {
+		return firstCandidate
+	}
+	return instances[0]
+}
@@ -0,0 +1,197 @@
+package mesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthCheckType selects the protocol used to probe an instance
+type HealthCheckType string
+
+const (
+	HealthCheckHTTP HealthCheckType = "http"
+	HealthCheckGRPC HealthCheckType = "grpc"
+)
+
+// HealthCheckMetadataKey lets an instance declare its preferred check type
+// in Metadata, e.g. {"health_check": "grpc"}
+const HealthCheckMetadataKey = "health_check"
+
+// healthCheckType returns the declared check type, defaulting to gRPC for
+// instances that expose a gRPC port and HTTP otherwise
+func (inst *ServiceInstance) healthCheckType() HealthCheckType {
+	switch HealthCheckType(inst.Metadata[HealthCheckMetadataKey]) {
+	case HealthCheckHTTP:
+		return HealthCheckHTTP
+	case HealthCheckGRPC:
+		return HealthCheckGRPC
+	}
+	if inst.GRPCPort != 0 {
+		return HealthCheckGRPC
+	}
+	return HealthCheckHTTP
+}
+
+// checkHTTPHealth probes an instance's HTTP health endpoint
+func checkHTTPHealth(client *http.Client, inst *ServiceInstance) error {
+	if inst.HealthCheckURL == "" {
+		inst.HealthCheckURL = fmt.Sprintf("http://%s:%d/health", inst.Host, inst.Port)
+	}
+
+	resp, err := client.Get(inst.HealthCheckURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkGRPCHealth probes an instance with the standard gRPC health protocol,
+// reusing a pooled connection to the instance
+func (r *ServiceRegistry) checkGRPCHealth(inst *ServiceInstance) error {
+	if inst.GRPCPort == 0 {
+		return fmt.Errorf("instance %s declares gRPC health checks without a gRPC port", inst.ID)
+	}
+
+	_, timeout := r.healthCheckSettings()
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+
+	conn, err := r.healthConns.instanceConn(ctx, inst)
+	if err != nil {
+		return err
+	}
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{
+		Service: string(inst.Type),
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health status %s", resp.Status)
+	}
+	return nil
+}
+
+// instanceHealth is the registry's view of one instance's health. Times are
+// taken from the local clock so skew between hosts can't affect staleness.
+type instanceHealth struct {
+	status        InstanceStatus
+	failures      int
+	successes     int
+	heartbeat     time.Time // Last LastHealthCheck value published by the instance
+	heartbeatSeen time.Time // Local time the published value last changed
+	healthySince  time.Time // Local time the instance last became healthy
+	stale         bool
+}
+
+// healthTracker owns consecutive failure/success counts per instance so
+// health survives instance cache refreshes and is dropped with the instance
+type healthTracker struct {
+	unhealthyThreshold int
+	healthyThreshold   int
+	staleAfter         time.Duration
+
+	mu     sync.Mutex
+	states map[string]*instanceHealth
+}
+
+// newHealthTracker creates a tracker from registry configuration
+func newHealthTracker(config *RegistryConfig) *healthTracker {
+	healthy := config.HealthyThreshold
+	if healthy <= 0 {
+		healthy = 1
+	}
+	return &healthTracker{
+		unhealthyThreshold: config.UnhealthyThreshold,
+		healthyThreshold:   healthy,
+		staleAfter:         config.RegistrationTTL,
+		states:             make(map[string]*instanceHealth),
+	}
+}
+
+// stateLocked returns the state for an instance, creating it (caller must hold lock)
+func (t *healthTracker) stateLocked(id string) *instanceHealth {
+	state, ok := t.states[id]
+	if !ok {
+		state = &instanceHealth{status: InstanceStatusStarting, heartbeatSeen: time.Now()}
+		t.states[id] = state
+	}
+	return state
+}
+
+// recordCheck applies a health check result and returns the resulting status
+// and whether it changed. An instance that has never been healthy is admitted
+// on its first passing check; recovery from unhealthy needs healthyThreshold.
+func (t *healthTracker) recordCheck(id string, err error) (InstanceStatus, bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.stateLocked(id)
+	previous := state.status
+
+	if err != nil {
+		state.successes = 0
+		state.failures++
+		if state.failures >= t.unhealthyThreshold {
+			state.status = InstanceStatusUnhealthy
+		}
+		return state.status, state.status != previous, state.failures
+	}
+
+	state.failures = 0
+	state.successes++
+	if !state.stale && (previous == InstanceStatusStarting || state.successes >= t.healthyThreshold) {
+		state.status = InstanceStatusHealthy
+		if previous != InstanceStatusHealthy {
+			state.healthySince = time.Now()
+		}
+	}
+	return state.status, state.status != previous, state.successes
+}
+
+// observe records the heartbeat published with a refreshed instance and
+// returns the status the registry should serve for it. Only changes in the
+// published value are used, never its absolute time.
+func (t *healthTracker) observe(inst *ServiceInstance, now time.Time) (InstanceStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.stateLocked(inst.ID)
+	if !inst.LastHealthCheck.Equal(state.heartbeat) {
+		state.heartbeat = inst.LastHealthCheck
+		state.heartbeatSeen = now
+	}
+
+	wasStale := state.stale
+	state.stale = t.staleAfter > 0 && now.Sub(state.heartbeatSeen) > t.staleAfter
+	if state.stale {
+		state.status = InstanceStatusUnhealthy
+		state.successes = 0
+	}
+
+	return state.status, state.stale && !wasStale
+}
+
+// forget drops health state for instances that are no longer registered
+func (t *healthTracker) forget(present map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id := range t.states {
+		if !present[id] {
+			delete(t.states, id)
+		}
+	}
+}
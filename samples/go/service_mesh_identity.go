@@ -0,0 +1,145 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Verified identity headers set for upstream services. Caller-supplied
+// copies are replaced so they can't be spoofed through the sidecar.
+const (
+	HeaderUserID     = "X-User-ID"
+	HeaderUserRole   = "X-User-Role"
+	HeaderFacilityID = "X-Facility-ID"
+	HeaderSessionID  = "X-Session-ID"
+)
+
+// identityHeaders lists every header the sidecar owns
+var identityHeaders = []string{HeaderUserID, HeaderUserRole, HeaderFacilityID, HeaderSessionID}
+
+// Identity is the verified caller behind a request
+type Identity struct {
+	UserID     string
+	Role       string
+	FacilityID string
+	SessionID  string
+}
+
+// TokenValidator verifies a bearer token and returns the caller's identity.
+// Wrap auth.AuthService.ValidateToken to plug in the platform's JWT checks:
+//
+//	mesh.TokenValidatorFunc(func(ctx context.Context, token string) (*mesh.Identity, error) {
+//		claims, err := authService.ValidateToken(ctx, token)
+//		if err != nil {
+//			return nil, err
+//		}
+//		if claims.TokenType != auth.TokenTypeAccess {
+//			return nil, errors.New("invalid token type")
+//		}
+//		return &mesh.Identity{UserID: claims.UserID, Role: string(claims.Role),
+//			FacilityID: claims.FacilityID, SessionID: claims.SessionID}, nil
+//	})
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*Identity, error)
+}
+
+// TokenValidatorFunc adapts a function to TokenValidator
+type TokenValidatorFunc func(ctx context.Context, token string) (*Identity, error)
+
+// ValidateToken implements TokenValidator
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, token string) (*Identity, error) {
+	return f(ctx, token)
+}
+
+// ErrMissingToken is returned when a request carries no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+// identityCtx is the context key for the verified identity
+type identityCtx struct{}
+
+// WithIdentity returns a context whose ServiceClient calls carry the
+// identity headers to upstream services
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityCtx{}, identity)
+}
+
+// IdentityFromContext returns the verified identity, if any
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityCtx{}).(*Identity)
+	return identity
+}
+
+// setIdentityHeaders writes the context identity onto an outbound request
+func setIdentityHeaders(ctx context.Context, header http.Header) {
+	for _, name := range identityHeaders {
+		header.Del(name)
+	}
+
+	identity := IdentityFromContext(ctx)
+	if identity == nil {
+		return
+	}
+	header.Set(HeaderUserID, identity.UserID)
+	header.Set(HeaderUserRole, identity.Role)
+	header.Set(HeaderFacilityID, identity.FacilityID)
+	header.Set(HeaderSessionID, identity.SessionID)
+}
+
+// setIdentityMetadata replaces caller-supplied identity keys and the token
+// in outbound gRPC metadata with the verified identity
+func setIdentityMetadata(identity *Identity, md metadata.MD) {
+	for _, name := range identityHeaders {
+		md.Delete(name)
+	}
+	md.Delete("authorization")
+
+	if identity == nil {
+		return
+	}
+	md.Set(HeaderUserID, identity.UserID)
+	md.Set(HeaderUserRole, identity.Role)
+	md.Set(HeaderFacilityID, identity.FacilityID)
+	md.Set(HeaderSessionID, identity.SessionID)
+}
+
+// bearerToken extracts the token from an Authorization value
+func bearerToken(value string) (string, error) {
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", ErrMissingToken
+	}
+	return token, nil
+}
+
+// EnableAuth requires every proxied request to carry a valid bearer token.
+// Verified identity is forwarded upstream; the token itself is not.
+func (s *Sidecar) EnableAuth(validator TokenValidator) {
+	s.validator = validator
+}
+
+// authenticate validates a request's bearer token when auth is enabled.
+// It returns the identity to forward, or nil when auth is disabled.
+func (s *Sidecar) authenticate(ctx context.Context, authorization string) (*Identity, error) {
+	if s.validator == nil {
+		return nil, nil
+	}
+
+	token, err := bearerToken(authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.validator.ValidateToken(ctx, token)
+	if err != nil {
+		s.logger.Warn("sidecar token validation failed",
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+	return identity, nil
+}
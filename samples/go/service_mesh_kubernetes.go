@@ -0,0 +1,223 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// KubernetesDiscoveryConfig contains configuration for EndpointSlice discovery
+type KubernetesDiscoveryConfig struct {
+	Namespace        string        // Empty watches all namespaces
+	ServiceTypeLabel string        // Label carrying the ServiceType on the Service/EndpointSlice
+	VersionLabel     string        // Label carrying the service version
+	HTTPPortName     string        // EndpointSlice port name used for HTTP traffic
+	GRPCPortName     string        // EndpointSlice port name used for gRPC traffic
+	ResyncPeriod     time.Duration // Informer resync period
+	SyncTimeout      time.Duration // Max wait for the initial cache sync
+}
+
+// DefaultKubernetesDiscoveryConfig returns default configuration
+func DefaultKubernetesDiscoveryConfig() *KubernetesDiscoveryConfig {
+	return &KubernetesDiscoveryConfig{
+		ServiceTypeLabel: "mesh.lilo.io/service-type",
+		VersionLabel:     "app.kubernetes.io/version",
+		HTTPPortName:     "http",
+		GRPCPortName:     "grpc",
+		ResyncPeriod:     5 * time.Minute,
+		SyncTimeout:      30 * time.Second,
+	}
+}
+
+// ErrKubernetesCacheSync is returned when the EndpointSlice cache never syncs
+var ErrKubernetesCacheSync = errors.New("timed out waiting for endpointslice cache sync")
+
+// kubernetesDiscovery feeds the registry from EndpointSlice informers
+type kubernetesDiscovery struct {
+	registry *ServiceRegistry
+	config   *KubernetesDiscoveryConfig
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   listersv1.EndpointSliceLister
+	logger   *slog.Logger
+}
+
+// NewKubernetesServiceRegistry creates a registry backed by Kubernetes
+// EndpointSlices instead of Redis self-registration. Only slices carrying the
+// configured service-type label are considered; endpoint readiness replaces
+// the registry's own health checks.
+func NewKubernetesServiceRegistry(clientset kubernetes.Interface, logger *slog.Logger, config *RegistryConfig) (*ServiceRegistry, error) {
+	kubeConfig := config.Kubernetes
+	if kubeConfig == nil {
+		kubeConfig = DefaultKubernetesDiscoveryConfig()
+	}
+
+	registry := newServiceRegistry(DiscoveryModeKubernetes, logger, config)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, kubeConfig.ResyncPeriod,
+		informers.WithNamespace(kubeConfig.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = kubeConfig.ServiceTypeLabel
+		}),
+	)
+	slices := factory.Discovery().V1().EndpointSlices()
+
+	discovery := &kubernetesDiscovery{
+		registry: registry,
+		config:   kubeConfig,
+		factory:  factory,
+		informer: slices.Informer(),
+		lister:   slices.Lister(),
+		logger:   logger,
+	}
+	registry.refresh = discovery.rebuild
+
+	if err := discovery.start(); err != nil {
+		registry.cancel()
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// start registers event handlers and waits for the initial cache sync
+func (d *kubernetesDiscovery) start() error {
+	// Any change rebuilds the full table; slice counts are small and this
+	// keeps the registry consistent with the informer cache
+	resync := func(interface{}) { d.rebuild() }
+	if _, err := d.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    resync,
+		UpdateFunc: func(_, obj interface{}) { d.rebuild() },
+		DeleteFunc: resync,
+	}); err != nil {
+		return fmt.Errorf("failed to add endpointslice handler: %w", err)
+	}
+
+	d.factory.Start(d.registry.ctx.Done())
+
+	syncCh := make(chan struct{})
+	go func() {
+		select {
+		case <-time.After(d.config.SyncTimeout):
+		case <-d.registry.ctx.Done():
+		}
+		close(syncCh)
+	}()
+
+	if !cache.WaitForCacheSync(syncCh, d.informer.HasSynced) {
+		return ErrKubernetesCacheSync
+	}
+
+	d.rebuild()
+
+	d.logger.Info("kubernetes discovery started",
+		slog.String("namespace", d.config.Namespace),
+		slog.String("label", d.config.ServiceTypeLabel),
+	)
+
+	return nil
+}
+
+// rebuild recomputes the instance table from the informer cache
+func (d *kubernetesDiscovery) rebuild() {
+	slices, err := d.lister.List(labels.Everything())
+	if err != nil {
+		d.logger.Error("failed to list endpointslices",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	newInstances := make(map[ServiceType][]*ServiceInstance)
+	for _, slice := range slices {
+		svcType := ServiceType(slice.Labels[d.config.ServiceTypeLabel])
+		if svcType == "" {
+			continue
+		}
+		newInstances[svcType] = append(newInstances[svcType], d.instancesFromSlice(svcType, slice)...)
+	}
+
+	d.registry.mu.Lock()
+	d.registry.instances = newInstances
+	d.registry.mu.Unlock()
+
+	d.registry.forgetVanished(newInstances)
+}
+
+// instancesFromSlice converts EndpointSlice endpoints into service instances
+func (d *kubernetesDiscovery) instancesFromSlice(svcType ServiceType, slice *discoveryv1.EndpointSlice) []*ServiceInstance {
+	var httpPort, grpcPort int
+	for _, port := range slice.Ports {
+		if port.Name == nil || port.Port == nil {
+			continue
+		}
+		switch *port.Name {
+		case d.config.HTTPPortName:
+			httpPort = int(*port.Port)
+		case d.config.GRPCPortName:
+			grpcPort = int(*port.Port)
+		}
+	}
+
+	now := time.Now()
+	instances := make([]*ServiceInstance, 0, len(slice.Endpoints))
+
+	for _, ep := range slice.Endpoints {
+		if len(ep.Addresses) == 0 {
+			continue
+		}
+
+		id := ep.Addresses[0]
+		if ep.TargetRef != nil && ep.TargetRef.Name != "" {
+			id = ep.TargetRef.Name
+		}
+
+		metadata := map[string]string{
+			"namespace":      slice.Namespace,
+			"endpointslice":  slice.Name,
+			"discovery_mode": string(DiscoveryModeKubernetes),
+		}
+		if ep.NodeName != nil {
+			metadata["node"] = *ep.NodeName
+		}
+		if ep.Zone != nil {
+			metadata["zone"] = *ep.Zone
+		}
+
+		instances = append(instances, &ServiceInstance{
+			ID:              id,
+			Type:            svcType,
+			Host:            ep.Addresses[0],
+			Port:            httpPort,
+			GRPCPort:        grpcPort,
+			Version:         slice.Labels[d.config.VersionLabel],
+			Status:          endpointStatus(ep.Conditions),
+			Metadata:        metadata,
+			LastHealthCheck: now,
+			Weight:          1,
+		})
+	}
+
+	return instances
+}
+
+// endpointStatus maps EndpointSlice conditions onto InstanceStatus
+func endpointStatus(conditions discoveryv1.EndpointConditions) InstanceStatus {
+	if conditions.Terminating != nil && *conditions.Terminating {
+		return InstanceStatusDraining
+	}
+	// A nil Ready condition means ready per the EndpointSlice API contract
+	if conditions.Ready == nil || *conditions.Ready {
+		return InstanceStatusHealthy
+	}
+	return InstanceStatusUnhealthy
+}
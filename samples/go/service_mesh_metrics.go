@@ -0,0 +1,247 @@
+package mesh
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// metricsNamespace prefixes all mesh metric names
+const metricsNamespace = "lilo_mesh"
+
+// meshMetrics holds the event-driven collectors updated on the request path
+type meshMetrics struct {
+	requestDuration     *prometheus.HistogramVec
+	retries             *prometheus.CounterVec
+	healthCheckFailures *prometheus.CounterVec
+	poolDials           *prometheus.CounterVec
+	poolEvictions       *prometheus.CounterVec
+	shadowRequests      *prometheus.CounterVec
+	shadowDuration      *prometheus.HistogramVec
+	shadowMismatches    *prometheus.CounterVec
+	bulkheadRejections  *prometheus.CounterVec
+	grpcProxyRequests   *prometheus.CounterVec
+	grpcProxyDuration   *prometheus.HistogramVec
+	rateLimited         *prometheus.CounterVec
+}
+
+// metrics is shared by every registry and client in the process, mirroring
+// the package-level load balancing state
+var metrics = newMeshMetrics()
+
+// newMeshMetrics creates the mesh collectors
+func newMeshMetrics() *meshMetrics {
+	return &meshMetrics{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of outbound mesh requests by target service.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"service", "method", "code"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Retry attempts made against a target service.",
+		}, []string{"service"}),
+		healthCheckFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "health_check_failures_total",
+			Help:      "Failed instance health checks by service.",
+		}, []string{"service"}),
+		poolDials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pool_dials_total",
+			Help:      "gRPC connections opened by the connection pool.",
+		}, []string{"kind"}),
+		poolEvictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pool_evictions_total",
+			Help:      "gRPC connections closed by the connection pool by reason.",
+		}, []string{"reason"}),
+		shadowRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "shadow_requests_total",
+			Help:      "Mirrored requests by primary service and outcome.",
+		}, []string{"service", "outcome"}),
+		shadowDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "shadow_request_duration_seconds",
+			Help:      "Latency of mirrored requests by primary and shadow service.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"service", "target"}),
+		shadowMismatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "shadow_status_mismatches_total",
+			Help:      "Mirrored requests whose status code differed from the primary.",
+		}, []string{"service"}),
+		bulkheadRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bulkhead_rejections_total",
+			Help:      "Requests rejected because the service's concurrency limit was reached.",
+		}, []string{"service"}),
+		grpcProxyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_proxy_requests_total",
+			Help:      "gRPC calls proxied by the sidecar by service, method, and status code.",
+		}, []string{"service", "method", "code"}),
+		grpcProxyDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_proxy_duration_seconds",
+			Help:      "Duration of proxied gRPC calls, including full stream lifetime.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+		}, []string{"service", "method"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_rate_limited_total",
+			Help:      "Requests rejected by a route rate limit.",
+		}, []string{"service", "route"}),
+	}
+}
+
+// observeRequest records the outcome of an outbound request
+func (m *meshMetrics) observeRequest(serviceType ServiceType, method string, statusCode int, seconds float64) {
+	code := "error"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	m.requestDuration.WithLabelValues(string(serviceType), method, code).Observe(seconds)
+}
+
+// meshStateCollector reports registry and breaker state at scrape time so
+// gauges never go stale between events
+type meshStateCollector struct {
+	registry *ServiceRegistry
+	client   *ServiceClient
+
+	circuitStateDesc *prometheus.Desc
+	instancesDesc    *prometheus.Desc
+	poolSizeDesc     *prometheus.Desc
+	latencyEWMADesc  *prometheus.Desc
+	latencyP99Desc   *prometheus.Desc
+	timeoutDesc      *prometheus.Desc
+	bulkheadDesc     *prometheus.Desc
+}
+
+// newMeshStateCollector creates a scrape-time collector
+func newMeshStateCollector(registry *ServiceRegistry, client *ServiceClient) *meshStateCollector {
+	return &meshStateCollector{
+		registry: registry,
+		client:   client,
+		circuitStateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "circuit_breaker_state"),
+			"Circuit breaker state by service (0=closed, 1=open, 2=half-open).",
+			[]string{"service"}, nil,
+		),
+		instancesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "service_instances"),
+			"Known service instances by service and status.",
+			[]string{"service", "status"}, nil,
+		),
+		poolSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "pool_connections"),
+			"Open pooled gRPC connections by kind.",
+			[]string{"kind"}, nil,
+		),
+		latencyEWMADesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "latency_ewma_seconds"),
+			"Exponentially weighted moving average of successful request latency.",
+			[]string{"service"}, nil,
+		),
+		latencyP99Desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "latency_percentile_seconds"),
+			"Latency percentile used to derive the adaptive timeout.",
+			[]string{"service"}, nil,
+		),
+		timeoutDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "adaptive_timeout_seconds"),
+			"Current adaptive per-attempt timeout by service.",
+			[]string{"service"}, nil,
+		),
+		bulkheadDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "bulkhead_slots"),
+			"Bulkhead slots by service and state (in_use, capacity).",
+			[]string{"service", "state"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *meshStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.circuitStateDesc
+	ch <- c.instancesDesc
+	ch <- c.poolSizeDesc
+	ch <- c.latencyEWMADesc
+	ch <- c.latencyP99Desc
+	ch <- c.timeoutDesc
+	ch <- c.bulkheadDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *meshStateCollector) Collect(ch chan<- prometheus.Metric) {
+	for svcType, cb := range c.client.circuitBreakers {
+		ch <- prometheus.MustNewConstMetric(c.circuitStateDesc, prometheus.GaugeValue,
+			float64(cb.State()), string(svcType))
+	}
+
+	services, instances := c.client.pool.size()
+	ch <- prometheus.MustNewConstMetric(c.poolSizeDesc, prometheus.GaugeValue, float64(services), "service")
+	ch <- prometheus.MustNewConstMetric(c.poolSizeDesc, prometheus.GaugeValue, float64(instances), "instance")
+
+	for svcType, stats := range c.client.timeouts.snapshot() {
+		ch <- prometheus.MustNewConstMetric(c.latencyEWMADesc, prometheus.GaugeValue, stats.ewma.Seconds(), string(svcType))
+		ch <- prometheus.MustNewConstMetric(c.latencyP99Desc, prometheus.GaugeValue, stats.quantile.Seconds(), string(svcType))
+		ch <- prometheus.MustNewConstMetric(c.timeoutDesc, prometheus.GaugeValue, stats.timeout.Seconds(), string(svcType))
+	}
+
+	for svcType, usage := range c.client.bulkheads.inUse() {
+		ch <- prometheus.MustNewConstMetric(c.bulkheadDesc, prometheus.GaugeValue, float64(usage[0]), string(svcType), "in_use")
+		ch <- prometheus.MustNewConstMetric(c.bulkheadDesc, prometheus.GaugeValue, float64(usage[1]), string(svcType), "capacity")
+	}
+
+	c.registry.mu.RLock()
+	defer c.registry.mu.RUnlock()
+
+	for svcType, instances := range c.registry.instances {
+		counts := make(map[InstanceStatus]int)
+		for _, inst := range instances {
+			counts[inst.Status]++
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.instancesDesc, prometheus.GaugeValue,
+				float64(count), string(svcType), string(status))
+		}
+	}
+}
+
+// NewMetricsRegistry builds a Prometheus registry containing the mesh
+// collectors plus the standard Go runtime and process collectors
+func NewMetricsRegistry(registry *ServiceRegistry, client *ServiceClient) (*prometheus.Registry, error) {
+	reg := prometheus.NewRegistry()
+
+	cs := []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.requestDuration,
+		metrics.retries,
+		metrics.healthCheckFailures,
+		metrics.poolDials,
+		metrics.poolEvictions,
+		metrics.shadowRequests,
+		metrics.shadowDuration,
+		metrics.shadowMismatches,
+		metrics.bulkheadRejections,
+		metrics.grpcProxyRequests,
+		metrics.grpcProxyDuration,
+		metrics.rateLimited,
+		newMeshStateCollector(registry, client),
+	}
+
+	for _, collector := range cs {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return reg, nil
+}
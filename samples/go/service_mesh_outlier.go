@@ -0,0 +1,186 @@
+package mesh
+
+import (
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// OutlierDetectionConfig configures passive per-instance outlier ejection
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int           // Failures before an instance is ejected
+	BaseEjectionTime    time.Duration // Cooldown for the first ejection, doubled on repeats
+	MaxEjectionTime     time.Duration // Upper bound for the cooldown
+	MaxEjectionPercent  int           // Never eject more than this share of a service
+	RecoveryPeriod      time.Duration // Ramp from 10% to 100% traffic after cooldown
+}
+
+// DefaultOutlierDetectionConfig returns default configuration
+func DefaultOutlierDetectionConfig() *OutlierDetectionConfig {
+	return &OutlierDetectionConfig{
+		ConsecutiveFailures: 5,
+		BaseEjectionTime:    30 * time.Second,
+		MaxEjectionTime:     5 * time.Minute,
+		MaxEjectionPercent:  50,
+		RecoveryPeriod:      60 * time.Second,
+	}
+}
+
+// minRecoveryShare is the fraction of traffic a reintroduced instance starts with
+const minRecoveryShare = 0.1
+
+// instanceOutlierState is the per-instance breaker state
+type instanceOutlierState struct {
+	serviceType         ServiceType
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+}
+
+// outlierDetector ejects consistently failing instances from load balancing
+// so that one bad replica does not take down traffic for its whole service
+type outlierDetector struct {
+	config *OutlierDetectionConfig
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	instances map[string]*instanceOutlierState
+}
+
+// newOutlierDetector creates an outlier detector
+func newOutlierDetector(config *OutlierDetectionConfig, logger *slog.Logger) *outlierDetector {
+	if config == nil {
+		config = DefaultOutlierDetectionConfig()
+	}
+	return &outlierDetector{
+		config:    config,
+		logger:    logger,
+		instances: make(map[string]*instanceOutlierState),
+	}
+}
+
+// record updates instance state with the outcome of a request
+func (d *outlierDetector) record(inst *ServiceInstance, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.instances[inst.ID]
+	if !ok {
+		state = &instanceOutlierState{serviceType: inst.Type}
+		d.instances[inst.ID] = state
+	}
+
+	now := time.Now()
+
+	if err == nil {
+		state.consecutiveFailures = 0
+		// Forget past ejections once an instance survives a full recovery period
+		if state.ejections > 0 && now.After(state.ejectedUntil.Add(d.config.RecoveryPeriod)) {
+			state.ejections = 0
+		}
+		return
+	}
+
+	state.consecutiveFailures++
+
+	// A failure while still recovering re-ejects immediately
+	recovering := state.ejections > 0 && now.Before(state.ejectedUntil.Add(d.config.RecoveryPeriod))
+	if state.consecutiveFailures < d.config.ConsecutiveFailures && !recovering {
+		return
+	}
+	if now.Before(state.ejectedUntil) || !d.canEjectLocked(inst.Type) {
+		return
+	}
+
+	cooldown := d.config.BaseEjectionTime << state.ejections
+	if cooldown > d.config.MaxEjectionTime || cooldown <= 0 {
+		cooldown = d.config.MaxEjectionTime
+	}
+
+	state.ejections++
+	state.ejectedUntil = now.Add(cooldown)
+	state.consecutiveFailures = 0
+
+	d.logger.Warn("instance ejected",
+		slog.String("type", string(inst.Type)),
+		slog.String("id", inst.ID),
+		slog.Int("ejections", state.ejections),
+		slog.Duration("cooldown", cooldown),
+	)
+}
+
+// canEjectLocked enforces MaxEjectionPercent (caller must hold lock)
+func (d *outlierDetector) canEjectLocked(serviceType ServiceType) bool {
+	now := time.Now()
+	total, ejected := 0, 0
+	for _, state := range d.instances {
+		if state.serviceType != serviceType {
+			continue
+		}
+		total++
+		if now.Before(state.ejectedUntil) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= total*d.config.MaxEjectionPercent
+}
+
+// filter removes ejected instances and probabilistically admits recovering
+// ones in proportion to how far through their recovery period they are.
+// If nothing remains the original set is returned rather than failing closed.
+func (d *outlierDetector) filter(instances []*ServiceInstance) []*ServiceInstance {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	admitted := make([]*ServiceInstance, 0, len(instances))
+
+	for _, inst := range instances {
+		state, ok := d.instances[inst.ID]
+		if !ok || state.ejections == 0 {
+			admitted = append(admitted, inst)
+			continue
+		}
+		if now.Before(state.ejectedUntil) {
+			continue
+		}
+
+		elapsed := now.Sub(state.ejectedUntil)
+		if elapsed >= d.config.RecoveryPeriod {
+			admitted = append(admitted, inst)
+			continue
+		}
+
+		share := minRecoveryShare + (1-minRecoveryShare)*float64(elapsed)/float64(d.config.RecoveryPeriod)
+		if rand.Float64() < share {
+			admitted = append(admitted, inst)
+		}
+	}
+
+	if len(admitted) == 0 {
+		return instances
+	}
+	return admitted
+}
+
+// isEjected reports whether an instance is currently in its ejection cooldown
+func (d *outlierDetector) isEjected(instanceID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.instances[instanceID]
+	return ok && time.Now().Before(state.ejectedUntil)
+}
+
+// forget drops state for instances that have left the registry
+func (d *outlierDetector) forget(present map[string]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id := range d.instances {
+		if !present[id] {
+			delete(d.instances, id)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package mesh
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyWindowSize is the number of recent responses kept per instance
+const latencyWindowSize = 32
+
+// instanceLatency is a sliding window of response times for one instance
+type instanceLatency struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	next    int
+	count   int
+	total   time.Duration
+}
+
+// record adds a response time to the window
+func (l *instanceLatency) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == latencyWindowSize {
+		l.total -= l.samples[l.next]
+	} else {
+		l.count++
+	}
+	l.samples[l.next] = d
+	l.total += d
+	l.next = (l.next + 1) % latencyWindowSize
+}
+
+// mean returns the average response time, or zero with no samples
+func (l *instanceLatency) mean() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return 0
+	}
+	return l.total / time.Duration(l.count)
+}
+
+// instanceLatencies tracks recent response times per instance ID
+var instanceLatencies sync.Map // map[string]*instanceLatency
+
+// observeLatency records a successful response time for an instance
+func (r *ServiceRegistry) observeLatency(inst *ServiceInstance, d time.Duration) {
+	latI, _ := instanceLatencies.LoadOrStore(inst.ID, &instanceLatency{})
+	latI.(*instanceLatency).record(d)
+}
+
+// p2cScore estimates how long a new request would wait on an instance.
+// Instances without samples score zero so they are tried promptly.
+func p2cScore(inst *ServiceInstance) float64 {
+	var inflight int64
+	if countI, ok := connectionCounts.Load(inst.ID); ok {
+		inflight = atomic.LoadInt64(countI.(*int64))
+	}
+
+	var mean time.Duration
+	if latI, ok := instanceLatencies.Load(inst.ID); ok {
+		mean = latI.(*instanceLatency).mean()
+	}
+
+	return float64(mean) * float64(inflight+1)
+}
+
+// leastLatency samples two distinct instances and picks the one with the
+// lower latency-weighted load (power of two choices)
+func (r *ServiceRegistry) leastLatency(instances []*ServiceInstance) *ServiceInstance {
+	if len(instances) == 1 {
+		return instances[0]
+	}
+
+	i := rand.Intn(len(instances))
+	j := rand.Intn(len(instances) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := instances[i], instances[j]
+	if p2cScore(b) < p2cScore(a) {
+		return b
+	}
+	return a
+}
+
+// forgetLatencies drops latency windows for instances no longer registered
+func forgetLatencies(present map[string]bool) {
+	instanceLatencies.Range(func(key, _ any) bool {
+		if !present[key.(string)] {
+			instanceLatencies.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,331 @@
+package mesh
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+)
+
+// ConnPoolConfig configures gRPC connection lifecycle management
+type ConnPoolConfig struct {
+	MaxIdle          time.Duration // Close connections unused for this long
+	ProbeInterval    time.Duration // How often connections are probed and swept
+	MaxFailedProbes  int           // Consecutive TRANSIENT_FAILURE probes before eviction
+	MaxInstanceConns int           // Cap on direct per-instance connections
+}
+
+// DefaultConnPoolConfig returns default configuration
+func DefaultConnPoolConfig() *ConnPoolConfig {
+	return &ConnPoolConfig{
+		MaxIdle:          10 * time.Minute,
+		ProbeInterval:    30 * time.Second,
+		MaxFailedProbes:  3,
+		MaxInstanceConns: 256,
+	}
+}
+
+// Eviction reasons reported in pool metrics
+const (
+	evictIdle      = "idle"
+	evictVanished  = "vanished"
+	evictUnhealthy = "unhealthy"
+	evictCapacity  = "capacity"
+	evictShutdown  = "shutdown"
+)
+
+// pooledConn is a connection tracked by the pool
+type pooledConn struct {
+	conn         *grpc.ClientConn
+	serviceType  ServiceType
+	instanceID   string // Empty for resolver-backed service connections
+	lastUsed     time.Time
+	failedProbes int
+}
+
+// connPool owns every gRPC connection a ServiceClient opens. Service
+// connections go through the registry resolver; instance connections dial a
+// single instance directly (health probing, sidecar passthrough).
+type connPool struct {
+	registry        *ServiceRegistry
+	resolverBuilder resolver.Builder
+	config          *ConnPoolConfig
+	logger          *slog.Logger
+
+	mu        sync.Mutex
+	services  map[ServiceType]*pooledConn
+	instances map[string]*pooledConn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newConnPool creates a pool and starts its sweeper
+func newConnPool(registry *ServiceRegistry, config *ConnPoolConfig, logger *slog.Logger) *connPool {
+	if config == nil {
+		config = DefaultConnPoolConfig()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pool := &connPool{
+		registry:        registry,
+		resolverBuilder: NewResolverBuilder(registry, logger),
+		config:          config,
+		logger:          logger,
+		services:        make(map[ServiceType]*pooledConn),
+		instances:       make(map[string]*pooledConn),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+
+	go pool.sweeper()
+
+	return pool
+}
+
+// dialOptions returns the options shared by every pooled connection
+func (p *connPool) dialOptions(useTLS bool) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                10 * time.Second,
+			Timeout:             3 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		// Trace every RPC on this connection and propagate context via metadata
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		// Carry caller, priority, and tenant alongside the native deadline
+		grpc.WithChainUnaryInterceptor(p.registry.callMetadataUnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(p.registry.callMetadataStreamClientInterceptor),
+	}
+
+	// Use TLS in production
+	if useTLS {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	return opts
+}
+
+// serviceConn returns the resolver-backed connection for a service type
+func (p *connPool) serviceConn(ctx context.Context, serviceType ServiceType) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	if pc, ok := p.services[serviceType]; ok {
+		pc.lastUsed = time.Now()
+		p.mu.Unlock()
+		return pc.conn, nil
+	}
+	p.mu.Unlock()
+
+	instances := p.registry.GetInstances(serviceType)
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no healthy instances of %s available", serviceType)
+	}
+
+	grpcCapable, useTLS := false, false
+	for _, inst := range instances {
+		if inst.GRPCPort != 0 {
+			grpcCapable = true
+			useTLS = useTLS || inst.Metadata["tls"] == "true"
+		}
+	}
+	if !grpcCapable {
+		return nil, fmt.Errorf("service %s does not support gRPC", serviceType)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Double-check after reacquiring the lock
+	if pc, ok := p.services[serviceType]; ok {
+		pc.lastUsed = time.Now()
+		return pc.conn, nil
+	}
+
+	opts := append(p.dialOptions(useTLS), grpc.WithResolvers(p.resolverBuilder))
+	conn, err := grpc.DialContext(ctx, GRPCTarget(serviceType), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", serviceType, err)
+	}
+
+	p.services[serviceType] = &pooledConn{conn: conn, serviceType: serviceType, lastUsed: time.Now()}
+	metrics.poolDials.WithLabelValues("service").Inc()
+
+	return conn, nil
+}
+
+// instanceConn returns a direct connection to a single instance
+func (p *connPool) instanceConn(ctx context.Context, inst *ServiceInstance) (*grpc.ClientConn, error) {
+	if inst.GRPCPort == 0 {
+		return nil, fmt.Errorf("instance %s does not support gRPC", inst.ID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc, ok := p.instances[inst.ID]; ok {
+		pc.lastUsed = time.Now()
+		return pc.conn, nil
+	}
+
+	if len(p.instances) >= p.config.MaxInstanceConns {
+		p.evictLeastRecentLocked()
+	}
+
+	addr := net.JoinHostPort(inst.Host, strconv.Itoa(inst.GRPCPort))
+	conn, err := grpc.DialContext(ctx, addr, p.dialOptions(inst.Metadata["tls"] == "true")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to instance %s: %w", inst.ID, err)
+	}
+
+	p.instances[inst.ID] = &pooledConn{
+		conn:        conn,
+		serviceType: inst.Type,
+		instanceID:  inst.ID,
+		lastUsed:    time.Now(),
+	}
+	metrics.poolDials.WithLabelValues("instance").Inc()
+
+	return conn, nil
+}
+
+// evictLeastRecentLocked closes the least recently used instance connection
+// (caller must hold lock)
+func (p *connPool) evictLeastRecentLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, pc := range p.instances {
+		if oldestID == "" || pc.lastUsed.Before(oldest) {
+			oldestID, oldest = id, pc.lastUsed
+		}
+	}
+	if oldestID != "" {
+		p.closeLocked(p.instances[oldestID], evictCapacity)
+		delete(p.instances, oldestID)
+	}
+}
+
+// closeLocked closes a pooled connection and records why (caller must hold lock)
+func (p *connPool) closeLocked(pc *pooledConn, reason string) {
+	pc.conn.Close()
+	metrics.poolEvictions.WithLabelValues(reason).Inc()
+
+	p.logger.Debug("pooled connection closed",
+		slog.String("service", string(pc.serviceType)),
+		slog.String("instance_id", pc.instanceID),
+		slog.String("reason", reason),
+	)
+}
+
+// sweeper periodically probes and evicts connections
+func (p *connPool) sweeper() {
+	ticker := time.NewTicker(p.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.sweep()
+		}
+	}
+}
+
+// sweep evicts idle connections, connections to instances that have left
+// the registry, and connections stuck in TRANSIENT_FAILURE
+func (p *connPool) sweep() {
+	present := make(map[string]bool)
+	for _, inst := range p.registry.allInstances() {
+		present[inst.ID] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	for id, pc := range p.instances {
+		if reason := p.evictionReason(pc, now, present[id]); reason != "" {
+			p.closeLocked(pc, reason)
+			delete(p.instances, id)
+		}
+	}
+
+	for svcType, pc := range p.services {
+		// Resolver-backed connections heal themselves; only evict when idle
+		// or when the service has disappeared entirely
+		vanished := len(p.registry.GetInstances(svcType)) == 0
+		if now.Sub(pc.lastUsed) > p.config.MaxIdle || (vanished && now.Sub(pc.lastUsed) > p.config.ProbeInterval) {
+			reason := evictIdle
+			if vanished {
+				reason = evictVanished
+			}
+			p.closeLocked(pc, reason)
+			delete(p.services, svcType)
+		}
+	}
+}
+
+// evictionReason decides whether an instance connection should be closed
+func (p *connPool) evictionReason(pc *pooledConn, now time.Time, present bool) string {
+	if !present {
+		return evictVanished
+	}
+	if now.Sub(pc.lastUsed) > p.config.MaxIdle {
+		return evictIdle
+	}
+
+	switch pc.conn.GetState() {
+	case connectivity.Shutdown:
+		return evictUnhealthy
+	case connectivity.TransientFailure:
+		pc.failedProbes++
+		if pc.failedProbes >= p.config.MaxFailedProbes {
+			return evictUnhealthy
+		}
+	case connectivity.Idle:
+		// Nudge idle connections so the next probe reflects real reachability
+		pc.conn.Connect()
+		pc.failedProbes = 0
+	default:
+		pc.failedProbes = 0
+	}
+	return ""
+}
+
+// size returns the number of open connections by kind
+func (p *connPool) size() (services, instances int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.services), len(p.instances)
+}
+
+// close shuts down the sweeper and every pooled connection
+func (p *connPool) close() {
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for svcType, pc := range p.services {
+		p.closeLocked(pc, evictShutdown)
+		delete(p.services, svcType)
+	}
+	for id, pc := range p.instances {
+		p.closeLocked(pc, evictShutdown)
+		delete(p.instances, id)
+	}
+}
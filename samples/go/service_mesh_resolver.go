@@ -0,0 +1,167 @@
+package mesh
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+
+	// Registers the client-side health checking function used by healthCheckConfig
+	_ "google.golang.org/grpc/health"
+)
+
+// ResolverScheme is the gRPC target scheme served by the registry,
+// e.g. "lilo:///ai-router"
+const ResolverScheme = "lilo"
+
+// resolverRefreshInterval matches the registry's instance sync interval
+const resolverRefreshInterval = 5 * time.Second
+
+// instanceIDAttributeKey tags resolved addresses with their instance ID
+type instanceIDAttributeKey struct{}
+
+// serviceConfigTemplate enables round-robin balancing and per-subconn health
+// checking against the gRPC health service for the target service name
+const serviceConfigTemplate = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": %q}
+}`
+
+// GRPCTarget returns the registry-backed gRPC target for a service type
+func GRPCTarget(serviceType ServiceType) string {
+	return fmt.Sprintf("%s:///%s", ResolverScheme, serviceType)
+}
+
+// registryResolverBuilder builds resolvers that read from a ServiceRegistry
+type registryResolverBuilder struct {
+	registry *ServiceRegistry
+	logger   *slog.Logger
+}
+
+// NewResolverBuilder returns a gRPC resolver.Builder for the lilo scheme.
+// Pass it per connection with grpc.WithResolvers, or register it globally
+// with resolver.Register.
+func NewResolverBuilder(registry *ServiceRegistry, logger *slog.Logger) resolver.Builder {
+	return &registryResolverBuilder{registry: registry, logger: logger}
+}
+
+// Scheme implements resolver.Builder
+func (b *registryResolverBuilder) Scheme() string {
+	return ResolverScheme
+}
+
+// Build implements resolver.Builder
+func (b *registryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	serviceType := ServiceType(strings.TrimPrefix(target.URL.Path, "/"))
+	if serviceType == "" {
+		return nil, fmt.Errorf("missing service type in target %q", target.URL.String())
+	}
+
+	r := &registryResolver{
+		registry:    b.registry,
+		serviceType: serviceType,
+		cc:          cc,
+		logger:      b.logger,
+		resolveNow:  make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	r.resolve()
+	go r.watch()
+
+	return r, nil
+}
+
+// registryResolver pushes registry membership for one service to gRPC
+type registryResolver struct {
+	registry    *ServiceRegistry
+	serviceType ServiceType
+	cc          resolver.ClientConn
+	logger      *slog.Logger
+
+	resolveNow chan struct{}
+	done       chan struct{}
+	lastState  string
+}
+
+// ResolveNow implements resolver.Resolver
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close implements resolver.Resolver
+func (r *registryResolver) Close() {
+	close(r.done)
+}
+
+// watch re-resolves on a timer and whenever gRPC asks
+func (r *registryResolver) watch() {
+	ticker := time.NewTicker(resolverRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.registry.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+		r.resolve()
+	}
+}
+
+// resolve publishes the current gRPC-capable instances, skipping the update
+// when membership hasn't changed so subconns aren't churned
+func (r *registryResolver) resolve() {
+	instances := r.registry.GetInstances(r.serviceType)
+
+	addrs := make([]resolver.Address, 0, len(instances))
+	keys := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		if inst.GRPCPort == 0 || r.registry.outliers.isEjected(inst.ID) {
+			continue
+		}
+		addr := net.JoinHostPort(inst.Host, strconv.Itoa(inst.GRPCPort))
+		addrs = append(addrs, resolver.Address{
+			Addr:               addr,
+			BalancerAttributes: attributes.New(instanceIDAttributeKey{}, inst.ID),
+		})
+		keys = append(keys, addr)
+	}
+
+	if len(addrs) == 0 {
+		r.lastState = ""
+		r.cc.ReportError(fmt.Errorf("no healthy gRPC instances of %s available", r.serviceType))
+		return
+	}
+
+	sort.Strings(keys)
+	state := strings.Join(keys, ",")
+	if state == r.lastState {
+		return
+	}
+
+	if err := r.cc.UpdateState(resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: r.cc.ParseServiceConfig(fmt.Sprintf(serviceConfigTemplate, r.serviceType)),
+	}); err != nil {
+		r.logger.Warn("resolver state update rejected",
+			slog.String("service", string(r.serviceType)),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	r.lastState = state
+}
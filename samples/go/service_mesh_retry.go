@@ -0,0 +1,285 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryBudgetConfig limits retries to a share of recent traffic so that
+// retries cannot multiply load on a service that is already failing
+type RetryBudgetConfig struct {
+	Ratio               float64       // Max retries as a fraction of requests (0.2 = 20%)
+	MinRetriesPerSecond int           // Floor so low-traffic services can still retry
+	Window              time.Duration // Sliding window for counting requests
+}
+
+// DefaultRetryBudgetConfig returns default configuration
+func DefaultRetryBudgetConfig() *RetryBudgetConfig {
+	return &RetryBudgetConfig{
+		Ratio:               0.2,
+		MinRetriesPerSecond: 10,
+		Window:              10 * time.Second,
+	}
+}
+
+// HedgingConfig configures hedged requests for idempotent calls
+type HedgingConfig struct {
+	Enabled     bool
+	Delay       time.Duration // Latency after which another attempt is fired
+	MaxAttempts int           // Total attempts including the original
+}
+
+// DefaultHedgingConfig returns default configuration (disabled)
+func DefaultHedgingConfig() *HedgingConfig {
+	return &HedgingConfig{
+		Enabled:     false,
+		Delay:       200 * time.Millisecond,
+		MaxAttempts: 2,
+	}
+}
+
+// budgetBuckets is the number of buckets the budget window is split into
+const budgetBuckets = 10
+
+// retryBudget tracks requests and retries for one service over a sliding window
+type retryBudget struct {
+	config *RetryBudgetConfig
+
+	mu       sync.Mutex
+	requests [budgetBuckets]int
+	retries  [budgetBuckets]int
+	bucketAt [budgetBuckets]int64
+}
+
+// retryBudgets holds a budget per service type
+type retryBudgets struct {
+	config  *RetryBudgetConfig
+	budgets sync.Map // map[ServiceType]*retryBudget
+}
+
+// newRetryBudgets creates per-service retry budgets
+func newRetryBudgets(config *RetryBudgetConfig) *retryBudgets {
+	if config == nil {
+		config = DefaultRetryBudgetConfig()
+	}
+	return &retryBudgets{config: config}
+}
+
+// forService returns the budget for a service type
+func (b *retryBudgets) forService(serviceType ServiceType) *retryBudget {
+	budgetI, _ := b.budgets.LoadOrStore(serviceType, &retryBudget{config: b.config})
+	return budgetI.(*retryBudget)
+}
+
+// bucketLocked returns the current bucket index, clearing it if it has
+// rolled over since last use (caller must hold lock)
+func (b *retryBudget) bucketLocked(now time.Time) int {
+	width := int64(b.config.Window) / budgetBuckets
+	if width <= 0 {
+		width = int64(time.Second)
+	}
+	slot := now.UnixNano() / width
+	idx := int(slot % budgetBuckets)
+	if b.bucketAt[idx] != slot {
+		b.bucketAt[idx] = slot
+		b.requests[idx] = 0
+		b.retries[idx] = 0
+	}
+	return idx
+}
+
+// totalsLocked sums requests and retries within the window (caller must hold lock)
+func (b *retryBudget) totalsLocked(now time.Time) (requests, retries int) {
+	width := int64(b.config.Window) / budgetBuckets
+	if width <= 0 {
+		width = int64(time.Second)
+	}
+	oldest := now.UnixNano()/width - budgetBuckets + 1
+	for i := 0; i < budgetBuckets; i++ {
+		if b.bucketAt[i] >= oldest {
+			requests += b.requests[i]
+			retries += b.retries[i]
+		}
+	}
+	return requests, retries
+}
+
+// recordRequest counts an original (non-retry) request
+func (b *retryBudget) recordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requests[b.bucketLocked(time.Now())]++
+}
+
+// tryRetry reserves a retry if the budget allows it
+func (b *retryBudget) tryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	idx := b.bucketLocked(now)
+	requests, retries := b.totalsLocked(now)
+
+	allowed := int(float64(requests) * b.config.Ratio)
+	if floor := int(float64(b.config.MinRetriesPerSecond) * b.config.Window.Seconds()); allowed < floor {
+		allowed = floor
+	}
+
+	if retries >= allowed {
+		return false
+	}
+
+	b.retries[idx]++
+	return true
+}
+
+// isIdempotent reports whether an HTTP method is safe to repeat
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordRetry records a retry attempt in metrics and on the active span
+func recordRetry(ctx context.Context, serviceType ServiceType, attempt int) {
+	if serviceType != "" {
+		metrics.retries.WithLabelValues(string(serviceType)).Inc()
+	}
+	if stats := callStatsFromContext(ctx); stats != nil {
+		stats.addRetry()
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attrRetryCount.Int(attempt))
+	span.AddEvent("retry", trace.WithAttributes(attrRetryCount.Int(attempt)))
+}
+
+// hedgeResult carries the outcome of one hedged attempt
+type hedgeResult struct {
+	index  int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedgedCall sends the request to one instance and, if no response arrives
+// within the hedging delay, fires another attempt at a different instance.
+// The first successful response wins and the others are cancelled.
+func (c *ServiceClient) hedgedCall(ctx context.Context, serviceType ServiceType, method, path string, budget *retryBudget) (*http.Response, error) {
+	maxAttempts := c.hedging.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	results := make(chan hedgeResult, maxAttempts)
+	tried := make(map[string]bool)
+	cancels := make([]context.CancelFunc, 0, maxAttempts)
+
+	launch := func() error {
+		instance, err := c.pickInstance(ctx, serviceType, tried)
+		if err != nil {
+			return err
+		}
+		tried[instance.ID] = true
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := c.callInstance(attemptCtx, serviceType, instance, method, path, nil)
+			results <- hedgeResult{index: index, resp: resp, err: err, cancel: cancel}
+		}()
+		return nil
+	}
+
+	if err := launch(); err != nil {
+		return nil, err
+	}
+	launched, inflight := 1, 1
+
+	timer := time.NewTimer(c.hedging.Delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for inflight > 0 {
+		select {
+		case <-ctx.Done():
+			for _, cancel := range cancels {
+				cancel()
+			}
+			go drainHedges(results, inflight)
+			return nil, ctx.Err()
+
+		case <-timer.C:
+			if launched < maxAttempts && budget.tryRetry() && launch() == nil {
+				recordRetry(ctx, serviceType, launched)
+				launched++
+				inflight++
+				timer.Reset(c.hedging.Delay)
+			}
+
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				// Cancel the losers; the winner's context lives until its body is closed
+				for i, cancel := range cancels {
+					if i != res.index {
+						cancel()
+					}
+				}
+				go drainHedges(results, inflight)
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+				return res.resp, nil
+			}
+
+			res.cancel()
+			lastErr = res.err
+			if errors.Is(res.err, ErrBulkheadFull) {
+				continue
+			}
+
+			// Fail fast: replace a failed attempt immediately rather than waiting
+			if launched < maxAttempts && budget.tryRetry() && launch() == nil {
+				recordRetry(ctx, serviceType, launched)
+				launched++
+				inflight++
+			}
+		}
+	}
+
+	return nil, lastErr
+}
+
+// drainHedges closes responses from attempts that finished after a winner
+func drainHedges(results <-chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		res := <-results
+		res.cancel()
+		if res.resp != nil {
+			res.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases an attempt's context once the caller closes the body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the attempt context
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
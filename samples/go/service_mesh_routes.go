@@ -0,0 +1,214 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RoutePolicy overrides client-wide behavior for matching requests. Zero
+// values fall back to the client's defaults.
+type RoutePolicy struct {
+	MaxRetries     *int                  `json:"max_retries,omitempty"` // nil inherits; 0 disables retries and hedging
+	Timeout        time.Duration         `json:"timeout,omitempty"`     // Fixed per-attempt timeout
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	RateLimit      float64               `json:"rate_limit,omitempty"` // Requests per second
+	RateBurst      int                   `json:"rate_burst,omitempty"`
+}
+
+// Route applies a policy to requests for a service whose path starts with
+// PathPrefix, e.g. no retries on POST /generate
+type Route struct {
+	ServiceType ServiceType `json:"service_type"`
+	PathPrefix  string      `json:"path_prefix"`
+	Methods     []string    `json:"methods,omitempty"` // Empty matches every method
+	Policy      RoutePolicy `json:"policy"`
+}
+
+// ErrInvalidRoute is returned when a route fails validation
+var ErrInvalidRoute = errors.New("invalid route")
+
+// ErrRateLimited is returned when a route's rate limit is exceeded
+var ErrRateLimited = errors.New("route rate limit exceeded")
+
+// Validate checks a route for consistency
+func (rt *Route) Validate() error {
+	if rt.ServiceType == "" {
+		return fmt.Errorf("%w: service type required", ErrInvalidRoute)
+	}
+	if !strings.HasPrefix(rt.PathPrefix, "/") {
+		return fmt.Errorf("%w: path prefix must start with /", ErrInvalidRoute)
+	}
+	if rt.Policy.MaxRetries != nil && *rt.Policy.MaxRetries < 0 {
+		return fmt.Errorf("%w: max retries cannot be negative", ErrInvalidRoute)
+	}
+	if rt.Policy.RateLimit < 0 {
+		return fmt.Errorf("%w: rate limit cannot be negative", ErrInvalidRoute)
+	}
+	return nil
+}
+
+// name identifies a route in logs and metrics
+func (rt *Route) name() string {
+	return string(rt.ServiceType) + rt.PathPrefix
+}
+
+// matches reports whether the route applies to a request
+func (rt *Route) matches(method, path string) bool {
+	if !strings.HasPrefix(path, rt.PathPrefix) {
+		return false
+	}
+	if len(rt.Methods) == 0 {
+		return true
+	}
+	for _, m := range rt.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeRoute is a route with its runtime state
+type activeRoute struct {
+	*Route
+	breaker *CircuitBreaker
+	limiter *rate.Limiter
+}
+
+// allowsRetries reports whether retries and hedging are permitted
+func (ar *activeRoute) allowsRetries() bool {
+	return ar.Policy.MaxRetries == nil || *ar.Policy.MaxRetries > 0
+}
+
+// routeTable holds routes per service, longest prefix first
+type routeTable struct {
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	routes map[ServiceType][]*activeRoute
+}
+
+// newRouteTable creates an empty route table
+func newRouteTable(logger *slog.Logger) *routeTable {
+	return &routeTable{
+		logger: logger,
+		routes: make(map[ServiceType][]*activeRoute),
+	}
+}
+
+// SetRoutes replaces the client's routing table
+func (c *ServiceClient) SetRoutes(routes []*Route) error {
+	table := make(map[ServiceType][]*activeRoute)
+	for _, rt := range routes {
+		if err := rt.Validate(); err != nil {
+			return err
+		}
+
+		ar := &activeRoute{Route: rt}
+		if cbConfig := rt.Policy.CircuitBreaker; cbConfig != nil {
+			named := *cbConfig
+			named.Name = rt.name()
+			ar.breaker = NewCircuitBreaker(&named, c.logger)
+		}
+		if rt.Policy.RateLimit > 0 {
+			burst := rt.Policy.RateBurst
+			if burst <= 0 {
+				burst = 1
+			}
+			ar.limiter = rate.NewLimiter(rate.Limit(rt.Policy.RateLimit), burst)
+		}
+		table[rt.ServiceType] = append(table[rt.ServiceType], ar)
+	}
+
+	for _, routes := range table {
+		sort.SliceStable(routes, func(i, j int) bool {
+			return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+		})
+	}
+
+	c.routes.mu.Lock()
+	c.routes.routes = table
+	c.routes.mu.Unlock()
+
+	c.logger.Info("routing table updated", slog.Int("routes", len(routes)))
+	return nil
+}
+
+// match returns the most specific route for a request, or nil
+func (t *routeTable) match(serviceType ServiceType, method, path string) *activeRoute {
+	path, _, _ = strings.Cut(path, "?")
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, ar := range t.routes[serviceType] {
+		if ar.matches(method, path) {
+			return ar
+		}
+	}
+	return nil
+}
+
+// routeCtx is the context key for the matched route
+type routeCtx struct{}
+
+// withRoute attaches the matched route to a call's context
+func withRoute(ctx context.Context, route *activeRoute) context.Context {
+	return context.WithValue(ctx, routeCtx{}, route)
+}
+
+// routeFromContext returns the matched route, if any
+func routeFromContext(ctx context.Context) *activeRoute {
+	route, _ := ctx.Value(routeCtx{}).(*activeRoute)
+	return route
+}
+
+// breakerFor returns the route's breaker when it has one, otherwise the
+// service breaker
+func (c *ServiceClient) breakerFor(ctx context.Context, serviceType ServiceType) *CircuitBreaker {
+	if route := routeFromContext(ctx); route != nil && route.breaker != nil {
+		return route.breaker
+	}
+	return c.circuitBreakers[serviceType]
+}
+
+// maxRetriesFor returns the retry limit for a call
+func (c *ServiceClient) maxRetriesFor(ctx context.Context) int {
+	if route := routeFromContext(ctx); route != nil && route.Policy.MaxRetries != nil {
+		return *route.Policy.MaxRetries
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxRetries
+}
+
+// applyRoute matches a request to a route, enforces its rate limit, and
+// returns a context carrying the route's policy
+func (c *ServiceClient) applyRoute(ctx context.Context, serviceType ServiceType, method, path string) (context.Context, error) {
+	route := c.routes.match(serviceType, method, path)
+	if route == nil {
+		return ctx, nil
+	}
+
+	if route.limiter != nil && !route.limiter.Allow() {
+		metrics.rateLimited.WithLabelValues(string(serviceType), route.PathPrefix).Inc()
+		return ctx, ErrRateLimited
+	}
+
+	// An explicit per-call timeout still wins over the route's
+	if route.Policy.Timeout > 0 {
+		if _, ok := ctx.Value(callTimeoutCtx{}).(time.Duration); !ok {
+			ctx = WithCallTimeout(ctx, route.Policy.Timeout)
+		}
+	}
+
+	return withRoute(ctx, route), nil
+}
@@ -0,0 +1,266 @@
+package mesh
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shadowHeader marks mirrored requests so shadow services can suppress side
+// effects such as notifications or crisis escalations
+const shadowHeader = "X-Shadow-Request"
+
+// maxInflightShadows caps concurrent mirrored requests so shadowing never
+// competes with production traffic for sidecar resources
+const maxInflightShadows = 64
+
+// Shadow outcomes reported in metrics
+const (
+	shadowSuccess = "success"
+	shadowError   = "error"
+	shadowDropped = "dropped"
+)
+
+// ShadowConfig mirrors a share of a service's traffic to another service
+// (typically a new build registered under its own service type). Shadow
+// responses are always discarded.
+type ShadowConfig struct {
+	ServiceType  ServiceType   `json:"service_type"`   // Primary traffic to mirror
+	Target       ServiceType   `json:"target"`         // Service receiving mirrored copies
+	Percent      float64       `json:"percent"`        // Share of requests mirrored, 0-100
+	MaxBodyBytes int64         `json:"max_body_bytes"` // Larger requests are not mirrored
+	Timeout      time.Duration `json:"timeout"`
+}
+
+// DefaultShadowConfig returns default configuration
+func DefaultShadowConfig(serviceType, target ServiceType) *ShadowConfig {
+	return &ShadowConfig{
+		ServiceType:  serviceType,
+		Target:       target,
+		Percent:      10,
+		MaxBodyBytes: 1 << 20,
+		Timeout:      5 * time.Second,
+	}
+}
+
+// ErrInvalidShadowConfig is returned when a shadow config fails validation
+var ErrInvalidShadowConfig = errors.New("invalid shadow config")
+
+// Validate checks a shadow config for consistency
+func (c *ShadowConfig) Validate() error {
+	if c.ServiceType == "" || c.Target == "" {
+		return fmt.Errorf("%w: service type and target required", ErrInvalidShadowConfig)
+	}
+	if c.ServiceType == c.Target {
+		return fmt.Errorf("%w: target must differ from the primary service", ErrInvalidShadowConfig)
+	}
+	if c.Percent <= 0 || c.Percent > 100 {
+		return fmt.Errorf("%w: percent must be in (0, 100]", ErrInvalidShadowConfig)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("%w: timeout must be positive", ErrInvalidShadowConfig)
+	}
+	return nil
+}
+
+// shadower mirrors sampled sidecar traffic to shadow services
+type shadower struct {
+	registry   *ServiceRegistry
+	client     *ServiceClient // For the upstream scheme of shadow instances
+	httpClient *http.Client
+	logger     *slog.Logger
+	slots      chan struct{}
+
+	mu      sync.RWMutex
+	configs map[ServiceType]*ShadowConfig
+}
+
+// newShadower creates a shadower with no active mirrors
+func newShadower(registry *ServiceRegistry, client *ServiceClient, logger *slog.Logger) *shadower {
+	return &shadower{
+		registry: registry,
+		client:   client,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:        20,
+				MaxIdleConnsPerHost: 5,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		logger:  logger,
+		slots:   make(chan struct{}, maxInflightShadows),
+		configs: make(map[ServiceType]*ShadowConfig),
+	}
+}
+
+// SetShadow starts mirroring traffic for a service
+func (s *Sidecar) SetShadow(config *ShadowConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	s.shadows.mu.Lock()
+	s.shadows.configs[config.ServiceType] = config
+	s.shadows.mu.Unlock()
+
+	s.logger.Info("traffic shadowing enabled",
+		slog.String("service", string(config.ServiceType)),
+		slog.String("target", string(config.Target)),
+		slog.Float64("percent", config.Percent),
+	)
+	return nil
+}
+
+// ClearShadow stops mirroring traffic for a service
+func (s *Sidecar) ClearShadow(serviceType ServiceType) {
+	s.shadows.mu.Lock()
+	delete(s.shadows.configs, serviceType)
+	s.shadows.mu.Unlock()
+}
+
+// shadowRequest is a sampled request waiting to be mirrored
+type shadowRequest struct {
+	config  *ShadowConfig
+	method  string
+	path    string
+	header  http.Header
+	body    []byte
+	primary chan int
+}
+
+// prepare samples a request for mirroring. It returns the body the primary
+// call should use and, when sampled, the pending shadow request. ctx carries
+// the caller's verified identity.
+func (s *shadower) prepare(ctx context.Context, r *http.Request, serviceType ServiceType) (io.Reader, *shadowRequest) {
+	s.mu.RLock()
+	config, ok := s.configs[serviceType]
+	s.mu.RUnlock()
+
+	if !ok || rand.Float64()*100 >= config.Percent {
+		return r.Body, nil
+	}
+
+	var body []byte
+	if r.Body != nil {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, config.MaxBodyBytes+1))
+		if err != nil || int64(len(buf)) > config.MaxBodyBytes {
+			// Too large (or unreadable) to mirror; hand back what was consumed
+			metrics.shadowRequests.WithLabelValues(string(serviceType), shadowDropped).Inc()
+			return io.MultiReader(bytes.NewReader(buf), r.Body), nil
+		}
+		body = buf
+	}
+
+	// Like the primary call, the shadow gets the verified identity and never
+	// the caller's token or identity headers
+	header := r.Header.Clone()
+	header.Set(shadowHeader, "true")
+	header.Del("X-Target-Service")
+	header.Del("Authorization")
+	setIdentityHeaders(ctx, header)
+
+	sr := &shadowRequest{
+		config:  config,
+		method:  r.Method,
+		path:    r.URL.Path,
+		header:  header,
+		body:    body,
+		primary: make(chan int, 1),
+	}
+
+	if body == nil {
+		return nil, sr
+	}
+	return bytes.NewReader(body), sr
+}
+
+// mirror sends the shadow request in the background. Requests are dropped
+// rather than queued when too many mirrors are already in flight.
+func (s *shadower) mirror(sr *shadowRequest) {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		metrics.shadowRequests.WithLabelValues(string(sr.config.ServiceType), shadowDropped).Inc()
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+
+		status, err := s.send(sr)
+		if err != nil {
+			metrics.shadowRequests.WithLabelValues(string(sr.config.ServiceType), shadowError).Inc()
+			s.logger.Debug("shadow request failed",
+				slog.String("target", string(sr.config.Target)),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		metrics.shadowRequests.WithLabelValues(string(sr.config.ServiceType), shadowSuccess).Inc()
+
+		// Compare against the primary once it completes
+		select {
+		case primary := <-sr.primary:
+			if primary != status {
+				metrics.shadowMismatches.WithLabelValues(string(sr.config.ServiceType)).Inc()
+			}
+		case <-time.After(sr.config.Timeout):
+		}
+	}()
+}
+
+// enableUpstreamTLS switches mirrored requests to HTTPS along with the
+// client's
+func (s *shadower) enableUpstreamTLS(tlsConfig *tls.Config) {
+	if transport, ok := s.httpClient.Transport.(*http.Transport); ok {
+		transport.TLSClientConfig = tlsConfig
+	}
+}
+
+// send performs the mirrored request and discards the response body
+func (s *shadower) send(sr *shadowRequest) (int, error) {
+	instance, err := s.registry.GetInstance(sr.config.Target, LoadBalanceRoundRobin)
+	if err != nil {
+		return 0, err
+	}
+
+	// Detached from the caller's context so client disconnects don't skew results
+	ctx, cancel := context.WithTimeout(context.Background(), sr.config.Timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s://%s:%d%s", s.client.upstreamScheme(instance), instance.Host, instance.Port, sr.path)
+	req, err := http.NewRequestWithContext(ctx, sr.method, url, bytes.NewReader(sr.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = sr.header
+
+	startTime := time.Now()
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	metrics.shadowDuration.WithLabelValues(string(sr.config.ServiceType), string(sr.config.Target)).
+		Observe(time.Since(startTime).Seconds())
+
+	return resp.StatusCode, nil
+}
+
+// complete reports the primary response status for comparison
+func (sr *shadowRequest) complete(statusCode int) {
+	select {
+	case sr.primary <- statusCode:
+	default:
+	}
+}
@@ -0,0 +1,80 @@
+package mesh
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SlowStartConfig ramps traffic to instances that just became healthy so
+// cold JIT and model caches don't take a full share of load at once
+type SlowStartConfig struct {
+	Window   time.Duration // Time to ramp from MinShare to a full share
+	MinShare float64       // Share of traffic at the start of the window, e.g. 0.1
+}
+
+// DefaultSlowStartConfig returns default configuration
+func DefaultSlowStartConfig() *SlowStartConfig {
+	return &SlowStartConfig{
+		Window:   2 * time.Minute,
+		MinShare: 0.1,
+	}
+}
+
+// slowStartShare returns the share of traffic an instance should receive,
+// or 1 once it has warmed up
+func (r *ServiceRegistry) slowStartShare(inst *ServiceInstance, now time.Time) float64 {
+	if r.slowStart == nil || r.slowStart.Window <= 0 {
+		return 1
+	}
+
+	since, ok := r.health.healthySince(inst.ID)
+	if !ok {
+		return 1
+	}
+
+	// Instances that were already running when first seen (e.g. when this
+	// process starts) are warm; only freshly started ones ramp
+	if !inst.StartedAt.IsZero() && since.Sub(inst.StartedAt) > r.slowStart.Window {
+		return 1
+	}
+
+	elapsed := now.Sub(since)
+	if elapsed >= r.slowStart.Window {
+		return 1
+	}
+	return r.slowStart.MinShare + (1-r.slowStart.MinShare)*float64(elapsed)/float64(r.slowStart.Window)
+}
+
+// slowStartFilter probabilistically admits warming instances in proportion
+// to their ramp share. If nothing remains the original set is returned.
+func (r *ServiceRegistry) slowStartFilter(instances []*ServiceInstance) []*ServiceInstance {
+	if r.slowStart == nil {
+		return instances
+	}
+
+	now := time.Now()
+	admitted := make([]*ServiceInstance, 0, len(instances))
+	for _, inst := range instances {
+		share := r.slowStartShare(inst, now)
+		if share >= 1 || rand.Float64() < share {
+			admitted = append(admitted, inst)
+		}
+	}
+
+	if len(admitted) == 0 {
+		return instances
+	}
+	return admitted
+}
+
+// healthySince returns when an instance last became healthy
+func (t *healthTracker) healthySince(id string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.states[id]
+	if !ok || state.status != InstanceStatusHealthy || state.healthySince.IsZero() {
+		return time.Time{}, false
+	}
+	return state.healthySince, true
+}
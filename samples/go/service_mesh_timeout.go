@@ -0,0 +1,210 @@
+package mesh
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimeoutBounds clamps the adaptive timeout for one service
+type TimeoutBounds struct {
+	Floor   time.Duration
+	Ceiling time.Duration
+}
+
+// AdaptiveTimeoutConfig derives per-attempt deadlines from observed latency
+// instead of a single static HTTPTimeout
+type AdaptiveTimeoutConfig struct {
+	Enabled    bool
+	Percentile float64                       // Latency percentile the deadline is based on, e.g. 0.99
+	Multiplier float64                       // Deadline = percentile latency x multiplier
+	Floor      time.Duration                 // Default lower bound
+	Ceiling    time.Duration                 // Default upper bound
+	MinSamples int                           // Samples needed before adapting; HTTPTimeout applies until then
+	WindowSize int                           // Recent samples retained per service
+	Bounds     map[ServiceType]TimeoutBounds // Per-service overrides of Floor/Ceiling
+	EWMAAlpha  float64                       // Smoothing factor for the latency EWMA
+}
+
+// DefaultAdaptiveTimeoutConfig returns default configuration
+func DefaultAdaptiveTimeoutConfig() *AdaptiveTimeoutConfig {
+	return &AdaptiveTimeoutConfig{
+		Enabled:    true,
+		Percentile: 0.99,
+		Multiplier: 2,
+		Floor:      100 * time.Millisecond,
+		Ceiling:    30 * time.Second,
+		MinSamples: 50,
+		WindowSize: 1000,
+		Bounds: map[ServiceType]TimeoutBounds{
+			// Auth is on every request path; fail fast
+			ServiceTypeAuth: {Floor: 50 * time.Millisecond, Ceiling: 2 * time.Second},
+			// Voice synthesis legitimately runs long
+			ServiceTypeVoice: {Floor: 2 * time.Second, Ceiling: 60 * time.Second},
+		},
+		EWMAAlpha: 0.1,
+	}
+}
+
+// recomputeEvery controls how often the percentile is recalculated
+const recomputeEvery = 50
+
+// callTimeoutCtx is the context key for per-call timeout overrides
+type callTimeoutCtx struct{}
+
+// WithCallTimeout returns a context whose ServiceClient calls use a fixed
+// per-attempt timeout instead of the adaptive one
+func WithCallTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutCtx{}, timeout)
+}
+
+// latencyWindow tracks recent latencies for one service
+type latencyWindow struct {
+	samples  []time.Duration
+	next     int
+	filled   bool
+	pending  int
+	ewma     float64 // Seconds
+	quantile time.Duration
+	timeout  time.Duration
+}
+
+// latencyTracker computes adaptive timeouts per service type
+type latencyTracker struct {
+	config *AdaptiveTimeoutConfig
+
+	mu       sync.Mutex
+	fallback time.Duration // HTTPTimeout; used until a service has enough samples
+	windows  map[ServiceType]*latencyWindow
+}
+
+// newLatencyTracker creates a tracker; a nil config disables adaptation
+func newLatencyTracker(config *AdaptiveTimeoutConfig, fallback time.Duration) *latencyTracker {
+	return &latencyTracker{
+		config:   config,
+		fallback: fallback,
+		windows:  make(map[ServiceType]*latencyWindow),
+	}
+}
+
+// enabled reports whether adaptive timeouts are active
+func (t *latencyTracker) enabled() bool {
+	return t.config != nil && t.config.Enabled
+}
+
+// observe records a successful attempt's latency
+func (t *latencyTracker) observe(serviceType ServiceType, latency time.Duration) {
+	if !t.enabled() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, ok := t.windows[serviceType]
+	if !ok {
+		w = &latencyWindow{samples: make([]time.Duration, t.config.WindowSize)}
+		t.windows[serviceType] = w
+	}
+
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.filled = true
+	}
+
+	if w.ewma == 0 {
+		w.ewma = latency.Seconds()
+	} else {
+		w.ewma = t.config.EWMAAlpha*latency.Seconds() + (1-t.config.EWMAAlpha)*w.ewma
+	}
+
+	w.pending++
+	if w.pending >= recomputeEvery || w.timeout == 0 {
+		t.recomputeLocked(serviceType, w)
+	}
+}
+
+// recomputeLocked recalculates the percentile and timeout (caller must hold lock)
+func (t *latencyTracker) recomputeLocked(serviceType ServiceType, w *latencyWindow) {
+	count := w.next
+	if w.filled {
+		count = len(w.samples)
+	}
+	if count < t.config.MinSamples {
+		return
+	}
+
+	sorted := make([]time.Duration, count)
+	copy(sorted, w.samples[:count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(math.Ceil(t.config.Percentile*float64(count))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	w.quantile = sorted[idx]
+	w.pending = 0
+
+	floor, ceiling := t.config.Floor, t.config.Ceiling
+	if bounds, ok := t.config.Bounds[serviceType]; ok {
+		floor, ceiling = bounds.Floor, bounds.Ceiling
+	}
+
+	timeout := time.Duration(float64(w.quantile) * t.config.Multiplier)
+	if timeout < floor {
+		timeout = floor
+	}
+	if timeout > ceiling {
+		timeout = ceiling
+	}
+	w.timeout = timeout
+}
+
+// timeout returns the per-attempt timeout for a call: an override, the
+// adaptive deadline, or the static HTTPTimeout
+func (t *latencyTracker) timeout(ctx context.Context, serviceType ServiceType) time.Duration {
+	if override, ok := ctx.Value(callTimeoutCtx{}).(time.Duration); ok {
+		return override
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if w, ok := t.windows[serviceType]; ok && t.enabled() && w.timeout > 0 {
+		return w.timeout
+	}
+	return t.fallback
+}
+
+// setFallback changes the static HTTPTimeout
+func (t *latencyTracker) setFallback(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fallback = timeout
+}
+
+// latencyStats is a point-in-time view of one service's latency tracking
+type latencyStats struct {
+	ewma     time.Duration
+	quantile time.Duration
+	timeout  time.Duration
+}
+
+// snapshot returns current stats for every tracked service
+func (t *latencyTracker) snapshot() map[ServiceType]latencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[ServiceType]latencyStats, len(t.windows))
+	for svcType, w := range t.windows {
+		stats[svcType] = latencyStats{
+			ewma:     time.Duration(w.ewma * float64(time.Second)),
+			quantile: w.quantile,
+			timeout:  w.timeout,
+		}
+	}
+	return stats
+}
@@ -0,0 +1,154 @@
+package mesh
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertificateProvider loads serving certificates from a secret store, keyed
+// by server name so each facility can present its own certificate
+type CertificateProvider interface {
+	Certificate(ctx context.Context, serverName string) (*tls.Certificate, error)
+}
+
+// SidecarTLSConfig configures inbound TLS termination and optional upstream
+// re-encryption
+type SidecarTLSConfig struct {
+	Provider          CertificateProvider
+	DefaultServerName string         // Used when the client sends no SNI
+	ClientCAs         *x509.CertPool // Require and verify client certificates when set
+	CacheTTL          time.Duration  // How long loaded certificates are reused
+	LoadTimeout       time.Duration  // Bound on provider lookups during handshakes
+
+	ReencryptUpstream bool           // Call upstream instances over HTTPS
+	UpstreamRootCAs   *x509.CertPool // Trust roots for upstream certificates; nil uses system roots
+}
+
+// DefaultSidecarTLSConfig returns default configuration for a provider
+func DefaultSidecarTLSConfig(provider CertificateProvider) *SidecarTLSConfig {
+	return &SidecarTLSConfig{
+		Provider:    provider,
+		CacheTTL:    time.Hour,
+		LoadTimeout: 2 * time.Second,
+	}
+}
+
+// ErrCertificateProviderRequired is returned when TLS has no provider
+var ErrCertificateProviderRequired = errors.New("sidecar TLS requires a certificate provider")
+
+// cachedCertificate is a certificate with its cache expiry
+type cachedCertificate struct {
+	cert    *tls.Certificate
+	expires time.Time
+}
+
+// certificateCache serves certificates during handshakes, refreshing from
+// the provider after the TTL so rotated secrets are picked up
+type certificateCache struct {
+	config *SidecarTLSConfig
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*cachedCertificate
+}
+
+// getCertificate implements tls.Config.GetCertificate
+func (c *certificateCache) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	serverName := strings.ToLower(hello.ServerName)
+	if serverName == "" {
+		serverName = c.config.DefaultServerName
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[serverName]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.cert, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.LoadTimeout)
+	defer cancel()
+
+	cert, err := c.config.Provider.Certificate(ctx, serverName)
+	if err != nil {
+		// Keep serving the previous certificate rather than failing handshakes
+		if ok {
+			c.logger.Warn("certificate refresh failed, serving cached certificate",
+				slog.String("server_name", serverName),
+				slog.String("error", err.Error()),
+			)
+			return entry.cert, nil
+		}
+		c.logger.Error("certificate load failed",
+			slog.String("server_name", serverName),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[serverName] = &cachedCertificate{cert: cert, expires: time.Now().Add(c.config.CacheTTL)}
+	c.mu.Unlock()
+
+	return cert, nil
+}
+
+// EnableTLS terminates inbound TLS on the proxy port using certificates from
+// the configured provider and, when requested, re-encrypts upstream calls.
+// Call before Start.
+func (s *Sidecar) EnableTLS(config *SidecarTLSConfig) error {
+	if config.Provider == nil {
+		return ErrCertificateProviderRequired
+	}
+
+	cache := &certificateCache{
+		config:  config,
+		logger:  s.logger,
+		entries: make(map[string]*cachedCertificate),
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cache.getCertificate,
+	}
+	if config.ClientCAs != nil {
+		tlsConfig.ClientCAs = config.ClientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	s.tlsConfig = tlsConfig
+
+	if config.ReencryptUpstream {
+		upstream := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    config.UpstreamRootCAs,
+		}
+		s.client.enableUpstreamTLS(upstream)
+		s.shadows.enableUpstreamTLS(upstream)
+	}
+
+	return nil
+}
+
+// enableUpstreamTLS switches HTTP calls to HTTPS with the given client config
+func (c *ServiceClient) enableUpstreamTLS(tlsConfig *tls.Config) {
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		transport.TLSClientConfig = tlsConfig
+	}
+	c.upstreamTLS = true
+}
+
+// upstreamScheme returns the URL scheme for calls to an instance
+func (c *ServiceClient) upstreamScheme(instance *ServiceInstance) string {
+	if c.upstreamTLS || instance.Metadata["tls"] == "true" {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,66 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies mesh spans in the trace backend
+const tracerName = "github.com/lilo-engine/mesh"
+
+// Span attribute keys for mesh calls
+const (
+	attrServiceType  = attribute.Key("lilo.mesh.service_type")
+	attrInstanceID   = attribute.Key("lilo.mesh.instance_id")
+	attrRetryCount   = attribute.Key("lilo.mesh.retry_count")
+	attrCircuitState = attribute.Key("lilo.mesh.circuit_state")
+)
+
+// tracer returns the mesh tracer from the globally registered provider
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// startClientSpan starts a span for an outbound mesh call
+func startClientSpan(ctx context.Context, serviceType ServiceType, method, path string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "mesh.call "+string(serviceType),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrServiceType.String(string(serviceType)),
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLPath(path),
+		),
+	)
+}
+
+// startProxySpan starts a server span for a request entering the sidecar,
+// continuing any trace context sent by the caller
+func startProxySpan(r *http.Request, targetService string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer().Start(ctx, "mesh.sidecar "+targetService,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attrServiceType.String(targetService),
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		),
+	)
+}
+
+// injectTraceContext writes the active trace context into outbound headers
+func injectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// recordSpanError marks a span as failed
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Acknowledgment tracking
+const (
+	ackPendingKey   = "lilo:websocket:ack:pending" // Sorted set of message IDs by next check, unix ms
+	ackPollInterval = time.Second
+	ackRetention    = 24 * time.Hour // Longest a pending ack is kept, whatever the retry settings
+)
+
+// pendingAck is a RequiresAck message the recipient hasn't acknowledged
+type pendingAck struct {
+	Message   *Message  `json:"message"`
+	Attempts  int       `json:"attempts"` // Deliveries so far, the first included
+	SentAt    time.Time `json:"sent_at"`
+	Escalated bool      `json:"escalated"`
+}
+
+// recipient reports whether a client was sent the pending message
+func (p *pendingAck) recipient(client *Client) bool {
+	if p.Message.Audience != nil {
+		return p.Message.Audience.includes(client)
+	}
+	return p.Message.UserID == client.UserID
+}
+
+// ackKey holds a pending ack
+func ackKey(messageID string) string {
+	return fmt.Sprintf("lilo:websocket:ack:%s", messageID)
+}
+
+// trackAck records a RequiresAck message as pending, giving it an ID if it
+// has none so the recipient can acknowledge it. Tracking is in Redis, so a
+// message sent from one instance is retried by whichever runs first.
+func (h *Hub) trackAck(msg *Message) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	pending := &pendingAck{Message: msg, Attempts: 1, SentAt: time.Now()}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		h.logger.Error("failed to marshal pending ack", slog.String("error", err.Error()))
+		return
+	}
+
+	_, err = h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(h.ctx, ackKey(msg.ID), data, ackRetention)
+		pipe.ZAdd(h.ctx, ackPendingKey, &redis.Z{Score: h.nextAckCheck(pending), Member: msg.ID})
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to track message ack",
+			slog.String("message_id", msg.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// acknowledge clears a pending ack. Only a recipient of the message can
+// acknowledge it, and for an audience message the first ack counts; acks
+// for unknown or already acknowledged messages are ignored.
+func (h *Hub) acknowledge(client *Client, messageID string) {
+	if messageID == "" {
+		return
+	}
+	data, err := h.redis.Get(h.ctx, ackKey(messageID)).Bytes()
+	if err == redis.Nil {
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to load pending ack",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	var pending pendingAck
+	if err := json.Unmarshal(data, &pending); err != nil || !pending.recipient(client) {
+		h.logger.Warn("ignoring ack from non-recipient",
+			slog.String("message_id", messageID),
+			slog.String("user_id", client.UserID),
+		)
+		return
+	}
+
+	_, err = h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(h.ctx, ackKey(messageID))
+		pipe.ZRem(h.ctx, ackPendingKey, messageID)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to clear pending ack",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	h.logger.Info("message acknowledged",
+		slog.String("message_id", messageID),
+		slog.String("user_id", client.UserID),
+		slog.Int("attempts", pending.Attempts),
+		slog.Duration("latency", time.Since(pending.SentAt)),
+	)
+}
+
+// ackBackoff is the wait after a delivery attempt before the next one
+func (h *Hub) ackBackoff(attempts int) time.Duration {
+	backoff := h.config.AckBackoff
+	for i := 1; i < attempts && backoff < h.config.AckMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, h.config.AckMaxBackoff)
+}
+
+// nextAckCheck is when a pending ack is next looked at: its next retry,
+// or its escalation deadline if that comes first
+func (h *Hub) nextAckCheck(pending *pendingAck) float64 {
+	next := time.Now().Add(h.ackBackoff(pending.Attempts))
+	if pending.Message.Type == MessageTypeCrisisAlert && !pending.Escalated {
+		if deadline := pending.SentAt.Add(h.config.CrisisAckDeadline); deadline.Before(next) {
+			next = deadline
+		}
+	}
+	return float64(next.UnixMilli())
+}
+
+// ackMonitor retries unacknowledged messages as they fall due
+func (h *Hub) ackMonitor() {
+	ticker := time.NewTicker(ackPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkAcks()
+		}
+	}
+}
+
+// checkAcks claims due pending acks and handles each. Removing an ID from
+// the pending set is the claim, so only one instance acts on it.
+func (h *Hub) checkAcks() {
+	ids, err := h.redis.ZRangeByScore(h.ctx, ackPendingKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		h.logger.Error("failed to list pending acks", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, id := range ids {
+		claimed, err := h.redis.ZRem(h.ctx, ackPendingKey, id).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		h.retryAck(id)
+	}
+}
+
+// retryAck escalates an unacknowledged crisis alert past its deadline,
+// then redelivers the message or, after AckMaxAttempts, gives up on it
+func (h *Hub) retryAck(messageID string) {
+	data, err := h.redis.Get(h.ctx, ackKey(messageID)).Bytes()
+	if err == redis.Nil {
+		return // Acknowledged meanwhile
+	}
+	if err != nil {
+		h.logger.Error("failed to load pending ack",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	var pending pendingAck
+	if err := json.Unmarshal(data, &pending); err != nil {
+		h.redis.Del(h.ctx, ackKey(messageID))
+		return
+	}
+	msg := pending.Message
+
+	// A crisis alert is escalated at its deadline, or sooner if retries run out
+	if msg.Type == MessageTypeCrisisAlert && !pending.Escalated &&
+		(time.Since(pending.SentAt) >= h.config.CrisisAckDeadline || pending.Attempts >= h.config.AckMaxAttempts) {
+		h.escalateUnacked(&pending)
+	}
+
+	if pending.Attempts >= h.config.AckMaxAttempts {
+		h.logger.Warn("giving up on unacknowledged message",
+			slog.String("message_id", messageID),
+			slog.String("user_id", msg.UserID),
+			slog.String("type", string(msg.Type)),
+			slog.Int("attempts", pending.Attempts),
+		)
+		h.redis.Del(h.ctx, ackKey(messageID))
+		return
+	}
+
+	pending.Attempts++
+	data, err = json.Marshal(&pending)
+	if err != nil {
+		return
+	}
+	// SetXX so an ack that landed since the load isn't undone
+	saved, err := h.redis.SetXX(h.ctx, ackKey(messageID), data, redis.KeepTTL).Result()
+	if err != nil || !saved {
+		return
+	}
+	if err := h.redis.ZAdd(h.ctx, ackPendingKey, &redis.Z{Score: h.nextAckCheck(&pending), Member: messageID}).Err(); err != nil {
+		h.logger.Error("failed to reschedule pending ack",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	// Every instance, this one included, delivers to its local clients
+	msg.Metadata = withRedelivery(msg.Metadata, pending.Attempts)
+	h.publishToRedis(msg)
+}
+
+// escalateUnacked tells the care team about a crisis alert nobody has
+// acknowledged. It happens once per alert.
+func (h *Hub) escalateUnacked(pending *pendingAck) {
+	pending.Escalated = true
+	msg := pending.Message
+	h.logger.Warn("crisis alert unacknowledged, escalating",
+		slog.String("message_id", msg.ID),
+		slog.String("user_id", msg.UserID),
+		slog.String("crisis_level", msg.CrisisLevel),
+		slog.Duration("since_sent", time.Since(pending.SentAt)),
+	)
+	if h.crisisHandler == nil {
+		return
+	}
+	if err := h.crisisHandler.NotifyCareTeam(h.ctx, msg.UserID, msg.CrisisLevel); err != nil {
+		h.logger.Error("failed to escalate unacknowledged crisis alert",
+			slog.String("message_id", msg.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// withRedelivery marks a message's metadata with its delivery attempt, so
+// clients can tell a retry from a new message
+func withRedelivery(metadata map[string]interface{}, attempt int) map[string]interface{} {
+	marked := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		marked[k] = v
+	}
+	marked["delivery_attempt"] = attempt
+	return marked
+}
@@ -0,0 +1,248 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Upgrade errors
+var (
+	ErrMissingToken     = errors.New("missing bearer token")
+	ErrIdentityMismatch = errors.New("requested identity does not match token")
+)
+
+// bearerProtocol is the subprotocol browsers, which can't set headers on a
+// WebSocket, send ahead of their token: Sec-WebSocket-Protocol: bearer, <token>
+const bearerProtocol = "bearer"
+
+// Principal is the verified identity behind a connection
+type Principal struct {
+	UserID     string
+	Role       string
+	FacilityID string
+	SessionID  string // Auth session the token belongs to
+}
+
+// Authenticator verifies connection tokens and reports whether their
+// sessions are still live. Wrap auth.AuthService to plug in the platform's
+// JWT checks:
+//
+//	type hubAuth struct{ *auth.AuthService }
+//
+//	func (a hubAuth) ValidateToken(ctx context.Context, token string) (*websocket.Principal, error) {
+//		claims, err := a.AuthService.ValidateToken(ctx, token)
+//		if err != nil {
+//			return nil, err
+//		}
+//		if claims.TokenType != auth.TokenTypeAccess || claims.IsService() {
+//			return nil, errors.New("invalid token type")
+//		}
+//		return &websocket.Principal{UserID: claims.UserID, Role: string(claims.Role),
+//			FacilityID: claims.FacilityID, SessionID: claims.SessionID}, nil
+//	}
+//
+//	func (a hubAuth) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+//		_, err := a.GetSession(ctx, sessionID)
+//		if errors.Is(err, auth.ErrSessionNotFound) {
+//			return false, nil
+//		}
+//		return err == nil, err
+//	}
+type Authenticator interface {
+	ValidateToken(ctx context.Context, token string) (*Principal, error)
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+// EnableAuth requires a valid token on every upgrade and closes
+// connections whose session is revoked. Call before Run.
+func (h *Hub) EnableAuth(authenticator Authenticator) {
+	h.auth = authenticator
+}
+
+// upgradeToken returns the bearer token from the Authorization header or,
+// for browsers, the bearer subprotocol
+func upgradeToken(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return "", ErrMissingToken
+		}
+		return token, nil
+	}
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == bearerProtocol && i+1 < len(protocols) {
+			return protocols[i+1], nil
+		}
+	}
+	return "", ErrMissingToken
+}
+
+// checkRequested refuses upgrades that ask for an identity other than the
+// token's. Older clients still send user_id and role; the token decides.
+func checkRequested(r *http.Request, principal *Principal) error {
+	query := r.URL.Query()
+	for param, value := range map[string]string{
+		"user_id":     principal.UserID,
+		"role":        principal.Role,
+		"facility_id": principal.FacilityID,
+	} {
+		if requested := query.Get(param); requested != "" && requested != value {
+			return ErrIdentityMismatch
+		}
+	}
+	return nil
+}
+
+// ServeWS upgrades an authenticated request and registers the connection
+// under the token's user and role. The optional session_id query parameter
+// names the conversation; a new one is started without it, and one another
+// user is connected on is refused. A reconnecting client passes last_seq to
+// have what it missed replayed.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	if h.Draining() {
+		refuseDraining(w)
+		return
+	}
+	if h.auth == nil {
+		http.Error(w, "authentication not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if !h.originAllowed(r) {
+		h.refuseUpgrade(w, r, http.StatusForbidden, RefusedOrigin, "", "origin not allowed")
+		return
+	}
+	token, err := upgradeToken(r)
+	if err != nil {
+		h.refuseUpgrade(w, r, http.StatusUnauthorized, RefusedToken, "", err.Error())
+		return
+	}
+	principal, err := h.auth.ValidateToken(r.Context(), token)
+	if err != nil {
+		h.logger.Warn("websocket token rejected",
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("error", err.Error()),
+		)
+		h.refuseUpgrade(w, r, http.StatusUnauthorized, RefusedToken, "", "invalid token")
+		return
+	}
+	if err := checkRequested(r, principal); err != nil {
+		h.logger.Warn("websocket identity mismatch",
+			slog.String("user_id", principal.UserID),
+			slog.String("requested_user_id", r.URL.Query().Get("user_id")),
+			slog.String("requested_role", r.URL.Query().Get("role")),
+		)
+		h.refuseUpgrade(w, r, http.StatusForbidden, RefusedIdentity, principal.UserID, err.Error())
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	}
+	if err := h.claimSession(r.Context(), sessionID, principal.UserID); err != nil {
+		if errors.Is(err, ErrSessionOwned) {
+			h.refuseUpgrade(w, r, http.StatusForbidden, RefusedSession, principal.UserID, err.Error())
+			return
+		}
+		h.logger.Error("failed to claim websocket session",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		http.Error(w, "session unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		Subprotocols:      []string{binaryProtocol, bearerProtocol},
+		EnableCompression: h.config.Compression,
+		CheckOrigin:       h.originAllowed,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		h.logger.Error("websocket upgrade failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64)
+	media := h.negotiateMedia(r, conn.Subprotocol())
+	deflate := h.negotiateCompression(r, conn)
+	h.ServeClient(&Client{
+		ID:           uuid.New().String(),
+		UserID:       principal.UserID,
+		SessionID:    sessionID,
+		Role:         principal.Role,
+		FacilityID:   principal.FacilityID,
+		Principal:    principal,
+		Conn:         conn,
+		LastSeq:      lastSeq,
+		Media:        media,
+		Capabilities: negotiateCapabilities(r, media, deflate),
+		deflate:      deflate,
+	})
+}
+
+// sessionMonitor closes connections whose auth session has been revoked,
+// e.g. by sign-out elsewhere or an admin, within SessionCheckInterval
+func (h *Hub) sessionMonitor() {
+	ticker := time.NewTicker(h.config.SessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkSessions()
+		}
+	}
+}
+
+// checkSessions looks up each authenticated session once and disconnects
+// its clients if it is gone. Lookup failures leave clients connected.
+func (h *Hub) checkSessions() {
+	bySession := make(map[string][]*Client)
+	for _, client := range h.connectedClients() {
+		if client.Principal != nil {
+			id := client.Principal.SessionID
+			bySession[id] = append(bySession[id], client)
+		}
+	}
+
+	for sessionID, clients := range bySession {
+		active, err := h.auth.SessionActive(h.ctx, sessionID)
+		if err != nil {
+			h.logger.Error("failed to check websocket session",
+				slog.String("session_id", sessionID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		if active {
+			continue
+		}
+		for _, client := range clients {
+			h.logger.Info("closing websocket for revoked session",
+				slog.String("user_id", client.UserID),
+				slog.String("session_id", sessionID),
+			)
+			deadline := time.Now().Add(h.config.WriteTimeout)
+			client.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"), deadline)
+			h.leave(client)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Binary frames carry voice audio and attachments over the chat connection,
+// so the voice companion doesn't need a second, gRPC connection on
+// tablets. A client opts in by offering binaryProtocol and listing the
+// media types it can take in the media query parameter; clients that
+// don't get JSON only.
+//
+// Each frame is a length-prefixed envelope:
+//
+//	version (1 byte) | kind (1 byte) | header length (2 bytes, big endian) | JSON header | payload
+const (
+	binaryProtocol      = "lilo.binary.v1"
+	binaryFrameVersion  = 1
+	binaryChannel       = "lilo:websocket:binary"
+	binaryEnvelopeBytes = 4
+)
+
+// ErrInvalidFrame is returned for binary frames that can't be decoded
+var ErrInvalidFrame = errors.New("invalid binary frame")
+
+// FrameKind is what a binary frame carries
+type FrameKind byte
+
+const (
+	FrameAudio      FrameKind = 1 // A chunk of a voice stream
+	FrameAttachment FrameKind = 2 // A chunk of an image or other file
+)
+
+// FrameHeader describes a binary frame's payload
+type FrameHeader struct {
+	ID        string                 `json:"id"` // Stream or attachment; shared by its chunks
+	UserID    string                 `json:"user_id"`
+	SessionID string                 `json:"session_id"`
+	MediaType string                 `json:"media_type"` // e.g. audio/opus, image/jpeg
+	Chunk     int                    `json:"chunk"`
+	Final     bool                   `json:"final,omitempty"` // Last chunk of the stream or attachment
+	Name      string                 `json:"name,omitempty"`  // Attachment file name
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// BinaryFrame is a decoded binary message
+type BinaryFrame struct {
+	Kind    FrameKind
+	Header  FrameHeader
+	Payload []byte
+}
+
+// BinaryHandler receives binary frames from clients, e.g. the voice
+// companion transcribing audio and answering with SendBinary
+type BinaryHandler interface {
+	HandleBinary(ctx context.Context, frame *BinaryFrame) error
+}
+
+// SetBinaryHandler routes inbound binary frames to handler. Without one
+// they are dropped. Call before Run.
+func (h *Hub) SetBinaryHandler(handler BinaryHandler) {
+	h.binaryHandler = handler
+}
+
+// EncodeFrame serializes a binary frame
+func EncodeFrame(frame *BinaryFrame) ([]byte, error) {
+	header, err := json.Marshal(&frame.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal frame header: %w", err)
+	}
+	if len(header) > 0xFFFF {
+		return nil, fmt.Errorf("%w: header too long", ErrInvalidFrame)
+	}
+
+	data := make([]byte, binaryEnvelopeBytes, binaryEnvelopeBytes+len(header)+len(frame.Payload))
+	data[0] = binaryFrameVersion
+	data[1] = byte(frame.Kind)
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(header)))
+	data = append(data, header...)
+	return append(data, frame.Payload...), nil
+}
+
+// DecodeFrame parses a binary frame
+func DecodeFrame(data []byte) (*BinaryFrame, error) {
+	if len(data) < binaryEnvelopeBytes {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidFrame)
+	}
+	if data[0] != binaryFrameVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFrame, data[0])
+	}
+	kind := FrameKind(data[1])
+	if kind != FrameAudio && kind != FrameAttachment {
+		return nil, fmt.Errorf("%w: unknown kind %d", ErrInvalidFrame, kind)
+	}
+	end := binaryEnvelopeBytes + int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) < end {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidFrame)
+	}
+
+	frame := &BinaryFrame{Kind: kind, Payload: data[end:]}
+	if err := json.Unmarshal(data[binaryEnvelopeBytes:end], &frame.Header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	return frame, nil
+}
+
+// negotiateMedia returns the media types a client asked for that the hub
+// allows, or nil if the client didn't take up the binary subprotocol
+func (h *Hub) negotiateMedia(r *http.Request, subprotocol string) []string {
+	if subprotocol != binaryProtocol {
+		return nil
+	}
+	var media []string
+	for _, mediaType := range strings.Split(r.URL.Query().Get("media"), ",") {
+		mediaType = strings.TrimSpace(mediaType)
+		if slices.Contains(h.config.BinaryMediaTypes, mediaType) && !slices.Contains(media, mediaType) {
+			media = append(media, mediaType)
+		}
+	}
+	return media
+}
+
+// acceptsMedia reports whether a client negotiated a media type
+func (c *Client) acceptsMedia(mediaType string) bool {
+	return c.binary != nil && slices.Contains(c.Media, mediaType)
+}
+
+// receiveBinary hands a frame from a client to the binary handler, with
+// the client's identity in place of whatever the header claimed. Audio is
+// exempt from message rate limits, as a voice stream sends many small
+// chunks; attachments count against them.
+func (c *Client) receiveBinary(data []byte) {
+	h := c.Hub
+	if c.binary == nil || h.binaryHandler == nil {
+		return
+	}
+	if int64(len(data)) > h.config.MaxBinaryFrameSize {
+		h.logger.Warn("dropping oversized binary frame",
+			slog.String("user_id", c.UserID),
+			slog.Int("size", len(data)),
+		)
+		return
+	}
+	frame, err := DecodeFrame(data)
+	if err != nil {
+		h.logger.Warn("dropping malformed binary frame",
+			slog.String("user_id", c.UserID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if !c.acceptsMedia(frame.Header.MediaType) {
+		h.logger.Warn("dropping binary frame of unnegotiated media type",
+			slog.String("user_id", c.UserID),
+			slog.String("media_type", frame.Header.MediaType),
+		)
+		return
+	}
+	if frame.Kind != FrameAudio && !h.allowInbound(c) {
+		return
+	}
+	frame.Header.UserID = c.UserID
+	frame.Header.SessionID = c.SessionID
+
+	if err := h.binaryHandler.HandleBinary(h.ctx, frame); err != nil {
+		h.logger.Error("failed to handle binary frame",
+			slog.String("user_id", c.UserID),
+			slog.String("frame_id", frame.Header.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// SendBinary sends a binary frame to the header's user on every instance.
+// Only clients that negotiated the frame's media type receive it.
+func (h *Hub) SendBinary(frame *BinaryFrame) error {
+	data, err := EncodeFrame(frame)
+	if err != nil {
+		return err
+	}
+	if err := h.redis.Publish(h.ctx, binaryChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish binary frame: %w", err)
+	}
+	return nil
+}
+
+// deliverBinaryLocal delivers a published binary frame to this instance's
+// clients. A client too far behind loses the frame rather than its
+// connection; late audio is of no use anyway.
+func (h *Hub) deliverBinaryLocal(data []byte) {
+	frame, err := DecodeFrame(data)
+	if err != nil {
+		h.logger.Error("failed to decode published binary frame",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	s := h.shardFor(frame.Header.UserID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for client := range s.clients[frame.Header.UserID] {
+		if !client.acceptsMedia(frame.Header.MediaType) {
+			continue
+		}
+		select {
+		case client.binary <- data:
+		default:
+			h.logger.Warn("dropping binary frame for slow client",
+				slog.String("user_id", client.UserID),
+				slog.String("frame_id", frame.Header.ID),
+			)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// sendBuffer is the number of outbound messages queued per client before
+// the hub drops it as too slow
+const sendBuffer = 256
+
+// ServeClient registers an upgraded connection with the hub and runs its
+// read and write pumps until either side closes. Conn, UserID, SessionID
+// and Role must be set; the rest is filled in. Clients sent through here
+// share one set of deadlines, read limits and keepalives from HubConfig.
+func (h *Hub) ServeClient(client *Client) {
+	if h.Draining() {
+		h.closeForRestart(client.Conn, "")
+		client.Conn.Close()
+		return
+	}
+	if client.ID == "" {
+		client.ID = uuid.New().String()
+	}
+	client.Hub = h
+	client.Send = make(chan []byte, sendBuffer)
+	client.crisis = make(chan []byte, crisisLaneBuffer)
+	client.low = make(chan []byte, lowLaneBuffer)
+	client.LastPing = time.Now()
+	client.limiter = h.newConnLimiter()
+	if len(client.Media) > 0 {
+		client.binary = make(chan []byte, sendBuffer)
+	}
+
+	select {
+	case h.shardFor(client.UserID).register <- client:
+	case <-h.ctx.Done():
+		client.Conn.Close()
+		return
+	}
+	go client.writePump()
+	go client.readPump()
+}
+
+// readPump reads messages from the connection into the hub until it fails
+// or closes, then unregisters the client. Any frame, including a pong,
+// counts as a sign of life. Identity fields are taken from the client,
+// never from the message.
+func (c *Client) readPump() {
+	defer func() {
+		c.Hub.leave(c)
+		c.Conn.Close()
+	}()
+
+	cfg := c.Hub.config
+	c.Conn.SetReadLimit(cfg.MaxMessageSize)
+	if c.binary != nil {
+		c.Conn.SetReadLimit(max(cfg.MaxMessageSize, cfg.MaxBinaryFrameSize))
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+	c.Conn.SetPongHandler(func(string) error {
+		c.touch()
+		return c.Conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+	})
+
+	for {
+		frameType, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.Hub.logger.Warn("websocket read failed",
+					slog.String("user_id", c.UserID),
+					slog.String("error", err.Error()),
+				)
+			}
+			return
+		}
+		c.touch()
+		c.Conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+
+		if frameType == websocket.BinaryMessage {
+			c.receiveBinary(data)
+			continue
+		}
+		if int64(len(data)) > cfg.MaxMessageSize {
+			continue
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.Hub.logger.Warn("dropping malformed websocket message",
+				slog.String("user_id", c.UserID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		// Application heartbeats only keep the client alive
+		if msg.Type == MessageTypeHeartbeat {
+			continue
+		}
+		// An ack carries the ID of the message it acknowledges
+		if msg.Type == MessageTypeAcknowledge {
+			c.Hub.acknowledge(c, msg.ID)
+			continue
+		}
+		// As does a read receipt
+		if msg.Type == MessageTypeRead {
+			if msg.ID != "" {
+				go c.Hub.recordReceipt(msg.ID, c.UserID, StatusRead)
+			}
+			continue
+		}
+		// Keystrokes are coalesced into changes of typing state
+		if msg.Type == MessageTypeTyping {
+			c.updateTyping(&msg)
+			continue
+		}
+		// Crisis alerts are never held back
+		if msg.Type != MessageTypeCrisisAlert && !c.Hub.allowInbound(c) {
+			continue
+		}
+		msg.UserID = c.UserID
+		msg.SenderID = c.UserID
+		msg.SessionID = c.SessionID
+		msg.Timestamp = time.Now()
+		msg.Seq = 0
+		msg.SessionSeq = 0
+		msg.Audience = nil // Only the server addresses roles and facilities
+		msg.Route = RouteAllDevices
+		if msg.ID == "" {
+			msg.ID = uuid.New().String()
+		}
+		if msg.Type == MessageTypeResend {
+			c.resend(&msg)
+			continue
+		}
+		if msg.Type == MessageTypeChat {
+			c.clearTyping()
+		}
+		c.Hub.markActive(c)
+
+		if err := c.Hub.submit(&msg); err != nil {
+			return
+		}
+	}
+}
+
+// writePump replays what a reconnecting client missed and what was held
+// while its user was offline, then writes queued messages to the
+// connection, crisis alerts first, and pings it every HeartbeatInterval.
+// It closes the connection when the hub closes Send or a write misses
+// WriteTimeout.
+func (c *Client) writePump() {
+	cfg := c.Hub.config
+	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+		c.discardHeld()
+	}()
+
+	// Messages queued while replaying may already have been replayed
+	caughtUp, err := c.replay()
+	if err != nil {
+		return
+	}
+	if caughtUp, err = c.deliverInbox(caughtUp); err != nil {
+		return
+	}
+
+	writeText := func(data []byte) error {
+		if err := c.writeFrame(websocket.TextMessage, data); err != nil {
+			return err
+		}
+		c.markDelivered(data)
+		return nil
+	}
+
+	for {
+		// Crisis alerts are written ahead of anything else queued
+		select {
+		case data := <-c.crisis:
+			if err := writeText(data); err != nil {
+				return
+			}
+			continue
+		default:
+		}
+
+		// Messages held while the client was behind follow everything
+		// queued before them
+		if len(c.Send) == 0 && c.degraded() {
+			if err := c.writeHeld(); err != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case data := <-c.crisis:
+			if err := writeText(data); err != nil {
+				return
+			}
+		case data, ok := <-c.Send:
+			if ok && caughtUp > 0 {
+				seq := messageSeq(data)
+				if seq > 0 && seq <= caughtUp {
+					continue
+				}
+				if seq > caughtUp {
+					caughtUp = 0
+				}
+			}
+			if !ok {
+				c.Conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := writeText(data); err != nil {
+				return
+			}
+		case data := <-c.low:
+			if err := writeText(data); err != nil {
+				return
+			}
+		case data := <-c.binary:
+			if err := c.writeFrame(websocket.BinaryMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// touch records activity from the client
+func (c *Client) touch() {
+	c.mu.Lock()
+	c.LastPing = time.Now()
+	c.mu.Unlock()
+}
+
+// leave unregisters a client unless the hub is already shutting down
+func (h *Hub) leave(client *Client) {
+	select {
+	case h.shardFor(client.UserID).unregister <- client:
+	case <-h.ctx.Done():
+	}
+}
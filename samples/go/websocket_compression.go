@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"compress/flate"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Compression uses permessage-deflate when HubConfig.Compression is set and
+// the client offers it. Only text messages of CompressionThreshold bytes
+// or more are compressed: heartbeats, typing and presence are too small to
+// gain from it, and audio and image frames are compressed already.
+const (
+	deflateExtension = "permessage-deflate"
+
+	// Every compressed message is counted, but only one in this many is
+	// compressed a second time to estimate the bytes saved
+	compressionSampleEvery = 16
+)
+
+// compressionMetrics tracks what compression saves across the hub's clients
+var compressionMetrics = struct {
+	messages *prometheus.CounterVec
+	input    prometheus.Counter
+	saved    prometheus.Counter
+}{
+	messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "compression_messages_total",
+		Help:      "Messages written to clients that negotiated compression, by whether they were compressed.",
+	}, []string{"compressed"}),
+	input: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "compression_input_bytes_total",
+		Help:      "Bytes of messages written compressed, before compression.",
+	}),
+	saved: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "compression_saved_bytes_total",
+		Help:      "Estimated bytes saved by compression, extrapolated from sampled messages.",
+	}),
+}
+
+// CompressionCollectors returns the compression collectors for
+// registration with the process metrics registry
+func CompressionCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		compressionMetrics.messages,
+		compressionMetrics.input,
+		compressionMetrics.saved,
+	}
+}
+
+// offersDeflate reports whether an upgrade request offers permessage-deflate
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), deflateExtension) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// negotiateCompression reports whether an upgraded connection uses
+// compression, setting its level if so
+func (h *Hub) negotiateCompression(r *http.Request, conn *websocket.Conn) bool {
+	if !h.config.Compression || !offersDeflate(r) {
+		return false
+	}
+	if err := conn.SetCompressionLevel(h.config.CompressionLevel); err != nil {
+		h.logger.Warn("invalid compression level, using the default",
+			slog.Int("level", h.config.CompressionLevel),
+			slog.String("error", err.Error()),
+		)
+	}
+	return true
+}
+
+// writeFrame writes a text or binary message to the connection within
+// WriteTimeout, compressed if the client negotiated it and the message is
+// text of at least CompressionThreshold bytes. Text is downgraded to the
+// client's protocol version first.
+func (c *Client) writeFrame(messageType int, data []byte) error {
+	cfg := c.Hub.config
+	if messageType == websocket.TextMessage {
+		data = c.downgrade(data)
+	}
+	compress := c.deflate && messageType == websocket.TextMessage && len(data) >= cfg.CompressionThreshold
+	if c.deflate {
+		c.Conn.EnableWriteCompression(compress)
+	}
+
+	c.Conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+
+	if c.deflate {
+		c.recordCompression(compress, data)
+	}
+	return nil
+}
+
+// recordCompression counts a message written to a client that negotiated
+// compression, sampling compressed ones for the bytes saved. Only the
+// write pump calls it.
+func (c *Client) recordCompression(compressed bool, data []byte) {
+	if !compressed {
+		compressionMetrics.messages.WithLabelValues("false").Inc()
+		return
+	}
+	compressionMetrics.messages.WithLabelValues("true").Inc()
+	compressionMetrics.input.Add(float64(len(data)))
+
+	c.compressedWrites++
+	if c.compressedWrites%compressionSampleEvery != 0 {
+		return
+	}
+	size, err := deflatedSize(data, c.Hub.config.CompressionLevel)
+	if err != nil || size >= len(data) {
+		return
+	}
+	compressionMetrics.saved.Add(float64((len(data) - size) * compressionSampleEvery))
+}
+
+// deflatedSize returns roughly how many bytes data takes on the wire once
+// compressed, as permessage-deflate does it without context takeover
+func deflatedSize(data []byte, level int) (int, error) {
+	var counter byteCounter
+	w, err := flate.NewWriter(&counter, level)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	// permessage-deflate drops the 4-byte tail of the flush
+	return max(int(counter)-4, 0), nil
+}
+
+// byteCounter is a writer that only counts what is written to it
+type byteCounter int
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
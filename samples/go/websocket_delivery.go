@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// ErrNoCareTeamDirectory is returned by care team delivery on a hub
+// without a CareTeamDirectory
+var ErrNoCareTeamDirectory = errors.New("no care team directory configured")
+
+// Audience addresses a message to connected users other than its UserID,
+// which then names the subject, e.g. the resident an alert is about. A
+// client receives it if it is one of UserIDs, or is at FacilityID with one
+// of Roles (any role when Roles is empty).
+type Audience struct {
+	FacilityID string   `json:"facility_id,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	UserIDs    []string `json:"user_ids,omitempty"`
+}
+
+// includes reports whether a client is in the audience
+func (a *Audience) includes(client *Client) bool {
+	if slices.Contains(a.UserIDs, client.UserID) {
+		return true
+	}
+	if a.FacilityID == "" || client.FacilityID != a.FacilityID {
+		return false
+	}
+	return len(a.Roles) == 0 || slices.Contains(a.Roles, client.Role)
+}
+
+// CareTeamDirectory looks up who looks after a resident.
+// auth.RedisRelationshipStore implements it, or wrap the crisis service's
+// CareTeamService:
+//
+//	type careTeams struct{ crisis.CareTeamService }
+//
+//	func (c careTeams) ResidentFacility(ctx context.Context, residentID string) (string, error) {
+//		team, err := c.GetCareTeam(ctx, residentID)
+//		if err != nil {
+//			return "", err
+//		}
+//		return team.FacilityID, nil
+//	}
+//
+//	func (c careTeams) CareTeam(ctx context.Context, residentID string) ([]string, error) {
+//		team, err := c.GetCareTeam(ctx, residentID)
+//		if err != nil {
+//			return nil, err
+//		}
+//		members := make([]string, 0, len(team.Members))
+//		for _, member := range team.Members {
+//			members = append(members, member.UserID)
+//		}
+//		return members, nil
+//	}
+type CareTeamDirectory interface {
+	ResidentFacility(ctx context.Context, residentID string) (string, error)
+	CareTeam(ctx context.Context, residentID string) ([]string, error)
+}
+
+// SetCareTeamDirectory enables care team delivery. Call before Run.
+func (h *Hub) SetCareTeamDirectory(directory CareTeamDirectory) {
+	h.careTeams = directory
+}
+
+// crisisAudience is who sees a crisis alert about a resident. A failed
+// lookup narrows the audience rather than holding the alert back.
+func (h *Hub) crisisAudience(residentID string) (*Audience, error) {
+	if h.careTeams == nil {
+		return nil, ErrNoCareTeamDirectory
+	}
+	facilityID, facilityErr := h.careTeams.ResidentFacility(h.ctx, residentID)
+	members, teamErr := h.careTeams.CareTeam(h.ctx, residentID)
+	if err := errors.Join(facilityErr, teamErr); err != nil {
+		h.logger.Error("failed to resolve crisis alert recipients",
+			slog.String("user_id", residentID),
+			slog.String("error", err.Error()),
+		)
+		if facilityID == "" && len(members) == 0 {
+			return nil, fmt.Errorf("no recipients for crisis alert: %w", err)
+		}
+	}
+	return &Audience{FacilityID: facilityID, Roles: h.config.CrisisAlertRoles, UserIDs: members}, nil
+}
+
+// recipients returns the shard's clients a message is for. Callers hold
+// s.mu.
+func (s *hubShard) recipients(msg *Message) []*Client {
+	if msg.Type == MessageTypeTyping {
+		return s.sessionParticipants(msg)
+	}
+	var recipients []*Client
+	if msg.Audience == nil {
+		for client := range s.clients[msg.UserID] {
+			if client.routedTo(msg) {
+				recipients = append(recipients, client)
+			}
+		}
+		return recipients
+	}
+	for _, clients := range s.clients {
+		for client := range clients {
+			if msg.Audience.includes(client) {
+				recipients = append(recipients, client)
+			}
+		}
+	}
+	return recipients
+}
+
+// sendToAudience broadcasts a message to an audience on every instance
+func (h *Hub) sendToAudience(audience *Audience, msg *Message) error {
+	msg.Audience = audience
+	msg.Timestamp = time.Now()
+	return h.submit(msg)
+}
+
+// SendToRole sends a message to every connected user with a role at a
+// facility, e.g. the staff on shift
+func (h *Hub) SendToRole(facilityID, role string, msg *Message) error {
+	return h.sendToAudience(&Audience{FacilityID: facilityID, Roles: []string{role}}, msg)
+}
+
+// SendToFacility sends a message to every connected user at a facility
+func (h *Hub) SendToFacility(facilityID string, msg *Message) error {
+	return h.sendToAudience(&Audience{FacilityID: facilityID}, msg)
+}
+
+// SendToCareTeam sends a message about a resident to the connected members
+// of their care team
+func (h *Hub) SendToCareTeam(residentID string, msg *Message) error {
+	if h.careTeams == nil {
+		return ErrNoCareTeamDirectory
+	}
+	members, err := h.careTeams.CareTeam(h.ctx, residentID)
+	if err != nil {
+		return fmt.Errorf("failed to load care team: %w", err)
+	}
+	msg.UserID = residentID
+	return h.sendToAudience(&Audience{UserIDs: members}, msg)
+}
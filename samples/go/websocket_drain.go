@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// drainPollInterval is how often Drain checks for clients left to move
+const drainPollInterval = 250 * time.Millisecond
+
+// maxCloseReason is the longest reason a close frame can carry
+const maxCloseReason = 123
+
+// Draining reports whether the hub has stopped taking connections
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
+
+// Drain moves clients off this instance before it shuts down, e.g. for a
+// deploy. The hub stops accepting connections and tells each client to
+// reconnect, naming endpoint if one is given, with a service restart close
+// frame. Clients resume where they were through last_seq replay, and
+// pending acks are retried by the remaining instances. Drain waits for the
+// clients to go or for ctx to end, then stops the hub; it returns an error
+// if clients were still connected at the deadline.
+func (h *Hub) Drain(ctx context.Context, endpoint string) error {
+	if !h.draining.CompareAndSwap(false, true) {
+		return fmt.Errorf("hub is already draining")
+	}
+	h.logger.Info("draining websocket hub",
+		slog.String("endpoint", endpoint),
+		slog.Int("clients", h.clientCount()),
+	)
+	defer h.Stop()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	// Each client gets the reconnect message on one pass and the close
+	// frame on the next, so the message is written before the close.
+	// Clients that registered as draining began are picked up as they come.
+	told := make(map[*Client]bool)
+	closed := make(map[*Client]bool)
+	for {
+		for _, client := range h.connectedClients() {
+			switch {
+			case !told[client]:
+				told[client] = true
+				h.sendReconnect(client, endpoint)
+			case !closed[client]:
+				closed[client] = true
+				h.closeForRestart(client.Conn, endpoint)
+			}
+		}
+		remaining := h.clientCount()
+		if remaining == 0 {
+			h.logger.Info("websocket hub drained")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			h.logger.Warn("websocket drain deadline reached",
+				slog.Int("remaining", remaining),
+			)
+			return fmt.Errorf("drain ended with %d clients connected: %w", remaining, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendReconnect tells a client to reconnect elsewhere, at endpoint if given
+func (h *Hub) sendReconnect(client *Client, endpoint string) {
+	h.notify(client, &Message{
+		Type:      MessageTypeReconnect,
+		UserID:    client.UserID,
+		SessionID: client.SessionID,
+		Metadata: map[string]interface{}{
+			"endpoint": endpoint,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// closeForRestart sends a service restart close frame, with the endpoint
+// as its reason if it fits
+func (h *Hub) closeForRestart(conn *websocket.Conn, endpoint string) {
+	reason := "server draining"
+	if endpoint != "" && len(endpoint) <= maxCloseReason {
+		reason = endpoint
+	}
+	deadline := time.Now().Add(h.config.WriteTimeout)
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason), deadline)
+}
+
+// refuseDraining turns away an upgrade while draining
+func refuseDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server draining", http.StatusServiceUnavailable)
+}
+
+// connectedClients returns this instance's clients
+func (h *Hub) connectedClients() []*Client {
+	var connected []*Client
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for _, clients := range s.clients {
+			for client := range clients {
+				connected = append(connected, client)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return connected
+}
+
+// clientCount returns the number of clients on this instance
+func (h *Hub) clientCount() int {
+	count := 0
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for _, clients := range s.clients {
+			count += len(clients)
+		}
+		s.mu.RUnlock()
+	}
+	return count
+}
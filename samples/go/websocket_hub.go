@@ -3,14 +3,19 @@
 package websocket
 
 import (
+	"compress/flate"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
 )
 
 // MessageType defines the type of WebSocket message
@@ -23,6 +28,15 @@ const (
 	MessageTypePresence     MessageType = "presence"
 	MessageTypeAcknowledge  MessageType = "ack"
 	MessageTypeHeartbeat    MessageType = "heartbeat"
+	MessageTypeReplayDone   MessageType = "replay_done"
+	MessageTypeRateLimited  MessageType = "rate_limited"
+	MessageTypeReconnect    MessageType = "reconnect"
+	MessageTypeRead         MessageType = "read"    // Read receipt from a recipient; ID names the message read
+	MessageTypeReceipt      MessageType = "receipt" // Status update to a sender
+	MessageTypeResend       MessageType = "resend"  // Request for skipped session messages
+	MessageTypeResendDone   MessageType = "resend_done"
+	MessageTypeDegraded     MessageType = "degraded" // Messages are being held for a client that fell behind
+	MessageTypeBatch        MessageType = "batch"    // Held messages coalesced into one frame
 )
 
 // Message represents a WebSocket message with therapeutic context
@@ -30,12 +44,17 @@ type Message struct {
 	ID            string                 `json:"id"`
 	Type          MessageType            `json:"type"`
 	UserID        string                 `json:"user_id"`
+	SenderID      string                 `json:"sender_id,omitempty"` // Told of delivery and reads by other users
 	SessionID     string                 `json:"session_id"`
 	Content       string                 `json:"content,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 	Timestamp     time.Time              `json:"timestamp"`
 	CrisisLevel   string                 `json:"crisis_level,omitempty"`
 	RequiresAck   bool                   `json:"requires_ack,omitempty"`
+	Seq           int64                  `json:"seq,omitempty"` // Per-user order, for replay on reconnect
+	SessionSeq    int64                  `json:"session_seq,omitempty"` // Per-session order, for rendering and gap detection
+	Audience      *Audience              `json:"audience,omitempty"` // Recipients when not UserID
+	Route         RoutePolicy            `json:"route,omitempty"` // Which of UserID's devices get it
 }
 
 // Client represents a WebSocket client connection
@@ -44,29 +63,33 @@ type Client struct {
 	UserID     string
 	SessionID  string
 	Role       string // resident, family, staff, provider, admin
+	FacilityID string
+	Principal  *Principal // Token identity; nil for clients registered without one
 	Conn       *websocket.Conn
 	Send       chan []byte
 	Hub        *Hub
 	LastPing   time.Time
+	LastSeq    int64 // Last message the client saw before reconnecting; replayed from here
+	Media      []string // Media types negotiated for binary frames; none for JSON only
+	Capabilities Capabilities // Protocol negotiated at connect; zero for the current one
 	mu         sync.RWMutex
+	limiter    *rate.Limiter // Inbound limit for this connection
+	throttled  bool          // Warned since the last allowed message
+	binary     chan []byte   // Outbound binary frames; nil without negotiated media
+	crisis     chan []byte   // Outbound crisis alerts, written ahead of Send
+	low        chan []byte   // Outbound typing and presence, shed when full
+	deflate    bool          // permessage-deflate negotiated
+	compressedWrites int     // Messages written compressed, for sampling savings
+	typingTimer *time.Timer  // Set while the client's user is typing
+	typingUntil time.Time    // When typing stops without another keystroke
+	overflowMu  sync.Mutex
+	slowSince   time.Time    // When messages began to be held for the client; zero when keeping up
 }
 
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
-	// Registered clients by user ID
-	clients map[string]map[*Client]bool
-
-	// Registered clients by session ID
-	sessions map[string]*Client
-
-	// Inbound messages from clients
-	broadcast chan *Message
-
-	// Register requests from clients
-	register chan *Client
-
-	// Unregister requests from clients
-	unregister chan *Client
+	// Registered clients and their event loops, split by user
+	shards []*hubShard
 
 	// Redis client for pub/sub across instances
 	redis *redis.Client
@@ -78,9 +101,6 @@ type Hub struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// Mutex for thread-safe operations
-	mu sync.RWMutex
-
 	// Logger
 	logger *slog.Logger
 
@@ -89,6 +109,29 @@ type Hub struct {
 
 	// Message persistence
 	messageStore MessageStore
+
+	// Token checks for upgrades; nil until EnableAuth
+	auth Authenticator
+
+	// Care team lookups for care team delivery
+	careTeams CareTeamDirectory
+
+	// Inbound message limits
+	rateLimits *RateLimitConfig
+
+	// Receives binary frames from clients
+	binaryHandler BinaryHandler
+
+	// Reaches users who aren't connected
+	notifier Notifier
+
+	// Records refused upgrades
+	upgradeAuditor UpgradeAuditor
+
+	// Set by Drain; no new clients are taken
+	draining atomic.Bool
+
+	config *HubConfig
 }
 
 // CrisisHandler defines the interface for crisis alert handling
@@ -111,6 +154,26 @@ type HubConfig struct {
 	WriteTimeout   time.Duration
 	ReadTimeout    time.Duration
 	MaxMessageSize int64
+	SessionCheckInterval time.Duration // How often revoked sessions are disconnected
+	AckBackoff        time.Duration // Wait before the first redelivery of an unacknowledged message; doubles per attempt
+	AckMaxBackoff     time.Duration
+	AckMaxAttempts    int           // Deliveries before an unacknowledged message is dropped
+	CrisisAckDeadline time.Duration // Unacknowledged crisis alerts are escalated to the care team after this
+	ReplayLimit       int           // Most missed messages replayed to a reconnecting client
+	CrisisAlertRoles  []string      // Roles at the resident's facility that receive crisis alerts, with the care team
+	BinaryMediaTypes   []string // Media types clients may negotiate for binary frames
+	MaxBinaryFrameSize int64
+	PushChat           bool // Notify offline users of chat as well as crisis alerts
+	Compression          bool // Offer permessage-deflate to clients
+	CompressionThreshold int  // Smallest text message compressed, in bytes
+	CompressionLevel     int  // flate level, from 1 (fastest) to 9
+	TypingTimeout        time.Duration // Quiet time after which a typing user is taken to have stopped
+	Shards               int           // Client maps and event loops, split by user; raise for tens of thousands of connections
+	OfflineGrace         time.Duration // How long a resident must stay disconnected before their care team is told
+	CrisisWatchWindow    time.Duration // How long after a crisis alert a resident's disconnect raises another
+	SlowClientTimeout    time.Duration // How long a client may stay behind before it is dropped
+	OverflowLimit        int           // Most messages held for a client that is behind
+	AllowedOrigins       []string      // Browser origins other than the hub's own that may connect, per environment
 }
 
 // DefaultHubConfig returns default configuration values
@@ -121,6 +184,23 @@ func DefaultHubConfig() *HubConfig {
 		WriteTimeout:      10 * time.Second,
 		ReadTimeout:       60 * time.Second,
 		MaxMessageSize:    65536, // 64KB
+		SessionCheckInterval: 30 * time.Second,
+		AckBackoff:        5 * time.Second,
+		AckMaxBackoff:     time.Minute,
+		AckMaxAttempts:    10,
+		CrisisAckDeadline: 2 * time.Minute,
+		ReplayLimit:       100,
+		CrisisAlertRoles:  []string{"staff"},
+		BinaryMediaTypes:   []string{"audio/opus", "audio/pcm", "image/jpeg", "image/png"},
+		MaxBinaryFrameSize: 1 << 20, // 1MB; larger attachments are chunked
+		CompressionThreshold: 512,
+		CompressionLevel:     flate.BestSpeed,
+		TypingTimeout:        5 * time.Second,
+		Shards:               runtime.GOMAXPROCS(0),
+		OfflineGrace:         15 * time.Second,
+		CrisisWatchWindow:    time.Hour,
+		SlowClientTimeout:    2 * time.Minute,
+		OverflowLimit:        1000,
 	}
 }
 
@@ -129,24 +209,24 @@ func NewHub(cfg *HubConfig, redisClient *redis.Client, logger *slog.Logger) *Hub
 	ctx, cancel := context.WithCancel(context.Background())
 
 	hub := &Hub{
-		clients:    make(map[string]map[*Client]bool),
-		sessions:   make(map[string]*Client),
-		broadcast:  make(chan *Message, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
 		redis:      redisClient,
 		ctx:        ctx,
 		cancel:     cancel,
 		logger:     logger,
+		config:     cfg,
+		rateLimits: DefaultRateLimitConfig(),
+	}
+	for i := 0; i < max(cfg.Shards, 1); i++ {
+		hub.shards = append(hub.shards, newHubShard(hub))
 	}
 
-	// Subscribe to Redis channel for cross-instance messaging
-	hub.pubsub = redisClient.Subscribe(ctx, cfg.RedisChannel)
+	// Subscribe to Redis channels for cross-instance messaging
+	hub.pubsub = redisClient.Subscribe(ctx, cfg.RedisChannel, binaryChannel)
 
 	return hub
 }
 
-// Run starts the hub's main event loop
+// Run starts the hub's event loops and blocks until the hub stops
 func (h *Hub) Run() {
 	// Start Redis subscription handler
 	go h.handleRedisMessages()
@@ -154,37 +234,42 @@ func (h *Hub) Run() {
 	// Start heartbeat monitor
 	go h.heartbeatMonitor()
 
-	for {
-		select {
-		case <-h.ctx.Done():
-			h.shutdown()
-			return
-
-		case client := <-h.register:
-			h.registerClient(client)
+	// Start acknowledgment redelivery
+	go h.ackMonitor()
 
-		case client := <-h.unregister:
-			h.unregisterClient(client)
+	// Start revoked session monitor
+	if h.auth != nil {
+		go h.sessionMonitor()
+	}
 
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
-		}
+	var wg sync.WaitGroup
+	for _, shard := range h.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shard.run()
+		}()
 	}
+	wg.Wait()
+	h.shutdown()
 }
 
-// registerClient adds a client to the hub
-func (h *Hub) registerClient(client *Client) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// registerClient adds a client to the shard
+func (s *hubShard) registerClient(client *Client) {
+	h := s.hub
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Add to user's client map
-	if _, ok := h.clients[client.UserID]; !ok {
-		h.clients[client.UserID] = make(map[*Client]bool)
+	if _, ok := s.clients[client.UserID]; !ok {
+		s.clients[client.UserID] = make(map[*Client]bool)
 	}
-	h.clients[client.UserID][client] = true
+	s.clients[client.UserID][client] = true
+	h.markOnline(client)
+	h.markActive(client)
 
 	// Add to session map
-	h.sessions[client.SessionID] = client
+	s.sessions[client.SessionID] = client
 
 	h.logger.Info("client registered",
 		slog.String("user_id", client.UserID),
@@ -196,23 +281,25 @@ func (h *Hub) registerClient(client *Client) {
 	h.broadcastPresence(client, true)
 }
 
-// unregisterClient removes a client from the hub
-func (h *Hub) unregisterClient(client *Client) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// unregisterClient removes a client from the shard
+func (s *hubShard) unregisterClient(client *Client) {
+	h := s.hub
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if clients, ok := h.clients[client.UserID]; ok {
+	if clients, ok := s.clients[client.UserID]; ok {
 		if _, ok := clients[client]; ok {
 			delete(clients, client)
 			close(client.Send)
+			h.markOffline(client)
 
 			if len(clients) == 0 {
-				delete(h.clients, client.UserID)
+				delete(s.clients, client.UserID)
 			}
 		}
 	}
 
-	delete(h.sessions, client.SessionID)
+	delete(s.sessions, client.SessionID)
 
 	h.logger.Info("client unregistered",
 		slog.String("user_id", client.UserID),
@@ -223,12 +310,29 @@ func (h *Hub) unregisterClient(client *Client) {
 	h.broadcastPresence(client, false)
 }
 
-// broadcastMessage sends a message to all relevant clients
+// broadcastMessage sends a message to all relevant clients. The loop of
+// the shard owning msg.UserID runs it.
 func (h *Hub) broadcastMessage(msg *Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	// Typing and presence aren't numbered, persisted or tracked
+	if ephemeral(msg.Type) {
+		h.deliverEphemeral(msg)
+		return
+	}
+
+	// Pick the device, then number the message before anything persists
+	// or sends it
+	h.resolveRoute(msg)
+	if msg.Seq == 0 && msg.Audience == nil {
+		msg.Seq = h.nextSeq(msg.UserID)
+	}
+	if msg.SessionSeq == 0 && sequenced(msg) {
+		msg.SessionSeq = h.nextSessionSeq(msg.SessionID)
+	}
 
 	// Handle crisis alerts specially
+	if msg.Type == MessageTypeCrisisAlert {
+		h.watchCrisis(msg)
+	}
 	if msg.Type == MessageTypeCrisisAlert && h.crisisHandler != nil {
 		go func() {
 			if err := h.crisisHandler.HandleCrisisAlert(h.ctx, msg); err != nil {
@@ -251,25 +355,35 @@ func (h *Hub) broadcastMessage(msg *Message) {
 		}()
 	}
 
+	// Track delivery and reads for the sender
+	if msg.SenderID != "" {
+		h.recordSent(msg)
+	}
+
+	// Track messages the recipient must acknowledge
+	if msg.RequiresAck {
+		h.trackAck(msg)
+	}
+
 	// Serialize message
 	data, err := json.Marshal(msg)
 	if err != nil {
 		h.logger.Error("failed to marshal message", slog.String("error", err.Error()))
 		return
 	}
+	if msg.SessionSeq > 0 {
+		h.logSessionMessage(msg, data)
+	}
 
-	// Send to all clients for this user
-	if clients, ok := h.clients[msg.UserID]; ok {
-		for client := range clients {
-			select {
-			case client.Send <- data:
-			default:
-				// Client buffer full, close connection
-				h.unregister <- client
-			}
-		}
+	// Hold it for recipients with no connection here, if they have none
+	// anywhere
+	for _, userID := range h.offlineCandidates(msg) {
+		go h.offlineFallback(userID, msg, data)
 	}
 
+	// Send to all clients for this user, or the audience
+	h.enqueueLocal(msg, data)
+
 	// Publish to Redis for other instances
 	h.publishToRedis(msg)
 }
@@ -300,6 +414,11 @@ func (h *Hub) handleRedisMessages() {
 		case <-h.ctx.Done():
 			return
 		case redisMsg := <-ch:
+			if redisMsg.Channel == binaryChannel {
+				h.deliverBinaryLocal([]byte(redisMsg.Payload))
+				continue
+			}
+
 			var msg Message
 			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
 				h.logger.Error("failed to unmarshal Redis message",
@@ -316,25 +435,12 @@ func (h *Hub) handleRedisMessages() {
 
 // deliverLocal delivers a message to local clients without republishing
 func (h *Hub) deliverLocal(msg *Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return
 	}
 
-	if clients, ok := h.clients[msg.UserID]; ok {
-		for client := range clients {
-			select {
-			case client.Send <- data:
-			default:
-				go func(c *Client) {
-					h.unregister <- c
-				}(client)
-			}
-		}
-	}
+	h.enqueueLocal(msg, data)
 }
 
 // broadcastPresence sends presence updates to relevant users
@@ -350,21 +456,37 @@ func (h *Hub) broadcastPresence(client *Client, online bool) {
 		Timestamp: time.Now(),
 	}
 
-	// Broadcast to care team if this is a resident
+	// Broadcast to care team if this is a resident. The shard's loop is
+	// running this, so the lookups and sending happen off it.
 	if client.Role == "resident" {
-		h.notifyCareTeam(client.UserID, msg)
+		go h.notifyCareTeam(client.UserID, msg)
 	}
 }
 
-// notifyCareTeam sends notifications to care team members
+// notifyCareTeam sends a resident's presence to the connected members of
+// their care team. Going offline is only reported once the resident has
+// stayed offline on every instance for OfflineGrace, and raises a crisis
+// alert if they are in an active crisis.
 func (h *Hub) notifyCareTeam(residentID string, msg *Message) {
-	// Implementation would query care team relationships
-	// and send presence updates to relevant staff/family
+	if online, _ := msg.Metadata["online"].(bool); !online {
+		if !h.staysOffline(residentID) {
+			return
+		}
+		h.alertCrisisDisconnect(residentID)
+	}
+
+	err := h.SendToCareTeam(residentID, msg)
+	if err != nil && !errors.Is(err, ErrNoCareTeamDirectory) {
+		h.logger.Error("failed to send presence to care team",
+			slog.String("user_id", residentID),
+			slog.String("error", err.Error()),
+		)
+	}
 }
 
 // heartbeatMonitor checks for stale client connections
 func (h *Hub) heartbeatMonitor() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(h.config.HeartbeatInterval)
 	defer ticker.Stop()
 
 	for {
@@ -373,25 +495,23 @@ func (h *Hub) heartbeatMonitor() {
 			return
 		case <-ticker.C:
 			h.checkHeartbeats()
+			h.refreshPresence()
 		}
 	}
 }
 
-// checkHeartbeats removes clients that haven't responded to pings
+// checkHeartbeats removes clients that haven't responded to pings for
+// longer than ReadTimeout
 func (h *Hub) checkHeartbeats() {
-	h.mu.RLock()
 	staleClients := make([]*Client, 0)
 
-	for _, clients := range h.clients {
-		for client := range clients {
-			client.mu.RLock()
-			if time.Since(client.LastPing) > 90*time.Second {
-				staleClients = append(staleClients, client)
-			}
-			client.mu.RUnlock()
+	for _, client := range h.connectedClients() {
+		client.mu.RLock()
+		if time.Since(client.LastPing) > h.config.ReadTimeout {
+			staleClients = append(staleClients, client)
 		}
+		client.mu.RUnlock()
 	}
-	h.mu.RUnlock()
 
 	// Unregister stale clients
 	for _, client := range staleClients {
@@ -399,18 +519,18 @@ func (h *Hub) checkHeartbeats() {
 			slog.String("user_id", client.UserID),
 			slog.Duration("last_ping", time.Since(client.LastPing)),
 		)
-		h.unregister <- client
+		h.leave(client)
 	}
 }
 
 // SendToUser sends a message to all connections for a specific user
 func (h *Hub) SendToUser(userID string, msg *Message) error {
 	msg.Timestamp = time.Now()
-	h.broadcast <- msg
-	return nil
+	return h.submit(msg)
 }
 
-// SendCrisisAlert sends a crisis alert with guaranteed delivery
+// SendCrisisAlert sends a crisis alert about a resident with guaranteed
+// delivery to their care team and the CrisisAlertRoles at their facility
 func (h *Hub) SendCrisisAlert(userID string, crisisLevel string, details map[string]interface{}) error {
 	msg := &Message{
 		Type:        MessageTypeCrisisAlert,
@@ -421,47 +541,53 @@ func (h *Hub) SendCrisisAlert(userID string, crisisLevel string, details map[str
 		RequiresAck: true,
 	}
 
-	h.broadcast <- msg
+	audience, err := h.crisisAudience(userID)
+	if err == nil {
+		err = h.sendToAudience(audience, msg)
+	}
 
 	// Also notify care team
 	if h.crisisHandler != nil {
-		return h.crisisHandler.NotifyCareTeam(h.ctx, userID, crisisLevel)
+		err = errors.Join(err, h.crisisHandler.NotifyCareTeam(h.ctx, userID, crisisLevel))
 	}
 
-	return nil
+	return err
 }
 
 // GetOnlineUsers returns a list of currently connected user IDs
 func (h *Hub) GetOnlineUsers() []string {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	users := make([]string, 0, len(h.clients))
-	for userID := range h.clients {
-		users = append(users, userID)
+	users := make([]string, 0)
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for userID := range s.clients {
+			users = append(users, userID)
+		}
+		s.mu.RUnlock()
 	}
 	return users
 }
 
 // IsUserOnline checks if a user has any active connections
 func (h *Hub) IsUserOnline(userID string) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	s := h.shardFor(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	clients, ok := h.clients[userID]
+	clients, ok := s.clients[userID]
 	return ok && len(clients) > 0
 }
 
 // shutdown gracefully shuts down the hub
 func (h *Hub) shutdown() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	// Close all client connections
-	for _, clients := range h.clients {
-		for client := range clients {
-			close(client.Send)
+	for _, s := range h.shards {
+		s.mu.Lock()
+		for _, clients := range s.clients {
+			for client := range clients {
+				close(client.Send)
+			}
 		}
+		s.mu.Unlock()
 	}
 
 	// Close Redis pub/sub
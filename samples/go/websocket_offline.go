@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+)
+
+// Offline delivery
+const (
+	inboxSize = 100 // Messages held per offline user
+	inboxTTL  = 7 * 24 * time.Hour
+)
+
+// Notifier reaches users who aren't connected, e.g. by push notification
+// or SMS
+type Notifier interface {
+	NotifyOffline(ctx context.Context, userID string, msg *Message) error
+}
+
+// SetNotifier enables offline notifications. Call before Run.
+func (h *Hub) SetNotifier(notifier Notifier) {
+	h.notifier = notifier
+}
+
+// presenceKey holds a user's connected clients on every instance, scored
+// by when their lease runs out, unix ms
+func presenceKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:presence:%s", userID)
+}
+
+// inboxKey holds messages sent to a user while they were offline
+func inboxKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:inbox:%s", userID)
+}
+
+// presenceLease is how long a client counts as connected without a
+// refresh; a crashed instance's clients drop out after it
+func (h *Hub) presenceLease() time.Duration {
+	return 3 * h.config.HeartbeatInterval
+}
+
+// markOnline records a client as connected
+func (h *Hub) markOnline(client *Client) {
+	key := presenceKey(client.UserID)
+	expiry := time.Now().Add(h.presenceLease())
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(h.ctx, key, &redis.Z{Score: float64(expiry.UnixMilli()), Member: client.ID})
+		pipe.Expire(h.ctx, key, h.presenceLease())
+		// Renews the claim ServeWS made; SetNX restores a lapsed one
+		// without taking over a session another user has since claimed
+		pipe.SetNX(h.ctx, sessionOwnerKey(client.SessionID), client.UserID, h.presenceLease())
+		pipe.Expire(h.ctx, sessionOwnerKey(client.SessionID), h.presenceLease())
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to record presence",
+			slog.String("user_id", client.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// markOffline records a client as gone
+func (h *Hub) markOffline(client *Client) {
+	h.redis.ZRem(h.ctx, presenceKey(client.UserID), client.ID)
+}
+
+// refreshPresence renews the leases of this instance's clients
+func (h *Hub) refreshPresence() {
+	for _, client := range h.connectedClients() {
+		h.markOnline(client)
+	}
+}
+
+// userOnline reports whether a user has a client connected to any instance
+func (h *Hub) userOnline(ctx context.Context, userID string) (bool, error) {
+	count, err := h.redis.ZCount(ctx, presenceKey(userID), strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check presence: %w", err)
+	}
+	return count > 0, nil
+}
+
+// offlineCandidates returns the recipients of a message who have no
+// client on this instance, for a crisis alert or chat
+func (h *Hub) offlineCandidates(msg *Message) []string {
+	if msg.Type != MessageTypeCrisisAlert && msg.Type != MessageTypeChat {
+		return nil // Other types only matter live
+	}
+	userIDs := []string{msg.UserID}
+	if msg.Audience != nil {
+		// Role and facility audiences can't be listed; their staff are on
+		// shift and the ack monitor escalates alerts nobody takes
+		userIDs = msg.Audience.UserIDs
+	}
+
+	var candidates []string
+	for _, userID := range userIDs {
+		if !h.IsUserOnline(userID) {
+			candidates = append(candidates, userID)
+		}
+	}
+	return candidates
+}
+
+// offlineFallback holds a message for a user with no client on any
+// instance, for delivery on their next connect, and notifies them: always
+// for a crisis alert, and for chat if PushChat is set. A user whose
+// presence can't be checked is treated as offline.
+func (h *Hub) offlineFallback(userID string, msg *Message, data []byte) {
+	online, err := h.userOnline(h.ctx, userID)
+	if err != nil {
+		h.logger.Warn("presence unavailable",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+	if online {
+		return
+	}
+
+	h.holdForUser(userID, data)
+
+	if h.notifier == nil || (msg.Type == MessageTypeChat && !h.config.PushChat) {
+		return
+	}
+	if err := h.notifier.NotifyOffline(h.ctx, userID, msg); err != nil {
+		h.logger.Error("failed to notify offline user",
+			slog.String("user_id", userID),
+			slog.String("type", string(msg.Type)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// holdForUser adds a serialized message to a user's offline inbox
+func (h *Hub) holdForUser(userID string, data []byte) {
+	key := inboxKey(userID)
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(h.ctx, key, data)
+		pipe.LTrim(h.ctx, key, -inboxSize, -1)
+		pipe.Expire(h.ctx, key, inboxTTL)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to hold message for offline user",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// deliverInbox writes the messages held while the client's user was
+// offline, oldest first, and empties the inbox; the first of the user's
+// devices to connect gets them, except those sent to another session,
+// which stay held. Messages already replayed through caughtUp are skipped. It returns the sequence number the client is now
+// caught up to. Only write failures are returned.
+func (c *Client) deliverInbox(caughtUp int64) (int64, error) {
+	h := c.Hub
+	var held *redis.StringSliceCmd
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		held = pipe.LRange(h.ctx, inboxKey(c.UserID), 0, -1)
+		pipe.Del(h.ctx, inboxKey(c.UserID))
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to load offline inbox",
+			slog.String("user_id", c.UserID),
+			slog.String("error", err.Error()),
+		)
+		return caughtUp, nil
+	}
+
+	through := caughtUp
+	for _, data := range held.Val() {
+		seq := messageSeq([]byte(data))
+		if seq > 0 && seq <= caughtUp {
+			continue
+		}
+		if !c.routedToData([]byte(data)) {
+			h.holdForUser(c.UserID, []byte(data))
+			continue
+		}
+		if err := c.writeFrame(websocket.TextMessage, []byte(data)); err != nil {
+			return 0, err
+		}
+		c.markDelivered([]byte(data))
+		through = max(through, seq)
+	}
+	return through, nil
+}
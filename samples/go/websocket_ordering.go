@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Messages in a conversation are numbered by session_seq as the hub takes
+// them. Delivery paths can still reorder or repeat them, so clients render
+// in session_seq order, drop numbers already rendered, and ask for any
+// they skipped with a resend message:
+//
+//	{"type": "resend", "metadata": {"from": 41, "to": 44}}
+//
+// Recent messages are kept per session in Redis to answer from; a
+// resend_done message follows with how many were no longer available.
+// Typing, presence and heartbeats aren't numbered, as they may be shed.
+const (
+	sessionLogSize = 500 // Messages kept per session for resends
+	sessionLogTTL  = time.Hour
+	maxResend      = 200 // Most messages one resend can ask for
+)
+
+// sessionSeqKey holds the last session_seq given in a session
+func sessionSeqKey(sessionID string) string {
+	return fmt.Sprintf("lilo:websocket:session_seq:%s", sessionID)
+}
+
+// sessionLogKey holds a session's recent messages scored by session_seq
+func sessionLogKey(sessionID string) string {
+	return fmt.Sprintf("lilo:websocket:session_log:%s", sessionID)
+}
+
+// sequenced reports whether a message is numbered in its session
+func sequenced(msg *Message) bool {
+	return msg.SessionID != "" && msg.Audience == nil && laneFor(msg.Type) != laneLow
+}
+
+// nextSessionSeq numbers a message in its session. Numbers come from
+// Redis, so they increase across instances in the order the hubs take the
+// messages; a message left at 0 is delivered unnumbered.
+func (h *Hub) nextSessionSeq(sessionID string) int64 {
+	seq, err := h.redis.Incr(h.ctx, sessionSeqKey(sessionID)).Result()
+	if err != nil {
+		h.logger.Error("failed to sequence session message",
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()),
+		)
+		return 0
+	}
+	return seq
+}
+
+// logSessionMessage keeps a numbered message for resends
+func (h *Hub) logSessionMessage(msg *Message, data []byte) {
+	key := sessionLogKey(msg.SessionID)
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(h.ctx, key, &redis.Z{Score: float64(msg.SessionSeq), Member: data})
+		pipe.ZRemRangeByRank(h.ctx, key, 0, -sessionLogSize-1)
+		pipe.Expire(h.ctx, key, sessionLogTTL)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to log session message",
+			slog.String("session_id", msg.SessionID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// resend answers a client's request for session messages it skipped,
+// from its own session and addressed to its user only
+func (c *Client) resend(req *Message) {
+	h := c.Hub
+	from, to := metadataInt(req.Metadata, "from"), metadataInt(req.Metadata, "to")
+	if from <= 0 || to < from {
+		return
+	}
+	to = min(to, from+maxResend-1)
+
+	logged, err := h.redis.ZRangeByScore(h.ctx, sessionLogKey(c.SessionID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		h.logger.Error("failed to load session messages for resend",
+			slog.String("session_id", c.SessionID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	sent := 0
+	var pending []pendingHold
+	s := h.shardFor(c.UserID)
+	s.mu.RLock()
+	if s.registered(c) {
+		for _, data := range logged {
+			var msg Message
+			if err := json.Unmarshal([]byte(data), &msg); err != nil || msg.UserID != c.UserID {
+				continue
+			}
+			// Once one message is held, the rest are held behind it
+			if len(pending) > 0 {
+				if c.Capabilities.handles(msg.Type) {
+					pending = append(pending, pendingHold{client: c, data: []byte(data)})
+				}
+			} else if c.enqueue(msg.Type, []byte(data)) == needsHold {
+				pending = append(pending, pendingHold{client: c, data: []byte(data)})
+			}
+			sent++
+		}
+	}
+	s.mu.RUnlock()
+	h.holdPending(pending)
+
+	h.notify(c, &Message{
+		Type:      MessageTypeResendDone,
+		UserID:    c.UserID,
+		SessionID: c.SessionID,
+		Metadata: map[string]interface{}{
+			"from":        from,
+			"to":          to,
+			"unavailable": int(to-from+1) - sent,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// metadataInt reads a whole number from message metadata, where JSON
+// decoding leaves it a float64
+func metadataInt(metadata map[string]interface{}, key string) int64 {
+	switch v := metadata[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
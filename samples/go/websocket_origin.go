@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Browsers send an Origin header with every WebSocket upgrade, and attach
+// the site's cookies whatever page opened it, so an upgrade from an origin
+// the deployment doesn't serve is refused before the token is looked at.
+// Upgrades without an Origin come from native clients such as the
+// facility tablets and are let through to token checks.
+
+// UpgradeRefusal is why an upgrade was turned away
+type UpgradeRefusal string
+
+const (
+	RefusedOrigin   UpgradeRefusal = "cross_origin"      // Origin not the hub's own or in AllowedOrigins
+	RefusedToken    UpgradeRefusal = "invalid_token"     // Missing, malformed or rejected bearer token
+	RefusedIdentity UpgradeRefusal = "identity_mismatch" // Asked for an identity other than the token's
+	RefusedSession  UpgradeRefusal = "session_owned"     // Asked for a session another user is connected on
+)
+
+// RefusedUpgrade records an upgrade the hub turned away
+type RefusedUpgrade struct {
+	Reason     UpgradeRefusal
+	Origin     string
+	RemoteAddr string
+	UserID     string // The token's user, if it was valid
+	At         time.Time
+}
+
+// UpgradeAuditor records refused upgrades for security review, e.g. in the
+// platform's HIPAA audit log. Refusals are logged either way.
+type UpgradeAuditor interface {
+	RecordRefusedUpgrade(ctx context.Context, refusal *RefusedUpgrade) error
+}
+
+// SetUpgradeAuditor records refused upgrades to auditor. Call before Run.
+func (h *Hub) SetUpgradeAuditor(auditor UpgradeAuditor) {
+	h.upgradeAuditor = auditor
+}
+
+// originAllowed reports whether an upgrade may come from its Origin: none,
+// the hub's own host, or one of AllowedOrigins, where *. matches any
+// subdomain, e.g. https://*.lilo.care
+func (h *Hub) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+
+	scheme, host := strings.ToLower(parsed.Scheme), strings.ToLower(parsed.Host)
+	for _, allowed := range h.config.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		if allowed == scheme+"://"+host {
+			return true
+		}
+		if domain, ok := strings.CutPrefix(allowed, scheme+"://*."); ok && strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseUpgrade turns an upgrade away with status, logging and auditing
+// the refusal
+func (h *Hub) refuseUpgrade(w http.ResponseWriter, r *http.Request, status int, reason UpgradeRefusal, userID, message string) {
+	refusal := &RefusedUpgrade{
+		Reason:     reason,
+		Origin:     r.Header.Get("Origin"),
+		RemoteAddr: r.RemoteAddr,
+		UserID:     userID,
+		At:         time.Now(),
+	}
+	h.logger.Warn("websocket upgrade refused",
+		slog.String("reason", string(reason)),
+		slog.String("origin", refusal.Origin),
+		slog.String("remote_addr", refusal.RemoteAddr),
+		slog.String("user_id", userID),
+	)
+	if h.upgradeAuditor != nil {
+		if err := h.upgradeAuditor.RecordRefusedUpgrade(r.Context(), refusal); err != nil {
+			h.logger.Error("failed to audit refused upgrade",
+				slog.String("reason", string(reason)),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// activeCrisisKey marks a resident as in an active crisis, holding the
+// level of the last alert about them
+func activeCrisisKey(residentID string) string {
+	return fmt.Sprintf("lilo:websocket:active_crisis:%s", residentID)
+}
+
+// ephemeral reports whether a message type is only of use live, so isn't
+// numbered, persisted or tracked
+func ephemeral(msgType MessageType) bool {
+	return msgType == MessageTypeTyping || msgType == MessageTypePresence
+}
+
+// deliverEphemeral sends a typing or presence message to its recipients
+// on every instance
+func (h *Hub) deliverEphemeral(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	h.enqueueLocal(msg, data)
+	h.publishToRedis(msg)
+}
+
+// watchCrisis marks the resident a crisis alert is about as in an active
+// crisis for CrisisWatchWindow, or until EndCrisisWatch
+func (h *Hub) watchCrisis(msg *Message) {
+	err := h.redis.Set(h.ctx, activeCrisisKey(msg.UserID), msg.CrisisLevel, h.config.CrisisWatchWindow).Err()
+	if err != nil {
+		h.logger.Error("failed to mark active crisis",
+			slog.String("user_id", msg.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// EndCrisisWatch clears a resident's active crisis once it is resolved, so
+// disconnecting no longer raises an alert
+func (h *Hub) EndCrisisWatch(ctx context.Context, residentID string) error {
+	if err := h.redis.Del(ctx, activeCrisisKey(residentID)).Err(); err != nil {
+		return fmt.Errorf("failed to end crisis watch: %w", err)
+	}
+	return nil
+}
+
+// staysOffline waits out OfflineGrace and reports whether the resident is
+// still without a client on any instance, so a tablet reconnecting after
+// a Wi-Fi drop or a drain isn't reported
+func (h *Hub) staysOffline(residentID string) bool {
+	select {
+	case <-time.After(h.config.OfflineGrace):
+	case <-h.ctx.Done():
+		return false
+	}
+	online, err := h.userOnline(h.ctx, residentID)
+	if err != nil {
+		h.logger.Warn("presence unavailable",
+			slog.String("user_id", residentID),
+			slog.String("error", err.Error()),
+		)
+	}
+	return !online
+}
+
+// alertCrisisDisconnect raises a crisis alert if a resident who has gone
+// offline is in an active crisis
+func (h *Hub) alertCrisisDisconnect(residentID string) {
+	level, err := h.redis.Get(h.ctx, activeCrisisKey(residentID)).Result()
+	if err != nil {
+		return // Not in a crisis, or expired
+	}
+
+	h.logger.Warn("resident disconnected during active crisis",
+		slog.String("user_id", residentID),
+		slog.String("crisis_level", level),
+	)
+	err = h.SendCrisisAlert(residentID, level, map[string]interface{}{
+		"reason": "resident_disconnected",
+	})
+	if err != nil {
+		h.logger.Error("failed to alert on crisis disconnect",
+			slog.String("user_id", residentID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
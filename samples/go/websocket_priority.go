@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Per-client lane buffers; chat uses Send and its sendBuffer
+const (
+	crisisLaneBuffer = 32
+	lowLaneBuffer    = 64
+)
+
+// lane is an outbound queue of a given priority
+type lane int
+
+const (
+	laneCrisis lane = iota // Written ahead of everything else
+	laneChat
+	laneLow // Shed when full rather than costing the client its connection
+)
+
+// laneFor returns the lane a message type travels in
+func laneFor(msgType MessageType) lane {
+	switch msgType {
+	case MessageTypeCrisisAlert:
+		return laneCrisis
+	case MessageTypeTyping, MessageTypePresence, MessageTypeHeartbeat:
+		return laneLow
+	default:
+		return laneChat
+	}
+}
+
+// priorityMetrics tracks lane shedding across the hub's clients
+var priorityMetrics = struct {
+	shed *prometheus.CounterVec
+}{
+	shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "shed_messages_total",
+		Help:      "Low-priority messages dropped for clients whose queue was full, by message type.",
+	}, []string{"type"}),
+}
+
+// PriorityCollectors returns the lane collectors for registration with the
+// process metrics registry
+func PriorityCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		priorityMetrics.shed,
+	}
+}
+
+// queueResult is what enqueue did with a message
+type queueResult int
+
+const (
+	queued    queueResult = iota // Queued in its lane, shed or skipped
+	needsHold                    // To be held in Redis with hold
+)
+
+// enqueue queues a serialized message in its lane without blocking. A full
+// low lane sheds the message. A full crisis or chat lane, or chat for a
+// client with messages held, returns needsHold, and the caller holds the
+// message with hold once it has released the shard lock. Clients without
+// lanes of their own queue everything on Send. Types the client can't
+// handle are skipped.
+func (c *Client) enqueue(msgType MessageType, data []byte) queueResult {
+	if !c.Capabilities.handles(msgType) {
+		return queued // Skipped for a client on an older protocol
+	}
+	if laneFor(msgType) == laneChat && c.degraded() {
+		return needsHold // Behind the messages already held
+	}
+	queue := c.Send
+	switch laneFor(msgType) {
+	case laneCrisis:
+		if c.crisis != nil {
+			queue = c.crisis
+		}
+	case laneLow:
+		if c.low != nil {
+			queue = c.low
+		}
+	}
+
+	select {
+	case queue <- data:
+		return queued
+	default:
+		if laneFor(msgType) == laneLow {
+			priorityMetrics.shed.WithLabelValues(string(msgType)).Inc()
+			return queued
+		}
+		return needsHold
+	}
+}
+
+// submit hands a message to the shard of the user it's about, crisis
+// alerts ahead of the rest
+func (h *Hub) submit(msg *Message) error {
+	shard := h.shardFor(msg.UserID)
+	queue := shard.broadcast
+	if msg.Type == MessageTypeCrisisAlert {
+		queue = shard.priority
+	}
+	select {
+	case queue <- msg:
+		return nil
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	}
+}
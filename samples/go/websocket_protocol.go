@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clients announce what they speak when they connect, in query parameters
+// alongside session_id and last_seq:
+//
+//	/ws?protocol=2&types=chat,crisis_alert,receipt
+//
+// protocol is the Message schema version; clients that don't send it are
+// taken to be version 1 tablets. types narrows the message types the
+// client handles to those listed; without it the client gets every type
+// its version has. Binary frames and compression are negotiated in the
+// upgrade itself and recorded here too. The hub skips types a client
+// can't handle, apart from crisis alerts, and writes messages to version
+// 1 clients without the fields added since.
+const ProtocolVersion = 2
+
+// protocolV1Types are the message types of protocol version 1
+var protocolV1Types = []MessageType{
+	MessageTypeChat,
+	MessageTypeCrisisAlert,
+	MessageTypeTyping,
+	MessageTypePresence,
+	MessageTypeAcknowledge,
+	MessageTypeHeartbeat,
+}
+
+// Capabilities is what a client negotiated at connect
+type Capabilities struct {
+	Version     int           // Protocol version; 0 for the current one
+	Types       []MessageType // Message types handled; nil for all of Version's
+	Binary      bool          // Binary frames negotiated; see Client.Media
+	Compression bool          // permessage-deflate negotiated
+}
+
+// messageV1 is a Message as protocol version 1 has it
+type messageV1 struct {
+	ID          string                 `json:"id"`
+	Type        MessageType            `json:"type"`
+	UserID      string                 `json:"user_id"`
+	SessionID   string                 `json:"session_id"`
+	Content     string                 `json:"content,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	CrisisLevel string                 `json:"crisis_level,omitempty"`
+	RequiresAck bool                   `json:"requires_ack,omitempty"`
+}
+
+// negotiateCapabilities reads a client's announced protocol version and
+// message types from its upgrade request
+func negotiateCapabilities(r *http.Request, media []string, deflate bool) Capabilities {
+	caps := Capabilities{
+		Version:     1,
+		Binary:      len(media) > 0,
+		Compression: deflate,
+	}
+	if version, err := strconv.Atoi(r.URL.Query().Get("protocol")); err == nil && version > 1 {
+		caps.Version = min(version, ProtocolVersion)
+	}
+	if types := r.URL.Query().Get("types"); types != "" {
+		caps.Types = []MessageType{}
+		for _, msgType := range strings.Split(types, ",") {
+			msgType := MessageType(strings.TrimSpace(msgType))
+			if caps.versionHas(msgType) && !slices.Contains(caps.Types, msgType) {
+				caps.Types = append(caps.Types, msgType)
+			}
+		}
+	}
+	return caps
+}
+
+// versionHas reports whether the negotiated protocol version has a
+// message type
+func (caps Capabilities) versionHas(msgType MessageType) bool {
+	return caps.Version == 0 || caps.Version >= ProtocolVersion || slices.Contains(protocolV1Types, msgType)
+}
+
+// handles reports whether the client takes a message type. Crisis alerts
+// are written whatever the client announced.
+func (caps Capabilities) handles(msgType MessageType) bool {
+	if msgType == MessageTypeCrisisAlert {
+		return true
+	}
+	if caps.Types != nil {
+		return slices.Contains(caps.Types, msgType)
+	}
+	return caps.versionHas(msgType)
+}
+
+// downgrade drops the fields of a serialized message that the client's
+// protocol version doesn't know. It runs as the message is written, so
+// receipts are still taken from the full message.
+func (c *Client) downgrade(data []byte) []byte {
+	if version := c.Capabilities.Version; version == 0 || version >= ProtocolVersion {
+		return data
+	}
+
+	var msg messageV1
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return data
+	}
+	downgraded, err := json.Marshal(&msg)
+	if err != nil {
+		return data
+	}
+	return downgraded
+}
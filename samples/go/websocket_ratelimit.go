@@ -0,0 +1,244 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig bounds how fast clients can send into the hub, so one
+// connection can't fill the broadcast channel for everyone. Connection
+// limits are local; user limits and mutes live in Redis so they hold
+// across instances. A zero rate disables that limit.
+type RateLimitConfig struct {
+	ConnMessagesPerSecond float64
+	ConnBurst             int
+	UserMessagesPerSecond float64 // Across all of a user's connections
+	UserBurst             int
+	MuteAfter             int // Throttled messages within MuteWindow before the user is muted; 0 never mutes
+	MuteWindow            time.Duration
+	MuteDuration          time.Duration
+}
+
+// DefaultRateLimitConfig returns default rate limit configuration
+func DefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		ConnMessagesPerSecond: 5,
+		ConnBurst:             10,
+		UserMessagesPerSecond: 10,
+		UserBurst:             20,
+		MuteAfter:             50,
+		MuteWindow:            time.Minute,
+		MuteDuration:          time.Minute,
+	}
+}
+
+// SetRateLimits replaces the inbound rate limits. Call before Run.
+func (h *Hub) SetRateLimits(config *RateLimitConfig) {
+	h.rateLimits = config
+}
+
+// takeToken is a Redis token bucket; it returns whether a token was taken
+// and, if not, the milliseconds until one is available
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}`)
+
+// rateLimitMetrics tracks throttling across the hub's clients
+var rateLimitMetrics = struct {
+	throttled *prometheus.CounterVec
+	mutes     prometheus.Counter
+}{
+	throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "throttled_messages_total",
+		Help:      "Inbound messages dropped by rate limiting, by the limit that applied.",
+	}, []string{"limit"}),
+	mutes: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "user_mutes_total",
+		Help:      "Users muted for repeatedly exceeding rate limits.",
+	}),
+}
+
+// RateLimitCollectors returns the throttling collectors for registration
+// with the process metrics registry
+func RateLimitCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		rateLimitMetrics.throttled,
+		rateLimitMetrics.mutes,
+	}
+}
+
+// userBucketKey holds a user's inbound token bucket
+func userBucketKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:ratelimit:%s", userID)
+}
+
+// userViolationsKey counts a user's throttled messages in the mute window
+func userViolationsKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:ratelimit:%s:violations", userID)
+}
+
+// userMuteKey marks a user muted until it expires
+func userMuteKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:mute:%s", userID)
+}
+
+// newConnLimiter returns a connection's local limiter, or nil if unlimited
+func (h *Hub) newConnLimiter() *rate.Limiter {
+	limits := h.rateLimits
+	if limits == nil || limits.ConnMessagesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(limits.ConnMessagesPerSecond), max(limits.ConnBurst, 1))
+}
+
+// allowInbound applies the rate limits to a message from a client. A
+// Redis failure lets the message through.
+func (h *Hub) allowInbound(client *Client) bool {
+	limits := h.rateLimits
+	if limits == nil {
+		return true
+	}
+
+	if muted, err := h.redis.PTTL(h.ctx, userMuteKey(client.UserID)).Result(); err == nil && muted > 0 {
+		rateLimitMetrics.throttled.WithLabelValues("muted").Inc()
+		return false
+	}
+
+	if client.limiter != nil {
+		if reservation := client.limiter.Reserve(); reservation.Delay() > 0 {
+			retryAfter := reservation.Delay()
+			reservation.Cancel()
+			h.throttle(client, "connection", retryAfter)
+			return false
+		}
+	}
+
+	if limits.UserMessagesPerSecond > 0 {
+		result, err := takeToken.Run(h.ctx, h.redis, []string{userBucketKey(client.UserID)},
+			limits.UserMessagesPerSecond, max(limits.UserBurst, 1), time.Now().UnixMilli()).Int64Slice()
+		if err != nil {
+			h.logger.Warn("websocket rate limit unavailable",
+				slog.String("user_id", client.UserID),
+				slog.String("error", err.Error()),
+			)
+		} else if result[0] == 0 {
+			h.throttle(client, "user", time.Duration(result[1])*time.Millisecond)
+			return false
+		}
+	}
+
+	client.throttled = false
+	return true
+}
+
+// throttle records a dropped message and warns the client on the first of
+// a run. Enough of them within MuteWindow mutes the user everywhere.
+func (h *Hub) throttle(client *Client, limit string, retryAfter time.Duration) {
+	rateLimitMetrics.throttled.WithLabelValues(limit).Inc()
+
+	if muteAfter := h.rateLimits.MuteAfter; muteAfter > 0 {
+		key := userViolationsKey(client.UserID)
+		var violations *redis.IntCmd
+		_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+			violations = pipe.Incr(h.ctx, key)
+			pipe.Expire(h.ctx, key, h.rateLimits.MuteWindow)
+			return nil
+		})
+		if err == nil && violations.Val() >= int64(muteAfter) {
+			h.mute(client)
+			return
+		}
+	}
+
+	if client.throttled {
+		return
+	}
+	client.throttled = true
+	h.logger.Warn("websocket client rate limited",
+		slog.String("user_id", client.UserID),
+		slog.String("client_id", client.ID),
+		slog.String("limit", limit),
+	)
+	h.notify(client, &Message{
+		Type:      MessageTypeRateLimited,
+		UserID:    client.UserID,
+		SessionID: client.SessionID,
+		Content:   "You're sending messages too quickly. Please slow down.",
+		Metadata: map[string]interface{}{
+			"limit":               limit,
+			"retry_after_seconds": int(retryAfter.Round(time.Second).Seconds()),
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// mute drops a user's messages on every instance for MuteDuration
+func (h *Hub) mute(client *Client) {
+	duration := h.rateLimits.MuteDuration
+	set, err := h.redis.SetNX(h.ctx, userMuteKey(client.UserID), "1", duration).Result()
+	if err != nil || !set {
+		return
+	}
+	h.redis.Del(h.ctx, userViolationsKey(client.UserID))
+	rateLimitMetrics.mutes.Inc()
+
+	h.logger.Warn("websocket user muted",
+		slog.String("user_id", client.UserID),
+		slog.Duration("duration", duration),
+	)
+	h.notify(client, &Message{
+		Type:      MessageTypeRateLimited,
+		UserID:    client.UserID,
+		SessionID: client.SessionID,
+		Content:   "Messages are paused for a moment because too many were sent.",
+		Metadata: map[string]interface{}{
+			"muted":       true,
+			"muted_until": time.Now().Add(duration),
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// notify sends a message to one client if it is still registered
+func (h *Hub) notify(client *Client, msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	s := h.shardFor(client.UserID)
+	s.mu.RLock()
+	if !s.registered(client) {
+		s.mu.RUnlock()
+		return
+	}
+	result := client.enqueue(msg.Type, data)
+	s.mu.RUnlock()
+
+	if result == needsHold {
+		h.holdPending([]pendingHold{{client: client, data: data}})
+	}
+}
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// receiptRetention is how long delivery state is kept in Redis; the
+// ReceiptStore keeps it for good
+const receiptRetention = 7 * 24 * time.Hour
+
+// MessageStatus is how far a message has got with a recipient
+type MessageStatus string
+
+const (
+	StatusSent      MessageStatus = "sent"      // Accepted by the hub
+	StatusDelivered MessageStatus = "delivered" // Written to one of the recipient's connections
+	StatusRead      MessageStatus = "read"      // Reported read by the recipient's client
+)
+
+// Receipt records a message reaching a status for a user. For sent, the
+// user is the sender.
+type Receipt struct {
+	MessageID string        `json:"message_id"`
+	UserID    string        `json:"user_id"`
+	Status    MessageStatus `json:"status"`
+	At        time.Time     `json:"at"`
+}
+
+// ReceiptStore is a MessageStore that also keeps delivery receipts, e.g.
+// for dashboards showing whether a nurse has seen a family message.
+// Receipts are tracked in Redis either way.
+type ReceiptStore interface {
+	SaveReceipt(ctx context.Context, receipt *Receipt) error
+}
+
+// receiptsKey holds a message's sender and the time each recipient
+// reached each status, in fields named status:user_id
+func receiptsKey(messageID string) string {
+	return fmt.Sprintf("lilo:websocket:receipts:%s", messageID)
+}
+
+// recordSent starts tracking a message that has a sender, giving it an ID
+// if it has none so receipts can name it
+func (h *Hub) recordSent(msg *Message) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	now := time.Now()
+	key := receiptsKey(msg.ID)
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(h.ctx, key, "sender", msg.SenderID, string(StatusSent)+":"+msg.SenderID, now.UnixMilli())
+		pipe.Expire(h.ctx, key, receiptRetention)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to track message receipts",
+			slog.String("message_id", msg.ID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	h.saveReceipt(&Receipt{MessageID: msg.ID, UserID: msg.SenderID, Status: StatusSent, At: now})
+}
+
+// recordReceipt records a recipient reaching a status and tells the sender.
+// Each status is recorded once per recipient, however many of their
+// devices report it. A read receipt counts only from a user the message
+// was delivered to, so clients can't mark arbitrary messages read.
+func (h *Hub) recordReceipt(messageID, userID string, status MessageStatus) {
+	key := receiptsKey(messageID)
+	var sender *redis.StringCmd
+	var delivered *redis.BoolCmd
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		sender = pipe.HGet(h.ctx, key, "sender")
+		delivered = pipe.HExists(h.ctx, key, string(StatusDelivered)+":"+userID)
+		return nil
+	})
+	if err == redis.Nil {
+		return // Untracked or expired
+	}
+	if err != nil {
+		h.logger.Error("failed to load message receipts",
+			slog.String("message_id", messageID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if sender.Val() == userID || (status == StatusRead && !delivered.Val()) {
+		return
+	}
+
+	now := time.Now()
+	recorded, err := h.redis.HSetNX(h.ctx, key, string(status)+":"+userID, now.UnixMilli()).Result()
+	if err != nil || !recorded {
+		return
+	}
+
+	receipt := &Receipt{MessageID: messageID, UserID: userID, Status: status, At: now}
+	h.saveReceipt(receipt)
+
+	// Straight to the sender's clients on every instance; receipts aren't
+	// persisted as messages or numbered for replay
+	h.publishToRedis(&Message{
+		Type:   MessageTypeReceipt,
+		UserID: sender.Val(),
+		Metadata: map[string]interface{}{
+			"message_id": messageID,
+			"user_id":    userID,
+			"status":     status,
+		},
+		Timestamp: now,
+	})
+}
+
+// saveReceipt persists a receipt if the message store keeps them
+func (h *Hub) saveReceipt(receipt *Receipt) {
+	store, ok := h.messageStore.(ReceiptStore)
+	if !ok {
+		return
+	}
+	if err := store.SaveReceipt(h.ctx, receipt); err != nil {
+		h.logger.Error("failed to save receipt",
+			slog.String("message_id", receipt.MessageID),
+			slog.String("status", string(receipt.Status)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// Receipts returns a message's receipts, oldest first, while it is tracked
+// in Redis, e.g. for a sender asking whether their message was read
+func (h *Hub) Receipts(ctx context.Context, messageID string) ([]*Receipt, error) {
+	fields, err := h.redis.HGetAll(ctx, receiptsKey(messageID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipts: %w", err)
+	}
+
+	var receipts []*Receipt
+	for field, value := range fields {
+		status, userID, ok := strings.Cut(field, ":")
+		if !ok {
+			continue // The sender field
+		}
+		millis, _ := strconv.ParseInt(value, 10, 64)
+		receipts = append(receipts, &Receipt{
+			MessageID: messageID,
+			UserID:    userID,
+			Status:    MessageStatus(status),
+			At:        time.UnixMilli(millis),
+		})
+	}
+	slices.SortFunc(receipts, func(a, b *Receipt) int {
+		return a.At.Compare(b.At)
+	})
+	return receipts, nil
+}
+
+// markDelivered records delivery of a written message to this client's
+// user, if it has a sender to tell
+func (c *Client) markDelivered(data []byte) {
+	var msg struct {
+		ID       string `json:"id"`
+		SenderID string `json:"sender_id"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.ID == "" || msg.SenderID == "" || msg.SenderID == c.UserID {
+		return
+	}
+	go c.Hub.recordReceipt(msg.ID, c.UserID, StatusDelivered)
+}
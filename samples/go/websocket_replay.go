@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReplayStore is a MessageStore that can list a user's messages by
+// sequence number. Clients reconnecting to a hub whose store doesn't
+// implement it get live delivery only.
+type ReplayStore interface {
+	MessagesSince(ctx context.Context, userID string, afterSeq int64, limit int) ([]*Message, error)
+}
+
+// userSeqKey holds the last sequence number given to a user's messages
+func userSeqKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:seq:%s", userID)
+}
+
+// SetMessageStore persists every broadcast message to store. Call before Run.
+func (h *Hub) SetMessageStore(store MessageStore) {
+	h.messageStore = store
+}
+
+// nextSeq numbers a user's next message. Sequences are kept in Redis so
+// they increase across instances; a message left at 0 can't be replayed.
+func (h *Hub) nextSeq(userID string) int64 {
+	seq, err := h.redis.Incr(h.ctx, userSeqKey(userID)).Result()
+	if err != nil {
+		h.logger.Error("failed to sequence message",
+			slog.String("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+		return 0
+	}
+	return seq
+}
+
+// replay writes the messages a reconnecting client missed since LastSeq,
+// oldest first and at most ReplayLimit, straight to the connection ahead of
+// anything queued on Send, then a replay_done marker. It returns the
+// sequence number the client is caught up to, so queued duplicates can be
+// skipped. Only write failures are returned.
+func (c *Client) replay() (int64, error) {
+	store, ok := c.Hub.messageStore.(ReplayStore)
+	if !ok || c.LastSeq <= 0 {
+		return c.LastSeq, nil
+	}
+
+	cfg := c.Hub.config
+	// One extra tells whether the replay was cut short
+	missed, err := store.MessagesSince(c.Hub.ctx, c.UserID, c.LastSeq, cfg.ReplayLimit+1)
+	if err != nil {
+		c.Hub.logger.Error("failed to load messages for replay",
+			slog.String("user_id", c.UserID),
+			slog.Int64("last_seq", c.LastSeq),
+			slog.String("error", err.Error()),
+		)
+		return c.LastSeq, nil
+	}
+	truncated := len(missed) > cfg.ReplayLimit
+	if truncated {
+		missed = missed[:cfg.ReplayLimit]
+	}
+
+	through := c.LastSeq
+	for _, msg := range missed {
+		through = max(through, msg.Seq)
+		if !c.routedTo(msg) || !c.Capabilities.handles(msg.Type) {
+			continue // Sent to another of the user's devices, or not understood
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		if err := c.writeFrame(websocket.TextMessage, data); err != nil {
+			return 0, err
+		}
+		c.markDelivered(data)
+	}
+
+	done, err := json.Marshal(&Message{
+		Type:      MessageTypeReplayDone,
+		UserID:    c.UserID,
+		SessionID: c.SessionID,
+		Metadata: map[string]interface{}{
+			"replayed":  len(missed),
+			"through":   through,
+			"truncated": truncated, // Older history has to be fetched separately
+		},
+		Timestamp: time.Now(),
+	})
+	if err != nil || !c.Capabilities.handles(MessageTypeReplayDone) {
+		return through, nil
+	}
+	if err := c.writeFrame(websocket.TextMessage, done); err != nil {
+		return 0, err
+	}
+
+	c.Hub.logger.Info("replayed missed messages",
+		slog.String("user_id", c.UserID),
+		slog.Int64("from_seq", c.LastSeq),
+		slog.Int64("through_seq", through),
+		slog.Int("count", len(missed)),
+		slog.Bool("truncated", truncated),
+	)
+	return through, nil
+}
+
+// messageSeq reads the sequence number of a serialized message
+func messageSeq(data []byte) int64 {
+	var msg struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return 0
+	}
+	return msg.Seq
+}
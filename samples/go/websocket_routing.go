@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrUnknownSession is returned when sending to a session with no client
+// connected on any instance
+var ErrUnknownSession = errors.New("no client connected for session")
+
+// ErrSessionOwned is returned when claiming a session another user is
+// connected on
+var ErrSessionOwned = errors.New("session belongs to another user")
+
+// RoutePolicy picks which of a user's devices a message goes to
+type RoutePolicy string
+
+const (
+	RouteAllDevices RoutePolicy = ""            // Every connected device; the default
+	RouteMostRecent RoutePolicy = "most_recent" // The device the user last connected or sent from
+	RouteSession    RoutePolicy = "session"     // Only the device on SessionID, e.g. the tablet in the resident's room
+)
+
+// sessionOwnerKey holds the user of a connected session, kept alive with
+// the presence lease
+func sessionOwnerKey(sessionID string) string {
+	return fmt.Sprintf("lilo:websocket:session_owner:%s", sessionID)
+}
+
+// recentSessionKey holds the session a user last connected or sent from
+func recentSessionKey(userID string) string {
+	return fmt.Sprintf("lilo:websocket:recent_session:%s", userID)
+}
+
+// SendToSession sends a message to the one device on a session, on
+// whichever instance it is connected to. It is numbered, stored and
+// replayed as the user's, but only ever written to that session.
+func (h *Hub) SendToSession(sessionID string, msg *Message) error {
+	userID, err := h.sessionOwner(h.ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	msg.UserID = userID
+	msg.SessionID = sessionID
+	msg.Route = RouteSession
+	return h.SendToUser(userID, msg)
+}
+
+// sessionOwner returns the user of a connected session
+func (h *Hub) sessionOwner(ctx context.Context, sessionID string) (string, error) {
+	userID, err := h.redis.Get(ctx, sessionOwnerKey(sessionID)).Result()
+	if err == redis.Nil {
+		return "", ErrUnknownSession
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up session: %w", err)
+	}
+	return userID, nil
+}
+
+// claimSession makes userID the owner of a session unless another user
+// already holds it, in which case it returns ErrSessionOwned
+func (h *Hub) claimSession(ctx context.Context, sessionID, userID string) error {
+	key := sessionOwnerKey(sessionID)
+	for {
+		claimed, err := h.redis.SetNX(ctx, key, userID, h.presenceLease()).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim session: %w", err)
+		}
+		if claimed {
+			return nil
+		}
+		owner, err := h.sessionOwner(ctx, sessionID)
+		if errors.Is(err, ErrUnknownSession) {
+			continue // The lease ran out in between
+		}
+		if err != nil {
+			return err
+		}
+		if owner != userID {
+			return ErrSessionOwned
+		}
+		return nil
+	}
+}
+
+// markActive records the client as its user's most recent device
+func (h *Hub) markActive(client *Client) {
+	err := h.redis.Set(h.ctx, recentSessionKey(client.UserID), client.SessionID, h.presenceLease()).Err()
+	if err != nil {
+		h.logger.Error("failed to record recent session",
+			slog.String("user_id", client.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// resolveRoute turns most-recent routing into the session it means, so
+// every instance delivers to the same device. With no recent device known
+// the message goes to all of them.
+func (h *Hub) resolveRoute(msg *Message) {
+	if msg.Route != RouteMostRecent || msg.Audience != nil {
+		return
+	}
+	sessionID, err := h.redis.Get(h.ctx, recentSessionKey(msg.UserID)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			h.logger.Warn("recent session unavailable, sending to all devices",
+				slog.String("user_id", msg.UserID),
+				slog.String("error", err.Error()),
+			)
+		}
+		msg.Route = RouteAllDevices
+		return
+	}
+	msg.Route = RouteSession
+	msg.SessionID = sessionID
+}
+
+// routedTo reports whether a message for the client's user may be written
+// to this client
+func (c *Client) routedTo(msg *Message) bool {
+	return msg.Route != RouteSession || msg.SessionID == c.SessionID
+}
+
+// routedToData is routedTo for a serialized message
+func (c *Client) routedToData(data []byte) bool {
+	var msg struct {
+		Route     RoutePolicy `json:"route"`
+		SessionID string      `json:"session_id"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return true
+	}
+	return c.routedTo(&Message{Route: msg.Route, SessionID: msg.SessionID})
+}
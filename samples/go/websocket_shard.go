@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// A hub splits its clients across shards by a hash of the user ID. Each
+// shard has its own client maps, lock and event loop, so registrations and
+// messages for different users don't queue behind one another. A user's
+// clients and messages always land in the same shard, which keeps that
+// user's messages in order. Messages for an audience or a session are
+// taken by the shard of the user they're about and delivered to matching
+// clients in every shard.
+
+// hubShard holds the clients of the users that hash to it
+type hubShard struct {
+	hub *Hub
+
+	// Registered clients by user ID
+	clients map[string]map[*Client]bool
+
+	// Registered clients by session ID
+	sessions map[string]*Client
+
+	// Inbound messages from clients
+	broadcast chan *Message
+
+	// Crisis alerts, taken ahead of broadcast
+	priority chan *Message
+
+	// Register requests from clients
+	register chan *Client
+
+	// Unregister requests from clients
+	unregister chan *Client
+
+	// Guards clients and sessions; only the shard's own loop writes them
+	mu sync.RWMutex
+}
+
+// newHubShard creates an empty shard
+func newHubShard(h *Hub) *hubShard {
+	return &hubShard{
+		hub:        h,
+		clients:    make(map[string]map[*Client]bool),
+		sessions:   make(map[string]*Client),
+		broadcast:  make(chan *Message, 256),
+		priority:   make(chan *Message, 64),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+	}
+}
+
+// shardFor returns the shard that owns a user's clients and messages
+func (h *Hub) shardFor(userID string) *hubShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+// run is the shard's event loop; it returns when the hub stops
+func (s *hubShard) run() {
+	h := s.hub
+	for {
+		// Crisis alerts go out ahead of anything already waiting
+		select {
+		case message := <-s.priority:
+			h.broadcastMessage(message)
+			continue
+		default:
+		}
+
+		select {
+		case <-h.ctx.Done():
+			return
+
+		case message := <-s.priority:
+			h.broadcastMessage(message)
+
+		case client := <-s.register:
+			s.registerClient(client)
+
+		case client := <-s.unregister:
+			s.unregisterClient(client)
+
+		case message := <-s.broadcast:
+			h.broadcastMessage(message)
+		}
+	}
+}
+
+// registered reports whether a client is still registered, so its queues
+// are open. Callers hold s.mu.
+func (s *hubShard) registered(client *Client) bool {
+	return s.clients[client.UserID][client]
+}
+
+// enqueueLocal queues a serialized message for its recipients on this
+// instance, holding it for those that have fallen behind and dropping
+// clients too far behind to take it. Shards are locked one at a time, so a
+// shard's loop can call it.
+func (h *Hub) enqueueLocal(msg *Message, data []byte) {
+	shards := h.shards
+	if msg.Audience == nil && msg.Type != MessageTypeTyping {
+		shards = []*hubShard{h.shardFor(msg.UserID)}
+	}
+	var pending []pendingHold
+	for _, s := range shards {
+		s.mu.RLock()
+		for _, client := range s.recipients(msg) {
+			if client.enqueue(msg.Type, data) == needsHold {
+				pending = append(pending, pendingHold{client: client, data: data})
+			}
+		}
+		s.mu.RUnlock()
+	}
+	h.holdPending(pending)
+}
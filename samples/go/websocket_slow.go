@@ -0,0 +1,253 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A client whose chat or crisis queue fills, as on a flaky cellular link,
+// isn't dropped straight away. Further chat is held in Redis in order,
+// crisis alerts only while their own queue is full, and the client is
+// told its connection is degraded:
+//
+//	{"type": "degraded", "metadata": {"degraded": true}}
+//
+// Once its queues empty, held messages are written in batches, coalesced
+// into one frame for clients that take batch messages:
+//
+//	{"type": "batch", "metadata": {"messages": [...]}}
+//
+// and a degraded message with degraded false follows the last of them. A
+// client still behind after SlowClientTimeout, or with OverflowLimit
+// messages held, is dropped to reconnect and replay.
+const overflowBatch = 50 // Held messages written per frame
+
+// overflowKey holds the messages waiting for a slow client
+func overflowKey(clientID string) string {
+	return fmt.Sprintf("lilo:websocket:overflow:%s", clientID)
+}
+
+// slowClientMetrics tracks slow client handling across the hub's clients
+var slowClientMetrics = struct {
+	degraded prometheus.Counter
+	held     prometheus.Counter
+	dropped  prometheus.Counter
+}{
+	degraded: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "degraded_clients_total",
+		Help:      "Times a client fell behind and had messages held for it.",
+	}),
+	held: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "held_messages_total",
+		Help:      "Messages held in Redis for clients that had fallen behind.",
+	}),
+	dropped: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "lilo_websocket",
+		Name:      "slow_clients_dropped_total",
+		Help:      "Clients disconnected for staying too far behind.",
+	}),
+}
+
+// SlowClientCollectors returns the slow client collectors for registration
+// with the process metrics registry
+func SlowClientCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		slowClientMetrics.degraded,
+		slowClientMetrics.held,
+		slowClientMetrics.dropped,
+	}
+}
+
+// degraded reports whether the client has messages held for it
+func (c *Client) degraded() bool {
+	c.overflowMu.Lock()
+	defer c.overflowMu.Unlock()
+	return !c.slowSince.IsZero()
+}
+
+// hold queues a message in Redis behind those already held for the client,
+// marking it degraded if it wasn't. It returns false when the client has
+// been behind for SlowClientTimeout or has OverflowLimit messages held, or
+// the message can't be held, and should be dropped. It writes to Redis, so
+// it is called through holdPending once shard locks are released.
+func (c *Client) hold(data []byte) bool {
+	h := c.Hub
+	c.overflowMu.Lock()
+	defer c.overflowMu.Unlock()
+
+	now := time.Now()
+	if c.slowSince.IsZero() {
+		c.slowSince = now
+		c.noticeDegraded(true)
+		slowClientMetrics.degraded.Inc()
+		h.logger.Warn("client falling behind, holding messages",
+			slog.String("user_id", c.UserID),
+			slog.String("client_id", c.ID),
+		)
+	} else if now.Sub(c.slowSince) > h.config.SlowClientTimeout {
+		slowClientMetrics.dropped.Inc()
+		return false
+	}
+
+	key := overflowKey(c.ID)
+	var held *redis.IntCmd
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		held = pipe.RPush(h.ctx, key, data)
+		pipe.Expire(h.ctx, key, h.config.SlowClientTimeout)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("failed to hold message for slow client",
+			slog.String("user_id", c.UserID),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	if held.Val() > int64(h.config.OverflowLimit) {
+		slowClientMetrics.dropped.Inc()
+		return false
+	}
+	slowClientMetrics.held.Inc()
+	return true
+}
+
+// pendingHold is a message enqueue couldn't queue, to be held once the
+// shard lock is released
+type pendingHold struct {
+	client *Client
+	data   []byte
+}
+
+// holdPending holds messages for clients that have fallen behind, in order,
+// and drops clients too far behind to take more. Holding writes to Redis,
+// so callers must not hold a shard lock.
+func (h *Hub) holdPending(pending []pendingHold) {
+	var dropped map[*Client]bool
+	for _, p := range pending {
+		if dropped[p.client] {
+			continue
+		}
+		if !p.client.hold(p.data) {
+			if dropped == nil {
+				dropped = make(map[*Client]bool)
+			}
+			dropped[p.client] = true
+			// Client too far behind for too long, close connection. Its
+			// shard's loop may be running this, so it can't take the
+			// unregister yet.
+			go h.leave(p.client)
+		}
+	}
+}
+
+// writeHeld writes the next batch of held messages, and ends degraded
+// handling once none are left. The write pump calls it when the client's
+// queues are empty; an error closes the connection.
+func (c *Client) writeHeld() error {
+	h := c.Hub
+	c.overflowMu.Lock()
+	key := overflowKey(c.ID)
+	var batch *redis.StringSliceCmd
+	_, err := h.redis.TxPipelined(h.ctx, func(pipe redis.Pipeliner) error {
+		batch = pipe.LRange(h.ctx, key, 0, overflowBatch-1)
+		pipe.LTrim(h.ctx, key, overflowBatch, -1)
+		return nil
+	})
+	if err != nil {
+		c.overflowMu.Unlock()
+		return fmt.Errorf("failed to load held messages: %w", err)
+	}
+	held := batch.Val()
+	caughtUp := len(held) < overflowBatch
+	if caughtUp {
+		c.slowSince = time.Time{}
+	}
+	c.overflowMu.Unlock()
+
+	if err := c.writeBatch(held); err != nil {
+		return err
+	}
+	if caughtUp {
+		c.noticeDegraded(false)
+	}
+	return nil
+}
+
+// writeBatch writes messages in one batch frame if the client takes them,
+// or one by one
+func (c *Client) writeBatch(messages []string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var frames [][]byte
+	if c.Capabilities.handles(MessageTypeBatch) && len(messages) > 1 {
+		raw := make([]json.RawMessage, len(messages))
+		for i, data := range messages {
+			raw[i] = json.RawMessage(data)
+		}
+		envelope, err := json.Marshal(&Message{
+			Type:      MessageTypeBatch,
+			UserID:    c.UserID,
+			SessionID: c.SessionID,
+			Metadata:  map[string]interface{}{"messages": raw},
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		frames = append(frames, envelope)
+	} else {
+		for _, data := range messages {
+			frames = append(frames, []byte(data))
+		}
+	}
+
+	for _, frame := range frames {
+		if err := c.writeFrame(websocket.TextMessage, frame); err != nil {
+			return err
+		}
+	}
+	for _, data := range messages {
+		c.markDelivered([]byte(data))
+	}
+	return nil
+}
+
+// noticeDegraded tells the client whether messages are being held for it,
+// on the low lane, which has room while the chat lane is full
+func (c *Client) noticeDegraded(degraded bool) {
+	if !c.Capabilities.handles(MessageTypeDegraded) {
+		return
+	}
+	data, err := json.Marshal(&Message{
+		Type:      MessageTypeDegraded,
+		UserID:    c.UserID,
+		SessionID: c.SessionID,
+		Metadata:  map[string]interface{}{"degraded": degraded},
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case c.low <- data:
+	default:
+	}
+}
+
+// discardHeld drops any messages still held for a client that has gone;
+// it replays them from its last seq on reconnect
+func (c *Client) discardHeld() {
+	if c.degraded() {
+		c.Hub.redis.Del(c.Hub.ctx, overflowKey(c.ID))
+	}
+}
@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"time"
+)
+
+// Clients send a typing message per keystroke, or a batch of them, and
+// one with state stop when the user clears the input. The hub coalesces
+// them into one typing message with state start when a user begins and
+// one with state stop when they stop or go quiet for TypingTimeout:
+//
+//	{"type": "typing", "metadata": {"state": "start"}}
+//
+// Sending a chat message ends typing without a stop; clients clear the
+// indicator when the message arrives. Typing state goes only to the other
+// participants of the sender's session, and isn't numbered, persisted or
+// tracked for receipts.
+const (
+	typingStart = "start"
+	typingStop  = "stop"
+)
+
+// updateTyping takes a typing message from the client, passing on a
+// change of state and absorbing the rest
+func (c *Client) updateTyping(msg *Message) {
+	timeout := c.Hub.config.TypingTimeout
+	stopping := msg.Metadata["state"] == typingStop
+
+	c.mu.Lock()
+	typing := c.typingTimer != nil
+	switch {
+	case !stopping && typing:
+		c.typingUntil = time.Now().Add(timeout)
+		c.mu.Unlock()
+		return
+	case !stopping:
+		c.typingUntil = time.Now().Add(timeout)
+		c.typingTimer = time.AfterFunc(timeout, c.typingIdle)
+	case typing:
+		c.typingTimer.Stop()
+		c.typingTimer = nil
+	default:
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	state := typingStart
+	if stopping {
+		state = typingStop
+	}
+	c.sendTyping(state)
+}
+
+// typingIdle stops typing once the client has gone TypingTimeout without
+// a typing message, or waits out the rest of it
+func (c *Client) typingIdle() {
+	c.mu.Lock()
+	if c.typingTimer == nil {
+		c.mu.Unlock()
+		return
+	}
+	if remaining := time.Until(c.typingUntil); remaining > 0 {
+		c.typingTimer.Reset(remaining)
+		c.mu.Unlock()
+		return
+	}
+	c.typingTimer = nil
+	c.mu.Unlock()
+
+	c.sendTyping(typingStop)
+}
+
+// clearTyping ends typing without telling the session, as when the
+// client sends the message it was typing
+func (c *Client) clearTyping() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.typingTimer != nil {
+		c.typingTimer.Stop()
+		c.typingTimer = nil
+	}
+}
+
+// sendTyping tells the client's session its user's typing state
+func (c *Client) sendTyping(state string) {
+	c.Hub.submit(&Message{
+		Type:      MessageTypeTyping,
+		UserID:    c.UserID,
+		SenderID:  c.UserID,
+		SessionID: c.SessionID,
+		Metadata:  map[string]interface{}{"state": state},
+		Timestamp: time.Now(),
+	})
+}
+
+// sessionParticipants returns the shard's clients in a typing message's
+// session, other than the sender's. Callers hold s.mu.
+func (s *hubShard) sessionParticipants(msg *Message) []*Client {
+	var participants []*Client
+	if msg.SessionID == "" {
+		return participants
+	}
+	for userID, clients := range s.clients {
+		if userID == msg.SenderID {
+			continue
+		}
+		for client := range clients {
+			if client.SessionID == msg.SessionID {
+				participants = append(participants, client)
+			}
+		}
+	}
+	return participants
+}